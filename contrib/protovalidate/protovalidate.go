@@ -0,0 +1,66 @@
+// Package protovalidate 用 buf.build/go/protovalidate 实现 pkg/api/validate.Validator:
+// 按 .proto 里的 buf.validate 注解(含 CEL 自定义规则)校验 protobuf 消息,违规转换为
+// errors.FieldViolation,字段路径用 protovalidate 的规范写法(如 "items[0].qty"、`labels["k"]`)。
+//
+//	v, err := protovalidate.New()
+//	srv := grpc.NewServer(
+//	    grpc.ChainUnaryInterceptor(validate.UnaryServerInterceptor(v)),
+//	    grpc.ChainStreamInterceptor(validate.StreamServerInterceptor(v)),
+//	)
+//
+// 非 protobuf 的值直接放行;需要同时校验 struct tag 时用 validate.Chain(validate.New(), v)。
+package protovalidate
+
+import (
+	"context"
+	"errors"
+
+	pv "buf.build/go/protovalidate"
+	"github.com/rushteam/beauty/pkg/api/validate"
+	"google.golang.org/protobuf/proto"
+)
+
+// Validator 包装 protovalidate.Validator。
+type Validator struct {
+	pv pv.Validator
+}
+
+var _ validate.Validator = (*Validator)(nil)
+
+// New 创建 Validator,opts 透传给 protovalidate.New(如 WithMessages 预编译、WithFailFast)。
+func New(opts ...pv.ValidatorOption) (*Validator, error) {
+	v, err := pv.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{pv: v}, nil
+}
+
+// Wrap 包装已有的 protovalidate.Validator。
+func Wrap(v pv.Validator) *Validator { return &Validator{pv: v} }
+
+// Validate 实现 validate.Validator。规则违规返回 InvalidArgument 的 *errors.Status;
+// 规则编译/运行期错误(注解写错、CEL 表达式异常)原样返回,拦截器会映射为 Internal。
+func (v *Validator) Validate(_ context.Context, x any) error {
+	msg, ok := x.(proto.Message)
+	if !ok {
+		return nil
+	}
+	err := v.pv.Validate(msg)
+	if err == nil {
+		return nil
+	}
+	var ve *pv.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	var vs validate.Violations
+	for _, viol := range ve.Violations {
+		desc := viol.Proto.GetMessage()
+		if desc == "" {
+			desc = "violates " + viol.Proto.GetRuleId()
+		}
+		vs.Add(pv.FieldPathString(viol.Proto.GetField()), desc)
+	}
+	return vs.Err()
+}
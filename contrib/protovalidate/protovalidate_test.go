@@ -0,0 +1,92 @@
+package protovalidate_test
+
+import (
+	"context"
+	"testing"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	pvx "github.com/rushteam/beauty/contrib/protovalidate"
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	bvalidate "github.com/rushteam/beauty/pkg/api/validate"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// orderType 构造带 buf.validate 注解的动态消息类型,等价于:
+//
+//	message Order {
+//	  string email = 1 [(buf.validate.field).string.email = true];
+//	  repeated int32 qty = 2 [(buf.validate.field).repeated.items.int32.gt = 0];
+//	}
+func orderType(t *testing.T) protoreflect.MessageType {
+	t.Helper()
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, rules *validate.FieldRules) *descriptorpb.FieldDescriptorProto {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, validate.E_Field, rules)
+		return &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(num),
+			Type: typ.Enum(), Label: label.Enum(), Options: opts,
+		}
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/order.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("email", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL,
+					validate.FieldRules_builder{String: validate.StringRules_builder{Email: proto.Bool(true)}.Build()}.Build()),
+				field("qty", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_LABEL_REPEATED,
+					validate.FieldRules_builder{Repeated: validate.RepeatedRules_builder{
+						Items: validate.FieldRules_builder{Int32: validate.Int32Rules_builder{Gt: proto.Int32(0)}.Build()}.Build(),
+					}.Build()}.Build()),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dynamicpb.NewMessageType(fd.Messages().ByName("Order"))
+}
+
+func TestValidator(t *testing.T) {
+	typ := orderType(t)
+	v, err := pvx.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := typ.New()
+	msg.Set(typ.Descriptor().Fields().ByName("email"), protoreflect.ValueOfString("nope"))
+	qty := msg.Mutable(typ.Descriptor().Fields().ByName("qty")).List()
+	qty.Append(protoreflect.ValueOfInt32(2))
+	qty.Append(protoreflect.ValueOfInt32(0))
+
+	st, ok := perr.FromError(v.Validate(context.Background(), msg.Interface()))
+	if !ok || st.Code() != perr.CodeInvalidArgument {
+		t.Fatalf("want InvalidArgument, got %v", st)
+	}
+	got := map[string]string{}
+	for _, fv := range bvalidate.FromStatus(st) {
+		got[fv.Field] = fv.Description
+	}
+	if got["email"] == "" || got["qty[1]"] != "must be greater than 0" || len(got) != 2 {
+		t.Fatalf("violations=%v", got)
+	}
+
+	msg.Set(typ.Descriptor().Fields().ByName("email"), protoreflect.ValueOfString("a@example.com"))
+	qty.Set(1, protoreflect.ValueOfInt32(1))
+	if err := v.Validate(context.Background(), msg.Interface()); err != nil {
+		t.Fatalf("valid message: %v", err)
+	}
+	if err := v.Validate(context.Background(), struct{}{}); err != nil {
+		t.Fatalf("non-proto value should pass: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package redisqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rushteam/beauty/pkg/orchestration/jobqueue"
+)
+
+// JobBackend 把 pkg/orchestration/jobqueue 的任务记录存入 Redis(jobqueue.Backend),
+// 使进程内 jobqueue 的任务在重启后恢复,并可被其它进程查询(dashboard)。
+// 调度仍在 jobqueue 进程内:同一 name 只应由一个 jobqueue.Queue 写入;需要多进程共同消费时用 Queue。
+//
+// 数据结构:
+//   - {prefix}:{name}:record:{id}  — String(jobqueue.Record 的 JSON)
+//   - {prefix}:{name}:index:{state} — Sorted Set(score=CreatedAt unix 毫秒,member=id)
+//   - {prefix}:{name}:index:all     — Sorted Set(同上,全部状态)
+type JobBackend struct {
+	rdb    redis.Cmdable
+	name   string
+	prefix string
+}
+
+var _ jobqueue.Backend = (*JobBackend)(nil)
+
+// NewJobBackend 创建 jobqueue 的 Redis 后端。name 是命名空间,opts 中只有 WithPrefix 生效。
+//
+//	q := jobqueue.New(jobqueue.WithBackend(redisqueue.NewJobBackend(rdb, "mail")))
+func NewJobBackend(rdb redis.Cmdable, name string, opts ...Option) *JobBackend {
+	cfg := Config{Prefix: "bq"}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &JobBackend{rdb: rdb, name: name, prefix: cfg.Prefix}
+}
+
+func (b *JobBackend) recordKey(id string) string {
+	return fmt.Sprintf("%s:%s:record:%s", b.prefix, b.name, id)
+}
+
+func (b *JobBackend) indexKey(state string) string {
+	return fmt.Sprintf("%s:%s:index:%s", b.prefix, b.name, state)
+}
+
+func (b *JobBackend) Save(ctx context.Context, rec *jobqueue.Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	old, err := b.Get(ctx, rec.ID)
+	if err != nil && !errors.Is(err, jobqueue.ErrNotFound) {
+		return err
+	}
+	z := redis.Z{Score: float64(rec.CreatedAt.UnixMilli()), Member: rec.ID}
+	pipe := b.rdb.TxPipeline()
+	pipe.Set(ctx, b.recordKey(rec.ID), data, 0)
+	if old != nil && old.State != rec.State {
+		pipe.ZRem(ctx, b.indexKey(old.State.String()), rec.ID)
+	}
+	pipe.ZAdd(ctx, b.indexKey(rec.State.String()), z)
+	pipe.ZAdd(ctx, b.indexKey("all"), z)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redisqueue: save record: %w", err)
+	}
+	return nil
+}
+
+func (b *JobBackend) Delete(ctx context.Context, id string) error {
+	old, err := b.Get(ctx, id)
+	if errors.Is(err, jobqueue.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pipe := b.rdb.TxPipeline()
+	pipe.Del(ctx, b.recordKey(id))
+	pipe.ZRem(ctx, b.indexKey(old.State.String()), id)
+	pipe.ZRem(ctx, b.indexKey("all"), id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (b *JobBackend) Get(ctx context.Context, id string) (*jobqueue.Record, error) {
+	data, err := b.rdb.Get(ctx, b.recordKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, jobqueue.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec := new(jobqueue.Record)
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List 按索引分批扫描。只查一个状态时走该状态的索引,否则走全量索引再过滤。
+// 顺序为 (CreatedAt 毫秒, ID),游标按同样的粒度比较。
+func (b *JobBackend) List(ctx context.Context, f jobqueue.Filter) ([]*jobqueue.Record, error) {
+	index := b.indexKey("all")
+	if len(f.States) == 1 {
+		index = b.indexKey(f.States[0].String())
+	}
+	cursored := !f.AfterCreated.IsZero() || f.AfterID != ""
+	afterMs := f.AfterCreated.UnixMilli()
+	min := "-inf"
+	if cursored {
+		min = strconv.FormatInt(afterMs, 10)
+	}
+	const batch = 256
+	var out []*jobqueue.Record
+	for offset := int64(0); ; offset += batch {
+		ids, err := b.rdb.ZRangeByScore(ctx, index, &redis.ZRangeBy{Min: min, Max: "+inf", Offset: offset, Count: batch}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return out, nil
+		}
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = b.recordKey(id)
+		}
+		vals, err := b.rdb.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			s, ok := v.(string)
+			if !ok {
+				continue // 扫描期间被删除
+			}
+			rec := new(jobqueue.Record)
+			if err := json.Unmarshal([]byte(s), rec); err != nil {
+				return nil, err
+			}
+			if cursored && !afterCursor(rec, afterMs, f.AfterID) || !f.Match(rec) {
+				continue
+			}
+			out = append(out, rec)
+			if f.Limit > 0 && len(out) == f.Limit {
+				return out, nil
+			}
+		}
+		if len(ids) < batch {
+			return out, nil
+		}
+	}
+}
+
+func afterCursor(rec *jobqueue.Record, afterMs int64, afterID string) bool {
+	if ms := rec.CreatedAt.UnixMilli(); ms != afterMs {
+		return ms > afterMs
+	}
+	return rec.ID > afterID
+}
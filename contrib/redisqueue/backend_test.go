@@ -0,0 +1,70 @@
+package redisqueue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rushteam/beauty/pkg/orchestration/jobqueue"
+)
+
+func TestJobBackend(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	backend := NewJobBackend(rdb, "mail")
+
+	// 第一个进程:投递后未启动即退出
+	q1 := jobqueue.New(jobqueue.WithBackend(backend))
+	q1.Handle("send", func(context.Context, *jobqueue.Job) error { return nil })
+	for _, id := range []string{"m-1", "m-2", "m-3"} {
+		if err := q1.Add(ctx, &jobqueue.Job{ID: id, Name: "send", Payload: map[string]string{"to": id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q1.Stop()
+	page, err := q1.Jobs(ctx, "", 2, jobqueue.StateWaiting)
+	if err != nil || len(page.Items) != 2 || page.Next == "" {
+		t.Fatalf("page = %+v, err = %v", page, err)
+	}
+	page, err = q1.Jobs(ctx, page.Next, 2, jobqueue.StateWaiting)
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != "m-3" || page.Next != "" {
+		t.Fatalf("page = %+v, err = %v", page, err)
+	}
+
+	// 重启:从 Redis 恢复并执行
+	var sent atomic.Int32
+	q2 := jobqueue.New(jobqueue.WithBackend(backend), jobqueue.WithKeepFinished(-1))
+	q2.Handle("send", func(ctx context.Context, job *jobqueue.Job) error {
+		var m map[string]string
+		if err := job.Decode(&m); err != nil || m["to"] != job.ID {
+			t.Errorf("payload of %s = %v, %v", job.ID, m, err)
+		}
+		sent.Add(1)
+		return nil
+	})
+	go q2.Start(ctx)
+	t.Cleanup(q2.Stop)
+	deadline := time.Now().Add(3 * time.Second)
+	for sent.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if page, _ := q2.Jobs(ctx, "", 0, jobqueue.StateCompleted); len(page.Items) != 3 {
+		t.Fatalf("completed = %+v", page.Items)
+	}
+	if n, _ := rdb.ZCard(ctx, "bq:mail:index:waiting").Result(); n != 0 {
+		t.Fatalf("waiting index = %d", n)
+	}
+	if err := backend.Delete(ctx, "m-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Get(ctx, "m-1"); err != jobqueue.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package sqldb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect 是数据库方言,决定占位符写法与建表语句的差异。outbox / inbox / sagastore / workflowstore
+// 共用它:查询统一用 ? 书写,执行前经 Rebind 改写。
+type Dialect int
+
+const (
+	MySQL    Dialect = iota // MySQL / MariaDB(默认),? 占位符
+	Postgres                // PostgreSQL,$n 占位符
+	SQLite                  // SQLite,? 占位符
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case SQLite:
+		return "sqlite"
+	default:
+		return "mysql"
+	}
+}
+
+// Rebind 把 query 中的 ? 占位符按方言改写:Postgres 依次改为 $1, $2…,其它方言原样返回。
+// 不识别字符串字面量,query 里的 ? 须都是占位符。
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -6,6 +6,7 @@ toolchain go1.26.5
 
 require (
 	github.com/XSAM/otelsql v0.43.0
+	github.com/rushteam/beauty v0.7.5
 	modernc.org/sqlite v1.54.0
 )
 
@@ -0,0 +1,223 @@
+// Package inbox 是 pkg/messaging/mq/inbox 的 SQL 去重存储(inbox.Store):已处理消息记在一张
+// inbox 表里,基于 database/sql,可直接使用 sqldb 的 Writer() / *sql.DB。
+//
+// 两种模式:
+//
+//   - New:普通模式。占位、完成、撤销各自是一条独立语句,语义同 KV 存储(at-least-once:
+//     handler 成功但 Commit 前崩溃会再执行一次)。
+//   - NewTransactional:事务模式。Claim 开启事务并在事务内写去重记录,handler 用 Tx(ctx)
+//     取出同一事务写业务数据,成功后一起提交、失败一起回滚——"已处理"标记与业务写原子生效。
+//
+// 事务模式用法:
+//
+//	store := inbox.NewTransactional(sdb.Primary(), inbox.WithDialect(sqldb.Postgres))
+//	_ = store.Migrate(ctx)
+//	h := mq.Chain(func(ctx context.Context, m mq.Message) error {
+//	    return q.WithTx(inbox.Tx(ctx)).ApplyPayment(ctx, decode(m))
+//	}, mq.Recover(), mq.Retry(3, 100*time.Millisecond), mqinbox.Dedup(store, "billing"))
+//
+// 事务模式下 mq.Retry 必须在 Dedup 外层:每次尝试各开一个事务,失败即回滚。放在内层时多次尝试
+// 共用一个事务,失败尝试的写入会随成功的那次一起提交。handler panic 时 Dedup 会先 Release(回滚),
+// 事务与连接不会泄漏。
+//
+// 表结构(Migrate 创建,也可用 Schema 交给自己的迁移工具):
+//
+//	CREATE TABLE inbox (
+//	    msg_key    VARCHAR(191) PRIMARY KEY, -- "{consumer}:{消息 ID}"
+//	    status     VARCHAR(16)  NOT NULL,    -- processing / done
+//	    expires_at BIGINT       NOT NULL     -- unix 毫秒,过期后可被重新占位、由 Cleanup 删除
+//	);
+//
+// 记录按 TTL 过期,定期调用 Cleanup 删除过期行,例如
+// worker.NewTicker("inbox-cleanup", time.Hour, func(ctx context.Context) { store.Cleanup(ctx) })。
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/messaging/mq/inbox"
+)
+
+const (
+	statusProcessing = "processing"
+	statusDone       = "done"
+)
+
+var txKey = ctxkey.New[*sql.Tx]()
+
+// Tx 返回事务模式下 Claim 开启的事务;不在事务模式(或不在 Dedup 的 handler 内)时返回 nil。
+func Tx(ctx context.Context) *sql.Tx {
+	tx, _ := ctxkey.Get(ctx, txKey)
+	return tx
+}
+
+// Store 实现 inbox.Store。零值不可用,用 New / NewTransactional 构造。
+type Store struct {
+	db      sqldb.DBTX
+	begin   *sql.DB // 非 nil 为事务模式
+	table   string
+	dialect sqldb.Dialect
+}
+
+var _ inbox.Store = (*Store)(nil)
+
+// Option 配置 Store。
+type Option func(*Store)
+
+// WithTable 设置表名,默认 "inbox"。
+func WithTable(name string) Option {
+	return func(s *Store) { s.table = name }
+}
+
+// WithDialect 设置数据库方言(决定建表语句与占位符),默认 sqldb.MySQL。
+func WithDialect(d sqldb.Dialect) Option {
+	return func(s *Store) { s.dialect = d }
+}
+
+// New 创建普通模式的 Store。db 须指向主库。
+func New(db sqldb.DBTX, opts ...Option) *Store {
+	s := &Store{db: db, table: "inbox"}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// NewTransactional 创建事务模式的 Store:每条消息在 db 上开一个事务,去重记录与 handler
+// 经 Tx(ctx) 做的业务写同一事务提交。
+func NewTransactional(db *sql.DB, opts ...Option) *Store {
+	s := New(db, opts...)
+	s.begin = db
+	return s
+}
+
+// Schema 返回建表语句(三种方言通用),可交给自己的迁移工具。
+func (s *Store) Schema() []string {
+	return []string{`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+	msg_key VARCHAR(191) NOT NULL PRIMARY KEY,
+	status VARCHAR(16) NOT NULL,
+	expires_at BIGINT NOT NULL
+)`}
+}
+
+// Migrate 建表(已存在则跳过)。
+func (s *Store) Migrate(ctx context.Context) error {
+	for _, stmt := range s.Schema() {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("inbox: migrate %s: %w", s.table, err)
+		}
+	}
+	return nil
+}
+
+// Claim 实现 inbox.Store。事务模式下返回的 ctx 携带事务(Tx 取出),Commit 提交、Release 回滚。
+func (s *Store) Claim(ctx context.Context, key string, lease time.Duration) (context.Context, inbox.Status, error) {
+	if s.begin == nil {
+		st, err := s.claim(ctx, s.db, key, statusProcessing, lease)
+		return ctx, st, err
+	}
+	tx, err := s.begin.BeginTx(ctx, nil)
+	if err != nil {
+		return ctx, inbox.Claimed, err
+	}
+	// 事务内直接写 done:未提交前其它事务看不到,并发的同 key 插入会等待本事务结束
+	st, err := s.claim(ctx, tx, key, statusDone, lease)
+	if err != nil || st != inbox.Claimed {
+		_ = tx.Rollback()
+		return ctx, st, err
+	}
+	return ctxkey.With(ctx, txKey, tx), inbox.Claimed, nil
+}
+
+// claim 插入占位行;已存在时按状态与是否过期判定,过期行被条件更新接管。
+func (s *Store) claim(ctx context.Context, db sqldb.DBTX, key, status string, lease time.Duration) (inbox.Status, error) {
+	now := time.Now()
+	expires := now.Add(lease).UnixMilli()
+	res, err := db.ExecContext(ctx, s.insertIgnore(), key, status, expires)
+	if err != nil {
+		return inbox.Claimed, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return inbox.Claimed, err
+	} else if n == 1 {
+		return inbox.Claimed, nil
+	}
+	var cur string
+	var curExpires int64
+	err = db.QueryRowContext(ctx, s.q(`SELECT status, expires_at FROM `+s.table+` WHERE msg_key = ?`), key).Scan(&cur, &curExpires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return inbox.InProgress, nil // 刚被删除,交给下一次投递
+	}
+	if err != nil {
+		return inbox.Claimed, err
+	}
+	if curExpires > now.UnixMilli() {
+		if cur == statusDone {
+			return inbox.Duplicate, nil
+		}
+		return inbox.InProgress, nil
+	}
+	res, err = db.ExecContext(ctx, s.q(`UPDATE `+s.table+` SET status = ?, expires_at = ? WHERE msg_key = ? AND expires_at = ?`),
+		status, expires, key, curExpires)
+	if err != nil {
+		return inbox.Claimed, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return inbox.Claimed, err
+	}
+	return inbox.InProgress, nil
+}
+
+// Commit 实现 inbox.Store。
+func (s *Store) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	tx := Tx(ctx)
+	var db sqldb.DBTX = s.db
+	if tx != nil {
+		db = tx
+	}
+	if _, err := db.ExecContext(ctx, s.q(`UPDATE `+s.table+` SET status = ?, expires_at = ? WHERE msg_key = ?`),
+		statusDone, time.Now().Add(ttl).UnixMilli(), key); err != nil {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+		return err
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// Release 实现 inbox.Store。事务模式下回滚事务(业务写一并撤销)。
+func (s *Store) Release(ctx context.Context, key string) error {
+	if tx := Tx(ctx); tx != nil {
+		return tx.Rollback()
+	}
+	_, err := s.db.ExecContext(ctx, s.q(`DELETE FROM `+s.table+` WHERE msg_key = ? AND status = ?`), key, statusProcessing)
+	return err
+}
+
+// Cleanup 删除已过期的记录,返回删除的行数。
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.q(`DELETE FROM `+s.table+` WHERE expires_at < ?`), time.Now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("inbox: cleanup: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) insertIgnore() string {
+	if s.dialect == sqldb.MySQL {
+		return `INSERT IGNORE INTO ` + s.table + ` (msg_key, status, expires_at) VALUES (?, ?, ?)`
+	}
+	return s.q(`INSERT INTO ` + s.table + ` (msg_key, status, expires_at) VALUES (?, ?, ?) ON CONFLICT (msg_key) DO NOTHING`)
+}
+
+// q 把 ? 占位符按方言改写。
+func (s *Store) q(query string) string { return s.dialect.Rebind(query) }
@@ -0,0 +1,146 @@
+package inbox_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+	"github.com/rushteam/beauty/contrib/sqldb/inbox"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	mqinbox "github.com/rushteam/beauty/pkg/messaging/mq/inbox"
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func withID(id string) mq.Message {
+	return mq.Message{Topic: "payments", Body: []byte("30"), Headers: map[string]string{mqinbox.HeaderMessageID: id}}
+}
+
+func TestTransactional(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	if _, err := db.Exec(`CREATE TABLE ledger (msg TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	store := inbox.NewTransactional(db, inbox.WithDialect(sqldb.SQLite))
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fail := true
+	h := mq.Chain(func(ctx context.Context, m mq.Message) error {
+		tx := inbox.Tx(ctx)
+		if tx == nil {
+			return errors.New("no tx in handler ctx")
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO ledger (msg) VALUES (?)`, m.Headers[mqinbox.HeaderMessageID]); err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("downstream failed after writing")
+		}
+		return nil
+	}, mqinbox.Dedup(store, "billing"))
+
+	if err := h(ctx, withID("p-1")); err == nil {
+		t.Fatal("first delivery should fail")
+	}
+	fail = false
+	for range 3 {
+		if err := h(ctx, withID("p-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rows, marks int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM ledger`).Scan(&rows)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM inbox WHERE status = 'done'`).Scan(&marks)
+	if rows != 1 || marks != 1 {
+		t.Errorf("ledger rows = %d, inbox marks = %d; want exactly one of each", rows, marks)
+	}
+}
+
+// TestTransactional_PanicRollsBack:handler panic 时事务被回滚、连接归还(池里只有一个连接,
+// 泄漏会让后续查询一直阻塞),重投可以重新处理。
+func TestTransactional_PanicRollsBack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db := openDB(t)
+	store := inbox.NewTransactional(db, inbox.WithDialect(sqldb.SQLite))
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	h := mq.Chain(func(context.Context, mq.Message) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return nil
+	}, mq.Recover(), mqinbox.Dedup(store, "billing"))
+
+	if err := h(ctx, withID("p-9")); err == nil {
+		t.Fatal("panicking delivery should fail")
+	}
+	if err := h(ctx, withID("p-9")); err != nil {
+		t.Fatalf("redelivery after panic: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestStore_LeaseAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	store := inbox.New(openDB(t), inbox.WithDialect(sqldb.SQLite))
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, st, err := store.Claim(ctx, "c:1", time.Minute); err != nil || st != mqinbox.Claimed {
+		t.Fatalf("claim = %v, %v", st, err)
+	}
+	if _, st, _ := store.Claim(ctx, "c:1", time.Minute); st != mqinbox.InProgress {
+		t.Errorf("second claim = %v, want in_progress", st)
+	}
+	if err := store.Commit(ctx, "c:1", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	// 记录过期后允许重新处理
+	if _, st, _ := store.Claim(ctx, "c:1", time.Millisecond); st != mqinbox.Claimed {
+		t.Errorf("claim after ttl = %v, want claimed", st)
+	}
+	// 占位过期(处理者崩溃)后也允许接管
+	time.Sleep(5 * time.Millisecond)
+	if _, st, _ := store.Claim(ctx, "c:1", time.Hour); st != mqinbox.Claimed {
+		t.Errorf("claim after lease = %v, want claimed", st)
+	}
+	if err := store.Release(ctx, "c:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _ = store.Claim(ctx, "c:2", time.Minute)
+	_ = store.Commit(ctx, "c:2", time.Hour)
+	_, _, _ = store.Claim(ctx, "c:3", time.Minute)
+	_ = store.Commit(ctx, "c:3", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n, err := store.Cleanup(ctx); err != nil || n != 1 {
+		t.Errorf("cleanup = %d, %v; want 1", n, err)
+	}
+	if _, st, _ := store.Claim(ctx, "c:2", time.Minute); st != mqinbox.Duplicate {
+		t.Errorf("c:2 = %v, want duplicate", st)
+	}
+}
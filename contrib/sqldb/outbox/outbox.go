@@ -0,0 +1,194 @@
+// Package outbox 是事务性发件箱(transactional outbox):业务写库与"要发的消息"在同一个事务里
+// 落盘,再由 Relay 把发件箱里的消息投给任意 mq.Publisher。进程在任何点崩溃都不会出现
+// "库改了但消息没发"或"消息发了但库回滚"。
+//
+//	box := outbox.New(sdb.Writer(), outbox.WithDialect(sqldb.MySQL))
+//	_ = box.Migrate(ctx)
+//
+//	tx, _ := sdb.Primary().BeginTx(ctx, nil)
+//	q.WithTx(tx).CreateOrder(ctx, p)                                   // 业务写
+//	_ = box.Enqueue(ctx, tx, outbox.Message{Topic: "order.created", Key: p.ID, Payload: body})
+//	_ = tx.Commit()                                                     // 两者一起提交或一起回滚
+//
+//	app := beauty.New(beauty.WithService(outbox.NewRelay(box, publisher,
+//	    outbox.WithLeaderElection(elector)))) // 多副本时只有 leader 投递
+//
+// 表结构(Migrate 创建,也可用 Schema 交给自己的迁移工具),以 MySQL 为例:
+//
+//	CREATE TABLE outbox (
+//	    id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	    topic      VARCHAR(255) NOT NULL,
+//	    msg_key    VARCHAR(191) NOT NULL DEFAULT '', -- 聚合键,同键按 id 顺序投递
+//	    payload    LONGBLOB     NOT NULL,
+//	    headers    TEXT,                             -- map[string]string 的 JSON
+//	    created_at BIGINT       NOT NULL,            -- unix 毫秒
+//	    attempts   INT          NOT NULL DEFAULT 0,  -- 已投递次数(含失败)
+//	    next_at    BIGINT       NOT NULL DEFAULT 0,  -- 失败后下次可重试的时刻(unix 毫秒)
+//	    sent_at    BIGINT,                           -- 投递成功的时刻,NULL 为未发
+//	    failed_at  BIGINT,                           -- 重试用尽的时刻,NULL 为未放弃
+//	    last_error TEXT,
+//	    KEY idx_outbox_pending (sent_at, failed_at, id)
+//	);
+//
+// 投递语义是 at-least-once:发布成功但标记 sent_at 前崩溃会重投,消费端需幂等——每条消息带
+// HeaderID 头(发件箱行 id),可直接作去重键。
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+)
+
+// HeaderID 是 Relay 发布时写入的消息头,值为发件箱行 id(十进制),供消费端去重。
+const HeaderID = "outbox-id"
+
+// Message 是写入发件箱的一条消息,投递时转为 mq.Message。
+type Message struct {
+	Topic   string
+	Key     string // 聚合键(可空):同键消息按写入顺序投递,前一条未成功时后续不投
+	Payload []byte
+	Headers map[string]string
+}
+
+// Outbox 是一张发件箱表。零值不可用,用 New 构造。并发安全。
+type Outbox struct {
+	db      sqldb.DBTX
+	table   string
+	dialect sqldb.Dialect
+	notify  string
+}
+
+// Option 配置 Outbox。
+type Option func(*Outbox)
+
+// WithTable 设置表名,默认 "outbox"。
+func WithTable(name string) Option {
+	return func(o *Outbox) { o.table = name }
+}
+
+// WithDialect 设置数据库方言(决定建表语句与占位符),默认 sqldb.MySQL。
+func WithDialect(d sqldb.Dialect) Option {
+	return func(o *Outbox) { o.dialect = d }
+}
+
+// WithNotify 让 Enqueue 在同一事务里执行 pg_notify(channel),事务提交时 PostgreSQL 通知所有
+// LISTEN 该 channel 的连接,Relay 经 WithWakeup 收到后立即投递而不必等下一次轮询。仅 Postgres 生效。
+func WithNotify(channel string) Option {
+	return func(o *Outbox) { o.notify = channel }
+}
+
+// New 创建基于 db 的 Outbox。db 须指向主库,Relay 与 Migrate 都走它;Enqueue 使用调用方传入的事务。
+func New(db sqldb.DBTX, opts ...Option) *Outbox {
+	o := &Outbox{db: db, table: "outbox"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Table 返回表名。
+func (o *Outbox) Table() string { return o.table }
+
+// Schema 返回当前方言的建表语句(含索引),可交给自己的迁移工具。
+func (o *Outbox) Schema() []string {
+	t := o.table
+	switch o.dialect {
+	case sqldb.Postgres:
+		return []string{`CREATE TABLE IF NOT EXISTS ` + t + ` (
+	id BIGSERIAL PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(191) NOT NULL DEFAULT '',
+	payload BYTEA NOT NULL,
+	headers TEXT,
+	created_at BIGINT NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_at BIGINT NOT NULL DEFAULT 0,
+	sent_at BIGINT,
+	failed_at BIGINT,
+	last_error TEXT
+)`, `CREATE INDEX IF NOT EXISTS idx_` + t + `_pending ON ` + t + ` (id) WHERE sent_at IS NULL AND failed_at IS NULL`}
+	case sqldb.SQLite:
+		return []string{`CREATE TABLE IF NOT EXISTS ` + t + ` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic TEXT NOT NULL,
+	msg_key TEXT NOT NULL DEFAULT '',
+	payload BLOB NOT NULL,
+	headers TEXT,
+	created_at INTEGER NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_at INTEGER NOT NULL DEFAULT 0,
+	sent_at INTEGER,
+	failed_at INTEGER,
+	last_error TEXT
+)`, `CREATE INDEX IF NOT EXISTS idx_` + t + `_pending ON ` + t + ` (sent_at, failed_at, id)`}
+	default:
+		return []string{`CREATE TABLE IF NOT EXISTS ` + t + ` (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(191) NOT NULL DEFAULT '',
+	payload LONGBLOB NOT NULL,
+	headers TEXT,
+	created_at BIGINT NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_at BIGINT NOT NULL DEFAULT 0,
+	sent_at BIGINT,
+	failed_at BIGINT,
+	last_error TEXT,
+	KEY idx_` + t + `_pending (sent_at, failed_at, id)
+)`}
+	}
+}
+
+// Migrate 建表(已存在则跳过)。
+func (o *Outbox) Migrate(ctx context.Context) error {
+	for _, stmt := range o.Schema() {
+		if _, err := o.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("outbox: migrate %s: %w", o.table, err)
+		}
+	}
+	return nil
+}
+
+// Enqueue 把消息写进发件箱。tx 必须是业务写所在的事务(*sql.Tx 或任何 sqldb.DBTX),
+// 消息随事务提交才对 Relay 可见、随回滚一起丢弃。同一次调用中的多条消息按参数顺序投递。
+func (o *Outbox) Enqueue(ctx context.Context, tx sqldb.DBTX, msgs ...Message) error {
+	now := time.Now().UnixMilli()
+	for _, m := range msgs {
+		var headers any // nil → NULL
+		if len(m.Headers) > 0 {
+			data, err := json.Marshal(m.Headers)
+			if err != nil {
+				return fmt.Errorf("outbox: encode headers: %w", err)
+			}
+			headers = string(data)
+		}
+		payload := m.Payload
+		if payload == nil {
+			payload = []byte{} // payload 列 NOT NULL
+		}
+		if _, err := tx.ExecContext(ctx, o.q(`INSERT INTO `+o.table+` (topic, msg_key, payload, headers, created_at) VALUES (?, ?, ?, ?, ?)`),
+			m.Topic, m.Key, payload, headers, now); err != nil {
+			return fmt.Errorf("outbox: enqueue %s: %w", m.Topic, err)
+		}
+	}
+	if o.dialect == sqldb.Postgres && o.notify != "" && len(msgs) > 0 {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, '')`, o.notify); err != nil {
+			return fmt.Errorf("outbox: notify %s: %w", o.notify, err)
+		}
+	}
+	return nil
+}
+
+// Pending 返回尚未投递(未发且未放弃)的消息数。
+func (o *Outbox) Pending(ctx context.Context) (int, error) {
+	var n int
+	err := o.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+o.table+` WHERE sent_at IS NULL AND failed_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// q 把 ? 占位符按方言改写。
+func (o *Outbox) q(query string) string { return o.dialect.Rebind(query) }
@@ -0,0 +1,217 @@
+package outbox_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+	"github.com/rushteam/beauty/contrib/sqldb/outbox"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
+	_ "modernc.org/sqlite"
+)
+
+// recorder 记录发布的消息;fail 中的 body 首次发布时返回错误。
+type recorder struct {
+	mu   sync.Mutex
+	got  []mq.Message
+	fail map[string]int
+}
+
+func (p *recorder) Publish(_ context.Context, m mq.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[string(m.Body)] > 0 {
+		p.fail[string(m.Body)]--
+		return errors.New("broker down")
+	}
+	p.got = append(p.got, m)
+	return nil
+}
+
+func (p *recorder) bodies() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []string
+	for _, m := range p.got {
+		out = append(out, string(m.Body))
+	}
+	return out
+}
+
+func openBox(t *testing.T) (*sql.DB, *outbox.Outbox) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	box := outbox.New(db, outbox.WithDialect(sqldb.SQLite))
+	if err := box.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := box.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate must be idempotent: %v", err)
+	}
+	return db, box
+}
+
+func TestEnqueueIsTransactional(t *testing.T) {
+	ctx := context.Background()
+	db, box := openBox(t)
+
+	tx, _ := db.BeginTx(ctx, nil)
+	if err := box.Enqueue(ctx, tx, outbox.Message{Topic: "order", Key: "o-1", Payload: []byte("rolled back")}); err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Rollback()
+
+	tx, _ = db.BeginTx(ctx, nil)
+	if err := box.Enqueue(ctx, tx, outbox.Message{Topic: "order", Key: "o-1", Payload: []byte("created"), Headers: map[string]string{"trace": "t1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := box.Pending(ctx); n != 1 {
+		t.Fatalf("pending = %d, want 1", n)
+	}
+
+	pub := &recorder{}
+	relay := outbox.NewRelay(box, pub, outbox.WithRetention(0))
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("RelayOnce = %d, %v", n, err)
+	}
+	m := pub.got[0]
+	if string(m.Body) != "created" || m.Headers["trace"] != "t1" || m.Headers[outbox.HeaderID] == "" {
+		t.Errorf("published %+v", m)
+	}
+	var rows int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM outbox`).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("retention 0 should delete sent rows, %d left", rows)
+	}
+}
+
+func TestRelayOrderPerKeyAndRetry(t *testing.T) {
+	ctx := context.Background()
+	db, box := openBox(t)
+	tx, _ := db.BeginTx(ctx, nil)
+	_ = box.Enqueue(ctx, tx,
+		outbox.Message{Topic: "acct", Key: "a", Payload: []byte("a1")},
+		outbox.Message{Topic: "acct", Key: "b", Payload: []byte("b1")},
+		outbox.Message{Topic: "acct", Key: "a", Payload: []byte("a2")},
+		outbox.Message{Topic: "acct", Key: "b", Payload: []byte("b2")},
+	)
+	_ = tx.Commit()
+
+	pub := &recorder{fail: map[string]int{"a1": 1}}
+	var failures int
+	relay := outbox.NewRelay(box, pub,
+		outbox.WithRetry(backoff.New(backoff.WithBase(20*time.Millisecond), backoff.WithJitter(backoff.JitterNone))),
+		outbox.WithOnError(func(context.Context, int64, outbox.Message, error) { failures++ }))
+
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("first round = %d, %v", n, err)
+	}
+	if got := pub.bodies(); len(got) != 2 || got[0] != "b1" || got[1] != "b2" {
+		t.Fatalf("key a must wait for a1, got %v", got)
+	}
+	// 退避期内 a1 不重试,a2 也不越过它
+	if n, _ := relay.RelayOnce(ctx); n != 0 {
+		t.Fatalf("backoff ignored: sent %d", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("retry round = %d, %v", n, err)
+	}
+	if got := pub.bodies(); got[2] != "a1" || got[3] != "a2" || failures != 1 {
+		t.Errorf("got %v, failures %d", got, failures)
+	}
+
+	// 已发送行保留到保留期之后才被清理
+	if n, _ := relay.Cleanup(ctx); n != 0 {
+		t.Errorf("cleanup removed %d rows inside retention", n)
+	}
+	expired := outbox.NewRelay(box, pub, outbox.WithRetention(time.Nanosecond))
+	time.Sleep(2 * time.Millisecond)
+	if n, err := expired.Cleanup(ctx); err != nil || n != 4 {
+		t.Errorf("cleanup = %d, %v", n, err)
+	}
+}
+
+// 某个键的积压超过一批且队首在退避时,不能占满批次饿住其它键。
+func TestRelayBlockedKeyDoesNotStarveOthers(t *testing.T) {
+	ctx := context.Background()
+	db, box := openBox(t)
+	tx, _ := db.BeginTx(ctx, nil)
+	for i := range 5 {
+		_ = box.Enqueue(ctx, tx, outbox.Message{Topic: "t", Key: "hot", Payload: []byte(fmt.Sprintf("hot%d", i))})
+	}
+	_ = box.Enqueue(ctx, tx, outbox.Message{Topic: "t", Key: "cold", Payload: []byte("cold")})
+	_ = tx.Commit()
+
+	pub := &recorder{fail: map[string]int{"hot0": 100}}
+	relay := outbox.NewRelay(box, pub, outbox.WithBatchSize(2),
+		outbox.WithRetry(backoff.New(backoff.WithBase(time.Hour))),
+		outbox.WithOnError(func(context.Context, int64, outbox.Message, error) {}))
+
+	// 第一轮:hot0 失败进入退避,本批其余行同属 hot
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("first round = %d, %v", n, err)
+	}
+	// 第二轮:hot 整键退避,cold 得以投递
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("second round = %d, %v", n, err)
+	}
+	if got := pub.bodies(); len(got) != 1 || got[0] != "cold" {
+		t.Fatalf("cold starved behind hot: %v", got)
+	}
+}
+
+func TestRelayMaxAttemptsAndService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, box := openBox(t)
+	tx, _ := db.BeginTx(ctx, nil)
+	_ = box.Enqueue(ctx, tx,
+		outbox.Message{Topic: "t", Key: "k", Payload: []byte("poison")},
+		outbox.Message{Topic: "t", Key: "k", Payload: []byte("next")},
+	)
+	_ = tx.Commit()
+
+	pub := &recorder{fail: map[string]int{"poison": 100}}
+	wake := make(chan struct{}, 1)
+	relay := outbox.NewRelay(box, pub,
+		outbox.WithMaxAttempts(1),
+		outbox.WithPollInterval(time.Hour), // 只靠唤醒
+		outbox.WithWakeup(wake),
+		outbox.WithOnError(func(context.Context, int64, outbox.Message, error) {}))
+	done := make(chan error, 1)
+	go func() { done <- relay.Start(ctx) }()
+
+	wake <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pub.bodies()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := pub.bodies(); len(got) != 1 || got[0] != "next" {
+		t.Fatalf("after giving up on poison, next should be sent: %v", got)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Start returned %v", err)
+	}
+	var failedAt sql.NullInt64
+	var lastErr string
+	_ = db.QueryRow(`SELECT failed_at, last_error FROM outbox WHERE payload = ?`, []byte("poison")).Scan(&failedAt, &lastErr)
+	if !failedAt.Valid || lastErr != "broker down" {
+		t.Errorf("poison row failed_at=%v last_error=%q", failedAt, lastErr)
+	}
+}
@@ -0,0 +1,353 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
+	"github.com/rushteam/beauty/pkg/store/dlock"
+)
+
+// cleanupEvery 是 Relay 清理已发送旧行的间隔。
+const cleanupEvery = time.Minute
+
+// maxErrorLen 是 last_error 列保存的错误信息最大长度。
+const maxErrorLen = 1000
+
+// Relay 把发件箱里的消息投递给 mq.Publisher,实现 beauty.Service。
+//
+// 每轮按 id 顺序拉取一批可投递的未发消息逐条发布:成功即标记 sent_at(保留期为 0 时直接删除);
+// 失败则按退避策略推迟该行,并且本轮跳过同一聚合键的后续消息——同键消息严格按写入顺序投递。
+// 仍在退避中的键整体不参与拉取,积压再多也不会占满批次、饿住其它键。空 Key 的消息不参与排序约束。
+//
+// 多副本部署时用 WithLeaderElection 只让 leader 投递;否则各副本会重复投递、同键顺序也无法保证。
+// 零值不可用,用 NewRelay 构造。
+type Relay struct {
+	box         *Outbox
+	pub         mq.Publisher
+	interval    time.Duration
+	batch       int
+	retry       *backoff.Policy
+	maxAttempts int
+	retention   time.Duration
+	elector     dlock.Elector
+	electKey    string
+	wake        <-chan struct{}
+	onError     func(ctx context.Context, id int64, m Message, err error)
+}
+
+// RelayOption 配置 Relay。
+type RelayOption func(*Relay)
+
+// WithPollInterval 设置轮询间隔(默认 1s)。
+func WithPollInterval(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// WithBatchSize 设置每轮拉取的最大行数(默认 100)。
+func WithBatchSize(n int) RelayOption {
+	return func(r *Relay) {
+		if n > 0 {
+			r.batch = n
+		}
+	}
+}
+
+// WithRetry 设置失败重试的退避策略(默认 base 1s、max 5m)。只使用 p.Duration 计算间隔,
+// 次数上限由 WithMaxAttempts 决定。
+func WithRetry(p *backoff.Policy) RelayOption {
+	return func(r *Relay) {
+		if p != nil {
+			r.retry = p
+		}
+	}
+}
+
+// WithMaxAttempts 设置单条消息的最大投递次数(默认 0 = 不限)。用尽后该行标记 failed_at 并留在表中
+// 供排查,同键的后续消息继续投递。
+func WithMaxAttempts(n int) RelayOption {
+	return func(r *Relay) { r.maxAttempts = n }
+}
+
+// WithRetention 设置已发送消息的保留时长(默认 7 天),Relay 定期删除更早的已发送行;
+// 0 表示投递成功即删除。放弃的行(failed_at)不会被清理。
+func WithRetention(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		if d >= 0 {
+			r.retention = d
+		}
+	}
+}
+
+// WithLeaderElection 让 Relay 只在当选 leader 期间投递,失去 leader 身份时停止。
+// 选主 key 默认 "outbox:{表名}"。
+func WithLeaderElection(e dlock.Elector) RelayOption {
+	return func(r *Relay) { r.elector = e }
+}
+
+// WithElectionKey 设置选主 key。
+func WithElectionKey(key string) RelayOption {
+	return func(r *Relay) {
+		if key != "" {
+			r.electKey = key
+		}
+	}
+}
+
+// WithWakeup 设置唤醒信号:收到后立即投递,不必等下一次轮询。典型用法是 PostgreSQL
+// LISTEN/NOTIFY(配合 Outbox 的 WithNotify),驱动相关部分由调用方完成,例如 pgx:
+//
+//	conn, _ := pgx.Connect(ctx, dsn) // 专用连接
+//	_, _ = conn.Exec(ctx, "LISTEN outbox")
+//	wake := make(chan struct{}, 1)
+//	go func() {
+//	    for {
+//	        if _, err := conn.WaitForNotification(ctx); err != nil {
+//	            return
+//	        }
+//	        select {
+//	        case wake <- struct{}{}:
+//	        default:
+//	        }
+//	    }
+//	}()
+//	relay := outbox.NewRelay(box, pub, outbox.WithWakeup(wake))
+//
+// 通知只是加速,丢失时仍由轮询兜底。
+func WithWakeup(ch <-chan struct{}) RelayOption {
+	return func(r *Relay) { r.wake = ch }
+}
+
+// WithOnError 设置投递失败回调(每次失败调用一次),默认 slog.Warn。
+func WithOnError(fn func(ctx context.Context, id int64, m Message, err error)) RelayOption {
+	return func(r *Relay) {
+		if fn != nil {
+			r.onError = fn
+		}
+	}
+}
+
+// NewRelay 创建把 box 中的消息投递给 pub 的 Relay。
+func NewRelay(box *Outbox, pub mq.Publisher, opts ...RelayOption) *Relay {
+	r := &Relay{
+		box:       box,
+		pub:       pub,
+		interval:  time.Second,
+		batch:     100,
+		retry:     backoff.New(backoff.WithBase(time.Second), backoff.WithMax(5*time.Minute)),
+		retention: 7 * 24 * time.Hour,
+		electKey:  "outbox:" + box.table,
+		onError: func(_ context.Context, id int64, m Message, err error) {
+			slog.Warn("outbox: publish failed", "table", box.table, "id", id, "topic", m.Topic, "key", m.Key, "error", err)
+		},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Start 实现 beauty.Service:持续投递直到 ctx 取消。
+func (r *Relay) Start(ctx context.Context) error {
+	if r.elector == nil {
+		r.run(ctx)
+		return nil
+	}
+	err := r.elector.Run(ctx, r.electKey, r.run)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (r *Relay) String() string {
+	return fmt.Sprintf("outbox-relay(%s)", r.box.table)
+}
+
+// run 是投递循环:每次轮询或被唤醒时把积压投完,并按 cleanupEvery 清理旧行。
+func (r *Relay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		r.drain(ctx)
+		if r.retention > 0 && time.Since(lastCleanup) >= cleanupEvery {
+			lastCleanup = time.Now()
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("outbox: cleanup failed", "table", r.box.table, "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// drain 连续调用 RelayOnce,直到一轮投出的条数不满一批。
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("outbox: relay failed", "table", r.box.table, "error", err)
+			}
+			return
+		}
+		if n < r.batch {
+			return
+		}
+	}
+}
+
+// record 是发件箱中的一行。
+type record struct {
+	id       int64
+	msg      Message
+	attempts int
+}
+
+// RelayOnce 拉取一批未发消息并投递,返回投递成功的条数。发布失败不作为错误返回(已记录到行上
+// 并回调 WithOnError);返回的错误来自数据库。Start 内部循环调用它,也可用于手动触发或测试。
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	recs, err := r.fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	blocked := make(map[string]bool)
+	sent := 0
+	for _, rec := range recs {
+		key := rec.msg.Key
+		if key != "" && blocked[key] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if perr := r.publish(ctx, rec); perr != nil {
+			if key != "" {
+				blocked[key] = true
+			}
+			r.onError(ctx, rec.id, rec.msg, perr)
+			if err := r.markFailed(ctx, rec, perr); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := r.markSent(ctx, rec); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// fetch 按 id 顺序拉取至多一批到期的未发消息。某个键的队首仍在退避时,该键的后续消息也须等待,
+// 因此整个键都被排除在外,由其它键填满批次。
+func (r *Relay) fetch(ctx context.Context) ([]record, error) {
+	b := r.box
+	now := time.Now().UnixMilli()
+	rows, err := b.db.QueryContext(ctx, b.q(`SELECT id, topic, msg_key, payload, headers, attempts FROM `+b.table+
+		` WHERE sent_at IS NULL AND failed_at IS NULL AND next_at <= ?`+
+		` AND (msg_key = '' OR msg_key NOT IN (SELECT msg_key FROM `+b.table+
+		` WHERE sent_at IS NULL AND failed_at IS NULL AND next_at > ?))`+
+		` ORDER BY id LIMIT ?`), now, now, r.batch)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: fetch: %w", err)
+	}
+	defer rows.Close()
+	var out []record
+	for rows.Next() {
+		var rec record
+		var headers sql.NullString
+		if err := rows.Scan(&rec.id, &rec.msg.Topic, &rec.msg.Key, &rec.msg.Payload, &headers, &rec.attempts); err != nil {
+			return nil, fmt.Errorf("outbox: fetch: %w", err)
+		}
+		if headers.Valid && headers.String != "" {
+			if err := json.Unmarshal([]byte(headers.String), &rec.msg.Headers); err != nil {
+				return nil, fmt.Errorf("outbox: decode headers of %d: %w", rec.id, err)
+			}
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+func (r *Relay) publish(ctx context.Context, rec record) error {
+	headers := make(map[string]string, len(rec.msg.Headers)+1)
+	for k, v := range rec.msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderID] = strconv.FormatInt(rec.id, 10)
+	return r.pub.Publish(ctx, mq.Message{Topic: rec.msg.Topic, Key: rec.msg.Key, Body: rec.msg.Payload, Headers: headers})
+}
+
+func (r *Relay) markSent(ctx context.Context, rec record) error {
+	b := r.box
+	var err error
+	if r.retention == 0 {
+		_, err = b.db.ExecContext(ctx, b.q(`DELETE FROM `+b.table+` WHERE id = ?`), rec.id)
+	} else {
+		_, err = b.db.ExecContext(ctx, b.q(`UPDATE `+b.table+` SET sent_at = ?, attempts = attempts + 1 WHERE id = ?`),
+			time.Now().UnixMilli(), rec.id)
+	}
+	if err != nil {
+		return fmt.Errorf("outbox: mark %d sent: %w", rec.id, err)
+	}
+	return nil
+}
+
+// markFailed 记录一次失败:未达上限时按退避推迟 next_at,达到上限时标记 failed_at。
+func (r *Relay) markFailed(ctx context.Context, rec record, cause error) error {
+	b := r.box
+	attempts := rec.attempts + 1
+	msg := cause.Error()
+	if len(msg) > maxErrorLen {
+		n := maxErrorLen
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n-- // 不截断多字节字符(PostgreSQL 拒收非法 UTF-8)
+		}
+		msg = msg[:n]
+	}
+	now := time.Now()
+	var err error
+	if r.maxAttempts > 0 && attempts >= r.maxAttempts {
+		_, err = b.db.ExecContext(ctx, b.q(`UPDATE `+b.table+` SET attempts = ?, failed_at = ?, last_error = ? WHERE id = ?`),
+			attempts, now.UnixMilli(), msg, rec.id)
+	} else {
+		next := now.Add(r.retry.Duration(attempts - 1)).UnixMilli()
+		_, err = b.db.ExecContext(ctx, b.q(`UPDATE `+b.table+` SET attempts = ?, next_at = ?, last_error = ? WHERE id = ?`),
+			attempts, next, msg, rec.id)
+	}
+	if err != nil {
+		return fmt.Errorf("outbox: mark %d failed: %w", rec.id, err)
+	}
+	return nil
+}
+
+// Cleanup 删除保留期之前已发送的行,返回删除的行数。保留期为 0 时已发送即删,无需清理。
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	if r.retention <= 0 {
+		return 0, nil
+	}
+	b := r.box
+	res, err := b.db.ExecContext(ctx, b.q(`DELETE FROM `+b.table+` WHERE sent_at IS NOT NULL AND sent_at < ?`),
+		time.Now().Add(-r.retention).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("outbox: cleanup: %w", err)
+	}
+	return res.RowsAffected()
+}
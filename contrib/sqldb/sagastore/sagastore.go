@@ -0,0 +1,193 @@
+// Package sagastore 是 pkg/orchestration/saga 的 SQL 持久化实现(saga.Store),
+// 基于 database/sql,可直接使用 sqldb 的 Writer() / *sql.DB / *sql.Tx。
+//
+// 表结构(Migrate 创建,也可自行建表):
+//
+//	CREATE TABLE saga_instances (
+//	    id         VARCHAR(191) PRIMARY KEY,
+//	    definition VARCHAR(191) NOT NULL,
+//	    state      VARCHAR(32)  NOT NULL,
+//	    version    BIGINT       NOT NULL,
+//	    updated_at BIGINT       NOT NULL, -- unix 毫秒
+//	    data       TEXT         NOT NULL  -- saga.Instance 的 JSON
+//	);
+//
+// 查询用的列(definition / state / updated_at)单独存放,其余状态整体以 JSON 存入 data。
+// Update 以 "WHERE id=? AND version=?" 做乐观锁,多个协调器共享同一张表时同一实例只会被一方推进。
+// 恢复扫描按 (state, updated_at) 过滤,实例多时建议建对应索引。
+package sagastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+	"github.com/rushteam/beauty/pkg/orchestration/saga"
+)
+
+// Store 实现 saga.Store。零值不可用,用 New 构造。
+type Store struct {
+	db      sqldb.DBTX
+	table   string
+	dialect sqldb.Dialect
+}
+
+var _ saga.Store = (*Store)(nil)
+
+// Option 配置 Store。
+type Option func(*Store)
+
+// WithTable 设置表名,默认 "saga_instances"。
+func WithTable(name string) Option {
+	return func(s *Store) { s.table = name }
+}
+
+// WithDialect 设置数据库方言(决定占位符),默认 sqldb.MySQL;PostgreSQL 传 sqldb.Postgres。
+func WithDialect(d sqldb.Dialect) Option {
+	return func(s *Store) { s.dialect = d }
+}
+
+// New 创建基于 db 的 Store。db 须指向主库(读写都走它,恢复不能读到落后的副本)。
+func New(db sqldb.DBTX, opts ...Option) *Store {
+	s := &Store{db: db, table: "saga_instances"}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Migrate 建表(已存在则跳过)。
+func (s *Store) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	id VARCHAR(191) PRIMARY KEY,
+	definition VARCHAR(191) NOT NULL,
+	state VARCHAR(32) NOT NULL,
+	version BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	data TEXT NOT NULL
+)`)
+	return err
+}
+
+// q 把 ? 占位符按方言改写。
+func (s *Store) q(query string) string { return s.dialect.Rebind(query) }
+
+func (s *Store) Create(ctx context.Context, inst *saga.Instance) error {
+	if _, err := s.Get(ctx, inst.ID); err == nil {
+		return saga.ErrExists
+	} else if !errors.Is(err, saga.ErrNotFound) {
+		return err
+	}
+	inst.Version = 1
+	data, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.q(`INSERT INTO `+s.table+` (id, definition, state, version, updated_at, data) VALUES (?, ?, ?, ?, ?, ?)`),
+		inst.ID, inst.Definition, string(inst.State), inst.Version, inst.UpdatedAt.UnixMilli(), string(data))
+	if err != nil {
+		// 并发 Create 撞主键:各驱动的唯一约束错误不统一,回查确认
+		if _, gerr := s.Get(ctx, inst.ID); gerr == nil {
+			return saga.ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Update(ctx context.Context, inst *saga.Instance) error {
+	next := *inst
+	next.Version++
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, s.q(`UPDATE `+s.table+` SET state = ?, version = ?, updated_at = ?, data = ? WHERE id = ? AND version = ?`),
+		string(next.State), next.Version, next.UpdatedAt.UnixMilli(), string(data), inst.ID, inst.Version)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.Get(ctx, inst.ID); err != nil {
+			return err
+		}
+		return saga.ErrConflict
+	}
+	inst.Version = next.Version
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*saga.Instance, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, s.q(`SELECT data FROM `+s.table+` WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, saga.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+func (s *Store) List(ctx context.Context, f saga.Filter) ([]*saga.Instance, error) {
+	var where []string
+	var args []any
+	if len(f.States) > 0 {
+		marks := make([]string, len(f.States))
+		for i, st := range f.States {
+			marks[i] = "?"
+			args = append(args, string(st))
+		}
+		where = append(where, "state IN ("+strings.Join(marks, ", ")+")")
+	}
+	if f.Definition != "" {
+		where = append(where, "definition = ?")
+		args = append(args, f.Definition)
+	}
+	if !f.UpdatedBefore.IsZero() {
+		where = append(where, "updated_at < ?")
+		args = append(args, f.UpdatedBefore.UnixMilli())
+	}
+	query := `SELECT data FROM ` + s.table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY updated_at"
+	if f.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(f.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*saga.Instance
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		inst, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inst)
+	}
+	return out, rows.Err()
+}
+
+func decode(data string) (*saga.Instance, error) {
+	inst := new(saga.Instance)
+	if err := json.Unmarshal([]byte(data), inst); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
@@ -0,0 +1,82 @@
+package sagastore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb/sagastore"
+	"github.com/rushteam/beauty/pkg/orchestration/saga"
+	_ "modernc.org/sqlite"
+)
+
+func TestStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	store := sagastore.New(db)
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次执行在 charge 处失败(模拟崩溃后恢复前的状态由补偿收尾)
+	var charged int
+	order := saga.New("order").
+		Step("reserve", func(ctx context.Context) error { return saga.SetOutput(ctx, "r-1") }, func(context.Context) error { return nil }).
+		Step("charge", func(ctx context.Context) error {
+			charged++
+			var in struct{ Amount int }
+			if err := saga.Input(ctx, &in); err != nil {
+				return err
+			}
+			if in.Amount > 100 {
+				return errors.New("insufficient funds")
+			}
+			return nil
+		}, nil)
+	c := saga.NewCoordinator(store)
+	c.Register(order)
+
+	res, err := c.Execute(ctx, "order", "o-1", map[string]int{"Amount": 50})
+	if err != nil || res.Status != saga.StatusCommitted {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	res, err = c.Execute(ctx, "order", "o-2", map[string]int{"Amount": 500})
+	if err != nil || res.Status != saga.StatusCompensated || res.FailedStep != "charge" {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	// 幂等:已终结的实例不再执行
+	if _, err := c.Execute(ctx, "order", "o-1", nil); err != nil || charged != 2 {
+		t.Fatalf("charged = %d, err = %v", charged, err)
+	}
+
+	inst, err := store.Get(ctx, "o-1")
+	if err != nil || inst.State != saga.StateCommitted || string(inst.Steps[0].Output) != `"r-1"` {
+		t.Fatalf("inst = %+v, err = %v", inst, err)
+	}
+	stale := *inst
+	stale.Version--
+	if err := store.Update(ctx, &stale); !errors.Is(err, saga.ErrConflict) {
+		t.Fatalf("want conflict, got %v", err)
+	}
+	if _, err := store.Get(ctx, "absent"); !errors.Is(err, saga.ErrNotFound) {
+		t.Fatalf("want not found, got %v", err)
+	}
+	if err := store.Create(ctx, inst); !errors.Is(err, saga.ErrExists) {
+		t.Fatalf("want exists, got %v", err)
+	}
+
+	list, err := store.List(ctx, saga.Filter{States: []saga.State{saga.StateCompensated}, UpdatedBefore: time.Now().Add(time.Second)})
+	if err != nil || len(list) != 1 || list[0].ID != "o-2" {
+		t.Fatalf("list = %v, err = %v", list, err)
+	}
+	if list, _ := store.List(ctx, saga.Filter{Definition: "order", Limit: 1}); len(list) != 1 {
+		t.Fatalf("limit: %d", len(list))
+	}
+}
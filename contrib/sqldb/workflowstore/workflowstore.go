@@ -0,0 +1,168 @@
+// Package workflowstore 是 pkg/orchestration/workflow 的 SQL 事件历史(workflow.HistoryStore),
+// 基于 database/sql,可直接使用 sqldb 的 Writer() / *sql.DB。
+//
+// 表结构(Migrate 创建,也可自行建表):
+//
+//	CREATE TABLE workflow_events (
+//	    workflow_id VARCHAR(191) NOT NULL,
+//	    event_id    BIGINT       NOT NULL, -- 历史内序号,从 1 起
+//	    type        VARCHAR(32)  NOT NULL,
+//	    data        TEXT         NOT NULL, -- workflow.Event 的 JSON
+//	    PRIMARY KEY (workflow_id, event_id)
+//	);
+//
+// 历史只追加:每个事件一行,(workflow_id, event_id) 主键保证同一位置不会写入两次。
+// Open 扫描没有终结事件的 workflow,历史多时建议在 type 上建索引。
+package workflowstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rushteam/beauty/contrib/sqldb"
+	"github.com/rushteam/beauty/pkg/orchestration/workflow"
+)
+
+// Store 实现 workflow.HistoryStore。零值不可用,用 New 构造。
+type Store struct {
+	db      sqldb.DBTX
+	table   string
+	dialect sqldb.Dialect
+}
+
+var _ workflow.HistoryStore = (*Store)(nil)
+
+// Option 配置 Store。
+type Option func(*Store)
+
+// WithTable 设置表名,默认 "workflow_events"。
+func WithTable(name string) Option {
+	return func(s *Store) { s.table = name }
+}
+
+// WithDialect 设置数据库方言(决定占位符),默认 sqldb.MySQL;PostgreSQL 传 sqldb.Postgres。
+func WithDialect(d sqldb.Dialect) Option {
+	return func(s *Store) { s.dialect = d }
+}
+
+// New 创建基于 db 的 Store。db 须指向主库(重放不能读到落后的副本)。
+func New(db sqldb.DBTX, opts ...Option) *Store {
+	s := &Store{db: db, table: "workflow_events"}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Migrate 建表(已存在则跳过)。
+func (s *Store) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	workflow_id VARCHAR(191) NOT NULL,
+	event_id BIGINT NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (workflow_id, event_id)
+)`)
+	return err
+}
+
+// q 把 ? 占位符按方言改写。
+func (s *Store) q(query string) string { return s.dialect.Rebind(query) }
+
+func (s *Store) Create(ctx context.Context, id string, start workflow.Event) error {
+	if n, err := s.last(ctx, id); err != nil {
+		return err
+	} else if n > 0 {
+		return workflow.ErrExists
+	}
+	start.ID = 1
+	if err := s.insert(ctx, id, start); err != nil {
+		// 并发 Create 撞主键:各驱动的唯一约束错误不统一,回查确认
+		if n, lerr := s.last(ctx, id); lerr == nil && n > 0 {
+			return workflow.ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Append(ctx context.Context, id string, events ...workflow.Event) error {
+	n, err := s.last(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return workflow.ErrNotFound
+	}
+	for _, ev := range events {
+		n++
+		ev.ID = n
+		if err := s.insert(ctx, id, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Load(ctx context.Context, id string) ([]workflow.Event, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT data FROM `+s.table+` WHERE workflow_id = ? ORDER BY event_id`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []workflow.Event
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var ev workflow.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, workflow.ErrNotFound
+	}
+	return out, nil
+}
+
+func (s *Store) Open(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT workflow_id FROM `+s.table+` WHERE event_id = 1 AND workflow_id NOT IN (
+	SELECT workflow_id FROM `+s.table+` WHERE type IN (?, ?)
+) ORDER BY workflow_id`), string(workflow.EventWorkflowCompleted), string(workflow.EventWorkflowFailed))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// last 返回 workflow 当前最大的 event_id(不存在为 0)。
+func (s *Store) last(ctx context.Context, id string) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, s.q(`SELECT COALESCE(MAX(event_id), 0) FROM `+s.table+` WHERE workflow_id = ?`), id).Scan(&n)
+	return n, err
+}
+
+func (s *Store) insert(ctx context.Context, id string, ev workflow.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.q(`INSERT INTO `+s.table+` (workflow_id, event_id, type, data) VALUES (?, ?, ?, ?)`),
+		id, ev.ID, string(ev.Type), string(data))
+	return err
+}
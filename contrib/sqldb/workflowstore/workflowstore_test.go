@@ -0,0 +1,98 @@
+package workflowstore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/contrib/sqldb/workflowstore"
+	"github.com/rushteam/beauty/pkg/orchestration/workflow"
+	_ "modernc.org/sqlite"
+)
+
+func TestStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	store := workflowstore.New(db)
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个引擎:记账后等待信号时"崩溃"
+	var charges int
+	register := func(e *workflow.Engine) {
+		workflow.RegisterActivity(e, "charge", func(_ context.Context, amount int) (int, error) {
+			charges++
+			return amount, nil
+		})
+		workflow.RegisterWorkflow(e, "order", func(ctx *workflow.Context, amount int) (int, error) {
+			paid, err := workflow.ExecuteActivity[int](ctx, "charge", amount)
+			if err != nil {
+				return 0, err
+			}
+			bonus, err := workflow.ReceiveSignal[int](ctx, "bonus")
+			return paid + bonus, err
+		})
+	}
+	e1 := workflow.New(store)
+	register(e1)
+	if err := e1.StartWorkflow(ctx, "order", "o-1", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.StartWorkflow(ctx, "order", "o-1", 30); !errors.Is(err, workflow.ErrExists) {
+		t.Fatalf("want ErrExists, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h, err := store.Load(ctx, "o-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h[len(h)-1].Type == workflow.EventActivityCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("history = %+v", h)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 重启:Open 找回未结束的 workflow,重放不重复记账
+	if ids, err := store.Open(ctx); err != nil || len(ids) != 1 || ids[0] != "o-1" {
+		t.Fatalf("open = %v, err = %v", ids, err)
+	}
+	e2 := workflow.New(store)
+	register(e2)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() { _ = e2.Start(runCtx) }()
+	if err := e2.Signal(ctx, "o-1", "bonus", 5); err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	var total int
+	if err := e2.Result(waitCtx, "o-1", &total); err != nil || total != 35 || charges != 1 {
+		t.Fatalf("total = %d, err = %v, charges = %d", total, err, charges)
+	}
+	if ids, _ := store.Open(ctx); len(ids) != 0 {
+		t.Fatalf("open = %v", ids)
+	}
+	h, err := store.Load(ctx, "o-1")
+	if err != nil || h[0].Type != workflow.EventWorkflowStarted || h[len(h)-1].ID != int64(len(h)) {
+		t.Fatalf("history = %+v, err = %v", h, err)
+	}
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, workflow.ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := store.Append(ctx, "missing", workflow.Event{Type: workflow.EventMarker}); !errors.Is(err, workflow.ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
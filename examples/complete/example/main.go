@@ -92,7 +92,7 @@ func main() {
 		}
 	}()
 
-	gw := grpcgw.New()
+	gw := grpcgw.NewServeMux()
 	v1.RegisterGreeterHandlerServer(context.Background(), gw, &GreeterServer{})
 
 	metricExprter, err := prometheus.New()
@@ -7,6 +7,10 @@
 //   - 仅 err==nil 且状态码 < 500 才记(失败由 logger 负责);
 //   - 异步写入 Sink(如 DB/文件),不阻塞响应。
 //
+// 内置 Sink(见 filesink.go / mqsink.go):NewFileSink 追加写 JSONL,每条带哈希链、定期写签名检查点,
+// 删改可被 VerifyFiles 发现;MQSink 把条目发布到 pkg/messaging/mq。ExportCSV 按用户/资源/动作/时间
+// 过滤导出给审计方;命令行见 pkg/api/audit/auditctl。
+//
 // 与 pkg/logger 的区别:logger 记运行时事件(含错误),audit 只记"成功的敏感操作"
 // 且字段固定(Resource/Action),便于按操作类型检索与合规导出。
 //
@@ -37,16 +41,16 @@ const (
 
 // Entry 是一条审计记录。创建后不可变。
 type Entry struct {
-	ID         int64     // 单调递增
-	Time       time.Time // 操作发生时间
-	UserID     string    // 操作者
-	Resource   Resource  // 被操作资源类型
-	ResourceID string    // 被操作资源 ID(如用户 ID、配置名)
-	Action     Action    // 操作类型
-	Method     string    // HTTP 方法 / gRPC 方法
-	Path       string    // HTTP 路径 / gRPC FullMethod
-	Status     int       // HTTP 状态码 / gRPC OK=0
-	Metadata   string    // 业务自定义 JSON 等编码
+	ID         int64     `json:"id"`                    // 单调递增
+	Time       time.Time `json:"time"`                  // 操作发生时间
+	UserID     string    `json:"user_id"`               // 操作者
+	Resource   Resource  `json:"resource"`              // 被操作资源类型
+	ResourceID string    `json:"resource_id,omitempty"` // 被操作资源 ID(如用户 ID、配置名)
+	Action     Action    `json:"action"`                // 操作类型
+	Method     string    `json:"method,omitempty"`      // HTTP 方法 / gRPC 方法
+	Path       string    `json:"path,omitempty"`        // HTTP 路径 / gRPC FullMethod
+	Status     int       `json:"status"`                // HTTP 状态码 / gRPC OK=0
+	Metadata   string    `json:"metadata,omitempty"`    // 业务自定义 JSON 等编码
 }
 
 // Sink 接收审计条目。实现可以是 DB 写入、文件追加、远程聚合等。
@@ -92,16 +96,19 @@ func New(sink Sink, opts ...Option) *Audit {
 	return a
 }
 
-// Record 记录一条审计条目。非阻塞:队列满时丢弃。
+// Record 记录一条审计条目。非阻塞:队列满时丢弃;Stop 之后调用直接丢弃。
 // 仅在业务确认操作成功后调用(仅记 err==nil)。
 func (a *Audit) Record(ctx context.Context, e Entry) {
-	a.mu.Lock()
-	a.seq++
-	e.ID = a.seq
-	a.mu.Unlock()
 	if e.Time.IsZero() {
 		e.Time = time.Now()
 	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped {
+		return
+	}
+	a.seq++
+	e.ID = a.seq
 	select {
 	case a.queue <- e:
 	default:
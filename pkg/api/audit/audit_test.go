@@ -131,6 +131,16 @@ func TestAudit_StopIdempotent(t *testing.T) {
 	a.Stop() // 不 panic
 }
 
+func TestAudit_RecordAfterStop(t *testing.T) {
+	sink := &memSink{}
+	a := audit.New(sink)
+	a.Stop()
+	a.Record(context.Background(), audit.Entry{UserID: "u", Resource: resUser, Action: audit.ActionRead}) // 不 panic
+	if got := sink.snapshot(); len(got) != 0 {
+		t.Fatalf("entries after Stop = %v", got)
+	}
+}
+
 func TestAudit_ActionMapping(t *testing.T) {
 	cases := map[string]audit.Action{
 		http.MethodGet:    audit.ActionRead,
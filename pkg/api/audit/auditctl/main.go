@@ -0,0 +1,204 @@
+// auditctl 校验与导出 audit.FileSink 写出的审计日志。
+//
+//	go run github.com/rushteam/beauty/pkg/api/audit/auditctl verify -pubkey audit.pub /var/log/app/audit.jsonl
+//	go run github.com/rushteam/beauty/pkg/api/audit/auditctl export -user alice -action delete \
+//	    -from 2026-01-01T00:00:00Z -to 2026-04-01T00:00:00Z -o q1.csv /var/log/app/audit.jsonl
+//
+// 路径为当前文件;同目录的轮转文件会按时间顺序一并处理。export 默认先校验,链断裂时拒绝导出。
+// 给了公钥时,没有签名检查点或末尾有未签名记录也算校验失败(退出码非 0);
+// 校验仍在写入的日志可加 -allow-unsigned-tail。
+// 公钥为 PEM(PKIX "PUBLIC KEY")或 32 字节 Ed25519 公钥的 base64。
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/api/audit"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "auditctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: auditctl verify|export [flags] <audit.jsonl>")
+	os.Exit(2)
+}
+
+type keyFlags struct {
+	pubkey        string
+	keyID         string
+	allowUnsigned bool
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.pubkey, "pubkey", "", "checkpoint public key file (PEM or base64)")
+	fs.StringVar(&k.keyID, "key-id", "", "key id the checkpoints were signed with")
+	fs.BoolVar(&k.allowUnsigned, "allow-unsigned-tail", false, "accept records after the last signed checkpoint")
+}
+
+func (k *keyFlags) options() ([]audit.VerifyOption, error) {
+	if k.pubkey == "" {
+		return nil, nil
+	}
+	pub, err := loadPublicKey(k.pubkey)
+	if err != nil {
+		return nil, err
+	}
+	opts := []audit.VerifyOption{audit.WithVerifyKey(k.keyID, pub)}
+	if k.allowUnsigned {
+		opts = append(opts, audit.WithAllowUnsignedTail())
+	}
+	return opts, nil
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var keys keyFlags
+	keys.register(fs)
+	_ = fs.Parse(args)
+	files, err := logFiles(fs)
+	if err != nil {
+		return err
+	}
+	opts, err := keys.options()
+	if err != nil {
+		return err
+	}
+	rep, err := audit.VerifyFiles(files, opts...)
+	fmt.Printf("files=%d records=%d checkpoints=%d seq=%d..%d head=%s\n",
+		rep.Files, rep.Records, rep.Checkpoints, rep.FirstSeq, rep.LastSeq, rep.Head)
+	if err != nil {
+		return err
+	}
+	if keys.pubkey != "" && rep.Unsigned > 0 {
+		fmt.Printf("warning: %d record(s) after the last signed checkpoint\n", rep.Unsigned)
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var keys keyFlags
+	keys.register(fs)
+	verify := fs.Bool("verify", true, "verify the chain before exporting")
+	user := fs.String("user", "", "filter by user id")
+	resource := fs.Int("resource", 0, "filter by resource type")
+	action := fs.String("action", "", "filter by action (create|update|delete|read|<n>)")
+	from := fs.String("from", "", "start time, RFC 3339 (inclusive)")
+	to := fs.String("to", "", "end time, RFC 3339 (exclusive)")
+	out := fs.String("o", "", "output file (default stdout)")
+	_ = fs.Parse(args)
+
+	files, err := logFiles(fs)
+	if err != nil {
+		return err
+	}
+	f := audit.Filter{UserID: *user, Resource: audit.Resource(*resource)}
+	if *action != "" {
+		if f.Action, err = audit.ParseAction(*action); err != nil {
+			return err
+		}
+	}
+	if f.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if f.To, err = parseTime(*to); err != nil {
+		return err
+	}
+	if *verify {
+		opts, err := keys.options()
+		if err != nil {
+			return err
+		}
+		if _, err := audit.VerifyFiles(files, opts...); err != nil {
+			return fmt.Errorf("refusing to export: %w", err)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	n, err := audit.ExportCSV(w, files, f)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d record(s)\n", n)
+	return nil
+}
+
+func logFiles(fs *flag.FlagSet) ([]string, error) {
+	if fs.NArg() != 1 {
+		usage()
+	}
+	files, err := audit.LogFiles(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audit files at %s", fs.Arg(0))
+	}
+	return files, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := k.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not Ed25519")
+		}
+		return pub, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("public key must be PEM or base64 of 32 bytes")
+	}
+	return ed25519.PublicKey(b), nil
+}
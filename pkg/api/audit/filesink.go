@@ -0,0 +1,367 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record 是 FileSink 写出的一行审计记录:Entry 加上链序号与哈希链。
+//
+//	Hash = hex(SHA-256(Prev + "\n" + 去掉 hash 字段后的 JSON))
+//
+// 任何一行被修改、删除或插入,其后所有 Hash 都对不上;重算整条链则过不了检查点签名。
+type Record struct {
+	Seq int64 `json:"seq"` // 链序号,跨轮转、跨重启连续
+	Entry
+	Prev string `json:"prev"`           // 上一条(记录或检查点)的 Hash;链首为空串
+	Hash string `json:"hash,omitempty"` // 本行哈希
+}
+
+// Checkpoint 是定期写入的签名检查点,固定链头:离线持有私钥的人才能产生,
+// 攻击者即使改完文件并重算哈希也无法伪造。
+type Checkpoint struct {
+	Type  string    `json:"type"` // 固定 "checkpoint"
+	Seq   int64     `json:"seq"`  // 覆盖到的最后一条记录序号
+	Time  time.Time `json:"time"`
+	Head  string    `json:"head"` // 此刻的链头(最后一条记录的 Hash)
+	KeyID string    `json:"key_id,omitempty"`
+	Sig   []byte    `json:"sig"` // Ed25519(checkpointPayload)
+	Prev  string    `json:"prev"`
+	Hash  string    `json:"hash,omitempty"`
+}
+
+const checkpointType = "checkpoint"
+
+func checkpointPayload(seq int64, head string, t time.Time) []byte {
+	return []byte("beauty-audit-checkpoint\n" + strconv.FormatInt(seq, 10) + "\n" + head + "\n" + t.UTC().Format(time.RFC3339Nano))
+}
+
+func chainHash(prev string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileSinkOption 配置 FileSink。
+type FileSinkOption func(*fileSinkConfig)
+
+type fileSinkConfig struct {
+	maxSize        int64
+	rotateEvery    time.Duration
+	syncEach       bool
+	signKey        ed25519.PrivateKey
+	keyID          string
+	checkpointN    int
+	checkpointTick time.Duration
+	now            func() time.Time
+}
+
+// WithMaxFileSize 设置单文件上限(字节,默认 100MB),超过即轮转。<=0 不按大小轮转。
+func WithMaxFileSize(n int64) FileSinkOption {
+	return func(c *fileSinkConfig) { c.maxSize = n }
+}
+
+// WithRotateEvery 按时间轮转(如 24h),与大小轮转取先到者。
+func WithRotateEvery(d time.Duration) FileSinkOption {
+	return func(c *fileSinkConfig) { c.rotateEvery = d }
+}
+
+// WithSyncEachWrite 每条记录后 fsync,掉电不丢已确认的记录,代价是写吞吐。
+func WithSyncEachWrite() FileSinkOption {
+	return func(c *fileSinkConfig) { c.syncEach = true }
+}
+
+// WithCheckpoints 开启签名检查点:每 every 条记录(<=0 不按条数)或每 interval(<=0 不按时间)
+// 写一个 Ed25519 签名的检查点;轮转与 Close 时也会写一个。keyID 写入检查点供验证方选公钥。
+func WithCheckpoints(key ed25519.PrivateKey, keyID string, every int, interval time.Duration) FileSinkOption {
+	return func(c *fileSinkConfig) {
+		c.signKey, c.keyID, c.checkpointN, c.checkpointTick = key, keyID, every, interval
+	}
+}
+
+// FileSink 是追加写的 JSONL 审计文件,带哈希链与可选的签名检查点。
+//
+// 文件布局:当前文件为 path(如 /var/log/app/audit.jsonl),轮转后改名为
+// audit-<UTC 时间>.jsonl 放在同目录;链跨文件连续。LogFiles(path) 按时间顺序列出全部文件。
+// 重启时从最后一个文件的末行恢复链头,继续追加;崩溃留下的未写完的末行会被截掉。
+//
+// 并发安全;Close 写最终检查点并关闭文件。
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	cfg  fileSinkConfig
+
+	f        *os.File
+	w        *bufio.Writer
+	size     int64
+	opened   time.Time
+	seq      int64
+	head     string
+	sinceCP  int
+	lastCP   time.Time
+	lastCPAt int64 // 最近一个检查点覆盖的 seq,避免重复写
+	closed   bool
+}
+
+// NewFileSink 打开(或续写)path 处的审计文件。
+func NewFileSink(path string, opts ...FileSinkOption) (*FileSink, error) {
+	cfg := fileSinkConfig{maxSize: 100 << 20, now: time.Now}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	s := &FileSink{path: path, cfg: cfg}
+	files, err := LogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		seq, head, cpSeq, ok, err := lastLink(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.seq, s.head, s.lastCPAt = seq, head, cpSeq
+			break
+		}
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.lastCP = cfg.now()
+	return s, nil
+}
+
+// Write 实现 Sink。
+func (s *FileSink) Write(_ context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("audit: file sink closed")
+	}
+	now := s.cfg.now()
+	if s.shouldRotate(now) {
+		if err := s.rotate(now); err != nil {
+			return err
+		}
+	}
+	if e.Time.IsZero() {
+		e.Time = now
+	}
+	rec := Record{Seq: s.seq + 1, Entry: e, Prev: s.head}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	rec.Hash = chainHash(rec.Prev, body)
+	if err := s.writeLine(rec); err != nil {
+		return err
+	}
+	s.seq, s.head = rec.Seq, rec.Hash
+	s.sinceCP++
+	if s.cfg.signKey != nil &&
+		(s.cfg.checkpointN > 0 && s.sinceCP >= s.cfg.checkpointN ||
+			s.cfg.checkpointTick > 0 && now.Sub(s.lastCP) >= s.cfg.checkpointTick) {
+		if err := s.checkpoint(now); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+// Close 写最终检查点并关闭文件。幂等。
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var errs []error
+	if s.cfg.signKey != nil {
+		errs = append(errs, s.checkpoint(s.cfg.now()))
+	}
+	errs = append(errs, s.w.Flush(), s.f.Sync(), s.f.Close())
+	return errors.Join(errs...)
+}
+
+func (s *FileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.f, s.w, s.size, s.opened = f, bufio.NewWriter(f), st.Size(), s.cfg.now()
+	return nil
+}
+
+func (s *FileSink) shouldRotate(now time.Time) bool {
+	if s.size == 0 {
+		return false
+	}
+	return s.cfg.maxSize > 0 && s.size >= s.cfg.maxSize ||
+		s.cfg.rotateEvery > 0 && now.Sub(s.opened) >= s.cfg.rotateEvery
+}
+
+// rotate 在旧文件末尾写检查点后改名,再开新文件;链头沿用,新文件首条的 Prev 指向旧文件末行。
+func (s *FileSink) rotate(now time.Time) error {
+	if s.cfg.signKey != nil {
+		if err := s.checkpoint(now); err != nil {
+			return err
+		}
+	}
+	if err := errors.Join(s.w.Flush(), s.f.Sync(), s.f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, rotatedName(s.path, now)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) checkpoint(now time.Time) error {
+	if s.lastCPAt == s.seq && s.seq > 0 || s.seq == 0 {
+		s.lastCP, s.sinceCP = now, 0
+		return nil
+	}
+	cp := Checkpoint{
+		Type:  checkpointType,
+		Seq:   s.seq,
+		Time:  now.UTC(),
+		Head:  s.head,
+		KeyID: s.cfg.keyID,
+		Sig:   ed25519.Sign(s.cfg.signKey, checkpointPayload(s.seq, s.head, now)),
+		Prev:  s.head,
+	}
+	body, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	cp.Hash = chainHash(cp.Prev, body)
+	if err := s.writeLine(cp); err != nil {
+		return err
+	}
+	s.head, s.lastCPAt, s.lastCP, s.sinceCP = cp.Hash, s.seq, now, 0
+	return nil
+}
+
+func (s *FileSink) writeLine(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.cfg.syncEach {
+		return s.f.Sync()
+	}
+	return nil
+}
+
+// rotatedName 生成轮转文件名:audit.jsonl → audit-20060102T150405.000000000Z.jsonl(字典序即时间序)。
+func rotatedName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return base + "-" + t.UTC().Format("20060102T150405.000000000Z") + ext
+}
+
+// LogFiles 返回 path 对应的全部审计文件:轮转文件按时间升序,当前文件(若存在)在最后。
+func LogFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	rotated, err := filepath.Glob(globEscape(base) + "-*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(rotated)
+	if _, err := os.Stat(path); err == nil {
+		rotated = append(rotated, path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return r.Replace(s)
+}
+
+// lastLink 读取文件末行,返回链序号、链头与最近检查点覆盖的序号;空文件 ok=false。
+// 末尾没有换行的半行是崩溃时未写完的记录,截掉后以前一行为末行。
+func lastLink(path string) (seq int64, head string, cpSeq int64, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", 0, false, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 64<<10)
+	var last []byte
+	var size int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := os.Truncate(path, size); err != nil {
+					return 0, "", 0, false, fmt.Errorf("audit: %s: truncate torn last line: %w", path, err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return 0, "", 0, false, err
+		}
+		size += int64(len(line))
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if last == nil {
+		return 0, "", 0, false, nil
+	}
+	var probe struct {
+		Type string `json:"type"`
+		Seq  int64  `json:"seq"`
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(last, &probe); err != nil {
+		return 0, "", 0, false, fmt.Errorf("audit: %s: unreadable last line: %w", path, err)
+	}
+	if probe.Type == checkpointType {
+		cpSeq = probe.Seq
+	}
+	return probe.Seq, probe.Hash, cpSeq, true, nil
+}
+
+const maxLine = 4 << 20
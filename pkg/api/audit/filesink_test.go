@@ -0,0 +1,226 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/api/audit"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func writeEntries(t *testing.T, s *audit.FileSink, from, n int) {
+	t.Helper()
+	users := []string{"alice", "bob"}
+	for i := from; i < from+n; i++ {
+		e := audit.Entry{
+			Time:       t0.Add(time.Duration(i) * time.Hour),
+			UserID:     users[i%2],
+			Resource:   resUser,
+			ResourceID: "u" + string(rune('0'+i%10)),
+			Action:     audit.Action(i%4 + 1),
+			Status:     200,
+			Metadata:   `{"i":` + string(rune('0'+i%10)) + `}`,
+		}
+		if err := s.Write(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileSink_ChainAcrossRotationAndRestart(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	opts := []audit.FileSinkOption{
+		audit.WithMaxFileSize(1024),
+		audit.WithCheckpoints(priv, "k1", 4, 0),
+	}
+	s, err := audit.NewFileSink(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, s, 0, 10)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 重启续写:链从上次末行接上。
+	s, err = audit.NewFileSink(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, s, 10, 5)
+	_ = s.Close()
+
+	files, _ := audit.LogFiles(path)
+	if len(files) < 2 {
+		t.Fatalf("expected rotation, files=%v", files)
+	}
+	rep, err := audit.VerifyFiles(files, audit.WithVerifyKey("k1", pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Records != 15 || rep.FirstSeq != 1 || rep.LastSeq != 15 || rep.Checkpoints < 4 || rep.Unsigned != 0 {
+		t.Fatalf("report=%+v", rep)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	var ce *audit.ChainError
+	if _, err := audit.VerifyFiles(files, audit.WithVerifyKey("k1", otherPub)); !errors.As(err, &ce) || !strings.Contains(ce.Reason, "signature") {
+		t.Fatalf("wrong key: %v", err)
+	}
+}
+
+func TestFileSink_UnsignedTailRejected(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	dir := t.TempDir()
+
+	// 没有检查点的日志不能通过带公钥的校验。
+	plain := filepath.Join(dir, "plain.jsonl")
+	s, _ := audit.NewFileSink(plain)
+	writeEntries(t, s, 0, 3)
+	_ = s.Close()
+	if _, err := audit.VerifyFiles([]string{plain}, audit.WithVerifyKey("k1", pub)); !errors.Is(err, audit.ErrUnsignedTail) {
+		t.Fatalf("no checkpoints: %v", err)
+	}
+
+	// 去掉末尾检查点后改写最后一条并重算哈希:链仍连续,但尾部未签名。
+	path := filepath.Join(dir, "audit.jsonl")
+	s, _ = audit.NewFileSink(path, audit.WithCheckpoints(priv, "k1", 2, 0))
+	writeEntries(t, s, 0, 5)
+	_ = s.Close()
+	raw, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	lines = lines[:len(lines)-1]
+	var rec audit.Record
+	_ = json.Unmarshal([]byte(lines[len(lines)-1]), &rec)
+	rec.UserID, rec.Hash = "mallory", ""
+	_ = os.WriteFile(path, []byte(strings.Join(lines[:len(lines)-1], "\n")+"\n"), 0o640)
+	s, _ = audit.NewFileSink(path)
+	_ = s.Write(context.Background(), rec.Entry)
+	_ = s.Close()
+
+	rep, err := audit.VerifyFiles([]string{path}, audit.WithVerifyKey("k1", pub))
+	if !errors.Is(err, audit.ErrUnsignedTail) || rep.Unsigned != 1 {
+		t.Fatalf("unsigned tail: rep=%+v err=%v", rep, err)
+	}
+	if rep, err := audit.VerifyFiles([]string{path}, audit.WithVerifyKey("k1", pub), audit.WithAllowUnsignedTail()); err != nil || rep.Unsigned != 1 {
+		t.Fatalf("allow unsigned tail: rep=%+v err=%v", rep, err)
+	}
+}
+
+func TestFileSink_RecoversFromTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s, _ := audit.NewFileSink(path)
+	writeEntries(t, s, 0, 3)
+	_ = s.Close()
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.WriteString(`{"seq":4,"time":"2026-03`)
+	_ = f.Close()
+
+	s, err := audit.NewFileSink(path)
+	if err != nil {
+		t.Fatalf("reopen after torn write: %v", err)
+	}
+	writeEntries(t, s, 3, 2)
+	_ = s.Close()
+	rep, err := audit.VerifyFiles([]string{path})
+	if err != nil || rep.Records != 5 || rep.LastSeq != 5 {
+		t.Fatalf("rep=%+v err=%v", rep, err)
+	}
+}
+
+func TestFileSink_TamperDetected(t *testing.T) {
+	fresh := func(t *testing.T) (string, []string) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		s, err := audit.NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeEntries(t, s, 0, 5)
+		_ = s.Close()
+		raw, _ := os.ReadFile(path)
+		return path, strings.Split(strings.TrimSpace(string(raw)), "\n")
+	}
+	check := func(t *testing.T, path string, lines []string, want string) {
+		t.Helper()
+		_ = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o640)
+		_, err := audit.VerifyFiles([]string{path})
+		var ce *audit.ChainError
+		if !errors.As(err, &ce) || !strings.Contains(ce.Reason, want) {
+			t.Fatalf("want %q, got %v", want, err)
+		}
+	}
+
+	t.Run("edit", func(t *testing.T) {
+		path, lines := fresh(t)
+		lines[2] = strings.Replace(lines[2], `"user_id":"alice"`, `"user_id":"mallory"`, 1)
+		check(t, path, lines, "record modified")
+	})
+	t.Run("delete", func(t *testing.T) {
+		path, lines := fresh(t)
+		check(t, path, append(lines[:2:2], lines[3:]...), "removed")
+	})
+	t.Run("inject field", func(t *testing.T) {
+		path, lines := fresh(t)
+		lines[1] = strings.Replace(lines[1], `{"seq"`, `{"approved":true,"seq"`, 1)
+		check(t, path, lines, "malformed")
+	})
+}
+
+func TestExportCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s, _ := audit.NewFileSink(path)
+	writeEntries(t, s, 0, 8)
+	_ = s.Close()
+
+	var buf bytes.Buffer
+	n, err := audit.ExportCSV(&buf, []string{path}, audit.Filter{
+		UserID: "alice",
+		From:   t0.Add(2 * time.Hour),
+		To:     t0.Add(7 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, _ := csv.NewReader(&buf).ReadAll()
+	// alice 在偶数小时:2、4、6。
+	if n != 3 || len(rows) != 4 || rows[0][0] != "seq" || rows[1][2] != "alice" || rows[1][0] != "3" {
+		t.Fatalf("n=%d rows=%v", n, rows)
+	}
+	if rows[1][5] != "delete" || rows[1][9] != `{"i":2}` {
+		t.Fatalf("row=%v", rows[1])
+	}
+}
+
+func TestMQSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := mq.NewInProc()
+	got := make(chan mq.Message, 1)
+	_ = bus.Subscribe(ctx, "audit", func(_ context.Context, m mq.Message) error { got <- m; return nil })
+
+	a := audit.New(audit.MQSink(bus, "audit"))
+	a.Record(ctx, audit.Entry{UserID: "alice", Resource: resConfig, Action: audit.ActionDelete})
+	a.Stop()
+
+	select {
+	case m := <-got:
+		var e audit.Entry
+		if err := json.Unmarshal(m.Body, &e); err != nil || m.Key != "alice" || e.Action != audit.ActionDelete || e.ID != 1 {
+			t.Fatalf("msg=%+v entry=%+v err=%v", m, e, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+}
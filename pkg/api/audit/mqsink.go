@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+)
+
+// MQSink 把每条审计条目以 JSON 发布到 topic,消息 Key 为 UserID(同一操作者的记录在分区 broker
+// 上保持有序)。用于把审计流汇入集中存储/SIEM;需要防篡改时与 FileSink 组合(见 MultiSink)。
+func MQSink(pub mq.Publisher, topic string) Sink {
+	return SinkFunc(func(ctx context.Context, e Entry) error {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return pub.Publish(ctx, mq.Message{
+			Topic:   topic,
+			Key:     e.UserID,
+			Body:    body,
+			Headers: map[string]string{"content-type": "application/json"},
+		})
+	})
+}
+
+// MultiSink 把条目依次写入多个 Sink;全部尝试,返回第一个错误。
+func MultiSink(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, e Entry) error {
+		var first error
+		for _, s := range sinks {
+			if err := s.Write(ctx, e); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
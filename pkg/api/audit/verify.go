@@ -0,0 +1,308 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ChainError 描述哈希链或检查点校验失败的位置。
+type ChainError struct {
+	File   string
+	Line   int   // 文件内行号(从 1 开始)
+	Seq    int64 // 出错行声明的链序号
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit: chain broken at %s:%d (seq %d): %s", e.File, e.Line, e.Seq, e.Reason)
+}
+
+// ErrUnsignedTail 表示提供了公钥,但日志末尾有记录没有被任何有效检查点覆盖(含完全没有检查点):
+// 能写文件的人可以改写或截断这部分记录并重算哈希链,校验无从发现。
+var ErrUnsignedTail = errors.New("audit: records after the last signed checkpoint")
+
+// VerifyReport 是校验结果摘要。
+type VerifyReport struct {
+	Files       int
+	Records     int64
+	Checkpoints int
+	FirstSeq    int64
+	LastSeq     int64
+	Head        string // 最后一行的 Hash
+	// Unsigned 是最后一个有效检查点之后的记录数:这部分只受哈希链保护,
+	// 尾部截断无法被发现。配置了公钥时才有意义;非 0 时 VerifyFiles 返回 ErrUnsignedTail,
+	// 除非 WithAllowUnsignedTail。
+	Unsigned int64
+}
+
+// VerifyOption 配置 VerifyFiles。
+type VerifyOption func(*verifyConfig)
+
+type verifyConfig struct {
+	keys          map[string]ed25519.PublicKey
+	allowUnsigned bool
+}
+
+// WithVerifyKey 提供检查点公钥。keyID 为空时匹配所有未带 key_id 的检查点。
+// 提供任意公钥后,无法验证的检查点视为失败。
+func WithVerifyKey(keyID string, pub ed25519.PublicKey) VerifyOption {
+	return func(c *verifyConfig) {
+		if c.keys == nil {
+			c.keys = make(map[string]ed25519.PublicKey)
+		}
+		c.keys[keyID] = pub
+	}
+}
+
+// WithAllowUnsignedTail 允许最后一个检查点之后存在未签名的记录(如校验仍在写入的日志),
+// 此时只在 VerifyReport.Unsigned 中报告其条数。未提供公钥时无意义。
+func WithAllowUnsignedTail() VerifyOption {
+	return func(c *verifyConfig) { c.allowUnsigned = true }
+}
+
+// VerifyFiles 按顺序校验一组审计文件(通常来自 LogFiles):每行哈希、链连续、序号递增、
+// 检查点签名与链头一致。第一处问题以 *ChainError 返回,report 为出错前的统计。
+// 链首(第一个文件的第一行)允许 Prev 非空,以便只校验保留期内的文件;此时 FirstSeq > 1。
+// 提供公钥时,没有有效检查点或末尾有未签名记录都返回 ErrUnsignedTail(见 WithAllowUnsignedTail)。
+func VerifyFiles(paths []string, opts ...VerifyOption) (VerifyReport, error) {
+	var cfg verifyConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	var rep VerifyReport
+	var (
+		prevHash string
+		prevSeq  int64
+		started  bool
+		signedAt int64
+	)
+	for _, path := range paths {
+		rep.Files++
+		err := scanLines(path, func(lineNo int, line []byte) error {
+			fail := func(seq int64, reason string) error {
+				return &ChainError{File: path, Line: lineNo, Seq: seq, Reason: reason}
+			}
+			var probe struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(line, &probe); err != nil {
+				return fail(0, "malformed JSON")
+			}
+			if probe.Type == checkpointType {
+				var cp Checkpoint
+				if err := json.Unmarshal(line, &cp); err != nil {
+					return fail(0, "malformed checkpoint")
+				}
+				hash := cp.Hash
+				cp.Hash = ""
+				body, _ := json.Marshal(cp)
+				switch {
+				case !started:
+					return fail(cp.Seq, "log starts with a checkpoint")
+				case cp.Prev != prevHash:
+					return fail(cp.Seq, "prev does not match preceding line")
+				case chainHash(cp.Prev, body) != hash:
+					return fail(cp.Seq, "checkpoint hash mismatch")
+				case cp.Seq != prevSeq || cp.Head != prevHash:
+					return fail(cp.Seq, "checkpoint does not cover the chain head")
+				}
+				if cfg.keys != nil {
+					pub, ok := cfg.keys[cp.KeyID]
+					if !ok {
+						return fail(cp.Seq, "unknown checkpoint key "+strconv.Quote(cp.KeyID))
+					}
+					if !ed25519.Verify(pub, checkpointPayload(cp.Seq, cp.Head, cp.Time), cp.Sig) {
+						return fail(cp.Seq, "checkpoint signature invalid")
+					}
+					signedAt = cp.Seq
+				}
+				prevHash = hash
+				rep.Checkpoints++
+				return nil
+			}
+
+			var rec Record
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&rec); err != nil {
+				return fail(0, "malformed record")
+			}
+			hash := rec.Hash
+			rec.Hash = ""
+			body, _ := json.Marshal(rec)
+			switch {
+			case started && rec.Prev != prevHash:
+				return fail(rec.Seq, "prev does not match preceding line (record removed or reordered)")
+			case started && rec.Seq != prevSeq+1:
+				return fail(rec.Seq, fmt.Sprintf("sequence gap: want %d", prevSeq+1))
+			case chainHash(rec.Prev, body) != hash:
+				return fail(rec.Seq, "record hash mismatch (record modified)")
+			}
+			if !started {
+				started, rep.FirstSeq = true, rec.Seq
+			}
+			prevHash, prevSeq = hash, rec.Seq
+			rep.Records++
+			return nil
+		})
+		if err != nil {
+			rep.LastSeq, rep.Head = prevSeq, prevHash
+			return rep, err
+		}
+	}
+	rep.LastSeq, rep.Head = prevSeq, prevHash
+	if cfg.keys != nil {
+		rep.Unsigned = prevSeq - max(signedAt, rep.FirstSeq-1)
+		if !cfg.allowUnsigned && (signedAt == 0 || rep.Unsigned > 0) {
+			return rep, fmt.Errorf("%w: %d unsigned record(s), last signed seq %d", ErrUnsignedTail, rep.Unsigned, signedAt)
+		}
+	}
+	return rep, nil
+}
+
+// Filter 选择要导出的记录;零值字段不参与过滤,时间区间为 [From, To)。
+type Filter struct {
+	UserID   string
+	Resource Resource
+	Action   Action
+	From     time.Time
+	To       time.Time
+}
+
+// Match 判断 e 是否满足过滤条件。
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.UserID != "" && e.UserID != f.UserID,
+		f.Resource != 0 && e.Resource != f.Resource,
+		f.Action != 0 && e.Action != f.Action,
+		!f.From.IsZero() && e.Time.Before(f.From),
+		!f.To.IsZero() && !e.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// ReadRecords 依次读取文件中的审计记录(跳过检查点),不做链校验。fn 返回 error 即停止。
+func ReadRecords(paths []string, fn func(Record) error) error {
+	for _, path := range paths {
+		err := scanLines(path, func(lineNo int, line []byte) error {
+			var probe struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(line, &probe); err != nil {
+				return fmt.Errorf("audit: %s:%d: %w", path, lineNo, err)
+			}
+			if probe.Type == checkpointType {
+				return nil
+			}
+			var rec Record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return fmt.Errorf("audit: %s:%d: %w", path, lineNo, err)
+			}
+			return fn(rec)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader 是 ExportCSV 的列。
+var csvHeader = []string{"seq", "time", "user_id", "resource", "resource_id", "action", "method", "path", "status", "metadata", "hash"}
+
+// ExportCSV 把满足 f 的记录写成 CSV(首行为表头),返回导出条数。
+// 导出前通常先 VerifyFiles,保证交给审计方的数据未被篡改。
+func ExportCSV(w io.Writer, paths []string, f Filter) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := ReadRecords(paths, func(r Record) error {
+		if !f.Match(r.Entry) {
+			return nil
+		}
+		n++
+		return cw.Write([]string{
+			strconv.FormatInt(r.Seq, 10),
+			r.Time.UTC().Format(time.RFC3339Nano),
+			r.UserID,
+			strconv.Itoa(int(r.Resource)),
+			r.ResourceID,
+			r.Action.String(),
+			r.Method,
+			r.Path,
+			strconv.Itoa(r.Status),
+			r.Metadata,
+			r.Hash,
+		})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return n, err
+}
+
+func scanLines(path string, fn func(lineNo int, line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), maxLine)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(n, sc.Bytes()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// String 返回动作名;未预定义的值输出数字。
+func (a Action) String() string {
+	switch a {
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionDelete:
+		return "delete"
+	case ActionRead:
+		return "read"
+	}
+	return strconv.Itoa(int(a))
+}
+
+// ParseAction 是 Action.String 的逆运算,也接受数字。
+func ParseAction(s string) (Action, error) {
+	switch s {
+	case "create":
+		return ActionCreate, nil
+	case "update":
+		return ActionUpdate, nil
+	case "delete":
+		return ActionDelete, nil
+	case "read":
+		return ActionRead, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("audit: unknown action %q", s)
+	}
+	return Action(n), nil
+}
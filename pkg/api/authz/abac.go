@@ -0,0 +1,290 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/api/metadata"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// Effect 是策略命中后的效果。
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Policy 是一条 ABAC 策略:Actions/Resources 圈定适用范围(模式同 RBAC:"*" 通配、
+// "xxx/*" 前缀),Condition 是表达式(语法见 expr.go 顶部),三者全部满足才算命中。
+//
+// 可直接由 pkg/conf 反序列化(见 PolicyDocument)。
+type Policy struct {
+	ID          string   `mapstructure:"id" json:"id" yaml:"id"`
+	Description string   `mapstructure:"description" json:"description,omitempty" yaml:"description,omitempty"`
+	Effect      Effect   `mapstructure:"effect" json:"effect" yaml:"effect"`          // allow / deny,空视为 allow
+	Actions     []string `mapstructure:"actions" json:"actions" yaml:"actions"`       // 空表示任意动作
+	Resources   []string `mapstructure:"resources" json:"resources" yaml:"resources"` // 空表示任意资源
+	Condition   string   `mapstructure:"condition" json:"condition,omitempty" yaml:"condition,omitempty"`
+}
+
+// PolicyDocument 是配置文件里的策略集合,供 LoadConfig / WatchConfig 反序列化:
+//
+//	policies:
+//	  - id: owner-edit
+//	    effect: allow
+//	    actions: [update, delete]
+//	    resources: ["article/*"]
+//	    condition: resource.owner == subject.id
+//	  - id: block-outside-office
+//	    effect: deny
+//	    resources: ["admin/*"]
+//	    condition: not cidr(env.ip, "10.0.0.0/8")
+type PolicyDocument struct {
+	Policies []Policy `mapstructure:"policies" json:"policies" yaml:"policies"`
+}
+
+// Env 是请求环境属性,条件中以 env.* 引用。HTTP / gRPC 中间件会自动补 IP(取对端地址,
+// 不信任 X-Forwarded-For);在代理之后部署时由调用方用 ContextWithEnv 注入可信 IP。
+type Env struct {
+	Time   time.Time         // 为零时取判定时刻
+	IP     string            // 客户端 IP
+	Tenant string            // 为空时取 metadata 的 x-tenant-id,再退化为 Subject.Attrs["tenant"]
+	Attrs  map[string]string // 其它自定义环境属性
+}
+
+var envKey = ctxkey.New[Env]()
+
+// ContextWithEnv 把请求环境放入 context。
+func ContextWithEnv(ctx context.Context, e Env) context.Context {
+	return ctxkey.With(ctx, envKey, e)
+}
+
+// EnvFromContext 取出请求环境;未注入时 ok=false。
+func EnvFromContext(ctx context.Context) (Env, bool) {
+	return ctxkey.Get(ctx, envKey)
+}
+
+// withPeerIP 在 ctx 尚无 Env.IP 时补上对端 IP(addr 为 host:port 或纯 host)。
+func withPeerIP(ctx context.Context, addr string) context.Context {
+	e, _ := EnvFromContext(ctx)
+	if e.IP != "" || addr == "" {
+		return ctx
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	e.IP = addr
+	return ContextWithEnv(ctx, e)
+}
+
+// ResourceLoader 按资源标识加载资源属性(如从 DB 取 article/42 的 owner、dept),
+// 条件中以 resource.<attr> 引用。仅当条件真正引用资源属性时才调用,每次判定至多一次。
+type ResourceLoader interface {
+	LoadResource(ctx context.Context, resource string) (map[string]any, error)
+}
+
+// ResourceLoaderFunc 函数适配器。
+type ResourceLoaderFunc func(ctx context.Context, resource string) (map[string]any, error)
+
+func (f ResourceLoaderFunc) LoadResource(ctx context.Context, resource string) (map[string]any, error) {
+	return f(ctx, resource)
+}
+
+// Decision 是一次判定的结果与依据,由 Explain 返回。
+type Decision struct {
+	Allowed  bool
+	Effect   Effect // 决定结果的策略效果;无策略适用时为空
+	PolicyID string // 决定结果的策略 ID;无策略适用时为空
+	Rule     string // 决定结果的规则名(ABAC 为策略 ID,RBAC 为角色),取值有限,用作指标标签
+	Reason   string // 可读说明
+	Err      error  // 条件求值出错(此时拒绝,fail-closed)
+}
+
+// ABAC 是内置的基于属性的授权器(零依赖,并发安全)。组合算法为 deny 优先:
+//   - 任一 deny 策略命中 → 拒绝;
+//   - 否则任一 allow 策略命中 → 放行;
+//   - 否则默认拒绝;
+//   - 条件求值出错(如资源加载失败)→ 拒绝,Decision.Err 记录原因。
+//
+// 策略集整体替换(SetPolicies / 配置热加载),替换前先全部编译,有错则保留旧策略。
+// 零值不可用,用 NewABAC 构造。
+type ABAC struct {
+	loaders  map[string]ResourceLoader // 资源类型 → loader;"" 为兜底
+	policies atomic.Pointer[[]compiledPolicy]
+}
+
+type compiledPolicy struct {
+	Policy
+	cond node
+}
+
+// ABACOption 配置 ABAC。
+type ABACOption func(*ABAC)
+
+// WithResourceLoader 为某类资源注册属性加载器。typ 对应资源的类型段
+// ("article/42" 的 "article");typ 为 "" 时作为兜底,处理未单独注册的类型。
+func WithResourceLoader(typ string, l ResourceLoader) ABACOption {
+	return func(a *ABAC) { a.loaders[typ] = l }
+}
+
+// NewABAC 创建一个空策略集的 ABAC 授权器(此时一律拒绝)。
+func NewABAC(opts ...ABACOption) *ABAC {
+	a := &ABAC{loaders: make(map[string]ResourceLoader)}
+	for _, o := range opts {
+		o(a)
+	}
+	a.policies.Store(&[]compiledPolicy{})
+	return a
+}
+
+// SetPolicies 编译并整体替换策略集。任一策略非法时返回错误,原策略集保持不变。
+func (a *ABAC) SetPolicies(ps []Policy) error {
+	compiled := make([]compiledPolicy, 0, len(ps))
+	for i, p := range ps {
+		switch p.Effect {
+		case "":
+			p.Effect = EffectAllow
+		case EffectAllow, EffectDeny:
+		default:
+			return fmt.Errorf("authz: policy %q: invalid effect %q", policyName(p, i), p.Effect)
+		}
+		cond, err := compileCondition(p.Condition)
+		if err != nil {
+			return fmt.Errorf("authz: policy %q: condition: %w", policyName(p, i), err)
+		}
+		compiled = append(compiled, compiledPolicy{Policy: p, cond: cond})
+	}
+	a.policies.Store(&compiled)
+	return nil
+}
+
+// Policies 返回当前生效的策略集(副本)。
+func (a *ABAC) Policies() []Policy {
+	cur := *a.policies.Load()
+	out := make([]Policy, len(cur))
+	for i, p := range cur {
+		out[i] = p.Policy
+	}
+	return out
+}
+
+func policyName(p Policy, i int) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// ConfigLoader 是 conf.Loader 的方法集。authz 不直接依赖 pkg/conf,免得把配置中心的
+// 依赖带进 casbin/openfga 等适配器模块;conf.New 返回的加载器可直接传入。
+type ConfigLoader interface {
+	Unmarshal(dst any) error
+	Watch(ctx context.Context, fn func())
+}
+
+// LoadConfig 从配置加载器读取 PolicyDocument 并替换策略集。
+func (a *ABAC) LoadConfig(l ConfigLoader) error {
+	var doc PolicyDocument
+	if err := l.Unmarshal(&doc); err != nil {
+		return fmt.Errorf("authz: unmarshal policies: %w", err)
+	}
+	return a.SetPolicies(doc.Policies)
+}
+
+// WatchConfig 先同步加载一次,再在配置变更时热加载。变更后的策略非法时记录告警并
+// 保留上一份可用策略(last-good)。ctx 取消后停止监听。
+func (a *ABAC) WatchConfig(ctx context.Context, l ConfigLoader) error {
+	if err := a.LoadConfig(l); err != nil {
+		return err
+	}
+	l.Watch(ctx, func() {
+		if err := a.LoadConfig(l); err != nil {
+			slog.Warn("authz: ignored invalid policy update, keeping last-good", "err", err)
+		}
+	})
+	return nil
+}
+
+// Authorize 实现 Enforcer。拒绝时返回包装了 ErrDenied 的错误,消息含决定性策略。
+func (a *ABAC) Authorize(ctx context.Context, sub Subject, action, resource string) error {
+	d := a.Explain(ctx, sub, action, resource)
+	if d.Allowed {
+		return nil
+	}
+	if d.Err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrDenied, d.Reason, d.Err)
+	}
+	return fmt.Errorf("%w: %s", ErrDenied, d.Reason)
+}
+
+// Explain 做一次判定并返回依据(哪条策略决定了结果),用于调试与审计。
+func (a *ABAC) Explain(ctx context.Context, sub Subject, action, resource string) Decision {
+	env, _ := EnvFromContext(ctx)
+	if env.Time.IsZero() {
+		env.Time = time.Now()
+	}
+	if env.Tenant == "" {
+		env.Tenant = metadata.FromContext(ctx).Get(metadata.KeyTenantID)
+	}
+	if env.Tenant == "" {
+		env.Tenant = sub.Attrs["tenant"]
+	}
+	e := &evalEnv{ctx: ctx, sub: sub, action: action, resource: resource, env: env, loader: a.loaderFor(resource)}
+
+	var allow *compiledPolicy
+	policies := *a.policies.Load()
+	for i := range policies {
+		p := &policies[i]
+		if p.Effect == EffectAllow && allow != nil {
+			continue // 已有 allow 命中,只需继续找 deny
+		}
+		if !matchAny(p.Actions, action, matchAction) || !matchAny(p.Resources, resource, matchResource) {
+			continue
+		}
+		v, err := p.cond.eval(e)
+		if err == nil {
+			var ok bool
+			ok, err = truthy(v)
+			if err == nil && !ok {
+				continue
+			}
+		}
+		if err != nil {
+			return Decision{Effect: p.Effect, PolicyID: p.ID, Rule: p.ID, Reason: "policy " + p.ID + " failed to evaluate", Err: err}
+		}
+		if p.Effect == EffectDeny {
+			return Decision{Effect: EffectDeny, PolicyID: p.ID, Rule: p.ID, Reason: "denied by policy " + p.ID}
+		}
+		allow = p
+	}
+	if allow != nil {
+		return Decision{Allowed: true, Effect: EffectAllow, PolicyID: allow.ID, Rule: allow.ID, Reason: "allowed by policy " + allow.ID}
+	}
+	return Decision{Reason: "no applicable policy"}
+}
+
+func (a *ABAC) loaderFor(resource string) ResourceLoader {
+	if l, ok := a.loaders[resourceType(resource)]; ok {
+		return l
+	}
+	return a.loaders[""]
+}
+
+// matchAny:patterns 为空视为任意;否则任一模式命中即可。
+func matchAny(patterns []string, s string, match func(pattern, s string) bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if match(p, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/api/authz"
+)
+
+func articles() authz.ResourceLoader {
+	data := map[string]map[string]any{
+		"article/1": {"owner": "u1", "dept": "eng", "level": 2},
+		"article/2": {"owner": "u2", "dept": "ops", "level": 5},
+	}
+	return authz.ResourceLoaderFunc(func(_ context.Context, res string) (map[string]any, error) {
+		if res == "article/broken" {
+			return nil, errors.New("db down")
+		}
+		return data[res], nil
+	})
+}
+
+func abac(t *testing.T) *authz.ABAC {
+	t.Helper()
+	a := authz.NewABAC(authz.WithResourceLoader("article", articles()))
+	err := a.SetPolicies([]authz.Policy{
+		{ID: "owner", Actions: []string{"update", "delete"}, Resources: []string{"article/*"},
+			Condition: `resource.owner == subject.id`},
+		{ID: "same-dept-read", Actions: []string{"read"}, Resources: []string{"article/*"},
+			Condition: `subject.dept == resource.dept and subject.clearance >= resource.level`},
+		{ID: "office-only", Effect: authz.EffectDeny, Resources: []string{"admin/*"},
+			Condition: `not cidr(env.ip, "10.0.0.0/8")`},
+		{ID: "admin", Condition: `"admin" in subject.roles`},
+		{ID: "suspended", Effect: authz.EffectDeny, Condition: `subject.status in ["suspended", "banned"]`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestABAC(t *testing.T) {
+	a := abac(t)
+	u1 := authz.Subject{ID: "u1", Attrs: map[string]string{"dept": "eng", "clearance": "3"}}
+	admin := authz.Subject{ID: "root", Roles: []string{"admin"}}
+	inside := authz.ContextWithEnv(context.Background(), authz.Env{IP: "10.1.2.3"})
+	cases := []struct {
+		name        string
+		ctx         context.Context
+		sub         authz.Subject
+		action, res string
+		allowed     bool
+		policy      string
+	}{
+		{"owner update", context.Background(), u1, "update", "article/1", true, "owner"},
+		{"non-owner update", context.Background(), u1, "update", "article/2", false, ""},
+		{"same dept, enough clearance", context.Background(), u1, "read", "article/1", true, "same-dept-read"},
+		{"other dept", context.Background(), u1, "read", "article/2", false, ""},
+		{"admin anywhere", context.Background(), admin, "delete", "article/2", true, "admin"},
+		{"admin outside office", context.Background(), admin, "read", "admin/users", false, "office-only"},
+		{"admin inside office", inside, admin, "read", "admin/users", true, "admin"},
+		{"deny overrides allow", context.Background(),
+			authz.Subject{ID: "u1", Attrs: map[string]string{"status": "banned"}}, "update", "article/1", false, "suspended"},
+	}
+	for _, c := range cases {
+		d := a.Explain(c.ctx, c.sub, c.action, c.res)
+		if d.Allowed != c.allowed || d.PolicyID != c.policy {
+			t.Errorf("%s: got allowed=%v policy=%q (%s), want %v %q", c.name, d.Allowed, d.PolicyID, d.Reason, c.allowed, c.policy)
+		}
+		err := a.Authorize(c.ctx, c.sub, c.action, c.res)
+		if (err == nil) != c.allowed || (err != nil && !errors.Is(err, authz.ErrDenied)) {
+			t.Errorf("%s: Authorize err=%v", c.name, err)
+		}
+	}
+}
+
+func TestABACLoaderErrorFailsClosed(t *testing.T) {
+	a := abac(t)
+	d := a.Explain(context.Background(), authz.Subject{ID: "u1"}, "update", "article/broken")
+	if d.Allowed || d.Err == nil || d.PolicyID != "owner" {
+		t.Fatalf("loader error should deny with Err: %+v", d)
+	}
+}
+
+func TestABACEnvTime(t *testing.T) {
+	a := authz.NewABAC()
+	if err := a.SetPolicies([]authz.Policy{{ID: "office-hours",
+		Condition: `hour(env.time) >= 9 && hour(env.time) < 18 && env.time < time("2030-01-01T00:00:00Z")`}}); err != nil {
+		t.Fatal(err)
+	}
+	at := func(h int) context.Context {
+		return authz.ContextWithEnv(context.Background(), authz.Env{Time: time.Date(2026, 3, 2, h, 0, 0, 0, time.UTC)})
+	}
+	if err := a.Authorize(at(10), authz.Subject{ID: "u"}, "read", "x"); err != nil {
+		t.Fatalf("10:00 should pass: %v", err)
+	}
+	if err := a.Authorize(at(20), authz.Subject{ID: "u"}, "read", "x"); err == nil {
+		t.Fatal("20:00 should be denied")
+	}
+}
+
+func TestABACInvalidPolicyKeepsOld(t *testing.T) {
+	a := abac(t)
+	for _, bad := range []authz.Policy{
+		{ID: "syntax", Condition: `subject.id ==`},
+		{ID: "unknown-ref", Condition: `user.id == "x"`},
+		{ID: "unknown-fn", Condition: `foo(subject.id)`},
+		{ID: "effect", Effect: "maybe"},
+	} {
+		if err := a.SetPolicies([]authz.Policy{bad}); err == nil {
+			t.Errorf("%s: want compile error", bad.ID)
+		}
+	}
+	if n := len(a.Policies()); n != 5 {
+		t.Fatalf("policies replaced by invalid set: %d", n)
+	}
+}
+
+// fakeLoader 实现 authz.ConfigLoader:Unmarshal 返回当前文档,Watch 记下回调供测试触发。
+type fakeLoader struct {
+	doc      authz.PolicyDocument
+	onChange func()
+}
+
+func (f *fakeLoader) Unmarshal(dst any) error {
+	*dst.(*authz.PolicyDocument) = f.doc
+	return nil
+}
+
+func (f *fakeLoader) Watch(_ context.Context, fn func()) { f.onChange = fn }
+
+func TestABACWatchConfig(t *testing.T) {
+	l := &fakeLoader{doc: authz.PolicyDocument{Policies: []authz.Policy{{ID: "v1", Actions: []string{"read"}}}}}
+	a := authz.NewABAC()
+	if err := a.WatchConfig(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	sub := authz.Subject{ID: "u"}
+	if a.Authorize(context.Background(), sub, "read", "x") != nil || a.Authorize(context.Background(), sub, "write", "x") == nil {
+		t.Fatal("v1 policy not applied")
+	}
+
+	l.doc = authz.PolicyDocument{Policies: []authz.Policy{{ID: "v2", Actions: []string{"write"}}}}
+	l.onChange()
+	if d := a.Explain(context.Background(), sub, "write", "x"); !d.Allowed || d.PolicyID != "v2" {
+		t.Fatalf("hot reload not applied: %+v", d)
+	}
+
+	l.doc = authz.PolicyDocument{Policies: []authz.Policy{{ID: "broken", Condition: "(("}}}
+	l.onChange()
+	if d := a.Explain(context.Background(), sub, "write", "x"); d.PolicyID != "v2" {
+		t.Fatalf("invalid update should keep last-good: %+v", d)
+	}
+}
+
+func TestABACHTTPPeerIP(t *testing.T) {
+	a := authz.NewABAC()
+	if err := a.SetPolicies([]authz.Policy{{ID: "lan", Condition: `cidr(env.ip, "192.168.0.0/16")`}}); err != nil {
+		t.Fatal(err)
+	}
+	h := authz.HTTP(a, nil)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	for addr, want := range map[string]int{"192.168.1.9:5000": http.StatusOK, "8.8.8.8:5000": http.StatusForbidden} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/x", nil)
+		r.RemoteAddr = addr
+		r = r.WithContext(authz.ContextWithSubject(r.Context(), authz.Subject{ID: "u"}))
+		h.ServeHTTP(rec, r)
+		if rec.Code != want {
+			t.Errorf("%s: status=%d, want %d", addr, rec.Code, want)
+		}
+	}
+}
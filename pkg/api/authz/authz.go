@@ -5,10 +5,14 @@
 //   - Subject:主体(id + 角色 + 属性),由认证层放进 context;
 //   - Enforcer:决策接口,Authorize(sub, action, resource) → nil 放行 / ErrDenied 拒绝;
 //   - 内置 RBAC(NewRBAC):零依赖、支持通配的角色→权限模型,覆盖多数场景;
+//   - 内置 ABAC(NewABAC):零依赖的属性策略,条件用小型表达式语言写在主体/资源/动作/环境属性上,
+//     deny 优先,可从 pkg/conf 热加载,Explain 给出决定性策略;
+//   - Shadow(NewShadow):影子/dry-run 包装,新策略与现行策略并跑、不一致写 audit、按规则出指标,
+//     可运行时 Promote 转正;
 //   - 中间件:HTTP / gRPC 拦截器,从 context 取 Subject、按 mapper 推出 (action, resource)、
 //     调 Authorize,拒绝即 403 / PermissionDenied。
 //
-// 更复杂的策略(ABAC、动态/DB 策略、关系授权 ReBAC)由实现同一 Enforcer 接口的 contrib
+// 更复杂的策略(casbin 模型、关系授权 ReBAC)由实现同一 Enforcer 接口的 contrib
 // 模块提供(contrib/casbin、contrib/openfga),调用点不变。
 //
 // 边界(机制而非策略):策略内容、角色分配(谁是 admin)、资源命名、租户模型都由使用方定。
@@ -36,6 +40,28 @@ type Enforcer interface {
 	Authorize(ctx context.Context, sub Subject, action, resource string) error
 }
 
+// Explainer 是能给出判定依据的 Enforcer(内置 RBAC / ABAC 均实现),供审计、影子比对按规则归因。
+type Explainer interface {
+	Explain(ctx context.Context, sub Subject, action, resource string) Decision
+}
+
+// explain 对任意 Enforcer 取判定:实现了 Explainer 的取其依据,否则仅据 Authorize 的结果。
+// 非 ErrDenied 的错误记入 Decision.Err。
+func explain(ctx context.Context, e Enforcer, sub Subject, action, resource string) Decision {
+	if x, ok := e.(Explainer); ok {
+		return x.Explain(ctx, sub, action, resource)
+	}
+	err := e.Authorize(ctx, sub, action, resource)
+	switch {
+	case err == nil:
+		return Decision{Allowed: true, Effect: EffectAllow}
+	case errors.Is(err, ErrDenied):
+		return Decision{Effect: EffectDeny, Reason: err.Error()}
+	default:
+		return Decision{Reason: "enforcer error", Err: err}
+	}
+}
+
 type subjectKey struct{}
 
 // ContextWithSubject 把主体放入 context(通常在认证中间件里,验完 token 后调用)。
@@ -0,0 +1,804 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 本文件实现 ABAC 条件用的小型表达式语言(零依赖)。语法:
+//
+//	subject.dept == resource.dept && action in ["read", "list"]
+//	not (env.ip != "" && cidr(env.ip, "10.0.0.0/8")) || subject.level >= 3
+//
+//   - 字面量:字符串 "a" / 'a'、数字 1 / 2.5、true / false / null、列表 [a, b];
+//   - 引用:subject.id / subject.roles / subject.<attr>(Attrs);
+//     resource(完整资源串)/ resource.type / resource.id / resource.<attr>(由 ResourceLoader 加载);
+//     action;env.time / env.ip / env.tenant / env.<attr>;
+//   - 运算:== != < <= > >=、in / not in、&& (and)、|| (or)、! (not)、括号;
+//   - 函数:glob startsWith endsWith contains lower len cidr hour weekday time。
+//
+// 求值规则:缺失的属性为 null;与 null 比较大小恒为 false;数字与可解析为数字的字符串
+// 互相比较时按数字比较(Subject.Attrs 都是字符串)。
+
+// ---- 词法 ----
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			toks = append(toks, token{kind: tokString, text: sb.String(), pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[i:j], pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		default:
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					toks = append(toks, token{kind: tokOp, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("<>!()[],", rune(c)) {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			toks = append(toks, token{kind: tokOp, text: string(c), pos: i})
+			i++
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// ---- 语法 ----
+
+type node interface {
+	eval(e *evalEnv) (any, error)
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// compileCondition 把条件表达式编译成可求值的语法树。空串恒为真。
+func compileCondition(src string) (node, error) {
+	if strings.TrimSpace(src) == "" {
+		return litNode{v: true}, nil
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOp 报告当前 token 是否为给定运算符/关键字之一。
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokOp || t.text != op {
+		return fmt.Errorf("expected %q at %d, got %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||", "or") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{or: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&", "and") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!", "not") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *parser) parseCmp() (node, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isOp("==", "!=", "<", "<=", ">", ">="):
+		op := p.next().text
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op: op, l: l, r: r}, nil
+	case p.isOp("in"):
+		p.next()
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{l: l, r: r}, nil
+	case p.isOp("not") && p.toks[p.pos+1].kind == tokIdent && p.toks[p.pos+1].text == "in":
+		p.pos += 2
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{l: l, r: r, negate: true}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return litNode{v: t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return litNode{v: f}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return listNode{items: items}, nil
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return litNode{v: true}, nil
+		case "false":
+			return litNode{v: false}, nil
+		case "null":
+			return litNode{v: nil}, nil
+		}
+		if p.isOp("(") {
+			p.next()
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			fn, ok := builtins[t.text]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+			}
+			if len(args) != fn.arity {
+				return nil, fmt.Errorf("%s() takes %d argument(s), got %d", t.text, fn.arity, len(args))
+			}
+			return callNode{name: t.text, fn: fn.call, args: args}, nil
+		}
+		ref := strings.Split(t.text, ".")
+		switch ref[0] {
+		case "subject", "resource", "action", "env":
+		default:
+			return nil, fmt.Errorf("unknown identifier %q at %d (want subject/resource/action/env)", t.text, t.pos)
+		}
+		if ref[0] == "action" && len(ref) > 1 || slices.Contains(ref, "") {
+			return nil, fmt.Errorf("invalid reference %q at %d", t.text, t.pos)
+		}
+		return refNode{path: ref}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseList(end string) ([]node, error) {
+	var items []node
+	if p.isOp(end) {
+		p.next()
+		return items, nil
+	}
+	for {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		return items, p.expect(end)
+	}
+}
+
+// ---- 求值 ----
+
+// evalEnv 是一次授权判定的求值环境。resource 属性按需懒加载,同一次判定内只加载一次。
+type evalEnv struct {
+	ctx      context.Context
+	sub      Subject
+	action   string
+	resource string
+	env      Env
+	loader   ResourceLoader
+
+	loaded   bool
+	resAttrs map[string]any
+	loadErr  error
+}
+
+func (e *evalEnv) resourceAttrs() (map[string]any, error) {
+	if !e.loaded {
+		e.loaded = true
+		if e.loader != nil {
+			e.resAttrs, e.loadErr = e.loader.LoadResource(e.ctx, e.resource)
+		}
+	}
+	return e.resAttrs, e.loadErr
+}
+
+func (e *evalEnv) resolve(ref []string) (any, error) {
+	switch ref[0] {
+	case "action":
+		return e.action, nil
+	case "subject":
+		if len(ref) == 1 {
+			return e.sub.ID, nil
+		}
+		switch ref[1] {
+		case "id":
+			return e.sub.ID, nil
+		case "roles":
+			return e.sub.Roles, nil
+		}
+		if v, ok := e.sub.Attrs[ref[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "resource":
+		if len(ref) == 1 {
+			return e.resource, nil
+		}
+		switch ref[1] {
+		case "type":
+			return resourceType(e.resource), nil
+		case "id":
+			return resourceID(e.resource), nil
+		}
+		attrs, err := e.resourceAttrs()
+		if err != nil {
+			return nil, fmt.Errorf("load resource %q: %w", e.resource, err)
+		}
+		return lookup(attrs, ref[1:]), nil
+	case "env":
+		if len(ref) == 1 {
+			return nil, nil
+		}
+		switch ref[1] {
+		case "time":
+			return e.env.Time, nil
+		case "ip":
+			return e.env.IP, nil
+		case "tenant":
+			return e.env.Tenant, nil
+		}
+		if v, ok := e.env.Attrs[ref[1]]; ok {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// lookup 按路径在嵌套 map 中取值,缺失返回 nil。
+func lookup(m map[string]any, path []string) any {
+	var cur any = m
+	for _, k := range path {
+		switch c := cur.(type) {
+		case map[string]any:
+			cur = c[k]
+		case map[string]string:
+			v, ok := c[k]
+			if !ok {
+				return nil
+			}
+			cur = v
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// resourceType 取资源的类型段:"article/42" → "article","/orders/7" → "orders"。
+func resourceType(res string) string {
+	t, _, _ := strings.Cut(strings.TrimPrefix(res, "/"), "/")
+	return t
+}
+
+// resourceID 取资源的末段:"article/42" → "42"。无 "/" 时为空。
+func resourceID(res string) string {
+	res = strings.TrimPrefix(res, "/")
+	if i := strings.LastIndexByte(res, '/'); i >= 0 {
+		return res[i+1:]
+	}
+	return ""
+}
+
+type litNode struct{ v any }
+
+func (n litNode) eval(*evalEnv) (any, error) { return n.v, nil }
+
+type refNode struct{ path []string }
+
+func (n refNode) eval(e *evalEnv) (any, error) { return e.resolve(n.path) }
+
+type listNode struct{ items []node }
+
+func (n listNode) eval(e *evalEnv) (any, error) {
+	out := make([]any, len(n.items))
+	for i, it := range n.items {
+		v, err := it.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type notNode struct{ x node }
+
+func (n notNode) eval(e *evalEnv) (any, error) {
+	v, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	b, err := truthy(v)
+	return !b, err
+}
+
+type logicNode struct {
+	or   bool
+	l, r node
+}
+
+func (n logicNode) eval(e *evalEnv) (any, error) {
+	lv, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := truthy(lv)
+	if err != nil {
+		return nil, err
+	}
+	if lb == n.or { // 短路:or 左真 / and 左假
+		return lb, nil
+	}
+	rv, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(rv)
+}
+
+type cmpNode struct {
+	op   string
+	l, r node
+}
+
+func (n cmpNode) eval(e *evalEnv) (any, error) {
+	lv, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(lv, rv), nil
+	case "!=":
+		return !equal(lv, rv), nil
+	}
+	c, ok := compare(lv, rv)
+	if !ok {
+		return false, nil
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type inNode struct {
+	l, r   node
+	negate bool
+}
+
+func (n inNode) eval(e *evalEnv) (any, error) {
+	lv, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return contains(rv, lv) != n.negate, nil
+}
+
+type callNode struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []node
+}
+
+func (n callNode) eval(e *evalEnv) (any, error) {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return v, nil
+}
+
+// truthy:bool 原样,null 视为 false,其它类型报错(条件必须是布尔)。
+func truthy(v any) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected boolean, got %T", v)
+}
+
+func toNumber(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isNumber(v any) bool {
+	_, s := v.(string)
+	_, ok := toNumber(v)
+	return ok && !s
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case string:
+		t, err := time.Parse(time.RFC3339, x)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if isNumber(a) || isNumber(b) {
+		x, ok1 := toNumber(a)
+		y, ok2 := toNumber(b)
+		return ok1 && ok2 && x == y
+	}
+	_, ta := a.(time.Time)
+	_, tb := b.(time.Time)
+	if ta || tb {
+		x, ok1 := toTime(a)
+		y, ok2 := toTime(b)
+		return ok1 && ok2 && x.Equal(y)
+	}
+	if ba, ok := a.(bool); ok {
+		return fmt.Sprint(ba) == fmt.Sprint(b)
+	}
+	if bb, ok := b.(bool); ok {
+		return fmt.Sprint(bb) == fmt.Sprint(a)
+	}
+	sa, ok1 := a.(string)
+	sb, ok2 := b.(string)
+	if ok1 && ok2 {
+		return sa == sb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare 比较大小,返回 (-1/0/1, 可比较)。支持数字、时间、字符串。
+func compare(a, b any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if isNumber(a) || isNumber(b) {
+		x, ok1 := toNumber(a)
+		y, ok2 := toNumber(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	_, ta := a.(time.Time)
+	_, tb := b.(time.Time)
+	if ta || tb {
+		x, ok1 := toTime(a)
+		y, ok2 := toTime(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return x.Compare(y), true
+	}
+	sa, ok1 := a.(string)
+	sb, ok2 := b.(string)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(sa, sb), true
+}
+
+// contains 报告 container 是否包含 x:列表按元素相等、字符串按子串、map 按键。
+func contains(container, x any) bool {
+	switch c := container.(type) {
+	case nil:
+		return false
+	case string:
+		s, ok := x.(string)
+		return ok && strings.Contains(c, s)
+	case []string:
+		for _, it := range c {
+			if equal(it, x) {
+				return true
+			}
+		}
+		return false
+	case []any:
+		for _, it := range c {
+			if equal(it, x) {
+				return true
+			}
+		}
+		return false
+	case map[string]any:
+		_, ok := c[fmt.Sprint(x)]
+		return ok
+	case map[string]string:
+		_, ok := c[fmt.Sprint(x)]
+		return ok
+	}
+	rv := reflect.ValueOf(container)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := range rv.Len() {
+			if equal(rv.Index(i).Interface(), x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type builtin struct {
+	arity int
+	call  func(args []any) (any, error)
+}
+
+func str(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+var builtins = map[string]builtin{
+	// glob(pattern, s):path.Match 通配(* 不跨 "/")。
+	"glob": {2, func(a []any) (any, error) {
+		ok, err := path.Match(str(a[0]), str(a[1]))
+		return ok, err
+	}},
+	"startsWith": {2, func(a []any) (any, error) { return strings.HasPrefix(str(a[0]), str(a[1])), nil }},
+	"endsWith":   {2, func(a []any) (any, error) { return strings.HasSuffix(str(a[0]), str(a[1])), nil }},
+	// contains(container, x):同 "x in container"。
+	"contains": {2, func(a []any) (any, error) { return contains(a[0], a[1]), nil }},
+	"lower":    {1, func(a []any) (any, error) { return strings.ToLower(str(a[0])), nil }},
+	"len": {1, func(a []any) (any, error) {
+		switch x := a[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len(x)), nil
+		}
+		rv := reflect.ValueOf(a[0])
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return float64(rv.Len()), nil
+		}
+		return nil, fmt.Errorf("unsupported type %T", a[0])
+	}},
+	// cidr(ip, "10.0.0.0/8"):IP 是否落在网段内。ip 为空或非法时为 false。
+	"cidr": {2, func(a []any) (any, error) {
+		prefix, err := netip.ParsePrefix(str(a[1]))
+		if err != nil {
+			return nil, err
+		}
+		ip, err := netip.ParseAddr(str(a[0]))
+		if err != nil {
+			return false, nil
+		}
+		return prefix.Contains(ip.Unmap()), nil
+	}},
+	// hour(t) / weekday(t):取时间的小时(0~23)/ 星期(0=周日)。
+	"hour": {1, func(a []any) (any, error) {
+		t, ok := toTime(a[0])
+		if !ok {
+			return nil, fmt.Errorf("not a time: %v", a[0])
+		}
+		return float64(t.Hour()), nil
+	}},
+	"weekday": {1, func(a []any) (any, error) {
+		t, ok := toTime(a[0])
+		if !ok {
+			return nil, fmt.Errorf("not a time: %v", a[0])
+		}
+		return float64(t.Weekday()), nil
+	}},
+	// time("2026-01-02T15:04:05Z"):解析 RFC3339 时间,用于与 env.time 比较。
+	"time": {1, func(a []any) (any, error) {
+		t, ok := toTime(a[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid RFC3339 time %v", a[0])
+		}
+		return t, nil
+	}},
+}
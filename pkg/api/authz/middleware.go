@@ -5,11 +5,18 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// requestInfo 是中间件记下的请求入口(HTTP 方法+路径 / gRPC FullMethod),供 Shadow 写审计。
+type requestInfo struct{ method, path string }
+
+var requestInfoKey = ctxkey.New[requestInfo]()
+
 // RequestMapper 从 HTTP 请求推出被授权的 (action, resource)。这是 policy——按你的路由/资源规范定。
 type RequestMapper func(*http.Request) (action, resource string)
 
@@ -37,6 +44,7 @@ func MethodAction(method string) string {
 
 // HTTP 返回一个授权中间件:从 context 取 Subject(认证层填),按 mapper 推 (action, resource),
 // 调 e.Authorize。无主体→401;拒绝→403;放行→next。mapper 为 nil 时用 MethodResourceMapper。
+// 判定时 ctx 的 Env 未设 IP 则补上 RemoteAddr 的主机部分(供 ABAC 的 env.ip)。
 func HTTP(e Enforcer, mapper RequestMapper) func(http.Handler) http.Handler {
 	if mapper == nil {
 		mapper = MethodResourceMapper
@@ -49,7 +57,9 @@ func HTTP(e Enforcer, mapper RequestMapper) func(http.Handler) http.Handler {
 				return
 			}
 			action, resource := mapper(r)
-			if err := e.Authorize(r.Context(), sub, action, resource); err != nil {
+			ctx := withPeerIP(r.Context(), r.RemoteAddr)
+			ctx = ctxkey.With(ctx, requestInfoKey, requestInfo{method: r.Method, path: r.URL.Path})
+			if err := e.Authorize(ctx, sub, action, resource); err != nil {
 				http.Error(w, "forbidden", http.StatusForbidden)
 				return
 			}
@@ -83,6 +93,10 @@ func UnaryServerInterceptor(e Enforcer, mapper MethodMapper) grpc.UnaryServerInt
 			return nil, status.Error(codes.Unauthenticated, "authz: no subject")
 		}
 		action, resource := mapper(info.FullMethod)
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			ctx = withPeerIP(ctx, p.Addr.String())
+		}
+		ctx = ctxkey.With(ctx, requestInfoKey, requestInfo{method: info.FullMethod, path: info.FullMethod})
 		if err := e.Authorize(ctx, sub, action, resource); err != nil {
 			return nil, status.Error(codes.PermissionDenied, "authz: denied")
 		}
@@ -11,7 +11,7 @@ import (
 //   - action:"*" 匹配任意,否则精确;
 //   - resource:"*" 匹配任意;以 "/*" 结尾按前缀匹配(如 "article/*" 命中 "article/123");否则精确。
 //
-// 零值不可用,用 NewRBAC 构造。适合静态角色→权限;要 ABAC/动态策略用 contrib/casbin。
+// 零值不可用,用 NewRBAC 构造。适合静态角色→权限;按属性判定用 NewABAC,casbin 模型用 contrib/casbin。
 type RBAC struct {
 	mu     sync.RWMutex
 	grants map[string][]grant // role -> 授权列表
@@ -33,17 +33,26 @@ func (r *RBAC) Grant(role, action, resource string) *RBAC {
 }
 
 // Authorize 实现 Enforcer:主体任一角色拥有匹配 (action, resource) 的授权即放行,否则 ErrDenied。
-func (r *RBAC) Authorize(_ context.Context, sub Subject, action, resource string) error {
+func (r *RBAC) Authorize(ctx context.Context, sub Subject, action, resource string) error {
+	if d := r.Explain(ctx, sub, action, resource); d.Allowed {
+		return nil
+	}
+	return ErrDenied
+}
+
+// Explain 实现 Explainer:放行时 PolicyID 为命中的授权 "role:action:resource",Rule 为角色名。
+func (r *RBAC) Explain(_ context.Context, sub Subject, action, resource string) Decision {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	for _, role := range sub.Roles {
 		for _, g := range r.grants[role] {
 			if matchAction(g.action, action) && matchResource(g.resource, resource) {
-				return nil
+				id := role + ":" + g.action + ":" + g.resource
+				return Decision{Allowed: true, Effect: EffectAllow, PolicyID: id, Rule: role, Reason: "granted by " + id}
 			}
 		}
 	}
-	return ErrDenied
+	return Decision{Reason: "no matching grant"}
 }
 
 func matchAction(pattern, a string) bool {
@@ -0,0 +1,238 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/rushteam/beauty/pkg/api/audit"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// Shadow 是影子(dry-run)授权器:active 负责真实判定,candidate 同步跑一遍但结果不生效,
+// 两者不一致时写一条审计记录。用于上线新策略前观察"换上它会拦掉/放过哪些请求"。
+// 它本身实现 Enforcer,直接交给 HTTP / UnaryServerInterceptor 使用即可。
+//
+//   - 指标:authz.decisions(engine=active|candidate、effect、rule)与 authz.shadow.disagreements,
+//     基于 OTel 全局 MeterProvider,未配置 telemetry 时为 no-op;rule 取 Decision.Rule(RBAC 角色 / ABAC 策略 ID,
+//     不含具体资源,基数有限),需引擎实现 Explainer;
+//   - 审计:WithAuditSink 指定 audit.Sink,经 audit.Audit 异步写入,不阻塞请求;
+//   - 切换:Promote 原子地交换 active 与 candidate(旧策略转为影子,可再 Promote 回滚)。
+//
+// candidate 为 nil 时等价于 active 本身。用 NewShadow 构造;用完调用 Close 落盘审计队列。
+type Shadow struct {
+	mu        sync.RWMutex
+	active    Enforcer
+	candidate Enforcer
+
+	audit    *audit.Audit
+	auditAll bool
+	metrics  *shadowMetrics
+
+	decisions     atomic.Int64
+	disagreements atomic.Int64
+}
+
+// ShadowOption 配置 Shadow。
+type ShadowOption func(*shadowConfig)
+
+type shadowConfig struct {
+	sink      audit.Sink
+	auditOpts []audit.Option
+	auditAll  bool
+}
+
+// WithAuditSink 指定不一致记录的去处。opts 透传给 audit.New(如队列长度)。
+func WithAuditSink(sink audit.Sink, opts ...audit.Option) ShadowOption {
+	return func(c *shadowConfig) { c.sink = sink; c.auditOpts = opts }
+}
+
+// WithAuditAll 让每一次判定(而不仅是不一致)都写审计,用于全量授权留痕。
+func WithAuditAll() ShadowOption {
+	return func(c *shadowConfig) { c.auditAll = true }
+}
+
+// ShadowStats 是 Shadow 的累计计数。
+type ShadowStats struct {
+	Decisions     int64 // 判定总数
+	Disagreements int64 // active 与 candidate 结论不一致的次数
+}
+
+// NewShadow 创建影子授权器。
+func NewShadow(active, candidate Enforcer, opts ...ShadowOption) *Shadow {
+	var cfg shadowConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	s := &Shadow{active: active, candidate: candidate, auditAll: cfg.auditAll, metrics: newShadowMetrics()}
+	if cfg.sink != nil {
+		s.audit = audit.New(cfg.sink, cfg.auditOpts...)
+	}
+	return s
+}
+
+// Authorize 实现 Enforcer:按 active 的结论放行/拒绝。
+func (s *Shadow) Authorize(ctx context.Context, sub Subject, action, resource string) error {
+	if d := s.Explain(ctx, sub, action, resource); !d.Allowed {
+		if d.Err != nil {
+			return fmt.Errorf("%w: %v", ErrDenied, d.Err)
+		}
+		return ErrDenied
+	}
+	return nil
+}
+
+// Explain 实现 Explainer:返回 active 的判定,同时评估 candidate 并记录比对结果。
+func (s *Shadow) Explain(ctx context.Context, sub Subject, action, resource string) Decision {
+	s.mu.RLock()
+	active, candidate := s.active, s.candidate
+	s.mu.RUnlock()
+
+	d := explain(ctx, active, sub, action, resource)
+	s.decisions.Add(1)
+	s.metrics.decision(ctx, "active", d)
+
+	var cd *Decision
+	if candidate != nil {
+		c := explain(ctx, candidate, sub, action, resource)
+		cd = &c
+		s.metrics.decision(ctx, "candidate", c)
+		if c.Allowed != d.Allowed {
+			s.disagreements.Add(1)
+			s.metrics.disagree(ctx, d, c)
+		}
+	}
+	if s.audit != nil && (s.auditAll || cd != nil && cd.Allowed != d.Allowed) {
+		s.record(ctx, sub, action, resource, d, cd)
+	}
+	return d
+}
+
+// Promote 交换 active 与 candidate:候选策略转正,原策略退为影子继续比对。
+// candidate 为 nil 时无操作。
+func (s *Shadow) Promote() {
+	s.mu.Lock()
+	if s.candidate != nil {
+		s.active, s.candidate = s.candidate, s.active
+	}
+	s.mu.Unlock()
+}
+
+// SetCandidate 替换影子策略;传 nil 停止比对。
+func (s *Shadow) SetCandidate(e Enforcer) {
+	s.mu.Lock()
+	s.candidate = e
+	s.mu.Unlock()
+}
+
+// Stats 返回累计计数。
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{Decisions: s.decisions.Load(), Disagreements: s.disagreements.Load()}
+}
+
+// Close 停止审计队列并等待已排队的记录写完。幂等。
+func (s *Shadow) Close() {
+	if s.audit != nil {
+		s.audit.Stop()
+	}
+}
+
+// shadowRecord 是写入 audit.Entry.Metadata 的 JSON。
+type shadowRecord struct {
+	Kind            string `json:"kind"` // "authz.disagreement" / "authz.decision"
+	Subject         string `json:"subject"`
+	Action          string `json:"action"`
+	Resource        string `json:"resource"`
+	Active          string `json:"active"`
+	ActivePolicy    string `json:"active_policy,omitempty"`
+	Candidate       string `json:"candidate,omitempty"`
+	CandidatePolicy string `json:"candidate_policy,omitempty"`
+}
+
+func (s *Shadow) record(ctx context.Context, sub Subject, action, resource string, d Decision, cd *Decision) {
+	rec := shadowRecord{
+		Kind: "authz.decision", Subject: sub.ID, Action: action, Resource: resource,
+		Active: effectOf(d), ActivePolicy: d.PolicyID,
+	}
+	if cd != nil {
+		rec.Candidate, rec.CandidatePolicy = effectOf(*cd), cd.PolicyID
+		if cd.Allowed != d.Allowed {
+			rec.Kind = "authz.disagreement"
+		}
+	}
+	meta, _ := json.Marshal(rec)
+	info := ctxkey.MustGet(ctx, requestInfoKey)
+	status := http.StatusOK
+	if !d.Allowed {
+		status = http.StatusForbidden
+	}
+	s.audit.Record(ctx, audit.Entry{
+		UserID:     sub.ID,
+		ResourceID: resource,
+		Action:     auditAction(action),
+		Method:     info.method,
+		Path:       info.path,
+		Status:     status,
+		Metadata:   string(meta),
+	})
+}
+
+func effectOf(d Decision) string {
+	if d.Allowed {
+		return string(EffectAllow)
+	}
+	return string(EffectDeny)
+}
+
+// auditAction 把 MethodAction 风格的动作映射回 audit.Action;其它动作为 0(未分类)。
+func auditAction(action string) audit.Action {
+	switch action {
+	case "create":
+		return audit.ActionCreate
+	case "update":
+		return audit.ActionUpdate
+	case "delete":
+		return audit.ActionDelete
+	case "read":
+		return audit.ActionRead
+	}
+	return 0
+}
+
+type shadowMetrics struct {
+	decisions     metric.Int64Counter
+	disagreements metric.Int64Counter
+}
+
+func newShadowMetrics() *shadowMetrics {
+	m := otel.Meter("github.com/rushteam/beauty/pkg/api/authz")
+	decisions, _ := m.Int64Counter("authz.decisions", metric.WithDescription("授权判定次数(按引擎/效果/规则)"))
+	disagreements, _ := m.Int64Counter("authz.shadow.disagreements", metric.WithDescription("active 与 candidate 结论不一致次数"))
+	return &shadowMetrics{decisions: decisions, disagreements: disagreements}
+}
+
+func (m *shadowMetrics) decision(ctx context.Context, engine string, d Decision) {
+	if m.decisions != nil {
+		m.decisions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("engine", engine),
+			attribute.String("effect", effectOf(d)),
+			attribute.String("rule", d.Rule),
+		))
+	}
+}
+
+func (m *shadowMetrics) disagree(ctx context.Context, active, candidate Decision) {
+	if m.disagreements != nil {
+		m.disagreements.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("active", effectOf(active)),
+			attribute.String("candidate", effectOf(candidate)),
+		))
+	}
+}
@@ -0,0 +1,93 @@
+package authz_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/rushteam/beauty/pkg/api/audit"
+	"github.com/rushteam/beauty/pkg/api/authz"
+)
+
+type memSink struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (s *memSink) Write(_ context.Context, e audit.Entry) error {
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestShadow(t *testing.T) {
+	active := authz.NewRBAC().Grant("user", "read", "/article/*").Grant("user", "update", "/article/*")
+	candidate := authz.NewABAC()
+	if err := candidate.SetPolicies([]authz.Policy{
+		{ID: "read-all", Actions: []string{"read"}},
+		{ID: "owner-update", Actions: []string{"update"}, Condition: `subject.id == "u1"`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sink := &memSink{}
+	s := authz.NewShadow(active, candidate, authz.WithAuditSink(sink))
+
+	h := authz.HTTP(s, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	u2 := authz.Subject{ID: "u2", Roles: []string{"user"}}
+	// 读:两者一致放行;改:active 放行、candidate 拒绝 → 仍按 active 放行,但记录不一致。
+	if rec := serve(h, "GET", "/article/1", u2); rec.Code != http.StatusOK {
+		t.Fatalf("read status=%d", rec.Code)
+	}
+	if rec := serve(h, "PUT", "/article/1", u2); rec.Code != http.StatusOK {
+		t.Fatalf("shadow must not enforce candidate: status=%d", rec.Code)
+	}
+	s.Close()
+
+	if st := s.Stats(); st.Decisions != 2 || st.Disagreements != 1 {
+		t.Fatalf("stats=%+v", st)
+	}
+	if len(sink.entries) != 1 {
+		t.Fatalf("want 1 disagreement entry, got %d", len(sink.entries))
+	}
+	e := sink.entries[0]
+	if e.UserID != "u2" || e.ResourceID != "/article/1" || e.Action != audit.ActionUpdate || e.Method != "PUT" || e.Path != "/article/1" {
+		t.Fatalf("entry=%+v", e)
+	}
+	var meta map[string]string
+	if err := json.Unmarshal([]byte(e.Metadata), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["kind"] != "authz.disagreement" || meta["active"] != "allow" || meta["candidate"] != "deny" ||
+		meta["active_policy"] != "user:update:/article/*" {
+		t.Fatalf("metadata=%v", meta)
+	}
+
+	// 指标标签用有限的规则名(RBAC 为角色),不带具体的 action/resource。
+	if d := active.Explain(context.Background(), u2, "update", "/article/1"); d.Rule != "user" {
+		t.Fatalf("rule=%q", d.Rule)
+	}
+
+	// 转正:candidate 生效,原 RBAC 退为影子。
+	s.Promote()
+	if err := s.Authorize(context.Background(), u2, "update", "/article/1"); err == nil {
+		t.Fatal("promoted candidate should deny u2 update")
+	}
+	s.Promote()
+	if err := s.Authorize(context.Background(), u2, "update", "/article/1"); err != nil {
+		t.Fatalf("second promote should roll back: %v", err)
+	}
+}
+
+func TestShadowAuditAll(t *testing.T) {
+	sink := &memSink{}
+	s := authz.NewShadow(authz.NewRBAC().Grant("admin", "*", "*"), nil, authz.WithAuditSink(sink), authz.WithAuditAll())
+	_ = s.Authorize(context.Background(), authz.Subject{ID: "a", Roles: []string{"admin"}}, "delete", "x")
+	_ = s.Authorize(context.Background(), authz.Subject{ID: "b"}, "delete", "x")
+	s.Close()
+	if len(sink.entries) != 2 || sink.entries[0].Status != http.StatusOK || sink.entries[1].Status != http.StatusForbidden {
+		t.Fatalf("entries=%+v", sink.entries)
+	}
+}
@@ -8,7 +8,8 @@
 // 已有子包:
 //
 //	handler      — 类型安全的 HTTP handler 注册(自动 JSON 编解码)
-//	errors       — 结构化错误码(gRPC/HTTP 双模)
+//	errors       — 结构化错误码(gRPC/HTTP 双模,按 ErrorInfo.Reason 多语言文案;i18ncheck 检查翻译)
+//	validate     — 请求校验(struct tag / 消息自校验 / gRPC 拦截器,收集全部 FieldViolation)
 //	dberr        — 数据库错误到 API 错误的映射
 //	audit        — 审计日志
 //	authz        — RBAC/ABAC 授权接口(contrib/ 提供 casbin/openfga 实现)
@@ -49,3 +49,12 @@ type ErrorInfo struct {
 }
 
 func (e *ErrorInfo) detailType() string { return "ErrorInfo" }
+
+// LocalizedMessage 面向终端用户的本地化错误文案，由 Catalog 按 ErrorInfo.Reason 与请求语言生成，
+// WriteHTTPContext / ToGRPCContext 自动附带；Status.Message 仍保留给开发者看的原文。
+type LocalizedMessage struct {
+	Locale  string // 实际命中的语言标签，如 "zh-CN"
+	Message string // 插值后的文案
+}
+
+func (l *LocalizedMessage) detailType() string { return "LocalizedMessage" }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -230,6 +231,42 @@ func TestFromGRPCError(t *testing.T) {
 	}
 }
 
+var registerPartnerCode sync.Once
+
+// 429 与 413 经 gRPC 往返后各自还原;注册在标准 gRPC 码上的业务码不影响反查。
+func TestFromGRPCError_Deterministic(t *testing.T) {
+	registerPartnerCode.Do(func() {
+		errors.Register(errors.Code(77701), 429, uint32(codes.ResourceExhausted), "rate limited by partner")
+	})
+	for range 50 {
+		for _, c := range []errors.Code{errors.CodeTooManyRequests, errors.CodePayloadTooLarge} {
+			back, _ := errors.FromGRPCError(errors.ToGRPC(errors.New(c, "x")))
+			if back.Code() != c {
+				t.Fatalf("round trip of %d = %d", c, back.Code())
+			}
+		}
+	}
+}
+
+func TestGRPCDetailsRoundTrip(t *testing.T) {
+	s := errors.InvalidArgument("bad request").
+		WithDetail(&errors.FieldViolation{Field: "email", Description: "invalid"}).
+		WithDetail(&errors.FieldViolation{Field: "items[0].qty", Description: "must be at least 1"}).
+		WithDetail(&errors.ErrorInfo{Reason: "VALIDATION", Domain: "order"})
+
+	back, ok := errors.FromGRPCError(errors.ToGRPC(s))
+	if !ok || back.Code() != errors.CodeInvalidArgument || len(back.Details()) != 3 {
+		t.Fatalf("round trip: %+v", back)
+	}
+	fv, ok := back.Details()[1].(*errors.FieldViolation)
+	if !ok || fv.Field != "items[0].qty" {
+		t.Fatalf("second detail: %#v", back.Details()[1])
+	}
+	if ei, ok := back.Details()[2].(*errors.ErrorInfo); !ok || ei.Reason != "VALIDATION" {
+		t.Fatalf("third detail: %#v", back.Details()[2])
+	}
+}
+
 // ---- HTTPMiddlewareErrorHandler + SetError ----
 
 func TestHTTPMiddlewareErrorHandler(t *testing.T) {
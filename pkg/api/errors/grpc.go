@@ -3,20 +3,40 @@ package errors
 import (
 	"context"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 // ToGRPC 将 *Status 转换为 gRPC status error，供 gRPC handler 直接返回。
+// 内置详情按 google.rpc 标准类型附带：FieldViolation 合并为一个 BadRequest，
+// RetryInfo / ResourceInfo / QuotaViolation / ErrorInfo / LocalizedMessage 各自对应同名类型；
+// 自定义详情不传输。设置了全局 Catalog 时按默认语言附带 LocalizedMessage；
+// 需要按请求语言协商时用 ToGRPCContext。
 func ToGRPC(s *Status) error {
+	return ToGRPCContext(context.Background(), s)
+}
+
+// ToGRPCContext 同 ToGRPC，LocalizedMessage 按 ctx 的请求语言生成
+// （入站 metadata 的 accept-language，见 LocalesFromContext）。
+func ToGRPCContext(ctx context.Context, s *Status) error {
 	if s == nil {
 		return nil
 	}
-	return grpcstatus.Error(codes.Code(s.code.GRPCCode()), s.message)
+	s = Localize(ctx, s)
+	st := grpcstatus.New(codes.Code(s.code.GRPCCode()), s.message)
+	if details := grpcDetails(s.details); len(details) > 0 {
+		if withDetails, err := st.WithDetails(details...); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
 }
 
-// FromGRPCError 尝试将 gRPC status error 还原为 *Status。
+// FromGRPCError 尝试将 gRPC status error 还原为 *Status，并还原 ToGRPC 附带的内置详情。
 // 若输入不是 gRPC status error，返回 (nil, false)。
 func FromGRPCError(err error) (*Status, bool) {
 	if err == nil {
@@ -26,7 +46,61 @@ func FromGRPCError(err error) (*Status, bool) {
 	if !ok {
 		return nil, false
 	}
-	return New(grpcCodeToFramework(st.Code()), st.Message()), true
+	s := New(grpcCodeToFramework(st.Code()), st.Message())
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				s.details = append(s.details, &FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			s.details = append(s.details, &RetryInfo{RetryDelay: d.GetRetryDelay().AsDuration()})
+		case *errdetails.ResourceInfo:
+			s.details = append(s.details, &ResourceInfo{ResourceType: d.GetResourceType(), Name: d.GetResourceName(), Description: d.GetDescription()})
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				s.details = append(s.details, &QuotaViolation{Subject: v.GetSubject(), Description: v.GetDescription()})
+			}
+		case *errdetails.ErrorInfo:
+			s.details = append(s.details, &ErrorInfo{Reason: d.GetReason(), Domain: d.GetDomain(), Metadata: d.GetMetadata()})
+		case *errdetails.LocalizedMessage:
+			s.details = append(s.details, &LocalizedMessage{Locale: d.GetLocale(), Message: d.GetMessage()})
+		}
+	}
+	return s, true
+}
+
+func grpcDetails(details []Detail) []protoadapt.MessageV1 {
+	var (
+		out   []protoadapt.MessageV1
+		bad   *errdetails.BadRequest
+		quota *errdetails.QuotaFailure
+	)
+	for _, d := range details {
+		switch d := d.(type) {
+		case *FieldViolation:
+			if bad == nil {
+				bad = &errdetails.BadRequest{}
+				out = append(out, bad)
+			}
+			bad.FieldViolations = append(bad.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: d.Field, Description: d.Description})
+		case *QuotaViolation:
+			if quota == nil {
+				quota = &errdetails.QuotaFailure{}
+				out = append(out, quota)
+			}
+			quota.Violations = append(quota.Violations, &errdetails.QuotaFailure_Violation{Subject: d.Subject, Description: d.Description})
+		case *RetryInfo:
+			out = append(out, &errdetails.RetryInfo{RetryDelay: durationpb.New(d.RetryDelay)})
+		case *ResourceInfo:
+			out = append(out, &errdetails.ResourceInfo{ResourceType: d.ResourceType, ResourceName: d.Name, Description: d.Description})
+		case *ErrorInfo:
+			out = append(out, &errdetails.ErrorInfo{Reason: d.Reason, Domain: d.Domain, Metadata: d.Metadata})
+		case *LocalizedMessage:
+			out = append(out, &errdetails.LocalizedMessage{Locale: d.Locale, Message: d.Message})
+		}
+	}
+	return out
 }
 
 // GRPCUnaryServerInterceptor 将 handler 返回的 *Status 自动转换为 gRPC status error。
@@ -35,7 +109,7 @@ func GRPCUnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServe
 	resp, err := handler(ctx, req)
 	if err != nil {
 		if s, ok := FromError(err); ok {
-			return resp, ToGRPC(s)
+			return resp, ToGRPCContext(ctx, s)
 		}
 	}
 	return resp, err
@@ -46,19 +120,15 @@ func GRPCStreamServerInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamSe
 	err := handler(srv, ss)
 	if err != nil {
 		if s, ok := FromError(err); ok {
-			return ToGRPC(s)
+			return ToGRPCContext(ss.Context(), s)
 		}
 	}
 	return err
 }
 
-// grpcCodeToFramework 将 gRPC code 反查为框架 Code。
+// grpcCodeToFramework 将 gRPC code 反查为框架 Code。标准码优先;其余 gRPC 码取注册到该码上的
+// 最小业务码,结果与注册顺序、map 遍历顺序无关。
 func grpcCodeToFramework(c codes.Code) Code {
-	for code, meta := range registry {
-		if meta.grpcCode == uint32(c) {
-			return code
-		}
-	}
 	switch c {
 	case codes.InvalidArgument:
 		return CodeInvalidArgument
@@ -72,6 +142,8 @@ func grpcCodeToFramework(c codes.Code) Code {
 		return CodeUnauthenticated
 	case codes.ResourceExhausted:
 		return CodeTooManyRequests
+	case codes.OutOfRange:
+		return CodePayloadTooLarge
 	case codes.Unimplemented:
 		return CodeUnimplemented
 	case codes.Unavailable:
@@ -80,7 +152,15 @@ func grpcCodeToFramework(c codes.Code) Code {
 		return CodeDeadline
 	case codes.FailedPrecondition:
 		return CodeFailedPrecondition
-	default:
-		return CodeInternal
 	}
+	found, best := false, Code(0)
+	for code, meta := range registry {
+		if meta.grpcCode == uint32(c) && (!found || code < best) {
+			found, best = true, code
+		}
+	}
+	if found {
+		return best
+	}
+	return CodeInternal
 }
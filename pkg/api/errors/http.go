@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 )
@@ -19,8 +20,14 @@ type detailJSON struct {
 }
 
 // WriteHTTP 将 *Status 序列化为 JSON 写入 http.ResponseWriter。
-// Content-Type 固定为 application/json。
+// Content-Type 固定为 application/json。设置了全局 Catalog 时按默认语言附带 LocalizedMessage；
+// 需要按请求语言协商时用 WriteHTTPContext。
 func WriteHTTP(w http.ResponseWriter, s *Status) {
+	WriteHTTPContext(context.Background(), w, s)
+}
+
+// WriteHTTPContext 同 WriteHTTP，LocalizedMessage 按 ctx 的请求语言生成（见 Localize、WithRequestLocales）。
+func WriteHTTPContext(ctx context.Context, w http.ResponseWriter, s *Status) {
 	if s == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -30,6 +37,7 @@ func WriteHTTP(w http.ResponseWriter, s *Status) {
 		})
 		return
 	}
+	s = Localize(ctx, s)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(s.code.HTTPStatus())
 	resp := httpResponse{
@@ -47,6 +55,7 @@ func WriteHTTP(w http.ResponseWriter, s *Status) {
 
 // HTTPMiddlewareErrorHandler 返回一个 HTTP 中间件，将 handler 产生的 *Status 错误
 // 转换为结构化 JSON 响应。handler 通过 ctx 中的 errorSink 写入错误。
+// 错误文案按请求的 Accept-Language 本地化（见 Localize）。
 //
 // 使用场景：handler 无法直接返回 error（net/http 签名限制），
 // 可通过 SetError(ctx, err) 写入，中间件统一处理。
@@ -61,11 +70,11 @@ func WriteHTTP(w http.ResponseWriter, s *Status) {
 //	}
 func HTTPMiddlewareErrorHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := withErrorSink(r.Context())
+		ctx := withErrorSink(WithRequestLocales(r))
 		next.ServeHTTP(w, r.WithContext(ctx))
 		if err := getError(ctx); err != nil {
 			if s, ok := FromError(err); ok {
-				WriteHTTP(w, s)
+				WriteHTTPContext(ctx, w, s)
 			} else {
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,344 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rushteam/beauty/pkg/foundation/vars"
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog 是按 ErrorInfo.Reason 索引的多语言错误文案表。
+//
+// 文案支持 ${key} / ${key:-默认值} 插值，参数取自 ErrorInfo.Metadata（见 foundation/vars）：
+//
+//	c := errors.NewCatalog("en")
+//	c.Add("en", "USER_NOT_FOUND", "User ${user_id} does not exist")
+//	c.Add("zh-CN", "USER_NOT_FOUND", "用户 ${user_id} 不存在")
+//	errors.SetCatalog(c)
+//
+//	return errors.NotFound("user not found").
+//	    WithDetail(&errors.ErrorInfo{Reason: "USER_NOT_FOUND", Metadata: map[string]string{"user_id": id}})
+//
+// 语言回退链：对请求的每个语言标签依次尝试 标签本身 → SetFallback 显式回退 → 逐段截断
+// （zh-Hant-TW → zh-Hant → zh），全部落空后用默认语言，最后用 RegisterReason 登记的原文。
+// 标签匹配不区分大小写，"_" 视同 "-"。并发安全。
+type Catalog struct {
+	defaultLocale string
+
+	mu        sync.RWMutex
+	messages  map[string]map[string]string // locale key → reason → message
+	names     map[string]string            // locale key → 原始标签（用于回显）
+	fallbacks map[string][]string          // locale key → 显式回退链
+}
+
+// NewCatalog 创建以 defaultLocale 为兜底语言的文案表。
+func NewCatalog(defaultLocale string) *Catalog {
+	return &Catalog{
+		defaultLocale: defaultLocale,
+		messages:      make(map[string]map[string]string),
+		names:         make(map[string]string),
+		fallbacks:     make(map[string][]string),
+	}
+}
+
+// DefaultLocale 返回兜底语言。
+func (c *Catalog) DefaultLocale() string { return c.defaultLocale }
+
+// Add 添加一条文案，同语言同 reason 覆盖。
+func (c *Catalog) Add(locale, reason, message string) {
+	c.AddMessages(locale, map[string]string{reason: message})
+}
+
+// AddMessages 批量添加某语言的文案。
+func (c *Catalog) AddMessages(locale string, messages map[string]string) {
+	k := localeKey(locale)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.messages[k]
+	if !ok {
+		m = make(map[string]string, len(messages))
+		c.messages[k] = m
+		c.names[k] = locale
+	}
+	for r, msg := range messages {
+		m[r] = msg
+	}
+}
+
+// SetFallback 为 locale 设置显式回退链，如 SetFallback("zh-HK", "zh-TW")：
+// 香港繁体缺失的文案先找台湾繁体，再走常规截断回退。
+func (c *Catalog) SetFallback(locale string, chain ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fallbacks[localeKey(locale)] = append([]string(nil), chain...)
+}
+
+// Locales 返回已加载的语言标签（排序）。
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]string, 0, len(c.names))
+	for _, n := range c.names {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Reasons 返回 locale 自身（不含回退）已有文案的 reason（排序）。
+func (c *Catalog) Reasons(locale string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := c.messages[localeKey(locale)]
+	out := make([]string, 0, len(m))
+	for r := range m {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Lookup 按 locales 的优先顺序查找 reason 的文案（未插值），返回命中的语言标签。
+func (c *Catalog) Lookup(reason string, locales ...string) (locale, message string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, k := range c.chain(locales, true) {
+		if msg, hit := c.messages[k][reason]; hit {
+			return c.names[k], msg, true
+		}
+	}
+	if msg, hit := registeredReason(reason); hit {
+		return c.defaultLocale, msg, true
+	}
+	return "", "", false
+}
+
+// Format 查找并用 params 插值，未命中返回 ("", "", false)。
+func (c *Catalog) Format(reason string, params map[string]string, locales ...string) (locale, message string, ok bool) {
+	locale, msg, ok := c.Lookup(reason, locales...)
+	if !ok {
+		return "", "", false
+	}
+	return locale, vars.Render(msg, params), true
+}
+
+// chain 展开回退链（已去重），withDefault 时末尾追加默认语言；调用方持有读锁。
+func (c *Catalog) chain(locales []string, withDefault bool) []string {
+	var out []string
+	seen := make(map[string]bool)
+	var visit func(tag string)
+	visit = func(tag string) {
+		k := localeKey(tag)
+		if k == "" || seen[k] {
+			return
+		}
+		seen[k] = true
+		out = append(out, k)
+		for _, fb := range c.fallbacks[k] {
+			visit(fb)
+		}
+		if i := strings.LastIndexByte(k, '-'); i > 0 {
+			visit(k[:i])
+		}
+	}
+	for _, l := range locales {
+		visit(l)
+	}
+	if withDefault {
+		visit(c.defaultLocale)
+	}
+	return out
+}
+
+// Missing 返回各语言缺失的 reason：能经显式回退或截断回退命中的不算缺失，
+// 但回落到默认语言或 RegisterReason 原文的算缺失。locales 为空时检查全部已加载语言。
+func (c *Catalog) Missing(reasons []string, locales ...string) map[string][]string {
+	if len(locales) == 0 {
+		locales = c.Locales()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string][]string)
+	for _, l := range locales {
+		ch := c.chain([]string{l}, false)
+		for _, r := range reasons {
+			found := false
+			for _, k := range ch {
+				if _, found = c.messages[k][r]; found {
+					break
+				}
+			}
+			if !found {
+				out[l] = append(out[l], r)
+			}
+		}
+	}
+	return out
+}
+
+// fallbackKey 是文案文件中声明显式回退链的保留键，值为逗号分隔字符串或字符串列表。
+const fallbackKey = "@fallback"
+
+// LoadCatalog 从 fsys 的 dir 目录加载文案文件：每个 <locale>.json / .yaml / .yml 是一种语言，
+// 内容为 reason → 文案 的扁平映射；可选保留键 "@fallback" 声明该语言的回退链。
+//
+//	# locales/zh-HK.yaml
+//	"@fallback": zh-TW
+//	USER_NOT_FOUND: 用戶 ${user_id} 不存在
+//
+//	c, err := errors.LoadCatalog(os.DirFS("."), "locales", "en")
+func LoadCatalog(fsys fs.FS, dir, defaultLocale string) (*Catalog, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	c := NewCatalog(defaultLocale)
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		name := path.Join(dir, e.Name())
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var raw map[string]any
+		if ext == ".json" {
+			err = json.Unmarshal(b, &raw)
+		} else {
+			err = yaml.Unmarshal(b, &raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("errors: parse %s: %w", name, err)
+		}
+		locale := strings.TrimSuffix(e.Name(), ext)
+		msgs := make(map[string]string, len(raw))
+		for k, v := range raw {
+			if k == fallbackKey {
+				chain, err := parseFallback(v)
+				if err != nil {
+					return nil, fmt.Errorf("errors: %s: %w", name, err)
+				}
+				c.SetFallback(locale, chain...)
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("errors: %s: message for %q is %T, want string", name, k, v)
+			}
+			msgs[k] = s
+		}
+		c.AddMessages(locale, msgs)
+	}
+	return c, nil
+}
+
+func parseFallback(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, x := range v {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s entries must be strings", fallbackKey)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s must be a string or a list", fallbackKey)
+}
+
+func localeKey(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+var (
+	globalCatalog atomic.Pointer[Catalog]
+
+	reasonsMu sync.RWMutex
+	reasons   = map[string]string{}
+)
+
+// SetCatalog 设置全局文案表，WriteHTTP / ToGRPC 等据此附带 LocalizedMessage；传 nil 关闭。
+// 可在配置热更新时整体替换。
+func SetCatalog(c *Catalog) { globalCatalog.Store(c) }
+
+// GetCatalog 返回全局文案表（未设置时为 nil）。
+func GetCatalog() *Catalog { return globalCatalog.Load() }
+
+// RegisterReason 登记一个业务错误原因及其原文（源语言）文案，与 Register 一样在 init() 中调用。
+// 登记的原文在所有语言都缺失时兜底；Reasons 列表供 i18ncheck 检查翻译是否齐全。
+// 重复登记同一 reason 会 panic。
+func RegisterReason(reason, message string) {
+	reasonsMu.Lock()
+	defer reasonsMu.Unlock()
+	if _, dup := reasons[reason]; dup {
+		panic("errors: duplicate reason registration: " + reason)
+	}
+	reasons[reason] = message
+}
+
+// Reasons 返回已登记的全部 reason（排序）。
+func Reasons() []string {
+	reasonsMu.RLock()
+	defer reasonsMu.RUnlock()
+	out := make([]string, 0, len(reasons))
+	for r := range reasons {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func registeredReason(reason string) (string, bool) {
+	reasonsMu.RLock()
+	defer reasonsMu.RUnlock()
+	msg, ok := reasons[reason]
+	return msg, ok
+}
+
+// Localize 按 ctx 协商出的语言（见 LocalesFromContext）为 s 附带 LocalizedMessage，返回新 Status。
+// 未设置全局文案表、s 无 ErrorInfo、文案未命中或已带 LocalizedMessage 时原样返回。
+func Localize(ctx context.Context, s *Status) *Status {
+	c := GetCatalog()
+	if c == nil || s == nil {
+		return s
+	}
+	var info *ErrorInfo
+	for _, d := range s.details {
+		switch d := d.(type) {
+		case *LocalizedMessage:
+			return s
+		case *ErrorInfo:
+			if info == nil {
+				info = d
+			}
+		}
+	}
+	if info == nil || info.Reason == "" {
+		return s
+	}
+	locale, msg, ok := c.Format(info.Reason, info.Metadata, LocalesFromContext(ctx)...)
+	if !ok {
+		return s
+	}
+	return s.WithDetail(&LocalizedMessage{Locale: locale, Message: msg})
+}
@@ -0,0 +1,145 @@
+package errors_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rushteam/beauty/pkg/api/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+func init() {
+	errors.RegisterReason("ORDER_LOCKED", "Order ${order_id} is locked")
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := errors.ParseAcceptLanguage("en;q=0.5, zh-CN, zh;q=0.9, *;q=0.1, fr;q=0")
+	if want := []string{"zh-CN", "zh", "en"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCatalog_FallbackChain(t *testing.T) {
+	c := errors.NewCatalog("en")
+	c.Add("en", "USER_NOT_FOUND", "User ${user_id} does not exist")
+	c.Add("zh", "USER_NOT_FOUND", "用户 ${user_id} 不存在")
+	c.Add("zh-TW", "QUOTA", "配額已用盡")
+	c.SetFallback("zh-HK", "zh-TW")
+
+	cases := []struct {
+		locales    []string
+		reason     string
+		wantLocale string
+		wantMsg    string
+	}{
+		{[]string{"zh-Hans-CN"}, "USER_NOT_FOUND", "zh", "用户 42 不存在"},            // 截断回退
+		{[]string{"ZH_hk"}, "QUOTA", "zh-TW", "配額已用盡"},                           // 显式回退 + 大小写/下划线
+		{[]string{"ja", "fr"}, "USER_NOT_FOUND", "en", "User 42 does not exist"}, // 默认语言
+		{nil, "ORDER_LOCKED", "en", "Order 7 is locked"},                         // RegisterReason 原文兜底
+	}
+	params := map[string]string{"user_id": "42", "order_id": "7"}
+	for _, tc := range cases {
+		locale, msg, ok := c.Format(tc.reason, params, tc.locales...)
+		if !ok || locale != tc.wantLocale || msg != tc.wantMsg {
+			t.Errorf("%v %s: got (%q, %q, %v)", tc.locales, tc.reason, locale, msg, ok)
+		}
+	}
+	if _, _, ok := c.Lookup("UNKNOWN", "en"); ok {
+		t.Error("unknown reason should miss")
+	}
+
+	missing := c.Missing([]string{"USER_NOT_FOUND", "QUOTA"}, "en", "zh-HK", "ja")
+	if want := map[string][]string{"en": {"QUOTA"}, "ja": {"USER_NOT_FOUND", "QUOTA"}}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing: got %v, want %v", missing, want)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json":    {Data: []byte(`{"ORDER_LOCKED": "Order ${order_id} is locked"}`)},
+		"locales/zh-TW.yaml": {Data: []byte("ORDER_LOCKED: 訂單 ${order_id} 已鎖定\n")},
+		"locales/zh-HK.yml":  {Data: []byte("\"@fallback\": [zh-TW]\n")},
+		"locales/README.md":  {Data: []byte("ignored")},
+	}
+	c, err := errors.LoadCatalog(fsys, "locales", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Locales(); !reflect.DeepEqual(got, []string{"en", "zh-HK", "zh-TW"}) {
+		t.Fatalf("locales: %v", got)
+	}
+	if locale, msg, _ := c.Format("ORDER_LOCKED", map[string]string{"order_id": "9"}, "zh-HK"); locale != "zh-TW" || msg != "訂單 9 已鎖定" {
+		t.Fatalf("zh-HK: %q %q", locale, msg)
+	}
+
+	bad := fstest.MapFS{"l/en.json": {Data: []byte(`{"X": 1}`)}}
+	if _, err := errors.LoadCatalog(bad, "l", "en"); err == nil {
+		t.Fatal("non-string message should fail")
+	}
+}
+
+func withCatalog(t *testing.T) {
+	t.Helper()
+	c := errors.NewCatalog("en")
+	c.Add("zh-CN", "ORDER_LOCKED", "订单 ${order_id} 已锁定")
+	errors.SetCatalog(c)
+	t.Cleanup(func() { errors.SetCatalog(nil) })
+}
+
+func lockedErr() *errors.Status {
+	return errors.New(errors.CodeFailedPrecondition, "order locked").
+		WithDetail(&errors.ErrorInfo{Reason: "ORDER_LOCKED", Metadata: map[string]string{"order_id": "7"}})
+}
+
+func TestHTTPMiddlewareErrorHandler_Localized(t *testing.T) {
+	withCatalog(t)
+	h := errors.HTTPMiddlewareErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errors.SetError(r.Context(), lockedErr())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var resp struct {
+		Message string
+		Details []struct {
+			Type string
+			Data map[string]any
+		}
+	}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Message != "order locked" {
+		t.Errorf("developer message should stay: %q", resp.Message)
+	}
+	last := resp.Details[len(resp.Details)-1]
+	if last.Type != "LocalizedMessage" || last.Data["Locale"] != "zh-CN" || last.Data["Message"] != "订单 7 已锁定" {
+		t.Fatalf("localized detail: %+v", last)
+	}
+}
+
+func TestToGRPCContext_Localized(t *testing.T) {
+	withCatalog(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "zh-CN"))
+	back, _ := errors.FromGRPCError(errors.ToGRPCContext(ctx, lockedErr()))
+	var lm *errors.LocalizedMessage
+	for _, d := range back.Details() {
+		if d, ok := d.(*errors.LocalizedMessage); ok {
+			lm = d
+		}
+	}
+	if lm == nil || lm.Locale != "zh-CN" || lm.Message != "订单 7 已锁定" {
+		t.Fatalf("grpc localized: %+v", lm)
+	}
+
+	// 无请求语言:ToGRPC 按默认语言,回落到 RegisterReason 原文。
+	back, _ = errors.FromGRPCError(errors.ToGRPC(lockedErr()))
+	if lm := back.Details()[1].(*errors.LocalizedMessage); lm.Locale != "en" || lm.Message != "Order 7 is locked" {
+		t.Fatalf("default locale: %+v", lm)
+	}
+}
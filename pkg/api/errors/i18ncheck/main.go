@@ -0,0 +1,234 @@
+// i18ncheck 检查 errors.RegisterReason 登记的每个 reason 在文案目录里都有翻译。
+//
+//	go run github.com/rushteam/beauty/pkg/api/errors/i18ncheck -dir locales -default en ./...
+//	go run github.com/rushteam/beauty/pkg/api/errors/i18ncheck -dir locales -default en -locales zh-CN,ja ./internal/...
+//
+// reason 从 Go 源码里的 RegisterReason 调用中静态提取（首参为字符串字面量或同包字符串常量）；
+// 文案目录按 errors.LoadCatalog 的格式加载；能经显式或截断回退命中的不算缺失，回落到默认语言的算缺失。
+// -locales 缺省时检查目录下全部语言。有缺失时逐条列出并以状态码 1 退出；
+// 文案里存在但未登记的 reason 只打印警告（-strict 时同样视为失败）。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rushteam/beauty/pkg/api/errors"
+)
+
+func main() {
+	var (
+		dir     = flag.String("dir", "locales", "catalog directory (<locale>.json|yaml)")
+		def     = flag.String("default", "en", "default locale of the catalog")
+		locales = flag.String("locales", "", "comma separated locales to check (default: all in -dir)")
+		strict  = flag.Bool("strict", false, "fail on translations for unregistered reasons")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: i18ncheck [flags] [packages]  (e.g. ./...)")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	ok, err := run(*dir, *def, splitList(*locales), flag.Args(), *strict)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "i18ncheck:", err)
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func run(dir, def string, locales, patterns []string, strict bool) (bool, error) {
+	catalog, err := errors.LoadCatalog(os.DirFS(dir), ".", def)
+	if err != nil {
+		return false, err
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	reasons, err := scan(patterns)
+	if err != nil {
+		return false, err
+	}
+	if len(reasons) == 0 {
+		return false, fmt.Errorf("no RegisterReason calls found in %s", strings.Join(patterns, " "))
+	}
+	names := make([]string, 0, len(reasons))
+	for r := range reasons {
+		names = append(names, r)
+	}
+	sort.Strings(names)
+
+	ok := true
+	missing := catalog.Missing(names, locales...)
+	checked := locales
+	if len(checked) == 0 {
+		checked = catalog.Locales()
+	}
+	for _, l := range checked {
+		for _, r := range missing[l] {
+			ok = false
+			fmt.Printf("%s: missing %s (registered at %s)\n", l, r, reasons[r])
+		}
+	}
+	for _, l := range catalog.Locales() {
+		for _, r := range unregistered(catalog, l, reasons) {
+			if strict {
+				ok = false
+			}
+			fmt.Printf("%s: warning: %s is translated but not registered\n", l, r)
+		}
+	}
+	if ok {
+		fmt.Printf("ok: %d reasons x %d locales\n", len(names), len(checked))
+	}
+	return ok, nil
+}
+
+// unregistered 返回 locale 文案中出现、但源码未登记的 reason。
+func unregistered(c *errors.Catalog, locale string, reasons map[string]string) []string {
+	var out []string
+	for _, r := range c.Reasons(locale) {
+		if _, ok := reasons[r]; !ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// scan 解析 patterns 指定的包目录（"dir/..." 递归），返回 reason → 登记位置。
+func scan(patterns []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, p := range patterns {
+		root, recursive := strings.CutSuffix(p, "/...")
+		if p == "..." {
+			root, recursive = ".", true
+		}
+		walk := func(dir string) error { return scanDir(dir, out) }
+		if !recursive {
+			if err := walk(root); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			if name := d.Name(); path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return walk(path)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// scanDir 扫描单个目录下的非测试 Go 文件；同目录的包级字符串常量可作为 RegisterReason 的参数。
+func scanDir(dir string, out map[string]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	consts := make(map[string]string)
+	for _, f := range files {
+		collectConsts(f, consts)
+	}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 || !isRegisterReason(call.Fun) {
+				return true
+			}
+			if r, ok := stringValue(call.Args[0], consts); ok {
+				if _, dup := out[r]; !dup {
+					out[r] = fset.Position(call.Pos()).String()
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: warning: RegisterReason argument is not a constant string\n", fset.Position(call.Pos()))
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+func isRegisterReason(fun ast.Expr) bool {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return f.Name == "RegisterReason"
+	case *ast.SelectorExpr:
+		return f.Sel.Name == "RegisterReason"
+	}
+	return false
+}
+
+func collectConsts(f *ast.File, consts map[string]string) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i < len(vs.Values) {
+					if s, ok := stringValue(vs.Values[i], nil); ok {
+						consts[name.Name] = s
+					}
+				}
+			}
+		}
+	}
+}
+
+func stringValue(e ast.Expr, consts map[string]string) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			s, err := strconv.Unquote(e.Value)
+			return s, err == nil
+		}
+	case *ast.Ident:
+		s, ok := consts[e.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return stringValue(e.X, consts)
+	}
+	return "", false
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, x)
+		}
+	}
+	return out
+}
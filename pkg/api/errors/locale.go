@@ -0,0 +1,99 @@
+package errors
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"google.golang.org/grpc/metadata"
+)
+
+var localesKey = ctxkey.New[[]string]()
+
+// grpcLocaleKeys 是读取请求语言的 gRPC metadata 键：客户端直接设置的 accept-language，
+// 以及 grpc-gateway 从 HTTP Accept-Language 头转发来的键。
+var grpcLocaleKeys = []string{"accept-language", "grpcgateway-accept-language"}
+
+// WithLocales 把按优先级排好的语言标签绑定到 ctx。
+func WithLocales(ctx context.Context, locales ...string) context.Context {
+	return ctxkey.With(ctx, localesKey, locales)
+}
+
+// LocalesFromContext 返回 ctx 的请求语言（按优先级）：先取 WithLocales 绑定的，
+// 再取 gRPC 入站 metadata 的 accept-language；都没有返回 nil。
+func LocalesFromContext(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	if ls, ok := ctxkey.Get(ctx, localesKey); ok {
+		return ls
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, k := range grpcLocaleKeys {
+			if v := md.Get(k); len(v) > 0 {
+				return ParseAcceptLanguage(strings.Join(v, ","))
+			}
+		}
+	}
+	return nil
+}
+
+// WithRequestLocales 返回绑定了 r 的 Accept-Language 协商结果的 ctx；ctx 已绑定时原样返回。
+func WithRequestLocales(r *http.Request) context.Context {
+	ctx := r.Context()
+	if _, ok := ctxkey.Get(ctx, localesKey); ok {
+		return ctx
+	}
+	if h := r.Header.Get("Accept-Language"); h != "" {
+		return WithLocales(ctx, ParseAcceptLanguage(h)...)
+	}
+	return ctx
+}
+
+// HTTPLocaleMiddleware 把 Accept-Language 协商结果放进请求 ctx，供下游 WriteHTTPContext / Localize 使用。
+func HTTPLocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestLocales(r)))
+	})
+}
+
+// ParseAcceptLanguage 解析 Accept-Language（RFC 9110 §12.5.4），按 q 值降序返回语言标签，
+// 同 q 保持原顺序；忽略 "*" 与 q=0 的项。
+//
+//	ParseAcceptLanguage("zh-CN,zh;q=0.9,en;q=0.8") // ["zh-CN", "zh", "en"]
+func ParseAcceptLanguage(h string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(h, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if name == "" || name == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, tag{name, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.name
+	}
+	return out
+}
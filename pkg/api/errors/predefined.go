@@ -31,6 +31,7 @@ const (
 	CodeForbidden          Code = 403 // 无权限
 	CodeNotFound           Code = 404 // 资源不存在
 	CodeConflict           Code = 409 // 资源冲突/已存在
+	CodePayloadTooLarge    Code = 413 // 请求体过大
 	CodeTooManyRequests    Code = 429 // 请求过频
 	CodeFailedPrecondition Code = 412 // 前置条件不满足
 
@@ -47,6 +48,8 @@ func init() {
 	Register(CodeForbidden, 403, grpcPermissionDenied, "forbidden")
 	Register(CodeNotFound, 404, grpcNotFound, "not found")
 	Register(CodeConflict, 409, grpcAlreadyExists, "conflict")
+	// ResourceExhausted 留给 429:两者共用同一 gRPC 码时,经 gRPC 往返后无法区分
+	Register(CodePayloadTooLarge, 413, grpcOutOfRange, "payload too large")
 	Register(CodeTooManyRequests, 429, grpcResourceExhausted, "too many requests")
 	Register(CodeFailedPrecondition, 412, grpcFailedPrecondition, "failed precondition")
 	Register(CodeInternal, 500, grpcInternal, "internal server error")
@@ -62,6 +65,7 @@ func Unauthenticated(msg string) *Status { return New(CodeUnauthenticated, msg)
 func Forbidden(msg string) *Status       { return New(CodeForbidden, msg) }
 func NotFound(msg string) *Status        { return New(CodeNotFound, msg) }
 func Conflict(msg string) *Status        { return New(CodeConflict, msg) }
+func PayloadTooLarge(msg string) *Status { return New(CodePayloadTooLarge, msg) }
 func TooManyRequests(msg string) *Status { return New(CodeTooManyRequests, msg) }
 func Internal(msg string) *Status        { return New(CodeInternal, msg) }
 func Unimplemented(msg string) *Status   { return New(CodeUnimplemented, msg) }
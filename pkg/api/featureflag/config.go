@@ -0,0 +1,120 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// ConfigLoader 是 conf.Loader 的方法集。featureflag 不直接依赖 pkg/conf,免得把 viper 等配置中心
+// 依赖带给只用 Replace 的调用方;conf.New 返回的加载器可直接传入。
+type ConfigLoader interface {
+	Unmarshal(dst any) error
+	Watch(ctx context.Context, fn func())
+}
+
+// Document 是配置文件里的完整开关集合，供 Replace / LoadConfig / WatchConfig 使用：
+//
+//	segments:
+//	  - key: beta-testers
+//	    included: [u-1, u-2]
+//	    conditions:
+//	      - {attr: email, op: matches, values: ['@example\.com$']}
+//	flags:
+//	  - key: new-checkout
+//	    enabled: true
+//	    prerequisites: [payments-v2]
+//	    rules:
+//	      - conditions: [{op: in_segment, values: [beta-testers]}]
+//	        force: true
+//	      - conditions: [{attr: app_version, op: semver, values: ["<3.0.0"]}]
+//	        force: false
+//	    schedule:
+//	      - {at: 2026-11-01T00:00:00Z, rollout: 0.05}
+//	      - {at: 2026-11-08T00:00:00Z, rollout: 1}
+//	experiments:
+//	  - key: checkout-button
+//	    variants: [control, green]
+//
+// 时间字段同时接受 YAML 时间戳与 RFC 3339 字符串。注意 viper 会把 map 键转成小写，
+// Rule.When 的属性名在配置文件里应使用小写；Condition.Attr 是值，不受影响。
+type Document struct {
+	Flags       []Flag       `mapstructure:"flags" json:"flags" yaml:"flags"`
+	Segments    []Segment    `mapstructure:"segments" json:"segments,omitempty" yaml:"segments,omitempty"`
+	Experiments []Experiment `mapstructure:"experiments" json:"experiments,omitempty" yaml:"experiments,omitempty"`
+}
+
+// Replace 编译并整体替换开关、分群与实验。任一定义非法、键重复或前置开关成环时返回错误，
+// 原配置保持不变；成功时未出现在 doc 中的旧定义被移除。
+func (e *Engine) Replace(doc Document) error {
+	flags := make(map[string]*compiledFlag, len(doc.Flags))
+	for _, f := range doc.Flags {
+		cf, err := compileFlag(f)
+		if err != nil {
+			return err
+		}
+		if _, dup := flags[f.Key]; dup {
+			return fmt.Errorf("featureflag: duplicate flag %q", f.Key)
+		}
+		flags[f.Key] = cf
+	}
+	if err := checkPrerequisites(flags); err != nil {
+		return err
+	}
+	segments := make(map[string]*compiledSegment, len(doc.Segments))
+	for _, s := range doc.Segments {
+		cs, err := compileSegment(s)
+		if err != nil {
+			return err
+		}
+		if _, dup := segments[s.Key]; dup {
+			return fmt.Errorf("featureflag: duplicate segment %q", s.Key)
+		}
+		segments[s.Key] = cs
+	}
+	exps := make(map[string]Experiment, len(doc.Experiments))
+	for _, x := range doc.Experiments {
+		if _, dup := exps[x.Key]; dup {
+			return fmt.Errorf("featureflag: duplicate experiment %q", x.Key)
+		}
+		exps[x.Key] = x
+	}
+	e.mu.Lock()
+	e.flags, e.segments, e.exps = flags, segments, exps
+	e.mu.Unlock()
+	return nil
+}
+
+// LoadConfig 从配置加载器读取 Document 并整体替换。
+func (e *Engine) LoadConfig(l ConfigLoader) error {
+	// 先解到通用 map 再经 JSON 转成 Document：mapstructure 不能把字符串解成 time.Time，
+	// 而 JSON 两种时间写法都能接住。
+	var raw map[string]any
+	if err := l.Unmarshal(&raw); err != nil {
+		return fmt.Errorf("featureflag: unmarshal config: %w", err)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("featureflag: unmarshal config: %w", err)
+	}
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("featureflag: unmarshal config: %w", err)
+	}
+	return e.Replace(doc)
+}
+
+// WatchConfig 先同步加载一次，再在配置变更时热加载。变更后的配置非法时记录告警并
+// 保留上一份可用配置（last-good）。ctx 取消后停止监听。
+func (e *Engine) WatchConfig(ctx context.Context, l ConfigLoader) error {
+	if err := e.LoadConfig(l); err != nil {
+		return err
+	}
+	l.Watch(ctx, func() {
+		if err := e.LoadConfig(l); err != nil {
+			slog.Warn("featureflag: ignored invalid config update, keeping last-good", "err", err)
+		}
+	})
+	return nil
+}
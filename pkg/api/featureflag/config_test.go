@@ -0,0 +1,113 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/conf"
+)
+
+// fakeLoader 实现 ConfigLoader:Unmarshal 经 JSON 返回当前文档,Watch 记下回调供测试触发。
+type fakeLoader struct {
+	doc      string
+	onChange func()
+}
+
+func (f *fakeLoader) Unmarshal(dst any) error { return json.Unmarshal([]byte(f.doc), dst) }
+
+func (f *fakeLoader) Watch(_ context.Context, fn func()) { f.onChange = fn }
+
+func TestWatchConfig(t *testing.T) {
+	l := &fakeLoader{doc: `{"flags":[{"key":"a","enabled":true}],"experiments":[{"key":"x","variants":["only"]}]}`}
+	e := New()
+	if err := e.WatchConfig(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if !e.IsEnabled("a", "u", nil) {
+		t.Fatal("v1 not applied")
+	}
+	if v, _ := e.Variant("x", "u"); v != "only" {
+		t.Fatalf("experiment not loaded: %q", v)
+	}
+
+	l.doc = `{"flags":[{"key":"b","enabled":true,"schedule":[{"at":"2020-01-01T00:00:00Z","rollout":1}]}]}`
+	l.onChange()
+	if e.IsEnabled("a", "u", nil) || !e.IsEnabled("b", "u", nil) {
+		t.Fatal("hot reload should replace the whole set")
+	}
+	if _, ok := e.Variant("x", "u"); ok {
+		t.Fatal("removed experiment still served")
+	}
+
+	l.doc = `{"flags":[{"key":"c","prerequisites":["d"]},{"key":"d","prerequisites":["c"]}]}`
+	l.onChange()
+	if !e.IsEnabled("b", "u", nil) {
+		t.Fatal("invalid update should keep last-good")
+	}
+}
+
+func TestLoadConfig_YAMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	yaml := `
+segments:
+  - key: beta
+    included: [u-1]
+flags:
+  - key: new-ui
+    enabled: true
+    rollout: 0.000001
+    rules:
+      - conditions: [{op: in_segment, values: [beta]}]
+        force: true
+      - when: {plan: pro}
+        conditions: [{attr: app_version, op: semver, values: [">=3.0.0"]}]
+        force: true
+  - key: ramp
+    enabled: true
+    schedule:
+      - {at: 2020-01-01T00:00:00Z, rollout: 0}
+      - at: "2021-01-01T00:00:00Z"
+        rollout: 1
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := conf.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	if err := e.LoadConfig(l); err != nil {
+		t.Fatal(err)
+	}
+	if !e.IsEnabled("new-ui", "u-1", nil) {
+		t.Fatal("segment member should be on")
+	}
+	if !e.IsEnabled("new-ui", "u-2", Attributes{"plan": "pro", "app_version": "3.1.0"}) {
+		t.Fatal("pro on new app should be on")
+	}
+	if e.IsEnabled("new-ui", "u-2", Attributes{"plan": "pro", "app_version": "2.9.0"}) {
+		t.Fatal("pro on old app should fall through to rollout")
+	}
+	e.now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+	if !e.IsEnabled("ramp", "anyone", nil) {
+		t.Fatal("schedule with quoted and unquoted times should load")
+	}
+}
+
+func TestReplace_RejectsDuplicates(t *testing.T) {
+	e := New()
+	for _, doc := range []Document{
+		{Flags: []Flag{{Key: "a"}, {Key: "a"}}},
+		{Segments: []Segment{{Key: "s"}, {Key: "s"}}},
+		{Experiments: []Experiment{{Key: "x", Variants: []string{"a"}}, {Key: "x", Variants: []string{"b"}}}},
+	} {
+		if err := e.Replace(doc); err == nil {
+			t.Errorf("Replace(%+v) accepted duplicate keys", doc)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package featureflag
+
+import (
+	"strconv"
+	"time"
+)
+
+// Kind 区分曝光来源。
+type Kind string
+
+const (
+	KindFlag       Kind = "flag"
+	KindExperiment Kind = "experiment"
+)
+
+// Exposure 是一次曝光事件：某标识在某时刻被评估到某个开关结果/实验变体。
+// 实验分析用 (Key, ID) 与业务结果事件关联，得出各组指标。
+type Exposure struct {
+	Kind    Kind      `json:"kind"`
+	Key     string    `json:"key"`
+	ID      string    `json:"id"`
+	Enabled bool      `json:"enabled,omitempty"` // Kind=flag 时的结果
+	Variant string    `json:"variant,omitempty"` // Kind=experiment 时的变体
+	Reason  Reason    `json:"reason,omitempty"`  // Kind=flag 时的评估依据
+	Bulk    bool      `json:"bulk,omitempty"`    // 来自 Handler 批量评估：客户端拿到了结果，但未必已使用
+	Time    time.Time `json:"time"`
+}
+
+// WithExposure 设置曝光回调。开关存在的每次评估、实验纳入的每次分配都会触发，
+// 同一 (标识, 开关/实验, 结果, 是否批量) 在去重窗口内只上报一次（见 WithExposureDedup）。
+// 回调在评估的调用方 goroutine 中同步执行，应尽快返回（如写入 mq 或异步缓冲）。
+func WithExposure(fn func(Exposure)) Option {
+	return func(e *Engine) { e.onExposure = fn }
+}
+
+// WithExposureDedup 设置去重窗口容量（最近 n 个不同曝光，LRU 淘汰），默认 10000。
+// n<=0 关闭去重，每次评估都上报。
+func WithExposureDedup(n int) Option {
+	return func(e *Engine) { e.dedupSize = n }
+}
+
+func (e *Engine) expose(x Exposure) {
+	if e.onExposure == nil {
+		return
+	}
+	if e.seen != nil {
+		// Bulk 参与去重键:批量评估的曝光不能吞掉随后真正使用时的曝光。
+		k := string(x.Kind) + "\x00" + x.Key + "\x00" + x.ID + "\x00" + x.Variant + "\x00" +
+			strconv.FormatBool(x.Enabled) + "\x00" + strconv.FormatBool(x.Bulk)
+		e.seenMu.Lock()
+		_, dup := e.seen.Get(k)
+		if !dup {
+			e.seen.Set(k, struct{}{})
+		}
+		e.seenMu.Unlock()
+		if dup {
+			return
+		}
+	}
+	x.Time = e.now()
+	e.onExposure(x)
+}
@@ -1,59 +1,135 @@
 // Package featureflag 提供本地评估的特性开关与 A/B 实验：
 // 布尔开关、百分比灰度、按属性定向、多变体实验，均基于确定性哈希分桶，
 // 同一标识（如 userID）多次评估结果稳定，无需远程调用。
+//
+// 定向规则支持等值、in/not_in、数值比较、semver 范围、正则与分群（Segment）；
+// 开关可声明前置开关（Prerequisites）与按时间爬坡的灰度计划（Schedule）。
+// 整套配置可由 pkg/conf 加载并热更新（见 Document、WatchConfig），
+// 曝光事件（Exposure）经 WithExposure 回调输出，供实验分析关联分组与结果；
+// Handler 为客户端提供一次评估全部开关的 HTTP 端点。
 package featureflag
 
 import (
 	"fmt"
 	"hash/fnv"
 	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/store/cache"
 )
 
 // Attributes 是用于定向匹配的标识属性（如 {"country":"CN","plan":"pro"}）。
 type Attributes map[string]any
 
-// Rule 是一条定向规则：When 全部命中时，强制结果为 Force。
+// Rule 是一条定向规则：When 与 Conditions 全部命中时，强制结果为 Force。
 type Rule struct {
-	When  map[string]any // 属性等值匹配，全部满足才算命中
-	Force bool           // 命中后强制开/关
+	When       map[string]any `mapstructure:"when" json:"when,omitempty" yaml:"when,omitempty"`                   // 属性等值匹配，全部满足才算命中
+	Conditions []Condition    `mapstructure:"conditions" json:"conditions,omitempty" yaml:"conditions,omitempty"` // 运算符条件，全部满足才算命中
+	Force      bool           `mapstructure:"force" json:"force" yaml:"force"`                                    // 命中后强制开/关
 }
 
 // Flag 是一个特性开关定义。
 type Flag struct {
-	Key     string
-	Enabled bool    // 总开关；false 时一律关闭（除非被 Rule 命中强制开）
-	Rollout float64 // 0~1 灰度比例，Enabled 且未命中规则时按此比例放量；0 表示用默认 1
-	Rules   []Rule  // 定向规则，按顺序首个命中生效
+	Key     string  `mapstructure:"key" json:"key" yaml:"key"`
+	Enabled bool    `mapstructure:"enabled" json:"enabled" yaml:"enabled"`               // 总开关；false 时一律关闭（除非被 Rule 命中强制开）
+	Rollout float64 `mapstructure:"rollout" json:"rollout" yaml:"rollout"`               // 0~1 灰度比例，Enabled 且未命中规则时按此比例放量；0 表示用默认 1
+	Rules   []Rule  `mapstructure:"rules" json:"rules,omitempty" yaml:"rules,omitempty"` // 定向规则，按顺序首个命中生效
+	// Prerequisites 是前置开关：同一标识下任一前置开关未开启时，本开关直接关闭（不看规则）。
+	Prerequisites []string `mapstructure:"prerequisites" json:"prerequisites,omitempty" yaml:"prerequisites,omitempty"`
+	// Schedule 非空时取代 Rollout，按时间计算灰度比例（见 RolloutStep）。
+	Schedule []RolloutStep `mapstructure:"schedule" json:"schedule,omitempty" yaml:"schedule,omitempty"`
+}
+
+// RolloutStep 是灰度计划上的一个节点：At 时刻灰度比例为 Rollout。
+// 相邻节点之间线性插值；首个节点之前为 0（未开始），最后一个节点之后保持其比例。
+// 由于分桶确定，比例只升不降时已放量的标识不会被收回。
+type RolloutStep struct {
+	At      time.Time `mapstructure:"at" json:"at" yaml:"at"`
+	Rollout float64   `mapstructure:"rollout" json:"rollout" yaml:"rollout"`
 }
 
 // Experiment 是一个 A/B(/n) 实验定义。
 type Experiment struct {
-	Key      string
-	Variants []string  // 变体名，如 ["control","treatment"]
-	Weights  []float64 // 各变体权重，缺省或非法时等分；和应约等于 1
-	Coverage float64   // 0~1 参与实验的比例，0 表示用默认 1
+	Key      string    `mapstructure:"key" json:"key" yaml:"key"`
+	Variants []string  `mapstructure:"variants" json:"variants" yaml:"variants"`                     // 变体名，如 ["control","treatment"]
+	Weights  []float64 `mapstructure:"weights" json:"weights,omitempty" yaml:"weights,omitempty"`    // 各变体权重，缺省或非法时等分；和应约等于 1
+	Coverage float64   `mapstructure:"coverage" json:"coverage,omitempty" yaml:"coverage,omitempty"` // 0~1 参与实验的比例，0 表示用默认 1
 }
 
-// Engine 持有开关与实验配置，提供线程安全的评估。
+// Reason 说明一次开关评估的依据。
+type Reason string
+
+const (
+	ReasonNotFound           Reason = "not_found"           // 开关不存在
+	ReasonPrerequisiteFailed Reason = "prerequisite_failed" // 前置开关未开启
+	ReasonRuleMatch          Reason = "rule_match"          // 定向规则命中
+	ReasonDisabled           Reason = "disabled"            // 总开关关闭
+	ReasonRollout            Reason = "rollout"             // 按灰度比例分桶
+)
+
+// Evaluation 是一次开关评估的结果。
+type Evaluation struct {
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+	Reason  Reason `json:"reason"`
+	Rule    int    `json:"rule"` // 命中的规则下标；未命中规则时为 -1
+}
+
+// Option 配置 Engine。
+type Option func(*Engine)
+
+// Engine 持有开关、分群与实验配置，提供线程安全的评估。
 type Engine struct {
-	mu    sync.RWMutex
-	flags map[string]Flag
-	exps  map[string]Experiment
+	mu       sync.RWMutex
+	flags    map[string]*compiledFlag
+	segments map[string]*compiledSegment
+	exps     map[string]Experiment
+
+	onExposure func(Exposure)
+	dedupSize  int
+	seenMu     sync.Mutex // 让“查重+记录”原子化
+	seen       *cache.LRU[string, struct{}]
+	now        func() time.Time
 }
 
 // New 创建一个空 Engine。
-func New() *Engine {
-	return &Engine{
-		flags: make(map[string]Flag),
-		exps:  make(map[string]Experiment),
+func New(opts ...Option) *Engine {
+	e := &Engine{
+		flags:     make(map[string]*compiledFlag),
+		segments:  make(map[string]*compiledSegment),
+		exps:      make(map[string]Experiment),
+		dedupSize: 10000,
+		now:       time.Now,
+	}
+	for _, o := range opts {
+		o(e)
 	}
+	if e.onExposure != nil && e.dedupSize > 0 {
+		e.seen = cache.NewLRU[string, struct{}](e.dedupSize)
+	}
+	return e
 }
 
-// SetFlag 注册/更新一个开关。
+// SetFlag 注册/更新一个开关。不做校验：Rollout 与灰度计划的比例截断到 [0,1]，
+// 条件非法（未知运算符、正则/版本号无法解析等）的规则记录告警并视为永不命中，
+// 前置开关成环时环上的开关评估为关闭。需要校验失败即报错时用 Replace / LoadConfig。
 func (e *Engine) SetFlag(f Flag) {
+	cf := looseFlag(f)
+	e.mu.Lock()
+	e.flags[f.Key] = cf
+	e.mu.Unlock()
+}
+
+// SetSegment 注册/更新一个分群。
+func (e *Engine) SetSegment(s Segment) error {
+	cs, err := compileSegment(s)
+	if err != nil {
+		return err
+	}
 	e.mu.Lock()
-	e.flags[f.Key] = f
+	e.segments[s.Key] = cs
 	e.mu.Unlock()
+	return nil
 }
 
 // SetExperiment 注册/更新一个实验。
@@ -64,40 +140,100 @@ func (e *Engine) SetExperiment(x Experiment) {
 }
 
 // IsEnabled 评估某标识 id 是否命中开关 key。attrs 可为 nil。
-// 评估顺序：定向规则（首个命中）→ 总开关 → 百分比灰度（按 id 稳定分桶）。
+// 评估顺序：前置开关 → 定向规则（首个命中）→ 总开关 → 百分比灰度（按 id 稳定分桶）。
 func (e *Engine) IsEnabled(key, id string, attrs Attributes) bool {
+	return e.Evaluate(key, id, attrs).Enabled
+}
+
+// Evaluate 与 IsEnabled 相同，但同时返回评估依据。开关存在时触发曝光回调。
+func (e *Engine) Evaluate(key, id string, attrs Attributes) Evaluation {
 	e.mu.RLock()
-	f, ok := e.flags[key]
+	ev := e.evaluate(key, id, attrs, 0)
 	e.mu.RUnlock()
-	if !ok {
-		return false
+	if ev.Reason != ReasonNotFound {
+		e.expose(Exposure{Kind: KindFlag, Key: key, ID: id, Enabled: ev.Enabled, Reason: ev.Reason})
 	}
-	for _, r := range f.Rules {
-		if matchRule(r.When, attrs) {
-			return r.Force
+	return ev
+}
+
+// maxPrerequisiteDepth 兜底 SetFlag 未校验时可能出现的前置开关环（Replace 在加载时已拒绝）。
+const maxPrerequisiteDepth = 16
+
+// evaluate 需持有读锁。
+func (e *Engine) evaluate(key, id string, attrs Attributes, depth int) Evaluation {
+	ev := Evaluation{Key: key, Rule: -1}
+	f, ok := e.flags[key]
+	if !ok || depth > maxPrerequisiteDepth {
+		ev.Reason = ReasonNotFound
+		return ev
+	}
+	for _, p := range f.Prerequisites {
+		if !e.evaluate(p, id, attrs, depth+1).Enabled {
+			ev.Reason = ReasonPrerequisiteFailed
+			return ev
+		}
+	}
+	for i, r := range f.rules {
+		if r.match(e, id, attrs) {
+			ev.Enabled, ev.Reason, ev.Rule = r.force, ReasonRuleMatch, i
+			return ev
 		}
 	}
 	if !f.Enabled {
-		return false
+		ev.Reason = ReasonDisabled
+		return ev
 	}
+	ev.Reason = ReasonRollout
 	rollout := f.Rollout
-	if rollout <= 0 {
+	if len(f.Schedule) > 0 {
+		rollout = scheduledRollout(f.Schedule, e.now())
+		if rollout <= 0 {
+			return ev
+		}
+	} else if rollout <= 0 {
 		rollout = 1
 	}
-	if rollout >= 1 {
-		return true
+	ev.Enabled = rollout >= 1 || bucket(key, id) < rollout
+	return ev
+}
+
+// scheduledRollout 计算 t 时刻的灰度比例；steps 已按时间升序。
+func scheduledRollout(steps []RolloutStep, t time.Time) float64 {
+	if t.Before(steps[0].At) {
+		return 0
+	}
+	for i := 1; i < len(steps); i++ {
+		a, b := steps[i-1], steps[i]
+		if t.Before(b.At) {
+			span := b.At.Sub(a.At)
+			if span <= 0 {
+				return a.Rollout
+			}
+			return a.Rollout + (b.Rollout-a.Rollout)*float64(t.Sub(a.At))/float64(span)
+		}
 	}
-	return bucket(key, id) < rollout
+	return steps[len(steps)-1].Rollout
 }
 
 // Variant 评估某标识 id 在实验 key 中的变体。
 // 返回 (变体名, true)；未参与实验（超出 coverage）或实验不存在时返回 ("", false)，
-// 调用方应回退到对照/默认行为。
+// 调用方应回退到对照/默认行为。纳入实验时触发曝光回调。
 func (e *Engine) Variant(key, id string) (string, bool) {
 	e.mu.RLock()
 	x, ok := e.exps[key]
 	e.mu.RUnlock()
-	if !ok || len(x.Variants) == 0 {
+	if !ok {
+		return "", false
+	}
+	v, ok := assignVariant(x, id)
+	if ok {
+		e.expose(Exposure{Kind: KindExperiment, Key: key, ID: id, Variant: v})
+	}
+	return v, ok
+}
+
+func assignVariant(x Experiment, id string) (string, bool) {
+	if len(x.Variants) == 0 {
 		return "", false
 	}
 	coverage := x.Coverage
@@ -105,7 +241,7 @@ func (e *Engine) Variant(key, id string) (string, bool) {
 		coverage = 1
 	}
 
-	n := bucket(key, id)
+	n := bucket(x.Key, id)
 	if n >= coverage {
 		return "", false // 未纳入实验
 	}
@@ -122,10 +258,7 @@ func (e *Engine) Variant(key, id string) (string, bool) {
 	return x.Variants[len(x.Variants)-1], true
 }
 
-func matchRule(when map[string]any, attrs Attributes) bool {
-	if len(when) == 0 {
-		return false
-	}
+func matchWhen(when map[string]any, attrs Attributes) bool {
 	for k, want := range when {
 		if fmt.Sprint(attrs[k]) != fmt.Sprint(want) {
 			return false
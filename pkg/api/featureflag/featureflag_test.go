@@ -18,6 +18,17 @@ func TestIsEnabled_MasterSwitch(t *testing.T) {
 	}
 }
 
+func TestSetFlag_ClampsRollout(t *testing.T) {
+	e := New()
+	e.SetFlag(Flag{Key: "f", Enabled: true, Rollout: 1.5}) // 截断为 1，不丢弃
+	if !e.IsEnabled("f", "u1", nil) {
+		t.Fatal("rollout above 1 must be clamped to full rollout")
+	}
+	if err := e.Replace(Document{Flags: []Flag{{Key: "f", Enabled: true, Rollout: 1.5}}}); err == nil {
+		t.Fatal("Replace must reject rollout out of [0,1]")
+	}
+}
+
 func TestIsEnabled_UnknownFlag(t *testing.T) {
 	if New().IsEnabled("nope", "u", nil) {
 		t.Fatal("unknown flag must be off")
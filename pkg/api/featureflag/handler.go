@@ -0,0 +1,111 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// EvaluateRequest 是 Handler 的请求体（POST）。GET 时 id 取自查询参数 id，
+// 其余查询参数作为字符串属性。
+type EvaluateRequest struct {
+	ID         string     `json:"id"`
+	Attributes Attributes `json:"attributes,omitempty"`
+}
+
+// EvaluateResponse 是 Handler 的响应：全部开关的结果，以及已纳入的实验变体。
+type EvaluateResponse struct {
+	Flags       map[string]Evaluation `json:"flags"`
+	Experiments map[string]string     `json:"experiments"`
+}
+
+// HandlerOption 配置 Handler。
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	identify func(*http.Request) (string, Attributes, bool)
+}
+
+// WithIdentity 让服务端决定评估标识：fn 返回 ok=true 时使用其 id（忽略客户端传入的 id，
+// 防止冒充他人拿到定向结果），其属性覆盖客户端同名属性。典型实现读取认证中间件放入
+// context 的用户。fn 返回 ok=false 时回退到请求中的 id。
+func WithIdentity(fn func(r *http.Request) (id string, attrs Attributes, ok bool)) HandlerOption {
+	return func(c *handlerConfig) { c.identify = fn }
+}
+
+// EvaluateAll 评估全部开关与实验。每个结果都以 Bulk=true 触发曝光回调。
+func (e *Engine) EvaluateAll(id string, attrs Attributes) EvaluateResponse {
+	resp := EvaluateResponse{Flags: make(map[string]Evaluation), Experiments: make(map[string]string)}
+	e.mu.RLock()
+	for key := range e.flags {
+		resp.Flags[key] = e.evaluate(key, id, attrs, 0)
+	}
+	exps := slices.Collect(maps.Values(e.exps))
+	e.mu.RUnlock()
+	for _, x := range exps {
+		if v, ok := assignVariant(x, id); ok {
+			resp.Experiments[x.Key] = v
+		}
+	}
+	for key, ev := range resp.Flags {
+		e.expose(Exposure{Kind: KindFlag, Key: key, ID: id, Enabled: ev.Enabled, Reason: ev.Reason, Bulk: true})
+	}
+	for key, v := range resp.Experiments {
+		e.expose(Exposure{Kind: KindExperiment, Key: key, ID: id, Variant: v, Bulk: true})
+	}
+	return resp
+}
+
+// Handler 返回为客户端（前端/移动端）一次评估全部开关的 HTTP 端点，支持 GET 与 POST：
+//
+//	GET  /flags?id=u-1&country=CN
+//	POST /flags  {"id":"u-1","attributes":{"country":"CN","app_version":"3.1.0"}}
+//
+// 响应为 EvaluateResponse 的 JSON。缺少标识时返回 400。
+func (e *Engine) Handler(opts ...HandlerOption) http.Handler {
+	var cfg handlerConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EvaluateRequest
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			req.ID = q.Get("id")
+			q.Del("id")
+			if len(q) > 0 {
+				req.Attributes = make(Attributes, len(q))
+				for k := range q {
+					req.Attributes[k] = q.Get(k)
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid evaluate request", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if cfg.identify != nil {
+			if id, attrs, ok := cfg.identify(r); ok {
+				req.ID = id
+				if req.Attributes == nil {
+					req.Attributes = make(Attributes, len(attrs))
+				}
+				maps.Copy(req.Attributes, attrs)
+			}
+		}
+		if req.ID == "" {
+			http.Error(w, "id required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(e.EvaluateAll(req.ID, req.Attributes))
+	})
+}
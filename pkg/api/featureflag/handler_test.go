@@ -0,0 +1,104 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type exposureLog struct {
+	mu  sync.Mutex
+	got []Exposure
+}
+
+func (l *exposureLog) add(x Exposure) { l.mu.Lock(); l.got = append(l.got, x); l.mu.Unlock() }
+
+func (l *exposureLog) len() int { l.mu.Lock(); defer l.mu.Unlock(); return len(l.got) }
+
+func TestExposure_Dedup(t *testing.T) {
+	var log exposureLog
+	e := New(WithExposure(log.add))
+	e.SetFlag(Flag{Key: "f", Rules: []Rule{{When: map[string]any{"plan": "pro"}, Force: true}}})
+	e.SetExperiment(Experiment{Key: "x", Variants: []string{"a", "b"}})
+
+	for range 5 {
+		e.IsEnabled("f", "u", nil)
+		e.Variant("x", "u")
+	}
+	e.IsEnabled("f", "u", Attributes{"plan": "pro"}) // 结果变了:新曝光
+	e.IsEnabled("nope", "u", nil)                    // 不存在的开关不曝光
+	if n := log.len(); n != 3 {
+		t.Fatalf("exposures=%d, want 3: %+v", n, log.got)
+	}
+	if x := log.got[0]; x.Kind != KindFlag || x.Enabled || x.Reason != ReasonDisabled || x.Time.IsZero() {
+		t.Fatalf("flag exposure=%+v", x)
+	}
+	if x := log.got[1]; x.Kind != KindExperiment || x.Variant == "" {
+		t.Fatalf("experiment exposure=%+v", x)
+	}
+
+	var all exposureLog
+	noDedup := New(WithExposure(all.add), WithExposureDedup(0))
+	noDedup.SetFlag(Flag{Key: "f", Enabled: true})
+	for range 3 {
+		noDedup.IsEnabled("f", "u", nil)
+	}
+	if all.len() != 3 {
+		t.Fatalf("dedup disabled: %d", all.len())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var log exposureLog
+	e := New(WithExposure(log.add))
+	e.SetFlag(Flag{Key: "pro-only", Rules: []Rule{{Conditions: []Condition{{Attr: "plan", Op: OpIn, Values: []any{"pro"}}}, Force: true}}})
+	e.SetFlag(Flag{Key: "everyone", Enabled: true})
+	e.SetExperiment(Experiment{Key: "x", Variants: []string{"a"}})
+	h := e.Handler(WithIdentity(func(r *http.Request) (string, Attributes, bool) {
+		if r.Header.Get("X-User") == "" {
+			return "", nil, false
+		}
+		return r.Header.Get("X-User"), Attributes{"plan": "free"}, true
+	}))
+
+	do := func(r *http.Request) (int, EvaluateResponse) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		var resp EvaluateResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := do(httptest.NewRequest(http.MethodGet, "/flags?id=u-1&plan=pro", nil))
+	if code != http.StatusOK || !resp.Flags["pro-only"].Enabled || !resp.Flags["everyone"].Enabled || resp.Experiments["x"] != "a" {
+		t.Fatalf("GET: %d %+v", code, resp)
+	}
+	if resp.Flags["pro-only"].Reason != ReasonRuleMatch || resp.Flags["pro-only"].Rule != 0 {
+		t.Fatalf("reason: %+v", resp.Flags["pro-only"])
+	}
+	if n := log.len(); n != 3 || !log.got[0].Bulk {
+		t.Fatalf("bulk exposures=%+v", log.got)
+	}
+	// 批量曝光不吞掉随后真正使用时的曝光。
+	e.IsEnabled("everyone", "u-1", nil)
+	if n := log.len(); n != 4 || log.got[3].Bulk {
+		t.Fatalf("use after bulk=%+v", log.got)
+	}
+
+	// 服务端身份优先:客户端自报的 id 与 plan 被覆盖。
+	r := httptest.NewRequest(http.MethodPost, "/flags", strings.NewReader(`{"id":"admin","attributes":{"plan":"pro"}}`))
+	r.Header.Set("X-User", "u-2")
+	if code, resp := do(r); code != http.StatusOK || resp.Flags["pro-only"].Enabled {
+		t.Fatalf("identity override: %d %+v", code, resp)
+	}
+
+	if code, _ := do(httptest.NewRequest(http.MethodGet, "/flags", nil)); code != http.StatusBadRequest {
+		t.Fatalf("missing id: %d", code)
+	}
+	if code, _ := do(httptest.NewRequest(http.MethodDelete, "/flags?id=u", nil)); code != http.StatusMethodNotAllowed {
+		t.Fatalf("method: %d", code)
+	}
+}
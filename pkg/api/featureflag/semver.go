@@ -0,0 +1,174 @@
+package featureflag
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver 是解析后的语义化版本；构建元数据（+xxx）不参与比较。
+type semver struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+type semverComparator struct {
+	op  string // = > >= < <=
+	ver semver
+}
+
+// parseSemver 解析 "1.2.3"、"v1.2"、"1.2.3-rc.1+build"；缺省的 minor/patch 视为 0。
+func parseSemver(s string) (semver, error) {
+	v, _, err := parsePartialSemver(s)
+	return v, err
+}
+
+// parsePartialSemver 额外返回实际给出的数字段数（1~3），供 ^ ~ 计算上界。
+func parsePartialSemver(s string) (semver, int, error) {
+	orig := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v semver
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		return semver{}, 0, fmt.Errorf("invalid version %q", orig)
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, 0, fmt.Errorf("invalid version %q", orig)
+		}
+		nums[i] = n
+	}
+	v.major, v.minor, v.patch = nums[0], nums[1], nums[2]
+	return v, len(parts), nil
+}
+
+// compareSemver 按 semver 2.0 规则比较：预发布版本低于对应正式版本，
+// 预发布标识逐段比较，纯数字段按数值且低于字母段。
+func compareSemver(a, b semver) int {
+	if c := cmp.Compare(a.major, b.major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.minor, b.minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.patch, b.patch); c != 0 {
+		return c
+	}
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		x, y := a.pre[i], b.pre[i]
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		var c int
+		switch {
+		case xerr == nil && yerr == nil:
+			c = cmp.Compare(xn, yn)
+		case xerr == nil:
+			c = -1
+		case yerr == nil:
+			c = 1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a.pre), len(b.pre))
+}
+
+// parseSemverRange 解析范围表达式：空格分隔的比较式取交集，"||" 分隔取并集。
+// 支持 = > >= < <=、裸版本（精确匹配）、^x.y.z（不变更最左非零段）与 ~x.y.z（不变更 minor）。
+func parseSemverRange(s string) ([][]semverComparator, error) {
+	var out [][]semverComparator
+	for _, alt := range strings.Split(s, "||") {
+		var and []semverComparator
+		for _, tok := range strings.Fields(alt) {
+			cs, err := parseComparator(tok)
+			if err != nil {
+				return nil, err
+			}
+			and = append(and, cs...)
+		}
+		if len(and) == 0 {
+			return nil, fmt.Errorf("empty version range in %q", s)
+		}
+		out = append(out, and)
+	}
+	return out, nil
+}
+
+func parseComparator(tok string) ([]semverComparator, error) {
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if !strings.HasPrefix(tok, op) {
+			continue
+		}
+		v, n, err := parsePartialSemver(tok[len(op):])
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "^":
+			upper := semver{major: v.major + 1}
+			if v.major == 0 && n >= 2 {
+				upper = semver{minor: v.minor + 1}
+				if v.minor == 0 && n == 3 {
+					upper = semver{minor: v.minor, patch: v.patch + 1}
+				}
+			}
+			return []semverComparator{{">=", v}, {"<", upper}}, nil
+		case "~":
+			upper := semver{major: v.major, minor: v.minor + 1}
+			if n == 1 {
+				upper = semver{major: v.major + 1}
+			}
+			return []semverComparator{{">=", v}, {"<", upper}}, nil
+		}
+		return []semverComparator{{op, v}}, nil
+	}
+	v, err := parseSemver(tok)
+	if err != nil {
+		return nil, err
+	}
+	return []semverComparator{{"=", v}}, nil
+}
+
+func satisfies(v semver, and []semverComparator) bool {
+	for _, c := range and {
+		r := compareSemver(v, c.ver)
+		ok := false
+		switch c.op {
+		case "=":
+			ok = r == 0
+		case ">":
+			ok = r > 0
+		case ">=":
+			ok = r >= 0
+		case "<":
+			ok = r < 0
+		case "<=":
+			ok = r <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
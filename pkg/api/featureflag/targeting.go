@@ -0,0 +1,363 @@
+package featureflag
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Op 是条件运算符。
+type Op string
+
+const (
+	OpIn           Op = "in"             // 属性等于 Values 中任一值（字符串形式比较）
+	OpNotIn        Op = "not_in"         // 属性不等于 Values 中任何值；属性缺失也算命中
+	OpGT           Op = "gt"             // 数值 >  Values[0]
+	OpGTE          Op = "gte"            // 数值 >= Values[0]
+	OpLT           Op = "lt"             // 数值 <  Values[0]
+	OpLTE          Op = "lte"            // 数值 <= Values[0]
+	OpSemver       Op = "semver"         // 版本号满足 Values 中任一范围，如 ">=1.2.0 <2.0.0"、"^1.4"、"~2.1.3"
+	OpMatches      Op = "matches"        // 正则匹配 Values 中任一表达式
+	OpInSegment    Op = "in_segment"     // 属于 Values 中任一分群
+	OpNotInSegment Op = "not_in_segment" // 不属于 Values 中任何分群
+)
+
+// Condition 是一条运算符条件。Attr 为属性名；分群运算符的 Attr 可为空，表示用评估标识 id。
+// 属性缺失时除 not_in / not_in_segment 外均不命中。
+//
+//	conditions:
+//	  - {attr: country, op: in, values: [CN, SG]}
+//	  - {attr: app_version, op: semver, values: [">=3.2.0"]}
+//	  - {op: in_segment, values: [beta-testers]}
+type Condition struct {
+	Attr   string `mapstructure:"attr" json:"attr,omitempty" yaml:"attr,omitempty"`
+	Op     Op     `mapstructure:"op" json:"op" yaml:"op"`
+	Values []any  `mapstructure:"values" json:"values" yaml:"values"`
+}
+
+// Segment 是可被多个开关复用的标识分群：Excluded 优先，其次 Included，
+// 再次 Conditions（非空且全部命中）。Conditions 中不能再引用分群。
+type Segment struct {
+	Key        string      `mapstructure:"key" json:"key" yaml:"key"`
+	Included   []string    `mapstructure:"included" json:"included,omitempty" yaml:"included,omitempty"`
+	Excluded   []string    `mapstructure:"excluded" json:"excluded,omitempty" yaml:"excluded,omitempty"`
+	Conditions []Condition `mapstructure:"conditions" json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+type compiledFlag struct {
+	Flag
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	when  map[string]any
+	force bool
+	conds []compiledCond
+}
+
+type compiledSegment struct {
+	included map[string]struct{}
+	excluded map[string]struct{}
+	conds    []compiledCond
+}
+
+type compiledCond struct {
+	Condition
+	strs   []string
+	num    float64
+	ranges [][]semverComparator // OR of AND
+	res    []*regexp.Regexp
+}
+
+func compileFlag(f Flag) (*compiledFlag, error) {
+	if f.Key == "" {
+		return nil, errors.New("featureflag: flag key is empty")
+	}
+	cf := &compiledFlag{Flag: f}
+	for i, r := range f.Rules {
+		conds, err := compileConds(r.Conditions, true)
+		if err != nil {
+			return nil, fmt.Errorf("featureflag: flag %q rule #%d: %w", f.Key, i, err)
+		}
+		cf.rules = append(cf.rules, compiledRule{when: r.When, force: r.Force, conds: conds})
+	}
+	if len(f.Schedule) > 0 {
+		cf.Schedule = slices.Clone(f.Schedule)
+		slices.SortStableFunc(cf.Schedule, func(a, b RolloutStep) int { return a.At.Compare(b.At) })
+		for _, s := range cf.Schedule {
+			if s.Rollout < 0 || s.Rollout > 1 {
+				return nil, fmt.Errorf("featureflag: flag %q: schedule rollout %v out of [0,1]", f.Key, s.Rollout)
+			}
+		}
+	}
+	if f.Rollout < 0 || f.Rollout > 1 {
+		return nil, fmt.Errorf("featureflag: flag %q: rollout %v out of [0,1]", f.Key, f.Rollout)
+	}
+	return cf, nil
+}
+
+// looseFlag 是 SetFlag 用的宽松编译：Rollout 与灰度计划的比例截断到 [0,1]，
+// 条件无法编译的规则记录告警后视为永不命中（保留下标，Evaluation.Rule 不错位）。
+func looseFlag(f Flag) *compiledFlag {
+	f.Rollout = clamp01(f.Rollout)
+	cf := &compiledFlag{Flag: f}
+	for i, r := range f.Rules {
+		conds, err := compileConds(r.Conditions, true)
+		if err != nil {
+			slog.Warn("featureflag: invalid rule never matches", "flag", f.Key, "rule", i, "err", err)
+			cf.rules = append(cf.rules, compiledRule{})
+			continue
+		}
+		cf.rules = append(cf.rules, compiledRule{when: r.When, force: r.Force, conds: conds})
+	}
+	if len(f.Schedule) > 0 {
+		cf.Schedule = slices.Clone(f.Schedule)
+		slices.SortStableFunc(cf.Schedule, func(a, b RolloutStep) int { return a.At.Compare(b.At) })
+		for i := range cf.Schedule {
+			cf.Schedule[i].Rollout = clamp01(cf.Schedule[i].Rollout)
+		}
+	}
+	return cf
+}
+
+func clamp01(v float64) float64 { return min(max(v, 0), 1) }
+
+func compileSegment(s Segment) (*compiledSegment, error) {
+	if s.Key == "" {
+		return nil, errors.New("featureflag: segment key is empty")
+	}
+	conds, err := compileConds(s.Conditions, false)
+	if err != nil {
+		return nil, fmt.Errorf("featureflag: segment %q: %w", s.Key, err)
+	}
+	cs := &compiledSegment{included: toSet(s.Included), excluded: toSet(s.Excluded), conds: conds}
+	return cs, nil
+}
+
+// checkPrerequisites 检查前置开关是否成环。引用尚未注册的开关是允许的（评估为关闭）。
+func checkPrerequisites(flags map[string]*compiledFlag) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(flags))
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		switch state[key] {
+		case visiting:
+			return fmt.Errorf("featureflag: prerequisite cycle: %s", strings.Join(append(path, key), " -> "))
+		case done:
+			return nil
+		}
+		f, ok := flags[key]
+		if !ok {
+			return nil
+		}
+		state[key] = visiting
+		for _, p := range f.Prerequisites {
+			if err := visit(p, append(path, key)); err != nil {
+				return err
+			}
+		}
+		state[key] = done
+		return nil
+	}
+	for key := range flags {
+		if err := visit(key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileConds(conds []Condition, allowSegments bool) ([]compiledCond, error) {
+	out := make([]compiledCond, 0, len(conds))
+	for _, c := range conds {
+		cc := compiledCond{Condition: c}
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("condition %s %q: no values", c.Op, c.Attr)
+		}
+		if c.Attr == "" && c.Op != OpInSegment && c.Op != OpNotInSegment {
+			return nil, fmt.Errorf("condition %s: attr is required", c.Op)
+		}
+		for _, v := range c.Values {
+			cc.strs = append(cc.strs, fmt.Sprint(v))
+		}
+		switch c.Op {
+		case OpIn, OpNotIn:
+		case OpGT, OpGTE, OpLT, OpLTE:
+			n, ok := toFloat(c.Values[0])
+			if !ok {
+				return nil, fmt.Errorf("condition %s %q: %v is not a number", c.Op, c.Attr, c.Values[0])
+			}
+			cc.num = n
+		case OpSemver:
+			for _, s := range cc.strs {
+				r, err := parseSemverRange(s)
+				if err != nil {
+					return nil, fmt.Errorf("condition %s %q: %w", c.Op, c.Attr, err)
+				}
+				cc.ranges = append(cc.ranges, r...)
+			}
+		case OpMatches:
+			for _, s := range cc.strs {
+				re, err := regexp.Compile(s)
+				if err != nil {
+					return nil, fmt.Errorf("condition %s %q: %w", c.Op, c.Attr, err)
+				}
+				cc.res = append(cc.res, re)
+			}
+		case OpInSegment, OpNotInSegment:
+			if !allowSegments {
+				return nil, fmt.Errorf("condition %s: segments cannot reference segments", c.Op)
+			}
+		default:
+			return nil, fmt.Errorf("condition %q: unknown operator %q", c.Attr, c.Op)
+		}
+		out = append(out, cc)
+	}
+	return out, nil
+}
+
+// match 需持有读锁（分群查找）。规则至少要有一个条件才可能命中。
+func (r compiledRule) match(e *Engine, id string, attrs Attributes) bool {
+	if len(r.when) == 0 && len(r.conds) == 0 {
+		return false
+	}
+	if !matchWhen(r.when, attrs) {
+		return false
+	}
+	for _, c := range r.conds {
+		if !c.match(e, id, attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *compiledSegment) contains(e *Engine, id string, attrs Attributes) bool {
+	if _, ok := s.excluded[id]; ok {
+		return false
+	}
+	if _, ok := s.included[id]; ok {
+		return true
+	}
+	if len(s.conds) == 0 {
+		return false
+	}
+	for _, c := range s.conds {
+		if !c.match(e, id, attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c compiledCond) match(e *Engine, id string, attrs Attributes) bool {
+	if c.Op == OpInSegment || c.Op == OpNotInSegment {
+		subject := id
+		if c.Attr != "" {
+			v, ok := attrs[c.Attr]
+			if !ok {
+				return c.Op == OpNotInSegment
+			}
+			subject = fmt.Sprint(v)
+		}
+		in := false
+		for _, key := range c.strs {
+			if s, ok := e.segments[key]; ok && s.contains(e, subject, attrs) {
+				in = true
+				break
+			}
+		}
+		return in == (c.Op == OpInSegment)
+	}
+
+	v, ok := attrs[c.Attr]
+	if !ok || v == nil {
+		return c.Op == OpNotIn
+	}
+	switch c.Op {
+	case OpIn, OpNotIn:
+		return slices.Contains(c.strs, fmt.Sprint(v)) == (c.Op == OpIn)
+	case OpGT, OpGTE, OpLT, OpLTE:
+		n, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		switch c.Op {
+		case OpGT:
+			return n > c.num
+		case OpGTE:
+			return n >= c.num
+		case OpLT:
+			return n < c.num
+		default:
+			return n <= c.num
+		}
+	case OpSemver:
+		ver, err := parseSemver(fmt.Sprint(v))
+		if err != nil {
+			return false
+		}
+		for _, and := range c.ranges {
+			if satisfies(ver, and) {
+				return true
+			}
+		}
+		return false
+	case OpMatches:
+		s := fmt.Sprint(v)
+		for _, re := range c.res {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toSet(ss []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		m[s] = struct{}{}
+	}
+	return m
+}
@@ -0,0 +1,178 @@
+package featureflag
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditions_Operators(t *testing.T) {
+	cases := []struct {
+		name  string
+		cond  Condition
+		attrs Attributes
+		want  bool
+	}{
+		{"in hit", Condition{Attr: "country", Op: OpIn, Values: []any{"CN", "SG"}}, Attributes{"country": "SG"}, true},
+		{"in miss", Condition{Attr: "country", Op: OpIn, Values: []any{"CN", "SG"}}, Attributes{"country": "US"}, false},
+		{"in missing attr", Condition{Attr: "country", Op: OpIn, Values: []any{"CN"}}, nil, false},
+		{"not_in hit", Condition{Attr: "plan", Op: OpNotIn, Values: []any{"free"}}, Attributes{"plan": "pro"}, true},
+		{"not_in missing attr", Condition{Attr: "plan", Op: OpNotIn, Values: []any{"free"}}, nil, true},
+		{"gt int", Condition{Attr: "age", Op: OpGT, Values: []any{18}}, Attributes{"age": 21}, true},
+		{"gte boundary", Condition{Attr: "age", Op: OpGTE, Values: []any{18}}, Attributes{"age": int64(18)}, true},
+		{"lt string number", Condition{Attr: "score", Op: OpLT, Values: []any{"9.5"}}, Attributes{"score": "9.25"}, true},
+		{"lte non-number", Condition{Attr: "score", Op: OpLTE, Values: []any{10}}, Attributes{"score": "n/a"}, false},
+		{"semver range", Condition{Attr: "v", Op: OpSemver, Values: []any{">=1.2.0 <2.0.0"}}, Attributes{"v": "v1.10.3"}, true},
+		{"semver caret", Condition{Attr: "v", Op: OpSemver, Values: []any{"^1.4"}}, Attributes{"v": "2.0.0"}, false},
+		{"semver tilde", Condition{Attr: "v", Op: OpSemver, Values: []any{"~2.1.3"}}, Attributes{"v": "2.1.9"}, true},
+		{"semver or", Condition{Attr: "v", Op: OpSemver, Values: []any{"<1.0.0 || >=3.0.0"}}, Attributes{"v": "3.0.0"}, true},
+		{"semver prerelease", Condition{Attr: "v", Op: OpSemver, Values: []any{">=3.0.0"}}, Attributes{"v": "3.0.0-rc.1"}, false},
+		{"semver invalid attr", Condition{Attr: "v", Op: OpSemver, Values: []any{">=1.0.0"}}, Attributes{"v": "latest"}, false},
+		{"regex", Condition{Attr: "email", Op: OpMatches, Values: []any{`@example\.com$`}}, Attributes{"email": "a@example.com"}, true},
+		{"regex miss", Condition{Attr: "email", Op: OpMatches, Values: []any{`@example\.com$`}}, Attributes{"email": "a@example.org"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := New()
+			e.SetFlag(Flag{Key: "f", Rules: []Rule{{Conditions: []Condition{tc.cond}, Force: true}}})
+			if got := e.IsEnabled("f", "u", tc.attrs); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditions_CompileErrors(t *testing.T) {
+	bad := []Condition{
+		{Attr: "x", Op: "like", Values: []any{"a"}},
+		{Attr: "x", Op: OpGT, Values: []any{"ten"}},
+		{Attr: "x", Op: OpSemver, Values: []any{">=1.x"}},
+		{Attr: "x", Op: OpMatches, Values: []any{"("}},
+		{Attr: "x", Op: OpIn},
+		{Op: OpIn, Values: []any{"a"}},
+	}
+	e := New()
+	e.SetFlag(Flag{Key: "f", Enabled: true})
+	for _, c := range bad {
+		if err := e.Replace(Document{Flags: []Flag{{Key: "f", Rules: []Rule{{Conditions: []Condition{c}}}}}}); err == nil {
+			t.Errorf("%+v: want compile error", c)
+		}
+	}
+	if !e.IsEnabled("f", "u", nil) {
+		t.Fatal("invalid update must keep the previous flag")
+	}
+	// SetFlag 不校验：非法规则永不命中，开关本身照常保存。
+	e.SetFlag(Flag{Key: "g", Enabled: true, Rules: []Rule{{Conditions: []Condition{bad[3]}}, {Force: false, When: map[string]any{"plan": "free"}}}})
+	if ev := e.Evaluate("g", "u", Attributes{"x": "("}); !ev.Enabled || ev.Reason != ReasonRollout {
+		t.Fatalf("invalid rule must never match: %+v", ev)
+	}
+	if ev := e.Evaluate("g", "u", Attributes{"plan": "free"}); ev.Enabled || ev.Rule != 1 {
+		t.Fatalf("rule index must stay aligned: %+v", ev)
+	}
+	if err := e.SetSegment(Segment{Key: "s", Conditions: []Condition{{Op: OpInSegment, Values: []any{"t"}}}}); err == nil {
+		t.Fatal("segment referencing a segment must be rejected")
+	}
+}
+
+func TestSegments(t *testing.T) {
+	e := New()
+	_ = e.SetSegment(Segment{
+		Key:        "staff",
+		Included:   []string{"contractor-1"},
+		Excluded:   []string{"intern-9"},
+		Conditions: []Condition{{Attr: "email", Op: OpMatches, Values: []any{`@corp\.com$`}}},
+	})
+	e.SetFlag(Flag{Key: "f", Rules: []Rule{{Conditions: []Condition{{Op: OpInSegment, Values: []any{"staff"}}}, Force: true}}})
+	corp := Attributes{"email": "x@corp.com"}
+	for id, want := range map[string]bool{"contractor-1": true, "intern-9": false, "u-1": true} {
+		attrs := corp
+		if id == "contractor-1" {
+			attrs = nil
+		}
+		if got := e.IsEnabled("f", id, attrs); got != want {
+			t.Errorf("%s: got %v, want %v", id, got, want)
+		}
+	}
+	if e.IsEnabled("f", "u-2", Attributes{"email": "x@gmail.com"}) {
+		t.Fatal("outsider matched segment")
+	}
+	// 未注册的分群视为不属于。
+	e.SetFlag(Flag{Key: "g", Rules: []Rule{{Conditions: []Condition{{Op: OpNotInSegment, Values: []any{"ghost"}}}, Force: true}}})
+	if !e.IsEnabled("g", "u", nil) {
+		t.Fatal("not_in_segment of unknown segment should match")
+	}
+}
+
+func TestPrerequisites(t *testing.T) {
+	e := New()
+	e.SetFlag(Flag{Key: "payments-v2", Rules: []Rule{{When: map[string]any{"region": "eu"}, Force: true}}})
+	e.SetFlag(Flag{Key: "checkout", Enabled: true, Prerequisites: []string{"payments-v2"}})
+
+	if ev := e.Evaluate("checkout", "u", Attributes{"region": "us"}); ev.Enabled || ev.Reason != ReasonPrerequisiteFailed {
+		t.Fatalf("us: %+v", ev)
+	}
+	if ev := e.Evaluate("checkout", "u", Attributes{"region": "eu"}); !ev.Enabled || ev.Reason != ReasonRollout {
+		t.Fatalf("eu: %+v", ev)
+	}
+	err := e.Replace(Document{Flags: []Flag{
+		{Key: "payments-v2", Prerequisites: []string{"checkout"}},
+		{Key: "checkout", Enabled: true, Prerequisites: []string{"payments-v2"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("cycle not rejected: %v", err)
+	}
+	if !e.IsEnabled("checkout", "u", Attributes{"region": "eu"}) {
+		t.Fatal("rejected update must not change flags")
+	}
+	// SetFlag 不校验：成环的开关评估为关闭而不是死循环。
+	e.SetFlag(Flag{Key: "payments-v2", Enabled: true, Prerequisites: []string{"checkout"}})
+	if e.IsEnabled("checkout", "u", Attributes{"region": "eu"}) {
+		t.Fatal("flags on a prerequisite cycle must evaluate to off")
+	}
+}
+
+func TestSchedule_Ramp(t *testing.T) {
+	start := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(-time.Hour)
+	e := New()
+	e.now = func() time.Time { return now }
+	e.SetFlag(Flag{Key: "f", Enabled: true, Schedule: []RolloutStep{
+		{At: start.Add(48 * time.Hour), Rollout: 1}, // 乱序也应按时间排序
+		{At: start, Rollout: 0},
+	}})
+	ratio := func() float64 {
+		on := 0
+		for i := range 4000 {
+			if e.IsEnabled("f", "u-"+strconv.Itoa(i), nil) {
+				on++
+			}
+		}
+		return float64(on) / 4000
+	}
+	if r := ratio(); r != 0 {
+		t.Fatalf("before schedule: %.3f", r)
+	}
+	now = start.Add(12 * time.Hour)
+	if r := ratio(); r < 0.2 || r > 0.3 {
+		t.Fatalf("quarter way: %.3f", r)
+	}
+	now = start.Add(72 * time.Hour)
+	if r := ratio(); r != 1 {
+		t.Fatalf("after schedule: %.3f", r)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1", "2.0.0+build.5"}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := parseSemver(ordered[i-1])
+		b, err := parseSemver(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compareSemver(a, b) >= 0 {
+			t.Errorf("%s should sort before %s", ordered[i-1], ordered[i])
+		}
+	}
+}
@@ -11,6 +11,8 @@
 //   - WithAfterwork:挂上 afterwork.Middleware,handler 里 afterwork.Defer(...)
 //     投递的响应后副作用在响应返回后跑完;
 //   - WithRatelimit:声明式限流;
+//   - WithCriticality / WithOverloadControl:声明路由的请求优先级,过载时按优先级卸载;
+//   - WithValidator:解析 body 后按 pkg/api/validate 校验,全部违规合并为一个 400;
 //   - WithMiddleware:挂任意标准中间件(func(http.Handler) http.Handler)于最外层——
 //     核心不依赖 contrib,故可即插即用如 contrib/wasm 的过滤器等;
 //   - 返回的 error 自动经 errors.WriteHTTP 归一化为统一错误响应。
@@ -51,6 +53,8 @@ import (
 
 	"github.com/rushteam/beauty/pkg/api/afterwork"
 	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/api/validate"
+	"github.com/rushteam/beauty/pkg/governance/overloadctrl"
 	"github.com/rushteam/beauty/pkg/middleware/auth"
 	"github.com/rushteam/beauty/pkg/resilience/ratelimit"
 )
@@ -79,6 +83,10 @@ type Handler[I any, O any] struct {
 	rlLimiter ratelimit.Limiter
 	rlKeyFn   ratelimit.KeyFunc
 	mws       []func(http.Handler) http.Handler
+	validator validate.Validator
+	crit      *overloadctrl.Criticality
+	critOpts  []overloadctrl.ServerOption
+	overload  overloadctrl.OverloadController
 }
 
 // Option 配置 Handler。
@@ -93,6 +101,10 @@ type config struct {
 	rlLimiter ratelimit.Limiter
 	rlKeyFn   ratelimit.KeyFunc
 	mws       []func(http.Handler) http.Handler
+	validator validate.Validator
+	crit      *overloadctrl.Criticality
+	critOpts  []overloadctrl.ServerOption
+	overload  overloadctrl.OverloadController
 }
 
 // WithMethod 设置允许的 HTTP 方法(如 "POST")。空表示不限。
@@ -126,6 +138,32 @@ func WithRatelimit(l ratelimit.Limiter, keyFn ratelimit.KeyFunc) Option {
 	return func(c *config) { c.rlLimiter = l; c.rlKeyFn = keyFn }
 }
 
+// WithCriticality 声明路由的请求优先级,写入 ctx 的 api/metadata 并随下游调用透传。
+// 路由声明优先于请求自带的 X-Criticality;只有 opts 传 overloadctrl.WithTrustedHTTPUpstream
+// 认可的上游,其透传的优先级才生效。
+//
+//	handler.New("POST", checkout, handler.WithCriticality(overloadctrl.CriticalityCritical))
+//	handler.New("GET", recommend, handler.WithCriticality(overloadctrl.CriticalitySheddable))
+func WithCriticality(c overloadctrl.Criticality, opts ...overloadctrl.ServerOption) Option {
+	return func(cfg *config) { cfg.crit, cfg.critOpts = &c, opts }
+}
+
+// WithOverloadControl 按请求优先级做过载保护(见 overloadctrl.HTTPMiddleware):过载时低优先级先被拒,
+// 返回 503 + Retry-After。多个路由传同一个 controller 即共享负载画像。在限流之前执行。
+func WithOverloadControl(c overloadctrl.OverloadController) Option {
+	return func(cfg *config) { cfg.overload = c }
+}
+
+// WithValidator 在解析 body 之后、调业务函数之前校验请求体(无 body 时校验零值请求)。
+// 不通过时返回 400,响应 details 列出全部 FieldViolation;业务函数不会被调用。
+//
+//	type CreateOrderReq struct {
+//	    Sku string `json:"sku" validate:"required,max=32"`
+//	    Qty int    `json:"qty" validate:"gte=1,lte=99"`
+//	}
+//	handler.New("POST", createOrder, handler.WithValidator(validate.New()))
+func WithValidator(v validate.Validator) Option { return func(c *config) { c.validator = v } }
+
 // WithMiddleware 附加任意标准 HTTP 中间件(func(http.Handler) http.Handler),挂在包装链的
 // **最外层**——先于 ratelimit/afterwork/auth 执行,可提前短路(拒绝/改写)。多次传入或一次传多个时,
 // **靠前的在更外层**(WithMiddleware(a, b) 中 a 包住 b 包住其余)。
@@ -136,6 +174,10 @@ func WithRatelimit(l ratelimit.Limiter, keyFn ratelimit.KeyFunc) Option {
 //	    handler.WithMiddleware(wasm.Middleware(mod)), // wasm 沙箱过滤器
 //	    handler.WithRatelimit(lim, keyFn),
 //	)
+//
+// 面向浏览器的路由同理按路由挂 pkg/middleware/secheaders 与 pkg/middleware/csrf:
+//
+//	handler.WithMiddleware(secheaders.Middleware(secheaders.WithCSP(csp)), csrf.Middleware(csrf.WithSecret(key)))
 func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
 	return func(c *config) { c.mws = append(c.mws, mw...) }
 }
@@ -157,12 +199,17 @@ func New[I any, O any](method string, fn Func[I, O], opts ...Option) *Handler[I,
 		rlLimiter: cfg.rlLimiter,
 		rlKeyFn:   cfg.rlKeyFn,
 		mws:       cfg.mws,
+		validator: cfg.validator,
+		crit:      cfg.crit,
+		critOpts:  cfg.critOpts,
+		overload:  cfg.overload,
 	}
 }
 
 // ServeHTTP 实现 http.Handler。
-// 包装顺序(由外到内):WithMiddleware(用户中间件)→ ratelimit → afterwork → handle(auth+inject+body+fn)。
-// 用户中间件最外层(可提前短路);限流次之(超限不解析 body);afterwork 再次(响应后副作用跑完才放行)。
+// 包装顺序(由外到内):WithMiddleware(用户中间件)→ 优先级 → 过载保护 → ratelimit → afterwork →
+// handle(auth+inject+body+fn)。用户中间件最外层(可提前短路);过载卸载与限流次之(被拒不解析 body);
+// afterwork 再次(响应后副作用跑完才放行)。
 func (h *Handler[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var handler http.Handler = http.HandlerFunc(h.handle)
 	if h.afterMW {
@@ -171,6 +218,12 @@ func (h *Handler[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.rlLimiter != nil && h.rlKeyFn != nil {
 		handler = ratelimit.Middleware(h.rlLimiter, h.rlKeyFn)(handler)
 	}
+	if h.overload != nil {
+		handler = overloadctrl.HTTPMiddleware(h.overload)(handler)
+	}
+	if h.crit != nil {
+		handler = overloadctrl.CriticalityMiddleware(*h.crit, h.critOpts...)(handler)
+	}
 	// 用户中间件挂最外层;倒序应用使靠前者在更外层。
 	for i := len(h.mws) - 1; i >= 0; i-- {
 		handler = h.mws[i](handler)
@@ -178,10 +231,10 @@ func (h *Handler[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.ServeHTTP(w, r)
 }
 
-// handle 是纯处理函数:方法校验 → 依赖注入 → 认证 → 解析 body → 调业务函数 → 归一化错误。
+// handle 是纯处理函数:方法校验 → 依赖注入 → 认证 → 解析 body → 校验 → 调业务函数 → 归一化错误。
 func (h *Handler[I, O]) handle(w http.ResponseWriter, r *http.Request) {
 	if h.method != "" && r.Method != h.method {
-		writeErr(w, perr.New(perr.CodeUnimplemented, "method not allowed: "+r.Method))
+		writeErr(w, r, perr.New(perr.CodeUnimplemented, "method not allowed: "+r.Method))
 		return
 	}
 	ctx := r.Context()
@@ -191,7 +244,7 @@ func (h *Handler[I, O]) handle(w http.ResponseWriter, r *http.Request) {
 	if h.auth != nil {
 		user, err := h.auth(ctx, r)
 		if err != nil {
-			writeErr(w, err)
+			writeErr(w, r, err)
 			return
 		}
 		if user != nil {
@@ -201,13 +254,19 @@ func (h *Handler[I, O]) handle(w http.ResponseWriter, r *http.Request) {
 	var req I
 	if hasBody(r) {
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErr(w, perr.New(perr.CodeInvalidArgument, "invalid request body: "+err.Error()))
+			writeErr(w, r, perr.New(perr.CodeInvalidArgument, "invalid request body: "+err.Error()))
+			return
+		}
+	}
+	if h.validator != nil {
+		if err := h.validator.Validate(ctx, &req); err != nil {
+			writeErr(w, r, err)
 			return
 		}
 	}
 	resp, err := h.fn(ctx, &req)
 	if err != nil {
-		writeErr(w, err)
+		writeErr(w, r, err)
 		return
 	}
 	if resp == nil {
@@ -238,13 +297,13 @@ func MustGet[T any](ctx context.Context, name string) T {
 }
 
 // writeErr 把任意 error 归一化为 *Status 并写入 HTTP 响应。
-// 已是 *Status 则原样用;普通 error 兜底 CodeInternal(500)。
-func writeErr(w http.ResponseWriter, err error) {
+// 已是 *Status 则原样用;普通 error 兜底 CodeInternal(500)。文案按请求的 Accept-Language 本地化。
+func writeErr(w http.ResponseWriter, r *http.Request, err error) {
 	st, ok := perr.FromError(err)
 	if !ok {
 		st = perr.New(perr.CodeInternal, err.Error())
 	}
-	perr.WriteHTTP(w, st)
+	perr.WriteHTTPContext(perr.WithRequestLocales(r), w, st)
 }
 
 // hasBody 判断请求是否带 body(POST/PUT/PATCH 通常带)。
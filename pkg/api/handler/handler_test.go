@@ -14,6 +14,8 @@ import (
 	"github.com/rushteam/beauty/pkg/api/afterwork"
 	perr "github.com/rushteam/beauty/pkg/api/errors"
 	"github.com/rushteam/beauty/pkg/api/handler"
+	"github.com/rushteam/beauty/pkg/api/validate"
+	"github.com/rushteam/beauty/pkg/governance/overloadctrl"
 	"github.com/rushteam/beauty/pkg/middleware/auth"
 	"github.com/rushteam/beauty/pkg/resilience/ratelimit"
 )
@@ -309,3 +311,77 @@ func TestHandler_WithMiddleware_OutermostBeforeRatelimit(t *testing.T) {
 		t.Fatalf("外层中间件应在限流之外、两次都执行, seq=%v", seq)
 	}
 }
+
+type signupReq struct {
+	Email string `json:"email" validate:"required,email"`
+	Age   int    `json:"age" validate:"gte=18"`
+}
+
+func TestHandler_Validator_AggregatesViolations(t *testing.T) {
+	var called atomic.Bool
+	h := handler.New("POST", func(ctx context.Context, req *signupReq) (*echoResp, error) {
+		called.Store(true)
+		return &echoResp{}, nil
+	}, handler.WithValidator(validate.New()))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"nope","age":12}`)))
+	if rec.Code != http.StatusBadRequest || called.Load() {
+		t.Fatalf("code=%d called=%v", rec.Code, called.Load())
+	}
+	var body struct {
+		Details []struct {
+			Type string
+			Data perr.FieldViolation
+		}
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&body)
+	if len(body.Details) != 2 || body.Details[0].Data.Field != "email" || body.Details[1].Data.Field != "age" {
+		t.Fatalf("details=%+v", body.Details)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"a@b.co","age":30}`)))
+	if rec.Code != http.StatusOK || !called.Load() {
+		t.Fatalf("valid request: code=%d", rec.Code)
+	}
+}
+
+func TestHandler_CriticalityAndOverloadControl(t *testing.T) {
+	ctrl := overloadctrl.NewAdaptiveController(overloadctrl.WithMaxInflight(1), overloadctrl.WithCriticalReserve(1))
+	var seen overloadctrl.Criticality
+	fn := func(ctx context.Context, req *echoReq) (*echoResp, error) {
+		seen = overloadctrl.CriticalityFromContext(ctx)
+		return &echoResp{}, nil
+	}
+	critical := handler.New("GET", fn, handler.WithCriticality(overloadctrl.CriticalityCritical), handler.WithOverloadControl(ctrl))
+	sheddable := handler.New("GET", fn, handler.WithCriticality(overloadctrl.CriticalitySheddable), handler.WithOverloadControl(ctrl))
+
+	rec := httptest.NewRecorder()
+	critical.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || seen != overloadctrl.CriticalityCritical {
+		t.Fatalf("critical: status=%d criticality=%v", rec.Code, seen)
+	}
+	// 预留比例 1:非 Critical 路由全部被卸载
+	rec = httptest.NewRecorder()
+	sheddable.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("sheddable: status=%d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// 客户端自带的 X-Criticality 不能越过路由声明
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(overloadctrl.HeaderCriticality, "critical")
+	rec = httptest.NewRecorder()
+	sheddable.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("untrusted header: status=%d", rec.Code)
+	}
+	// 可信上游透传的优先级优先于路由声明
+	trusted := overloadctrl.WithTrustedHTTPUpstream(func(*http.Request) bool { return true })
+	internal := handler.New("GET", fn, handler.WithCriticality(overloadctrl.CriticalitySheddable, trusted), handler.WithOverloadControl(ctrl))
+	rec = httptest.NewRecorder()
+	internal.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || seen != overloadctrl.CriticalityCritical {
+		t.Fatalf("propagated: status=%d criticality=%v", rec.Code, seen)
+	}
+}
@@ -0,0 +1,52 @@
+package validate
+
+import (
+	"context"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor 在调用 handler 前校验请求消息;不通过时返回 InvalidArgument,
+// 全部违规以 google.rpc.BadRequest 详情附带(见 errors.ToGRPC),handler 不会被调用。
+// 校验器自身故障返回 Internal。
+func UnaryServerInterceptor(v Validator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := v.Validate(ctx, req); err != nil {
+			return nil, toGRPC(ctx, err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 校验客户端流上收到的每条消息;不通过时 RecvMsg 返回
+// InvalidArgument 错误,由 handler 按常规接收错误处理(通常直接返回以结束流)。
+func StreamServerInterceptor(v Validator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss, v: v})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+	v Validator
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := s.v.Validate(s.Context(), m); err != nil {
+		return toGRPC(s.Context(), err)
+	}
+	return nil
+}
+
+func toGRPC(ctx context.Context, err error) error {
+	if st, ok := perr.FromError(err); ok {
+		return perr.ToGRPCContext(ctx, st)
+	}
+	return status.Error(codes.Internal, "validate: "+err.Error())
+}
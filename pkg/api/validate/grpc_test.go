@@ -0,0 +1,64 @@
+package validate_test
+
+import (
+	"context"
+	"testing"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/api/validate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type createReq struct {
+	Name string `validate:"required"`
+	Qty  int    `validate:"gte=1"`
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	icpt := validate.UnaryServerInterceptor(validate.New())
+	called := false
+	handler := func(context.Context, any) (any, error) { called = true; return "ok", nil }
+
+	_, err := icpt(context.Background(), &createReq{}, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.InvalidArgument || called {
+		t.Fatalf("err=%v called=%v", err, called)
+	}
+	st, _ := perr.FromGRPCError(err)
+	if n := len(st.Details()); n != 2 {
+		t.Fatalf("field violations over the wire: %d", n)
+	}
+
+	if resp, err := icpt(context.Background(), &createReq{Name: "a", Qty: 1}, &grpc.UnaryServerInfo{}, handler); err != nil || resp != "ok" {
+		t.Fatalf("valid: resp=%v err=%v", resp, err)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	msgs []createReq
+}
+
+func (s *fakeStream) Context() context.Context { return context.Background() }
+
+func (s *fakeStream) RecvMsg(m any) error {
+	*m.(*createReq) = s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	icpt := validate.StreamServerInterceptor(validate.New())
+	ss := &fakeStream{msgs: []createReq{{Name: "a", Qty: 1}, {Name: "b"}}}
+	err := icpt(nil, ss, &grpc.StreamServerInfo{}, func(_ any, stream grpc.ServerStream) error {
+		var m createReq
+		if err := stream.RecvMsg(&m); err != nil {
+			t.Fatalf("first message: %v", err)
+		}
+		return stream.RecvMsg(&m)
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("second message should fail validation: %v", err)
+	}
+}
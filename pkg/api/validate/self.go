@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"context"
+	"errors"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+)
+
+// 消息自校验约定,兼容 protoc-gen-validate 的生成代码:ValidateAll 返回全部违规,
+// Validate 遇到第一个违规即返回。
+type (
+	allValidator interface{ ValidateAll() error }
+	oneValidator interface{ Validate() error }
+	ctxValidator interface {
+		Validate(ctx context.Context) error
+	}
+)
+
+// fieldError 是 protoc-gen-validate 生成的 XxxValidationError 的形状;
+// Cause() 可能是嵌套消息的同类错误。
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+type multiError interface{ AllErrors() []error }
+
+func selfValidate(ctx context.Context, v any) error {
+	var err error
+	switch m := v.(type) {
+	case allValidator:
+		err = m.ValidateAll()
+	case ctxValidator:
+		err = m.Validate(ctx)
+	case oneValidator:
+		err = m.Validate()
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	var vs Violations
+	collect(&vs, "", err)
+	return vs.Err()
+}
+
+// collect 把自校验错误展开为逐字段违规:*errors.Status 取其 FieldViolation,
+// protoc-gen-validate 的多错误/嵌套错误按路径展开,其它错误记为一条无字段违规。
+func collect(vs *Violations, prefix string, err error) {
+	if st, ok := err.(*perr.Status); ok {
+		for _, fv := range FromStatus(st) {
+			vs.Add(joinPath(prefix, fv.Field), fv.Description)
+		}
+		return
+	}
+	if m, ok := err.(multiError); ok {
+		for _, e := range m.AllErrors() {
+			collect(vs, prefix, e)
+		}
+		return
+	}
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range j.Unwrap() {
+			collect(vs, prefix, e)
+		}
+		return
+	}
+	if fe, ok := err.(fieldError); ok {
+		path := joinPath(prefix, fe.Field())
+		// 嵌套消息:Reason 形如 "embedded message failed validation",真正原因在 Cause 里。
+		if c, ok := err.(interface{ Cause() error }); ok && isStructured(c.Cause()) {
+			collect(vs, path, c.Cause())
+			return
+		}
+		vs.Add(path, fe.Reason())
+		return
+	}
+	var st *perr.Status
+	if errors.As(err, &st) {
+		collect(vs, prefix, st)
+		return
+	}
+	vs.Add(prefix, err.Error())
+}
+
+func isStructured(err error) bool {
+	switch err.(type) {
+	case fieldError, multiError, *perr.Status:
+		return true
+	}
+	return false
+}
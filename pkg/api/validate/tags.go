@@ -0,0 +1,415 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RuleFunc 是一条校验规则:v 为已解引用的字段值,param 为 tag 中 "=" 后的参数(可为空)。
+// 通过返回空串,否则返回违规描述(如 "must be a valid SKU")。
+type RuleFunc func(v reflect.Value, param string) string
+
+type tagValidator struct {
+	cfg   *config
+	rules map[string]RuleFunc
+	cache sync.Map // reflect.Type → *typeInfo
+}
+
+type typeInfo struct {
+	fields []fieldInfo
+	err    error
+}
+
+type fieldInfo struct {
+	index     []int
+	name      string
+	rules     ruleSet
+	elemRules *ruleSet // dive 之后的规则
+}
+
+type ruleSet struct {
+	omitempty bool
+	required  bool
+	rules     []boundRule
+}
+
+type boundRule struct {
+	name, param string
+	fn          RuleFunc
+}
+
+// maxDepth 防止自引用结构体(如链表/树)无限递归。
+const maxDepth = 32
+
+func newTagValidator(c *config) *tagValidator {
+	rules := make(map[string]RuleFunc, len(builtinRules)+len(c.rules))
+	for k, v := range builtinRules {
+		rules[k] = v
+	}
+	for k, v := range c.rules {
+		rules[k] = v
+	}
+	return &tagValidator{cfg: c, rules: rules}
+}
+
+// Validate 实现 Validator。
+func (t *tagValidator) Validate(_ context.Context, v any) error {
+	var vs Violations
+	if err := t.walk(&vs, reflect.ValueOf(v), "", 0); err != nil {
+		return err
+	}
+	return vs.Err()
+}
+
+func (t *tagValidator) walk(vs *Violations, v reflect.Value, path string, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		ti := t.typeInfo(v.Type())
+		if ti.err != nil {
+			return ti.err
+		}
+		for _, f := range ti.fields {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil {
+				continue // 经由 nil 嵌入指针提升的字段
+			}
+			fpath := joinPath(path, f.name)
+			t.check(vs, fv, f.rules, fpath)
+			if f.elemRules != nil {
+				forEachElem(fv, func(ev reflect.Value, seg string) {
+					t.check(vs, ev, *f.elemRules, fpath+seg)
+				})
+			}
+			if err := t.walk(vs, fv, fpath, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if !hasStructs(v.Type().Elem()) {
+			return nil
+		}
+		var err error
+		forEachElem(v, func(ev reflect.Value, seg string) {
+			if err == nil {
+				err = t.walk(vs, ev, path+seg, depth+1)
+			}
+		})
+		return err
+	}
+	return nil
+}
+
+// check 对单个值应用规则集,只记录第一条违规。
+func (t *tagValidator) check(vs *Violations, v reflect.Value, rs ruleSet, path string) {
+	if len(rs.rules) == 0 && !rs.required {
+		return
+	}
+	if isZero(v) {
+		if rs.required {
+			vs.Add(path, "is required")
+		}
+		if rs.required || rs.omitempty {
+			return
+		}
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	for _, r := range rs.rules {
+		if msg := r.fn(v, r.param); msg != "" {
+			vs.Add(path, msg)
+			return
+		}
+	}
+}
+
+func (t *tagValidator) typeInfo(typ reflect.Type) *typeInfo {
+	if ti, ok := t.cache.Load(typ); ok {
+		return ti.(*typeInfo)
+	}
+	ti := &typeInfo{}
+	for _, sf := range reflect.VisibleFields(typ) {
+		if !sf.IsExported() || sf.Anonymous && derefType(sf.Type).Kind() == reflect.Struct {
+			continue // 嵌入结构体的字段已由 VisibleFields 提升展开
+		}
+		f := fieldInfo{index: sf.Index, name: t.fieldName(sf)}
+		if f.name == "-" {
+			continue
+		}
+		if tag, ok := sf.Tag.Lookup(t.cfg.tag); ok && tag != "-" {
+			head, tail, dive := strings.Cut(tag, ",dive")
+			if !dive && strings.HasPrefix(tag, "dive") {
+				head, tail, dive = "", strings.TrimPrefix(tag, "dive"), true
+			}
+			var err error
+			if f.rules, err = t.parse(head); err == nil && dive {
+				if !isContainer(sf.Type) {
+					err = fmt.Errorf("dive on non-container type %s", sf.Type)
+				} else {
+					var elem ruleSet
+					elem, err = t.parse(strings.TrimPrefix(tail, ","))
+					f.elemRules = &elem
+				}
+			}
+			if err != nil {
+				ti.err = fmt.Errorf("validate: %s.%s: %w", typ, sf.Name, err)
+				break
+			}
+		}
+		ti.fields = append(ti.fields, f)
+	}
+	actual, _ := t.cache.LoadOrStore(typ, ti)
+	return actual.(*typeInfo)
+}
+
+func (t *tagValidator) fieldName(sf reflect.StructField) string {
+	if t.cfg.nameTag != "" {
+		if tag, ok := sf.Tag.Lookup(t.cfg.nameTag); ok {
+			if name, _, _ := strings.Cut(tag, ","); name != "" {
+				return name
+			}
+		}
+	}
+	return sf.Name
+}
+
+func (t *tagValidator) parse(tag string) (ruleSet, error) {
+	var rs ruleSet
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		name, param, _ := strings.Cut(part, "=")
+		switch name {
+		case "":
+			continue
+		case "required":
+			rs.required = true
+			continue
+		case "omitempty":
+			rs.omitempty = true
+			continue
+		}
+		fn, ok := t.rules[name]
+		if !ok {
+			return rs, fmt.Errorf("unknown rule %q", name)
+		}
+		if _, numeric := numericRules[name]; numeric {
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return rs, fmt.Errorf("rule %q: invalid number %q", name, param)
+			}
+		}
+		rs.rules = append(rs.rules, boundRule{name: name, param: param, fn: fn})
+	}
+	return rs, nil
+}
+
+func forEachElem(v reflect.Value, fn func(ev reflect.Value, seg string)) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			fn(v.Index(i), "["+strconv.Itoa(i)+"]")
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+		for _, k := range keys {
+			fn(v.MapIndex(k), "["+strconv.Quote(fmt.Sprint(k))+"]")
+		}
+	}
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func isContainer(t reflect.Type) bool {
+	switch derefType(t).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// hasStructs 判断元素类型是否可能含需要递归校验的结构体。
+func hasStructs(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Interface
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// ---- 内置规则 ----
+
+var numericRules = map[string]struct{}{"min": {}, "max": {}, "len": {}, "gt": {}, "gte": {}, "lt": {}, "lte": {}}
+
+var builtinRules = map[string]RuleFunc{
+	"min": compare("min", func(n, p float64) bool { return n >= p }),
+	"max": compare("max", func(n, p float64) bool { return n <= p }),
+	"len": compare("len", func(n, p float64) bool { return n == p }),
+	"gt":  compare("gt", func(n, p float64) bool { return n > p }),
+	"gte": compare("gte", func(n, p float64) bool { return n >= p }),
+	"lt":  compare("lt", func(n, p float64) bool { return n < p }),
+	"lte": compare("lte", func(n, p float64) bool { return n <= p }),
+	"eq": func(v reflect.Value, p string) string {
+		return unless(fmt.Sprint(v.Interface()) == p, "must equal "+p)
+	},
+	"ne": func(v reflect.Value, p string) string {
+		return unless(fmt.Sprint(v.Interface()) != p, "must not equal "+p)
+	},
+	"oneof": func(v reflect.Value, p string) string {
+		opts := strings.Fields(p)
+		return unless(slices.Contains(opts, fmt.Sprint(v.Interface())), "must be one of ["+strings.Join(opts, " ")+"]")
+	},
+	"email": stringRule("must be a valid email address", func(s string) bool {
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	}),
+	"url": stringRule("must be a valid URL", func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	}),
+	"uuid": stringRule("must be a valid UUID", uuidRE.MatchString),
+	"ip": stringRule("must be a valid IP address", func(s string) bool {
+		return net.ParseIP(s) != nil
+	}),
+	"alpha": stringRule("must contain only letters", func(s string) bool {
+		return s != "" && !strings.ContainsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	}),
+	"alphanum": stringRule("must contain only letters and digits", func(s string) bool {
+		return s != "" && !strings.ContainsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	}),
+	"numeric": stringRule("must be numeric", func(s string) bool {
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	}),
+	"contains": func(v reflect.Value, p string) string {
+		return stringRule(fmt.Sprintf("must contain %q", p), func(s string) bool { return strings.Contains(s, p) })(v, p)
+	},
+	"startswith": func(v reflect.Value, p string) string {
+		return stringRule(fmt.Sprintf("must start with %q", p), func(s string) bool { return strings.HasPrefix(s, p) })(v, p)
+	},
+	"endswith": func(v reflect.Value, p string) string {
+		return stringRule(fmt.Sprintf("must end with %q", p), func(s string) bool { return strings.HasSuffix(s, p) })(v, p)
+	},
+}
+
+var uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func unless(ok bool, msg string) string {
+	if ok {
+		return ""
+	}
+	return msg
+}
+
+func stringRule(msg string, ok func(string) bool) RuleFunc {
+	return func(v reflect.Value, _ string) string {
+		if v.Kind() != reflect.String {
+			return "must be a string"
+		}
+		return unless(ok(v.String()), msg)
+	}
+}
+
+// compare 生成数值/长度比较规则;描述随值的种类变化(字符数/元素数/数值)。
+func compare(name string, ok func(n, p float64) bool) RuleFunc {
+	return func(v reflect.Value, param string) string {
+		p, _ := strconv.ParseFloat(param, 64)
+		var (
+			n    float64
+			unit string
+		)
+		switch v.Kind() {
+		case reflect.String:
+			n, unit = float64(utf8.RuneCountInString(v.String())), "characters"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			n, unit = float64(v.Len()), "items"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = v.Float()
+		default:
+			return "has unsupported type for " + name
+		}
+		if ok(n, p) {
+			return ""
+		}
+		return describe(name, param, unit)
+	}
+}
+
+func describe(name, param, unit string) string {
+	if unit == "" {
+		switch name {
+		case "min", "gte":
+			return "must be greater than or equal to " + param
+		case "max", "lte":
+			return "must be less than or equal to " + param
+		case "len":
+			return "must equal " + param
+		case "gt":
+			return "must be greater than " + param
+		default:
+			return "must be less than " + param
+		}
+	}
+	verb := "must be"
+	if unit == "items" {
+		verb = "must contain"
+	}
+	switch name {
+	case "min", "gte":
+		return fmt.Sprintf("%s at least %s %s", verb, param, unit)
+	case "max", "lte":
+		return fmt.Sprintf("%s at most %s %s", verb, param, unit)
+	case "len":
+		return fmt.Sprintf("%s exactly %s %s", verb, param, unit)
+	case "gt":
+		return fmt.Sprintf("%s more than %s %s", verb, param, unit)
+	default:
+		return fmt.Sprintf("%s fewer than %s %s", verb, param, unit)
+	}
+}
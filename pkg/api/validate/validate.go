@@ -0,0 +1,175 @@
+// Package validate 把请求校验从业务 handler 里拿出来:收集全部违规字段,合并成一个
+// InvalidArgument 的 *errors.Status,每个违规一条 errors.FieldViolation。
+//
+// 约束来源:
+//   - struct tag:`validate:"required,min=3,max=64,email"`,供 api/handler 解出的 JSON 请求体使用
+//     (规则见下文);
+//   - 消息自校验:实现 ValidateAll() error / Validate() error 的类型(protoc-gen-validate 生成代码、
+//     手写业务校验),错误里的 Field()/Reason() 会被拆成逐字段违规;
+//   - protovalidate(buf.validate 注解 + CEL):见 contrib/protovalidate,实现同一个 Validator 接口。
+//
+// struct tag 规则(逗号分隔,按顺序检查,同一字段只报第一条违规):
+//
+//	required            非零值(字符串非空、切片/map 非空、指针非 nil)
+//	omitempty           零值时跳过其余规则
+//	min=N max=N len=N   字符串按字符数,切片/map 按元素数,数字按数值
+//	gt gte lt lte =N    同上,严格/非严格比较
+//	eq=X ne=X           值的字符串形式相等/不等
+//	oneof=a b c         取值之一(空格分隔)
+//	email url uuid ip   格式
+//	alpha alphanum numeric
+//	contains=X startswith=X endswith=X
+//	dive                其后的规则作用于切片/数组/map 的每个元素
+//
+// 嵌套结构体、结构体指针、结构体切片/map 会递归校验;字段路径取 json 名,如 "items[2].sku"。
+// 自定义规则用 WithRule 注册。
+//
+//	type CreateOrderReq struct {
+//	    Email string   `json:"email" validate:"required,email"`
+//	    Tags  []string `json:"tags" validate:"max=5,dive,min=1,max=16"`
+//	    Items []Item   `json:"items" validate:"required"`
+//	}
+//
+// 接入点:gRPC 用 UnaryServerInterceptor / StreamServerInterceptor,HTTP 用 handler.WithValidator。
+//
+//	v := validate.New() // struct tag + 自校验
+//	grpc.NewServer(grpc.ChainUnaryInterceptor(validate.UnaryServerInterceptor(v), errors.GRPCUnaryServerInterceptor))
+//	handler.New("POST /orders", createOrder, handler.WithValidator(v))
+package validate
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+)
+
+// Validator 校验一个请求值。通过返回 nil;不通过返回 *errors.Status
+// (CodeInvalidArgument + 全部 FieldViolation),其它 error 视为校验器自身故障。
+type Validator interface {
+	Validate(ctx context.Context, v any) error
+}
+
+// Func 把函数适配为 Validator。
+type Func func(ctx context.Context, v any) error
+
+// Validate 实现 Validator。
+func (f Func) Validate(ctx context.Context, v any) error { return f(ctx, v) }
+
+// Chain 依次运行多个 Validator,把各自的 FieldViolation 合并进同一个 Status;
+// 任一校验器返回非 Status 的 error 时立即返回该 error。
+func Chain(vs ...Validator) Validator {
+	return Func(func(ctx context.Context, v any) error {
+		var all Violations
+		for _, x := range vs {
+			err := x.Validate(ctx, v)
+			if err == nil {
+				continue
+			}
+			st, ok := perr.FromError(err)
+			if !ok {
+				return err
+			}
+			all = append(all, FromStatus(st)...)
+		}
+		return all.Err()
+	})
+}
+
+// Violations 是一组字段违规。
+type Violations []*perr.FieldViolation
+
+// Add 追加一条违规。
+func (vs *Violations) Add(field, description string) {
+	*vs = append(*vs, &perr.FieldViolation{Field: field, Description: description})
+}
+
+// Err 无违规时返回 nil,否则返回 InvalidArgument 的 *errors.Status,每条违规一个 FieldViolation。
+func (vs Violations) Err() error {
+	if len(vs) == 0 {
+		return nil
+	}
+	msg := "validation failed: " + strconv.Itoa(len(vs)) + " field violation"
+	if len(vs) > 1 {
+		msg += "s"
+	}
+	st := perr.InvalidArgument(msg)
+	for _, v := range vs {
+		st = st.WithDetail(v)
+	}
+	return st
+}
+
+// FromStatus 取出 Status 里的 FieldViolation;Status 不带字段违规时用其消息生成一条无字段的违规,
+// 保证合并后信息不丢。
+func FromStatus(st *perr.Status) Violations {
+	var out Violations
+	for _, d := range st.Details() {
+		if fv, ok := d.(*perr.FieldViolation); ok {
+			out = append(out, fv)
+		}
+	}
+	if len(out) == 0 {
+		out.Add("", st.Message())
+	}
+	return out
+}
+
+// Option 配置 New 返回的 Validator。
+type Option func(*config)
+
+type config struct {
+	tag        string
+	nameTag    string
+	rules      map[string]RuleFunc
+	selfCheck  bool
+	structTags bool
+}
+
+// WithTagName 设置约束所在的 struct tag 名,默认 "validate"。
+func WithTagName(name string) Option { return func(c *config) { c.tag = name } }
+
+// WithFieldNameTag 设置违规字段名取自哪个 tag(取逗号前部分),默认 "json";
+// 为空或 tag 缺失时用 Go 字段名。
+func WithFieldNameTag(name string) Option { return func(c *config) { c.nameTag = name } }
+
+// WithRule 注册自定义规则,在 tag 中以 name 或 name=param 引用;同名覆盖内置规则。
+func WithRule(name string, fn RuleFunc) Option {
+	return func(c *config) { c.rules[name] = fn }
+}
+
+// WithoutSelfValidation 不调用值自身的 ValidateAll/Validate 方法,只看 struct tag。
+func WithoutSelfValidation() Option { return func(c *config) { c.selfCheck = false } }
+
+// WithoutStructTags 不解析 struct tag,只做消息自校验(如纯 protobuf 服务)。
+func WithoutStructTags() Option { return func(c *config) { c.structTags = false } }
+
+// New 返回默认 Validator:先按 struct tag 校验,再调用值的 ValidateAll/Validate,违规合并返回。
+func New(opts ...Option) Validator {
+	c := &config{tag: "validate", nameTag: "json", rules: make(map[string]RuleFunc), selfCheck: true, structTags: true}
+	for _, o := range opts {
+		o(c)
+	}
+	var vs []Validator
+	if c.structTags {
+		vs = append(vs, newTagValidator(c))
+	}
+	if c.selfCheck {
+		vs = append(vs, Func(selfValidate))
+	}
+	return Chain(vs...)
+}
+
+// joinPath 拼接字段路径:父为空时直接返回子;子以 [ 开头(下标)时不加点。
+func joinPath(parent, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "":
+		return parent
+	case strings.HasPrefix(child, "["):
+		return parent + child
+	}
+	return parent + "." + child
+}
@@ -0,0 +1,170 @@
+package validate_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/api/validate"
+)
+
+type item struct {
+	SKU string `json:"sku" validate:"required,max=8"`
+	Qty int    `json:"qty" validate:"gte=1,lte=99"`
+}
+
+type Address struct {
+	Country string `json:"country" validate:"oneof=CN SG US"`
+}
+
+type order struct {
+	Address
+	Email   string            `json:"email" validate:"required,email"`
+	Coupon  string            `json:"coupon,omitempty" validate:"omitempty,len=6,alphanum"`
+	Tags    []string          `json:"tags" validate:"max=3,dive,min=2"`
+	Items   []item            `json:"items" validate:"required"`
+	Ship    *item             `json:"ship"`
+	Labels  map[string]string `json:"labels" validate:"dive,startswith=x-"`
+	Website string            `json:"website" validate:"omitempty,url"`
+	Note    string            `json:"-" validate:"required"`
+}
+
+func violations(t *testing.T, err error) map[string]string {
+	t.Helper()
+	st, ok := perr.FromError(err)
+	if !ok || st.Code() != perr.CodeInvalidArgument {
+		t.Fatalf("want InvalidArgument status, got %v", err)
+	}
+	out := map[string]string{}
+	for _, fv := range validate.FromStatus(st) {
+		out[fv.Field] = fv.Description
+	}
+	return out
+}
+
+func TestStructTags(t *testing.T) {
+	v := validate.New()
+	valid := order{
+		Address: Address{Country: "CN"},
+		Email:   "a@example.com",
+		Tags:    []string{"ab"},
+		Items:   []item{{SKU: "A1", Qty: 1}},
+		Labels:  map[string]string{"k": "x-1"},
+	}
+	if err := v.Validate(context.Background(), &valid); err != nil {
+		t.Fatalf("valid order rejected: %v", err)
+	}
+
+	bad := order{
+		Address: Address{Country: "JP"},
+		Email:   "not-an-email",
+		Coupon:  "ABC",
+		Tags:    []string{"ok", "x", "yy", "zz"},
+		Items:   []item{{SKU: "A1", Qty: 1}, {SKU: "TOO-LONG-SKU", Qty: 0}},
+		Ship:    &item{Qty: 5},
+		Labels:  map[string]string{"k": "y"},
+		Website: "example.com",
+	}
+	got := violations(t, v.Validate(context.Background(), &bad))
+	want := map[string]string{
+		"country":      "must be one of [CN SG US]",
+		"email":        "must be a valid email address",
+		"coupon":       "must be exactly 6 characters",
+		"tags":         "must contain at most 3 items",
+		"tags[1]":      "must be at least 2 characters",
+		"items[1].sku": "must be at most 8 characters",
+		"items[1].qty": "must be greater than or equal to 1",
+		"ship.sku":     "is required",
+		`labels["k"]`:  `must start with "x-"`,
+		"website":      "must be a valid URL",
+	}
+	for f, d := range want {
+		if got[f] != d {
+			t.Errorf("%s: got %q, want %q", f, got[f], d)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("extra violations: %v", got)
+	}
+
+	if got := violations(t, v.Validate(context.Background(), &order{})); got["items"] != "is required" || got["email"] != "is required" {
+		t.Fatalf("empty order: %v", got)
+	}
+}
+
+func TestCustomRuleAndBadTag(t *testing.T) {
+	type req struct {
+		Code string `json:"code" validate:"required,even_len"`
+	}
+	v := validate.New(validate.WithRule("even_len", func(rv reflect.Value, _ string) string {
+		if len(rv.String())%2 != 0 {
+			return "must have an even length"
+		}
+		return ""
+	}))
+	if got := violations(t, v.Validate(context.Background(), req{Code: "abc"})); got["code"] != "must have an even length" {
+		t.Fatalf("custom rule: %v", got)
+	}
+
+	type broken struct {
+		N int `validate:"min=ten"`
+	}
+	err := validate.New().Validate(context.Background(), broken{})
+	if _, isStatus := perr.FromError(err); err == nil || isStatus || !strings.Contains(err.Error(), "invalid number") {
+		t.Fatalf("bad tag should be a validator error, got %v", err)
+	}
+}
+
+// pgvError / pgvMulti 模拟 protoc-gen-validate 生成的错误类型。
+type pgvError struct {
+	field, reason string
+	cause         error
+}
+
+func (e pgvError) Field() string  { return e.field }
+func (e pgvError) Reason() string { return e.reason }
+func (e pgvError) Cause() error   { return e.cause }
+func (e pgvError) Error() string  { return fmt.Sprintf("invalid %s: %s", e.field, e.reason) }
+
+type pgvMulti []error
+
+func (m pgvMulti) Error() string      { return "multiple errors" }
+func (m pgvMulti) AllErrors() []error { return m }
+
+type pgvMessage struct{ err error }
+
+func (m *pgvMessage) ValidateAll() error { return m.err }
+
+type plainValidator struct{}
+
+func (plainValidator) Validate() error { return stderrors.New("end must be after start") }
+
+func TestSelfValidation(t *testing.T) {
+	msg := &pgvMessage{err: pgvMulti{
+		pgvError{field: "name", reason: "value length must be at least 1 runes"},
+		pgvError{field: "items[0]", reason: "embedded message failed validation", cause: pgvMulti{
+			pgvError{field: "qty", reason: "value must be greater than 0"},
+		}},
+		pgvError{field: "meta", reason: "embedded message failed validation", cause: stderrors.New("opaque")},
+	}}
+	got := violations(t, validate.New().Validate(context.Background(), msg))
+	want := map[string]string{
+		"name":         "value length must be at least 1 runes",
+		"items[0].qty": "value must be greater than 0",
+		"meta":         "embedded message failed validation",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v", got)
+	}
+
+	if got := violations(t, validate.New().Validate(context.Background(), plainValidator{})); got[""] != "end must be after start" {
+		t.Fatalf("plain Validate(): %v", got)
+	}
+	if err := validate.New(validate.WithoutSelfValidation()).Validate(context.Background(), plainValidator{}); err != nil {
+		t.Fatalf("self validation disabled: %v", err)
+	}
+}
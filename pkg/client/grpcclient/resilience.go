@@ -1,8 +1,10 @@
 package grpcclient
 
 import (
+	mwbulkhead "github.com/rushteam/beauty/pkg/middleware/bulkhead"
 	mwcache "github.com/rushteam/beauty/pkg/middleware/cache"
 	mwcb "github.com/rushteam/beauty/pkg/middleware/circuitbreaker"
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
 	"google.golang.org/grpc"
 )
 
@@ -20,6 +22,21 @@ func WithCircuitBreakerInterceptor(cb *mwcb.CircuitBreaker) DialOption {
 	return WithGRPCDialOptions(grpc.WithChainUnaryInterceptor(mwcb.UnaryClientInterceptor(cb)))
 }
 
+// WithBulkheadInterceptor 接入舱壁隔离(pkg/middleware/bulkhead):一元调用与整条流各占 reg 中
+// name 舱壁的一个名额,舱壁满时返回带 RetryInfo 的 codes.Unavailable。name 为空时用连接 target。
+// 与 WithCircuitBreakerInterceptor 互补:熔断看错误率,舱壁限住"变慢但未报错"的下游。
+// 两者同用时把本项放在前面(拦截器链更外层),本地饱和的拒绝才不会被熔断计为下游失败。
+//
+//	reg := bulkhead.NewRegistry()
+//	reg.Register("payment", bulkhead.WithMaxConcurrent(8))
+//	conn, _ := grpcclient.DialContext(ctx, target, grpcclient.WithBulkheadInterceptor(reg, "payment"))
+func WithBulkheadInterceptor(reg *bulkhead.Registry, name string) DialOption {
+	return WithGRPCDialOptions(
+		grpc.WithChainUnaryInterceptor(mwbulkhead.UnaryClientInterceptor(reg, name)),
+		grpc.WithChainStreamInterceptor(mwbulkhead.StreamClientInterceptor(reg, name)),
+	)
+}
+
 // WithCacheInterceptor 接入 gRPC 响应缓存(pkg/middleware/cache):
 // 相同方法 + 相同请求命中缓存时直接返回,跳过网络调用。
 // 拦截器注册在 chain 最外层:缓存命中不经过熔断/重试。
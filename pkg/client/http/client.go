@@ -6,8 +6,11 @@ import (
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	mwbulkhead "github.com/rushteam/beauty/pkg/middleware/bulkhead"
 	mwcb "github.com/rushteam/beauty/pkg/middleware/circuitbreaker"
+	"github.com/rushteam/beauty/pkg/middleware/signverify"
 	"github.com/rushteam/beauty/pkg/resilience/backoff"
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
 )
 
 const defaultTimeout = 30 * time.Second
@@ -28,14 +31,18 @@ func NewHTTPClient(opts ...ClientOption) *http.Client {
 	for _, o := range opts {
 		o(&cfg)
 	}
-	// 传输链(外→内):缓存 → 熔断 → 重试 → otel → base。
-	// 缓存在最外:命中时跳过熔断/重试(无网络开销);熔断在缓存之内:只统计实际下游请求;
-	// otel 在最内:每次实际尝试各自成 span。
+	// 传输链(外→内):缓存 → 舱壁 → 熔断 → 重试 → 签名 → otel → base。
+	// 缓存在最外:命中时跳过熔断/重试(无网络开销);舱壁在熔断之外:本地饱和的拒绝不计入熔断统计,
+	// 熔断只统计实际下游请求;舱壁在重试之外:一次逻辑调用(含退避等待)只占一个名额,拒绝也不会触发重试;
+	// 签名在重试之内:每次尝试各自重签;otel 在最内:每次实际尝试各自成 span,且 trace 头不参与签名。
 	base := cfg.base
 	if base == nil {
 		base = http.DefaultTransport
 	}
 	var rt http.RoundTripper = otelhttp.NewTransport(base, cfg.otelOpts...)
+	if cfg.signer != nil {
+		rt = NewSigningTransport(rt, cfg.signer)
+	}
 	if cfg.retry != nil {
 		retryable := cfg.retryable
 		if retryable == nil {
@@ -46,6 +53,9 @@ func NewHTTPClient(opts ...ClientOption) *http.Client {
 	if cfg.breaker != nil {
 		rt = mwcb.HTTPClientMiddleware(cfg.breaker)(rt)
 	}
+	if cfg.bulkheads != nil {
+		rt = mwbulkhead.HTTPClientMiddleware(cfg.bulkheads, cfg.bulkheadName)(rt)
+	}
 	if cfg.cacheStore != nil {
 		rt = NewCacheTransport(rt, cfg.cacheStore, cfg.cacheOpts...)
 	}
@@ -53,14 +63,17 @@ func NewHTTPClient(opts ...ClientOption) *http.Client {
 }
 
 type clientConfig struct {
-	timeout    time.Duration
-	base       http.RoundTripper
-	otelOpts   []otelhttp.Option
-	retry      *backoff.Policy
-	retryable  RetryableFunc
-	breaker    *mwcb.CircuitBreaker
-	cacheStore HTTPCacheStore
-	cacheOpts  []CacheTransportOption
+	timeout      time.Duration
+	base         http.RoundTripper
+	otelOpts     []otelhttp.Option
+	retry        *backoff.Policy
+	retryable    RetryableFunc
+	breaker      *mwcb.CircuitBreaker
+	bulkheads    *bulkhead.Registry
+	bulkheadName string
+	cacheStore   HTTPCacheStore
+	cacheOpts    []CacheTransportOption
+	signer       *signverify.Signer
 }
 
 // ClientOption 配置 NewHTTPClient 的选项。
@@ -107,6 +120,16 @@ func WithCircuitBreaker(cb *mwcb.CircuitBreaker) ClientOption {
 	return func(c *clientConfig) { c.breaker = cb }
 }
 
+// WithBulkhead 接入舱壁隔离(pkg/middleware/bulkhead):每个请求占用 reg 中 name 舱壁的一个名额,
+// 直到响应体读完或关闭;舱壁满时返回 *errors.Status(Unavailable,附 RetryInfo)。
+// name 为空时按请求的 URL.Host 隔离,同一 client 访问多个下游也互不拖累。
+func WithBulkhead(reg *bulkhead.Registry, name string) ClientOption {
+	return func(c *clientConfig) {
+		c.bulkheads = reg
+		c.bulkheadName = name
+	}
+}
+
 // WithCache 开启 HTTP 响应缓存。缓存在传输链最外层:命中时跳过熔断/重试/OTel,
 // 零网络开销;未命中走完整链路后存入缓存。默认仅缓存 GET、遵守 Cache-Control。
 func WithCache(store HTTPCacheStore, opts ...CacheTransportOption) ClientOption {
@@ -115,3 +138,9 @@ func WithCache(store HTTPCacheStore, opts ...CacheTransportOption) ClientOption
 		c.cacheOpts = opts
 	}
 }
+
+// WithSigner 对每个出站请求做 RFC 9421 HTTP Message Signatures 签名,
+// 与服务端 signverify.HTTPMessageSignatures 配对使用。用 signverify.NewSigner 构造。
+func WithSigner(s *signverify.Signer) ClientOption {
+	return func(c *clientConfig) { c.signer = s }
+}
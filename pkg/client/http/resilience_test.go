@@ -2,6 +2,7 @@ package resty_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -10,9 +11,11 @@ import (
 	"testing"
 	"time"
 
+	perr "github.com/rushteam/beauty/pkg/api/errors"
 	resty "github.com/rushteam/beauty/pkg/client/http"
 	mwcb "github.com/rushteam/beauty/pkg/middleware/circuitbreaker"
 	"github.com/rushteam/beauty/pkg/resilience/backoff"
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
 )
 
 func fastPolicy(retries int) *backoff.Policy {
@@ -173,3 +176,64 @@ func TestWithCircuitBreaker_Opens(t *testing.T) {
 		t.Fatal("熔断打开后应有请求返回错误(短路)")
 	}
 }
+
+// 舱壁满时直接返回 Unavailable,不打到后端,也不触发重试。
+func TestWithBulkhead_RejectsWhenSaturated(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	reg := bulkhead.NewRegistry()
+	reg.Register("backend", bulkhead.WithMaxConcurrent(1))
+	c := resty.NewHTTPClient(resty.WithBulkhead(reg, "backend"), resty.WithRetry(fastPolicy(3)))
+
+	held, err := c.Get(srv.URL) // 响应体未关闭,名额一直占着
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Get(srv.URL)
+	var st *perr.Status
+	if !errors.As(err, &st) || st.Code() != perr.CodeUnavailable {
+		t.Fatalf("舱壁满应返回 Unavailable, got %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("被拒绝的请求不应打到后端或重试, 后端命中 %d", hits.Load())
+	}
+	held.Body.Close()
+
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("释放后应可再次请求: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// 舱壁在熔断之外:本地饱和的拒绝不计为下游失败,不会把熔断打开。
+func TestWithBulkhead_RejectionsDoNotTripBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	reg := bulkhead.NewRegistry()
+	reg.Register("backend", bulkhead.WithMaxConcurrent(1))
+	cb := mwcb.NewCircuitBreaker(mwcb.ConsecutiveFailuresConfig("test-bulkhead", 2))
+	c := resty.NewHTTPClient(resty.WithBulkhead(reg, "backend"), resty.WithCircuitBreaker(cb))
+
+	held, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := c.Get(srv.URL); err == nil {
+			t.Fatal("舱壁满应拒绝")
+		}
+	}
+	held.Body.Close()
+	if st := cb.State(); st != mwcb.StateClosed {
+		t.Fatalf("本地拒绝不应触发熔断, state = %v", st)
+	}
+}
@@ -0,0 +1,43 @@
+package resty
+
+import (
+	"net/http"
+
+	"github.com/rushteam/beauty/pkg/middleware/signverify"
+)
+
+// signTransport 在请求发出前按 RFC 9421 签名(Signature-Input / Signature,有 body 时附带 Content-Digest)。
+// 位于重试之内:每次尝试各自重签,created/nonce 随之刷新,不会因重放被服务端判为过期。
+type signTransport struct {
+	base   http.RoundTripper
+	signer *signverify.Signer
+}
+
+// NewSigningTransport 返回对每个请求签名的 http.RoundTripper。
+// 原请求不被修改(RoundTripper 约定),签名作用在克隆上。
+func NewSigningTransport(base http.RoundTripper, signer *signverify.Signer) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &signTransport{base: base, signer: signer}
+}
+
+func (t *signTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	// 有 GetBody 时取一份新 body 签名,避免消费掉调用方持有的原 body。
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		r.Body = body
+	}
+	if err := t.signer.Sign(r); err != nil {
+		if r.Body != nil {
+			_ = r.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,59 @@
+package resty_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	resty "github.com/rushteam/beauty/pkg/client/http"
+	"github.com/rushteam/beauty/pkg/middleware/signverify"
+)
+
+// 签名在重试之内:重放的请求体与每次重签都能通过服务端验签。
+func TestWithSigner_VerifiedAcrossRetries(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := signverify.NewSigner("client-1", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits, verified atomic.Int64
+	verify := signverify.HTTPMessageSignatures(func(id string) (signverify.Key, bool) {
+		return signverify.Key{Key: pub}, id == "client-1"
+	})
+	srv := httptest.NewServer(verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified.Add(1)
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})))
+	defer srv.Close()
+
+	c := resty.NewHTTPClient(
+		resty.WithSigner(signer),
+		resty.WithRetry(fastPolicy(3)),
+		resty.WithRetryable(func(_ *http.Request, resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode == http.StatusServiceUnavailable
+		}),
+	)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/orders?id=1", strings.NewReader(`{"qty":1}`))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != `{"qty":1}` || verified.Load() != 2 {
+		t.Fatalf("status=%d body=%q verified=%d", resp.StatusCode, body, verified.Load())
+	}
+	if req.Header.Get("Signature") != "" {
+		t.Fatal("caller's request must not be mutated")
+	}
+}
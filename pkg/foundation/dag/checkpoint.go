@@ -0,0 +1,59 @@
+package dag
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Checkpoint 是一次运行（runID）的进度：已结束节点的结果（含输出）。
+type Checkpoint struct {
+	RunID     string                `json:"run_id"`
+	Nodes     map[string]NodeResult `json:"nodes"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// CheckpointStore 保存运行进度。Save 为整体覆盖写；实现须并发安全。
+// 持久化实现可把 Checkpoint JSON 序列化后写入数据库 / 对象存储 / kvstore。
+type CheckpointStore interface {
+	// Load 读取 runID 的 checkpoint；不存在返回 (nil, nil)。
+	Load(ctx context.Context, runID string) (*Checkpoint, error)
+	Save(ctx context.Context, cp *Checkpoint) error
+}
+
+// MemoryCheckpoints 是 CheckpointStore 的内存实现，用于测试与同进程内重跑。
+// 零值不可用，用 NewMemoryCheckpoints 构造。
+type MemoryCheckpoints struct {
+	mu  sync.Mutex
+	cps map[string]*Checkpoint
+}
+
+// NewMemoryCheckpoints 创建内存 checkpoint 存储。
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{cps: make(map[string]*Checkpoint)}
+}
+
+func (m *MemoryCheckpoints) Load(_ context.Context, runID string) (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.cps[runID]
+	if !ok {
+		return nil, nil
+	}
+	return cp.clone(), nil
+}
+
+func (m *MemoryCheckpoints) Save(_ context.Context, cp *Checkpoint) error {
+	m.mu.Lock()
+	m.cps[cp.RunID] = cp.clone()
+	m.mu.Unlock()
+	return nil
+}
+
+func (cp *Checkpoint) clone() *Checkpoint {
+	out := &Checkpoint{RunID: cp.RunID, Nodes: make(map[string]NodeResult, len(cp.Nodes)), UpdatedAt: cp.UpdatedAt}
+	for k, v := range cp.Nodes {
+		out.Nodes[k] = v
+	}
+	return out
+}
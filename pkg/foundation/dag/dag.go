@@ -1,13 +1,23 @@
 // Package dag 提供一个轻量的有向无环图（DAG）执行器：
 // 按依赖关系将节点拓扑分层，同一层内的节点并行执行，层间串行。
 // 不绑定任何数据库 / 调度器 / 任务体系——每个节点的工作由 Node.Run 闭包描述。
+//
+// 面向数据管道的进阶能力（均为可选）：
+//   - 节点级重试（Node.Retry，复用 pkg/resilience/backoff）与单次超时（Node.Timeout）；
+//   - 父子节点传值：Produce / Output 写出输出，Input 按类型读取父节点输出；
+//   - 条件执行：Node.When 返回 false 时跳过该节点及其整棵子树；
+//   - Checkpoint：Execute 按 runID 把每个节点的结果写入 CheckpointStore，失败后用同一 runID
+//     再次 Execute 只重跑失败 / 未运行的节点（已成功节点的输出从 checkpoint 恢复）；
+//   - 运行报告：Execute 返回每个节点的状态、尝试次数、耗时（Report），WithOnNodeDone 实时上报；
+//   - 导出：DOT / Mermaid 输出图结构，传入 Report 时按运行状态着色。
 package dag
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
 )
 
 // Strategy 控制某个节点返回错误时的行为。
@@ -28,6 +38,14 @@ type Node struct {
 	DependsOn []string
 	// Run 节点要执行的工作。为 nil 时视为空节点（仅占位/聚合依赖）。
 	Run func(ctx context.Context) error
+
+	// Retry 失败重试策略，nil 表示不重试。重试次数与间隔由 backoff.Policy 决定。
+	Retry *backoff.Policy
+	// Timeout 单次执行（每次重试各自计时）的超时，<=0 表示不限制。
+	Timeout time.Duration
+	// When 在依赖完成后、Run 之前求值（可用 Input 读取父节点输出）；返回 false 时本节点
+	// 及所有直接 / 间接依赖它的节点都被跳过（StatusSkipped），不视为失败。
+	When func(ctx context.Context) bool
 }
 
 // DAG 是一组按依赖关系执行的节点。零值不可用，请用 New 构造。
@@ -35,6 +53,8 @@ type DAG struct {
 	nodes       []Node
 	strategy    Strategy
 	maxParallel int // 单层内最大并发数，<=0 表示不限制
+	checkpoints CheckpointStore
+	onNodeDone  func(name string, res NodeResult)
 }
 
 // Option 配置 DAG。
@@ -51,6 +71,19 @@ func WithMaxParallel(n int) Option {
 	return func(d *DAG) { d.maxParallel = n }
 }
 
+// WithCheckpoint 设置 checkpoint 存储：Execute 每完成一个节点就保存一次该 runID 的进度，
+// 再次以同一 runID Execute 时跳过已成功 / 已跳过的节点。节点输出以 JSON 保存，
+// 需要断点续跑的节点输出应可 JSON 序列化。
+func WithCheckpoint(store CheckpointStore) Option {
+	return func(d *DAG) { d.checkpoints = store }
+}
+
+// WithOnNodeDone 设置节点结束（成功 / 失败 / 跳过）时的回调，用于上报每个节点的运行指标。
+// 回调在节点所在 goroutine 中同步调用，应尽快返回。
+func WithOnNodeDone(fn func(name string, res NodeResult)) Option {
+	return func(d *DAG) { d.onNodeDone = fn }
+}
+
 // New 创建一个 DAG。
 func New(opts ...Option) *DAG {
 	d := &DAG{strategy: FailFast}
@@ -75,89 +108,11 @@ func (d *DAG) Validate() error {
 // Run 校验并执行整个 DAG。层间串行，层内并行，遵循 ctx 取消。
 //   - FailFast：返回首个失败层的错误（多个失败用 errors.Join 合并）。
 //   - ContinueOnError：执行完所有层，返回所有错误的 errors.Join（无错误则 nil）。
+//
+// Run 不读写 checkpoint，也不返回运行报告；需要时用 Execute。
 func (d *DAG) Run(ctx context.Context) error {
-	layers, err := topoSort(d.nodes)
-	if err != nil {
-		return err
-	}
-
-	var collected []error
-
-	for _, layer := range layers {
-		if err := ctx.Err(); err != nil {
-			return errors.Join(append(collected, fmt.Errorf("dag canceled: %w", err))...)
-		}
-
-		layerErrs := runLayer(ctx, layer, d.maxParallel)
-
-		if len(layerErrs) > 0 {
-			if d.strategy == FailFast {
-				return errors.Join(append(collected, layerErrs...)...)
-			}
-			collected = append(collected, layerErrs...)
-		}
-	}
-
-	return errors.Join(collected...)
-}
-
-// runLayer 并行执行一层节点，返回该层出现的所有错误（已包裹节点名）。
-// maxParallel>0 时用信号量限制同时运行的节点数。
-func runLayer(ctx context.Context, layer []Node, maxParallel int) []error {
-	if len(layer) == 1 {
-		// 单节点无需起 goroutine
-		if err := execNode(ctx, layer[0]); err != nil {
-			return []error{err}
-		}
-		return nil
-	}
-
-	var sem chan struct{}
-	if maxParallel > 0 && maxParallel < len(layer) {
-		sem = make(chan struct{}, maxParallel)
-	}
-
-	errs := make([]error, len(layer))
-	var wg sync.WaitGroup
-	for i := range layer {
-		if sem != nil {
-			sem <- struct{}{} // 达到上限则阻塞，待有空位再调度下一个节点
-		}
-		wg.Add(1)
-		go func(idx int) {
-			defer wg.Done()
-			if sem != nil {
-				defer func() { <-sem }()
-			}
-			errs[idx] = execNode(ctx, layer[idx])
-		}(i)
-	}
-	wg.Wait()
-
-	var out []error
-	for _, e := range errs {
-		if e != nil {
-			out = append(out, e)
-		}
-	}
-	return out
-}
-
-// execNode 执行单个节点，并捕获其 panic 转为 error，避免一个节点 panic
-// 拖垮整个进程（节点 Run 是用户代码，且在 goroutine 中运行）。
-func execNode(ctx context.Context, n Node) (err error) {
-	if n.Run == nil {
-		return nil
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("dag node %q panicked: %v", n.Name, r)
-		}
-	}()
-	if e := n.Run(ctx); e != nil {
-		return fmt.Errorf("dag node %q: %w", n.Name, e)
-	}
-	return nil
+	_, err := d.execute(ctx, "")
+	return err
 }
 
 // topoSort 用 Kahn 算法将节点按依赖分层；同一层的节点之间无依赖、可并行。
@@ -0,0 +1,366 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// Status 是节点在一次运行中的状态。
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // 尚未运行（FailFast 中止或 ctx 取消）
+	StatusSucceeded Status = "succeeded" // 成功
+	StatusFailed    Status = "failed"    // 重试用尽后仍失败
+	StatusSkipped   Status = "skipped"   // When 返回 false，或上游被跳过
+)
+
+// ErrNoOutput 表示 Input 读取的节点没有输出（未运行、被跳过或未调用 Output）。
+var ErrNoOutput = errors.New("dag: node has no output")
+
+// NodeResult 是单个节点的运行结果，也是 checkpoint 中保存的内容。
+type NodeResult struct {
+	Status    Status          `json:"status"`
+	Attempts  int             `json:"attempts,omitempty"`
+	StartedAt time.Time       `json:"started_at,omitzero"`
+	Duration  time.Duration   `json:"duration,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"` // 输出的 JSON（仅配置 checkpoint 时填写）
+	// Resumed 表示本次运行没有执行该节点，结果取自 checkpoint。
+	Resumed bool `json:"-"`
+}
+
+// Report 是一次 Execute 的运行报告。
+type Report struct {
+	RunID    string
+	Nodes    map[string]NodeResult
+	Duration time.Duration
+
+	order []string // 节点的 Add 顺序
+}
+
+// Failed 返回失败节点名（按 Add 顺序）。
+func (r *Report) Failed() []string {
+	return r.names(StatusFailed)
+}
+
+func (r *Report) names(st Status) []string {
+	var out []string
+	for _, name := range r.order {
+		if r.Nodes[name].Status == st {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// execution 是一次运行的可变状态。
+type execution struct {
+	d      *DAG
+	runID  string
+	byName map[string]*Node
+
+	mu      sync.Mutex
+	results map[string]NodeResult
+	outputs map[string]any // 本次产生的输出，或从 checkpoint 恢复的 json.RawMessage
+}
+
+type scope struct {
+	ex   *execution
+	node string
+}
+
+var scopeKey = ctxkey.New[*scope]()
+
+// Execute 执行 DAG 并返回运行报告，语义与 Run 相同。
+//
+// 配置了 WithCheckpoint 且 runID 非空时：先加载该 runID 的 checkpoint，已成功 / 已跳过的节点
+// 不再执行（输出从 checkpoint 恢复），其余节点照常运行；每个节点结束后保存 checkpoint。
+// 失败的运行可用同一 runID 再次 Execute 从断点续跑。图结构变化后旧 checkpoint 中不存在的
+// 节点被忽略，新增节点视为未运行。
+func (d *DAG) Execute(ctx context.Context, runID string) (*Report, error) {
+	return d.execute(ctx, runID)
+}
+
+func (d *DAG) execute(ctx context.Context, runID string) (*Report, error) {
+	layers, err := topoSort(d.nodes)
+	if err != nil {
+		return nil, err
+	}
+	ex := &execution{
+		d:       d,
+		runID:   runID,
+		byName:  make(map[string]*Node, len(d.nodes)),
+		results: make(map[string]NodeResult, len(d.nodes)),
+		outputs: make(map[string]any),
+	}
+	for i := range d.nodes {
+		ex.byName[d.nodes[i].Name] = &d.nodes[i]
+		ex.results[d.nodes[i].Name] = NodeResult{Status: StatusPending}
+	}
+	if err := ex.load(ctx); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var collected []error
+	for _, layer := range layers {
+		if err := ctx.Err(); err != nil {
+			collected = append(collected, fmt.Errorf("dag canceled: %w", err))
+			break
+		}
+		layerErrs := ex.runLayer(ctx, layer)
+		if len(layerErrs) > 0 {
+			collected = append(collected, layerErrs...)
+			if d.strategy == FailFast {
+				break
+			}
+		}
+	}
+	return ex.report(time.Since(start)), errors.Join(collected...)
+}
+
+func (ex *execution) load(ctx context.Context) error {
+	if ex.d.checkpoints == nil || ex.runID == "" {
+		return nil
+	}
+	cp, err := ex.d.checkpoints.Load(ctx, ex.runID)
+	if err != nil {
+		return fmt.Errorf("dag: load checkpoint %q: %w", ex.runID, err)
+	}
+	if cp == nil {
+		return nil
+	}
+	for name, res := range cp.Nodes {
+		if _, ok := ex.byName[name]; !ok {
+			continue
+		}
+		if res.Status != StatusSucceeded && res.Status != StatusSkipped {
+			continue
+		}
+		res.Resumed = true
+		ex.results[name] = res
+		if res.Output != nil {
+			ex.outputs[name] = res.Output
+		}
+	}
+	return nil
+}
+
+func (ex *execution) report(elapsed time.Duration) *Report {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	r := &Report{RunID: ex.runID, Nodes: make(map[string]NodeResult, len(ex.results)), Duration: elapsed}
+	for name, res := range ex.results {
+		r.Nodes[name] = res
+	}
+	for _, n := range ex.d.nodes {
+		r.order = append(r.order, n.Name)
+	}
+	return r
+}
+
+// runLayer 并行执行一层节点，返回该层出现的所有错误（已包裹节点名）。
+// maxParallel>0 时用信号量限制同时运行的节点数。
+func (ex *execution) runLayer(ctx context.Context, layer []Node) []error {
+	if len(layer) == 1 {
+		// 单节点无需起 goroutine
+		if err := ex.runNode(ctx, layer[0]); err != nil {
+			return []error{err}
+		}
+		return nil
+	}
+
+	var sem chan struct{}
+	if maxParallel := ex.d.maxParallel; maxParallel > 0 && maxParallel < len(layer) {
+		sem = make(chan struct{}, maxParallel)
+	}
+
+	errs := make([]error, len(layer))
+	var wg sync.WaitGroup
+	for i := range layer {
+		if sem != nil {
+			sem <- struct{}{} // 达到上限则阻塞，待有空位再调度下一个节点
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			if sem != nil {
+				defer func() { <-sem }()
+			}
+			errs[idx] = ex.runNode(ctx, layer[idx])
+		}(i)
+	}
+	wg.Wait()
+
+	var out []error
+	for _, e := range errs {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// runNode 执行单个节点（含跳过判定、重试、超时），记录结果并保存 checkpoint。
+func (ex *execution) runNode(ctx context.Context, n Node) error {
+	ex.mu.Lock()
+	prev := ex.results[n.Name]
+	skip := false
+	for _, dep := range n.DependsOn {
+		if ex.results[dep].Status == StatusSkipped {
+			skip = true
+		}
+	}
+	ex.mu.Unlock()
+	if prev.Resumed {
+		return nil
+	}
+
+	nctx := ctxkey.With(ctx, scopeKey, &scope{ex: ex, node: n.Name})
+	if skip || (n.When != nil && !n.When(nctx)) {
+		return ex.finish(ctx, n.Name, NodeResult{Status: StatusSkipped}, nil)
+	}
+
+	res := NodeResult{StartedAt: time.Now()}
+	err := ex.call(nctx, n, &res.Attempts)
+	res.Duration = time.Since(res.StartedAt)
+	if err != nil {
+		res.Status, res.Error = StatusFailed, err.Error()
+	} else {
+		res.Status = StatusSucceeded
+	}
+	return ex.finish(ctx, n.Name, res, err)
+}
+
+// call 执行节点的 Run（按 Retry 重试，每次按 Timeout 计时），捕获 panic 转为 error，
+// 避免一个节点 panic 拖垮整个进程（节点 Run 是用户代码，且在 goroutine 中运行）。
+func (ex *execution) call(ctx context.Context, n Node, attempts *int) error {
+	if n.Run == nil {
+		*attempts = 1
+		return nil
+	}
+	var panicked any
+	attempt := func(ctx context.Context) (err error) {
+		*attempts++
+		if n.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+			defer cancel()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				panicked = r
+				err = fmt.Errorf("panicked: %v", r)
+			}
+		}()
+		panicked = nil
+		return n.Run(ctx)
+	}
+	var err error
+	if n.Retry != nil {
+		err = n.Retry.Retry(ctx, attempt)
+	} else {
+		err = attempt(ctx)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case panicked != nil:
+		return fmt.Errorf("dag node %q panicked: %v", n.Name, panicked)
+	default:
+		return fmt.Errorf("dag node %q: %w", n.Name, err)
+	}
+}
+
+// finish 记录节点结果、保存 checkpoint 并触发回调。返回节点错误与 checkpoint 错误的合并。
+func (ex *execution) finish(ctx context.Context, name string, res NodeResult, nodeErr error) error {
+	ex.mu.Lock()
+	if out, ok := ex.outputs[name]; ok && res.Status == StatusSucceeded && ex.d.checkpoints != nil && ex.runID != "" {
+		if data, err := json.Marshal(out); err != nil {
+			nodeErr = fmt.Errorf("dag node %q: encode output: %w", name, err)
+			res.Status, res.Error = StatusFailed, nodeErr.Error()
+		} else {
+			res.Output = data
+		}
+	}
+	ex.results[name] = res
+	var saveErr error
+	if ex.d.checkpoints != nil && ex.runID != "" {
+		cp := &Checkpoint{RunID: ex.runID, Nodes: make(map[string]NodeResult, len(ex.results)), UpdatedAt: time.Now()}
+		for k, v := range ex.results {
+			if v.Status != StatusPending {
+				cp.Nodes[k] = v
+			}
+		}
+		// 在锁内保存，保证 checkpoint 按完成顺序单调更新
+		if err := ex.d.checkpoints.Save(ctx, cp); err != nil {
+			saveErr = fmt.Errorf("dag: save checkpoint %q: %w", ex.runID, err)
+		}
+	}
+	ex.mu.Unlock()
+	if ex.d.onNodeDone != nil {
+		ex.d.onNodeDone(name, res)
+	}
+	return errors.Join(nodeErr, saveErr)
+}
+
+// Output 把当前节点的输出设为 v，供子节点用 Input 读取。只能在节点的 Run / When 中调用，
+// 重试时以最后一次调用为准。配置 checkpoint 时 v 须可 JSON 序列化。
+func Output(ctx context.Context, v any) {
+	sc, ok := ctxkey.Get(ctx, scopeKey)
+	if !ok {
+		return
+	}
+	sc.ex.mu.Lock()
+	sc.ex.outputs[sc.node] = v
+	sc.ex.mu.Unlock()
+}
+
+// Produce 把返回值式的函数包装成 Node.Run：成功时自动 Output 返回值。
+//
+//	dag.Node{Name: "extract", Run: dag.Produce(func(ctx context.Context) ([]Row, error) { ... })}
+func Produce[O any](fn func(ctx context.Context) (O, error)) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		Output(ctx, v)
+		return nil
+	}
+}
+
+// Input 读取节点 name（通常是当前节点的依赖）的输出并转为 T。输出来自 checkpoint 时
+// 从 JSON 解码。不存在返回 ErrNoOutput；类型不符返回错误。
+func Input[T any](ctx context.Context, name string) (T, error) {
+	var zero T
+	sc, ok := ctxkey.Get(ctx, scopeKey)
+	if !ok {
+		return zero, ErrNoOutput
+	}
+	sc.ex.mu.Lock()
+	v, ok := sc.ex.outputs[name]
+	sc.ex.mu.Unlock()
+	if !ok {
+		return zero, fmt.Errorf("%w: %q", ErrNoOutput, name)
+	}
+	switch x := v.(type) {
+	case T:
+		return x, nil
+	case json.RawMessage:
+		var out T
+		if err := json.Unmarshal(x, &out); err != nil {
+			return zero, fmt.Errorf("dag: decode output of %q: %w", name, err)
+		}
+		return out, nil
+	default:
+		return zero, fmt.Errorf("dag: output of %q is %T, not %T", name, v, zero)
+	}
+}
@@ -0,0 +1,150 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
+)
+
+func TestExecute_RetryAndTimeout(t *testing.T) {
+	var calls atomic.Int32
+	d := New().Add(
+		Node{
+			Name:  "flaky",
+			Retry: backoff.New(backoff.WithBase(time.Millisecond), backoff.WithMaxRetries(3)),
+			Run: func(context.Context) error {
+				if calls.Add(1) < 3 {
+					return errors.New("transient")
+				}
+				return nil
+			},
+		},
+		Node{
+			Name:    "slow",
+			Timeout: 20 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+	)
+	r, err := d.Execute(context.Background(), "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want timeout error, got %v", err)
+	}
+	if res := r.Nodes["flaky"]; res.Status != StatusSucceeded || res.Attempts != 3 {
+		t.Errorf("flaky = %+v, want succeeded after 3 attempts", res)
+	}
+	if res := r.Nodes["slow"]; res.Status != StatusFailed || res.Duration < 20*time.Millisecond {
+		t.Errorf("slow = %+v, want failed after timeout", res)
+	}
+	if got := r.Failed(); len(got) != 1 || got[0] != "slow" {
+		t.Errorf("Failed() = %v", got)
+	}
+}
+
+func TestExecute_OutputsAndConditionalSkip(t *testing.T) {
+	var loaded []int
+	d := New().Add(
+		Node{Name: "extract", Run: Produce(func(context.Context) ([]int, error) { return []int{1, 2, 3}, nil })},
+		Node{Name: "load", DependsOn: []string{"extract"}, Run: func(ctx context.Context) error {
+			rows, err := Input[[]int](ctx, "extract")
+			loaded = rows
+			return err
+		}},
+		Node{
+			Name:      "backfill",
+			DependsOn: []string{"extract"},
+			When: func(ctx context.Context) bool {
+				rows, _ := Input[[]int](ctx, "extract")
+				return len(rows) > 100
+			},
+			Run: func(context.Context) error { t.Error("backfill must be skipped"); return nil },
+		},
+		Node{Name: "reindex", DependsOn: []string{"backfill"}, Run: func(context.Context) error {
+			t.Error("subtree of a skipped node must be skipped")
+			return nil
+		}},
+	)
+	r, err := d.Execute(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 3 {
+		t.Errorf("load got %v", loaded)
+	}
+	if r.Nodes["backfill"].Status != StatusSkipped || r.Nodes["reindex"].Status != StatusSkipped {
+		t.Errorf("statuses: backfill=%s reindex=%s", r.Nodes["backfill"].Status, r.Nodes["reindex"].Status)
+	}
+}
+
+func TestExecute_ResumeFromCheckpoint(t *testing.T) {
+	var extractRuns, transformRuns atomic.Int32
+	var fail atomic.Bool
+	fail.Store(true)
+	var got atomic.Value
+	d := New(WithCheckpoint(NewMemoryCheckpoints())).Add(
+		Node{Name: "extract", Run: Produce(func(context.Context) (map[string]int, error) {
+			extractRuns.Add(1)
+			return map[string]int{"rows": 42}, nil
+		})},
+		Node{Name: "transform", DependsOn: []string{"extract"}, Run: func(ctx context.Context) error {
+			transformRuns.Add(1)
+			if fail.Load() {
+				return errors.New("disk full")
+			}
+			in, err := Input[map[string]int](ctx, "extract") // 续跑时来自 checkpoint 的 JSON
+			got.Store(in["rows"])
+			return err
+		}},
+	)
+
+	r, err := d.Execute(context.Background(), "run-1")
+	if err == nil || r.Nodes["transform"].Status != StatusFailed {
+		t.Fatalf("first run should fail at transform: %v", err)
+	}
+	fail.Store(false)
+	r, err = d.Execute(context.Background(), "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := extractRuns.Load(); n != 1 {
+		t.Errorf("extract ran %d times, want 1 (resumed)", n)
+	}
+	if n := transformRuns.Load(); n != 2 {
+		t.Errorf("transform ran %d times, want 2", n)
+	}
+	if !r.Nodes["extract"].Resumed || got.Load() != 42 {
+		t.Errorf("extract resumed=%v, transform input=%v", r.Nodes["extract"].Resumed, got.Load())
+	}
+}
+
+func TestExport(t *testing.T) {
+	d := New().Add(
+		Node{Name: "a"},
+		Node{Name: "b", DependsOn: []string{"a"}, Run: func(context.Context) error { return errors.New("x") }},
+		Node{Name: "c", DependsOn: []string{"a"}, When: func(context.Context) bool { return true }},
+	)
+	r, _ := d.Execute(context.Background(), "")
+
+	dot := d.DOT(r)
+	for _, want := range []string{`"a" -> "b";`, `"a" -> "c" [style=dashed];`, `fillcolor="#ffcdd2"`, `"b" [label="b\nfailed`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT missing %q:\n%s", want, dot)
+		}
+	}
+	mm := d.Mermaid(r)
+	for _, want := range []string{"flowchart LR", "n0 --> n1", "n0 -.-> n2", "class n1 failed"} {
+		if !strings.Contains(mm, want) {
+			t.Errorf("Mermaid missing %q:\n%s", want, mm)
+		}
+	}
+	if plain := d.DOT(nil); strings.Contains(plain, "#c8e6c9") {
+		t.Errorf("DOT without report should not be colored:\n%s", plain)
+	}
+}
@@ -0,0 +1,104 @@
+package dag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 各状态的填充色（DOT 与 Mermaid 共用）。
+var statusColors = map[Status]string{
+	StatusPending:   "#eeeeee",
+	StatusSucceeded: "#c8e6c9",
+	StatusFailed:    "#ffcdd2",
+	StatusSkipped:   "#fff9c4",
+}
+
+// DOT 导出 Graphviz DOT 描述（dot -Tsvg 渲染）。r 非 nil 时按节点状态着色并在标签上附耗时，
+// 有 When 的节点入边画成虚线。
+func (d *DAG) DOT(r *Report) string {
+	var b strings.Builder
+	b.WriteString("digraph dag {\n\trankdir=LR;\n\tnode [shape=box, style=\"rounded,filled\", fillcolor=\"white\"];\n")
+	for _, n := range d.nodes {
+		label, color := nodeLabel(n.Name, r, "\n")
+		fmt.Fprintf(&b, "\t%s [label=%s", dotQuote(n.Name), dotQuote(label))
+		if color != "" {
+			fmt.Fprintf(&b, ", fillcolor=%q", color)
+		}
+		b.WriteString("];\n")
+	}
+	for _, n := range d.nodes {
+		for _, dep := range n.DependsOn {
+			fmt.Fprintf(&b, "\t%s -> %s", dotQuote(dep), dotQuote(n.Name))
+			if n.When != nil {
+				b.WriteString(" [style=dashed]")
+			}
+			b.WriteString(";\n")
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotReplacer 按 DOT 字符串规则转义：只有 \ 与 " 需要转义，换行写成 DOT 的居中换行 \n。
+// 不用 strconv.Quote：它的 Go 转义（\u00d7 等）DOT 不认识。
+var dotReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string { return `"` + dotReplacer.Replace(s) + `"` }
+
+// Mermaid 导出 Mermaid flowchart 描述（可直接嵌入 Markdown）。着色规则同 DOT。
+func (d *DAG) Mermaid(r *Report) string {
+	id := make(map[string]string, len(d.nodes))
+	for i, n := range d.nodes {
+		id[n.Name] = "n" + strconv.Itoa(i)
+	}
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range d.nodes {
+		label, _ := nodeLabel(n.Name, r, "<br/>")
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", id[n.Name], strings.ReplaceAll(label, `"`, "#quot;"))
+	}
+	for _, n := range d.nodes {
+		arrow := "-->"
+		if n.When != nil {
+			arrow = "-.->"
+		}
+		for _, dep := range n.DependsOn {
+			fmt.Fprintf(&b, "\t%s %s %s\n", id[dep], arrow, id[n.Name])
+		}
+	}
+	if r != nil {
+		for _, st := range []Status{StatusPending, StatusSucceeded, StatusFailed, StatusSkipped} {
+			var members []string
+			for _, n := range d.nodes {
+				if res, ok := r.Nodes[n.Name]; ok && res.Status == st {
+					members = append(members, id[n.Name])
+				}
+			}
+			if len(members) > 0 {
+				fmt.Fprintf(&b, "\tclassDef %s fill:%s\n\tclass %s %s\n", st, statusColors[st], strings.Join(members, ","), st)
+			}
+		}
+	}
+	return b.String()
+}
+
+// nodeLabel 返回节点标签（有报告时附状态与耗时）与填充色。
+func nodeLabel(name string, r *Report, br string) (label, color string) {
+	if r == nil {
+		return name, ""
+	}
+	res, ok := r.Nodes[name]
+	if !ok {
+		return name, ""
+	}
+	label = name + br + string(res.Status)
+	if res.Duration > 0 {
+		label += " " + res.Duration.Round(time.Millisecond).String()
+	}
+	if res.Attempts > 1 {
+		label += fmt.Sprintf(" ×%d", res.Attempts)
+	}
+	return label, statusColors[res.Status]
+}
@@ -0,0 +1,168 @@
+package overloadctrl
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rushteam/beauty/pkg/api/metadata"
+	grpcmd "google.golang.org/grpc/metadata"
+)
+
+// Criticality 是请求优先级。过载时 AdaptiveController 从低到高卸载:
+// BestEffort 最先被拒,Critical 不受延迟梯度卸载且可使用预留容量。
+// 零值为 CriticalityDefault。
+type Criticality int
+
+const (
+	CriticalityBestEffort Criticality = -2 // 可随时丢弃(预取、统计上报)
+	CriticalitySheddable  Criticality = -1 // 可容忍失败(推荐、非关键读)
+	CriticalityDefault    Criticality = 0  // 未声明时的级别
+	CriticalityCritical   Criticality = 1  // 核心链路(下单、支付),最后卸载
+)
+
+// HeaderCriticality 是携带优先级的 HTTP 头,与 metadata.KeyCriticality 对应。
+const HeaderCriticality = "X-Criticality"
+
+func (c Criticality) String() string {
+	switch c {
+	case CriticalityBestEffort:
+		return "best_effort"
+	case CriticalitySheddable:
+		return "sheddable"
+	case CriticalityCritical:
+		return "critical"
+	}
+	return "default"
+}
+
+// ParseCriticality 解析优先级名(大小写不敏感,"-" 与 "_" 等价);无法识别时返回 false。
+func ParseCriticality(s string) (Criticality, bool) {
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "-", "_") {
+	case "best_effort":
+		return CriticalityBestEffort, true
+	case "sheddable":
+		return CriticalitySheddable, true
+	case "default":
+		return CriticalityDefault, true
+	case "critical":
+		return CriticalityCritical, true
+	}
+	return CriticalityDefault, false
+}
+
+// WithCriticality 把优先级写入 ctx 的 api/metadata,经 metadata/propagation 随下游调用透传。
+func WithCriticality(ctx context.Context, c Criticality) context.Context {
+	return metadata.NewContext(ctx, metadata.MD{metadata.KeyCriticality: c.String()})
+}
+
+// CriticalityFromContext 返回 ctx 中的优先级,未声明时为 CriticalityDefault。
+func CriticalityFromContext(ctx context.Context) Criticality {
+	c, _ := criticalityOf(ctx)
+	return c
+}
+
+func criticalityOf(ctx context.Context) (Criticality, bool) {
+	return ParseCriticality(metadata.FromContext(ctx).Get(metadata.KeyCriticality))
+}
+
+// ServerOption 配置服务端中间件/拦截器如何认定入站请求的优先级。
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	trustHTTP func(*http.Request) bool
+	trustGRPC func(context.Context) bool
+}
+
+func newServerConfig(opts []ServerOption) serverConfig {
+	var cfg serverConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return cfg
+}
+
+// WithTrustedHTTPUpstream 仅当 fn 返回 true(内网来源、mTLS 对端等)时采信入站的 X-Criticality 头
+// 与已提取进 ctx 的 x-criticality。默认一律不采信:外部调用方带 "X-Criticality: critical" 也不能自抬优先级。
+func WithTrustedHTTPUpstream(fn func(*http.Request) bool) ServerOption {
+	return func(c *serverConfig) { c.trustHTTP = fn }
+}
+
+// WithTrustedGRPCUpstream 同 WithTrustedHTTPUpstream,用于 gRPC 拦截器;fn 收到 incoming ctx,
+// 可经 peer.FromContext / credentials 判定来源。
+func WithTrustedGRPCUpstream(fn func(context.Context) bool) ServerOption {
+	return func(c *serverConfig) { c.trustGRPC = fn }
+}
+
+// declaredKey 标记 ctx 中的优先级由本服务声明(路由/服务端),不是入站请求带来的。
+type declaredKey struct{}
+
+func declare(ctx context.Context, c Criticality) context.Context {
+	return context.WithValue(WithCriticality(ctx, c), declaredKey{}, true)
+}
+
+func declared(ctx context.Context) bool { return ctx.Value(declaredKey{}) != nil }
+
+// untrusted 丢弃入站带来的优先级:metadata 里已有(propagation 提取)时改写为 Default,下游不会继续透传客户端的值。
+func untrusted(ctx context.Context) context.Context {
+	if c, ok := criticalityOf(ctx); ok && c != CriticalityDefault {
+		return WithCriticality(ctx, CriticalityDefault)
+	}
+	return ctx
+}
+
+// inboundHTTP 认定请求的优先级:本服务已声明的为准;上游可信时取 ctx 或 X-Criticality 头;
+// 否则丢弃入站值。
+func inboundHTTP(r *http.Request, cfg serverConfig) context.Context {
+	ctx := r.Context()
+	if declared(ctx) {
+		return ctx
+	}
+	if cfg.trustHTTP == nil || !cfg.trustHTTP(r) {
+		return untrusted(ctx)
+	}
+	if _, ok := criticalityOf(ctx); ok {
+		return ctx
+	}
+	if c, ok := ParseCriticality(r.Header.Get(HeaderCriticality)); ok {
+		return WithCriticality(ctx, c)
+	}
+	return ctx
+}
+
+// inboundGRPC 同 inboundHTTP,读取 incoming metadata。
+func inboundGRPC(ctx context.Context, cfg serverConfig) context.Context {
+	if declared(ctx) {
+		return ctx
+	}
+	if cfg.trustGRPC == nil || !cfg.trustGRPC(ctx) {
+		return untrusted(ctx)
+	}
+	if _, ok := criticalityOf(ctx); ok {
+		return ctx
+	}
+	if vs := grpcmd.ValueFromIncomingContext(ctx, metadata.KeyCriticality); len(vs) > 0 {
+		if c, ok := ParseCriticality(vs[0]); ok {
+			return WithCriticality(ctx, c)
+		}
+	}
+	return ctx
+}
+
+// CriticalityMiddleware 按路由声明把请求优先级设为 c,入站的 X-Criticality 头或 metadata 默认被忽略,
+// 外部调用方无法越过路由声明。内部服务间需要整条调用链同级时,用 WithTrustedHTTPUpstream
+// 指定可信上游,其透传的优先级优先于 c。
+func CriticalityMiddleware(c Criticality, opts ...ServerOption) func(http.Handler) http.Handler {
+	cfg := newServerConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			crit := c
+			if cfg.trustHTTP != nil && cfg.trustHTTP(r) {
+				if up, ok := criticalityOf(inboundHTTP(r, cfg)); ok {
+					crit = up
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(declare(r.Context(), crit)))
+		})
+	}
+}
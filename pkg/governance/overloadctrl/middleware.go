@@ -0,0 +1,143 @@
+package overloadctrl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServerAddr 是服务端中间件 Acquire 使用的 key:同一 controller 挂在 HTTP 与 gRPC 上时共享一份负载画像。
+const ServerAddr = "server"
+
+// errServerFault 反馈给 controller 的服务端故障(5xx / 服务端类 gRPC 码)。
+var errServerFault = errors.New("overloadctrl: server fault")
+
+// HTTPMiddleware 返回按优先级卸载的 HTTP 中间件。优先级取自 CriticalityMiddleware 的路由声明;
+// 未声明时只采信 WithTrustedHTTPUpstream 认可的上游所带的 X-Criticality,其余按 Default 处理。
+// 被拒时返回 503 + Retry-After,响应体附 RetryInfo。5xx 响应计为错误反馈。
+func HTTPMiddleware(c OverloadController, opts ...ServerOption) func(http.Handler) http.Handler {
+	cfg := newServerConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := inboundHTTP(r, cfg)
+			tok, err := c.Acquire(ctx, ServerAddr)
+			if err != nil {
+				st := shedStatus(ctx, err)
+				if d := retryDelay(err); d > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+				}
+				perr.WriteHTTPContext(perr.WithRequestLocales(r), w, st)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			defer func() {
+				var err error
+				if sw.code >= 500 {
+					err = errServerFault
+				}
+				tok.OnResponse(ctx, err)
+			}()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+		})
+	}
+}
+
+// UnaryServerInterceptor 返回按优先级卸载的 gRPC unary 拦截器。incoming metadata 的 x-criticality
+// 只在 WithTrustedGRPCUpstream 认可时采信,否则按 Default 处理。
+// 被拒时返回 Unavailable + RetryInfo;只有服务端类错误码计为错误反馈,业务错误(NotFound 等)不计。
+func UnaryServerInterceptor(c OverloadController, opts ...ServerOption) grpc.UnaryServerInterceptor {
+	cfg := newServerConfig(opts)
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = inboundGRPC(ctx, cfg)
+		tok, err := c.Acquire(ctx, ServerAddr)
+		if err != nil {
+			return nil, perr.ToGRPCContext(ctx, shedStatus(ctx, err))
+		}
+		resp, err := handler(ctx, req)
+		tok.OnResponse(ctx, serverFault(err))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 返回 stream 版本,整条流占一个在途名额。
+func StreamServerInterceptor(c OverloadController, opts ...ServerOption) grpc.StreamServerInterceptor {
+	cfg := newServerConfig(opts)
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := inboundGRPC(ss.Context(), cfg)
+		tok, err := c.Acquire(ctx, ServerAddr)
+		if err != nil {
+			return perr.ToGRPCContext(ctx, shedStatus(ctx, err))
+		}
+		err = handler(srv, &ctxStream{ServerStream: ss, ctx: ctx})
+		tok.OnResponse(ctx, serverFault(err))
+		return err
+	}
+}
+
+// shedStatus 把拒绝错误转为 503,附 RetryInfo 与 ErrorInfo(Reason=OVERLOADED,metadata 带优先级)。
+func shedStatus(ctx context.Context, err error) *perr.Status {
+	st := perr.Unavailable("server overloaded").WithCause(err)
+	if d := retryDelay(err); d > 0 {
+		st = st.WithDetail(&perr.RetryInfo{RetryDelay: d})
+	}
+	return st.WithDetail(&perr.ErrorInfo{
+		Reason:   "OVERLOADED",
+		Domain:   "overloadctrl",
+		Metadata: map[string]string{"criticality": CriticalityFromContext(ctx).String()},
+	})
+}
+
+func retryDelay(err error) time.Duration {
+	var oe *OverloadError
+	if errors.As(err, &oe) {
+		return oe.RetryAfter
+	}
+	return 0
+}
+
+// serverFault 只把服务端故障类错误反馈给 controller。
+func serverFault(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := perr.FromError(err); ok {
+		if st.Code() >= 500 && st.Code() != perr.CodeUnimplemented {
+			return err
+		}
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return err
+	}
+	return nil
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+type ctxStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *ctxStream) Context() context.Context { return s.ctx }
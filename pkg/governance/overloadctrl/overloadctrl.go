@@ -15,11 +15,23 @@
 // 恢复:延迟梯度触发的拒绝会随在途请求自然排空(inFlight 降到 minInflight 以下)自动放开;
 // 连续错误触发的锁定态则每隔 errRecovInterval(默认 5s)放行一个探测请求,探测成功解锁、
 // 失败续锁——确保节点不会因连续错误被永久拒绝。
+//
+// 优先级:请求经 ctx(api/metadata 的 x-criticality,见 WithCriticality)携带 Criticality,
+// 过载时从低到高卸载——BestEffort / Sheddable 在延迟升到 rttMultiple 的 0.6 / 0.8 倍(WithShedFactors)
+// 时就被拒,Default 维持原阈值,Critical 不受延迟梯度卸载;WithMaxInflight 设定硬上限时,
+// 最后 WithCriticalReserve 比例的容量只留给 Critical。拒绝返回 *OverloadError(errors.Is
+// ErrOverloaded),RetryAfter 按级别给出退避建议,级别越低越长。
+//
+// 服务端:HTTPMiddleware / UnaryServerInterceptor / StreamServerInterceptor 以 ServerAddr 为 key
+// 接入同一个 controller,拒绝时返回带 RetryInfo 的 503 / Unavailable。入站请求自带的 X-Criticality
+// 头 / x-criticality metadata 默认不采信(否则任何调用方都能自称 Critical 绕过卸载),以路由声明
+// (CriticalityMiddleware)为准;内部链路用 WithTrustedHTTPUpstream / WithTrustedGRPCUpstream 放行可信上游。
 package overloadctrl
 
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -29,6 +41,20 @@ import (
 // ErrOverloaded 节点过载,请求被拒绝。
 var ErrOverloaded = errors.New("overload controller rejected: node overloaded")
 
+// OverloadError 是 AdaptiveController 拒绝请求时返回的错误,errors.Is(err, ErrOverloaded) 为 true。
+type OverloadError struct {
+	Addr        string
+	Criticality Criticality   // 被拒请求的优先级
+	RetryAfter  time.Duration // 建议的重试等待
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("%s (addr=%s, criticality=%s)", ErrOverloaded, e.Addr, e.Criticality)
+}
+
+// Is 使 errors.Is(err, ErrOverloaded) 成立。
+func (e *OverloadError) Is(target error) bool { return target == ErrOverloaded }
+
 // OverloadController 自适应限流器接口。
 type OverloadController interface {
 	Acquire(ctx context.Context, addr string) (Token, error)
@@ -60,8 +86,9 @@ type addrState struct {
 	inFlight int // 当前在途请求数
 	// 错误追踪
 	consecutiveErrors uint32
-	errLockedAt       time.Time // 连续错误达阈值、进入锁定态的时刻(用于冷却放行探测)
-	errProbeInflight  bool      // 锁定态是否已放行一个探测请求
+	shed              [numCriticality]uint64 // 按优先级的拒绝计数
+	errLockedAt       time.Time              // 连续错误达阈值、进入锁定态的时刻(用于冷却放行探测)
+	errProbeInflight  bool                   // 锁定态是否已放行一个探测请求
 	// 配置快照(从 controller 复制,避免热路径读 controller 锁)
 	minInflight      int
 	rttMultiple      float64
@@ -72,11 +99,15 @@ type addrState struct {
 
 // config 配置(不导出,通过 Option 设置)。
 type config struct {
-	rttMultiple      float64       // 延迟梯度阈值:lastRTT > rttMultiple*minRTT 视为过载
-	minInflight      int           // inFlight 低于此值不触发(避免低负载误判)
-	rttWindow        int           // minRTT 采样窗口大小
-	errThreshold     uint32        // 连续错误达此值也拒绝(独立于延迟)
-	errRecovInterval time.Duration // 错误锁定后每隔多久放行一个探测请求(默认 5s)
+	rttMultiple      float64                 // 延迟梯度阈值:lastRTT > rttMultiple*minRTT 视为过载
+	minInflight      int                     // inFlight 低于此值不触发(避免低负载误判)
+	rttWindow        int                     // minRTT 采样窗口大小
+	errThreshold     uint32                  // 连续错误达此值也拒绝(独立于延迟)
+	errRecovInterval time.Duration           // 错误锁定后每隔多久放行一个探测请求(默认 5s)
+	shedFactors      [numCriticality]float64 // 各优先级的延迟梯度阈值系数(乘 rttMultiple),0 表示不按梯度卸载
+	maxInflight      int                     // 在途硬上限(0 不限)
+	criticalReserve  float64                 // 硬上限中只留给 Critical 的比例
+	retryAfter       time.Duration           // 退避建议的基数
 	onDrop           func(addr string)
 }
 
@@ -103,6 +134,26 @@ func WithErrorRecoveryInterval(d time.Duration) Option {
 	return func(c *config) { c.errRecovInterval = d }
 }
 
+// WithShedFactors 设置 BestEffort / Sheddable 的卸载阈值系数(默认 0.6 / 0.8):
+// lastRTT 超过 系数*rttMultiple*minRTT 即拒绝该级请求。Default 固定为 1,Critical 不按延迟梯度卸载。
+func WithShedFactors(bestEffort, sheddable float64) Option {
+	return func(c *config) {
+		c.shedFactors[CriticalityBestEffort-minCriticality] = bestEffort
+		c.shedFactors[CriticalitySheddable-minCriticality] = sheddable
+	}
+}
+
+// WithMaxInflight 设置每个 addr 的在途请求硬上限(默认 0 不限),达到后拒绝,不论延迟。
+func WithMaxInflight(n int) Option { return func(c *config) { c.maxInflight = n } }
+
+// WithCriticalReserve 设置硬上限中只留给 Critical 的比例(默认 0.1):非 Critical 请求在
+// inFlight 达到 (1-reserve)*maxInflight 时即被拒。未设置 WithMaxInflight 时无效。
+func WithCriticalReserve(f float64) Option { return func(c *config) { c.criticalReserve = f } }
+
+// WithRetryAfter 设置拒绝时退避建议的基数(默认 1s):Critical 为基数,每低一级翻倍;
+// 错误锁定态下不短于距下次探测的剩余时间。
+func WithRetryAfter(d time.Duration) Option { return func(c *config) { c.retryAfter = d } }
+
 // WithOnDrop 设置请求被拒时的回调(打 metric/日志用)。
 func WithOnDrop(fn func(addr string)) Option { return func(c *config) { c.onDrop = fn } }
 
@@ -121,6 +172,9 @@ func NewAdaptiveController(opts ...Option) *AdaptiveController {
 		rttWindow:        20,
 		errThreshold:     5,
 		errRecovInterval: 5 * time.Second,
+		shedFactors:      [numCriticality]float64{0.6, 0.8, 1, 0},
+		criticalReserve:  0.1,
+		retryAfter:       time.Second,
 	}
 	for _, o := range opts {
 		o(&cfg)
@@ -153,8 +207,10 @@ func (c *AdaptiveController) getOrCreate(addr string) *addrState {
 	return s
 }
 
-// Acquire 判断 addr 是否可放行。过载(延迟梯度超阈 + inFlight 足够)或连续错误超阈时拒绝。
-func (c *AdaptiveController) Acquire(_ context.Context, addr string) (Token, error) {
+// Acquire 判断 addr 是否可放行,按 ctx 中的优先级(CriticalityFromContext)决定卸载顺序。
+// 依次检查:连续错误锁定 → 在途硬上限(含 Critical 预留)→ 延迟梯度(按级别系数)。
+func (c *AdaptiveController) Acquire(ctx context.Context, addr string) (Token, error) {
+	crit := clampCriticality(CriticalityFromContext(ctx))
 	s := c.getOrCreate(addr)
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -168,25 +224,53 @@ func (c *AdaptiveController) Acquire(_ context.Context, addr string) (Token, err
 			!s.errLockedAt.IsZero() &&
 			time.Since(s.errLockedAt) >= s.errRecovInterval
 		if !canProbe {
-			c.fireOnDrop(addr)
-			return nil, ErrOverloaded
+			var wait time.Duration
+			if !s.errLockedAt.IsZero() {
+				wait = s.errRecovInterval - time.Since(s.errLockedAt)
+			}
+			return nil, c.reject(s, addr, crit, wait)
 		}
 		// 放行一个探测请求
 		s.errProbeInflight = true
 		s.inFlight++
 		return &adaptiveToken{controller: c, addr: addr, start: time.Now()}, nil
 	}
-	// 延迟梯度:有 minRTT 基线 + lastRTT 飙升 + 在途请求足够多时拒绝
-	if s.minRTT > 0 && s.inFlight >= s.minInflight {
-		if s.lastRTT > time.Duration(s.rttMultiple*float64(s.minRTT)) {
-			c.fireOnDrop(addr)
-			return nil, ErrOverloaded
+	// 硬上限:最后 criticalReserve 比例的名额只给 Critical
+	if limit := c.cfg.maxInflight; limit > 0 {
+		if crit < CriticalityCritical {
+			limit -= int(float64(limit) * c.cfg.criticalReserve)
+		}
+		if s.inFlight >= limit {
+			return nil, c.reject(s, addr, crit, 0)
+		}
+	}
+	// 延迟梯度:有 minRTT 基线 + lastRTT 飙升 + 在途请求足够多时,按级别系数拒绝
+	if f := c.cfg.shedFactors[crit-minCriticality]; f > 0 && s.minRTT > 0 && s.inFlight >= s.minInflight {
+		if s.lastRTT > time.Duration(f*s.rttMultiple*float64(s.minRTT)) {
+			return nil, c.reject(s, addr, crit, 0)
 		}
 	}
 	s.inFlight++
 	return &adaptiveToken{controller: c, addr: addr, start: time.Now()}, nil
 }
 
+// reject 记录拒绝并构造 OverloadError;调用方持有 s.mu。
+func (c *AdaptiveController) reject(s *addrState, addr string, crit Criticality, minWait time.Duration) error {
+	s.shed[crit-minCriticality]++
+	c.fireOnDrop(addr)
+	wait := c.cfg.retryAfter << (CriticalityCritical - crit)
+	return &OverloadError{Addr: addr, Criticality: crit, RetryAfter: max(wait, minWait)}
+}
+
+const (
+	minCriticality = CriticalityBestEffort
+	numCriticality = int(CriticalityCritical-CriticalityBestEffort) + 1
+)
+
+func clampCriticality(c Criticality) Criticality {
+	return min(max(c, CriticalityBestEffort), CriticalityCritical)
+}
+
 func (c *AdaptiveController) fireOnDrop(addr string) {
 	if c.cfg.onDrop != nil {
 		func() {
@@ -260,11 +344,12 @@ func (t *adaptiveToken) OnResponse(_ context.Context, err error) {
 
 // OverloadStats 单个 addr 的负载画像快照。
 type OverloadStats struct {
-	Addr              string        `json:"addr"`
-	InFlight          int           `json:"in_flight"`
-	MinRTT            time.Duration `json:"min_rtt"`
-	LastRTT           time.Duration `json:"last_rtt"`
-	ConsecutiveErrors uint32        `json:"consecutive_errors"`
+	Addr              string            `json:"addr"`
+	InFlight          int               `json:"in_flight"`
+	MinRTT            time.Duration     `json:"min_rtt"`
+	LastRTT           time.Duration     `json:"last_rtt"`
+	ConsecutiveErrors uint32            `json:"consecutive_errors"`
+	Shed              map[string]uint64 `json:"shed,omitempty"` // 按优先级的累计拒绝数
 }
 
 // Stats 返回所有 addr 的状态快照。
@@ -274,13 +359,22 @@ func (c *AdaptiveController) Stats() map[string]OverloadStats {
 	out := make(map[string]OverloadStats, len(c.states))
 	for addr, s := range c.states {
 		s.mu.Lock()
-		out[addr] = OverloadStats{
+		st := OverloadStats{
 			Addr:              addr,
 			InFlight:          s.inFlight,
 			MinRTT:            s.minRTT,
 			LastRTT:           s.lastRTT,
 			ConsecutiveErrors: s.consecutiveErrors,
 		}
+		for i, n := range s.shed {
+			if n > 0 {
+				if st.Shed == nil {
+					st.Shed = make(map[string]uint64)
+				}
+				st.Shed[(Criticality(i) + minCriticality).String()] = n
+			}
+		}
+		out[addr] = st
 		s.mu.Unlock()
 	}
 	return out
@@ -296,6 +390,7 @@ func (c *AdaptiveController) Reset() {
 		s.minRTT = 0
 		s.lastRTT = 0
 		s.consecutiveErrors = 0
+		s.shed = [numCriticality]uint64{}
 		s.errLockedAt = time.Time{}
 		s.errProbeInflight = false
 		s.rttSamples = s.rttSamples[:0]
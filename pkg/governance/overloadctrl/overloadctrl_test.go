@@ -3,12 +3,20 @@ package overloadctrl_test
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/rushteam/beauty/pkg/api/metadata"
 	"github.com/rushteam/beauty/pkg/governance/overloadctrl"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestNoopController_AlwaysAcquire(t *testing.T) {
@@ -312,3 +320,209 @@ func TestAdaptiveController_ErrorLockoutProbeFailRelocks(t *testing.T) {
 		t.Fatal("should re-lock after failed probe")
 	}
 }
+
+func TestCriticality_ParseAndContext(t *testing.T) {
+	for in, want := range map[string]overloadctrl.Criticality{
+		"critical": overloadctrl.CriticalityCritical, "Best-Effort": overloadctrl.CriticalityBestEffort,
+		"sheddable": overloadctrl.CriticalitySheddable, "default": overloadctrl.CriticalityDefault,
+	} {
+		if got, ok := overloadctrl.ParseCriticality(in); !ok || got != want {
+			t.Errorf("Parse(%q) = %v, %v", in, got, ok)
+		}
+	}
+	if _, ok := overloadctrl.ParseCriticality("urgent"); ok {
+		t.Error("unknown class should not parse")
+	}
+	ctx := context.Background()
+	if overloadctrl.CriticalityFromContext(ctx) != overloadctrl.CriticalityDefault {
+		t.Error("zero value should be default")
+	}
+	ctx = overloadctrl.WithCriticality(ctx, overloadctrl.CriticalitySheddable)
+	if got := metadata.FromContext(ctx).Get(metadata.KeyCriticality); got != "sheddable" {
+		t.Errorf("metadata = %q", got)
+	}
+}
+
+func withCrit(c overloadctrl.Criticality) context.Context {
+	return overloadctrl.WithCriticality(context.Background(), c)
+}
+
+func TestAdaptiveController_CriticalReserve(t *testing.T) {
+	c := overloadctrl.NewAdaptiveController(
+		overloadctrl.WithMaxInflight(10),
+		overloadctrl.WithCriticalReserve(0.2),
+		overloadctrl.WithRetryAfter(100*time.Millisecond),
+	)
+	for i := range 8 {
+		if _, err := c.Acquire(context.Background(), "a"); err != nil {
+			t.Fatalf("default #%d rejected: %v", i, err)
+		}
+	}
+	_, err := c.Acquire(withCrit(overloadctrl.CriticalitySheddable), "a")
+	var oe *overloadctrl.OverloadError
+	if !errors.As(err, &oe) || !errors.Is(err, overloadctrl.ErrOverloaded) {
+		t.Fatalf("want OverloadError, got %v", err)
+	}
+	// 每低一级退避翻倍:Sheddable 比 Critical 低两级
+	if oe.Criticality != overloadctrl.CriticalitySheddable || oe.RetryAfter != 400*time.Millisecond {
+		t.Fatalf("error = %+v", oe)
+	}
+	for i := range 2 {
+		if _, err := c.Acquire(withCrit(overloadctrl.CriticalityCritical), "a"); err != nil {
+			t.Fatalf("critical #%d should use reserve: %v", i, err)
+		}
+	}
+	if _, err := c.Acquire(withCrit(overloadctrl.CriticalityCritical), "a"); err == nil {
+		t.Fatal("hard limit should apply to critical too")
+	}
+	st := c.Stats()["a"]
+	if st.Shed["sheddable"] != 1 || st.Shed["critical"] != 1 {
+		t.Fatalf("shed = %v", st.Shed)
+	}
+}
+
+func TestAdaptiveController_ShedsLowerClassesOnLatency(t *testing.T) {
+	c := overloadctrl.NewAdaptiveController(
+		overloadctrl.WithMinInflight(1),
+		overloadctrl.WithErrorThreshold(1000),
+	)
+	ctx := context.Background()
+	for range 5 {
+		tok, _ := c.Acquire(ctx, "a")
+		tok.OnResponse(ctx, nil) // 极短 RTT 作基线
+	}
+	tok, _ := c.Acquire(ctx, "a")
+	time.Sleep(5 * time.Millisecond)
+	tok.OnResponse(ctx, nil)                                              // lastRTT 远超基线
+	hold, _ := c.Acquire(withCrit(overloadctrl.CriticalityCritical), "a") // 凑够 minInflight
+	defer hold.OnResponse(ctx, nil)
+
+	for _, crit := range []overloadctrl.Criticality{overloadctrl.CriticalityBestEffort, overloadctrl.CriticalitySheddable, overloadctrl.CriticalityDefault} {
+		if _, err := c.Acquire(withCrit(crit), "a"); !errors.Is(err, overloadctrl.ErrOverloaded) {
+			t.Errorf("%s should be shed, got %v", crit, err)
+		}
+	}
+	if _, err := c.Acquire(withCrit(overloadctrl.CriticalityCritical), "a"); err != nil {
+		t.Errorf("critical should pass latency shedding: %v", err)
+	}
+}
+
+func TestHTTPMiddleware_Shed(t *testing.T) {
+	c := overloadctrl.NewAdaptiveController(overloadctrl.WithMaxInflight(10), overloadctrl.WithCriticalReserve(0.5))
+	release := make(chan struct{})
+	entered := make(chan struct{}, 5)
+	trusted := overloadctrl.WithTrustedHTTPUpstream(func(*http.Request) bool { return true })
+	h := overloadctrl.HTTPMiddleware(c, trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+		<-entered
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("default: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	req.Header.Set(overloadctrl.HeaderCriticality, "critical")
+	critDone := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		critDone <- rec.Code
+	}()
+	<-entered
+	close(release)
+	wg.Wait()
+	if code := <-critDone; code != http.StatusOK {
+		t.Fatalf("critical: status = %d", code)
+	}
+	if st := c.Stats()[overloadctrl.ServerAddr]; st.InFlight != 0 || st.Shed["default"] != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestUnaryServerInterceptor_Shed(t *testing.T) {
+	c := overloadctrl.NewAdaptiveController(overloadctrl.WithMaxInflight(1), overloadctrl.WithCriticalReserve(1))
+	ic := overloadctrl.UnaryServerInterceptor(c, overloadctrl.WithTrustedGRPCUpstream(func(context.Context) bool { return true }))
+	ctx := grpcmd.NewIncomingContext(context.Background(), grpcmd.Pairs(metadata.KeyCriticality, "best_effort"))
+	_, err := ic(ctx, nil, &grpc.UnaryServerInfo{}, func(context.Context, any) (any, error) { return nil, nil })
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("code = %v", st.Code())
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retry = ri
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() != 8*time.Second {
+		t.Fatalf("retry = %v", retry)
+	}
+
+	ctx = grpcmd.NewIncomingContext(context.Background(), grpcmd.Pairs(metadata.KeyCriticality, "critical"))
+	var seen overloadctrl.Criticality
+	if _, err := ic(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+		seen = overloadctrl.CriticalityFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "x")
+	}); status.Code(err) != codes.NotFound {
+		t.Fatal(err)
+	}
+	if seen != overloadctrl.CriticalityCritical {
+		t.Fatalf("criticality in handler ctx = %v", seen)
+	}
+	if c.Stats()[overloadctrl.ServerAddr].ConsecutiveErrors != 0 {
+		t.Fatal("business errors should not count as server faults")
+	}
+}
+
+func TestCriticality_UntrustedInboundIgnored(t *testing.T) {
+	c := overloadctrl.NewAdaptiveController(overloadctrl.WithMaxInflight(1), overloadctrl.WithCriticalReserve(1))
+	var seen overloadctrl.Criticality
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = overloadctrl.CriticalityFromContext(r.Context())
+	})
+	serve := func(h http.Handler, ctx context.Context) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		req.Header.Set(overloadctrl.HeaderCriticality, "critical")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// propagation.HTTPServerMiddleware 已把客户端的值提取进 ctx 的情形
+	spoofed := metadata.NewContext(context.Background(), metadata.MD{metadata.KeyCriticality: "critical"})
+
+	// 无路由声明:客户端自称 Critical 按 Default 处理,被预留容量拒绝
+	if code := serve(overloadctrl.HTTPMiddleware(c)(next), spoofed); code != http.StatusServiceUnavailable {
+		t.Fatalf("untrusted header: status = %d", code)
+	}
+	// 路由声明 Sheddable:头与 ctx 中的 critical 都不能抬高
+	h := overloadctrl.CriticalityMiddleware(overloadctrl.CriticalitySheddable)(overloadctrl.HTTPMiddleware(c)(next))
+	if code := serve(h, spoofed); code != http.StatusServiceUnavailable {
+		t.Fatalf("declared sheddable: status = %d", code)
+	}
+	// 可信上游透传的优先级生效
+	trusted := overloadctrl.WithTrustedHTTPUpstream(func(r *http.Request) bool { return r.RemoteAddr == "192.0.2.1:1234" })
+	h = overloadctrl.CriticalityMiddleware(overloadctrl.CriticalitySheddable, trusted)(overloadctrl.HTTPMiddleware(c)(next))
+	if code := serve(h, context.Background()); code != http.StatusOK || seen != overloadctrl.CriticalityCritical {
+		t.Fatalf("trusted upstream: status = %d, criticality = %v", code, seen)
+	}
+
+	// gRPC:未配置可信上游时 incoming metadata 被忽略,handler 看到的是 Default
+	ic := overloadctrl.UnaryServerInterceptor(overloadctrl.NoopController{})
+	ctx := grpcmd.NewIncomingContext(spoofed, grpcmd.Pairs(metadata.KeyCriticality, "critical"))
+	if _, err := ic(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+		seen = overloadctrl.CriticalityFromContext(ctx)
+		return nil, nil
+	}); err != nil || seen != overloadctrl.CriticalityDefault {
+		t.Fatalf("grpc untrusted: err = %v, criticality = %v", err, seen)
+	}
+}
@@ -0,0 +1,173 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/rushteam/beauty/pkg/orchestration/delayqueue"
+)
+
+// DelayStore 用 etcd 实现 pkg/orchestration/delayqueue.ClusterStore。每个任务一个 key
+// ({prefix}{partition}/{id}),认领与 Ack 用 ModRevision CAS 保证同一任务不被并发认领。
+//
+// Claim 每次读取整个分区再过滤到期任务,适合已有 etcd、任务量在万级以内的场景;
+// 海量定时任务请用 pkg/infra/redis.DelayStore(Sorted Set 按分数范围查询)。
+//
+// 零值不可用,用 NewDelayStore / NewDelayStoreFromConfig 构造。
+type DelayStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// DelayStoreOption 配置 DelayStore。
+type DelayStoreOption func(*DelayStore)
+
+// WithDelayKeyPrefix 设置 key 前缀(默认 "/beauty/delay/"),不同队列应使用不同前缀。
+func WithDelayKeyPrefix(prefix string) DelayStoreOption {
+	return func(s *DelayStore) {
+		if prefix != "" {
+			s.prefix = prefix
+		}
+	}
+}
+
+// NewDelayStore 用已有 etcd 客户端创建 DelayStore。client 由调用方管理生命周期。
+func NewDelayStore(client *clientv3.Client, opts ...DelayStoreOption) *DelayStore {
+	s := &DelayStore{client: client, prefix: "/beauty/delay/"}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// NewDelayStoreFromConfig 复用 Config 建连接后创建 DelayStore。
+func NewDelayStoreFromConfig(c *Config, opts ...DelayStoreOption) (*DelayStore, error) {
+	client, err := NewClient(c)
+	if err != nil {
+		return nil, fmt.Errorf("etcd delaystore: %w", err)
+	}
+	return NewDelayStore(client, opts...), nil
+}
+
+// delayEntry 是 etcd 中存储的任务及其认领状态。
+type delayEntry struct {
+	Task      delayqueue.Task `json:"task"`
+	VisibleAt int64           `json:"visible_at"` // unix 毫秒,可被认领的时刻
+	Token     string          `json:"token,omitempty"`
+	Attempt   int             `json:"attempt,omitempty"`
+}
+
+func (s *DelayStore) partPrefix(partition int) string {
+	return s.prefix + strconv.Itoa(partition) + "/"
+}
+
+// Put 实现 delayqueue.ClusterStore(覆盖任务并清除进行中的认领)。
+func (s *DelayStore) Put(ctx context.Context, partition int, t delayqueue.Task) error {
+	data, err := json.Marshal(delayEntry{Task: t, VisibleAt: t.FireAt.UnixMilli()})
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.Put(ctx, s.partPrefix(partition)+t.ID, string(data)); err != nil {
+		return fmt.Errorf("etcd delaystore: put %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+// Delete 实现 delayqueue.ClusterStore。
+func (s *DelayStore) Delete(ctx context.Context, partition int, id string) (bool, error) {
+	resp, err := s.client.Delete(ctx, s.partPrefix(partition)+id)
+	if err != nil {
+		return false, fmt.Errorf("etcd delaystore: delete %s: %w", id, err)
+	}
+	return resp.Deleted > 0, nil
+}
+
+// Claim 实现 delayqueue.ClusterStore:读出分区内到期任务,逐个 CAS 写入新的可见时刻与令牌;
+// CAS 失败(被他人认领或改期)的跳过。无法解码的条目也跳过,其错误与认领结果一并经 errors.Join 返回。
+func (s *DelayStore) Claim(ctx context.Context, partition int, now time.Time, visibility time.Duration, limit int) ([]delayqueue.Claimed, error) {
+	resp, err := s.client.Get(ctx, s.partPrefix(partition), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("etcd delaystore: claim partition %d: %w", partition, err)
+	}
+	type candidate struct {
+		key string
+		rev int64
+		e   delayEntry
+	}
+	nowMs := now.UnixMilli()
+	var due []candidate
+	var errs []error // 无法解码的条目跳过,不挡住其它到期任务,经返回的 error 上报
+	for _, kv := range resp.Kvs {
+		var e delayEntry
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			errs = append(errs, fmt.Errorf("etcd delaystore: decode %s: %w", kv.Key, err))
+			continue
+		}
+		if e.VisibleAt > nowMs {
+			continue
+		}
+		due = append(due, candidate{key: string(kv.Key), rev: kv.ModRevision, e: e})
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].e.VisibleAt < due[j].e.VisibleAt })
+
+	var out []delayqueue.Claimed
+	for _, c := range due {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		c.e.VisibleAt = now.Add(visibility).UnixMilli()
+		c.e.Token = delayqueue.NewToken()
+		c.e.Attempt++
+		data, err := json.Marshal(c.e)
+		if err != nil {
+			return out, errors.Join(append(errs, err)...)
+		}
+		txn, err := s.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(c.key), "=", c.rev)).
+			Then(clientv3.OpPut(c.key, string(data))).
+			Commit()
+		if err != nil {
+			return out, errors.Join(append(errs, fmt.Errorf("etcd delaystore: claim %s: %w", c.e.Task.ID, err))...)
+		}
+		if !txn.Succeeded {
+			continue
+		}
+		t := c.e.Task
+		t.Attempt = c.e.Attempt
+		out = append(out, delayqueue.Claimed{Task: t, Token: c.e.Token})
+	}
+	return out, errors.Join(errs...)
+}
+
+// Ack 实现 delayqueue.ClusterStore(令牌匹配时按 ModRevision CAS 删除)。
+func (s *DelayStore) Ack(ctx context.Context, partition int, id, token string) (bool, error) {
+	key := s.partPrefix(partition) + id
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("etcd delaystore: ack %s: %w", id, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+	var e delayEntry
+	if err := json.Unmarshal(resp.Kvs[0].Value, &e); err != nil || e.Token != token {
+		return false, err
+	}
+	txn, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, fmt.Errorf("etcd delaystore: ack %s: %w", id, err)
+	}
+	return txn.Succeeded, nil
+}
+
+var _ delayqueue.ClusterStore = (*DelayStore)(nil)
@@ -0,0 +1,63 @@
+//go:build integration
+
+// 集成测试:需要真实 etcd。复用 dlock_integration_test.go 的 endpoints/newClient。
+package etcd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	beautyetcd "github.com/rushteam/beauty/pkg/infra/etcd"
+	"github.com/rushteam/beauty/pkg/orchestration/delayqueue"
+)
+
+func TestIntegration_DelayStore(t *testing.T) {
+	prefix := "beauty-test/delay/" + time.Now().Format("150405.000000") + "/"
+	s := beautyetcd.NewDelayStore(newClient(t), beautyetcd.WithDelayKeyPrefix(prefix))
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Put(ctx, 0, delayqueue.Task{ID: "a", Topic: "t", Payload: []byte("x"), FireAt: now.Add(-time.Second)})
+	s.Put(ctx, 0, delayqueue.Task{ID: "b", Topic: "t", FireAt: now.Add(time.Hour)})
+	t.Cleanup(func() { s.Delete(ctx, 0, "a"); s.Delete(ctx, 0, "b") })
+
+	claimed, err := s.Claim(ctx, 0, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != "a" || claimed[0].Attempt != 1 {
+		t.Fatalf("claim = %+v, %v; want [a]", claimed, err)
+	}
+	if again, _ := s.Claim(ctx, 0, now, time.Minute, 10); len(again) != 0 {
+		t.Fatalf("claimed twice: %+v", again)
+	}
+	late, _ := s.Claim(ctx, 0, now.Add(2*time.Minute), time.Minute, 10)
+	if len(late) != 1 || late[0].Attempt != 2 {
+		t.Fatalf("reclaim = %+v; want a attempt 2", late)
+	}
+	if ok, _ := s.Ack(ctx, 0, "a", claimed[0].Token); ok {
+		t.Fatal("stale token acked")
+	}
+	if ok, err := s.Ack(ctx, 0, "a", late[0].Token); !ok || err != nil {
+		t.Fatalf("ack = %v, %v", ok, err)
+	}
+}
+
+func TestIntegration_DelayStore_SkipsUndecodable(t *testing.T) {
+	prefix := "beauty-test/delay/" + time.Now().Format("150405.000000") + "/"
+	client := newClient(t)
+	s := beautyetcd.NewDelayStore(client, beautyetcd.WithDelayKeyPrefix(prefix))
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Put(ctx, 0, delayqueue.Task{ID: "good", Topic: "t", FireAt: now.Add(-time.Second)})
+	client.Put(ctx, prefix+"0/bad", "{not json")
+	t.Cleanup(func() { s.Delete(ctx, 0, "good"); client.Delete(ctx, prefix+"0/bad") })
+
+	claimed, err := s.Claim(ctx, 0, now, time.Minute, 10)
+	if len(claimed) != 1 || claimed[0].ID != "good" {
+		t.Fatalf("claim = %+v; want [good]", claimed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("err = %v; want report of entry bad", err)
+	}
+}
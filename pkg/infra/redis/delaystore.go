@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rushteam/beauty/pkg/orchestration/delayqueue"
+)
+
+// 每个分区三个 key(同一 hash tag,Cluster 下落在同一 slot):
+//   - {prefix}{p}:due  — Sorted Set,score = 可被认领的时刻(unix 毫秒),member = 任务 ID
+//   - {prefix}{p}:task — Hash,ID → 任务 JSON
+//   - {prefix}{p}:meta — Hash,"{ID}:tok" → 当前认领令牌,"{ID}:att" → 已认领次数
+var (
+	// claimScript: KEYS = due, task, meta;ARGV = now, visibleUntil, limit, tokenPrefix
+	claimScript = redis.NewScript(`
+local ids = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, tonumber(ARGV[3]))
+local out = {}
+for i, id in ipairs(ids) do
+	local data = redis.call("hget", KEYS[2], id)
+	if data then
+		local tok = ARGV[4] .. i
+		redis.call("zadd", KEYS[1], ARGV[2], id)
+		redis.call("hset", KEYS[3], id .. ":tok", tok)
+		local att = redis.call("hincrby", KEYS[3], id .. ":att", 1)
+		table.insert(out, id)
+		table.insert(out, data)
+		table.insert(out, tok)
+		table.insert(out, att)
+	else
+		redis.call("zrem", KEYS[1], id)
+	end
+end
+return out`)
+
+	// ackScript: KEYS = due, task, meta;ARGV = id, token
+	ackScript = redis.NewScript(`
+if redis.call("hget", KEYS[3], ARGV[1] .. ":tok") ~= ARGV[2] then
+	return 0
+end
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1] .. ":tok", ARGV[1] .. ":att")
+return 1`)
+)
+
+// DelayStore 用 Redis Sorted Set 实现 pkg/orchestration/delayqueue.ClusterStore,
+// 让 delayqueue.Cluster 的任务跨实例共享、进程重启不丢。认领与 Ack 用 Lua 保证原子。
+//
+// 零值不可用,用 NewDelayStore / NewDelayStoreFromConfig 构造。
+type DelayStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// DelayStoreOption 配置 DelayStore。
+type DelayStoreOption func(*DelayStore)
+
+// WithDelayKeyPrefix 设置 key 前缀(默认 "beauty:delay:"),不同队列应使用不同前缀。
+func WithDelayKeyPrefix(prefix string) DelayStoreOption {
+	return func(s *DelayStore) {
+		if prefix != "" {
+			s.prefix = prefix
+		}
+	}
+}
+
+// NewDelayStore 用已有 Redis 客户端创建 DelayStore。client 由调用方管理生命周期。
+func NewDelayStore(client redis.UniversalClient, opts ...DelayStoreOption) *DelayStore {
+	s := &DelayStore{client: client, prefix: "beauty:delay:"}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// NewDelayStoreFromConfig 复用 Config 建连接(并 Ping 校验)后创建 DelayStore。
+func NewDelayStoreFromConfig(c *Config, opts ...DelayStoreOption) (*DelayStore, error) {
+	client, err := pingClient(c)
+	if err != nil {
+		return nil, fmt.Errorf("redis delaystore: %w", err)
+	}
+	return NewDelayStore(client, opts...), nil
+}
+
+func (s *DelayStore) keys(partition int) []string {
+	base := s.prefix + "{" + strconv.Itoa(partition) + "}"
+	return []string{base + ":due", base + ":task", base + ":meta"}
+}
+
+// Put 实现 delayqueue.ClusterStore(覆盖任务并清除进行中的认领)。
+func (s *DelayStore) Put(ctx context.Context, partition int, t delayqueue.Task) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	k := s.keys(partition)
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, k[1], t.ID, data)
+	pipe.HDel(ctx, k[2], t.ID+":tok", t.ID+":att")
+	pipe.ZAdd(ctx, k[0], redis.Z{Score: float64(t.FireAt.UnixMilli()), Member: t.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis delaystore: put %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+// Delete 实现 delayqueue.ClusterStore。
+func (s *DelayStore) Delete(ctx context.Context, partition int, id string) (bool, error) {
+	k := s.keys(partition)
+	pipe := s.client.TxPipeline()
+	removed := pipe.ZRem(ctx, k[0], id)
+	pipe.HDel(ctx, k[1], id)
+	pipe.HDel(ctx, k[2], id+":tok", id+":att")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("redis delaystore: delete %s: %w", id, err)
+	}
+	return removed.Val() > 0, nil
+}
+
+// Claim 实现 delayqueue.ClusterStore(ZRANGEBYSCORE + 推迟 score,Lua 原子执行)。
+// 无法解码的任务被跳过(可见性超时后会再次被认领并报告),其余任务照常返回。
+func (s *DelayStore) Claim(ctx context.Context, partition int, now time.Time, visibility time.Duration, limit int) ([]delayqueue.Claimed, error) {
+	res, err := claimScript.Run(ctx, s.client, s.keys(partition),
+		now.UnixMilli(), now.Add(visibility).UnixMilli(), limit, delayqueue.NewToken()+":").Slice()
+	if err != nil {
+		return nil, fmt.Errorf("redis delaystore: claim partition %d: %w", partition, err)
+	}
+	out := make([]delayqueue.Claimed, 0, len(res)/4)
+	var errs []error
+	for i := 0; i+3 < len(res); i += 4 {
+		id, _ := res[i].(string)
+		data, _ := res[i+1].(string)
+		tok, _ := res[i+2].(string)
+		att, _ := res[i+3].(int64)
+		var cl delayqueue.Claimed
+		if err := json.Unmarshal([]byte(data), &cl.Task); err != nil {
+			errs = append(errs, fmt.Errorf("redis delaystore: decode task %s: %w", id, err))
+			continue
+		}
+		cl.Token, cl.Attempt = tok, int(att)
+		out = append(out, cl)
+	}
+	return out, errors.Join(errs...)
+}
+
+// Ack 实现 delayqueue.ClusterStore(令牌 CAS 删除)。
+func (s *DelayStore) Ack(ctx context.Context, partition int, id, token string) (bool, error) {
+	n, err := ackScript.Run(ctx, s.client, s.keys(partition), id, token).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis delaystore: ack %s: %w", id, err)
+	}
+	return n == 1, nil
+}
+
+var _ delayqueue.ClusterStore = (*DelayStore)(nil)
@@ -7,6 +7,7 @@ package redis_test
 import (
 	"context"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -15,6 +16,7 @@ import (
 	goredis "github.com/redis/go-redis/v9"
 
 	beautyredis "github.com/rushteam/beauty/pkg/infra/redis"
+	"github.com/rushteam/beauty/pkg/orchestration/delayqueue"
 )
 
 func redisAddr(t *testing.T) string {
@@ -195,3 +197,57 @@ func TestIntegration_Store(t *testing.T) {
 	}
 	s.Delete(ctx, sk)
 }
+
+func TestIntegration_DelayStore(t *testing.T) {
+	prefix := "beauty-test:delay:" + time.Now().Format("150405.000000") + ":"
+	s := beautyredis.NewDelayStore(newRawClient(t), beautyredis.WithDelayKeyPrefix(prefix))
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Put(ctx, 0, delayqueue.Task{ID: "a", Topic: "t", Payload: []byte("x"), FireAt: now.Add(-time.Second)})
+	s.Put(ctx, 0, delayqueue.Task{ID: "b", Topic: "t", FireAt: now.Add(time.Hour)})
+
+	claimed, err := s.Claim(ctx, 0, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != "a" || string(claimed[0].Payload) != "x" || claimed[0].Attempt != 1 {
+		t.Fatalf("claim = %+v, %v; want [a]", claimed, err)
+	}
+	// 认领期间其它实例看不到
+	if again, _ := s.Claim(ctx, 0, now, time.Minute, 10); len(again) != 0 {
+		t.Fatalf("claimed twice: %+v", again)
+	}
+	// 可见性超时后重新可见,旧令牌失效
+	late, _ := s.Claim(ctx, 0, now.Add(2*time.Minute), time.Minute, 10)
+	if len(late) != 1 || late[0].Attempt != 2 {
+		t.Fatalf("reclaim = %+v; want a attempt 2", late)
+	}
+	if ok, _ := s.Ack(ctx, 0, "a", claimed[0].Token); ok {
+		t.Fatal("stale token acked")
+	}
+	if ok, err := s.Ack(ctx, 0, "a", late[0].Token); !ok || err != nil {
+		t.Fatalf("ack = %v, %v", ok, err)
+	}
+	if ok, _ := s.Delete(ctx, 0, "b"); !ok {
+		t.Fatal("delete b should report existed")
+	}
+}
+
+// 个别任务 JSON 损坏时跳过并报告它,其余任务照常认领。
+func TestIntegration_DelayStore_SkipsUndecodable(t *testing.T) {
+	prefix := "beauty-test:delay:" + time.Now().Format("150405.000000") + ":"
+	client := newRawClient(t)
+	s := beautyredis.NewDelayStore(client, beautyredis.WithDelayKeyPrefix(prefix))
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Put(ctx, 0, delayqueue.Task{ID: "good", Topic: "t", FireAt: now.Add(-time.Second)})
+	s.Put(ctx, 0, delayqueue.Task{ID: "bad", Topic: "t", FireAt: now.Add(-2 * time.Second)})
+	client.HSet(ctx, prefix+"{0}:task", "bad", "{not json")
+
+	claimed, err := s.Claim(ctx, 0, now, time.Minute, 10)
+	if len(claimed) != 1 || claimed[0].ID != "good" {
+		t.Fatalf("claim = %+v; want [good]", claimed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("err = %v; want report of task bad", err)
+	}
+}
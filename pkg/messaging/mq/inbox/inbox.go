@@ -0,0 +1,221 @@
+// Package inbox 为 pkg/mq 提供消费端去重(inbox 模式):同一条消息被 broker 重投、被 mq.Retry
+// 重跑或被上游重复发布时,handler 只生效一次。
+//
+// broker 的投递保证普遍是 at-least-once,发件箱(contrib/sqldb/outbox)也是;消费端若不去重,
+// 扣款、发奖之类的副作用就会重复。Dedup 中间件按消息 ID 在 Store 中占位:
+//
+//   - 首次到达:占位 → 执行 handler → 成功则 Commit(记录保留 TTL),失败或 panic 则 Release(允许重投后重试);
+//   - 已处理过:直接返回 nil(确认消息),不执行 handler,计入 mq.inbox.duplicates 指标;
+//   - 另一副本正在处理:返回 ErrInProgress,由 broker / Retry 稍后重投,避免与前者并发执行。
+//
+// 存储可选:
+//   - KV(kvstore.Store):Redis 等共享 KV,占位与记录都带 TTL 自动过期;
+//   - contrib/sqldb/inbox:SQL inbox 表,可让去重记录与 handler 的业务写**同一事务**提交——
+//     业务写与"已处理"标记要么都生效要么都不生效,得到 effectively-once。
+//
+// 用法:
+//
+//	h := mq.Chain(business,
+//	    mq.Recover(),
+//	    mq.Retry(3, 100*time.Millisecond),
+//	    inbox.Dedup(inbox.KV(redisKV), "order-service"),
+//	)
+//
+// mq.Retry 放在 Dedup 外层:每次重试各自占位、失败各自 Release。事务型 Store 必须这样排——
+// 放在内层时所有重试共用 Claim 开启的同一个事务,失败尝试的写入会随成功的那次一起提交
+// (PostgreSQL 下事务出错后更是直接作废,重试不可能成功)。
+//
+// 消息 ID 默认取 Headers["message-id"];发件箱投递的消息用 WithID(inbox.FromHeader(outbox.HeaderID)),
+// 或用 WithID 从 Body 中提取业务 ID。取不到 ID 的消息不去重,直接交给 handler。
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+)
+
+// HeaderMessageID 是默认读取消息 ID 的 header。
+const HeaderMessageID = "message-id"
+
+// ErrInProgress 表示同一消息正由其它处理者处理(已占位但尚未 Commit / Release)。
+var ErrInProgress = errors.New("inbox: message is being processed")
+
+// Status 是 Store.Claim 的结果。
+type Status int
+
+const (
+	Claimed    Status = iota // 占位成功,调用方应执行 handler
+	Duplicate                // 已处理过
+	InProgress               // 正在被其它处理者处理
+)
+
+func (s Status) String() string {
+	switch s {
+	case Claimed:
+		return "claimed"
+	case Duplicate:
+		return "duplicate"
+	case InProgress:
+		return "in_progress"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Store 保存已处理消息的记录。实现须并发安全。
+type Store interface {
+	// Claim 为 key 占位,lease 是占位的有效期(处理者崩溃后占位自动失效)。
+	// 返回的 ctx 交给 handler 及随后的 Commit / Release——事务型实现借此把事务传给 handler。
+	Claim(ctx context.Context, key string, lease time.Duration) (context.Context, Status, error)
+	// Commit 把 key 记为已处理,记录保留 ttl。
+	Commit(ctx context.Context, key string, ttl time.Duration) error
+	// Release 撤销占位,让后续重投可以重新处理。
+	Release(ctx context.Context, key string) error
+}
+
+// IDFunc 从消息中取去重 ID;返回空串表示该消息不去重。
+type IDFunc func(msg mq.Message) string
+
+// FromHeader 返回从 Headers[name] 取 ID 的 IDFunc。
+func FromHeader(name string) IDFunc {
+	return func(msg mq.Message) string { return msg.Headers[name] }
+}
+
+type config struct {
+	id         IDFunc
+	ttl        time.Duration
+	lease      time.Duration
+	onStoreErr func(op, key string, err error)
+}
+
+// Option 配置 Dedup。
+type Option func(*config)
+
+// WithID 设置取消息 ID 的函数(默认 FromHeader(HeaderMessageID))。
+func WithID(fn IDFunc) Option {
+	return func(c *config) {
+		if fn != nil {
+			c.id = fn
+		}
+	}
+}
+
+// WithTTL 设置已处理记录的保留时长(默认 24h)。应长于 broker 可能重投的时间窗。
+func WithTTL(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.ttl = d
+		}
+	}
+}
+
+// WithLease 设置处理中占位的有效期(默认 1 分钟)。应长于 handler 的最长执行时间,
+// 否则慢处理期间的重投会被当作无人处理而再执行一次。
+func WithLease(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.lease = d
+		}
+	}
+}
+
+// WithOnStoreError 设置 Commit / Release 出错时的回调(默认 slog.Warn)。
+// Claim 出错时消息按处理失败返回,不经此回调。
+func WithOnStoreError(fn func(op, key string, err error)) Option {
+	return func(c *config) {
+		if fn != nil {
+			c.onStoreErr = fn
+		}
+	}
+}
+
+// Dedup 返回按消息 ID 去重的中间件。consumer 是消费者名,参与去重 key("{consumer}:{id}"),
+// 不同消费者处理同一条消息互不影响。
+//
+// 应放在 mq.Retry 内层(见包文档):每次重试先查重、各自占位。handler panic 时先 Release 再继续向上
+// panic(交给外层 mq.Recover),占位与事务不会泄漏。
+// Claim 出错时返回错误(fail-closed,交由 broker 重投),不会在无法确认的情况下执行 handler。
+func Dedup(store Store, consumer string, opts ...Option) mq.HandlerMiddleware {
+	cfg := config{id: FromHeader(HeaderMessageID), ttl: 24 * time.Hour, lease: time.Minute}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.onStoreErr == nil {
+		cfg.onStoreErr = func(op, key string, err error) {
+			slog.Warn("inbox: store failed", "op", op, "key", key, "error", err)
+		}
+	}
+	m := newMetrics()
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg mq.Message) error {
+			id := cfg.id(msg)
+			if id == "" {
+				return next(ctx, msg)
+			}
+			key := consumer + ":" + id
+			hctx, st, err := store.Claim(ctx, key, cfg.lease)
+			if err != nil {
+				return fmt.Errorf("inbox: claim %s: %w", key, err)
+			}
+			switch st {
+			case Duplicate:
+				m.duplicate(ctx, consumer, msg.Topic)
+				return nil
+			case InProgress:
+				return ErrInProgress
+			}
+			release := func() {
+				if rerr := store.Release(hctx, key); rerr != nil {
+					cfg.onStoreErr("release", key, rerr)
+				}
+			}
+			returned := false
+			defer func() {
+				if !returned { // handler panic / Goexit:撤销占位(事务型 Store 回滚事务)后照常向上传播
+					release()
+				}
+			}()
+			err = next(hctx, msg)
+			returned = true
+			if err != nil {
+				release()
+				return err
+			}
+			if err := store.Commit(hctx, key, cfg.ttl); err != nil {
+				// 没能记为已处理:返回错误让 broker 重投。事务型 Store 的业务写已随之回滚;
+				// KV Store 下重投会再执行一次(at-least-once)。
+				cfg.onStoreErr("commit", key, err)
+				return fmt.Errorf("inbox: commit %s: %w", key, err)
+			}
+			return nil
+		}
+	}
+}
+
+type metrics struct {
+	duplicates metric.Int64Counter
+}
+
+func newMetrics() *metrics {
+	m := otel.Meter("github.com/rushteam/beauty/pkg/messaging/mq/inbox")
+	duplicates, _ := m.Int64Counter("mq.inbox.duplicates", metric.WithDescription("被去重拦截的重复消息数(按消费者/主题)"))
+	return &metrics{duplicates: duplicates}
+}
+
+func (m *metrics) duplicate(ctx context.Context, consumer, topic string) {
+	if m.duplicates != nil {
+		m.duplicates.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("consumer", consumer),
+			attribute.String("topic", topic),
+		))
+	}
+}
@@ -0,0 +1,122 @@
+package inbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/messaging/mq/inbox"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+func withID(id string) mq.Message {
+	return mq.Message{Topic: "orders", Body: []byte("paid"), Headers: map[string]string{inbox.HeaderMessageID: id}}
+}
+
+// TestDedup_SuppressesDuplicates:同一 ID 只执行一次;不同消费者、没有 ID 的消息不受影响。
+func TestDedup_SuppressesDuplicates(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	ctx := context.Background()
+
+	billing := map[string]int{}
+	audit := 0
+	h := mq.Chain(func(_ context.Context, m mq.Message) error {
+		billing[m.Headers[inbox.HeaderMessageID]]++
+		return nil
+	}, inbox.Dedup(inbox.KV(kv), "billing"))
+	a := mq.Chain(func(context.Context, mq.Message) error { audit++; return nil }, inbox.Dedup(inbox.KV(kv), "audit"))
+	for range 3 {
+		if err := h(ctx, withID("m-1")); err != nil {
+			t.Fatal(err)
+		}
+		_ = a(ctx, withID("m-1"))
+		_ = h(ctx, mq.Message{Topic: "orders"})
+	}
+	if billing["m-1"] != 1 || audit != 1 || billing[""] != 3 {
+		t.Errorf("billing=%v audit=%d", billing, audit)
+	}
+}
+
+// TestDedup_FailureReleases:handler 失败时撤销占位,重投后可再处理;成功后不再执行。
+func TestDedup_FailureReleases(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	ctx := context.Background()
+
+	calls := 0
+	h := mq.Chain(func(context.Context, mq.Message) error {
+		calls++
+		if calls == 1 {
+			return errors.New("db down")
+		}
+		return nil
+	}, inbox.Dedup(inbox.KV(kv), "billing"))
+
+	if err := h(ctx, withID("m-2")); err == nil {
+		t.Fatal("first delivery should fail")
+	}
+	if err := h(ctx, withID("m-2")); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	_ = h(ctx, withID("m-2"))
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+// TestDedup_InProgress:前一次投递仍在处理时,并发的重复投递返回 ErrInProgress 而不是并发执行。
+func TestDedup_InProgress(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	h := mq.Chain(func(context.Context, mq.Message) error {
+		close(started)
+		<-release
+		return nil
+	}, inbox.Dedup(inbox.KV(kv), "billing", inbox.WithLease(time.Minute)))
+
+	done := make(chan error, 1)
+	go func() { done <- h(ctx, withID("m-3")) }()
+	<-started
+	if err := h(ctx, withID("m-3")); !errors.Is(err, inbox.ErrInProgress) {
+		t.Errorf("concurrent duplicate: got %v, want ErrInProgress", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := h(ctx, withID("m-3")); err != nil {
+		t.Errorf("after commit the duplicate should be acked: %v", err)
+	}
+}
+
+// TestDedup_PanicReleases:handler panic 时撤销占位并继续向上 panic,重投后可再处理。
+func TestDedup_PanicReleases(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	ctx := context.Background()
+
+	calls := 0
+	h := mq.Chain(func(context.Context, mq.Message) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return nil
+	}, mq.Recover(), inbox.Dedup(inbox.KV(kv), "billing"))
+
+	if err := h(ctx, withID("m-4")); err == nil {
+		t.Fatal("panicking delivery should fail")
+	}
+	if err := h(ctx, withID("m-4")); err != nil {
+		t.Fatalf("redelivery after panic: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
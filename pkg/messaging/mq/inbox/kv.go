@@ -0,0 +1,59 @@
+package inbox
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+var (
+	processingMark = []byte("processing")
+	doneMark       = []byte("done")
+)
+
+// kvStore 把 kvstore.Store 适配为 Store:占位用 SetNX(值 "processing",过期 = lease),
+// 完成后覆盖为 "done"(过期 = ttl)。
+type kvStore struct {
+	s      kvstore.Store
+	prefix string
+}
+
+// KV 用 kvstore.Store(Redis 等)作为去重存储,key 加前缀 "inbox:"。
+func KV(s kvstore.Store) Store {
+	return &kvStore{s: s, prefix: "inbox:"}
+}
+
+func (k *kvStore) Claim(ctx context.Context, key string, lease time.Duration) (context.Context, Status, error) {
+	ok, err := k.s.SetNX(ctx, k.prefix+key, processingMark, lease)
+	if err != nil {
+		return ctx, Claimed, err
+	}
+	if ok {
+		return ctx, Claimed, nil
+	}
+	val, found, err := k.s.Get(ctx, k.prefix+key)
+	if err != nil {
+		return ctx, Claimed, err
+	}
+	if !found {
+		// 占位恰好在两次调用之间过期或被释放:再抢一次
+		if ok, err := k.s.SetNX(ctx, k.prefix+key, processingMark, lease); err != nil || ok {
+			return ctx, Claimed, err
+		}
+		return ctx, InProgress, nil
+	}
+	if bytes.Equal(val, doneMark) {
+		return ctx, Duplicate, nil
+	}
+	return ctx, InProgress, nil
+}
+
+func (k *kvStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return k.s.Set(ctx, k.prefix+key, doneMark, ttl)
+}
+
+func (k *kvStore) Release(ctx context.Context, key string) error {
+	return k.s.Delete(ctx, k.prefix+key)
+}
@@ -20,7 +20,8 @@
 //
 // 边界(机制而非策略):序列化(Body 是 []byte)、分区键(Key)、broker 选型都是 policy。
 // OTel trace 透传(Headers 承载 W3C TraceContext)见子包 pkg/mq/otelmq(opt-in,对齐
-// franz-go kotel 的 publish/process 语义,但与具体 broker 解耦)。
+// franz-go kotel 的 publish/process 语义,但与具体 broker 解耦)。消费端按消息 ID 去重见子包
+// pkg/messaging/mq/inbox(Dedup 中间件,KV 或 SQL inbox 表存储)。
 package mq
 
 import (
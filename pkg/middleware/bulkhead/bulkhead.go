@@ -0,0 +1,179 @@
+// Package bulkhead 把 pkg/resilience/bulkhead 的舱壁接到出站调用上:gRPC 客户端拦截器、
+// HTTP 客户端 RoundTripper 与通用 Do。舱壁满时返回 api/errors 的 Unavailable,附 RetryInfo
+// (建议重试间隔)与 ErrorInfo(Reason=BULKHEAD_FULL,metadata 带依赖名),调用方可按结构化错误处理。
+//
+//	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(50))
+//	reg.Register("payment", bulkhead.WithMaxConcurrent(8), bulkhead.WithMaxWait(20*time.Millisecond))
+//	_ = mwbulkhead.RegisterMetrics(reg) // 导出饱和度指标
+//
+//	conn, _ := grpcclient.DialContext(ctx, target, grpcclient.WithBulkheadInterceptor(reg, "payment"))
+//	client := resty.NewHTTPClient(resty.WithBulkhead(reg, "")) // 空名按请求 Host 隔离
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"google.golang.org/grpc"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
+)
+
+// ReasonFull 是舱壁拒绝时 ErrorInfo 的 Reason。
+const ReasonFull = "BULKHEAD_FULL"
+
+// Status 把舱壁拒绝错误转为 Unavailable(附 RetryInfo 与 ErrorInfo);err 不是拒绝错误时返回 nil。
+func Status(err error) *perr.Status {
+	var re *bulkhead.RejectedError
+	if !errors.As(err, &re) {
+		return nil
+	}
+	return perr.Unavailable("dependency " + re.Name + " is saturated").
+		WithCause(err).
+		WithDetail(&perr.RetryInfo{RetryDelay: re.RetryAfter}).
+		WithDetail(&perr.ErrorInfo{
+			Reason:   ReasonFull,
+			Domain:   "bulkhead",
+			Metadata: map[string]string{"dependency": re.Name},
+		})
+}
+
+// Do 在 name 的舱壁内执行 fn。被拒绝时返回 *perr.Status(Unavailable),其余错误原样返回。
+func Do(ctx context.Context, reg *bulkhead.Registry, name string, fn func(ctx context.Context) error) error {
+	err := reg.Do(ctx, name, fn)
+	if st := Status(err); st != nil {
+		return st
+	}
+	return err
+}
+
+// acquire 占用名额,拒绝错误转为 *perr.Status。
+func acquire(ctx context.Context, reg *bulkhead.Registry, name string) (func(), error) {
+	release, err := reg.Get(name).Acquire(ctx)
+	if st := Status(err); st != nil {
+		return nil, st
+	}
+	return release, err
+}
+
+// UnaryClientInterceptor 返回 gRPC 一元客户端拦截器:每次调用占用 name 舱壁的一个名额。
+// name 为空时用连接的 target 作依赖名。拒绝时返回带 RetryInfo 的 codes.Unavailable。
+func UnaryClientInterceptor(reg *bulkhead.Registry, name string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		release, err := acquire(ctx, reg, dependency(name, cc))
+		if err != nil {
+			return grpcError(ctx, err)
+		}
+		defer release()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor 返回 gRPC 流客户端拦截器:整条流占用一个名额,流结束或 ctx 取消时释放。
+// 流结束指 RecvMsg 返回错误(含 io.EOF);客户端流(服务端只回一条)在 RecvMsg 成功收到响应时即结束。
+func StreamClientInterceptor(reg *bulkhead.Registry, name string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		release, err := acquire(ctx, reg, dependency(name, cc))
+		if err != nil {
+			return nil, grpcError(ctx, err)
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		stop := context.AfterFunc(ctx, release)
+		return &releasingStream{ClientStream: cs, release: func() { stop(); release() }, unaryRecv: !desc.ServerStreams}, nil
+	}
+}
+
+func dependency(name string, cc *grpc.ClientConn) string {
+	if name == "" && cc != nil {
+		return cc.Target()
+	}
+	return name
+}
+
+func grpcError(ctx context.Context, err error) error {
+	var st *perr.Status
+	if errors.As(err, &st) {
+		return perr.ToGRPCContext(ctx, st)
+	}
+	return err
+}
+
+type releasingStream struct {
+	grpc.ClientStream
+	release   func() // 幂等
+	unaryRecv bool   // 服务端只回一条:成功收到即流结束,grpc 不会再让调用方读到 io.EOF
+}
+
+func (s *releasingStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || s.unaryRecv {
+		s.release()
+	}
+	return err
+}
+
+// HTTPClientMiddleware 返回 HTTP 客户端中间件:每个请求占用一个名额,直到响应体读完或关闭才释放
+// (慢下游的"读响应体"同样占着舱壁)。name 为空时按请求的 URL.Host 隔离。
+// 拒绝时 RoundTrip 返回 *perr.Status(Unavailable),可用 errors.As 取出。
+func HTTPClientMiddleware(reg *bulkhead.Registry, name string) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		return &transport{reg: reg, name: name, next: next}
+	}
+}
+
+type transport struct {
+	reg  *bulkhead.Registry
+	name string
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := t.name
+	if name == "" {
+		name = req.URL.Host
+	}
+	release, err := acquire(req.Context(), t.reg, name)
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close() // RoundTripper 约定:出错也要关闭请求体
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody 在响应体读到 EOF 或 Close 时释放名额。
+type releasingBody struct {
+	io.ReadCloser
+	release func() // 幂等
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
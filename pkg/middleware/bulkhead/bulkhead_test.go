@@ -0,0 +1,157 @@
+package bulkhead_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	mwbulkhead "github.com/rushteam/beauty/pkg/middleware/bulkhead"
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
+)
+
+func TestHTTPClientMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(1), bulkhead.WithRetryAfter(2*time.Second))
+	client := &http.Client{Transport: mwbulkhead.HTTPClientMiddleware(reg, "")(nil)}
+
+	// 第一个响应体未关闭前一直占着名额
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get(srv.URL)
+	var st *perr.Status
+	if !errors.As(err, &st) || st.Code() != perr.CodeUnavailable {
+		t.Fatalf("want Unavailable while saturated, got %v", err)
+	}
+	var retry *perr.RetryInfo
+	for _, d := range st.Details() {
+		if ri, ok := d.(*perr.RetryInfo); ok {
+			retry = ri
+		}
+	}
+	if retry == nil || retry.RetryDelay != 2*time.Second {
+		t.Errorf("RetryInfo = %+v", retry)
+	}
+
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("after body closed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if s := reg.Stats(); len(s) != 1 || s[0].Name != srv.Listener.Addr().String() || s[0].InFlight != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(1))
+	ic := mwbulkhead.UnaryClientInterceptor(reg, "payment")
+	ctx := context.Background()
+
+	entered, done := make(chan struct{}), make(chan struct{})
+	slow := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		close(entered)
+		<-done
+		return nil
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- ic(ctx, "/pay.Payment/Charge", nil, nil, nil, slow) }()
+	<-entered
+
+	fast := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		t.Error("invoker must not run while saturated")
+		return nil
+	}
+	err := ic(ctx, "/pay.Payment/Charge", nil, nil, nil, fast)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("want codes.Unavailable, got %v", err)
+	}
+	if st, ok := perr.FromGRPCError(err); !ok || len(st.Details()) == 0 {
+		t.Errorf("gRPC error should carry details: %v", err)
+	}
+	close(done)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if err := mwbulkhead.Do(ctx, reg, "payment", func(context.Context) error { return nil }); err != nil {
+		t.Errorf("Do after release: %v", err)
+	}
+}
+
+// clientStream 是只实现 RecvMsg 的假流,模拟服务端回复成功。
+type clientStream struct{ grpc.ClientStream }
+
+func (clientStream) RecvMsg(any) error { return nil }
+
+// TestStreamClientInterceptor_ClientStreaming:客户端流收到唯一响应即结束,名额随之释放,
+// 不依赖 ctx 取消(background ctx 下也不泄漏)。
+func TestStreamClientInterceptor_ClientStreaming(t *testing.T) {
+	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(1))
+	ic := mwbulkhead.StreamClientInterceptor(reg, "upload")
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return clientStream{}, nil
+	}
+	desc := &grpc.StreamDesc{ClientStreams: true}
+	for i := range 3 {
+		cs, err := ic(context.Background(), desc, nil, "/up.Upload/Put", streamer)
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		if err := cs.RecvMsg(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := reg.Stats(); len(s) != 1 || s[0].InFlight != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(prev)
+
+	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(2))
+	if err := mwbulkhead.RegisterMetrics(reg); err != nil {
+		t.Fatal(err)
+	}
+	release, _ := reg.Get("search").Acquire(context.Background())
+	defer release()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var saturation float64
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if g, ok := m.Data.(metricdata.Gauge[float64]); ok && m.Name == "bulkhead.saturation" {
+				saturation, found = g.DataPoints[0].Value, true
+			}
+		}
+	}
+	if !found || saturation != 0.5 {
+		t.Errorf("bulkhead.saturation = %v (found %v), want 0.5", saturation, found)
+	}
+}
@@ -0,0 +1,57 @@
+package bulkhead
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/rushteam/beauty/pkg/resilience/bulkhead"
+)
+
+// RegisterMetrics 以全局 MeterProvider 导出 reg 中各舱壁的指标(属性 dependency=依赖名),采集时读取
+// Registry.Stats,无额外热路径开销:
+//
+//	bulkhead.in_flight   正在执行的调用数
+//	bulkhead.waiting     排队等待名额的调用数
+//	bulkhead.capacity    最大并发
+//	bulkhead.saturation  占用率 in_flight/capacity(0..1)
+//	bulkhead.rejected    累计拒绝次数
+//
+// 同一 Registry 只应注册一次。
+func RegisterMetrics(reg *bulkhead.Registry) error {
+	m := otel.Meter("github.com/rushteam/beauty/pkg/middleware/bulkhead")
+	inFlight, err := m.Int64ObservableGauge("bulkhead.in_flight", metric.WithDescription("舱壁内正在执行的调用数"))
+	if err != nil {
+		return err
+	}
+	waiting, err := m.Int64ObservableGauge("bulkhead.waiting", metric.WithDescription("排队等待舱壁名额的调用数"))
+	if err != nil {
+		return err
+	}
+	capacity, err := m.Int64ObservableGauge("bulkhead.capacity", metric.WithDescription("舱壁最大并发"))
+	if err != nil {
+		return err
+	}
+	saturation, err := m.Float64ObservableGauge("bulkhead.saturation", metric.WithDescription("舱壁占用率(0..1)"))
+	if err != nil {
+		return err
+	}
+	rejected, err := m.Int64ObservableCounter("bulkhead.rejected", metric.WithDescription("舱壁满被拒绝的调用数"))
+	if err != nil {
+		return err
+	}
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, st := range reg.Stats() {
+			attrs := metric.WithAttributes(attribute.String("dependency", st.Name))
+			o.ObserveInt64(inFlight, int64(st.InFlight), attrs)
+			o.ObserveInt64(waiting, int64(st.Waiting), attrs)
+			o.ObserveInt64(capacity, int64(st.Capacity), attrs)
+			o.ObserveFloat64(saturation, st.Saturation(), attrs)
+			o.ObserveInt64(rejected, st.Rejected, attrs)
+		}
+		return nil
+	}, inFlight, waiting, capacity, saturation, rejected)
+	return err
+}
@@ -1,32 +1,71 @@
+// Package compress 提供响应压缩与请求体解压中间件。
+//
+// 响应压缩按 Accept-Encoding 的 q 值在 zstd / br / gzip / deflate 间协商(q 相同按服务端偏好,
+// 默认 zstd > br > gzip > deflate),每种编码按级别维护独立的 writer 池。只压缩白名单内的
+// Content-Type 且不小于 minSize 的响应;handler 已设置 Content-Encoding、206 / 204 / 304
+// 等响应原样透传。流式响应(SSE / chunked)在首次 Flush 时即定下是否压缩并立刻下发。
+//
+// 请求体解压见 Decompress。
 package compress
 
 import (
-	"compress/gzip"
 	"log/slog"
 	"net/http"
 	"strings"
-	"sync"
 )
 
-var gzipPool = sync.Pool{
-	New: func() any {
-		return gzip.NewWriter(nil)
-	},
-}
-
-var compressibleTypes = []string{
+// DefaultContentTypes 是默认压缩的 Content-Type 前缀。
+var DefaultContentTypes = []string{
 	"text/",
 	"application/json",
 	"application/xml",
 	"application/javascript",
 }
 
-func isCompressible(contentType string) bool {
+// Option 配置压缩中间件。
+type Option func(*options)
+
+type options struct {
+	minSize      int
+	encodings    []string
+	levels       map[string]int
+	contentTypes []string
+}
+
+// WithMinSize 设置压缩阈值:响应体不足 n 字节时不压缩(Flush 过的流式响应除外),0 表示始终压缩。默认 1024。
+func WithMinSize(n int) Option { return func(o *options) { o.minSize = n } }
+
+// WithEncodings 设置启用的编码及 q 值相同时的偏好顺序,默认 zstd、br、gzip、deflate;未知编码忽略。
+//
+//	compress.WithEncodings(compress.Brotli, compress.Gzip) // 不用 zstd
+func WithEncodings(names ...string) Option { return func(o *options) { o.encodings = names } }
+
+// WithLevel 设置某编码的压缩级别,超出该编码合法范围时取边界值。默认 zstd 3、br 4、gzip / deflate 6。
+func WithLevel(encoding string, level int) Option {
+	return func(o *options) { o.levels[encoding] = level }
+}
+
+// WithContentTypes 替换可压缩的 Content-Type 前缀白名单(默认 DefaultContentTypes)。
+func WithContentTypes(prefixes ...string) Option {
+	return func(o *options) { o.contentTypes = prefixes }
+}
+
+type compressor struct {
+	minSize      int
+	prefs        []string
+	encoders     map[string]*encoder
+	contentTypes []string
+}
+
+func (c *compressor) compressible(contentType string) bool {
 	ct := strings.ToLower(contentType)
 	if idx := strings.Index(ct, ";"); idx != -1 {
 		ct = strings.TrimSpace(ct[:idx])
 	}
-	for _, t := range compressibleTypes {
+	if ct == "" {
+		return false
+	}
+	for _, t := range c.contentTypes {
 		if strings.HasPrefix(ct, t) {
 			return true
 		}
@@ -34,10 +73,11 @@ func isCompressible(contentType string) bool {
 	return false
 }
 
-type gzipResponseWriter struct {
+type compressResponseWriter struct {
 	http.ResponseWriter
-	gz          *gzip.Writer
-	minSize     int
+	c           *compressor
+	enc         *encoder
+	ew          encWriter
 	buf         []byte
 	wroteHeader bool
 	statusCode  int
@@ -45,21 +85,29 @@ type gzipResponseWriter struct {
 	done        bool
 }
 
-func (g *gzipResponseWriter) WriteHeader(code int) {
+func (g *compressResponseWriter) WriteHeader(code int) {
+	// 1xx 信息性响应(如 103 Early Hints)直接下发,不影响最终响应的压缩决定。
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if g.wroteHeader {
+		return
+	}
 	g.statusCode = code
 	g.wroteHeader = true
 }
 
-func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+func (g *compressResponseWriter) Write(b []byte) (int, error) {
 	if !g.wroteHeader {
 		g.statusCode = http.StatusOK
 		g.wroteHeader = true
 	}
 
-	// 已进入压缩流：后续所有写入都必须经过 gz（流式响应会在 flush 后继续写入，
-	// compressed 必须优先于 done 判断，否则会绕过 gzip 写出原始字节）。
+	// 已进入压缩流：后续所有写入都必须经过编码器（流式响应会在 flush 后继续写入，
+	// compressed 必须优先于 done 判断，否则会绕过编码器写出原始字节）。
 	if g.compressed {
-		return g.gz.Write(b)
+		return g.ew.Write(b)
 	}
 
 	// 已决定不压缩：直接透传
@@ -69,13 +117,12 @@ func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 
 	g.buf = append(g.buf, b...)
 
-	ct := g.ResponseWriter.Header().Get("Content-Type")
-	if !isCompressible(ct) {
+	if !g.eligible() {
 		g.flush(false)
 		return len(b), nil
 	}
 
-	if g.minSize > 0 && len(g.buf) < g.minSize {
+	if g.c.minSize > 0 && len(g.buf) < g.c.minSize {
 		return len(b), nil
 	}
 
@@ -83,32 +130,51 @@ func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
-func (g *gzipResponseWriter) flush(compress bool) {
+// eligible 判断响应本身是否可压缩(不含大小阈值)。未设置 Content-Type 时按缓冲内容嗅探并补上,
+// 与 net/http 稍后的行为一致,也借此识别出已压缩的内容(gzip、zip、图片等)。
+func (g *compressResponseWriter) eligible() bool {
+	h := g.ResponseWriter.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	switch g.statusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	if _, ok := h["Content-Type"]; !ok && len(g.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	return g.c.compressible(h.Get("Content-Type"))
+}
+
+func (g *compressResponseWriter) flush(compress bool) {
 	g.done = true
+	h := g.ResponseWriter.Header()
 	if compress {
 		g.compressed = true
-		g.ResponseWriter.Header().Set("Content-Encoding", "gzip")
-		g.ResponseWriter.Header().Del("Content-Length")
-		g.ResponseWriter.Header().Add("Vary", "Accept-Encoding")
+		h.Set("Content-Encoding", g.enc.name)
+		h.Del("Content-Length")
+		h.Add("Vary", "Accept-Encoding")
 		g.ResponseWriter.WriteHeader(g.statusCode)
-		if _, err := g.gz.Write(g.buf); err != nil {
-			slog.Warn("compress: gzip write failed", "err", err)
+		g.ew = g.enc.get(g.ResponseWriter)
+		if _, err := g.ew.Write(g.buf); err != nil {
+			slog.Warn("compress: write failed", "encoding", g.enc.name, "err", err)
 		}
 	} else {
+		if h.Get("Content-Encoding") == "" && g.c.compressible(h.Get("Content-Type")) {
+			h.Add("Vary", "Accept-Encoding") // 低于阈值未压缩,但同一资源可能有压缩版本
+		}
 		g.ResponseWriter.WriteHeader(g.statusCode)
-		g.ResponseWriter.Write(g.buf)
+		if len(g.buf) > 0 {
+			g.ResponseWriter.Write(g.buf)
+		}
 	}
 	g.buf = nil
 }
 
-func (g *gzipResponseWriter) close() {
+func (g *compressResponseWriter) close() {
 	if !g.done && len(g.buf) > 0 {
-		ct := g.ResponseWriter.Header().Get("Content-Type")
-		if isCompressible(ct) && (g.minSize == 0 || len(g.buf) >= g.minSize) {
-			g.flush(true)
-		} else {
-			g.flush(false)
-		}
+		g.flush(g.eligible() && (g.c.minSize == 0 || len(g.buf) >= g.c.minSize))
 	} else if !g.done {
 		if !g.wroteHeader {
 			g.statusCode = http.StatusOK
@@ -116,21 +182,28 @@ func (g *gzipResponseWriter) close() {
 		g.ResponseWriter.WriteHeader(g.statusCode)
 	}
 	if g.compressed {
-		g.gz.Close()
+		if err := g.ew.Close(); err != nil {
+			slog.Warn("compress: close failed", "encoding", g.enc.name, "err", err)
+		}
+		g.enc.put(g.ew)
+		g.ew = nil
 	}
 }
 
 // Flush 支持流式响应（SSE / chunked）。没有它，handler 调用 Flush 不会真正下发数据，
 // 全缓冲到 minSize 或 handler 返回才发——流式场景会被破坏。
 // 首次 Flush 时必须定下"压缩与否"，因为流式响应无法再等 minSize 累积。
-func (g *gzipResponseWriter) Flush() {
+func (g *compressResponseWriter) Flush() {
 	if !g.done {
-		ct := g.ResponseWriter.Header().Get("Content-Type")
-		g.flush(isCompressible(ct))
+		if !g.wroteHeader {
+			g.statusCode = http.StatusOK
+			g.wroteHeader = true
+		}
+		g.flush(g.eligible())
 	}
 	if g.compressed {
-		if err := g.gz.Flush(); err != nil {
-			slog.Warn("compress: gzip flush failed", "err", err)
+		if err := g.ew.Flush(); err != nil {
+			slog.Warn("compress: flush failed", "encoding", g.enc.name, "err", err)
 		}
 	}
 	if f, ok := g.ResponseWriter.(http.Flusher); ok {
@@ -140,32 +213,54 @@ func (g *gzipResponseWriter) Flush() {
 
 // Unwrap 暴露底层 ResponseWriter，便于 http.ResponseController 及 Hijacker
 // 等可选接口透传（如 WebSocket 升级）。
-func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+func (g *compressResponseWriter) Unwrap() http.ResponseWriter {
 	return g.ResponseWriter
 }
 
+// Middleware 返回默认配置的压缩中间件,minSize 为压缩阈值(字节),0 表示始终压缩。
+//
+//	webserver.WithMiddleware(compress.Middleware(1024))
 func Middleware(minSize int) func(http.Handler) http.Handler {
+	return NewMiddleware(WithMinSize(minSize))
+}
+
+// NewMiddleware 返回按 opts 配置的压缩中间件。
+//
+//	compress.NewMiddleware(
+//	    compress.WithEncodings(compress.Zstd, compress.Gzip),
+//	    compress.WithLevel(compress.Zstd, 6),
+//	    compress.WithContentTypes("text/", "application/json", "application/grpc-web-text"),
+//	)
+func NewMiddleware(opts ...Option) func(http.Handler) http.Handler {
+	o := &options{minSize: 1024, encodings: defaultEncodings, levels: map[string]int{}, contentTypes: DefaultContentTypes}
+	for _, opt := range opts {
+		opt(o)
+	}
+	c := &compressor{minSize: o.minSize, encoders: map[string]*encoder{}, contentTypes: o.contentTypes}
+	for _, name := range o.encodings {
+		name = strings.ToLower(name)
+		if _, dup := c.encoders[name]; dup {
+			continue
+		}
+		level, ok := o.levels[name]
+		if !ok {
+			level = defaultLevels[name]
+		}
+		if e := newEncoder(name, level); e != nil {
+			c.encoders[name] = e
+			c.prefs = append(c.prefs, name)
+		}
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			enc := negotiate(r.Header.Get("Accept-Encoding"), c.prefs)
+			if enc == "" {
 				next.ServeHTTP(w, r)
 				return
 			}
-
-			gz := gzipPool.Get().(*gzip.Writer)
-			gz.Reset(w)
-			defer func() {
-				gzipPool.Put(gz)
-			}()
-
-			grw := &gzipResponseWriter{
-				ResponseWriter: w,
-				gz:             gz,
-				minSize:        minSize,
-			}
-			defer grw.close()
-
-			next.ServeHTTP(grw, r)
+			crw := &compressResponseWriter{ResponseWriter: w, c: c, enc: c.encoders[enc]}
+			defer crw.close()
+			next.ServeHTTP(crw, r)
 		})
 	}
 }
@@ -3,10 +3,14 @@ package compress
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // 流式响应：handler 调用 Flush 后数据应立即下发到底层 writer，
@@ -22,7 +26,7 @@ func TestCompress_FlushStreams(t *testing.T) {
 
 		f, ok := w.(http.Flusher)
 		if !ok {
-			t.Error("gzipResponseWriter must implement http.Flusher")
+			t.Error("compressResponseWriter must implement http.Flusher")
 			return
 		}
 		f.Flush()
@@ -57,8 +61,234 @@ func TestCompress_FlushStreams(t *testing.T) {
 // Unwrap 应暴露底层 ResponseWriter。
 func TestCompress_Unwrap(t *testing.T) {
 	base := httptest.NewRecorder()
-	grw := &gzipResponseWriter{ResponseWriter: base}
+	grw := &compressResponseWriter{ResponseWriter: base}
 	if grw.Unwrap() != base {
 		t.Fatal("Unwrap must return the underlying ResponseWriter")
 	}
 }
+
+func TestNegotiate(t *testing.T) {
+	prefs := []string{Zstd, Brotli, Gzip, Deflate}
+	cases := []struct{ header, want string }{
+		{"", ""},
+		{"gzip", Gzip},
+		{"gzip, deflate, br, zstd", Zstd},
+		{"gzip;q=1.0, br;q=0.8", Gzip},
+		{"br;q=0.5, gzip;q=0.5", Brotli},
+		{"zstd;q=0, gzip", Gzip},
+		{"*", Zstd},
+		{"*;q=0.1, gzip;q=0.5", Gzip},
+		{"identity", ""},
+		{"x-gzip", Gzip},
+		{"GZIP;Q=0.3", Gzip},
+		{"gzip;q=abc", ""},
+	}
+	for _, c := range cases {
+		if got := negotiate(c.header, prefs); got != c.want {
+			t.Errorf("negotiate(%q) = %q, want %q", c.header, got, c.want)
+		}
+	}
+}
+
+func decode(t *testing.T, enc string, b []byte) string {
+	t.Helper()
+	r, err := newDecoder(enc, bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s reader: %v", enc, err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s decode: %v", enc, err)
+	}
+	return string(out)
+}
+
+func TestCompress_Encodings(t *testing.T) {
+	body := strings.Repeat(`{"hello":"world"}`, 200)
+	for _, enc := range []string{Zstd, Brotli, Gzip, Deflate} {
+		t.Run(enc, func(t *testing.T) {
+			h := NewMiddleware(WithLevel(enc, 99))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, body)
+			}))
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", enc)
+			h.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Content-Encoding"); got != enc {
+				t.Fatalf("Content-Encoding = %q", got)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("Vary = %q", rec.Header().Get("Vary"))
+			}
+			if rec.Body.Len() >= len(body) {
+				t.Fatalf("not compressed: %d >= %d", rec.Body.Len(), len(body))
+			}
+			if got := decode(t, enc, rec.Body.Bytes()); got != body {
+				t.Fatalf("round trip mismatch")
+			}
+		})
+	}
+}
+
+func TestCompress_Skips(t *testing.T) {
+	serve := func(mw func(http.Handler) http.Handler, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip, br, zstd")
+		mw(fn).ServeHTTP(rec, req)
+		return rec
+	}
+	big := strings.Repeat("a", 4096)
+	cases := map[string]http.HandlerFunc{
+		"below min size": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "small")
+		},
+		"content type not allowed": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, big)
+		},
+		"already encoded": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			io.WriteString(w, big)
+		},
+		"partial content": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, big)
+		},
+		"sniffed gzip": func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte{0x1f, 0x8b, 0x08, 0, 0, 0, 0, 0})
+			io.WriteString(w, big)
+		},
+	}
+	for name, fn := range cases {
+		rec := serve(NewMiddleware(), fn)
+		want := ""
+		if name == "already encoded" {
+			want = "gzip" // handler 自己设置的,原样保留
+		}
+		if ce := rec.Header().Get("Content-Encoding"); ce != want {
+			t.Errorf("%s: Content-Encoding = %q, want %q", name, ce, want)
+		}
+		if !strings.HasSuffix(rec.Body.String(), big) && name != "below min size" {
+			t.Errorf("%s: body altered", name)
+		}
+	}
+
+	// 白名单可替换
+	rec := serve(NewMiddleware(WithContentTypes("image/svg+xml")), func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		io.WriteString(w, big)
+	})
+	if rec.Header().Get("Content-Encoding") != Zstd {
+		t.Errorf("svg: Content-Encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+	// 仅启用 gzip 时不协商出 zstd
+	rec = serve(NewMiddleware(WithEncodings(Gzip)), func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, big)
+	})
+	if rec.Header().Get("Content-Encoding") != Gzip {
+		t.Errorf("gzip only: Content-Encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+// zstd / br 同样支持流式 flush。
+func TestCompress_FlushStreamsZstd(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var atFlush []byte
+	h := NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		atFlush = append([]byte(nil), rec.Body.Bytes()...)
+		io.WriteString(w, "data: 2\n\n")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != Zstd {
+		t.Fatalf("Content-Encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+	d, _ := zstd.NewReader(nil)
+	defer d.Close()
+	var partial bytes.Buffer
+	d.Reset(bytes.NewReader(atFlush))
+	io.Copy(&partial, d) // 流未结束,读到已 flush 的部分后报 EOF
+	if partial.String() != "data: 1\n\n" {
+		t.Fatalf("flushed part = %q", partial.String())
+	}
+	if got := decode(t, Zstd, rec.Body.Bytes()); got != "data: 1\n\ndata: 2\n\n" {
+		t.Fatalf("stream = %q", got)
+	}
+}
+
+func compressed(t *testing.T, enc string, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	e := newEncoder(enc, defaultLevels[enc])
+	w := e.get(&buf)
+	io.WriteString(w, s)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	echo := Decompress(64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Error("Content-Encoding should be removed")
+		}
+		b, err := io.ReadAll(r.Body)
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(b)
+	}))
+	post := func(ce string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", ce)
+		rec := httptest.NewRecorder()
+		echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, enc := range []string{Zstd, Brotli, Gzip, Deflate} {
+		if rec := post(enc, compressed(t, enc, "hello")); rec.Body.String() != "hello" {
+			t.Errorf("%s: got %d %q", enc, rec.Code, rec.Body.String())
+		}
+	}
+	// 叠加编码:先 gzip 再 br
+	if rec := post("gzip, br", compressed(t, Brotli, string(compressed(t, Gzip, "stacked")))); rec.Body.String() != "stacked" {
+		t.Errorf("stacked: got %d %q", rec.Code, rec.Body.String())
+	}
+	// 解压后超过上限
+	if rec := post(Gzip, compressed(t, Gzip, strings.Repeat("x", 1000))); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("bomb: code = %d", rec.Code)
+	}
+	rec := post("compress", []byte("x"))
+	if rec.Code != http.StatusUnsupportedMediaType || rec.Header().Get("Accept-Encoding") == "" {
+		t.Errorf("unsupported: code = %d, Accept-Encoding = %q", rec.Code, rec.Header().Get("Accept-Encoding"))
+	}
+	if rec := post(Gzip, []byte("not gzip")); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed: code = %d", rec.Code)
+	}
+	// 叠加超过 2 种编码直接拒绝,不逐项分配解码器
+	if rec := post("gzip, gzip, gzip", compressed(t, Gzip, "x")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("too many codings: code = %d", rec.Code)
+	}
+	// 池化的 zstd 解码器被复用后仍能正确解码
+	for _, msg := range []string{"first", "second"} {
+		if rec := post(Zstd, compressed(t, Zstd, msg)); rec.Body.String() != msg {
+			t.Errorf("zstd reuse: got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rushteam/beauty/pkg/middleware/bodylimit"
+)
+
+// maxZstdWindow 限制解压 zstd 请求体时的窗口(即内存)上限,与浏览器侧对 HTTP zstd 的约定一致(8MiB)。
+const maxZstdWindow = 8 << 20
+
+// maxCodings 限制 Content-Encoding 可叠加的编码数(identity 不计),
+// 防止 "gzip, gzip, …" 这样的头让服务端为每一项分配一个解码器。
+const maxCodings = 2
+
+// zstdDecoders 复用 zstd 解码器,对应响应侧的 writer 池。并发度 1 时解码器不起后台 goroutine,
+// 不 Close 直接放回池中是安全的。
+var zstdDecoders = sync.Pool{New: func() any {
+	d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+	return d
+}}
+
+// Decompress 返回请求体解压中间件:按请求的 Content-Encoding(zstd / br / gzip / deflate,可叠加)
+// 解码 r.Body,并删除 Content-Encoding / Content-Length 头,下游读到的就是原文。
+// 解压后的大小由 bodylimit 限制为 maxBytes(<= 0 不限制),超限时读取报 *http.MaxBytesError,
+// 防止压缩炸弹;压缩后的传输大小仍应由外层 bodylimit.Middleware 限制。
+// 不支持的编码回 415,并在 Accept-Encoding 头中列出支持的编码(RFC 7694);叠加超过 2 种编码回 415;
+// 请求体头部损坏回 400。
+//
+//	mux.Use(bodylimit.Middleware(1 << 20))       // 传输大小 ≤ 1MB
+//	mux.Use(compress.Decompress(10 << 20))       // 解压后 ≤ 10MB
+func Decompress(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := bodylimit.Middleware(maxBytes)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ce := r.Header.Get("Content-Encoding")
+			if ce == "" || r.Body == nil || r.Body == http.NoBody {
+				limited.ServeHTTP(w, r)
+				return
+			}
+			var codings []string
+			for _, c := range strings.Split(ce, ",") {
+				if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+					codings = append(codings, c)
+				}
+			}
+			if len(codings) > maxCodings {
+				http.Error(w, "too many content encodings", http.StatusUnsupportedMediaType)
+				return
+			}
+			var closers []io.Closer
+			defer func() {
+				for _, c := range closers {
+					c.Close()
+				}
+			}()
+			body := io.Reader(r.Body)
+			// 多个编码按施加顺序列出,解码时从后往前。
+			for i := len(codings) - 1; i >= 0; i-- {
+				dec, err := newDecoder(codings[i], body)
+				if errors.Is(err, errUnsupportedEncoding) {
+					w.Header().Set("Accept-Encoding", strings.Join(defaultEncodings, ", "))
+					http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+					return
+				}
+				if err != nil {
+					http.Error(w, "malformed request body", http.StatusBadRequest)
+					return
+				}
+				closers = append(closers, dec)
+				body = dec
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{body, r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+var errUnsupportedEncoding = errors.New("compress: unsupported content encoding")
+
+func newDecoder(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case Gzip, "x-gzip":
+		return gzip.NewReader(r)
+	case Deflate:
+		return zlib.NewReader(r)
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case Zstd:
+		d := zstdDecoders.Get().(*zstd.Decoder)
+		if err := d.Reset(r); err != nil {
+			_ = d.Reset(nil)
+			zstdDecoders.Put(d)
+			return nil, err
+		}
+		return &zstdReader{d: d}, nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// zstdReader 在 Close 时把解码器放回 zstdDecoders。
+type zstdReader struct{ d *zstd.Decoder }
+
+func (z *zstdReader) Read(p []byte) (int, error) { return z.d.Read(p) }
+
+func (z *zstdReader) Close() error {
+	if z.d != nil {
+		_ = z.d.Reset(nil) // 释放对请求体的引用
+		zstdDecoders.Put(z.d)
+		z.d = nil
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 支持的内容编码(Content-Encoding / Accept-Encoding 取值)。
+const (
+	Zstd    = "zstd"
+	Brotli  = "br"
+	Gzip    = "gzip"
+	Deflate = "deflate" // HTTP 的 deflate 是 zlib 封装(RFC 1950),不是裸 DEFLATE
+)
+
+// defaultEncodings 是默认启用的编码,也是 q 值相同时服务端的偏好顺序。
+var defaultEncodings = []string{Zstd, Brotli, Gzip, Deflate}
+
+// 各编码的默认压缩级别:动态内容偏向速度。
+var defaultLevels = map[string]int{
+	Zstd:    3, // zstd 官方默认
+	Brotli:  4, // 11 级对动态响应太慢,4~5 与 gzip 6 速度相当、压缩率更好
+	Gzip:    gzip.DefaultCompression,
+	Deflate: zlib.DefaultCompression,
+}
+
+// encWriter 是各编码 writer 的公共方法集(gzip / zlib / brotli / zstd 均满足)。
+type encWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// encoder 是一种编码在固定级别下的 writer 池。
+type encoder struct {
+	name string
+	pool sync.Pool
+}
+
+func newEncoder(name string, level int) *encoder {
+	e := &encoder{name: name}
+	switch name {
+	case Zstd:
+		lv := zstd.EncoderLevelFromZstd(level)
+		e.pool.New = func() any {
+			// 并发度 1:HTTP 响应是单条流,多 goroutine 编码只会增加内存与调度开销。
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(lv), zstd.WithEncoderConcurrency(1))
+			return w
+		}
+	case Brotli:
+		level = clamp(level, brotli.BestSpeed, brotli.BestCompression)
+		e.pool.New = func() any { return brotli.NewWriterLevel(nil, level) }
+	case Gzip:
+		level = clamp(level, gzip.HuffmanOnly, gzip.BestCompression)
+		e.pool.New = func() any { w, _ := gzip.NewWriterLevel(nil, level); return w }
+	case Deflate:
+		level = clamp(level, zlib.HuffmanOnly, zlib.BestCompression)
+		e.pool.New = func() any { w, _ := zlib.NewWriterLevel(nil, level); return w }
+	default:
+		return nil
+	}
+	return e
+}
+
+func (e *encoder) get(w io.Writer) encWriter {
+	ew := e.pool.Get().(encWriter)
+	ew.Reset(w)
+	return ew
+}
+
+func (e *encoder) put(ew encWriter) { e.pool.Put(ew) }
+
+func clamp(v, lo, hi int) int { return min(max(v, lo), hi) }
+
+// negotiate 按 Accept-Encoding 的 q 值在 prefs 中选出编码:q 最高者胜,q 相同按 prefs 顺序;
+// 未列出的编码取 "*" 的 q 值。没有可接受的编码时返回空串(不压缩)。
+func negotiate(header string, prefs []string) string {
+	if header == "" {
+		return ""
+	}
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "x-gzip" {
+			name = Gzip
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || f < 0 || f > 1 {
+					f = 0
+				}
+				q = f
+			}
+		}
+		qs[name] = q
+	}
+	wildcard, hasWildcard := qs["*"]
+	best, bestQ := "", 0.0
+	for _, enc := range prefs {
+		q, ok := qs[enc]
+		if !ok {
+			if !hasWildcard {
+				continue
+			}
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,405 @@
+// Package csrf 提供面向浏览器的跨站请求伪造(CSRF)防护中间件。
+//
+// 两种令牌模式:
+//   - ModeDoubleSubmit(默认):令牌放在 cookie 中,写请求须在请求头/表单字段回传同一值。
+//     配置 WithSecret 后令牌带 HMAC 签名并与会话绑定(OWASP 推荐的 signed double-submit),
+//     子域写入的伪造 cookie 无法通过校验;
+//   - ModeSynchronizer:令牌保存在服务端 TokenStore,按会话 ID 索引,写请求回传的值须与之相等。
+//     需要 WithSessionID 提供会话标识。
+//
+// 令牌校验之前先做来源检查:Sec-Fetch-Site 为 cross-site、或 Origin(缺省时 Referer)
+// 与本站及 WithTrustedOrigins 都不匹配的写请求直接拒绝。GET/HEAD/OPTIONS/TRACE 视为安全方法,
+// 不校验,但会下发/续期令牌,页面模板用 Token(ctx) 取出嵌入表单或 meta。
+//
+// 返回标准 func(http.Handler) http.Handler,可全局挂载,也可经 handler.WithMiddleware
+// 按路由挂不同配置;WithSkipper 用于豁免个别路径(如第三方回调)。
+package csrf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/store/cache"
+)
+
+// Mode 令牌模式。
+type Mode int
+
+const (
+	ModeDoubleSubmit Mode = iota // cookie + 回传,无服务端状态
+	ModeSynchronizer             // 服务端保存令牌
+)
+
+// 拒绝原因,传给 ErrorHandler。
+const (
+	ReasonCrossSite     = "cross_site"     // Sec-Fetch-Site: cross-site
+	ReasonOriginInvalid = "origin_invalid" // Origin/Referer 不在允许列表
+	ReasonTokenMissing  = "token_missing"  // 未回传令牌或无令牌可比对
+	ReasonTokenInvalid  = "token_invalid"  // 令牌不匹配或签名无效
+)
+
+// TokenStore 是同步令牌模式的服务端存储。实现须并发安全。
+type TokenStore interface {
+	Get(ctx context.Context, sessionID string) (string, bool, error)
+	Set(ctx context.Context, sessionID, token string) error
+}
+
+// Option 配置中间件。
+type Option func(*options)
+
+type options struct {
+	mode           Mode
+	secret         []byte
+	cookieName     string
+	cookiePath     string
+	cookieDomain   string
+	cookieMaxAge   int
+	cookieSecure   bool
+	sameSite       http.SameSite
+	headerName     string
+	fieldName      string
+	trustedOrigins []string
+	store          TokenStore
+	sessionID      func(*http.Request) string
+	skipper        func(*http.Request) bool
+	errorHandler   func(w http.ResponseWriter, r *http.Request, reason string)
+}
+
+// WithMode 选择令牌模式(默认 ModeDoubleSubmit)。
+func WithMode(m Mode) Option { return func(o *options) { o.mode = m } }
+
+// WithSecret 设置双提交令牌的 HMAC 密钥;未设置时退化为朴素双提交(仅比较 cookie 与回传值)。
+func WithSecret(secret []byte) Option { return func(o *options) { o.secret = secret } }
+
+// WithCookie 设置令牌 cookie 的名称、路径与域(默认 "csrf_token"、"/"、当前域)。
+func WithCookie(name, path, domain string) Option {
+	return func(o *options) { o.cookieName, o.cookiePath, o.cookieDomain = name, path, domain }
+}
+
+// WithCookieMaxAge 设置 cookie 有效期(秒);0 为会话 cookie(默认)。
+func WithCookieMaxAge(seconds int) Option { return func(o *options) { o.cookieMaxAge = seconds } }
+
+// WithInsecureCookie 去掉 cookie 的 Secure 属性,仅用于本地 http 开发。
+func WithInsecureCookie() Option { return func(o *options) { o.cookieSecure = false } }
+
+// WithSameSite 设置 cookie 的 SameSite(默认 Lax)。
+func WithSameSite(s http.SameSite) Option { return func(o *options) { o.sameSite = s } }
+
+// WithHeaderName 设置回传令牌的请求头(默认 "X-CSRF-Token")。
+func WithHeaderName(name string) Option { return func(o *options) { o.headerName = name } }
+
+// WithFormField 设置回传令牌的表单字段(默认 "csrf_token");空串表示只接受请求头。
+func WithFormField(name string) Option { return func(o *options) { o.fieldName = name } }
+
+// WithTrustedOrigins 追加允许发起写请求的来源,形如 "https://app.example.com";
+// 本站(按请求 Host)总是允许。
+func WithTrustedOrigins(origins ...string) Option {
+	return func(o *options) {
+		for _, s := range origins {
+			o.trustedOrigins = append(o.trustedOrigins, strings.ToLower(strings.TrimRight(s, "/")))
+		}
+	}
+}
+
+// WithTokenStore 设置同步令牌模式的存储(默认 NewMemoryStore():进程内、有容量上限与闲置过期,
+// 多实例部署需换成共享存储)。
+func WithTokenStore(s TokenStore) Option { return func(o *options) { o.store = s } }
+
+// WithSessionID 提供会话标识:同步令牌模式必需;双提交模式下用于把签名令牌绑定到会话。
+// 返回空串表示匿名会话。
+func WithSessionID(fn func(*http.Request) string) Option {
+	return func(o *options) { o.sessionID = fn }
+}
+
+// WithSkipper 返回 true 的请求完全跳过本中间件(不校验也不下发令牌)。
+func WithSkipper(fn func(*http.Request) bool) Option { return func(o *options) { o.skipper = fn } }
+
+// WithErrorHandler 自定义拒绝响应;默认 403 纯文本。
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, reason string)) Option {
+	return func(o *options) { o.errorHandler = fn }
+}
+
+var tokenKey = ctxkey.New[string]()
+
+// Token 返回当前请求可用的 CSRF 令牌,用于渲染表单隐藏字段或 meta 标签;未经过中间件时返回空串。
+func Token(ctx context.Context) string { return ctxkey.MustGet(ctx, tokenKey) }
+
+// Middleware 返回 CSRF 防护中间件。
+//
+//	mux.Handle("/", csrf.Middleware(csrf.WithSecret(key))(app))
+func Middleware(opts ...Option) func(http.Handler) http.Handler {
+	o := &options{
+		cookieName:   "csrf_token",
+		cookiePath:   "/",
+		cookieSecure: true,
+		sameSite:     http.SameSiteLaxMode,
+		headerName:   "X-CSRF-Token",
+		fieldName:    "csrf_token",
+		errorHandler: defaultError,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if o.mode == ModeSynchronizer && o.store == nil {
+		o.store = NewMemoryStore()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.skipper != nil && o.skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Cookie")
+			if !safeMethod(r.Method) {
+				if reason := o.checkOrigin(r); reason != "" {
+					o.errorHandler(w, r, reason)
+					return
+				}
+			}
+			token, reason := o.current(r)
+			if !safeMethod(r.Method) {
+				if reason == "" {
+					reason = o.verify(r, token)
+				}
+				if reason != "" {
+					o.errorHandler(w, r, reason)
+					return
+				}
+			}
+			if token == "" && reason == "" { // 同步令牌模式下无会话的安全请求不下发令牌
+				var err error
+				if token, err = o.issue(w, r); err != nil {
+					http.Error(w, "csrf: issue token failed", http.StatusInternalServerError)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(ctxkey.With(r.Context(), tokenKey, token)))
+		})
+	}
+}
+
+func safeMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// checkOrigin 做来源检查;无任何来源信息(老浏览器/非浏览器客户端)时交给令牌校验。
+func (o *options) checkOrigin(r *http.Request) string {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return ""
+	case "cross-site":
+		if !o.originAllowed(r, r.Header.Get("Origin")) {
+			return ReasonCrossSite
+		}
+		return ""
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		ref := r.Header.Get("Referer")
+		if ref == "" {
+			if origin == "null" {
+				return ReasonOriginInvalid
+			}
+			return ""
+		}
+		u, err := url.Parse(ref)
+		if err != nil || u.Host == "" {
+			return ReasonOriginInvalid
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if !o.originAllowed(r, origin) {
+		return ReasonOriginInvalid
+	}
+	return ""
+}
+
+func (o *options) originAllowed(r *http.Request, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, t := range o.trustedOrigins {
+		if t == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// current 取出本请求已有的令牌(cookie 或服务端存储)。
+func (o *options) current(r *http.Request) (string, string) {
+	if o.mode == ModeSynchronizer {
+		sid := o.sid(r)
+		if sid == "" {
+			return "", ReasonTokenMissing
+		}
+		tok, ok, err := o.store.Get(r.Context(), sid)
+		if err != nil || !ok {
+			return "", ""
+		}
+		return tok, ""
+	}
+	c, err := r.Cookie(o.cookieName)
+	if err != nil || c.Value == "" {
+		return "", ""
+	}
+	if o.secret != nil && !o.validSigned(r, c.Value) {
+		return "", "" // 签名无效:当作没有,安全方法会重新下发
+	}
+	return c.Value, ""
+}
+
+func (o *options) verify(r *http.Request, token string) string {
+	if token == "" {
+		return ReasonTokenMissing
+	}
+	sent := r.Header.Get(o.headerName)
+	if sent == "" && o.fieldName != "" {
+		sent = r.PostFormValue(o.fieldName)
+	}
+	if sent == "" {
+		return ReasonTokenMissing
+	}
+	if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		return ReasonTokenInvalid
+	}
+	return ""
+}
+
+func (o *options) issue(w http.ResponseWriter, r *http.Request) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if o.mode == ModeSynchronizer {
+		if err := o.store.Set(r.Context(), o.sid(r), raw); err != nil {
+			return "", err
+		}
+		return raw, nil
+	}
+	token := raw
+	if o.secret != nil {
+		token = raw + "." + o.sign(r, raw)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.cookieName,
+		Value:    token,
+		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
+		MaxAge:   o.cookieMaxAge,
+		Secure:   o.cookieSecure,
+		HttpOnly: false, // 前端 JS 需要读出并放入请求头
+		SameSite: o.sameSite,
+	})
+	return token, nil
+}
+
+func (o *options) sid(r *http.Request) string {
+	if o.sessionID == nil {
+		return ""
+	}
+	return o.sessionID(r)
+}
+
+func (o *options) sign(r *http.Request, raw string) string {
+	mac := hmac.New(sha256.New, o.secret)
+	sid := o.sid(r)
+	mac.Write([]byte(sid))
+	mac.Write([]byte{0})
+	mac.Write([]byte(raw))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (o *options) validSigned(r *http.Request, token string) bool {
+	raw, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(o.sign(r, raw)))
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func defaultError(w http.ResponseWriter, _ *http.Request, reason string) {
+	http.Error(w, "csrf: "+reason, http.StatusForbidden)
+}
+
+// MemoryStore 是进程内 TokenStore,适合单实例或测试。容量有上限(LRU 淘汰最久未用的会话),
+// 令牌在最后一次使用后 TTL 内有效;被淘汰或过期的会话在下一次安全方法请求时重新下发令牌。
+type MemoryStore struct {
+	c   *cache.LRU[string, memToken]
+	ttl time.Duration
+	now func() time.Time
+}
+
+type memToken struct {
+	token string
+	exp   time.Time
+}
+
+// MemoryStoreOption 配置 MemoryStore。
+type MemoryStoreOption func(*MemoryStore)
+
+// WithMemoryCapacity 设置最多保存的会话数,默认 100000。
+func WithMemoryCapacity(n int) MemoryStoreOption {
+	return func(s *MemoryStore) { s.c = cache.NewLRU[string, memToken](n) }
+}
+
+// WithMemoryTTL 设置令牌闲置多久后失效,默认 12 小时;<=0 表示不过期(只靠容量淘汰)。
+func WithMemoryTTL(d time.Duration) MemoryStoreOption {
+	return func(s *MemoryStore) { s.ttl = d }
+}
+
+// NewMemoryStore 创建进程内令牌存储。
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	s := &MemoryStore{c: cache.NewLRU[string, memToken](100000), ttl: 12 * time.Hour, now: time.Now}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+func (s *MemoryStore) Get(_ context.Context, sessionID string) (string, bool, error) {
+	v, ok := s.c.Get(sessionID)
+	if !ok {
+		return "", false, nil
+	}
+	if s.ttl > 0 {
+		now := s.now()
+		if now.After(v.exp) {
+			s.c.Delete(sessionID)
+			return "", false, nil
+		}
+		v.exp = now.Add(s.ttl) // 滑动过期:活跃会话不会中途失效
+		s.c.Set(sessionID, v)
+	}
+	return v.token, true, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, sessionID, token string) error {
+	s.c.Set(sessionID, memToken{token: token, exp: s.now().Add(s.ttl)})
+	return nil
+}
@@ -0,0 +1,186 @@
+package csrf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type result struct {
+	code   int
+	token  string
+	cookie *http.Cookie
+	body   string
+}
+
+func do(mw func(http.Handler) http.Handler, r *http.Request) result {
+	var res result
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res.token = Token(r.Context())
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	res.code, res.body = rec.Code, rec.Body.String()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "csrf_token" {
+			res.cookie = c
+		}
+	}
+	return res
+}
+
+func post(path, token string, cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "http://example.com"+path, nil)
+	r.Header.Set("Origin", "http://example.com")
+	if token != "" {
+		r.Header.Set("X-CSRF-Token", token)
+	}
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	mw := Middleware(WithSecret([]byte("k")), WithSessionID(func(r *http.Request) string { return r.Header.Get("X-Session") }))
+
+	get := do(mw, httptest.NewRequest(http.MethodGet, "http://example.com/form", nil))
+	if get.code != http.StatusOK || get.cookie == nil || get.token != get.cookie.Value {
+		t.Fatalf("GET should issue token: %+v", get)
+	}
+	if !get.cookie.Secure || get.cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("cookie attrs: %+v", get.cookie)
+	}
+
+	if res := do(mw, post("/submit", get.token, get.cookie)); res.code != http.StatusOK || res.token != get.token {
+		t.Fatalf("valid POST: %+v", res)
+	}
+	if res := do(mw, post("/submit", "", get.cookie)); res.code != http.StatusForbidden || !strings.Contains(res.body, ReasonTokenMissing) {
+		t.Fatalf("missing token: %+v", res)
+	}
+	if res := do(mw, post("/submit", "forged", get.cookie)); res.code != http.StatusForbidden || !strings.Contains(res.body, ReasonTokenInvalid) {
+		t.Fatalf("mismatched token: %+v", res)
+	}
+	// 攻击者自己种的 cookie(无有效签名)即使与回传值一致也被拒。
+	forged := &http.Cookie{Name: "csrf_token", Value: "abc.def"}
+	if res := do(mw, post("/submit", "abc.def", forged)); res.code != http.StatusForbidden {
+		t.Fatalf("unsigned cookie accepted: %+v", res)
+	}
+	// 签名绑定会话:换会话后旧令牌失效。
+	r := post("/submit", get.token, get.cookie)
+	r.Header.Set("X-Session", "other")
+	if res := do(mw, r); res.code != http.StatusForbidden {
+		t.Fatalf("token reused across sessions: %+v", res)
+	}
+	// 表单字段回传。
+	form := url.Values{"csrf_token": {get.token}}
+	r = httptest.NewRequest(http.MethodPost, "http://example.com/submit", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(get.cookie)
+	if res := do(mw, r); res.code != http.StatusOK {
+		t.Fatalf("form field: %+v", res)
+	}
+}
+
+func TestOriginChecks(t *testing.T) {
+	mw := Middleware(WithTrustedOrigins("https://app.example.org/"))
+	get := do(mw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	cases := []struct {
+		name   string
+		set    map[string]string
+		reason string
+	}{
+		{"cross-site fetch", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.test"}, ReasonCrossSite},
+		{"foreign origin", map[string]string{"Origin": "https://evil.test"}, ReasonOriginInvalid},
+		{"foreign referer", map[string]string{"Origin": "", "Referer": "https://evil.test/page"}, ReasonOriginInvalid},
+		{"opaque origin", map[string]string{"Origin": "null"}, ReasonOriginInvalid},
+		{"trusted origin", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.org"}, ""},
+		{"same-origin fetch", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": ""}, ""},
+	}
+	for _, c := range cases {
+		r := post("/", get.token, get.cookie)
+		for k, v := range c.set {
+			if v == "" {
+				r.Header.Del(k)
+			} else {
+				r.Header.Set(k, v)
+			}
+		}
+		res := do(mw, r)
+		if c.reason == "" && res.code != http.StatusOK || c.reason != "" && !strings.Contains(res.body, c.reason) {
+			t.Errorf("%s: code=%d body=%q", c.name, res.code, res.body)
+		}
+	}
+}
+
+func TestSynchronizer(t *testing.T) {
+	store := NewMemoryStore()
+	mw := Middleware(WithMode(ModeSynchronizer), WithTokenStore(store),
+		WithSessionID(func(r *http.Request) string { return r.Header.Get("X-Session") }))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.Header.Set("X-Session", "s1")
+	get := do(mw, r)
+	if get.token == "" || get.cookie != nil {
+		t.Fatalf("synchronizer GET: %+v", get)
+	}
+	if tok, ok, _ := store.Get(context.Background(), "s1"); !ok || tok != get.token {
+		t.Fatalf("store=%q", tok)
+	}
+
+	r = post("/", get.token, nil)
+	r.Header.Set("X-Session", "s1")
+	if res := do(mw, r); res.code != http.StatusOK {
+		t.Fatalf("valid POST: %+v", res)
+	}
+	r = post("/", get.token, nil)
+	r.Header.Set("X-Session", "s2")
+	if res := do(mw, r); res.code != http.StatusForbidden {
+		t.Fatalf("other session: %+v", res)
+	}
+	// 无会话:安全请求放行但不下发令牌,写请求拒绝。
+	if res := do(mw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil)); res.code != http.StatusOK || res.token != "" {
+		t.Fatalf("anonymous GET: %+v", res)
+	}
+	if res := do(mw, post("/", "x", nil)); res.code != http.StatusForbidden {
+		t.Fatalf("anonymous POST: %+v", res)
+	}
+}
+
+func TestSkipper(t *testing.T) {
+	mw := Middleware(WithSkipper(func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/webhooks/") }))
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/webhooks/pay", nil)
+	r.Header.Set("Origin", "https://psp.test")
+	if res := do(mw, r); res.code != http.StatusOK {
+		t.Fatalf("skipped path rejected: %+v", res)
+	}
+}
+
+func TestMemoryStoreBounded(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore(WithMemoryCapacity(2), WithMemoryTTL(time.Minute))
+	s.now = func() time.Time { return now }
+	s.Set(ctx, "a", "1")
+	s.Set(ctx, "b", "2")
+	s.Set(ctx, "c", "3")
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Fatal("oldest session should be evicted at capacity")
+	}
+	now = now.Add(50 * time.Second)
+	if tok, ok, _ := s.Get(ctx, "b"); !ok || tok != "2" {
+		t.Fatalf("b = %q, %v", tok, ok)
+	}
+	now = now.Add(50 * time.Second)
+	if _, ok, _ := s.Get(ctx, "c"); ok {
+		t.Fatal("idle token should expire")
+	}
+	if _, ok, _ := s.Get(ctx, "b"); !ok {
+		t.Fatal("recently used token should slide")
+	}
+}
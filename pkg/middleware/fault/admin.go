@@ -0,0 +1,58 @@
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// State 是管理端点 GET 的响应。
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Rules   []Rule `json:"rules"`
+	Stats   Stats  `json:"stats"`
+}
+
+// Handler 返回规则管理端点:
+//
+//	GET    → State(是否可用、当前规则、计数)
+//	PUT    → 请求体为 Document,校验后整体替换,回 204;规则非法回 400
+//	DELETE → 清空规则,回 204
+//
+// 生产环境的写操作回 403。接口本身不鉴权,挂载时请包一层认证中间件。
+//
+//	mux.Handle("/internal/fault", adminAuth(inj.Handler()))
+func (i *Injector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			rules := i.Rules()
+			if rules == nil {
+				rules = []Rule{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			_ = json.NewEncoder(w).Encode(State{Enabled: i.Enabled(), Rules: rules, Stats: i.Stats()})
+		case http.MethodPut, http.MethodDelete:
+			var doc Document
+			if r.Method == http.MethodPut {
+				if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&doc); err != nil {
+					http.Error(w, "invalid fault rules", http.StatusBadRequest)
+					return
+				}
+			}
+			if err := i.SetRules(doc.Rules); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, ErrProduction) {
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,381 @@
+// Package fault 提供故障注入中间件，用于在测试/预发环境演练故障，不依赖外部混沌工具。
+//
+// 规则按 路径 / 方法 / header / 租户 / 百分比 匹配请求，命中后注入：
+//   - 延迟(Delay + 随机 Jitter);
+//   - 中止(Abort):返回指定 HTTP 状态码或 api/errors 业务码;
+//   - 连接重置(Reset):HTTP 直接 RST 连接,gRPC/mq 返回等价的传输错误;
+//   - 响应截断(Truncate):HTTP 写出前 N 字节后断开,gRPC 服务端流发出 N 条消息后中断。
+//
+// 同一 Injector 可同时挂在 HTTP(HTTPMiddleware)、gRPC 服务端/客户端(*Interceptor)与
+// mq 消费端(MQMiddleware)。规则可运行时切换:WatchConfig 跟随 pkg/conf 热更新,
+// Handler 提供管理端点(GET 查看 / PUT 替换 / DELETE 清空)。
+//
+// 生产保护:环境变量 APP_ENV(可用 WithEnvVar 更换)为 prod / production 时 Injector
+// 永久停用——规则不会生效,SetRules 返回 ErrProduction。
+//
+//	inj := fault.New()
+//	_ = inj.WatchConfig(ctx, loader) // 配置键见 Document
+//	mux.Handle("/internal/fault", adminAuth(inj.Handler()))
+//	handler := fault.HTTPMiddleware(inj)(mux)
+//
+//	# fault.yaml
+//	rules:
+//	  - name: slow-orders
+//	    paths: ["/orders/*"]
+//	    methods: [POST]
+//	    percentage: 20
+//	    delay: 300ms
+//	    jitter: 200ms
+//	  - name: payments-down
+//	    paths: ["/pay.v1.Payment/*"]
+//	    tenants: [t-canary]
+//	    abort: {code: 503, message: "injected"}
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/conf"
+	"github.com/rushteam/beauty/pkg/middleware/tenant"
+)
+
+// ErrProduction 表示当前环境被识别为生产环境，故障注入已停用。
+var ErrProduction = errors.New("fault: injection disabled in production")
+
+// ErrInjectedReset 是注入"连接重置"时 mq 处理返回的错误。
+var ErrInjectedReset = errors.New("fault: injected connection reset")
+
+// DefaultEnvVar 是判定生产环境的默认环境变量。
+const DefaultEnvVar = "APP_ENV"
+
+// Kind 是请求来源,用于限定规则只作用于某类入口。
+type Kind string
+
+const (
+	KindHTTP       Kind = "http"
+	KindGRPC       Kind = "grpc"        // gRPC 服务端
+	KindGRPCClient Kind = "grpc_client" // gRPC 客户端(出站调用)
+	KindMQ         Kind = "mq"
+)
+
+// Duration 是可从 "300ms" 这类字符串(或纳秒整数)解码的时长。
+type Duration time.Duration
+
+// MarshalJSON 输出 "300ms" 形式。
+func (d Duration) MarshalJSON() ([]byte, error) { return json.Marshal(time.Duration(d).String()) }
+
+// UnmarshalJSON 接受字符串时长或纳秒整数。
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("fault: invalid duration %s", b)
+	}
+	*d = Duration(n)
+	return nil
+}
+
+// Abort 描述中止动作。Code 非 0 时按 api/errors 业务码返回(HTTP 走 errors.WriteHTTP,
+// gRPC 走 errors.ToGRPC);否则 HTTP 返回 HTTPStatus,gRPC 按该状态码映射到相近的 gRPC code。
+type Abort struct {
+	Code       int32  `json:"code,omitempty" yaml:"code,omitempty"`
+	HTTPStatus int    `json:"http_status,omitempty" yaml:"http_status,omitempty"`
+	Message    string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Rule 是一条注入规则。匹配条件之间为"与",同一条件内多个取值为"或";空条件不限制。
+// 多条规则按顺序匹配,第一条命中的生效。
+type Rule struct {
+	Name string `json:"name" yaml:"name"`
+
+	Kinds   []Kind            `json:"kinds,omitempty" yaml:"kinds,omitempty"`     // 限定入口,空为全部
+	Paths   []string          `json:"paths,omitempty" yaml:"paths,omitempty"`     // path.Match 模式:HTTP 路径 / gRPC 全方法名 / mq topic
+	Methods []string          `json:"methods,omitempty" yaml:"methods,omitempty"` // HTTP 方法(gRPC/mq 不参与)
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // 值为 "*" 表示存在即可
+	Tenants []string          `json:"tenants,omitempty" yaml:"tenants,omitempty"` // tenant.FromContext
+	// Percentage 命中比例(0–100],0 视为 100。
+	Percentage float64 `json:"percentage,omitempty" yaml:"percentage,omitempty"`
+
+	Delay    Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	Jitter   Duration `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	Abort    *Abort   `json:"abort,omitempty" yaml:"abort,omitempty"`
+	Reset    bool     `json:"reset,omitempty" yaml:"reset,omitempty"`
+	Truncate int      `json:"truncate,omitempty" yaml:"truncate,omitempty"` // HTTP 字节数 / gRPC 流消息数
+}
+
+func (r Rule) validate() error {
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("fault: rule %q: percentage %v out of range [0,100]", r.Name, r.Percentage)
+	}
+	if r.Delay < 0 || r.Jitter < 0 || r.Truncate < 0 {
+		return fmt.Errorf("fault: rule %q: negative delay/jitter/truncate", r.Name)
+	}
+	for _, p := range r.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("fault: rule %q: bad path pattern %q", r.Name, p)
+		}
+	}
+	if r.Abort != nil && r.Abort.Code == 0 && (r.Abort.HTTPStatus < 400 || r.Abort.HTTPStatus > 599) {
+		return fmt.Errorf("fault: rule %q: abort needs code or http_status in 4xx/5xx", r.Name)
+	}
+	if r.Delay == 0 && r.Jitter == 0 && r.Abort == nil && !r.Reset && r.Truncate == 0 {
+		return fmt.Errorf("fault: rule %q: no fault configured", r.Name)
+	}
+	return nil
+}
+
+// Request 是参与匹配的请求视图,由各入口中间件构造。
+type Request struct {
+	Kind   Kind
+	Path   string
+	Method string
+	Header func(key string) string
+}
+
+func (r Rule) matches(ctx context.Context, req Request) bool {
+	if len(r.Kinds) > 0 && !contains(r.Kinds, req.Kind) {
+		return false
+	}
+	if len(r.Paths) > 0 {
+		ok := false
+		for _, p := range r.Paths {
+			if m, _ := path.Match(p, req.Path); m {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.Methods) > 0 && req.Method != "" {
+		ok := false
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, req.Method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for k, want := range r.Headers {
+		got := ""
+		if req.Header != nil {
+			got = req.Header(k)
+		}
+		if got == "" || (want != "*" && got != want) {
+			return false
+		}
+	}
+	if len(r.Tenants) > 0 && !contains(r.Tenants, tenant.FromContext(ctx)) {
+		return false
+	}
+	return true
+}
+
+func contains[T comparable](xs []T, x T) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats 是注入计数(自创建起累计)。
+type Stats struct {
+	Matched   uint64 // 命中规则(已过百分比抽样)
+	Delayed   uint64
+	Aborted   uint64
+	Reset     uint64
+	Truncated uint64
+}
+
+// Option 配置 Injector。
+type Option func(*Injector)
+
+// WithEnvVar 更换判定生产环境的环境变量名,默认 APP_ENV。
+func WithEnvVar(name string) Option { return func(i *Injector) { i.envVar = name } }
+
+// WithRules 设置初始规则;非法规则在 New 时记录告警并忽略整组。
+func WithRules(rules ...Rule) Option { return func(i *Injector) { i.initial = rules } }
+
+// withRand 替换随机源(测试用)。
+func withRand(fn func() float64) Option { return func(i *Injector) { i.rand = fn } }
+
+// Injector 持有当前规则并执行注入,并发安全。
+type Injector struct {
+	envVar  string
+	initial []Rule
+	rand    func() float64
+	prod    bool
+	rules   atomic.Pointer[[]Rule]
+
+	matched, delayed, aborted, reset, truncated atomic.Uint64
+}
+
+// New 创建 Injector。处于生产环境时返回的 Injector 恒为空操作。
+func New(opts ...Option) *Injector {
+	i := &Injector{envVar: DefaultEnvVar, rand: rand.Float64}
+	for _, o := range opts {
+		o(i)
+	}
+	i.prod = isProduction(os.Getenv(i.envVar))
+	if i.prod {
+		slog.Warn("fault: production environment detected, fault injection disabled", "env", i.envVar)
+	}
+	if len(i.initial) > 0 {
+		if err := i.SetRules(i.initial); err != nil && !errors.Is(err, ErrProduction) {
+			slog.Warn("fault: ignored invalid initial rules", "err", err)
+		}
+	}
+	return i
+}
+
+func isProduction(env string) bool {
+	switch strings.ToLower(strings.TrimSpace(env)) {
+	case "prod", "production":
+		return true
+	}
+	return false
+}
+
+// Enabled 报告注入是否可用(非生产环境)。
+func (i *Injector) Enabled() bool { return !i.prod }
+
+// SetRules 校验并整体替换规则;传空切片清空。生产环境返回 ErrProduction。
+func (i *Injector) SetRules(rules []Rule) error {
+	if i.prod {
+		return ErrProduction
+	}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	cp := append([]Rule(nil), rules...)
+	i.rules.Store(&cp)
+	return nil
+}
+
+// Rules 返回当前规则的副本。
+func (i *Injector) Rules() []Rule {
+	if p := i.rules.Load(); p != nil {
+		return append([]Rule(nil), (*p)...)
+	}
+	return nil
+}
+
+// Stats 返回注入计数。
+func (i *Injector) Stats() Stats {
+	return Stats{
+		Matched:   i.matched.Load(),
+		Delayed:   i.delayed.Load(),
+		Aborted:   i.aborted.Load(),
+		Reset:     i.reset.Load(),
+		Truncated: i.truncated.Load(),
+	}
+}
+
+// Match 返回 req 命中的第一条规则(已做百分比抽样)。生产环境恒返回 (nil)。
+func (i *Injector) Match(ctx context.Context, req Request) *Rule {
+	if i.prod {
+		return nil
+	}
+	p := i.rules.Load()
+	if p == nil {
+		return nil
+	}
+	for idx := range *p {
+		r := &(*p)[idx]
+		if !r.matches(ctx, req) {
+			continue
+		}
+		if r.Percentage > 0 && r.Percentage < 100 && i.rand()*100 >= r.Percentage {
+			continue
+		}
+		i.matched.Add(1)
+		return r
+	}
+	return nil
+}
+
+// delay 执行规则的延迟,ctx 取消时提前返回其错误。
+func (i *Injector) delay(ctx context.Context, r *Rule) error {
+	d := time.Duration(r.Delay)
+	if r.Jitter > 0 {
+		d += time.Duration(i.rand() * float64(r.Jitter))
+	}
+	if d <= 0 {
+		return nil
+	}
+	i.delayed.Add(1)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Document 是配置里的规则集合:
+//
+//	rules:
+//	  - {name: slow, paths: ["/orders/*"], delay: 300ms}
+type Document struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadConfig 从配置加载器读取 Document 并整体替换规则。
+func (i *Injector) LoadConfig(l conf.Loader) error {
+	// 经 JSON 转换:Duration 接受 "300ms" 字符串,mapstructure 做不到。
+	var raw map[string]any
+	if err := l.Unmarshal(&raw); err != nil {
+		return fmt.Errorf("fault: unmarshal config: %w", err)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("fault: unmarshal config: %w", err)
+	}
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("fault: unmarshal config: %w", err)
+	}
+	return i.SetRules(doc.Rules)
+}
+
+// WatchConfig 先同步加载一次,再在配置变更时热加载。变更后的配置非法时记录告警并
+// 保留上一份可用规则(last-good)。生产环境直接返回 ErrProduction,不监听。
+func (i *Injector) WatchConfig(ctx context.Context, l conf.Loader) error {
+	if err := i.LoadConfig(l); err != nil {
+		return err
+	}
+	l.Watch(ctx, func() {
+		if err := i.LoadConfig(l); err != nil {
+			slog.Warn("fault: ignored invalid config update, keeping last-good", "err", err)
+		}
+	})
+	return nil
+}
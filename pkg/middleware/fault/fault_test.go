@@ -0,0 +1,270 @@
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/middleware/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMatch(t *testing.T) {
+	roll := 0.5
+	inj := New(withRand(func() float64 { return roll }), WithRules(
+		Rule{Name: "hdr", Headers: map[string]string{"X-Chaos": "on"}, Abort: &Abort{HTTPStatus: 503}},
+		Rule{Name: "tenant", Kinds: []Kind{KindGRPC}, Tenants: []string{"t1"}, Reset: true},
+		Rule{Name: "orders", Paths: []string{"/orders/*"}, Methods: []string{"post"}, Percentage: 30, Delay: Duration(time.Millisecond)},
+	))
+	name := func(ctx context.Context, req Request) string {
+		if r := inj.Match(ctx, req); r != nil {
+			return r.Name
+		}
+		return ""
+	}
+	hdr := func(k string) string { return map[string]string{"X-Chaos": "on"}[k] }
+	ctx := context.Background()
+
+	if got := name(ctx, Request{Kind: KindHTTP, Path: "/x", Header: hdr}); got != "hdr" {
+		t.Errorf("header rule: %q", got)
+	}
+	if got := name(tenant.NewContext(ctx, "t1"), Request{Kind: KindGRPC, Path: "/a.B/C"}); got != "tenant" {
+		t.Errorf("tenant rule: %q", got)
+	}
+	if got := name(tenant.NewContext(ctx, "t1"), Request{Kind: KindMQ, Path: "topic"}); got != "" {
+		t.Errorf("kind filter: %q", got)
+	}
+	if got := name(ctx, Request{Kind: KindHTTP, Path: "/orders/1", Method: "POST"}); got != "" {
+		t.Errorf("50 >= 30 should be sampled out: %q", got)
+	}
+	roll = 0.1
+	if got := name(ctx, Request{Kind: KindHTTP, Path: "/orders/1", Method: "POST"}); got != "orders" {
+		t.Errorf("percentage hit: %q", got)
+	}
+	if got := name(ctx, Request{Kind: KindHTTP, Path: "/orders/1", Method: "GET"}); got != "" {
+		t.Errorf("method filter: %q", got)
+	}
+	if s := inj.Stats(); s.Matched != 3 {
+		t.Errorf("matched: %+v", s)
+	}
+
+	if err := inj.SetRules([]Rule{{Name: "noop"}}); err == nil {
+		t.Error("rule without fault should be rejected")
+	}
+	if err := inj.SetRules([]Rule{{Name: "pct", Percentage: 120, Reset: true}}); err == nil {
+		t.Error("percentage > 100 should be rejected")
+	}
+}
+
+func TestProductionGuard(t *testing.T) {
+	t.Setenv("APP_ENV", "Production")
+	inj := New(WithRules(Rule{Name: "r", Reset: true}))
+	if inj.Enabled() || inj.Rules() != nil {
+		t.Fatal("injector must be inert in production")
+	}
+	if err := inj.SetRules([]Rule{{Name: "r", Reset: true}}); !errors.Is(err, ErrProduction) {
+		t.Fatalf("SetRules: %v", err)
+	}
+	if r := inj.Match(context.Background(), Request{Kind: KindHTTP, Path: "/"}); r != nil {
+		t.Fatal("matched in production")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"rules":[{"name":"r","reset":true}]}`))
+	w := httptest.NewRecorder()
+	inj.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("admin PUT in production: %d", w.Code)
+	}
+
+	t.Setenv("DEPLOY_ENV", "staging")
+	if !New(WithEnvVar("DEPLOY_ENV")).Enabled() {
+		t.Fatal("custom env var not honoured")
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	inj := New(WithRules(
+		Rule{Name: "code", Paths: []string{"/code"}, Abort: &Abort{Code: int32(perr.CodeTooManyRequests), Message: "slow down"}},
+		Rule{Name: "status", Paths: []string{"/status"}, Delay: Duration(5 * time.Millisecond), Abort: &Abort{HTTPStatus: 502}},
+		Rule{Name: "reset", Paths: []string{"/reset"}, Reset: true},
+		Rule{Name: "trunc", Paths: []string{"/trunc"}, Truncate: 5},
+	))
+	srv := httptest.NewServer(HTTPMiddleware(inj)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "11")
+		_, _ = io.WriteString(w, "hello world")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/code")
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("code abort: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	resp, err = http.Get(srv.URL + "/status")
+	if err != nil || resp.StatusCode != http.StatusBadGateway || time.Since(start) < 5*time.Millisecond {
+		t.Fatalf("status abort with delay: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	if resp, err := http.Get(srv.URL + "/reset"); err == nil {
+		resp.Body.Close()
+		t.Fatal("reset should fail the request")
+	}
+
+	resp, err = http.Get(srv.URL + "/trunc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || string(body) != "hello" {
+		t.Fatalf("truncate: body=%q err=%v", body, err)
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unmatched: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	// 连接被重置时 net/http 客户端会对幂等请求自动重试,Reset 可能多于 1。
+	if s := inj.Stats(); s.Aborted != 2 || s.Reset == 0 || s.Truncated != 1 || s.Delayed != 1 {
+		t.Fatalf("stats: %+v", s)
+	}
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	inj := New(WithRules(
+		Rule{Name: "abort", Kinds: []Kind{KindGRPC}, Paths: []string{"/pay.v1.Payment/*"}, Abort: &Abort{Code: int32(perr.CodeUnavailable)}},
+		Rule{Name: "client", Kinds: []Kind{KindGRPCClient}, Headers: map[string]string{"x-chaos": "*"}, Abort: &Abort{HTTPStatus: 504}},
+		Rule{Name: "stream", Kinds: []Kind{KindGRPC}, Paths: []string{"/feed.v1.Feed/Watch"}, Truncate: 2},
+	))
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	_, err := UnaryServerInterceptor(inj)(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pay.v1.Payment/Charge"}, handler)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("server abort: %v", err)
+	}
+	if resp, err := UnaryServerInterceptor(inj)(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/user.v1.User/Get"}, handler); err != nil || resp != "ok" {
+		t.Fatalf("unmatched: %v %v", resp, err)
+	}
+
+	invoked := false
+	invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		invoked = true
+		return nil
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-chaos", "1")
+	if err := UnaryClientInterceptor(inj)(ctx, "/any.Svc/M", nil, nil, nil, invoker); status.Code(err) != codes.DeadlineExceeded || invoked {
+		t.Fatalf("client abort: %v invoked=%v", err, invoked)
+	}
+
+	ss := &sendStream{}
+	err = StreamServerInterceptor(inj)(nil, ss, &grpc.StreamServerInfo{FullMethod: "/feed.v1.Feed/Watch"}, func(_ any, s grpc.ServerStream) error {
+		for i := 0; i < 5; i++ {
+			if err := s.SendMsg(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if status.Code(err) != codes.Unavailable || ss.sent != 2 {
+		t.Fatalf("stream truncate: err=%v sent=%d", err, ss.sent)
+	}
+}
+
+type sendStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *sendStream) Context() context.Context { return context.Background() }
+func (s *sendStream) SendMsg(any) error        { s.sent++; return nil }
+
+func TestMQMiddleware(t *testing.T) {
+	inj := New(WithRules(
+		Rule{Name: "reset", Kinds: []Kind{KindMQ}, Paths: []string{"orders.*"}, Headers: map[string]string{"X-Chaos": "reset"}, Reset: true},
+		Rule{Name: "abort", Kinds: []Kind{KindMQ}, Paths: []string{"orders.*"}, Abort: &Abort{HTTPStatus: 503}},
+	))
+	h := mq.Chain(func(context.Context, mq.Message) error { return nil }, MQMiddleware(inj))
+
+	if err := h(context.Background(), mq.Message{Topic: "orders.created", Headers: map[string]string{"x-chaos": "reset"}}); !errors.Is(err, ErrInjectedReset) {
+		t.Fatalf("reset: %v", err)
+	}
+	st, ok := perr.FromError(h(context.Background(), mq.Message{Topic: "orders.paid"}))
+	if !ok || st.Code() != perr.CodeUnavailable {
+		t.Fatalf("abort: %v", st)
+	}
+	if err := h(context.Background(), mq.Message{Topic: "users.created"}); err != nil {
+		t.Fatalf("unmatched: %v", err)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	inj := New()
+	h := inj.Handler()
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/internal/fault", strings.NewReader(body)))
+		return w
+	}
+	if w := do(http.MethodPut, `{"rules":[{"name":"slow","paths":["/a"],"delay":"250ms"}]}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: %d %s", w.Code, w.Body)
+	}
+	var st State
+	if err := json.NewDecoder(do(http.MethodGet, "").Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if !st.Enabled || len(st.Rules) != 1 || time.Duration(st.Rules[0].Delay) != 250*time.Millisecond {
+		t.Fatalf("GET: %+v", st)
+	}
+	if w := do(http.MethodPut, `{"rules":[{"name":"bad"}]}`); w.Code != http.StatusBadRequest || len(inj.Rules()) != 1 {
+		t.Fatalf("invalid PUT must keep rules: %d", w.Code)
+	}
+	if w := do(http.MethodDelete, ""); w.Code != http.StatusNoContent || len(inj.Rules()) != 0 {
+		t.Fatalf("DELETE: %d", w.Code)
+	}
+}
+
+type fakeLoader struct {
+	doc      string
+	onChange func()
+}
+
+func (f *fakeLoader) Unmarshal(dst any) error { return json.Unmarshal([]byte(f.doc), dst) }
+
+func (f *fakeLoader) Watch(_ context.Context, fn func()) { f.onChange = fn }
+
+func TestWatchConfig(t *testing.T) {
+	l := &fakeLoader{doc: `{"rules":[{"name":"a","delay":"1s","jitter":"100ms"}]}`}
+	inj := New()
+	if err := inj.WatchConfig(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if r := inj.Rules(); len(r) != 1 || time.Duration(r[0].Jitter) != 100*time.Millisecond {
+		t.Fatalf("v1: %+v", r)
+	}
+	l.doc = `{"rules":[{"name":"b","delay":"soon"}]}`
+	l.onChange()
+	if r := inj.Rules(); len(r) != 1 || r[0].Name != "a" {
+		t.Fatalf("bad update must keep last-good: %+v", r)
+	}
+	l.doc = `{"rules":[]}`
+	l.onChange()
+	if len(inj.Rules()) != 0 {
+		t.Fatal("rules not cleared")
+	}
+}
@@ -0,0 +1,159 @@
+package fault
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor 返回按 inj 规则注入故障的 gRPC unary 服务端拦截器。
+// Reset 以 Unavailable 模拟连接被对端重置;unary 调用不支持 Truncate。
+func UnaryServerInterceptor(inj *Injector) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rule := inj.Match(ctx, grpcRequest(ctx, KindGRPC, info.FullMethod, metadata.FromIncomingContext))
+		if rule == nil {
+			return handler(ctx, req)
+		}
+		if err := inj.apply(ctx, rule); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 返回 stream 版本;Truncate=N 时服务端发出 N 条消息后以 Unavailable 中断流。
+func StreamServerInterceptor(inj *Injector) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		rule := inj.Match(ctx, grpcRequest(ctx, KindGRPC, info.FullMethod, metadata.FromIncomingContext))
+		if rule == nil {
+			return handler(srv, ss)
+		}
+		if err := inj.apply(ctx, rule); err != nil {
+			return err
+		}
+		if rule.Truncate > 0 {
+			ss = &truncStream{ServerStream: ss, inj: inj, remain: rule.Truncate}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor 返回 gRPC unary 客户端拦截器,在发出调用前注入(演练下游故障)。
+func UnaryClientInterceptor(inj *Injector) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		rule := inj.Match(ctx, grpcRequest(ctx, KindGRPCClient, method, metadata.FromOutgoingContext))
+		if rule != nil {
+			if err := inj.apply(ctx, rule); err != nil {
+				return err
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor 返回 gRPC stream 客户端拦截器,在建流前注入。
+func StreamClientInterceptor(inj *Injector) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		rule := inj.Match(ctx, grpcRequest(ctx, KindGRPCClient, method, metadata.FromOutgoingContext))
+		if rule != nil {
+			if err := inj.apply(ctx, rule); err != nil {
+				return nil, err
+			}
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func grpcRequest(ctx context.Context, kind Kind, method string, md func(context.Context) (metadata.MD, bool)) Request {
+	m, _ := md(ctx)
+	return Request{Kind: kind, Path: method, Header: func(k string) string {
+		if v := m.Get(k); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}}
+}
+
+// apply 执行延迟,再按 Reset / Abort 返回错误;两者皆无返回 nil(放行)。
+func (i *Injector) apply(ctx context.Context, r *Rule) error {
+	if err := i.delay(ctx, r); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	switch {
+	case r.Reset:
+		i.reset.Add(1)
+		return status.Error(codes.Unavailable, "fault: injected connection reset")
+	case r.Abort != nil:
+		i.aborted.Add(1)
+		return abortGRPC(ctx, r.Abort)
+	}
+	return nil
+}
+
+func abortGRPC(ctx context.Context, a *Abort) error {
+	if a.Code != 0 {
+		return perr.ToGRPCContext(ctx, perr.New(perr.Code(a.Code), a.Message))
+	}
+	msg := a.Message
+	if msg == "" {
+		msg = strings.ToLower(http.StatusText(a.HTTPStatus))
+	}
+	return status.Error(httpToGRPC(a.HTTPStatus), msg)
+}
+
+// httpToGRPC 把 HTTP 状态码映射到相近的 gRPC code(与 grpc-gateway 的反向映射一致)。
+func httpToGRPC(s int) codes.Code {
+	switch s {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if s >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// truncStream 放行前 remain 条消息,之后的 SendMsg 返回 Unavailable 中断流。
+type truncStream struct {
+	grpc.ServerStream
+	inj    *Injector
+	remain int
+}
+
+func (s *truncStream) SendMsg(m any) error {
+	if s.remain == 0 {
+		s.inj.truncated.Add(1)
+		s.remain = -1
+		return status.Error(codes.Unavailable, "fault: injected stream truncation")
+	}
+	if s.remain < 0 {
+		return status.Error(codes.Unavailable, "fault: injected stream truncation")
+	}
+	s.remain--
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,93 @@
+package fault
+
+import (
+	"net"
+	"net/http"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+)
+
+// HTTPMiddleware 返回按 inj 规则注入故障的 HTTP 中间件。执行顺序:延迟 → 重置 / 中止 → 截断。
+// 延迟期间客户端断开则直接返回。
+func HTTPMiddleware(inj *Injector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := inj.Match(r.Context(), Request{Kind: KindHTTP, Path: r.URL.Path, Method: r.Method, Header: r.Header.Get})
+			if rule == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := inj.delay(r.Context(), rule); err != nil {
+				return
+			}
+			switch {
+			case rule.Reset:
+				inj.reset.Add(1)
+				resetConn(w)
+				return
+			case rule.Abort != nil:
+				inj.aborted.Add(1)
+				writeAbort(w, r, rule.Abort)
+				return
+			case rule.Truncate > 0:
+				tw := &truncWriter{ResponseWriter: w, remain: rule.Truncate}
+				next.ServeHTTP(tw, r)
+				if tw.cut {
+					inj.truncated.Add(1)
+					_ = http.NewResponseController(w).Flush()
+					resetConn(w)
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeAbort(w http.ResponseWriter, r *http.Request, a *Abort) {
+	if a.Code != 0 {
+		perr.WriteHTTPContext(perr.WithRequestLocales(r), w, perr.New(perr.Code(a.Code), a.Message))
+		return
+	}
+	msg := a.Message
+	if msg == "" {
+		msg = http.StatusText(a.HTTPStatus)
+	}
+	http.Error(w, msg, a.HTTPStatus)
+}
+
+// resetConn 劫持底层 TCP 连接并以 SO_LINGER=0 关闭,对端收到 RST;
+// 无法劫持(HTTP/2 等)时以 http.ErrAbortHandler 中断,服务器会重置该流。
+func resetConn(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// truncWriter 只放行前 remain 字节,其余丢弃并标记 cut。
+type truncWriter struct {
+	http.ResponseWriter
+	remain int
+	cut    bool
+}
+
+func (t *truncWriter) Write(b []byte) (int, error) {
+	if len(b) <= t.remain {
+		t.remain -= len(b)
+		return t.ResponseWriter.Write(b)
+	}
+	if t.remain > 0 {
+		_, _ = t.ResponseWriter.Write(b[:t.remain])
+		t.remain = 0
+	}
+	t.cut = true
+	return len(b), nil
+}
+
+// Unwrap 供 http.ResponseController 找到底层 writer(Flush / Hijack)。
+func (t *truncWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
@@ -0,0 +1,49 @@
+package fault
+
+import (
+	"context"
+	"strings"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+)
+
+// MQMiddleware 返回按 inj 规则注入故障的 mq 处理中间件,规则的 Paths 匹配 topic、Headers 匹配消息头
+// (键不区分大小写)。Reset 返回 ErrInjectedReset,Abort 返回对应的 *errors.Status,
+// 后续是否重投由 broker 与 Retry 等中间件决定;mq 不支持 Truncate。
+func MQMiddleware(inj *Injector) mq.HandlerMiddleware {
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg mq.Message) error {
+			rule := inj.Match(ctx, Request{Kind: KindMQ, Path: msg.Topic, Header: func(k string) string {
+				if v, ok := msg.Headers[k]; ok {
+					return v
+				}
+				for hk, v := range msg.Headers {
+					if strings.EqualFold(hk, k) {
+						return v
+					}
+				}
+				return ""
+			}})
+			if rule == nil {
+				return next(ctx, msg)
+			}
+			if err := inj.delay(ctx, rule); err != nil {
+				return err
+			}
+			switch {
+			case rule.Reset:
+				inj.reset.Add(1)
+				return ErrInjectedReset
+			case rule.Abort != nil:
+				inj.aborted.Add(1)
+				code := perr.Code(rule.Abort.Code)
+				if code == 0 {
+					code = perr.Code(rule.Abort.HTTPStatus) // 预定义业务码与 HTTP 状态码同值
+				}
+				return perr.New(code, rule.Abort.Message)
+			}
+			return next(ctx, msg)
+		}
+	}
+}
@@ -0,0 +1,711 @@
+// Package httpcache 提供服务端 HTTP 响应缓存中间件:把 handler 的响应存进缓存,后续相同请求
+// 直接回放,不再进入业务逻辑。与 pkg/middleware/cache(gRPC 客户端缓存)、
+// pkg/client/http.CacheTransport(出站 HTTP 缓存)互补,覆盖的是"入站"方向。
+//
+// 行为:
+//   - 只缓存 GET(HEAD 命中时从 GET 条目回放);键默认为 path+query,可 WithKeyFunc 自定义;
+//   - 新鲜度由 handler 决定:有 Surrogate-Control 时只看它(Cache-Control 留给浏览器),
+//     否则看 Cache-Control 的 s-maxage > max-age;都没有时用 WithDefaultTTL(默认 0 即不缓存)。
+//     no-store / private / no-cache、Set-Cookie、Vary: * 的响应不缓存;
+//     带 Authorization 的请求仅在响应声明 public、s-maxage 或 Surrogate-Control 时缓存;
+//   - Vary:按响应的 Vary 头把同一键拆成多个变体,查找时用请求的对应头取变体;
+//   - stale-while-revalidate:过期但仍在窗口内时先回旧值,后台单飞重算;
+//   - 请求合并(WithRequestCoalescing):同一键并发未命中只放一个请求进 handler,其余等它写完缓存后回放;
+//   - Surrogate-Key:handler 用空格分隔的标签标记响应,PurgeTags 按标签失效;标签与
+//     Surrogate-Control 默认不透传给客户端。
+//
+// 存储:Store 与 kvstore.Store 的 Get/Set/Delete 同签名,可直接传入 Redis 等共享实现;
+// 单机可用 FromCache 包一个 store/cache 的 LRU / TinyLFU。标签失效用"版本号"实现:
+// 条目记录写入时各标签的版本,PurgeTags 只需把版本加一,O(1) 且不需要反向索引;主键同理,
+// Purge 把主键版本加一,该键下全部 Vary 变体一并失配。版本号须与条目同样共享:Store 不是进程内
+// 实现(nil 或 FromCache)时,默认用 Store 自身保存版本(须实现 TagStore,kvstore 实现即可),
+// 否则必须 WithTagStore 显式指定,New 会 panic 而不是让各实例各记各的版本、Purge 只在本机生效。
+//
+// 多实例:WithBroadcast 让 Purge / PurgeTags 经 pkg/messaging/mq 广播,各实例 Subscribe
+// 后在本地执行同样的失效;PurgeHandler 把它暴露为 HTTP 接口(鉴权由调用方包一层)。
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/store/cache"
+)
+
+// Store 是缓存条目的存储。方法签名与 kvstore.Store 的对应方法一致,kvstore 实现可直接使用。
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// TagStore 保存 Surrogate-Key 的版本号。签名与 kvstore.Store 一致;多实例共享时传入同一个
+// 共享后端,PurgeTags 一次即全局生效。
+type TagStore interface {
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	GetInt(ctx context.Context, key string) (int64, bool, error)
+}
+
+// DefaultTopic 是 WithBroadcast 未指定 topic 时的失效广播主题。
+const DefaultTopic = "beauty.httpcache.purge"
+
+// Option 配置 Cache。
+type Option func(*config)
+
+type config struct {
+	defaultTTL      time.Duration
+	swr             time.Duration
+	keyFn           func(*http.Request) string
+	prefix          string
+	maxBody         int
+	coalesce        bool
+	filter          func(*http.Request) bool
+	tags            TagStore
+	pub             mq.Publisher
+	topic           string
+	exposeSurrogate bool
+	onStoreError    func(error)
+	now             func() time.Time
+}
+
+// WithDefaultTTL 设置 handler 未声明新鲜度时的缓存时长(默认 0,即只缓存显式声明的响应)。
+func WithDefaultTTL(d time.Duration) Option { return func(c *config) { c.defaultTTL = d } }
+
+// WithStaleWhileRevalidate 设置响应未声明 stale-while-revalidate 时的默认窗口(默认 0)。
+func WithStaleWhileRevalidate(d time.Duration) Option { return func(c *config) { c.swr = d } }
+
+// WithKeyFunc 自定义缓存主键(默认 r.URL.RequestURI(),即 path+query)。Purge 使用同一键。
+func WithKeyFunc(fn func(*http.Request) string) Option { return func(c *config) { c.keyFn = fn } }
+
+// WithKeyPrefix 设置存储键前缀(默认 "httpcache:"),多个 Cache 共享一个 Store 时用于隔离。
+func WithKeyPrefix(p string) Option { return func(c *config) { c.prefix = p } }
+
+// WithMaxBodySize 设置可缓存的最大响应体(默认 1MB);超过的响应照常返回但不缓存。
+func WithMaxBodySize(n int) Option { return func(c *config) { c.maxBody = n } }
+
+// WithRequestCoalescing 合并同一键的并发未命中请求。
+func WithRequestCoalescing() Option { return func(c *config) { c.coalesce = true } }
+
+// WithFilter 追加请求级判定:返回 false 的请求绕过缓存。
+func WithFilter(fn func(*http.Request) bool) Option { return func(c *config) { c.filter = fn } }
+
+// WithTagStore 设置标签与主键版本的存储。默认:进程内 Store 用进程内有界表(最近 100000 个
+// 失效过的键),其它 Store 用 Store 自身(须实现 TagStore)。
+func WithTagStore(s TagStore) Option { return func(c *config) { c.tags = s } }
+
+// WithBroadcast 让 Purge / PurgeTags 通过 pub 广播到 topic(空串用 DefaultTopic)。
+func WithBroadcast(pub mq.Publisher, topic string) Option {
+	return func(c *config) { c.pub, c.topic = pub, topic }
+}
+
+// WithExposeSurrogateHeaders 把 Surrogate-Key / Surrogate-Control 透传给客户端(前面还有 CDN 时使用)。
+func WithExposeSurrogateHeaders() Option { return func(c *config) { c.exposeSurrogate = true } }
+
+// WithOnStoreError 设置存储出错时的回调;出错时中间件降级为直接调用 handler。
+func WithOnStoreError(fn func(error)) Option { return func(c *config) { c.onStoreError = fn } }
+
+// Stats 是累计计数。
+type Stats struct {
+	Hits      int64 // 新鲜命中
+	Stale     int64 // 回放过期条目并触发后台重算
+	Misses    int64 // 未命中,进入 handler
+	Coalesced int64 // 因请求合并而等待他人结果的请求
+	Stores    int64 // 写入缓存的响应
+}
+
+// Cache 是服务端响应缓存。用 New 构造,Middleware 挂到路由上。并发安全。
+type Cache struct {
+	store Store
+	cfg   config
+
+	mu           sync.Mutex
+	inflight     map[string]chan struct{}
+	revalidating map[string]bool
+
+	hits, stale, misses, coalesced, stores atomic.Int64
+}
+
+// New 创建响应缓存。store 为 nil 时使用容量 10000 的进程内 LRU。
+// store 不是进程内实现、既未实现 TagStore 也未给 WithTagStore 时 panic(见包文档"多实例")。
+func New(store Store, opts ...Option) *Cache {
+	cfg := config{prefix: "httpcache:", maxBody: 1 << 20, now: time.Now}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.keyFn == nil {
+		cfg.keyFn = func(r *http.Request) string { return r.URL.RequestURI() }
+	}
+	if store == nil {
+		store = FromCache(cache.NewLRU[string, []byte](10000))
+	}
+	if cfg.tags == nil {
+		if _, local := store.(cacheStore); local {
+			cfg.tags = newLocalTags(localTagCapacity)
+		} else if ts, ok := store.(TagStore); ok {
+			cfg.tags = ts
+		} else {
+			panic("httpcache: a non-local Store must implement TagStore or be given WithTagStore")
+		}
+	}
+	if cfg.topic == "" {
+		cfg.topic = DefaultTopic
+	}
+	return &Cache{
+		store:        store,
+		cfg:          cfg,
+		inflight:     make(map[string]chan struct{}),
+		revalidating: make(map[string]bool),
+	}
+}
+
+// Stats 返回累计计数。
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits: c.hits.Load(), Stale: c.stale.Load(), Misses: c.misses.Load(),
+		Coalesced: c.coalesced.Load(), Stores: c.stores.Load(),
+	}
+}
+
+// Middleware 返回缓存中间件。
+//
+//	hc := httpcache.New(redisStore, httpcache.WithRequestCoalescing())
+//	mux.Handle("/articles/", hc.Middleware()(articles))
+func (c *Cache) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead ||
+				c.cfg.filter != nil && !c.cfg.filter(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			pk := c.cfg.keyFn(r)
+			e, state := c.lookup(r, pk)
+			switch state {
+			case stateFresh:
+				c.hits.Add(1)
+				c.serve(w, r, e, "HIT")
+				return
+			case stateStale:
+				c.stale.Add(1)
+				c.serve(w, r, e, "STALE")
+				c.revalidate(r, pk, next)
+				return
+			}
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if c.cfg.coalesce {
+				if wait, leader := c.join(pk); !leader {
+					c.coalesced.Add(1)
+					select {
+					case <-wait:
+					case <-r.Context().Done():
+						return
+					}
+					if e, state := c.lookup(r, pk); state == stateFresh {
+						c.hits.Add(1)
+						c.serve(w, r, e, "HIT")
+						return
+					}
+				} else {
+					defer c.leave(pk)
+				}
+			}
+			c.misses.Add(1)
+			w.Header().Set("X-Cache", "MISS")
+			c.fetch(w, r, pk, next)
+		})
+	}
+}
+
+// ---- 查找与回放 ----
+
+type entryState int
+
+const (
+	stateMiss entryState = iota
+	stateFresh
+	stateStale
+)
+
+// entry 是序列化到 Store 的一条响应。
+type entry struct {
+	Status     int              `json:"s"`
+	Header     http.Header      `json:"h"`
+	Body       []byte           `json:"b"`
+	StoredAt   time.Time        `json:"t"`
+	FreshUntil time.Time        `json:"f"`
+	StaleUntil time.Time        `json:"w"`
+	Tags       map[string]int64 `json:"g,omitempty"` // 标签 → 写入时的版本
+	KeyVer     int64            `json:"k,omitempty"` // 写入时主键的版本
+}
+
+// index 记录主键下响应的 Vary 头名,用于定位变体;Until 为各变体中最晚的过期时刻。
+type index struct {
+	Vary  []string  `json:"v"`
+	Until time.Time `json:"u"`
+}
+
+func (c *Cache) lookup(r *http.Request, pk string) (*entry, entryState) {
+	ctx := r.Context()
+	raw, ok, err := c.store.Get(ctx, c.indexKey(pk))
+	if err != nil {
+		c.storeError(err)
+		return nil, stateMiss
+	}
+	if !ok {
+		return nil, stateMiss
+	}
+	var idx index
+	if json.Unmarshal(raw, &idx) != nil {
+		return nil, stateMiss
+	}
+	raw, ok, err = c.store.Get(ctx, c.variantKey(pk, idx.Vary, r.Header))
+	if err != nil {
+		c.storeError(err)
+		return nil, stateMiss
+	}
+	if !ok {
+		return nil, stateMiss
+	}
+	var e entry
+	if json.Unmarshal(raw, &e) != nil {
+		return nil, stateMiss
+	}
+	cur, _, err := c.cfg.tags.GetInt(ctx, c.keyVerKey(pk))
+	if err != nil {
+		c.storeError(err)
+		return nil, stateMiss
+	}
+	if cur != e.KeyVer {
+		return nil, stateMiss
+	}
+	for tag, ver := range e.Tags {
+		cur, _, err := c.cfg.tags.GetInt(ctx, c.tagKey(tag))
+		if err != nil {
+			c.storeError(err)
+			return nil, stateMiss
+		}
+		if cur != ver {
+			return nil, stateMiss
+		}
+	}
+	now := c.cfg.now()
+	switch {
+	case now.Before(e.FreshUntil):
+		return &e, stateFresh
+	case now.Before(e.StaleUntil):
+		return &e, stateStale
+	}
+	return nil, stateMiss
+}
+
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, e *entry, state string) {
+	h := w.Header()
+	for k, v := range e.Header {
+		h[k] = slices.Clone(v)
+	}
+	h.Set("Age", strconv.Itoa(int(max(c.cfg.now().Sub(e.StoredAt), 0)/time.Second)))
+	h.Set("X-Cache", state)
+	if etag := e.Header.Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.Body)
+	}
+}
+
+// ---- 回源与写入 ----
+
+// fetch 调用 handler,响应边写给客户端边缓冲,结束后按策略写入缓存。
+func (c *Cache) fetch(w http.ResponseWriter, r *http.Request, pk string, next http.Handler) {
+	rec := &recorder{ResponseWriter: w, c: c, status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	c.storeResponse(r, pk, rec)
+}
+
+// revalidate 在后台重新执行 handler 刷新过期条目;同一键同时只有一个重算。
+func (c *Cache) revalidate(r *http.Request, pk string, next http.Handler) {
+	c.mu.Lock()
+	if c.revalidating[pk] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[pk] = true
+	c.mu.Unlock()
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Method = http.MethodGet
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, pk)
+			c.mu.Unlock()
+			if p := recover(); p != nil {
+				c.storeError(errors.New("httpcache: handler panic during revalidation"))
+			}
+		}()
+		rec := &recorder{ResponseWriter: discardWriter{h: make(http.Header)}, c: c, status: http.StatusOK}
+		next.ServeHTTP(rec, req)
+		c.storeResponse(req, pk, rec)
+	}()
+}
+
+func (c *Cache) storeResponse(r *http.Request, pk string, rec *recorder) {
+	if rec.overflow || !cacheableStatus(rec.status) {
+		return
+	}
+	h := rec.header
+	if h.Get("Set-Cookie") != "" {
+		return
+	}
+	fresh, stale, ok := c.policy(r, h, rec.surrogateControl)
+	if !ok {
+		return
+	}
+	vary := varyNames(h)
+	if slices.Contains(vary, "*") {
+		return
+	}
+	ctx := r.Context()
+	now := c.cfg.now()
+	keyVer, _, err := c.cfg.tags.GetInt(ctx, c.keyVerKey(pk))
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	e := entry{
+		Status:     rec.status,
+		Header:     storedHeader(h),
+		Body:       rec.buf,
+		StoredAt:   now,
+		FreshUntil: now.Add(fresh),
+		StaleUntil: now.Add(fresh + stale),
+		KeyVer:     keyVer,
+	}
+	if len(rec.surrogateKeys) > 0 {
+		e.Tags = make(map[string]int64, len(rec.surrogateKeys))
+		for _, tag := range rec.surrogateKeys {
+			ver, _, err := c.cfg.tags.GetInt(ctx, c.tagKey(tag))
+			if err != nil {
+				c.storeError(err)
+				return
+			}
+			e.Tags[tag] = ver
+		}
+	}
+	ttl := fresh + stale
+	val, _ := json.Marshal(e)
+	if err := c.store.Set(ctx, c.variantKey(pk, vary, r.Header), val, ttl); err != nil {
+		c.storeError(err)
+		return
+	}
+	// 索引保留到最晚过期的变体:短 TTL 的变体不能让仍在缓存里的兄弟变体失去索引。
+	until := e.StaleUntil
+	if raw, ok, err := c.store.Get(ctx, c.indexKey(pk)); err == nil && ok {
+		var prev index
+		if json.Unmarshal(raw, &prev) == nil && slices.Equal(prev.Vary, vary) && prev.Until.After(until) {
+			until = prev.Until
+		}
+	}
+	idx, _ := json.Marshal(index{Vary: vary, Until: until})
+	if err := c.store.Set(ctx, c.indexKey(pk), idx, until.Sub(now)); err != nil {
+		c.storeError(err)
+		return
+	}
+	c.stores.Add(1)
+}
+
+// policy 计算新鲜期与 stale 窗口。有 Surrogate-Control 时只看它(Cache-Control 留给浏览器),
+// 否则按 Cache-Control:s-maxage 优先于 max-age。
+func (c *Cache) policy(r *http.Request, h http.Header, surrogate string) (fresh, stale time.Duration, ok bool) {
+	d := parseDirectives(surrogate)
+	maxAge := "max-age"
+	if d == nil {
+		d = parseDirectives(h.Get("Cache-Control"))
+		if d.has("private") || d.has("no-cache") {
+			return 0, 0, false
+		}
+		if r.Header.Get("Authorization") != "" && !d.has("public") && !d.has("s-maxage") {
+			return 0, 0, false
+		}
+		if d.has("s-maxage") {
+			maxAge = "s-maxage"
+		}
+	}
+	if d.has("no-store") {
+		return 0, 0, false
+	}
+	fresh = c.cfg.defaultTTL
+	if d.has(maxAge) {
+		fresh = d.seconds(maxAge)
+	}
+	if fresh <= 0 {
+		return 0, 0, false
+	}
+	stale = c.cfg.swr
+	if d.has("stale-while-revalidate") {
+		stale = d.seconds("stale-while-revalidate")
+	}
+	return fresh, stale, true
+}
+
+func cacheableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusPermanentRedirect,
+		http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// storedHeader 复制要随条目保存的响应头,去掉逐跳头与每次回放时重算的头。
+func storedHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Age", "X-Cache", "Date"} {
+		out.Del(k)
+	}
+	return out
+}
+
+// ---- 请求合并 ----
+
+func (c *Cache) join(pk string) (<-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.inflight[pk]; ok {
+		return ch, false
+	}
+	c.inflight[pk] = make(chan struct{})
+	return nil, true
+}
+
+func (c *Cache) leave(pk string) {
+	c.mu.Lock()
+	ch := c.inflight[pk]
+	delete(c.inflight, pk)
+	c.mu.Unlock()
+	close(ch)
+}
+
+// ---- 键 ----
+
+func (c *Cache) indexKey(pk string) string { return c.cfg.prefix + "i:" + pk }
+
+func (c *Cache) tagKey(tag string) string { return c.cfg.prefix + "t:" + tag }
+
+func (c *Cache) keyVerKey(pk string) string { return c.cfg.prefix + "k:" + pk }
+
+// variantKey 由主键与请求中 Vary 头的取值组成;无 Vary 时即主键本身。
+func (c *Cache) variantKey(pk string, vary []string, h http.Header) string {
+	if len(vary) == 0 {
+		return c.cfg.prefix + "e:" + pk
+	}
+	sum := sha256.New()
+	for _, name := range vary {
+		sum.Write([]byte(name))
+		sum.Write([]byte{0})
+		sum.Write([]byte(strings.Join(h.Values(name), ",")))
+		sum.Write([]byte{0})
+	}
+	return c.cfg.prefix + "e:" + pk + "#" + hex.EncodeToString(sum.Sum(nil)[:12])
+}
+
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				names = append(names, http.CanonicalHeaderKey(f))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func (c *Cache) storeError(err error) {
+	if c.cfg.onStoreError != nil {
+		c.cfg.onStoreError(err)
+	}
+}
+
+// ---- 指令解析 ----
+
+type directives map[string]string
+
+func parseDirectives(v string) directives {
+	if v == "" {
+		return nil
+	}
+	d := make(directives)
+	for _, part := range strings.Split(v, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if k != "" {
+			d[strings.ToLower(k)] = strings.Trim(val, `"`)
+		}
+	}
+	return d
+}
+
+func (d directives) has(k string) bool { _, ok := d[k]; return ok }
+
+func (d directives) seconds(k string) time.Duration {
+	n, err := strconv.Atoi(d[k])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// ---- 响应录制 ----
+
+// recorder 把响应写给下游的同时缓冲一份;WriteHeader 时摘下 Surrogate-* 头。
+type recorder struct {
+	http.ResponseWriter
+	c                *Cache
+	status           int
+	wroteHeader      bool
+	header           http.Header
+	buf              []byte
+	overflow         bool
+	surrogateKeys    []string
+	surrogateControl string
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	h := w.ResponseWriter.Header()
+	for _, v := range h.Values("Surrogate-Key") {
+		w.surrogateKeys = append(w.surrogateKeys, strings.Fields(v)...)
+	}
+	w.surrogateControl = h.Get("Surrogate-Control")
+	if !w.c.cfg.exposeSurrogate {
+		h.Del("Surrogate-Key")
+		h.Del("Surrogate-Control")
+	}
+	w.header = h.Clone()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if len(w.buf)+len(b) > w.c.cfg.maxBody {
+			w.overflow, w.buf = true, nil
+		} else {
+			w.buf = append(w.buf, b...)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+type discardWriter struct{ h http.Header }
+
+func (d discardWriter) Header() http.Header         { return d.h }
+func (d discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardWriter) WriteHeader(int)             {}
+
+// ---- 存储适配 ----
+
+// FromCache 把 store/cache 的有界内存缓存(LRU / TinyLFU)适配为 Store,过期时间随值保存、读取时校验。
+func FromCache(c cache.Cache[string, []byte]) Store { return cacheStore{c: c} }
+
+type cacheStore struct{ c cache.Cache[string, []byte] }
+
+func (s cacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	v, ok := s.c.Get(key)
+	if !ok || len(v) < 8 {
+		return nil, false, nil
+	}
+	if exp := int64(binary.BigEndian.Uint64(v)); exp > 0 && time.Now().UnixNano() > exp {
+		s.c.Delete(key)
+		return nil, false, nil
+	}
+	return v[8:], true, nil
+}
+
+func (s cacheStore) Set(_ context.Context, key string, val []byte, ttl time.Duration) error {
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	buf := make([]byte, 8+len(val))
+	binary.BigEndian.PutUint64(buf, uint64(exp))
+	copy(buf[8:], val)
+	s.c.Set(key, buf)
+	return nil
+}
+
+func (s cacheStore) Delete(_ context.Context, key string) error {
+	s.c.Delete(key)
+	return nil
+}
+
+// localTagCapacity 是进程内版本表最多记住的键数。
+const localTagCapacity = 100000
+
+// localTags 是进程内的版本存储,只记最近失效过的 cap 个键(LRU)。
+//
+// 版本取自全局递增的 clock,每次 Incr 都发一个比以往都大的版本;表满淘汰时把 floor 提到 clock,
+// 不在表中的键按 floor 计。于是任一键的版本随时间只增不减,失效前写入的条目不会因淘汰而"复活",
+// 代价只是淘汰后未失效过的键也多一次未命中。
+type localTags struct {
+	mu    sync.Mutex
+	m     *cache.LRU[string, int64]
+	cap   int
+	clock int64 // 已发出的最大版本
+	floor int64 // 不在表中的键的版本
+}
+
+func newLocalTags(capacity int) *localTags {
+	return &localTags{m: cache.NewLRU[string, int64](capacity), cap: capacity}
+}
+
+func (t *localTags) Incr(_ context.Context, key string, delta int64, _ time.Duration) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.m.Get(key); !ok && t.m.Len() >= t.cap {
+		t.floor = t.clock
+	}
+	t.clock += max(delta, 1)
+	t.m.Set(key, t.clock)
+	return t.clock, nil
+}
+
+func (t *localTags) GetInt(_ context.Context, key string) (int64, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.m.Get(key); ok {
+		return v, true, nil
+	}
+	return t.floor, false, nil
+}
@@ -0,0 +1,345 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// counting 返回一个每次调用输出递增序号的 handler,header 由 set 决定。
+func counting(calls *atomic.Int64, set func(h http.Header, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if set != nil {
+			set(w.Header(), r)
+		}
+		_, _ = w.Write([]byte(strconv.FormatInt(n, 10)))
+	})
+}
+
+func get(h http.Handler, target string, hdr ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestCacheControl(t *testing.T) {
+	var calls atomic.Int64
+	c := New(nil)
+	h := c.Middleware()(counting(&calls, func(h http.Header, r *http.Request) {
+		switch r.URL.Path {
+		case "/cached":
+			h.Set("Cache-Control", "public, max-age=60")
+		case "/nostore":
+			h.Set("Cache-Control", "no-store")
+		case "/cookie":
+			h.Set("Cache-Control", "max-age=60")
+			h.Set("Set-Cookie", "sid=1")
+		}
+	}))
+
+	if rec := get(h, "/cached"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "1" {
+		t.Fatalf("first: %v %q", rec.Header(), rec.Body.String())
+	}
+	rec := get(h, "/cached")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "1" || rec.Header().Get("Age") == "" {
+		t.Fatalf("second: %v %q", rec.Header(), rec.Body.String())
+	}
+	r := httptest.NewRequest(http.MethodHead, "/cached", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.Len() != 0 {
+		t.Fatalf("HEAD: %v %q", rec.Header(), rec.Body.String())
+	}
+	// query 参与键。
+	if rec := get(h, "/cached?page=2"); rec.Body.String() != "2" {
+		t.Fatalf("query variant: %q", rec.Body.String())
+	}
+
+	for _, p := range []string{"/nostore", "/cookie", "/plain"} {
+		get(h, p)
+		if rec := get(h, p); rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("%s must not be cached: %v", p, rec.Header())
+		}
+	}
+	// 带 Authorization 但响应没声明 public/s-maxage:不缓存。
+	priv := New(nil).Middleware()(counting(&calls, func(h http.Header, _ *http.Request) { h.Set("Cache-Control", "max-age=60") }))
+	get(priv, "/me", "Authorization", "Bearer x")
+	if rec := get(priv, "/me", "Authorization", "Bearer x"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatal("authorized response cached without public")
+	}
+}
+
+func TestVary(t *testing.T) {
+	var calls atomic.Int64
+	h := New(nil).Middleware()(counting(&calls, func(h http.Header, r *http.Request) {
+		h.Set("Cache-Control", "max-age=60")
+		h.Set("Vary", "Accept-Language")
+		h.Set("Content-Language", r.Header.Get("Accept-Language"))
+	}))
+	get(h, "/p", "Accept-Language", "en")
+	get(h, "/p", "Accept-Language", "zh")
+	en := get(h, "/p", "Accept-Language", "en")
+	zh := get(h, "/p", "Accept-Language", "zh")
+	if en.Body.String() != "1" || zh.Body.String() != "2" || en.Header().Get("X-Cache") != "HIT" || zh.Header().Get("Content-Language") != "zh" {
+		t.Fatalf("en=%q zh=%q calls=%d", en.Body.String(), zh.Body.String(), calls.Load())
+	}
+}
+
+// ttlStore 记录每个键最后一次 Set 的 TTL。
+type ttlStore struct {
+	Store
+	mu   sync.Mutex
+	ttls map[string]time.Duration
+}
+
+func (s *ttlStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	s.ttls[key] = ttl
+	s.mu.Unlock()
+	return s.Store.Set(ctx, key, val, ttl)
+}
+
+func TestVaryPurgeAndIndexTTL(t *testing.T) {
+	var calls atomic.Int64
+	mem := kvstore.NewMemory()
+	defer mem.Stop()
+	store := &ttlStore{Store: mem, ttls: map[string]time.Duration{}}
+	c := New(store, WithTagStore(mem))
+	h := c.Middleware()(counting(&calls, func(h http.Header, r *http.Request) {
+		if r.Header.Get("Accept-Language") == "zh" {
+			h.Set("Cache-Control", "max-age=1")
+		} else {
+			h.Set("Cache-Control", "max-age=60")
+		}
+		h.Set("Vary", "Accept-Language")
+	}))
+	get(h, "/p", "Accept-Language", "en")
+	get(h, "/p", "Accept-Language", "zh")
+	// 短 TTL 的 zh 变体不能把索引的 TTL 缩短到 1s,否则 en 变体随之不可达。
+	if ttl := store.ttls["httpcache:i:/p"]; ttl < 59*time.Second {
+		t.Fatalf("index ttl = %v", ttl)
+	}
+
+	// Purge 失效全部变体:en 重新写入索引后,zh 的旧变体不能再被命中。
+	if err := c.Purge(context.Background(), "/p"); err != nil {
+		t.Fatal(err)
+	}
+	en := get(h, "/p", "Accept-Language", "en")
+	zh := get(h, "/p", "Accept-Language", "zh")
+	if en.Body.String() != "3" || zh.Body.String() != "4" || zh.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("after purge en=%q zh=%q (%s)", en.Body.String(), zh.Body.String(), zh.Header().Get("X-Cache"))
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int64
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	store := kvstore.NewMemory()
+	defer store.Stop()
+	c := New(store)
+	c.cfg.now = func() time.Time { return time.Unix(0, now.Load()) }
+	h := c.Middleware()(counting(&calls, func(h http.Header, _ *http.Request) {
+		h.Set("Cache-Control", "max-age=10, stale-while-revalidate=30")
+	}))
+
+	get(h, "/s")
+	now.Add(int64(15 * time.Second))
+	rec := get(h, "/s")
+	if rec.Header().Get("X-Cache") != "STALE" || rec.Body.String() != "1" {
+		t.Fatalf("stale: %v %q", rec.Header(), rec.Body.String())
+	}
+	waitFor(t, func() bool { return c.Stats().Stores == 2 })
+	if rec := get(h, "/s"); rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "2" {
+		t.Fatalf("after revalidate: %v %q", rec.Header(), rec.Body.String())
+	}
+	now.Add(int64(time.Minute))
+	if rec := get(h, "/s"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("beyond stale window: %v", rec.Header())
+	}
+}
+
+func TestRequestCoalescing(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	c := New(nil, WithRequestCoalescing())
+	h := c.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("v"))
+	}))
+
+	const n = 8
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = get(h, "/hot").Body.String()
+		}()
+	}
+	waitFor(t, func() bool { return c.Stats().Coalesced == n-1 })
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("handler calls=%d, want 1", calls.Load())
+	}
+	for _, b := range bodies {
+		if b != "v" {
+			t.Fatalf("bodies=%v", bodies)
+		}
+	}
+}
+
+func TestSurrogateKeysAndPurge(t *testing.T) {
+	var calls atomic.Int64
+	c := New(nil)
+	h := c.Middleware()(counting(&calls, func(h http.Header, r *http.Request) {
+		h.Set("Surrogate-Control", "max-age=300")
+		h.Set("Cache-Control", "no-cache") // 给浏览器的策略;有 Surrogate-Control 时服务端不看它
+		if strings.HasPrefix(r.URL.Path, "/articles/") {
+			h.Set("Surrogate-Key", "articles article-"+strings.TrimPrefix(r.URL.Path, "/articles/"))
+		}
+	}))
+
+	first := get(h, "/articles/1")
+	if first.Header().Get("Surrogate-Key") != "" || first.Header().Get("Surrogate-Control") != "" {
+		t.Fatalf("surrogate headers leaked: %v", first.Header())
+	}
+	get(h, "/articles/2")
+	get(h, "/about")
+	hit := func(p string) bool { return get(h, p).Header().Get("X-Cache") == "HIT" }
+	if !hit("/articles/1") || !hit("/articles/2") || !hit("/about") {
+		t.Fatal("warm-up failed")
+	}
+
+	ctx := context.Background()
+	if err := c.PurgeTags(ctx, "article-1"); err != nil {
+		t.Fatal(err)
+	}
+	if hit("/articles/1") || !hit("/articles/2") {
+		t.Fatal("tag purge should only drop article-1")
+	}
+	_ = c.PurgeTags(ctx, "articles")
+	if hit("/articles/1") || hit("/articles/2") || !hit("/about") {
+		t.Fatal("tag purge of 'articles'")
+	}
+	_ = c.Purge(ctx, "/about")
+	if hit("/about") {
+		t.Fatal("key purge")
+	}
+}
+
+// 两个实例各自的本地缓存,通过 mq 广播失效。
+func TestBroadcastPurge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := mq.NewInProc()
+	var calls atomic.Int64
+	handler := counting(&calls, func(h http.Header, _ *http.Request) {
+		h.Set("Cache-Control", "max-age=60")
+		h.Set("Surrogate-Key", "home")
+	})
+	a := New(nil, WithBroadcast(bus, ""))
+	b := New(nil, WithBroadcast(bus, ""))
+	for _, c := range []*Cache{a, b} {
+		if err := c.Subscribe(ctx, bus); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ha, hb := a.Middleware()(handler), b.Middleware()(handler)
+	get(ha, "/")
+	get(hb, "/")
+	if get(hb, "/").Header().Get("X-Cache") != "HIT" {
+		t.Fatal("b not warm")
+	}
+
+	srv := httptest.NewServer(a.PurgeHandler())
+	defer srv.Close()
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"tags":["home"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("purge status=%d", resp.StatusCode)
+	}
+	if get(ha, "/").Header().Get("X-Cache") != "MISS" {
+		t.Fatal("a should be purged synchronously")
+	}
+	waitFor(t, func() bool { return get(hb, "/").Header().Get("X-Cache") == "MISS" })
+
+	resp, _ = http.Post(srv.URL, "application/json", strings.NewReader(`{}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("empty purge status=%d", resp.StatusCode)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// plainStore 是只实现 Store 的共享存储(没有版本计数)。
+type plainStore struct{ Store }
+
+func TestNewRequiresSharedTagStore(t *testing.T) {
+	mem := kvstore.NewMemory()
+	defer mem.Stop()
+	if c := New(mem); c.cfg.tags != TagStore(mem) {
+		t.Fatal("kvstore-backed Store should also hold the versions")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("non-local Store without a TagStore must be rejected")
+			}
+		}()
+		New(plainStore{mem})
+	}()
+	if c := New(plainStore{mem}, WithTagStore(mem)); c.cfg.tags != TagStore(mem) {
+		t.Fatal("explicit TagStore ignored")
+	}
+}
+
+func TestLocalTagsBounded(t *testing.T) {
+	ctx := context.Background()
+	tags := newLocalTags(2)
+	v, _ := tags.Incr(ctx, "a", 1, 0)
+	tags.Incr(ctx, "b", 1, 0)
+	tags.Incr(ctx, "c", 1, 0) // 淘汰 a
+	if tags.m.Len() != 2 {
+		t.Fatalf("len = %d", tags.m.Len())
+	}
+	// a 已被淘汰:失效前记录的版本不能再匹配,之后再失效也得到新版本。
+	if cur, _, _ := tags.GetInt(ctx, "a"); cur == 0 || cur < v {
+		t.Fatalf("evicted a = %d, want >= %d", cur, v)
+	}
+	before, _, _ := tags.GetInt(ctx, "a")
+	if after, _ := tags.Incr(ctx, "a", 1, 0); after <= before {
+		t.Fatalf("a: %d -> %d", before, after)
+	}
+}
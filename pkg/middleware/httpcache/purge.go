@@ -0,0 +1,97 @@
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+)
+
+// PurgeRequest 是失效请求:按主键和/或按标签。也是广播消息与 PurgeHandler 请求体的 JSON 格式。
+type PurgeRequest struct {
+	Keys []string `json:"keys,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Purge 按主键(与 WithKeyFunc 一致,默认 path+query)失效条目,含该键下的全部 Vary 变体。
+// 配置了 WithBroadcast 时同时广播给其它实例。
+func (c *Cache) Purge(ctx context.Context, keys ...string) error {
+	return c.purge(ctx, PurgeRequest{Keys: keys})
+}
+
+// PurgeTags 失效带有任一给定 Surrogate-Key 的条目。
+func (c *Cache) PurgeTags(ctx context.Context, tags ...string) error {
+	return c.purge(ctx, PurgeRequest{Tags: tags})
+}
+
+func (c *Cache) purge(ctx context.Context, req PurgeRequest) error {
+	if err := c.apply(ctx, req); err != nil {
+		return err
+	}
+	if c.cfg.pub == nil {
+		return nil
+	}
+	body, _ := json.Marshal(req)
+	return c.cfg.pub.Publish(ctx, mq.Message{
+		Topic:   c.cfg.topic,
+		Body:    body,
+		Headers: map[string]string{"content-type": "application/json"},
+	})
+}
+
+// apply 在本实例执行失效。主键与标签都是版本加一,让旧条目(含主键下全部 Vary 变体)失配;
+// 主键索引顺带删除。
+func (c *Cache) apply(ctx context.Context, req PurgeRequest) error {
+	var errs []error
+	for _, k := range req.Keys {
+		_, err := c.cfg.tags.Incr(ctx, c.keyVerKey(k), 1, 0)
+		errs = append(errs, err, c.store.Delete(ctx, c.indexKey(k)))
+	}
+	for _, t := range req.Tags {
+		_, err := c.cfg.tags.Incr(ctx, c.tagKey(t), 1, 0)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe 订阅失效广播并在本实例执行。每个实例都应订阅(扇出,不要设队列组)。
+// 订阅随 ctx 取消解除。
+func (c *Cache) Subscribe(ctx context.Context, sub mq.Subscriber) error {
+	return sub.Subscribe(ctx, c.cfg.topic, func(ctx context.Context, msg mq.Message) error {
+		var req PurgeRequest
+		if err := json.Unmarshal(msg.Body, &req); err != nil {
+			return err
+		}
+		return c.apply(ctx, req)
+	})
+}
+
+// PurgeHandler 返回失效接口:POST JSON PurgeRequest,成功回 204。
+// 接口本身不鉴权,挂载时请包一层认证中间件。
+//
+//	mux.Handle("/internal/cache/purge", adminAuth(hc.PurgeHandler()))
+func (c *Cache) PurgeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req PurgeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "invalid purge request", http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) == 0 && len(req.Tags) == 0 {
+			http.Error(w, "keys or tags required", http.StatusBadRequest)
+			return
+		}
+		if err := c.purge(r.Context(), req); err != nil {
+			http.Error(w, "purge failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
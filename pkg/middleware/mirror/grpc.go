@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rushteam/beauty/pkg/client/grpcclient"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// mirrorMD 是标记影子请求的 gRPC metadata 键。
+var mirrorMD = strings.ToLower(HeaderMirror)
+
+// UnaryServerInterceptor 返回镜像 gRPC unary 调用的服务端拦截器。请求在 handler 返回后即序列化,
+// 入站 metadata 原样转发(附加 x-mirror 令牌)。带有效 x-mirror 令牌的调用(影子流量,见 WithSecret)
+// 不再镜像,并标记到 ctx(FromShadow);入站的 x-mirror 在交给 handler 前总被删掉。
+// 仅支持 protobuf 消息;流式调用不镜像。
+func UnaryServerInterceptor(m *Mirror) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if vals := md.Get(mirrorMD); len(vals) > 0 {
+			md = md.Copy()
+			delete(md, mirrorMD)
+			ctx = metadata.NewIncomingContext(ctx, md)
+			if m.trusted(info.FullMethod, vals[0]) {
+				return handler(ctxkey.With(ctx, shadowKey, true), req)
+			}
+		}
+		msg, isProto := req.(proto.Message)
+		if !isProto || !m.sample(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		reqBytes, err := proto.Marshal(msg)
+		if err != nil || int64(len(reqBytes)) > m.cfg.maxBody {
+			m.dropped.Add(1)
+			return handler(ctx, req)
+		}
+
+		resp, herr := handler(ctx, req)
+
+		var primary []byte
+		if m.cfg.compare {
+			if pm, ok := resp.(proto.Message); ok && herr == nil {
+				primary, _ = proto.MarshalOptions{Deterministic: true}.Marshal(pm)
+			}
+		}
+		out := metadata.Join(md.Copy(), metadata.Pairs(mirrorMD, m.token(info.FullMethod)))
+		m.spawn(ctx, func(ctx context.Context) {
+			m.replayGRPC(metadata.NewOutgoingContext(ctx, out), info.FullMethod, reqBytes, resp, herr, primary)
+		})
+		return resp, herr
+	}
+}
+
+func (m *Mirror) clientConn() (*grpc.ClientConn, error) {
+	m.grpcOnce.Do(func() {
+		opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, m.cfg.grpcOpts...)
+		m.conn, m.connErr = grpcclient.DialContext(context.Background(), "beauty:///"+m.service,
+			grpcclient.WithRegistry(m.discovery), grpcclient.WithGRPCDialOptions(opts...))
+	})
+	return m.conn, m.connErr
+}
+
+func (m *Mirror) replayGRPC(ctx context.Context, method string, req []byte, primaryResp any, primaryErr error, primary []byte) {
+	conn, err := m.clientConn()
+	if err != nil {
+		m.failed.Add(1)
+		return
+	}
+	var shadow rawFrame
+	serr := conn.Invoke(ctx, method, rawFrame(req), &shadow, grpc.ForceCodecV2(rawCodec{}))
+	if st, ok := status.FromError(serr); !ok || isTransportFailure(st.Code()) {
+		m.failed.Add(1)
+		return
+	}
+	m.mirrored.Add(1)
+	if !m.cfg.compare {
+		return
+	}
+	pCode, sCode := status.Code(primaryErr), status.Code(serr)
+	same := pCode == sCode
+	if same && primaryErr == nil {
+		same = m.sameMessage(primaryResp, shadow)
+	}
+	if same {
+		return
+	}
+	m.report(ctx, Diff{
+		Kind:          "grpc",
+		Path:          method,
+		PrimaryStatus: int(pCode),
+		ShadowStatus:  int(sCode),
+		PrimaryBody:   primary,
+		ShadowBody:    []byte(shadow),
+	})
+}
+
+// sameMessage 把影子响应解到与主响应同类型的消息后按 proto.Equal 比较(不受字段顺序影响)。
+func (m *Mirror) sameMessage(primaryResp any, shadow []byte) bool {
+	pm, ok := primaryResp.(proto.Message)
+	if !ok {
+		return true
+	}
+	sm := pm.ProtoReflect().New().Interface()
+	if err := proto.Unmarshal(shadow, sm); err != nil {
+		return false
+	}
+	return proto.Equal(pm, sm)
+}
+
+// isTransportFailure 判断影子调用是否没能得到服务端的有效答复(不参与比对,计入 Failed)。
+func isTransportFailure(c codes.Code) bool {
+	return c == codes.Unavailable || c == codes.DeadlineExceeded || c == codes.Canceled
+}
+
+// rawFrame 是已序列化的消息字节,经 rawCodec 原样收发,镜像无需知道具体消息类型。
+type rawFrame []byte
+
+// rawCodec 以 "proto" 名义注册内容类型,但不做编解码,只搬运字节。
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) (mem.BufferSlice, error) {
+	return mem.BufferSlice{mem.SliceBuffer(v.(rawFrame))}, nil
+}
+
+func (rawCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	*(v.(*rawFrame)) = data.Materialize()
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
@@ -0,0 +1,167 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	resty "github.com/rushteam/beauty/pkg/client/http"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+type httpRoundTripper = http.RoundTripper
+
+// HTTPMiddleware 返回镜像 HTTP 请求的中间件。带有效 X-Mirror 令牌的请求(影子流量,见 WithSecret)
+// 不再镜像以防环路,并标记到 ctx(FromShadow);入站的 X-Mirror 头在交给 handler 前总被删掉。
+func HTTPMiddleware(m *Mirror) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if v := r.Header.Get(HeaderMirror); v != "" {
+				shadow := m.trusted(r.URL.Path, v)
+				r = r.Clone(r.Context())
+				r.Header.Del(HeaderMirror)
+				if shadow {
+					next.ServeHTTP(w, r.WithContext(ctxkey.With(r.Context(), shadowKey, true)))
+					return
+				}
+			}
+			if !m.sample(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, ok := m.bufferBody(r)
+			if !ok {
+				m.dropped.Add(1)
+				next.ServeHTTP(w, r)
+				return
+			}
+			shadow := r.Clone(context.WithoutCancel(r.Context()))
+			shadow.RequestURI = ""
+			shadow.Header.Set(HeaderMirror, m.token(r.URL.Path))
+
+			var rec *recorder
+			if m.cfg.compare {
+				rec = &recorder{ResponseWriter: w, limit: m.cfg.maxBody}
+				w = rec
+			}
+			next.ServeHTTP(w, r)
+
+			m.spawn(r.Context(), func(ctx context.Context) { m.replayHTTP(ctx, shadow, body, rec) })
+		})
+	}
+}
+
+// bufferBody 读入至多 maxBody 字节并把 r.Body 还原为完整流;超限返回 false(主请求不受影响)。
+func (m *Mirror) bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > m.cfg.maxBody {
+		return nil, false
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, m.cfg.maxBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || int64(len(buf)) > m.cfg.maxBody {
+		return nil, false
+	}
+	return buf, true
+}
+
+func (m *Mirror) roundTripper() http.RoundTripper {
+	m.httpOnce.Do(func() {
+		opts := append([]resty.HTTPDiscoveryOption{resty.WithHTTPMaxRetries(0)}, m.cfg.httpOpts...)
+		m.httpRT = resty.NewDiscoveryTransport(m.discovery, m.service, opts...)
+	})
+	return m.httpRT
+}
+
+func (m *Mirror) replayHTTP(ctx context.Context, req *http.Request, body []byte, primary *recorder) {
+	req = req.WithContext(ctx)
+	req.URL.Scheme, req.URL.Host = "http", m.service
+	req.Body, req.GetBody = http.NoBody, nil
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	req.ContentLength = int64(len(body))
+
+	resp, err := m.roundTripper().RoundTrip(req)
+	if err != nil {
+		m.failed.Add(1)
+		return
+	}
+	defer resp.Body.Close()
+	var shadowBody []byte
+	if primary != nil {
+		shadowBody, err = io.ReadAll(io.LimitReader(resp.Body, m.cfg.maxBody+1))
+	} else {
+		_, err = io.Copy(io.Discard, resp.Body)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		m.failed.Add(1)
+		return
+	}
+	m.mirrored.Add(1)
+	if primary == nil {
+		return
+	}
+	// 任一侧响应体超出缓冲上限时只比较状态码。
+	bodyComparable := !primary.overflow && int64(len(shadowBody)) <= m.cfg.maxBody
+	if primary.status() == resp.StatusCode && (!bodyComparable || m.sameBody(primary.buf.Bytes(), shadowBody)) {
+		return
+	}
+	m.report(ctx, Diff{
+		Kind:          "http",
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		PrimaryStatus: primary.status(),
+		ShadowStatus:  resp.StatusCode,
+		PrimaryBody:   primary.buf.Bytes(),
+		ShadowBody:    shadowBody,
+	})
+}
+
+// recorder 记录主响应的状态码与前 limit 字节响应体,供比对。
+type recorder struct {
+	http.ResponseWriter
+	code     int
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	if !r.overflow {
+		if room := r.limit - int64(r.buf.Len()); int64(len(b)) <= room {
+			r.buf.Write(b)
+		} else {
+			r.overflow = true
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+// Unwrap 供 http.ResponseController 找到底层 writer(Flush 等)。
+func (r *recorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
@@ -0,0 +1,283 @@
+// Package mirror 提供流量镜像(影子流量)中间件:把线上请求按比例异步复制到影子部署,
+// 用于验证重写/新版本,调用方无感知。
+//
+// 语义:
+//
+//   - 主路径优先:镜像在主请求处理完成后于独立 goroutine 中发出,响应被丢弃;并发由
+//     foundation/semaphore 限定,槽位满时直接放弃本次镜像(计入 Dropped),绝不阻塞主路径。
+//
+//   - 请求体最多缓冲 WithMaxBodySize 字节(默认 1MiB),超限的请求不镜像,主请求照常读取完整 body。
+//
+//   - 影子目标经 discover.Discovery 按服务名解析(HTTP 复用 pkg/client/http 的发现 transport,
+//     gRPC 复用 grpcclient.DialContext),影子请求带 X-Mirror 头 / x-mirror metadata。
+//
+//   - 入站的 X-Mirror 不可信:任何外部调用方都能带上它。只有配置了 WithSecret 且令牌校验通过的请求
+//     才算影子流量——不再镜像,并在 ctx 上标记(FromShadow);其余请求一律先删掉该头再处理。
+//     影子服务应挂上同一 WithSecret 的中间件,用 FromShadow 而不是裸头判断是否跳过外部副作用
+//     (发短信、扣款等)。
+//
+//   - WithCompare 开启比对:HTTP 比较状态码与响应体,gRPC 比较状态码与响应消息,
+//     不一致时回调 DiffFunc(默认 slog.Warn)并计入 Stats.Diffs。
+//
+//     m := mirror.New(registry, "order-svc-shadow",
+//     mirror.WithSampleRate(0.05),
+//     mirror.WithPaths("/orders/*", "/order.v1.Order/*"),
+//     mirror.WithCompare(nil),
+//     mirror.WithSecret(secret), // 影子部署挂同一密钥,handler 里用 mirror.FromShadow(ctx) 跳过副作用
+//     )
+//     defer m.Close()
+//     handler = mirror.HTTPMiddleware(m)(handler)
+//     grpc.ChainUnaryInterceptor(mirror.UnaryServerInterceptor(m))
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"math/rand/v2"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	resty "github.com/rushteam/beauty/pkg/client/http"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/foundation/semaphore"
+	"github.com/rushteam/beauty/pkg/service/discover"
+	"google.golang.org/grpc"
+)
+
+// HeaderMirror 标记影子请求的 HTTP 头;gRPC 使用同名小写 metadata。配置了 WithSecret 时取值为
+// 令牌,否则为 "1"(仅供观测,不被本包采信)。
+const HeaderMirror = "X-Mirror"
+
+var shadowKey = ctxkey.New[bool]()
+
+// FromShadow 报告 ctx 所属请求是否为经 WithSecret 认证的影子流量。
+func FromShadow(ctx context.Context) bool {
+	v, _ := ctxkey.Get(ctx, shadowKey)
+	return v
+}
+
+// Diff 描述一次主/影子响应不一致。Body 字段最多保留 WithMaxBodySize 字节。
+type Diff struct {
+	Kind          string // "http" 或 "grpc"
+	Method        string // HTTP 方法;gRPC 为空
+	Path          string // HTTP 路径或 gRPC 全方法名
+	PrimaryStatus int    // HTTP 状态码或 gRPC code
+	ShadowStatus  int
+	PrimaryBody   []byte // HTTP 响应体;gRPC 为序列化后的响应消息
+	ShadowBody    []byte
+}
+
+// DiffFunc 接收不一致记录,在镜像 goroutine 中调用。
+type DiffFunc func(ctx context.Context, d Diff)
+
+// Stats 是镜像计数(自创建起累计)。
+type Stats struct {
+	Sampled  uint64 // 命中匹配与采样的请求
+	Mirrored uint64 // 已发往影子并收到响应
+	Dropped  uint64 // 并发槽满或 body 超限而放弃
+	Failed   uint64 // 影子请求出错(网络、超时、无实例)
+	Diffs    uint64 // 比对不一致
+}
+
+// Option 配置 Mirror。
+type Option func(*config)
+
+type config struct {
+	rate        float64
+	paths       []string
+	maxBody     int64
+	concurrency int64
+	timeout     time.Duration
+	compare     bool
+	onDiff      DiffFunc
+	normalize   func([]byte) []byte
+	httpOpts    []resty.HTTPDiscoveryOption
+	grpcOpts    []grpc.DialOption
+	rand        func() float64
+	secret      []byte
+}
+
+// WithSampleRate 设置镜像比例 [0,1],默认 1(全部命中的请求)。
+func WithSampleRate(r float64) Option { return func(c *config) { c.rate = r } }
+
+// WithPaths 只镜像匹配任一 path.Match 模式的请求(HTTP 路径或 gRPC 全方法名),默认全部。
+func WithPaths(patterns ...string) Option { return func(c *config) { c.paths = patterns } }
+
+// WithMaxBodySize 设置请求/响应体缓冲上限,默认 1MiB;请求体超限的请求不镜像。
+func WithMaxBodySize(n int64) Option { return func(c *config) { c.maxBody = n } }
+
+// WithConcurrency 设置同时在途的影子请求上限,默认 16。
+func WithConcurrency(n int64) Option { return func(c *config) { c.concurrency = n } }
+
+// WithSecret 设置主、影子部署共享的密钥:影子请求的 X-Mirror 取值为按路径(gRPC 为全方法名)
+// 计算的 HMAC-SHA256 令牌,入站带有效令牌的请求才被当作影子流量。影子部署若也挂了镜像中间件,
+// 须配置同一密钥,否则会把影子流量再镜像一次。
+func WithSecret(secret []byte) Option { return func(c *config) { c.secret = secret } }
+
+// WithTimeout 设置单个影子请求的超时,默认 5s。
+func WithTimeout(d time.Duration) Option { return func(c *config) { c.timeout = d } }
+
+// WithCompare 开启主/影子响应比对,不一致时调用 fn;fn 为 nil 时记 slog.Warn。
+func WithCompare(fn DiffFunc) Option {
+	return func(c *config) {
+		c.compare = true
+		c.onDiff = fn
+	}
+}
+
+// WithNormalize 在比对 HTTP 响应体前先规整(如去掉时间戳、请求 ID 等必然不同的字段);
+// gRPC 响应按 proto.Equal 比较,不经过它。
+func WithNormalize(fn func(body []byte) []byte) Option { return func(c *config) { c.normalize = fn } }
+
+// WithHTTPOptions 透传给影子 HTTP 发现 transport 的选项(负载均衡、标签过滤、base transport 等)。
+// 镜像固定不重试。
+func WithHTTPOptions(opts ...resty.HTTPDiscoveryOption) Option {
+	return func(c *config) { c.httpOpts = append(c.httpOpts, opts...) }
+}
+
+// WithGRPCDialOptions 追加影子 gRPC 连接的拨号选项(默认明文,需要 TLS 时在此覆盖传输凭证)。
+func WithGRPCDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *config) { c.grpcOpts = append(c.grpcOpts, opts...) }
+}
+
+// Mirror 把匹配的请求镜像到影子服务。并发安全;用完调用 Close。
+type Mirror struct {
+	cfg       config
+	discovery discover.Discovery
+	service   string
+	sem       *semaphore.Semaphore
+
+	httpOnce sync.Once
+	httpRT   httpRoundTripper
+	grpcOnce sync.Once
+	conn     *grpc.ClientConn
+	connErr  error
+
+	mu                                        sync.Mutex // 保护 closed,使 spawn 的 wg.Add 不与 Close 的 wg.Wait 并发
+	closed                                    bool
+	wg                                        sync.WaitGroup
+	sampled, mirrored, dropped, failed, diffs atomic.Uint64
+}
+
+// New 创建镜像器,影子目标为 d 中名为 service 的实例。连接在首次镜像时建立。
+func New(d discover.Discovery, service string, opts ...Option) *Mirror {
+	cfg := config{rate: 1, maxBody: 1 << 20, concurrency: 16, timeout: 5 * time.Second, rand: rand.Float64}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+	return &Mirror{
+		cfg:       cfg,
+		discovery: d,
+		service:   service,
+		sem:       semaphore.New(semaphore.WithCapacity(cfg.concurrency)),
+	}
+}
+
+// Stats 返回镜像计数。
+func (m *Mirror) Stats() Stats {
+	return Stats{
+		Sampled:  m.sampled.Load(),
+		Mirrored: m.mirrored.Load(),
+		Dropped:  m.dropped.Load(),
+		Failed:   m.failed.Load(),
+		Diffs:    m.diffs.Load(),
+	}
+}
+
+// Close 等待在途影子请求结束并释放连接。之后的请求不再镜像。
+func (m *Mirror) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.wg.Wait()
+	if s, ok := m.httpRT.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+	if m.conn != nil {
+		return m.conn.Close()
+	}
+	return nil
+}
+
+// sample 判断是否镜像:匹配路径 → 采样。并发槽在主请求完成后由 spawn 再抢,
+// 慢的主请求不占用镜像名额。
+func (m *Mirror) sample(p string) bool {
+	if len(m.cfg.paths) > 0 {
+		ok := false
+		for _, pat := range m.cfg.paths {
+			if hit, _ := path.Match(pat, p); hit {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if m.cfg.rate <= 0 || (m.cfg.rate < 1 && m.cfg.rate <= m.cfg.rand()) {
+		return false
+	}
+	m.sampled.Add(1)
+	return true
+}
+
+// spawn 抢一个并发槽后在独立 goroutine 中运行 fn,ctx 脱离主请求的取消但保留其值(trace 等),
+// 并带超时。槽位满或已 Close 时放弃本次镜像(计入 Dropped)。
+func (m *Mirror) spawn(parent context.Context, fn func(ctx context.Context)) {
+	m.mu.Lock()
+	if m.closed || !m.sem.TryAcquire(1) {
+		m.mu.Unlock()
+		m.dropped.Add(1)
+		return
+	}
+	m.wg.Add(1)
+	m.mu.Unlock()
+	go func() {
+		defer m.wg.Done()
+		defer m.sem.Release(1)
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), m.cfg.timeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// token 返回影子请求 X-Mirror 的取值。
+func (m *Mirror) token(p string) string {
+	if m.cfg.secret == nil {
+		return "1"
+	}
+	mac := hmac.New(sha256.New, m.cfg.secret)
+	mac.Write([]byte(p))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// trusted 判断入站的 X-Mirror 取值是否为 p 的有效令牌;未配置密钥时一律不可信。
+func (m *Mirror) trusted(p, v string) bool {
+	return m.cfg.secret != nil && v != "" && hmac.Equal([]byte(v), []byte(m.token(p)))
+}
+
+func (m *Mirror) report(ctx context.Context, d Diff) {
+	m.diffs.Add(1)
+	if m.cfg.onDiff != nil {
+		m.cfg.onDiff(ctx, d)
+		return
+	}
+	slog.WarnContext(ctx, "mirror: shadow response differs",
+		"kind", d.Kind, "path", d.Path, "primary_status", d.PrimaryStatus, "shadow_status", d.ShadowStatus)
+}
+
+func (m *Mirror) sameBody(a, b []byte) bool {
+	if m.cfg.normalize != nil {
+		a, b = m.cfg.normalize(a), m.cfg.normalize(b)
+	}
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,316 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/service/discover"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+type staticDiscovery struct{ addr string }
+
+func (d staticDiscovery) Find(context.Context, string) ([]discover.ServiceInfo, error) {
+	return []discover.ServiceInfo{{ID: d.addr, Addr: d.addr}}, nil
+}
+
+func (d staticDiscovery) Watch(ctx context.Context, _ string, n discover.Notify) error {
+	n([]discover.ServiceInfo{{ID: d.addr, Addr: d.addr}})
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type shadowHit struct {
+	method, path, body, mirror string
+}
+
+func newShadow(t *testing.T, status int, reply string) (*httptest.Server, chan shadowHit) {
+	hits := make(chan shadowHit, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		hits <- shadowHit{r.Method, r.URL.Path, string(b), r.Header.Get(HeaderMirror)}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hits
+}
+
+func echoPrimary(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("primary read body: %v", err)
+		}
+		io.WriteString(w, "ok:"+string(b))
+	})
+}
+
+func TestHTTPMirrorReplaysRequest(t *testing.T) {
+	srv, hits := newShadow(t, http.StatusOK, "ignored")
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow")
+	h := HTTPMiddleware(m)(echoPrimary(t))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("payload")))
+	if rr.Body.String() != "ok:payload" {
+		t.Fatalf("primary response = %q", rr.Body.String())
+	}
+	m.Close()
+
+	hit := <-hits
+	if hit.method != http.MethodPost || hit.path != "/orders/1" || hit.body != "payload" || hit.mirror != "1" {
+		t.Fatalf("shadow got %+v", hit)
+	}
+	if s := m.Stats(); s.Sampled != 1 || s.Mirrored != 1 || s.Diffs != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestHTTPMirrorCompare(t *testing.T) {
+	srv, _ := newShadow(t, http.StatusCreated, "ok:payload")
+	var mu sync.Mutex
+	var diffs []Diff
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow",
+		WithCompare(func(_ context.Context, d Diff) {
+			mu.Lock()
+			diffs = append(diffs, d)
+			mu.Unlock()
+		}))
+	h := HTTPMiddleware(m)(echoPrimary(t))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/x", strings.NewReader("payload")))
+	m.Close()
+
+	if len(diffs) != 1 {
+		t.Fatalf("diffs = %d, want 1", len(diffs))
+	}
+	d := diffs[0]
+	if d.Kind != "http" || d.PrimaryStatus != 200 || d.ShadowStatus != 201 || string(d.PrimaryBody) != "ok:payload" {
+		t.Fatalf("diff = %+v", d)
+	}
+	if m.Stats().Diffs != 1 {
+		t.Fatalf("stats = %+v", m.Stats())
+	}
+}
+
+func TestHTTPMirrorNormalize(t *testing.T) {
+	srv, _ := newShadow(t, http.StatusOK, "OK:PAYLOAD")
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow",
+		WithCompare(nil), WithNormalize(func(b []byte) []byte { return []byte(strings.ToLower(string(b))) }))
+	HTTPMiddleware(m)(echoPrimary(t)).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/x", strings.NewReader("payload")))
+	m.Close()
+	if s := m.Stats(); s.Mirrored != 1 || s.Diffs != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestHTTPMirrorSkips(t *testing.T) {
+	srv, hits := newShadow(t, http.StatusOK, "")
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow",
+		WithPaths("/orders/*"), WithMaxBodySize(4))
+	h := HTTPMiddleware(m)(echoPrimary(t))
+
+	// 路径不匹配
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	// body 超限:主请求仍拿到完整 body
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("too large"))
+	req.ContentLength = -1
+	h.ServeHTTP(rr, req)
+	if rr.Body.String() != "ok:too large" {
+		t.Fatalf("primary response = %q", rr.Body.String())
+	}
+	m.Close()
+
+	if len(hits) != 0 {
+		t.Fatalf("shadow got %d requests, want 0", len(hits))
+	}
+	if s := m.Stats(); s.Sampled != 1 || s.Dropped != 1 || s.Mirrored != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestHTTPMirrorShadowHeaderAuthenticated(t *testing.T) {
+	srv, hits := newShadow(t, http.StatusOK, "")
+	secret := []byte("s3cret")
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow", WithSecret(secret))
+	var sawHeader, sawShadow []bool
+	h := HTTPMiddleware(m)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawHeader = append(sawHeader, r.Header.Get(HeaderMirror) != "")
+		sawShadow = append(sawShadow, FromShadow(r.Context()))
+	}))
+
+	// 外部调用方伪造的头:删掉后照常处理与镜像,不算影子流量
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set(HeaderMirror, "1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	hit := <-hits
+	if !m.trusted(hit.path, hit.mirror) {
+		t.Fatalf("shadow request carries %q, want a valid token", hit.mirror)
+	}
+	// 影子部署收到的有效令牌:不再镜像,标记为影子流量
+	req = httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set(HeaderMirror, hit.mirror)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	// 别的路径的令牌不通用
+	req = httptest.NewRequest(http.MethodGet, "/orders/2", nil)
+	req.Header.Set(HeaderMirror, hit.mirror)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	m.Close()
+
+	if len(hits) != 1 {
+		t.Fatalf("shadow got %d more requests, want 1", len(hits))
+	}
+	if fmt.Sprint(sawHeader) != "[false false false]" || fmt.Sprint(sawShadow) != "[false true false]" {
+		t.Fatalf("handler saw header=%v shadow=%v", sawHeader, sawShadow)
+	}
+	if s := m.Stats(); s.Sampled != 2 || s.Mirrored != 2 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestHTTPMirrorConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer srv.Close()
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow", WithConcurrency(1))
+	h := HTTPMiddleware(m)(echoPrimary(t))
+
+	for range 3 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	close(release)
+	m.Close()
+	if s := m.Stats(); s.Sampled != 3 || s.Dropped != 2 || s.Mirrored != 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestHTTPMirrorSlowPrimaryHoldsNoSlot(t *testing.T) {
+	srv, hits := newShadow(t, http.StatusOK, "")
+	m := New(staticDiscovery{srv.Listener.Addr().String()}, "shadow", WithConcurrency(1))
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	h := HTTPMiddleware(m)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-unblock
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+	// 慢主请求还在处理,不应占住唯一的镜像槽。
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if hit := <-hits; hit.path != "/fast" {
+		t.Fatalf("first shadow hit = %+v", hit)
+	}
+	for m.Stats().Mirrored != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	<-done
+	m.Close()
+	if s := m.Stats(); s.Sampled != 2 || s.Dropped != 0 || s.Mirrored != 2 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// Close 之后不再镜像。
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if s := m.Stats(); s.Dropped != 1 || s.Mirrored != 2 {
+		t.Fatalf("after close stats = %+v", s)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	m := New(staticDiscovery{}, "shadow", WithSampleRate(0.5))
+	vals := []float64{0.2, 0.7}
+	m.cfg.rand = func() float64 { v := vals[0]; vals = vals[1:]; return v }
+	if !m.sample("/") {
+		t.Fatal("0.2 < 0.5 should be sampled")
+	}
+	if m.sample("/") {
+		t.Fatal("0.7 >= 0.5 should not be sampled")
+	}
+	if New(staticDiscovery{}, "shadow", WithSampleRate(0)).sample("/") {
+		t.Fatal("rate 0 should never sample")
+	}
+}
+
+func TestGRPCMirror(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow := health.NewServer()
+	shadow.SetServingStatus("svc", healthpb.HealthCheckResponse_NOT_SERVING)
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, shadow)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	var diffs []Diff
+	m := New(staticDiscovery{lis.Addr().String()}, "shadow",
+		WithCompare(func(_ context.Context, d Diff) { diffs = append(diffs, d) }))
+	ic := UnaryServerInterceptor(m)
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	serving := func(context.Context, any) (any, error) {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	}
+
+	resp, err := ic(context.Background(), &healthpb.HealthCheckRequest{Service: "svc"}, info, serving)
+	if err != nil || resp.(*healthpb.HealthCheckResponse).Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("primary = %v, %v", resp, err)
+	}
+	m.wg.Wait()
+	if len(diffs) != 1 || diffs[0].Kind != "grpc" || diffs[0].PrimaryStatus != 0 || diffs[0].ShadowStatus != 0 {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+
+	// 状态一致:无 diff
+	shadow.SetServingStatus("svc", healthpb.HealthCheckResponse_SERVING)
+	_, _ = ic(context.Background(), &healthpb.HealthCheckRequest{Service: "svc"}, info, serving)
+	// 影子返回 NotFound(未知服务),主成功:diff
+	_, _ = ic(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"}, info, serving)
+	m.Close()
+
+	if len(diffs) != 2 || diffs[1].ShadowStatus != 5 {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+	if s := m.Stats(); s.Mirrored != 3 || s.Failed != 0 || s.Diffs != 2 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestGRPCMirrorShadowMetadata(t *testing.T) {
+	m := New(staticDiscovery{}, "shadow", WithSecret([]byte("s3cret")))
+	defer m.Close()
+	ic := UnaryServerInterceptor(m)
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	var shadow, leaked bool
+	handler := func(ctx context.Context, _ any) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		shadow, leaked = FromShadow(ctx), len(md.Get(mirrorMD)) > 0
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(mirrorMD, m.token(info.FullMethod)))
+	_, _ = ic(ctx, &healthpb.HealthCheckRequest{}, info, handler)
+	if !shadow || leaked || m.Stats().Sampled != 0 {
+		t.Fatalf("valid token: shadow=%v leaked=%v stats=%+v", shadow, leaked, m.Stats())
+	}
+}
@@ -51,7 +51,7 @@ func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
 		resp, err = handler(ctx, req)
 		if err != nil {
 			if s, ok := apperrors.FromError(err); ok {
-				err = apperrors.ToGRPC(s)
+				err = apperrors.ToGRPCContext(ctx, s)
 			}
 		}
 		return resp, err
@@ -71,7 +71,7 @@ func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
 		err = handler(srv, ss)
 		if err != nil {
 			if s, ok := apperrors.FromError(err); ok {
-				err = apperrors.ToGRPC(s)
+				err = apperrors.ToGRPCContext(ss.Context(), s)
 			}
 		}
 		return err
@@ -0,0 +1,188 @@
+// Package secheaders 提供浏览器安全响应头中间件:CSP(支持逐请求 nonce)、HSTS、
+// X-Frame-Options、X-Content-Type-Options、Referrer-Policy、Permissions-Policy,
+// 以及跨源隔离用的 COOP / COEP / CORP。
+//
+// 默认值偏保守且不破坏普通站点:nosniff、DENY、strict-origin-when-cross-origin、
+// COOP same-origin、HTTPS 请求上的 HSTS(两年,含子域);CSP 与 COEP 需显式开启。
+//
+// CSP 策略中的 {nonce} 占位符会被替换为本请求的随机 nonce('nonce-xxx'),
+// 模板用 Nonce(ctx) 取出写进 <script nonce="..."> 即可。
+//
+// 头在调用下游之前写入,下游或内层中间件可覆盖;按路由挂不同配置(经 handler.WithMiddleware)
+// 时,内层实例会重新生成 nonce 并覆盖 CSP,ctx 中的 Nonce 与最终发出的策略保持一致。
+package secheaders
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// Option 配置中间件。
+type Option func(*options)
+
+type options struct {
+	csp            string
+	cspReportOnly  bool
+	hstsMaxAge     int
+	hstsSubdomains bool
+	hstsPreload    bool
+	hstsAlways     bool
+	frameOptions   string
+	nosniff        bool
+	referrerPolicy string
+	permissions    string
+	coop           string
+	coep           string
+	corp           string
+	skipper        func(*http.Request) bool
+}
+
+// WithCSP 设置 Content-Security-Policy;可含 {nonce} 占位符。
+//
+//	secheaders.WithCSP("default-src 'self'; script-src 'self' {nonce}; object-src 'none'")
+func WithCSP(policy string) Option { return func(o *options) { o.csp = policy } }
+
+// WithCSPReportOnly 以 Content-Security-Policy-Report-Only 下发 CSP,只上报不拦截,用于灰度新策略。
+func WithCSPReportOnly() Option { return func(o *options) { o.cspReportOnly = true } }
+
+// WithHSTS 设置 Strict-Transport-Security;maxAge <= 0 关闭。
+func WithHSTS(maxAge int, includeSubdomains, preload bool) Option {
+	return func(o *options) { o.hstsMaxAge, o.hstsSubdomains, o.hstsPreload = maxAge, includeSubdomains, preload }
+}
+
+// WithHSTSAlways 在非 TLS 请求上也下发 HSTS,用于 TLS 在前置代理终止的部署。
+func WithHSTSAlways() Option { return func(o *options) { o.hstsAlways = true } }
+
+// WithFrameOptions 设置 X-Frame-Options("DENY" / "SAMEORIGIN");空串不下发。
+func WithFrameOptions(v string) Option { return func(o *options) { o.frameOptions = v } }
+
+// WithoutNosniff 不下发 X-Content-Type-Options: nosniff。
+func WithoutNosniff() Option { return func(o *options) { o.nosniff = false } }
+
+// WithReferrerPolicy 设置 Referrer-Policy;空串不下发。
+func WithReferrerPolicy(v string) Option { return func(o *options) { o.referrerPolicy = v } }
+
+// WithPermissionsPolicy 设置 Permissions-Policy,如 "camera=(), geolocation=(self)"。
+func WithPermissionsPolicy(v string) Option { return func(o *options) { o.permissions = v } }
+
+// WithCOOP 设置 Cross-Origin-Opener-Policy;空串不下发。
+func WithCOOP(v string) Option { return func(o *options) { o.coop = v } }
+
+// WithCOEP 设置 Cross-Origin-Embedder-Policy(如 "require-corp"),与 COOP same-origin
+// 一起启用跨源隔离(SharedArrayBuffer 等)。默认不下发。
+func WithCOEP(v string) Option { return func(o *options) { o.coep = v } }
+
+// WithCORP 设置 Cross-Origin-Resource-Policy(如 "same-origin")。默认不下发。
+func WithCORP(v string) Option { return func(o *options) { o.corp = v } }
+
+// WithSkipper 返回 true 的请求不写任何头。
+func WithSkipper(fn func(*http.Request) bool) Option { return func(o *options) { o.skipper = fn } }
+
+var nonceKey = ctxkey.New[string]()
+
+// Nonce 返回本请求的 CSP nonce(base64,不含 'nonce-' 前缀);未配置含 {nonce} 的 CSP 时为空串。
+func Nonce(ctx context.Context) string { return ctxkey.MustGet(ctx, nonceKey) }
+
+// Middleware 返回安全响应头中间件。
+//
+//	mux.Handle("/", secheaders.Middleware(
+//	    secheaders.WithCSP("default-src 'self'; script-src {nonce}"),
+//	    secheaders.WithCOEP("require-corp"),
+//	)(app))
+func Middleware(opts ...Option) func(http.Handler) http.Handler {
+	o := &options{
+		hstsMaxAge:     63072000,
+		hstsSubdomains: true,
+		frameOptions:   "DENY",
+		nosniff:        true,
+		referrerPolicy: "strict-origin-when-cross-origin",
+		coop:           "same-origin",
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	static := o.staticHeaders()
+	useNonce := strings.Contains(o.csp, "{nonce}")
+	cspHeader := "Content-Security-Policy"
+	if o.cspReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	hsts := o.hsts()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.skipper != nil && o.skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			for _, kv := range static {
+				h.Set(kv[0], kv[1])
+			}
+			if hsts != "" && (r.TLS != nil || o.hstsAlways) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if o.csp != "" {
+				policy := o.csp
+				if useNonce {
+					nonce, err := newNonce()
+					if err != nil {
+						http.Error(w, "secheaders: nonce generation failed", http.StatusInternalServerError)
+						return
+					}
+					policy = strings.ReplaceAll(policy, "{nonce}", "'nonce-"+nonce+"'")
+					r = r.WithContext(ctxkey.With(r.Context(), nonceKey, nonce))
+				}
+				h.Set(cspHeader, policy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (o *options) staticHeaders() [][2]string {
+	var hs [][2]string
+	add := func(k, v string) {
+		if v != "" {
+			hs = append(hs, [2]string{k, v})
+		}
+	}
+	if o.nosniff {
+		add("X-Content-Type-Options", "nosniff")
+	}
+	add("X-Frame-Options", o.frameOptions)
+	add("Referrer-Policy", o.referrerPolicy)
+	add("Permissions-Policy", o.permissions)
+	add("Cross-Origin-Opener-Policy", o.coop)
+	add("Cross-Origin-Embedder-Policy", o.coep)
+	add("Cross-Origin-Resource-Policy", o.corp)
+	return hs
+}
+
+func (o *options) hsts() string {
+	if o.hstsMaxAge <= 0 {
+		return ""
+	}
+	v := "max-age=" + strconv.Itoa(o.hstsMaxAge)
+	if o.hstsSubdomains {
+		v += "; includeSubDomains"
+	}
+	if o.hstsPreload {
+		v += "; preload"
+	}
+	return v
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
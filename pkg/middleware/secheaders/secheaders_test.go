@@ -0,0 +1,92 @@
+package secheaders
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(mw func(http.Handler) http.Handler, r *http.Request) (*httptest.ResponseRecorder, string) {
+	var nonce string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r.Context())
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec, nonce
+}
+
+func TestDefaults(t *testing.T) {
+	rec, nonce := serve(Middleware(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h := rec.Header()
+	want := map[string]string{
+		"X-Content-Type-Options":     "nosniff",
+		"X-Frame-Options":            "DENY",
+		"Referrer-Policy":            "strict-origin-when-cross-origin",
+		"Cross-Origin-Opener-Policy": "same-origin",
+	}
+	for k, v := range want {
+		if h.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, h.Get(k), v)
+		}
+	}
+	for _, k := range []string{"Strict-Transport-Security", "Content-Security-Policy", "Cross-Origin-Embedder-Policy"} {
+		if h.Get(k) != "" {
+			t.Errorf("%s should be unset on plain http by default, got %q", k, h.Get(k))
+		}
+	}
+	if nonce != "" {
+		t.Fatalf("nonce without CSP: %q", nonce)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	rec, _ = serve(Middleware(WithHSTS(31536000, true, true)), r)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains; preload" {
+		t.Fatalf("hsts=%q", got)
+	}
+}
+
+// 每个请求一个新 nonce,且 ctx 中的值与 CSP 头一致。
+func TestCSPNonce(t *testing.T) {
+	mw := Middleware(WithCSP("default-src 'self'; script-src 'self' {nonce}"))
+	rec1, n1 := serve(mw, httptest.NewRequest(http.MethodGet, "/", nil))
+	rec2, n2 := serve(mw, httptest.NewRequest(http.MethodGet, "/", nil))
+	if n1 == "" || n1 == n2 {
+		t.Fatalf("nonces not unique: %q %q", n1, n2)
+	}
+	if got := rec1.Header().Get("Content-Security-Policy"); got != "default-src 'self'; script-src 'self' 'nonce-"+n1+"'" {
+		t.Fatalf("csp=%q", got)
+	}
+	if !strings.Contains(rec2.Header().Get("Content-Security-Policy"), n2) {
+		t.Fatal("second response must carry its own nonce")
+	}
+
+	ro := Middleware(WithCSP("script-src {nonce}"), WithCSPReportOnly())
+	rec, _ := serve(ro, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Content-Security-Policy") != "" || rec.Header().Get("Content-Security-Policy-Report-Only") == "" {
+		t.Fatalf("report-only header wrong: %v", rec.Header())
+	}
+}
+
+// 路由级配置:内层实例覆盖外层,nonce 以内层为准。
+func TestPerRouteOverride(t *testing.T) {
+	outer := Middleware(WithCSP("script-src {nonce}"))
+	inner := Middleware(WithFrameOptions("SAMEORIGIN"), WithCSP("script-src 'self' {nonce}"), WithCOEP("require-corp"))
+	rec, nonce := serve(func(h http.Handler) http.Handler { return outer(inner(h)) }, httptest.NewRequest(http.MethodGet, "/embed", nil))
+	h := rec.Header()
+	if h.Get("X-Frame-Options") != "SAMEORIGIN" || h.Get("Cross-Origin-Embedder-Policy") != "require-corp" {
+		t.Fatalf("override: %v", h)
+	}
+	if h.Get("Content-Security-Policy") != "script-src 'self' 'nonce-"+nonce+"'" {
+		t.Fatalf("csp=%q nonce=%q", h.Get("Content-Security-Policy"), nonce)
+	}
+
+	skip := Middleware(WithSkipper(func(r *http.Request) bool { return r.URL.Path == "/raw" }))
+	rec, _ = serve(skip, httptest.NewRequest(http.MethodGet, "/raw", nil))
+	if len(rec.Header()) != 0 {
+		t.Fatalf("skipped request got headers: %v", rec.Header())
+	}
+}
@@ -0,0 +1,686 @@
+package signverify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/middleware/auth"
+)
+
+// 本文件实现 RFC 9421 HTTP Message Signatures(请求签名)与 RFC 9530 Content-Digest。
+//
+// 与上面自定义 HMAC 方案并存:HTTPMessageSignatures 是验签中间件,Signer 是签名方
+// (pkg/client/http 的 SigningTransport 用它给出站请求签名)。支持的算法:
+// ed25519、ecdsa-p256-sha256、ecdsa-p384-sha384、rsa-pss-sha512、rsa-v1_5-sha256、hmac-sha256。
+//
+// 支持的组件:@method @target-uri @authority @scheme @request-target @path @query
+// @query-param;name="..." 以及任意请求头(小写名,如 "content-digest")。
+
+// 算法名(RFC 9421 §6.2 注册表)。
+const (
+	AlgEd25519         = "ed25519"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgECDSAP384SHA384 = "ecdsa-p384-sha384"
+	AlgRSAPSSSHA512    = "rsa-pss-sha512"
+	AlgRSAV15SHA256    = "rsa-v1_5-sha256"
+	AlgHMACSHA256      = "hmac-sha256"
+)
+
+// DefaultCoveredComponents 是 Signer 默认覆盖的组件;带 body 的请求额外覆盖 content-digest。
+var DefaultCoveredComponents = []string{"@method", "@authority", "@path", "@query"}
+
+// DefaultRequiredComponents 是 HTTPMessageSignatures 始终要求覆盖的组件;带 body 的请求还要求
+// 覆盖 content-digest。@target-uri 视为同时覆盖 @authority 与 @path,@request-target 视为覆盖 @path。
+var DefaultRequiredComponents = []string{"@method", "@authority", "@path"}
+
+// Key 是验签用的密钥。Key 字段类型:ed25519.PublicKey、*ecdsa.PublicKey、*rsa.PublicKey,
+// 或 []byte(HMAC 共享密钥)。Alg 为空时按密钥类型推断(RSA 默认 rsa-pss-sha512)。
+type Key struct {
+	Alg string
+	Key any
+}
+
+// KeyFunc 按签名参数里的 keyid 查找验签密钥。返回 false 表示未知 keyid。
+type KeyFunc func(keyID string) (Key, bool)
+
+var keyIDKey = ctxkey.New[string]()
+
+// KeyIDFromContext 返回 HTTPMessageSignatures 验签通过的 keyid;未经验签时为空。
+func KeyIDFromContext(ctx context.Context) string {
+	return ctxkey.MustGet(ctx, keyIDKey)
+}
+
+// WithCoveredComponents 在 DefaultRequiredComponents 之外追加要求覆盖的组件(如 "@query"、"x-user-id"),
+// 未覆盖即拒绝(reason "missing_component")。仅作用于 HTTPMessageSignatures。
+func WithCoveredComponents(components ...string) Option {
+	return func(o *options) { o.requiredComponents = append(o.requiredComponents, components...) }
+}
+
+// WithSignatureLabel 指定校验的签名标签(Signature-Input 里的字典键,如 "sig1")。
+// 默认取第一个同时出现在 Signature 头里的标签。
+func WithSignatureLabel(label string) Option {
+	return func(o *options) { o.label = label }
+}
+
+// WithMaxBodySize 设置校验 Content-Digest 时缓冲请求体的上限(默认 DefaultMaxBodySize),
+// 超过即拒绝(reason "body_too_large"),未签名或伪造的请求不能让服务端无限缓冲。
+// 仅作用于 HTTPMessageSignatures。
+func WithMaxBodySize(n int64) Option {
+	return func(o *options) { o.maxBodySize = n }
+}
+
+// HTTPMessageSignatures 返回 RFC 9421 验签中间件。校验步骤:
+//
+//  1. 解析 Signature-Input / Signature,取标签对应的签名;
+//  2. 按 keyid 查密钥,alg 参数(若有)须与密钥算法一致;
+//  3. created 必填且与当前时间相差不超过 WithMaxAge,expires(若有)未过期;
+//  4. DefaultRequiredComponents 与 WithCoveredComponents 要求的组件均被覆盖,带 body 时还须
+//     携带并覆盖 Content-Digest——否则签名可以被挪用到任意方法、路径或 body 上;
+//  5. 带 Content-Digest 时校验 body 摘要(sha-256 / sha-512),缓冲上限见 WithMaxBodySize;
+//  6. 重建签名基串并验签。
+//
+// 拒绝原因(WithRejectHandler 收到的 reason):"missing_signature"、"invalid_signature_input"、
+// "unknown_key"、"invalid_timestamp"、"timestamp_expired"、"missing_component"、
+// "body_too_large"、"content_digest_mismatch"、"signature_mismatch"。
+//
+// 通过后 keyid 写入 context(KeyIDFromContext);WithExtractUser 时,仅当用户标识 header
+// 被签名覆盖才写入 auth.User。
+func HTTPMessageSignatures(keys KeyFunc, opts ...Option) func(http.Handler) http.Handler {
+	o := defaults()
+	for _, fn := range opts {
+		fn(o)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if shouldSkip(r.URL.Path, o.skipPrefixes) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			keyID, covered, reason := verifyMessage(w, r, keys, o)
+			if reason != "" {
+				o.onReject(w, reason)
+				return
+			}
+			ctx := ctxkey.With(r.Context(), keyIDKey, keyID)
+			if o.extractUser && covered[strings.ToLower(o.userIDHeader)] {
+				if uid := r.Header.Get(o.userIDHeader); uid != "" {
+					ctx = auth.WithUser(ctx, auth.NewUser(uid, "", nil))
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// verifyMessage 校验请求签名,成功返回 keyid 与被覆盖组件集合;失败返回拒绝原因。
+// 会读取并重置 r.Body(需要校验 Content-Digest 时),最多读 maxBodySize 字节。
+func verifyMessage(w http.ResponseWriter, r *http.Request, keys KeyFunc, o *options) (string, map[string]bool, string) {
+	inputs, order, err := parseDictionary(strings.Join(r.Header.Values("Signature-Input"), ", "))
+	if err != nil || len(inputs) == 0 {
+		if err == nil && r.Header.Get("Signature") == "" {
+			return "", nil, "missing_signature"
+		}
+		return "", nil, "invalid_signature_input"
+	}
+	sigs, _, err := parseDictionary(strings.Join(r.Header.Values("Signature"), ", "))
+	if err != nil {
+		return "", nil, "invalid_signature_input"
+	}
+	label := o.label
+	if label == "" {
+		for _, l := range order {
+			if _, ok := sigs[l]; ok {
+				label = l
+				break
+			}
+		}
+	}
+	input, ok1 := inputs[label]
+	sigMember, ok2 := sigs[label]
+	if !ok1 || !ok2 {
+		return "", nil, "missing_signature"
+	}
+	sig, ok := sigMember.item.val.([]byte)
+	if !input.isList || sigMember.isList || !ok {
+		return "", nil, "invalid_signature_input"
+	}
+
+	keyIDVal, _ := findParam(input.params, "keyid")
+	keyID, _ := keyIDVal.(string)
+	key, found := keys(keyID)
+	if keyID == "" || !found {
+		return "", nil, "unknown_key"
+	}
+	alg, err := keyAlg(key)
+	if err != nil {
+		return "", nil, "unknown_key"
+	}
+	if a, ok := findParam(input.params, "alg"); ok && a != alg {
+		return "", nil, "signature_mismatch"
+	}
+
+	now := o.clock()
+	created, ok := findParam(input.params, "created")
+	createdAt, isInt := created.(int64)
+	if !ok || !isInt {
+		return "", nil, "invalid_timestamp"
+	}
+	if o.maxAge > 0 && abs64(now.Unix()-createdAt) > int64(o.maxAge.Seconds()) {
+		return "", nil, "timestamp_expired"
+	}
+	if exp, ok := findParam(input.params, "expires"); ok {
+		if e, isInt := exp.(int64); !isInt || now.Unix() > e {
+			return "", nil, "timestamp_expired"
+		}
+	}
+
+	covered := make(map[string]bool, len(input.inner))
+	for _, it := range input.inner {
+		if name, ok := it.val.(string); ok {
+			covered[name] = true
+		}
+	}
+	for _, c := range DefaultRequiredComponents {
+		if !coversComponent(covered, c) {
+			return "", nil, "missing_component"
+		}
+	}
+	for _, c := range o.requiredComponents {
+		if !coversComponent(covered, strings.ToLower(c)) {
+			return "", nil, "missing_component"
+		}
+	}
+
+	withBody := hasBody(r)
+	if digest := r.Header.Get("Content-Digest"); digest != "" || withBody {
+		if digest == "" || withBody && !covered["content-digest"] {
+			return "", nil, "missing_component"
+		}
+		if r.ContentLength > o.maxBodySize {
+			return "", nil, "body_too_large"
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, o.maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return "", nil, "body_too_large"
+			}
+			return "", nil, "content_digest_mismatch"
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !VerifyContentDigest(digest, body) {
+			return "", nil, "content_digest_mismatch"
+		}
+	}
+
+	base, err := signatureBase(r, input.inner, input.params)
+	if err != nil {
+		return "", nil, "missing_component"
+	}
+	if err := verifyWith(alg, key.Key, []byte(base), sig); err != nil {
+		return "", nil, "signature_mismatch"
+	}
+	return keyID, covered, ""
+}
+
+// coversComponent 判断签名是否覆盖组件 c;@target-uri 包含 @authority 与 @path,
+// @request-target 包含 @path。
+func coversComponent(covered map[string]bool, c string) bool {
+	switch {
+	case covered[c]:
+		return true
+	case c == "@authority":
+		return covered["@target-uri"]
+	case c == "@path":
+		return covered["@target-uri"] || covered["@request-target"]
+	}
+	return false
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+// signatureBase 按 RFC 9421 §2.5 构造签名基串。
+func signatureBase(r *http.Request, components []sfItem, params []sfParam) (string, error) {
+	var sb strings.Builder
+	seen := make(map[string]bool, len(components))
+	for _, c := range components {
+		id := serializeItem(c)
+		if seen[id] {
+			return "", fmt.Errorf("duplicate component %s", id)
+		}
+		seen[id] = true
+		v, err := componentValue(r, c)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(id)
+		sb.WriteString(": ")
+		sb.WriteString(v)
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(`"@signature-params": `)
+	sb.WriteString(serializeInnerList(components, params))
+	return sb.String(), nil
+}
+
+func componentValue(r *http.Request, c sfItem) (string, error) {
+	name, ok := c.val.(string)
+	if !ok || name != strings.ToLower(name) {
+		return "", fmt.Errorf("invalid component identifier %v", c.val)
+	}
+	for _, p := range c.params {
+		if p.key != "name" || name != "@query-param" {
+			return "", fmt.Errorf("unsupported component parameter %q on %s", p.key, name)
+		}
+	}
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@target-uri":
+		return requestScheme(r) + "://" + requestAuthority(r) + r.URL.RequestURI(), nil
+	case "@authority":
+		return requestAuthority(r), nil
+	case "@scheme":
+		return requestScheme(r), nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		if p := r.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "@query-param":
+		n, _ := c.param("name")
+		key, ok := n.(string)
+		if !ok {
+			return "", errors.New(`@query-param requires name parameter`)
+		}
+		vals, ok := r.URL.Query()[key]
+		if !ok || len(vals) != 1 {
+			return "", fmt.Errorf("query parameter %q must appear exactly once", key)
+		}
+		return url.QueryEscape(vals[0]), nil
+	}
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("unsupported derived component %s", name)
+	}
+	vals := r.Header.Values(name)
+	if name == "host" && len(vals) == 0 && requestAuthority(r) != "" {
+		vals = []string{requestAuthority(r)}
+	}
+	if len(vals) == 0 {
+		return "", fmt.Errorf("header %q not present", name)
+	}
+	trimmed := make([]string, len(vals)) // 不改写 r.Header 里的值
+	for i, v := range vals {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+func requestAuthority(r *http.Request) string {
+	if r.Host != "" {
+		return strings.ToLower(r.Host)
+	}
+	return strings.ToLower(r.URL.Host)
+}
+
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// ---- Content-Digest(RFC 9530) ----
+
+// ContentDigest 计算 body 的 Content-Digest 头值。alg 取 "sha-256" 或 "sha-512"(默认 sha-256)。
+func ContentDigest(alg string, body []byte) string {
+	var sum []byte
+	if alg == "sha-512" {
+		s := sha512.Sum512(body)
+		sum = s[:]
+	} else {
+		alg = "sha-256"
+		s := sha256.Sum256(body)
+		sum = s[:]
+	}
+	return alg + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// VerifyContentDigest 校验 Content-Digest 头与 body 一致:头里每个受支持算法(sha-256/sha-512)
+// 的摘要都必须匹配,且至少有一个受支持算法。
+func VerifyContentDigest(header string, body []byte) bool {
+	dict, order, err := parseDictionary(header)
+	if err != nil {
+		return false
+	}
+	checked := false
+	for _, alg := range order {
+		if alg != "sha-256" && alg != "sha-512" {
+			continue
+		}
+		got, ok := dict[alg].item.val.([]byte)
+		if !ok {
+			return false
+		}
+		want := ContentDigest(alg, body)
+		if !hmac.Equal([]byte(alg+"=:"+base64.StdEncoding.EncodeToString(got)+":"), []byte(want)) {
+			return false
+		}
+		checked = true
+	}
+	return checked
+}
+
+// ---- 算法 ----
+
+func keyAlg(k Key) (string, error) {
+	if k.Alg != "" {
+		return k.Alg, nil
+	}
+	switch key := k.Key.(type) {
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return AlgEd25519, nil
+	case *ecdsa.PublicKey:
+		return ecdsaAlg(key.Curve)
+	case *ecdsa.PrivateKey:
+		return ecdsaAlg(key.Curve)
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return AlgRSAPSSSHA512, nil
+	case []byte:
+		return AlgHMACSHA256, nil
+	}
+	return "", fmt.Errorf("signverify: unsupported key type %T", k.Key)
+}
+
+func ecdsaAlg(c elliptic.Curve) (string, error) {
+	switch c {
+	case elliptic.P256():
+		return AlgECDSAP256SHA256, nil
+	case elliptic.P384():
+		return AlgECDSAP384SHA384, nil
+	}
+	return "", fmt.Errorf("signverify: unsupported ecdsa curve %s", c.Params().Name)
+}
+
+func digestFor(alg string, msg []byte) (crypto.Hash, []byte) {
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg {
+	case AlgECDSAP384SHA384:
+		h, ch = sha512.New384(), crypto.SHA384
+	case AlgRSAPSSSHA512:
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		h, ch = sha256.New(), crypto.SHA256
+	}
+	h.Write(msg)
+	return ch, h.Sum(nil)
+}
+
+var errBadSignature = errors.New("signverify: bad signature")
+
+func verifyWith(alg string, key any, msg, sig []byte) error {
+	ok := false
+	switch alg {
+	case AlgEd25519:
+		pub, isKey := key.(ed25519.PublicKey)
+		ok = isKey && ed25519.Verify(pub, msg, sig)
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		pub, isKey := key.(*ecdsa.PublicKey)
+		if !isKey || len(sig)%2 != 0 {
+			return errBadSignature
+		}
+		_, h := digestFor(alg, msg)
+		n := len(sig) / 2
+		ok = ecdsa.Verify(pub, h, new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:]))
+	case AlgRSAPSSSHA512:
+		pub, isKey := key.(*rsa.PublicKey)
+		ch, h := digestFor(alg, msg)
+		ok = isKey && rsa.VerifyPSS(pub, ch, h, sig, &rsa.PSSOptions{SaltLength: 64}) == nil
+	case AlgRSAV15SHA256:
+		pub, isKey := key.(*rsa.PublicKey)
+		ch, h := digestFor(alg, msg)
+		ok = isKey && rsa.VerifyPKCS1v15(pub, ch, h, sig) == nil
+	case AlgHMACSHA256:
+		secret, isKey := key.([]byte)
+		if isKey {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(msg)
+			ok = hmac.Equal(mac.Sum(nil), sig)
+		}
+	default:
+		return fmt.Errorf("signverify: unsupported alg %q", alg)
+	}
+	if !ok {
+		return errBadSignature
+	}
+	return nil
+}
+
+func signWith(alg string, key any, msg []byte) ([]byte, error) {
+	switch alg {
+	case AlgEd25519:
+		if priv, ok := key.(ed25519.PrivateKey); ok {
+			return ed25519.Sign(priv, msg), nil
+		}
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		if priv, ok := key.(*ecdsa.PrivateKey); ok {
+			_, h := digestFor(alg, msg)
+			r, s, err := ecdsa.Sign(rand.Reader, priv, h)
+			if err != nil {
+				return nil, err
+			}
+			size := (priv.Curve.Params().BitSize + 7) / 8
+			out := make([]byte, 2*size)
+			r.FillBytes(out[:size])
+			s.FillBytes(out[size:])
+			return out, nil
+		}
+	case AlgRSAPSSSHA512:
+		if priv, ok := key.(*rsa.PrivateKey); ok {
+			ch, h := digestFor(alg, msg)
+			return rsa.SignPSS(rand.Reader, priv, ch, h, &rsa.PSSOptions{SaltLength: 64})
+		}
+	case AlgRSAV15SHA256:
+		if priv, ok := key.(*rsa.PrivateKey); ok {
+			ch, h := digestFor(alg, msg)
+			return rsa.SignPKCS1v15(rand.Reader, priv, ch, h)
+		}
+	case AlgHMACSHA256:
+		if secret, ok := key.([]byte); ok {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(msg)
+			return mac.Sum(nil), nil
+		}
+	default:
+		return nil, fmt.Errorf("signverify: unsupported alg %q", alg)
+	}
+	return nil, fmt.Errorf("signverify: key type %T does not match alg %q", key, alg)
+}
+
+// ---- 签名方 ----
+
+// Signer 按 RFC 9421 给出站请求签名,并为带 body 的请求补 Content-Digest。
+// 并发安全(只读配置)。用 NewSigner 构造。
+type Signer struct {
+	keyID      string
+	alg        string
+	key        any
+	label      string
+	components []string
+	digestAlg  string
+	expires    time.Duration
+	tag        string
+	nonce      func() string
+	includeAlg bool
+	now        func() time.Time
+}
+
+// SignerOption 配置 Signer。
+type SignerOption func(*Signer)
+
+// WithSignerComponents 覆盖要签名的组件(默认 DefaultCoveredComponents;带 body 时总会追加 content-digest)。
+func WithSignerComponents(components ...string) SignerOption {
+	return func(s *Signer) { s.components = components }
+}
+
+// WithSignerLabel 设置签名标签,默认 "sig1"。
+func WithSignerLabel(label string) SignerOption {
+	return func(s *Signer) { s.label = label }
+}
+
+// WithSignerAlg 显式指定算法(如 RSA 密钥用 rsa-v1_5-sha256);默认按密钥类型推断。
+func WithSignerAlg(alg string) SignerOption {
+	return func(s *Signer) { s.alg = alg }
+}
+
+// WithSignerDigest 设置 Content-Digest 算法:"sha-256"(默认)或 "sha-512"。
+func WithSignerDigest(alg string) SignerOption {
+	return func(s *Signer) { s.digestAlg = alg }
+}
+
+// WithSignerExpires 给签名加 expires=created+d 参数。
+func WithSignerExpires(d time.Duration) SignerOption {
+	return func(s *Signer) { s.expires = d }
+}
+
+// WithSignerTag 给签名加 tag 参数(应用自定义的签名用途标识)。
+func WithSignerTag(tag string) SignerOption {
+	return func(s *Signer) { s.tag = tag }
+}
+
+// WithSignerNonce 给签名加 nonce 参数(由 fn 生成),配合服务端防重放。
+func WithSignerNonce(fn func() string) SignerOption {
+	return func(s *Signer) { s.nonce = fn }
+}
+
+// WithSignerAlgParam 在签名参数里写出 alg(RFC 9421 建议由 keyid 隐含算法,默认不写)。
+func WithSignerAlgParam() SignerOption {
+	return func(s *Signer) { s.includeAlg = true }
+}
+
+// NewSigner 创建签名方。key 类型:ed25519.PrivateKey、*ecdsa.PrivateKey(P-256/P-384)、
+// *rsa.PrivateKey 或 []byte(HMAC)。
+func NewSigner(keyID string, key any, opts ...SignerOption) (*Signer, error) {
+	s := &Signer{keyID: keyID, key: key, label: "sig1", components: DefaultCoveredComponents, digestAlg: "sha-256", now: time.Now}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.alg == "" {
+		alg, err := keyAlg(Key{Key: key})
+		if err != nil {
+			return nil, err
+		}
+		s.alg = alg
+	}
+	if _, err := signWith(s.alg, key, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sign 给请求签名:带 body 时读出 body 计算 Content-Digest 并重置 r.Body(及 GetBody),
+// 然后写入 Signature-Input 与 Signature 头。
+func (s *Signer) Sign(r *http.Request) error {
+	components := s.components
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("signverify: read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		r.Header.Set("Content-Digest", ContentDigest(s.digestAlg, body))
+		if !containsFold(components, "content-digest") {
+			components = append(components[:len(components):len(components)], "content-digest")
+		}
+	}
+
+	items := make([]sfItem, 0, len(components))
+	for _, c := range components {
+		it, err := parseComponentID(c)
+		if err != nil {
+			return err
+		}
+		items = append(items, it)
+	}
+	created := s.now().Unix()
+	params := []sfParam{{key: "created", val: created}}
+	if s.expires > 0 {
+		params = append(params, sfParam{key: "expires", val: created + int64(s.expires.Seconds())})
+	}
+	if s.nonce != nil {
+		params = append(params, sfParam{key: "nonce", val: s.nonce()})
+	}
+	if s.includeAlg {
+		params = append(params, sfParam{key: "alg", val: s.alg})
+	}
+	params = append(params, sfParam{key: "keyid", val: s.keyID})
+	if s.tag != "" {
+		params = append(params, sfParam{key: "tag", val: s.tag})
+	}
+
+	base, err := signatureBase(r, items, params)
+	if err != nil {
+		return fmt.Errorf("signverify: %w", err)
+	}
+	sig, err := signWith(s.alg, s.key, []byte(base))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Signature-Input", s.label+"="+serializeInnerList(items, params))
+	r.Header.Set("Signature", s.label+"="+serializeBareItem(sig))
+	return nil
+}
+
+// parseComponentID 把 `@method`、`content-type`、`"@query-param";name="id"` 这类写法转成组件项。
+func parseComponentID(c string) (sfItem, error) {
+	if !strings.HasPrefix(c, `"`) {
+		c = `"` + strings.ToLower(c) + `"`
+	}
+	p := &sfParser{s: c}
+	it, err := p.parseItem()
+	if err != nil || p.pos != len(c) {
+		return sfItem{}, fmt.Errorf("signverify: invalid component %q", c)
+	}
+	return it, nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, x := range ss {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package signverify
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/middleware/auth"
+)
+
+// RFC 9421 附录 B.1.4 的 test-key-ed25519。
+const rfcEd25519Pub = `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAJrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=
+-----END PUBLIC KEY-----`
+
+func rfcKey(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	block, _ := pem.Decode([]byte(rfcEd25519Pub))
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.(ed25519.PublicKey)
+}
+
+func atTime(ts int64) Option {
+	return func(o *options) { o.now = func() time.Time { return time.Unix(ts, 0) } }
+}
+
+func serveSig(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// RFC 9421 附录 B.2.6:ed25519 签名的请求。
+func TestHTTPMessageSignaturesRFCVector(t *testing.T) {
+	pub := rfcKey(t)
+	keys := func(id string) (Key, bool) { return Key{Key: pub}, id == "test-key-ed25519" }
+	var gotKey string
+	h := HTTPMessageSignatures(keys, atTime(1618884473))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = KeyIDFromContext(r.Context())
+	}))
+
+	// 向量的签名未覆盖 content-digest:只有不带 body 的请求才能通过默认要求。
+	newReq := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/foo?param=Value&Pet=dog", nil)
+		r.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Length", "18")
+		r.Header.Set("Signature-Input", `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`)
+		r.Header.Set("Signature", "sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:")
+		return r
+	}
+
+	rec := serveSig(h, newReq())
+	if rec.Code != http.StatusOK || gotKey != "test-key-ed25519" {
+		t.Fatalf("RFC vector: status=%d key=%q", rec.Code, gotKey)
+	}
+	// 带 body 但签名未覆盖 content-digest:body 可被任意替换,拒绝。
+	r := newReq()
+	r.Body, r.ContentLength = io.NopCloser(strings.NewReader(`{"hello": "world"}`)), 18
+	r.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	if rec := serveSig(h, r); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("body without covered digest: status=%d", rec.Code)
+	}
+
+	// 篡改被覆盖的头 → 验签失败。
+	r = newReq()
+	r.Header.Set("Content-Type", "text/plain")
+	if rec := serveSig(h, r); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered header: status=%d", rec.Code)
+	}
+	// 过期。
+	late := HTTPMessageSignatures(keys, atTime(1618884473+3600))(http.HandlerFunc(ok200))
+	if rec := serveSig(late, newReq()); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expired: status=%d", rec.Code)
+	}
+	// 要求覆盖未签的组件。
+	strict := HTTPMessageSignatures(keys, atTime(1618884473), WithCoveredComponents("@query"))(http.HandlerFunc(ok200))
+	if rec := serveSig(strict, newReq()); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing component: status=%d", rec.Code)
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	hmacKey := []byte("shared-secret")
+	cases := []struct {
+		name string
+		priv any
+		pub  Key
+	}{
+		{"ed25519", edPriv, Key{Key: edPub}},
+		{"ecdsa-p256", p256, Key{Key: &p256.PublicKey}},
+		{"ecdsa-p384", p384, Key{Key: &p384.PublicKey}},
+		{"hmac", hmacKey, Key{Key: hmacKey}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			signer, err := NewSigner("k1", c.priv,
+				WithSignerComponents("@method", "@target-uri", "x-user-id", `"@query-param";name="id"`),
+				WithSignerExpires(time.Minute), WithSignerAlgParam())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var user string
+			h := HTTPMessageSignatures(func(id string) (Key, bool) { return c.pub, id == "k1" },
+				WithCoveredComponents("x-user-id"), WithExtractUser(),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if u, ok := auth.GetUserFromContext(r.Context()); ok {
+					user = u.ID()
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodPut, "http://api.example.com/orders?id=7", strings.NewReader(`{"qty":2}`))
+			r.Header.Set("X-User-Id", "u-9")
+			if err := signer.Sign(r); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(r.Header.Get("Signature-Input"), `"content-digest"`) {
+				t.Fatalf("content-digest not covered: %s", r.Header.Get("Signature-Input"))
+			}
+			if rec := serveSig(h, r); rec.Code != http.StatusOK || user != "u-9" {
+				t.Fatalf("status=%d user=%q input=%s", rec.Code, user, r.Header.Get("Signature-Input"))
+			}
+
+			// 换 query 参数 → @query-param 不符。
+			r2 := httptest.NewRequest(http.MethodPut, "http://api.example.com/orders?id=8", strings.NewReader(`{"qty":2}`))
+			r2.Header = r.Header.Clone()
+			if rec := serveSig(h, r2); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("tampered query: status=%d", rec.Code)
+			}
+			// 换 body → Content-Digest 不符。
+			r3 := httptest.NewRequest(http.MethodPut, "http://api.example.com/orders?id=7", strings.NewReader(`{"qty":9}`))
+			r3.Header = r.Header.Clone()
+			if rec := serveSig(h, r3); rec.Code != http.StatusBadRequest {
+				t.Fatalf("tampered body: status=%d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHTTPMessageSignaturesRejects(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := NewSigner("k1", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	reject := WithRejectHandler(func(w http.ResponseWriter, reason string) {
+		reasons = append(reasons, reason)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	h := HTTPMessageSignatures(func(id string) (Key, bool) { return Key{Key: otherPub}, id == "k1" }, reject)(http.HandlerFunc(ok200))
+
+	serveSig(h, httptest.NewRequest(http.MethodGet, "/x", nil)) // 无签名
+
+	r := httptest.NewRequest(http.MethodGet, "/x", nil)
+	_ = signer.Sign(r)
+	serveSig(h, r) // 公钥不匹配
+
+	r = httptest.NewRequest(http.MethodGet, "/x", nil)
+	_ = signer.Sign(r)
+	r.Header.Set("Signature-Input", strings.Replace(r.Header.Get("Signature-Input"), `"k1"`, `"k2"`, 1))
+	serveSig(h, r) // 未知 keyid
+
+	r = httptest.NewRequest(http.MethodGet, "/x", nil)
+	r.Header.Set("Signature-Input", `sig1=("@method"`)
+	r.Header.Set("Signature", `sig1=:AAAA:`)
+	serveSig(h, r) // 语法错误
+
+	// 签名只覆盖 @method:可被挪用到任意路径,默认要求拒绝。
+	r = httptest.NewRequest(http.MethodGet, "/x", nil)
+	narrow, _ := NewSigner("k1", priv, WithSignerComponents("@method"))
+	_ = narrow.Sign(r)
+	serveSig(h, r)
+
+	want := []string{"missing_signature", "signature_mismatch", "unknown_key", "invalid_signature_input", "missing_component"}
+	if strings.Join(reasons, ",") != strings.Join(want, ",") {
+		t.Fatalf("reasons=%v, want %v", reasons, want)
+	}
+}
+
+func TestParseDictionary(t *testing.T) {
+	d, order, err := parseDictionary(`sig1=("@method" "@query-param";name="id");created=1;keyid="a b", sig2=:AQID:, flag`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "sig1,sig2,flag" {
+		t.Fatalf("order=%v", order)
+	}
+	m := d["sig1"]
+	if got := serializeInnerList(m.inner, m.params); got != `("@method" "@query-param";name="id");created=1;keyid="a b"` {
+		t.Fatalf("roundtrip=%s", got)
+	}
+	if b, _ := d["sig2"].item.val.([]byte); len(b) != 3 || d["flag"].item.val != true {
+		t.Fatalf("members=%+v", d)
+	}
+}
+
+func TestHTTPMessageSignaturesBodyLimit(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := NewSigner("k1", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	h := HTTPMessageSignatures(func(id string) (Key, bool) { return Key{Key: pub}, id == "k1" },
+		WithMaxBodySize(8), WithRejectHandler(func(w http.ResponseWriter, reason string) {
+			reasons = append(reasons, reason)
+			defaultReject(w, reason)
+		}))(http.HandlerFunc(ok200))
+
+	r := httptest.NewRequest(http.MethodPost, "/x", strings.NewReader(`{"qty":2}`))
+	if err := signer.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveSig(h, r); rec.Code != http.StatusRequestEntityTooLarge { // 声明的 Content-Length 超限
+		t.Fatalf("too large: status=%d", rec.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/x", strings.NewReader(`{"qty":2}`))
+	_ = signer.Sign(r)
+	r.ContentLength = -1
+	serveSig(h, r) // 未声明长度,读取时超限
+
+	r = httptest.NewRequest(http.MethodPost, "/x", strings.NewReader(`{}`))
+	_ = signer.Sign(r)
+	if rec := serveSig(h, r); rec.Code != http.StatusOK {
+		t.Fatalf("small body: status=%d reasons=%v", rec.Code, reasons)
+	}
+	if strings.Join(reasons, ",") != "body_too_large,body_too_large" {
+		t.Fatalf("reasons=%v", reasons)
+	}
+}
+
+func TestComponentValueLeavesHeaderIntact(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/x", nil)
+	r.Header.Add("X-Tag", "  a ")
+	r.Header.Add("X-Tag", "b  ")
+	v, err := componentValue(r, sfItem{val: "x-tag"})
+	if err != nil || v != "a, b" {
+		t.Fatalf("value=%q err=%v", v, err)
+	}
+	if got := r.Header.Values("X-Tag"); got[0] != "  a " || got[1] != "b  " {
+		t.Fatalf("header rewritten: %q", got)
+	}
+}
@@ -0,0 +1,296 @@
+package signverify
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 本文件是 RFC 8941 Structured Field Values 的最小实现,只覆盖 RFC 9421 用到的部分:
+// Dictionary、Inner List、Item(String / Token / Integer / Decimal / Boolean / Byte Sequence)
+// 与 Parameters。序列化采用规范形式,签名方与验签方据此构造一致的 @signature-params。
+
+type sfToken string
+
+type sfParam struct {
+	key string
+	val any // string / sfToken / int64 / float64 / bool / []byte
+}
+
+type sfItem struct {
+	val    any
+	params []sfParam
+}
+
+// sfMember 是字典成员:要么是 Item,要么是 Inner List(inner != nil)。
+type sfMember struct {
+	item   sfItem
+	inner  []sfItem
+	isList bool
+	params []sfParam // Inner List 的参数
+}
+
+func (it sfItem) param(key string) (any, bool) { return findParam(it.params, key) }
+
+func findParam(ps []sfParam, key string) (any, bool) {
+	for _, p := range ps {
+		if p.key == key {
+			return p.val, true
+		}
+	}
+	return nil, false
+}
+
+type sfParser struct {
+	s   string
+	pos int
+}
+
+// parseDictionary 解析 SF Dictionary,返回成员及其出现顺序。
+func parseDictionary(s string) (map[string]sfMember, []string, error) {
+	p := &sfParser{s: s}
+	out := make(map[string]sfMember)
+	var order []string
+	p.skipOWS()
+	for p.pos < len(p.s) {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		var m sfMember
+		if p.peek() == '=' {
+			p.pos++
+			if m, err = p.parseMember(); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			ps, err := p.parseParams()
+			if err != nil {
+				return nil, nil, err
+			}
+			m = sfMember{item: sfItem{val: true, params: ps}}
+		}
+		if _, dup := out[key]; !dup {
+			order = append(order, key)
+		}
+		out[key] = m
+		p.skipOWS()
+		if p.pos >= len(p.s) {
+			break
+		}
+		if p.s[p.pos] != ',' {
+			return nil, nil, fmt.Errorf("sfv: expected ',' at %d", p.pos)
+		}
+		p.pos++
+		p.skipOWS()
+		if p.pos >= len(p.s) {
+			return nil, nil, fmt.Errorf("sfv: trailing comma")
+		}
+	}
+	return out, order, nil
+}
+
+func (p *sfParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *sfParser) skipOWS() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *sfParser) skipSP() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) parseMember() (sfMember, error) {
+	if p.peek() != '(' {
+		it, err := p.parseItem()
+		return sfMember{item: it}, err
+	}
+	p.pos++
+	var items []sfItem
+	for {
+		p.skipSP()
+		if p.peek() == ')' {
+			p.pos++
+			ps, err := p.parseParams()
+			return sfMember{inner: items, isList: true, params: ps}, err
+		}
+		it, err := p.parseItem()
+		if err != nil {
+			return sfMember{}, err
+		}
+		items = append(items, it)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return sfMember{}, fmt.Errorf("sfv: malformed inner list at %d", p.pos)
+		}
+	}
+}
+
+func (p *sfParser) parseItem() (sfItem, error) {
+	v, err := p.parseBareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	ps, err := p.parseParams()
+	return sfItem{val: v, params: ps}, err
+}
+
+func (p *sfParser) parseParams() ([]sfParam, error) {
+	var ps []sfParam
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var v any = true
+		if p.peek() == '=' {
+			p.pos++
+			if v, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		ps = append(ps, sfParam{key: key, val: v})
+	}
+	return ps, nil
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	start := p.pos
+	if c := p.peek(); !(c >= 'a' && c <= 'z' || c == '*') {
+		return "", fmt.Errorf("sfv: invalid key at %d", p.pos)
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == '*') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *sfParser) parseBareItem() (any, error) {
+	c := p.peek()
+	switch {
+	case c == '"':
+		return p.parseString()
+	case c == ':':
+		end := strings.IndexByte(p.s[p.pos+1:], ':')
+		if end < 0 {
+			return nil, fmt.Errorf("sfv: unterminated byte sequence at %d", p.pos)
+		}
+		b, err := base64.StdEncoding.DecodeString(p.s[p.pos+1 : p.pos+1+end])
+		if err != nil {
+			return nil, fmt.Errorf("sfv: invalid byte sequence: %w", err)
+		}
+		p.pos += end + 2
+		return b, nil
+	case c == '?':
+		if p.pos+1 < len(p.s) && (p.s[p.pos+1] == '0' || p.s[p.pos+1] == '1') {
+			p.pos += 2
+			return p.s[p.pos-1] == '1', nil
+		}
+		return nil, fmt.Errorf("sfv: invalid boolean at %d", p.pos)
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && (p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		num := p.s[start:p.pos]
+		if strings.Contains(num, ".") {
+			return strconv.ParseFloat(num, 64)
+		}
+		return strconv.ParseInt(num, 10, 64)
+	case c == '*' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte(" ,;()=\"", p.s[p.pos]) < 0 {
+			p.pos++
+		}
+		return sfToken(p.s[start:p.pos]), nil
+	}
+	return nil, fmt.Errorf("sfv: unexpected %q at %d", c, p.pos)
+}
+
+func (p *sfParser) parseString() (string, error) {
+	var sb strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.s) || p.s[p.pos] != '"' && p.s[p.pos] != '\\' {
+				return "", fmt.Errorf("sfv: invalid escape at %d", p.pos)
+			}
+			sb.WriteByte(p.s[p.pos])
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("sfv: unterminated string")
+}
+
+// ---- 序列化(规范形式) ----
+
+func serializeBareItem(v any) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x) // 签名相关字段只含可打印 ASCII,Quote 的转义与 SF 一致
+	case sfToken:
+		return string(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "?1"
+		}
+		return "?0"
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(x) + ":"
+	}
+	return fmt.Sprint(v)
+}
+
+func serializeParams(ps []sfParam) string {
+	var sb strings.Builder
+	for _, p := range ps {
+		sb.WriteByte(';')
+		sb.WriteString(p.key)
+		if b, ok := p.val.(bool); ok && b {
+			continue
+		}
+		sb.WriteByte('=')
+		sb.WriteString(serializeBareItem(p.val))
+	}
+	return sb.String()
+}
+
+func serializeItem(it sfItem) string {
+	return serializeBareItem(it.val) + serializeParams(it.params)
+}
+
+func serializeInnerList(items []sfItem, params []sfParam) string {
+	parts := make([]string, len(items))
+	for i, it := range items {
+		parts[i] = serializeItem(it)
+	}
+	return "(" + strings.Join(parts, " ") + ")" + serializeParams(params)
+}
@@ -1,4 +1,5 @@
-// Package signverify 提供基于 HMAC-SHA256 的 HTTP 请求签名校验中间件。
+// Package signverify 提供 HTTP 请求签名校验中间件:自定义的 HMAC-SHA256 方案(本文件),
+// 以及 RFC 9421 HTTP Message Signatures + RFC 9530 Content-Digest(见 HTTPMessageSignatures / Signer)。
 //
 // 签名公式（默认）：hex(HMAC-SHA256(secret, timestamp + userID + body))
 //
@@ -25,6 +26,14 @@
 //	))
 //
 // 也可直接使用底层 HTTPMiddleware 自由组合。
+//
+// 对接要求 RFC 9421 的合作方(非对称密钥,按 keyid 查公钥):
+//
+//	mux.Use(signverify.HTTPMessageSignatures(lookupKey,
+//	    signverify.WithCoveredComponents("@query"), // 默认已要求 @method @authority @path,带 body 时要求 content-digest
+//	))
+//
+// 出站请求签名见 pkg/client/http 的 WithSigner。
 package signverify
 
 import (
@@ -53,6 +62,9 @@ type SecretDeriver func(appID string, r *http.Request) (secret []byte, ok bool)
 // DefaultWindowSec 派生 key 的默认时间窗口（秒）。
 const DefaultWindowSec int64 = 300
 
+// DefaultMaxBodySize 是 HTTPMessageSignatures 校验 Content-Digest 时缓冲请求体的默认上限(10MiB)。
+const DefaultMaxBodySize int64 = 10 << 20
+
 type options struct {
 	appIDHeader     string
 	signHeader      string
@@ -64,6 +76,19 @@ type options struct {
 	deriver         SecretDeriver
 	deriveWindowSec int64 // >0 表示启用 DeriveKey 模式
 	onReject        func(w http.ResponseWriter, reason string)
+
+	// 以下仅用于 HTTPMessageSignatures(RFC 9421)
+	requiredComponents []string
+	label              string
+	maxBodySize        int64
+	now                func() time.Time // 测试注入,nil 用 time.Now
+}
+
+func (o *options) clock() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
 }
 
 func defaults() *options {
@@ -73,6 +98,7 @@ func defaults() *options {
 		timestampHeader: "X-Timestamp",
 		userIDHeader:    "X-User-Id",
 		maxAge:          5 * time.Minute,
+		maxBodySize:     DefaultMaxBodySize,
 		onReject:        defaultReject,
 	}
 }
@@ -143,7 +169,10 @@ func WithDerivedKey(windowSec int64) Option {
 }
 
 // WithRejectHandler 自定义拒绝响应。reason 可能为：
-// "missing_headers"、"invalid_timestamp"、"timestamp_expired"、"unknown_app"、"signature_mismatch"。
+// "missing_headers"、"invalid_timestamp"、"timestamp_expired"、"unknown_app"、"signature_mismatch"；
+// HTTPMessageSignatures 另有 "missing_signature"、"invalid_signature_input"、"unknown_key"、
+// "missing_component"、"body_too_large"、"content_digest_mismatch"。
+// 默认响应均为 401,其中 "content_digest_mismatch" 为 400、"body_too_large" 为 413。
 func WithRejectHandler(fn func(w http.ResponseWriter, reason string)) Option {
 	return func(o *options) { o.onReject = fn }
 }
@@ -290,6 +319,18 @@ func defaultReject(w http.ResponseWriter, reason string) {
 		http.Error(w, "timestamp expired", http.StatusUnauthorized)
 	case "unknown_app":
 		http.Error(w, "unknown app_id", http.StatusUnauthorized)
+	case "missing_signature":
+		http.Error(w, "missing signature", http.StatusUnauthorized)
+	case "invalid_signature_input":
+		http.Error(w, "invalid signature input", http.StatusUnauthorized)
+	case "unknown_key":
+		http.Error(w, "unknown keyid", http.StatusUnauthorized)
+	case "missing_component":
+		http.Error(w, "required component not signed", http.StatusUnauthorized)
+	case "content_digest_mismatch":
+		http.Error(w, "content digest mismatch", http.StatusBadRequest)
+	case "body_too_large":
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
 	default:
 		http.Error(w, "signature mismatch", http.StatusUnauthorized)
 	}
@@ -0,0 +1,245 @@
+package tenantquota
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Kind 是被超限的配额种类,对应 QuotaViolation.Subject 的末段与 Usage.Rejected 的键。
+type Kind string
+
+const (
+	KindDisabled    Kind = "disabled"
+	KindBodySize    Kind = "body_size"
+	KindRate        Kind = "rate"
+	KindConcurrency Kind = "concurrency"
+	KindDaily       Kind = "daily_requests"
+	KindMonthly     Kind = "monthly_requests"
+)
+
+var kinds = [...]Kind{KindDisabled, KindBodySize, KindRate, KindConcurrency, KindDaily, KindMonthly}
+
+// ErrorDomain 是拒绝时 ErrorInfo.Domain 的取值。
+const ErrorDomain = "tenantquota"
+
+// OtherTenant 是未单独配置的租户在 OTel 指标 tenant 属性上的取值:租户 ID 来自客户端,
+// 按原值打标签会让任何调用方制造无限多的指标序列。
+const OtherTenant = "other"
+
+// evicted 是被淘汰条目的 inflight 取值。淘汰以 CAS(0 → evicted)抢占,之后的 Add(1) 得到负数,
+// 请求据此改用新条目,不会在已脱离用量表的条目上计并发。
+const evicted = math.MinInt64 / 2
+
+// usage 是单个租户的计量,全部为原子计数。
+type usage struct {
+	requests atomic.Int64
+	inflight atomic.Int64
+	rejected [len(kinds)]atomic.Int64
+}
+
+// Usage 是某租户的用量快照。
+type Usage struct {
+	Requests int64          // 放行的请求数(进程启动以来)
+	Rejected map[Kind]int64 // 按种类的拒绝数(进程启动以来)
+	InFlight int64          // 当前在途请求数
+	Daily    int64          // DayWindow 内计入配额的请求数(WithStore 时为共享计数)
+	Monthly  int64          // MonthWindow 内计入配额的请求数
+}
+
+func (r *Registry) usageOf(tenant string) *usage {
+	if u, ok := r.usage.Load(tenant); ok {
+		return u.(*usage)
+	}
+	if r.tracked.Load() >= r.maxTracked {
+		r.evictIdle()
+	}
+	u, loaded := r.usage.LoadOrStore(tenant, &usage{})
+	if !loaded {
+		r.tracked.Add(1)
+	}
+	return u.(*usage)
+}
+
+// evictIdle 删除未配置且没有在途请求的租户的用量。已在淘汰时直接返回,不阻塞请求。
+func (r *Registry) evictIdle() {
+	if !r.evicting.TryLock() {
+		return
+	}
+	defer r.evicting.Unlock()
+	configured := r.snap.Load().policies
+	r.usage.Range(func(k, v any) bool {
+		if _, ok := configured[k.(string)]; !ok && v.(*usage).inflight.CompareAndSwap(0, evicted) {
+			r.usage.CompareAndDelete(k, v)
+			r.tracked.Add(-1)
+		}
+		return true
+	})
+}
+
+// Usage 返回租户 id 的用量。只读,不会为未出现过的租户建立条目。
+func (r *Registry) Usage(id string) Usage {
+	u := &usage{}
+	if v, ok := r.usage.Load(id); ok {
+		u = v.(*usage)
+	}
+	out := Usage{
+		Requests: u.requests.Load(),
+		Rejected: make(map[Kind]int64),
+		InFlight: max(u.inflight.Load(), 0),
+		Daily:    r.daily.Count(id),
+		Monthly:  r.month.Count(id),
+	}
+	for i, k := range kinds {
+		if n := u.rejected[i].Load(); n > 0 {
+			out.Rejected[k] = n
+		}
+	}
+	return out
+}
+
+// Snapshot 返回用量表中全部租户的用量(未配置的空闲租户可能已被淘汰,见 WithMaxTrackedTenants)。
+func (r *Registry) Snapshot() map[string]Usage {
+	out := make(map[string]Usage)
+	r.usage.Range(func(k, _ any) bool {
+		out[k.(string)] = r.Usage(k.(string))
+		return true
+	})
+	return out
+}
+
+// Acquire 按租户 id 的策略准入一次请求,size 为已知的请求体字节数(未知传 -1)。
+// 放行时返回注入了 Policy 的 ctx 与必须调用一次的 release(释放并发名额);
+// 拒绝时返回 *errors.Status。HTTP / gRPC 中间件之外的入口(如 mq 消费)可直接调用。
+// 检查顺序:停用 → 请求体 → 速率 → 并发 → 日 / 月配额,先失败的不消耗后面的额度。
+func (r *Registry) Acquire(ctx context.Context, id string, size int64) (context.Context, func(), error) {
+	if id == "" {
+		if r.requireTenant {
+			return ctx, nil, perr.Forbidden("missing tenant ID")
+		}
+		return ctx, func() {}, nil
+	}
+	s := r.snap.Load()
+	p := s.policy(id)
+	u := r.usageOf(id)
+	reject := func(kind Kind, st *perr.Status) (context.Context, func(), error) {
+		return ctx, nil, r.reject(ctx, p, kind, st)
+	}
+	plan := p.Plan
+	if p.Disabled {
+		return reject(KindDisabled, perr.Forbidden("tenant disabled"))
+	}
+	if plan.MaxBodyBytes > 0 && size > plan.MaxBodyBytes {
+		return reject(KindBodySize, perr.PayloadTooLarge(fmt.Sprintf("request body exceeds %d bytes", plan.MaxBodyBytes)))
+	}
+	if l := s.limiters[p.PlanName]; l != nil {
+		if ok, wait := l.gcra.Allow(id); !ok {
+			return reject(KindRate, perr.TooManyRequests("tenant rate limit exceeded").WithDetail(&perr.RetryInfo{RetryDelay: wait}))
+		}
+	}
+	n := u.inflight.Add(1)
+	for n < 0 { // 条目刚被淘汰,改用新条目
+		u = r.usageOf(id)
+		n = u.inflight.Add(1)
+	}
+	if plan.MaxConcurrency > 0 && n > plan.MaxConcurrency {
+		u.inflight.Add(-1)
+		return reject(KindConcurrency, perr.TooManyRequests(fmt.Sprintf("tenant concurrency limit %d reached", plan.MaxConcurrency)))
+	}
+	if plan.MonthlyRequests > 0 && !r.month.Allow(id, 1, plan.MonthlyRequests) {
+		u.inflight.Add(-1)
+		return reject(KindMonthly, perr.TooManyRequests("tenant monthly request quota exhausted"))
+	}
+	if plan.DailyRequests > 0 && !r.daily.Allow(id, 1, plan.DailyRequests) {
+		if plan.MonthlyRequests > 0 {
+			r.month.Add(id, -1)
+		}
+		u.inflight.Add(-1)
+		return reject(KindDaily, perr.TooManyRequests("tenant daily request quota exhausted"))
+	}
+	// 无配额限制的计数也要记,供 Usage 展示
+	if plan.MonthlyRequests <= 0 {
+		r.month.Add(id, 1)
+	}
+	if plan.DailyRequests <= 0 {
+		r.daily.Add(id, 1)
+	}
+	u.requests.Add(1)
+	r.m.request(ctx, s.metricTenant(id), p.PlanName)
+	var released atomic.Bool
+	release := func() {
+		if released.CompareAndSwap(false, true) {
+			u.inflight.Add(-1)
+		}
+	}
+	return ctxkey.With(ctx, policyKey, p), release, nil
+}
+
+// reject 计入拒绝用量并给 st 附上 QuotaViolation 与 ErrorInfo。
+func (r *Registry) reject(ctx context.Context, p *Policy, kind Kind, st *perr.Status) *perr.Status {
+	r.usageOf(p.Tenant).rejected[kindIndex(kind)].Add(1)
+	r.m.reject(ctx, r.snap.Load().metricTenant(p.Tenant), kind)
+	return st.
+		WithDetail(&perr.QuotaViolation{Subject: "tenant/" + p.Tenant + "/" + string(kind), Description: st.Message()}).
+		WithDetail(&perr.ErrorInfo{Reason: "TENANT_" + strings.ToUpper(string(kind)), Domain: ErrorDomain, Metadata: map[string]string{"tenant": p.Tenant, "plan": p.PlanName}})
+}
+
+// metricTenant 返回租户在指标上的标签值:已配置的租户用其 ID,其余归为 OtherTenant。
+func (s *snapshot) metricTenant(id string) string {
+	if _, ok := s.policies[id]; ok {
+		return id
+	}
+	return OtherTenant
+}
+
+func kindIndex(k Kind) int {
+	for i, kk := range kinds {
+		if kk == k {
+			return i
+		}
+	}
+	return 0
+}
+
+// retryAfter 取拒绝错误中的 RetryInfo,供 HTTP 写 Retry-After。
+func retryAfter(st *perr.Status) time.Duration {
+	for _, d := range st.Details() {
+		if ri, ok := d.(*perr.RetryInfo); ok {
+			return ri.RetryDelay
+		}
+	}
+	return 0
+}
+
+type metrics struct {
+	requests   metric.Int64Counter
+	rejections metric.Int64Counter
+}
+
+func newMetrics() *metrics {
+	m := otel.Meter("github.com/rushteam/beauty/pkg/middleware/tenantquota")
+	requests, _ := m.Int64Counter("tenant.requests", metric.WithDescription("按租户放行的请求数"))
+	rejections, _ := m.Int64Counter("tenant.rejections", metric.WithDescription("按租户/配额种类拒绝的请求数"))
+	return &metrics{requests: requests, rejections: rejections}
+}
+
+func (m *metrics) request(ctx context.Context, tenant, plan string) {
+	if m.requests != nil {
+		m.requests.Add(ctx, 1, metric.WithAttributes(attribute.String("tenant", tenant), attribute.String("plan", plan)))
+	}
+}
+
+func (m *metrics) reject(ctx context.Context, tenant string, kind Kind) {
+	if m.rejections != nil {
+		m.rejections.Add(ctx, 1, metric.WithAttributes(attribute.String("tenant", tenant), attribute.String("kind", string(kind))))
+	}
+}
@@ -0,0 +1,68 @@
+package tenantquota
+
+import (
+	"context"
+	"fmt"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/middleware/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryServerInterceptor 返回按租户策略准入调用的 gRPC unary 拦截器,需排在 tenant.UnaryServerInterceptor 之后。
+// MaxBodyBytes 按请求消息的编码长度判断。
+func UnaryServerInterceptor(reg *Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, release, err := reg.Acquire(ctx, tenant.FromContext(ctx), messageSize(req))
+		if err != nil {
+			return nil, perr.ToGRPCContext(ctx, err.(*perr.Status))
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 返回 stream 版本:整条流占一个并发名额、计一次请求配额,
+// MaxBodyBytes 作用于流中的每条客户端消息。
+func StreamServerInterceptor(reg *Registry) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, release, err := reg.Acquire(ss.Context(), tenant.FromContext(ss.Context()), -1)
+		if err != nil {
+			return perr.ToGRPCContext(ss.Context(), err.(*perr.Status))
+		}
+		defer release()
+		return handler(srv, &policyStream{ServerStream: ss, ctx: ctx, reg: reg, policy: PolicyFromContext(ctx)})
+	}
+}
+
+type policyStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	reg    *Registry
+	policy *Policy
+}
+
+func (s *policyStream) Context() context.Context { return s.ctx }
+
+func (s *policyStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.policy == nil || s.policy.Plan.MaxBodyBytes <= 0 {
+		return nil
+	}
+	if n := messageSize(m); n > s.policy.Plan.MaxBodyBytes {
+		st := perr.PayloadTooLarge(fmt.Sprintf("request body exceeds %d bytes", s.policy.Plan.MaxBodyBytes))
+		return perr.ToGRPCContext(s.ctx, s.reg.reject(s.ctx, s.policy, KindBodySize, st))
+	}
+	return nil
+}
+
+// messageSize 返回 proto 消息的编码长度,非 proto 消息返回 -1(不检查)。
+func messageSize(m any) int64 {
+	if pm, ok := m.(proto.Message); ok {
+		return int64(proto.Size(pm))
+	}
+	return -1
+}
@@ -0,0 +1,33 @@
+package tenantquota
+
+import (
+	"net/http"
+	"strconv"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/middleware/tenant"
+)
+
+// HTTPMiddleware 返回按租户策略准入请求的 HTTP 中间件,需挂在 tenant.HTTPMiddleware 之后。
+// 声明了 Content-Length 的超限请求直接 413;未声明的按 MaxBodyBytes 包一层 http.MaxBytesReader,
+// 读取越界时由 handler 处理读错误。限流拒绝附 Retry-After 头(秒级)。
+func HTTPMiddleware(reg *Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, release, err := reg.Acquire(r.Context(), tenant.FromContext(r.Context()), r.ContentLength)
+			if err != nil {
+				st := err.(*perr.Status)
+				if d := retryAfter(st); d > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+				}
+				perr.WriteHTTPContext(perr.WithRequestLocales(r), w, st)
+				return
+			}
+			defer release()
+			if p := PolicyFromContext(ctx); p != nil && p.Plan.MaxBodyBytes > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, p.Plan.MaxBodyBytes)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
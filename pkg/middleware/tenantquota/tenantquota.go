@@ -0,0 +1,338 @@
+// Package tenantquota 提供按租户套餐(plan)统一执行的配额与隔离中间件。
+//
+// tenant 中间件只负责识别租户;本包在其之后按租户所属套餐执行:
+//   - 速率限制(Rate / Burst,GCRA,每租户独立);
+//   - 并发上限(MaxConcurrency,同一租户同时在途的请求数);
+//   - 请求体上限(MaxBodyBytes,HTTP 请求体 / gRPC 单条请求消息);
+//   - 日 / 月请求配额(DailyRequests / MonthlyRequests,resilience/counter 滑动窗口,
+//     WithStore 后多实例共享,改为固定窗口);
+//   - 功能开关(Features,业务用 HasFeature 查询)。
+//
+// 超限时返回 api/errors 的 413 / 429,附 QuotaViolation(Subject 为 "tenant/<id>/<kind>")、
+// ErrorInfo(Reason 为 "TENANT_" 加大写的 Kind,如 TENANT_RATE、TENANT_DAILY_REQUESTS)与限流时的 RetryInfo。
+// 同一 Registry 可同时挂在 HTTP(HTTPMiddleware)与 gRPC(*ServerInterceptor)上,配额合并计算。
+// 每租户用量经 Usage / Snapshot 读取,并以 OpenTelemetry 指标 tenant.requests / tenant.rejections 导出;
+// 未配置的租户 ID 来自客户端,计量表超过 WithMaxTrackedTenants 时淘汰其中没有在途请求的条目,
+// 指标的 tenant 属性也统一记为 OtherTenant。
+//
+//	reg := tenantquota.New()
+//	_ = reg.WatchConfig(ctx, loader) // 配置键见 Document;也可 LoadKV 从 kvstore 读取
+//	defer reg.Stop()
+//	handler := tenant.HTTPMiddleware()(tenantquota.HTTPMiddleware(reg)(mux))
+//
+//	# tenantquota.yaml
+//	default_plan: free
+//	plans:
+//	  free: {rate: 5, burst: 10, max_concurrency: 4, max_body_bytes: 1048576, daily_requests: 10000}
+//	  pro:  {rate: 100, burst: 200, max_concurrency: 64, monthly_requests: 10000000, features: [export]}
+//	tenants:
+//	  t-acme: {plan: pro, features: [beta-ui]}
+//	  t-spam: {disabled: true}
+package tenantquota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/conf"
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/resilience/counter"
+	"github.com/rushteam/beauty/pkg/resilience/ratelimit"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// 日 / 月配额的统计窗口。
+const (
+	DayWindow   = 24 * time.Hour
+	MonthWindow = 30 * DayWindow
+)
+
+// Plan 是一档套餐的限制,各项为 0 表示不限。
+type Plan struct {
+	Rate            float64  `json:"rate"`             // 每秒稳定速率
+	Burst           int      `json:"burst"`            // 可突发数,为 0 时取 max(1, Rate)
+	MaxConcurrency  int64    `json:"max_concurrency"`  // 同时在途请求数
+	MaxBodyBytes    int64    `json:"max_body_bytes"`   // 请求体 / 单条请求消息字节数
+	DailyRequests   int64    `json:"daily_requests"`   // DayWindow 内请求数
+	MonthlyRequests int64    `json:"monthly_requests"` // MonthWindow 内请求数
+	Features        []string `json:"features"`         // 套餐内置的功能开关
+}
+
+func (p Plan) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return max(1, int(p.Rate))
+}
+
+func (p Plan) validate() error {
+	if p.Rate < 0 || p.Burst < 0 || p.MaxConcurrency < 0 || p.MaxBodyBytes < 0 || p.DailyRequests < 0 || p.MonthlyRequests < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// Tenant 是单个租户的配置。
+type Tenant struct {
+	Plan     string   `json:"plan"`     // 所属套餐,空表示 Document.DefaultPlan
+	Features []string `json:"features"` // 在套餐之外额外开启的功能
+	Disabled bool     `json:"disabled"` // 停用:所有请求被拒绝
+}
+
+// Document 是配置里的租户策略:
+//
+//	default_plan: <未单独配置的租户所用套餐,空表示不限>
+//	plans:   {<套餐名>: Plan}
+//	tenants: {<租户 ID>: Tenant}
+type Document struct {
+	DefaultPlan string            `json:"default_plan"`
+	Plans       map[string]Plan   `json:"plans"`
+	Tenants     map[string]Tenant `json:"tenants"`
+}
+
+// Validate 校验套餐限制非负、所引用的套餐都已定义。
+func (d Document) Validate() error {
+	for name, p := range d.Plans {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("tenantquota: plan %q: %w", name, err)
+		}
+	}
+	if _, ok := d.Plans[d.DefaultPlan]; d.DefaultPlan != "" && !ok {
+		return fmt.Errorf("tenantquota: default plan %q not defined", d.DefaultPlan)
+	}
+	for id, t := range d.Tenants {
+		if _, ok := d.Plans[t.Plan]; t.Plan != "" && !ok {
+			return fmt.Errorf("tenantquota: tenant %q: plan %q not defined", id, t.Plan)
+		}
+	}
+	return nil
+}
+
+// Policy 是某租户解析后的生效策略,经 PolicyFromContext 在下游读取。
+type Policy struct {
+	Tenant   string
+	PlanName string // 未匹配任何套餐时为空
+	Plan     Plan
+	Disabled bool
+	features map[string]bool
+}
+
+// HasFeature 报告策略是否开启了功能 flag(套餐内置或租户额外开启)。
+func (p *Policy) HasFeature(flag string) bool { return p != nil && p.features[flag] }
+
+var policyKey = ctxkey.New[*Policy]()
+
+// PolicyFromContext 返回中间件为当前请求解析的策略;未经过中间件时返回 nil。
+func PolicyFromContext(ctx context.Context) *Policy {
+	p, _ := ctxkey.Get(ctx, policyKey)
+	return p
+}
+
+// HasFeature 报告当前请求的租户是否开启了功能 flag。
+func HasFeature(ctx context.Context, flag string) bool {
+	return PolicyFromContext(ctx).HasFeature(flag)
+}
+
+// Option 配置 Registry。
+type Option func(*Registry)
+
+// WithDocument 设置初始策略;非法时记录告警并保持不限。
+func WithDocument(doc Document) Option { return func(r *Registry) { r.initial = &doc } }
+
+// WithStore 让日 / 月配额计数走共享存储(如 Redis),多实例合并计数。
+func WithStore(s kvstore.Store) Option { return func(r *Registry) { r.store = s } }
+
+// DefaultMaxTrackedTenants 是 WithMaxTrackedTenants 的默认值。
+const DefaultMaxTrackedTenants = 10000
+
+// WithMaxTrackedTenants 设置用量表的条目上限(默认 DefaultMaxTrackedTenants)。超过时淘汰未配置且
+// 没有在途请求的租户的用量,防止客户端随意填写的租户 ID 把内存撑大;已配置的租户始终保留。
+func WithMaxTrackedTenants(n int) Option {
+	return func(r *Registry) {
+		if n > 0 {
+			r.maxTracked = int64(n)
+		}
+	}
+}
+
+// WithRequireTenant 设置缺少租户 ID 的请求是否被拒绝(403),默认 false:直接放行、不计量。
+func WithRequireTenant(require bool) Option { return func(r *Registry) { r.requireTenant = require } }
+
+// limiter 是某套餐的速率限制器,套餐的 Rate / Burst 不变时跨配置更新复用。
+type limiter struct {
+	rate  float64
+	burst int
+	gcra  *ratelimit.GCRA
+}
+
+// snapshot 是一次配置生效后的不可变视图。
+type snapshot struct {
+	doc      Document
+	policies map[string]*Policy // 已配置的租户;其余租户按默认套餐即时生成
+	limiters map[string]*limiter
+}
+
+// Registry 持有租户策略并执行配额。零值不可用,用 New 构造;并发安全。
+type Registry struct {
+	initial       *Document
+	store         kvstore.Store
+	requireTenant bool
+
+	mu    sync.Mutex // 串行化 SetDocument
+	snap  atomic.Pointer[snapshot]
+	daily *counter.Counter
+	month *counter.Counter
+	usage sync.Map // tenant → *usage
+	m     *metrics
+
+	maxTracked int64        // usage 条目上限,超过时淘汰空闲的未配置租户
+	tracked    atomic.Int64 // usage 当前条目数
+	evicting   sync.Mutex   // 同一时刻只有一个 goroutine 做淘汰
+}
+
+// New 创建 Registry。未设置策略前所有请求都放行(仍计量用量)。
+func New(opts ...Option) *Registry {
+	r := &Registry{maxTracked: DefaultMaxTrackedTenants}
+	for _, o := range opts {
+		o(r)
+	}
+	var copts []counter.Option
+	if r.store != nil {
+		copts = append(copts, counter.WithStore(r.store), counter.WithOnStoreError(func(op, key string, err error) {
+			slog.Warn("tenantquota: quota store error, allowing request", "op", op, "key", key, "err", err)
+		}))
+	}
+	r.daily = counter.New(DayWindow, append([]counter.Option{counter.WithBuckets(24)}, copts...)...)
+	r.month = counter.New(MonthWindow, append([]counter.Option{counter.WithBuckets(30)}, copts...)...)
+	r.m = newMetrics()
+	r.snap.Store(&snapshot{})
+	if r.initial != nil {
+		if err := r.SetDocument(*r.initial); err != nil {
+			slog.Warn("tenantquota: ignored invalid initial document", "err", err)
+		}
+	}
+	return r
+}
+
+// SetDocument 校验并整体替换策略。Rate / Burst 未变的套餐保留限流状态,其余重建。
+func (r *Registry) SetDocument(doc Document) error {
+	if err := doc.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.snap.Load()
+	next := &snapshot{
+		doc:      doc,
+		policies: make(map[string]*Policy, len(doc.Tenants)),
+		limiters: make(map[string]*limiter, len(doc.Plans)),
+	}
+	for name, p := range doc.Plans {
+		if l := old.limiters[name]; l != nil && l.rate == p.Rate && l.burst == p.burst() {
+			next.limiters[name] = l
+			continue
+		}
+		next.limiters[name] = &limiter{rate: p.Rate, burst: p.burst(), gcra: ratelimit.NewGCRA(p.Rate, p.burst())}
+	}
+	for id, t := range doc.Tenants {
+		next.policies[id] = newPolicy(doc, id, t)
+	}
+	r.snap.Store(next)
+	for name, l := range old.limiters {
+		if next.limiters[name] != l {
+			l.gcra.Stop()
+		}
+	}
+	return nil
+}
+
+func newPolicy(doc Document, id string, t Tenant) *Policy {
+	name := t.Plan
+	if name == "" {
+		name = doc.DefaultPlan
+	}
+	p := &Policy{Tenant: id, PlanName: name, Plan: doc.Plans[name], Disabled: t.Disabled, features: make(map[string]bool)}
+	for _, f := range slices.Concat(p.Plan.Features, t.Features) {
+		p.features[f] = true
+	}
+	return p
+}
+
+// Document 返回当前生效的策略。
+func (r *Registry) Document() Document { return r.snap.Load().doc }
+
+// Policy 返回租户 id 的生效策略:已配置的租户按其配置,其余落到默认套餐。
+func (r *Registry) Policy(id string) *Policy { return r.snap.Load().policy(id) }
+
+func (s *snapshot) policy(id string) *Policy {
+	if p := s.policies[id]; p != nil {
+		return p
+	}
+	return newPolicy(s.doc, id, Tenant{})
+}
+
+// LoadConfig 从配置加载器读取 Document 并整体替换策略。
+func (r *Registry) LoadConfig(l conf.Loader) error {
+	var raw map[string]any
+	if err := l.Unmarshal(&raw); err != nil {
+		return fmt.Errorf("tenantquota: unmarshal config: %w", err)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("tenantquota: unmarshal config: %w", err)
+	}
+	return r.setJSON(b)
+}
+
+// WatchConfig 先同步加载一次,再在配置变更时热加载。变更后的配置非法时记录告警并
+// 保留上一份有效策略。
+func (r *Registry) WatchConfig(ctx context.Context, l conf.Loader) error {
+	if err := r.LoadConfig(l); err != nil {
+		return err
+	}
+	l.Watch(ctx, func() {
+		if err := r.LoadConfig(l); err != nil {
+			slog.Warn("tenantquota: ignored invalid config update, keeping last-good", "err", err)
+		}
+	})
+	return nil
+}
+
+// LoadKV 从 kvstore 的 key 读取 JSON 编码的 Document 并整体替换策略(便于运营后台写入、多实例共享)。
+// key 不存在时返回错误,保留当前策略。
+func (r *Registry) LoadKV(ctx context.Context, s kvstore.Store, key string) error {
+	b, ok, err := s.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("tenantquota: load %q: %w", key, err)
+	}
+	if !ok {
+		return fmt.Errorf("tenantquota: load %q: not found", key)
+	}
+	return r.setJSON(b)
+}
+
+func (r *Registry) setJSON(b []byte) error {
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("tenantquota: decode document: %w", err)
+	}
+	return r.SetDocument(doc)
+}
+
+// Stop 停止内部限流器与计数器的后台清理。
+func (r *Registry) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.snap.Load().limiters {
+		l.gcra.Stop()
+	}
+	r.daily.Stop()
+	r.month.Stop()
+}
@@ -0,0 +1,369 @@
+package tenantquota
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/middleware/tenant"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var testDoc = Document{
+	DefaultPlan: "free",
+	Plans: map[string]Plan{
+		"free": {Rate: 1000, Burst: 1000, MaxConcurrency: 1, MaxBodyBytes: 8, DailyRequests: 3},
+		"pro":  {MonthlyRequests: 2, Features: []string{"export"}},
+	},
+	Tenants: map[string]Tenant{
+		"t-pro":  {Plan: "pro", Features: []string{"beta"}},
+		"t-gone": {Disabled: true},
+	},
+}
+
+func kindOf(err error) Kind {
+	st, _ := perr.FromError(err)
+	for _, d := range st.Details() {
+		if q, ok := d.(*perr.QuotaViolation); ok {
+			return Kind(q.Subject[strings.LastIndex(q.Subject, "/")+1:])
+		}
+	}
+	return ""
+}
+
+func reasonOf(st *perr.Status) string {
+	for _, d := range st.Details() {
+		if ei, ok := d.(*perr.ErrorInfo); ok {
+			return ei.Reason
+		}
+	}
+	return ""
+}
+
+func TestAcquire(t *testing.T) {
+	reg := New(WithDocument(testDoc))
+	defer reg.Stop()
+	ctx := context.Background()
+
+	// 并发上限 1:第二个在途请求被拒,释放后恢复
+	_, release, err := reg.Acquire(ctx, "t1", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reg.Acquire(ctx, "t1", 4); kindOf(err) != KindConcurrency {
+		t.Fatalf("want concurrency rejection, got %v", err)
+	}
+	release()
+	release() // 幂等
+
+	if _, _, err := reg.Acquire(ctx, "t1", 9); kindOf(err) != KindBodySize {
+		t.Fatalf("want body rejection, got %v", err)
+	}
+	// 日配额 3:上面放行 1 次,被拒的请求不计配额
+	for range 2 {
+		_, release, err := reg.Acquire(ctx, "t1", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	_, _, err = reg.Acquire(ctx, "t1", -1)
+	if kindOf(err) != KindDaily {
+		t.Fatalf("want daily rejection, got %v", err)
+	}
+	if st, _ := perr.FromError(err); st.Code() != perr.CodeTooManyRequests || reasonOf(st) != "TENANT_DAILY_REQUESTS" {
+		t.Fatalf("code = %v, reason = %q", st.Code(), reasonOf(st))
+	}
+
+	u := reg.Usage("t1")
+	if u.Requests != 3 || u.Daily != 3 || u.InFlight != 0 {
+		t.Fatalf("usage = %+v", u)
+	}
+	if u.Rejected[KindConcurrency] != 1 || u.Rejected[KindBodySize] != 1 || u.Rejected[KindDaily] != 1 {
+		t.Fatalf("rejected = %v", u.Rejected)
+	}
+
+	// 套餐功能 + 租户额外功能;月配额 2
+	for range 2 {
+		ctx, release, err := reg.Acquire(ctx, "t-pro", 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !HasFeature(ctx, "export") || !HasFeature(ctx, "beta") || HasFeature(ctx, "admin") {
+			t.Fatalf("features of %+v", PolicyFromContext(ctx))
+		}
+		release()
+	}
+	if _, _, err := reg.Acquire(ctx, "t-pro", -1); kindOf(err) != KindMonthly {
+		t.Fatalf("want monthly rejection, got %v", err)
+	}
+	if _, _, err := reg.Acquire(ctx, "t-gone", -1); kindOf(err) != KindDisabled {
+		t.Fatalf("want disabled rejection, got %v", err)
+	}
+	if len(reg.Snapshot()) != 3 {
+		t.Fatalf("snapshot = %v", reg.Snapshot())
+	}
+}
+
+func TestAcquireRate(t *testing.T) {
+	reg := New(WithDocument(Document{DefaultPlan: "p", Plans: map[string]Plan{"p": {Rate: 1, Burst: 1}}}))
+	defer reg.Stop()
+	if _, release, err := reg.Acquire(context.Background(), "t", -1); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	_, _, err := reg.Acquire(context.Background(), "t", -1)
+	if kindOf(err) != KindRate {
+		t.Fatalf("want rate rejection, got %v", err)
+	}
+	st, _ := perr.FromError(err)
+	if reasonOf(st) != "TENANT_RATE" {
+		t.Fatalf("reason = %q", reasonOf(st))
+	}
+	if retryAfter(st) <= 0 {
+		t.Fatalf("missing RetryInfo: %v", st.Details())
+	}
+	// 其它租户不受影响
+	if _, _, err := reg.Acquire(context.Background(), "other", -1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUsageBounded(t *testing.T) {
+	reg := New(WithDocument(testDoc), WithMaxTrackedTenants(4))
+	defer reg.Stop()
+	ctx := context.Background()
+	_, busy, err := reg.Acquire(ctx, "busy", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, release, err := reg.Acquire(ctx, "t-pro", -1); err == nil {
+		release()
+	}
+	for i := range 100 {
+		if _, release, err := reg.Acquire(ctx, "random-"+strconv.Itoa(i), -1); err == nil {
+			release()
+		}
+	}
+	snap := reg.Snapshot()
+	if len(snap) > 4 {
+		t.Fatalf("usage table grew to %d entries", len(snap))
+	}
+	// 已配置的租户与有在途请求的租户不被淘汰
+	if snap["t-pro"].Requests != 1 || snap["busy"].InFlight != 1 {
+		t.Fatalf("snapshot = %v", snap)
+	}
+	if _, _, err := reg.Acquire(ctx, "busy", -1); kindOf(err) != KindConcurrency {
+		t.Fatalf("want concurrency rejection, got %v", err)
+	}
+	busy()
+	if u := reg.Usage("never-seen"); u.Requests != 0 || len(reg.Snapshot()) > 4 {
+		t.Fatalf("Usage must not create entries: %+v", u)
+	}
+}
+
+// 淘汰与准入并发时,同一租户的并发上限不能因条目被换掉而失效。
+func TestConcurrencyCapSurvivesEviction(t *testing.T) {
+	reg := New(WithDocument(Document{DefaultPlan: "p", Plans: map[string]Plan{"p": {MaxConcurrency: 1}}}),
+		WithMaxTrackedTenants(1))
+	defer reg.Stop()
+	ctx := context.Background()
+	var inflight, peak atomic.Int64
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				id := "hot"
+				if i%2 == 1 {
+					id = "churn-" + strconv.Itoa(w*1000+i) // 撑满用量表,触发淘汰
+				}
+				_, release, err := reg.Acquire(ctx, id, -1)
+				if err != nil {
+					continue
+				}
+				if id == "hot" {
+					n := inflight.Add(1)
+					for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+					}
+					inflight.Add(-1)
+				}
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > 1 {
+		t.Fatalf("hot tenant reached %d concurrent requests, cap is 1", p)
+	}
+}
+
+func TestMetricTenant(t *testing.T) {
+	reg := New(WithDocument(testDoc))
+	defer reg.Stop()
+	s := reg.snap.Load()
+	if got := s.metricTenant("t-pro"); got != "t-pro" {
+		t.Fatalf("configured tenant label = %q", got)
+	}
+	if got := s.metricTenant("random-123"); got != OtherTenant {
+		t.Fatalf("unconfigured tenant label = %q", got)
+	}
+}
+
+func TestNoTenant(t *testing.T) {
+	reg := New(WithDocument(testDoc))
+	defer reg.Stop()
+	if _, _, err := reg.Acquire(context.Background(), "", -1); err != nil {
+		t.Fatal(err)
+	}
+	strict := New(WithRequireTenant(true))
+	defer strict.Stop()
+	_, _, err := strict.Acquire(context.Background(), "", -1)
+	if st, _ := perr.FromError(err); st == nil || st.Code() != perr.CodeForbidden {
+		t.Fatalf("want forbidden, got %v", err)
+	}
+}
+
+func TestSharedStore(t *testing.T) {
+	store := kvstore.NewMemory()
+	doc := Document{DefaultPlan: "p", Plans: map[string]Plan{"p": {DailyRequests: 2}}}
+	a, b := New(WithDocument(doc), WithStore(store)), New(WithDocument(doc), WithStore(store))
+	defer a.Stop()
+	defer b.Stop()
+	for _, reg := range []*Registry{a, b} {
+		_, release, err := reg.Acquire(context.Background(), "t", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if _, _, err := a.Acquire(context.Background(), "t", -1); kindOf(err) != KindDaily {
+		t.Fatalf("want shared daily rejection, got %v", err)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	reg := New(WithDocument(Document{DefaultPlan: "p", Plans: map[string]Plan{"p": {Rate: 1, Burst: 1, MaxBodyBytes: 4, Features: []string{"x"}}}}))
+	defer reg.Stop()
+	h := tenant.HTTPMiddleware()(HTTPMiddleware(reg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasFeature(r.Context(), "x") {
+			t.Error("policy not injected")
+		}
+	})))
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-Tenant-ID", "t1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do("toolarge"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body: status = %d", rec.Code)
+	}
+	if rec := do("ok"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", rec.Code, rec.Body)
+	}
+	rec := do("ok")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("rate: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var resp struct {
+		Details []struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, d := range resp.Details {
+		if d.Type == "QuotaViolation" && strings.Contains(string(d.Data), "tenant/t1/rate") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("missing QuotaViolation: %s", rec.Body)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	reg := New(WithDocument(Document{DefaultPlan: "p", Plans: map[string]Plan{"p": {MaxBodyBytes: 4}}}))
+	defer reg.Stop()
+	ic := UnaryServerInterceptor(reg)
+	ctx := tenant.NewContext(context.Background(), "t1")
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	if _, err := ic(ctx, wrapperspb.String("ab"), &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ic(ctx, wrapperspb.String("abcdefgh"), &grpc.UnaryServerInfo{}, handler)
+	st := status.Convert(err)
+	if st.Code() != codes.OutOfRange { // 413 与 429 在 gRPC 上用不同的码
+		t.Fatalf("code = %v", st.Code())
+	}
+	var subject string
+	for _, d := range st.Details() {
+		if q, ok := d.(*errdetails.QuotaFailure); ok {
+			subject = q.Violations[0].Subject
+		}
+	}
+	if subject != "tenant/t1/body_size" {
+		t.Fatalf("subject = %q", subject)
+	}
+}
+
+type fakeLoader struct {
+	doc      string
+	onChange func()
+}
+
+func (f *fakeLoader) Unmarshal(dst any) error { return json.Unmarshal([]byte(f.doc), dst) }
+
+func (f *fakeLoader) Watch(_ context.Context, fn func()) { f.onChange = fn }
+
+func TestConfig(t *testing.T) {
+	reg := New()
+	defer reg.Stop()
+	l := &fakeLoader{doc: `{"default_plan":"free","plans":{"free":{"rate":5,"daily_requests":100}}}`}
+	if err := reg.WatchConfig(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if p := reg.Policy("t1"); p.PlanName != "free" || p.Plan.DailyRequests != 100 {
+		t.Fatalf("policy = %+v", p)
+	}
+	l.doc = `{"default_plan":"missing"}`
+	l.onChange()
+	if reg.Document().DefaultPlan != "free" {
+		t.Fatal("invalid update should keep last-good document")
+	}
+
+	store := kvstore.NewMemory()
+	_ = store.Set(context.Background(), "quota", []byte(`{"tenants":{"t1":{"disabled":true}}}`), 0)
+	if err := reg.LoadKV(context.Background(), store, "quota"); err != nil {
+		t.Fatal(err)
+	}
+	if !reg.Policy("t1").Disabled {
+		t.Fatal("kv document not applied")
+	}
+	if err := reg.LoadKV(context.Background(), store, "absent"); err == nil {
+		t.Fatal("want error for missing key")
+	}
+	if err := reg.SetDocument(Document{Plans: map[string]Plan{"p": {Rate: -1}}}); err == nil {
+		t.Fatal("want error for negative limit")
+	}
+}
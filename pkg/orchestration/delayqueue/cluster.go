@@ -0,0 +1,398 @@
+package delayqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/safe"
+	"github.com/rushteam/beauty/pkg/foundation/semaphore"
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/store/shard"
+)
+
+// ===== 集群版 =====
+//
+// Cluster 是跨实例的延迟队列:任务持久化在共享存储(ClusterStore,如 pkg/infra/redis 的
+// Sorted Set 实现),按 ID 哈希到固定数量的分区,每个分区由 pkg/store/shard 的一致性哈希
+// 归属到一个实例轮询。到期任务以"认领 + 可见性超时"取出:认领把任务对其它实例隐藏
+// visibility 时长,投递成功后按认领令牌 Ack 删除;实例崩溃或投递失败则超时后重新可见,
+// 由(可能是另一台)实例再次认领。
+//
+// 保证:同一时刻一个任务只被一个实例持有(成员变更期间两台都轮询同一分区也不会重复认领);
+// 投递是 at-least-once——投递成功但 Ack 前崩溃会再投一次,回调 / 下游消费者按
+// Task.ID 幂等。改期(同 ID 再 Schedule)会使进行中的认领失效,旧认领 Ack 不会删掉新任务。
+
+// ErrNoHandler 表示任务的 Topic 既没有注册回调,也没有配置 mq 发布器。
+var ErrNoHandler = errors.New("delayqueue: no handler for topic")
+
+// Task 是集群延迟任务。
+type Task struct {
+	ID      string    `json:"id"`    // 唯一标识(取消 / 改期 / 幂等键)
+	Topic   string    `json:"topic"` // Handle 注册的回调名,或 mq topic
+	Payload []byte    `json:"payload,omitempty"`
+	FireAt  time.Time `json:"fire_at"`
+	Attempt int       `json:"-"` // 第几次投递(从 1 起,由存储在认领时填写)
+}
+
+// Claimed 是被认领的任务及其认领令牌。
+type Claimed struct {
+	Task
+	Token string
+}
+
+// ClusterStore 是 Cluster 的共享存储。实现须保证 Claim 原子(同一任务不会被并发认领两次)。
+// partition 为 [0, 分区数) 的分区号,实现可据此拆 key。
+type ClusterStore interface {
+	// Put 写入任务;同 ID 已存在则覆盖(改期),并使其进行中的认领失效。
+	Put(ctx context.Context, partition int, t Task) error
+	// Delete 删除任务,返回是否存在。
+	Delete(ctx context.Context, partition int, id string) (bool, error)
+	// Claim 认领分区内 FireAt(或上次认领的可见时刻)<= now 的至多 limit 个任务:
+	// 把它们重新可见的时刻推迟到 now+visibility,Attempt 加一,并发放新的令牌。
+	// 个别任务无法解码时应跳过它们,返回其余任务,并用非 nil 的 error 报告被跳过的任务。
+	Claim(ctx context.Context, partition int, now time.Time, visibility time.Duration, limit int) ([]Claimed, error)
+	// Ack 仅当任务仍持有 token 时删除它,返回是否删除。
+	Ack(ctx context.Context, partition int, id, token string) (bool, error)
+}
+
+type clusterConfig struct {
+	name       string
+	partitions int
+	sharder    *shard.Sharder
+	poll       time.Duration
+	visibility time.Duration
+	batch      int
+	workers    int
+	publisher  mq.Publisher
+	onError    func(t Task, err error)
+}
+
+// ClusterOption 配置 Cluster。
+type ClusterOption func(*clusterConfig)
+
+// WithClusterName 设置队列名:参与分区归属的哈希与 String。共享同一存储的多个队列应取不同名字
+// 并使用不同的存储前缀。默认 "delayqueue"。
+func WithClusterName(name string) ClusterOption {
+	return func(c *clusterConfig) {
+		if name != "" {
+			c.name = name
+		}
+	}
+}
+
+// WithPartitions 设置分区数,默认 64。所有实例必须一致,上线后不可修改(任务按 ID 哈希定位分区)。
+func WithPartitions(n int) ClusterOption {
+	return func(c *clusterConfig) {
+		if n > 0 {
+			c.partitions = n
+		}
+	}
+}
+
+// WithSharder 按 sharder 的一致性哈希只轮询归属本实例的分区。不设置时轮询全部分区
+// (单实例,或不在意多实例重复轮询的开销——认领仍保证不重复)。
+func WithSharder(s *shard.Sharder) ClusterOption {
+	return func(c *clusterConfig) { c.sharder = s }
+}
+
+// WithPollInterval 设置轮询间隔(即触发精度),默认 200ms。
+func WithPollInterval(d time.Duration) ClusterOption {
+	return func(c *clusterConfig) {
+		if d > 0 {
+			c.poll = d
+		}
+	}
+}
+
+// WithVisibilityTimeout 设置认领的可见性超时,默认 30s。应大于回调 / 发布的最长耗时,
+// 否则任务会在投递完成前被其它实例重新认领。
+func WithVisibilityTimeout(d time.Duration) ClusterOption {
+	return func(c *clusterConfig) {
+		if d > 0 {
+			c.visibility = d
+		}
+	}
+}
+
+// WithClaimBatch 设置每个分区每次认领的最大任务数,默认 100。
+func WithClaimBatch(n int) ClusterOption {
+	return func(c *clusterConfig) {
+		if n > 0 {
+			c.batch = n
+		}
+	}
+}
+
+// WithDeliveryConcurrency 设置同时在途的投递数上限,默认 64。名额占满时本轮不再认领,
+// 已到期的任务留在存储里等下一轮,慢回调不会让投递 goroutine 无限堆积。
+func WithDeliveryConcurrency(n int) ClusterOption {
+	return func(c *clusterConfig) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithPublisher 把没有注册回调的 Topic 投递到 mq:消息 Topic 为 Task.Topic,Key 为 Task.ID,
+// Body 为 Payload,Headers 带 "delayqueue-id" / "delayqueue-attempt"。发布成功即 Ack。
+func WithPublisher(p mq.Publisher) ClusterOption {
+	return func(c *clusterConfig) { c.publisher = p }
+}
+
+// WithClusterOnError 设置存储 / 投递失败的回调(t 为零值表示与具体任务无关),
+// 默认 slog.Warn。投递失败的任务在可见性超时后重投。
+func WithClusterOnError(fn func(t Task, err error)) ClusterOption {
+	return func(c *clusterConfig) {
+		if fn != nil {
+			c.onError = fn
+		}
+	}
+}
+
+// Cluster 是基于共享存储的分布式延迟队列。实现 beauty.Service。
+// 零值不可用,用 NewCluster 构造。并发安全。
+type Cluster struct {
+	cfg   clusterConfig
+	store ClusterStore
+	sem   *semaphore.Semaphore // 在途投递名额
+
+	mu       sync.RWMutex
+	handlers map[string]func(ctx context.Context, t Task) error
+}
+
+// NewCluster 创建集群延迟队列。Start 之前即可 Schedule / Cancel(只写存储)。
+func NewCluster(store ClusterStore, opts ...ClusterOption) *Cluster {
+	cfg := clusterConfig{
+		name:       "delayqueue",
+		partitions: 64,
+		poll:       200 * time.Millisecond,
+		visibility: 30 * time.Second,
+		batch:      100,
+		workers:    64,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.onError == nil {
+		name := cfg.name
+		cfg.onError = func(t Task, err error) {
+			slog.Warn("delayqueue: cluster failed", "queue", name, "task", t.ID, "error", err)
+		}
+	}
+	return &Cluster{
+		cfg:      cfg,
+		store:    store,
+		sem:      semaphore.New(semaphore.WithCapacity(int64(cfg.workers))),
+		handlers: make(map[string]func(context.Context, Task) error),
+	}
+}
+
+// Handle 注册 topic 的进程内回调。返回 error 表示投递失败,任务在可见性超时后重投。
+// 所有可能轮询到该 topic 的实例都应注册同样的回调。
+func (c *Cluster) Handle(topic string, fn func(ctx context.Context, t Task) error) {
+	c.mu.Lock()
+	c.handlers[topic] = fn
+	c.mu.Unlock()
+}
+
+// Partition 返回 id 所在的分区号。
+func (c *Cluster) Partition(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(c.cfg.partitions))
+}
+
+// Schedule 持久化任务,在 t.FireAt 触发(零值表示立即)。同 ID 已存在则改期并替换内容。
+func (c *Cluster) Schedule(ctx context.Context, t Task) error {
+	if t.ID == "" || t.Topic == "" {
+		return errors.New("delayqueue: task needs ID and Topic")
+	}
+	if t.FireAt.IsZero() {
+		t.FireAt = time.Now()
+	}
+	t.Attempt = 0
+	return c.store.Put(ctx, c.Partition(t.ID), t)
+}
+
+// Cancel 删除尚未投递完成的任务,返回是否存在。正在投递中的任务无法撤回。
+func (c *Cluster) Cancel(ctx context.Context, id string) (bool, error) {
+	return c.store.Delete(ctx, c.Partition(id), id)
+}
+
+// Start 轮询归属本实例的分区并投递到期任务,直到 ctx 取消——满足 beauty.Service。
+// 退出时等待进行中的投递完成。
+func (c *Cluster) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.poll)
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, p := range c.localPartitions() {
+				c.poll(ctx, p, &wg)
+			}
+		}
+	}
+}
+
+// String 满足 beauty.Service。
+func (c *Cluster) String() string { return "delayqueue.Cluster(" + c.cfg.name + ")" }
+
+func (c *Cluster) localPartitions() []int {
+	out := make([]int, 0, c.cfg.partitions)
+	for p := range c.cfg.partitions {
+		if c.cfg.sharder == nil || c.cfg.sharder.IsLocal(c.cfg.name+"/"+strconv.Itoa(p)) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// poll 认领分区 p 的到期任务,每次至多认领当前空闲的投递名额数;名额占满时跳过。
+func (c *Cluster) poll(ctx context.Context, p int, wg *sync.WaitGroup) {
+	free := int(c.sem.Available())
+	if free <= 0 {
+		return
+	}
+	claimed, err := c.store.Claim(ctx, p, time.Now(), c.cfg.visibility, min(c.cfg.batch, free))
+	// 部分任务无法解码时 Claim 同时返回其余任务与错误:报告错误,照常投递其余任务
+	if err != nil && ctx.Err() == nil {
+		c.cfg.onError(Task{}, fmt.Errorf("claim partition %d: %w", p, err))
+	}
+	for _, cl := range claimed {
+		// 只有轮询循环占用名额,认领数不超过 free,这里不会失败
+		c.sem.TryAcquire(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.sem.Release(1)
+			c.deliver(p, cl)
+		}()
+	}
+}
+
+// deliver 投递一个已认领的任务;成功后按令牌 Ack。投递不随 Start 的 ctx 取消中断,
+// 但受可见性超时约束(超时后任务已可能被他人认领)。
+func (c *Cluster) deliver(p int, cl Claimed) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.visibility)
+	defer cancel()
+	c.mu.RLock()
+	fn := c.handlers[cl.Topic]
+	c.mu.RUnlock()
+
+	var err error
+	switch {
+	case fn != nil:
+		err = safe.Run(func() error { return fn(ctx, cl.Task) })
+	case c.cfg.publisher != nil:
+		err = c.cfg.publisher.Publish(ctx, mq.Message{
+			Topic: cl.Topic,
+			Key:   cl.ID,
+			Body:  cl.Payload,
+			Headers: map[string]string{
+				"delayqueue-id":      cl.ID,
+				"delayqueue-attempt": strconv.Itoa(cl.Attempt),
+			},
+		})
+	default:
+		err = ErrNoHandler
+	}
+	if err != nil {
+		c.cfg.onError(cl.Task, err)
+		return
+	}
+	if _, err := c.store.Ack(ctx, p, cl.ID, cl.Token); err != nil {
+		c.cfg.onError(cl.Task, fmt.Errorf("ack: %w", err))
+	}
+}
+
+// NewToken 生成随机认领令牌,供 ClusterStore 实现使用。
+func NewToken() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// MemoryStore 是 ClusterStore 的内存实现,用于单机与测试(多个 Cluster 共享同一个实例即可
+// 模拟多实例)。零值不可用,用 NewMemoryStore 构造。
+type MemoryStore struct {
+	mu    sync.Mutex
+	parts map[int]map[string]*memEntry
+}
+
+type memEntry struct {
+	task      Task
+	visibleAt time.Time
+	token     string
+}
+
+// NewMemoryStore 创建内存存储。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{parts: make(map[int]map[string]*memEntry)}
+}
+
+func (m *MemoryStore) Put(_ context.Context, partition int, t Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	part, ok := m.parts[partition]
+	if !ok {
+		part = make(map[string]*memEntry)
+		m.parts[partition] = part
+	}
+	part[t.ID] = &memEntry{task: t, visibleAt: t.FireAt}
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, partition int, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.parts[partition][id]
+	delete(m.parts[partition], id)
+	return ok, nil
+}
+
+func (m *MemoryStore) Claim(_ context.Context, partition int, now time.Time, visibility time.Duration, limit int) ([]Claimed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*memEntry
+	for _, e := range m.parts[partition] {
+		if !e.visibleAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].visibleAt.Before(due[j].visibleAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	out := make([]Claimed, 0, len(due))
+	for _, e := range due {
+		e.visibleAt = now.Add(visibility)
+		e.token = NewToken()
+		e.task.Attempt++
+		out = append(out, Claimed{Task: e.task, Token: e.token})
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) Ack(_ context.Context, partition int, id, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.parts[partition][id]
+	if !ok || e.token != token {
+		return false, nil
+	}
+	delete(m.parts[partition], id)
+	return true, nil
+}
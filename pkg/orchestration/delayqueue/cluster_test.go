@@ -0,0 +1,261 @@
+package delayqueue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/messaging/mq"
+	"github.com/rushteam/beauty/pkg/orchestration/delayqueue"
+	"github.com/rushteam/beauty/pkg/store/shard"
+)
+
+func runCluster(t *testing.T, c *delayqueue.Cluster) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start(ctx)
+	}()
+	var once sync.Once
+	stop := func() { once.Do(func() { cancel(); <-done }) }
+	t.Cleanup(stop)
+	return stop
+}
+
+// 两个实例按分片各管一半分区,共享存储:每个任务恰好触发一次。
+func TestCluster_FiresOnceAcrossInstances(t *testing.T) {
+	store := delayqueue.NewMemoryStore()
+	members := []shard.Member{shard.StaticMember{NodeID: "a"}, shard.StaticMember{NodeID: "b"}}
+
+	var mu sync.Mutex
+	fired := map[string]string{}
+	const n = 50
+	all := make(chan struct{})
+	for _, self := range []string{"a", "b"} {
+		c := delayqueue.NewCluster(store,
+			delayqueue.WithPartitions(8),
+			delayqueue.WithSharder(shard.New(self, members)),
+			delayqueue.WithPollInterval(10*time.Millisecond),
+		)
+		c.Handle("expire", func(_ context.Context, task delayqueue.Task) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if prev, ok := fired[task.ID]; ok {
+				t.Errorf("task %s fired twice (%s, %s)", task.ID, prev, self)
+			}
+			fired[task.ID] = self
+			if len(fired) == n {
+				close(all)
+			}
+			return nil
+		})
+		runCluster(t, c)
+	}
+
+	c := delayqueue.NewCluster(store, delayqueue.WithPartitions(8))
+	for i := range n {
+		err := c.Schedule(context.Background(), delayqueue.Task{
+			ID: fmt.Sprintf("order-%d", i), Topic: "expire", FireAt: time.Now().Add(30 * time.Millisecond),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-all:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("fired %d of %d", len(fired), n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	owners := map[string]int{}
+	for _, self := range fired {
+		owners[self]++
+	}
+	if owners["a"] == 0 || owners["b"] == 0 {
+		t.Errorf("partitions not spread across instances: %v", owners)
+	}
+}
+
+// 投递失败(或实例崩溃)的任务在可见性超时后被重新认领。
+func TestCluster_RedeliverAfterVisibilityTimeout(t *testing.T) {
+	store := delayqueue.NewMemoryStore()
+	c := delayqueue.NewCluster(store,
+		delayqueue.WithPartitions(4),
+		delayqueue.WithPollInterval(10*time.Millisecond),
+		delayqueue.WithVisibilityTimeout(80*time.Millisecond),
+		delayqueue.WithClusterOnError(func(delayqueue.Task, error) {}),
+	)
+	var attempts atomic.Int32
+	done := make(chan int, 1)
+	c.Handle("settle", func(_ context.Context, task delayqueue.Task) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("downstream unavailable")
+		}
+		done <- task.Attempt
+		return nil
+	})
+	runCluster(t, c)
+	c.Schedule(context.Background(), delayqueue.Task{ID: "match-1", Topic: "settle"})
+
+	select {
+	case attempt := <-done:
+		if attempt != 2 {
+			t.Errorf("attempt = %d, want 2", attempt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task was not redelivered")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("delivered %d times after ack, want 2", n)
+	}
+}
+
+func TestCluster_CancelAndReschedule(t *testing.T) {
+	store := delayqueue.NewMemoryStore()
+	c := delayqueue.NewCluster(store, delayqueue.WithPollInterval(10*time.Millisecond))
+	fired := make(chan string, 4)
+	c.Handle("kick", func(_ context.Context, task delayqueue.Task) error {
+		fired <- task.ID + ":" + string(task.Payload)
+		return nil
+	})
+	runCluster(t, c)
+	ctx := context.Background()
+
+	c.Schedule(ctx, delayqueue.Task{ID: "room-1", Topic: "kick", FireAt: time.Now().Add(40 * time.Millisecond)})
+	if ok, err := c.Cancel(ctx, "room-1"); !ok || err != nil {
+		t.Fatalf("Cancel = %v, %v", ok, err)
+	}
+	c.Schedule(ctx, delayqueue.Task{ID: "room-2", Topic: "kick", Payload: []byte("v1"), FireAt: time.Now().Add(time.Hour)})
+	c.Schedule(ctx, delayqueue.Task{ID: "room-2", Topic: "kick", Payload: []byte("v2"), FireAt: time.Now().Add(40 * time.Millisecond)})
+
+	select {
+	case got := <-fired:
+		if got != "room-2:v2" {
+			t.Fatalf("fired %q, want room-2:v2", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rescheduled task did not fire")
+	}
+	select {
+	case got := <-fired:
+		t.Fatalf("unexpected fire %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCluster_PublishToMQ(t *testing.T) {
+	broker := mq.NewInProc()
+	defer broker.Close()
+	got := make(chan mq.Message, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker.Subscribe(ctx, "order.timeout", func(_ context.Context, msg mq.Message) error {
+		got <- msg
+		return nil
+	})
+
+	c := delayqueue.NewCluster(delayqueue.NewMemoryStore(),
+		delayqueue.WithPollInterval(10*time.Millisecond),
+		delayqueue.WithPublisher(broker),
+	)
+	runCluster(t, c)
+	c.Schedule(context.Background(), delayqueue.Task{ID: "o-9", Topic: "order.timeout", Payload: []byte(`{"order":9}`)})
+
+	select {
+	case msg := <-got:
+		if msg.Key != "o-9" || string(msg.Body) != `{"order":9}` || msg.Headers["delayqueue-attempt"] != "1" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not published")
+	}
+}
+
+// 在途投递数不超过 WithDeliveryConcurrency,名额占满时不再认领,释放后继续投递剩余任务。
+func TestCluster_BoundsDeliveryConcurrency(t *testing.T) {
+	c := delayqueue.NewCluster(delayqueue.NewMemoryStore(),
+		delayqueue.WithPartitions(2),
+		delayqueue.WithPollInterval(5*time.Millisecond),
+		delayqueue.WithDeliveryConcurrency(2),
+	)
+	var inFlight, peak, delivered atomic.Int32
+	release := make(chan struct{})
+	const n = 10
+	done := make(chan struct{})
+	c.Handle("slow", func(context.Context, delayqueue.Task) error {
+		cur := inFlight.Add(1)
+		for p := peak.Load(); cur > p && !peak.CompareAndSwap(p, cur); p = peak.Load() {
+		}
+		<-release
+		inFlight.Add(-1)
+		if delivered.Add(1) == n {
+			close(done)
+		}
+		return nil
+	})
+	runCluster(t, c)
+	for i := range n {
+		c.Schedule(context.Background(), delayqueue.Task{ID: fmt.Sprintf("t-%d", i), Topic: "slow"})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := inFlight.Load(); got != 2 {
+		t.Fatalf("in flight = %d, want 2", got)
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("delivered %d of %d", delivered.Load(), n)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("peak in flight = %d, want <= 2", p)
+	}
+}
+
+// partialStore 模拟个别任务无法解码:Claim 返回其余任务并附带错误。
+type partialStore struct{ *delayqueue.MemoryStore }
+
+func (s partialStore) Claim(ctx context.Context, p int, now time.Time, vis time.Duration, limit int) ([]delayqueue.Claimed, error) {
+	claimed, _ := s.MemoryStore.Claim(ctx, p, now, vis, limit)
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	return claimed, errors.New("decode task bad: invalid character")
+}
+
+func TestCluster_DeliversRestOfPartialClaim(t *testing.T) {
+	errs := make(chan error, 4)
+	c := delayqueue.NewCluster(partialStore{delayqueue.NewMemoryStore()},
+		delayqueue.WithPartitions(1),
+		delayqueue.WithPollInterval(10*time.Millisecond),
+		delayqueue.WithClusterOnError(func(_ delayqueue.Task, err error) { errs <- err }),
+	)
+	fired := make(chan string, 1)
+	c.Handle("kick", func(_ context.Context, task delayqueue.Task) error {
+		fired <- task.ID
+		return nil
+	})
+	runCluster(t, c)
+	c.Schedule(context.Background(), delayqueue.Task{ID: "good", Topic: "kick"})
+
+	select {
+	case id := <-fired:
+		if id != "good" {
+			t.Fatalf("fired %q", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("remaining task was not delivered")
+	}
+	if err := <-errs; err == nil {
+		t.Fatal("partial claim error not reported")
+	}
+}
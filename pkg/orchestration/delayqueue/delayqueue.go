@@ -15,6 +15,10 @@
 // 回调在独立 goroutine 执行(复用 pkg/safe,panic 被恢复),不阻塞驱动循环。
 //
 // 零值不可用,用 New 构造。并发安全。Stop 后驱动 goroutine 退出,未触发的任务丢弃。
+//
+// 跨实例版本见 Cluster:任务持久化在共享存储(ClusterStore:内存 / pkg/infra/redis /
+// pkg/infra/etcd),按分区由 pkg/store/shard 分给各实例轮询,认领带可见性超时,
+// 可投递到进程内回调或 mq topic。
 package delayqueue
 
 import (
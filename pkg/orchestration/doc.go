@@ -7,11 +7,13 @@
 //
 // 已有子包:
 //
-//	saga        — Saga 模式(补偿事务编排)
+//	saga        — Saga 模式(补偿事务编排;Coordinator 持久化执行日志 + 崩溃恢复)
+//	tcc         — TCC 事务(Try-Confirm-Cancel;Coordinator 持久化事务日志 + 超时恢复)
+//	workflow    — 持久化 workflow 引擎(事件历史 + 确定性重放,activity / timer / 信号 / 版本标记)
 //	txn         — 本地事务辅助
 //	worker      — 后台 Worker 池(依赖 store/dlock)
 //	scheduler   — 异步任务调度器(Submit/Pause/Resume)
-//	timerqueue  — 最小堆延时队列(beauty.Service 集成,适合大量倒计时)
-//	delayqueue  — 精确 time.Timer 延时队列(一次性任务)
+//	timerqueue  — 最小堆 / 分层时间轮延时队列(beauty.Service 集成,适合大量倒计时,可快照恢复)
+//	delayqueue  — 精确 time.Timer 延时队列(一次性任务);Cluster 为跨实例持久化版本
 //	jobqueue    — 带优先级/进度/生命周期事件的任务队列(BullMQ 风格)
 package orchestration
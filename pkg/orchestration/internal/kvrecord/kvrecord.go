@@ -0,0 +1,204 @@
+// Package kvrecord 是 saga / tcc 等编排原语共用的"带版本号的 JSON 记录"存储,建在 kvstore.Store 之上。
+//
+// kvstore 没有列举与 CAS 原语,因此:
+//   - Scan 依赖一个自增序号索引(<prefix>seq + <prefix>x:<n> → id)顺序扫描,
+//     已过期记录的索引在扫描时顺带清理;适合"进行中记录 + 近期终态"规模,不适合海量历史查询;
+//   - Update 与 CompareAndSet 用 SetNX 短锁(Lock)保护"读-比较-写入",锁被占用即视为冲突。
+package kvrecord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// LockTTL 是短锁的存活时间,防止持锁进程崩溃后键永久不可写。
+const LockTTL = 10 * time.Second
+
+// Lock 以 SetNX 抢占锁键 lock。抢到时返回释放函数,锁被占用返回 (nil, nil)。
+func Lock(ctx context.Context, kv kvstore.Store, lock string) (unlock func(), err error) {
+	ok, err := kv.SetNX(ctx, lock, []byte{1}, LockTTL)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return func() { _ = kv.Delete(context.WithoutCancel(ctx), lock) }, nil
+}
+
+// KeyLock 返回 CompareAndSet 保护 key 时使用的锁键。
+func KeyLock(key string) string { return key + ":l" }
+
+// CompareAndSet 在 key 的当前值等于 old 时写入 val(val 为 nil 时删除 key),返回是否写入。
+// 锁(<key>:l)被占用时返回 false;同一 key 的其它写入方须经 Lock(KeyLock(key)) 才能与之互斥。
+func CompareAndSet(ctx context.Context, kv kvstore.Store, key, old string, val []byte, ttl time.Duration) (bool, error) {
+	unlock, err := Lock(ctx, kv, KeyLock(key))
+	if err != nil || unlock == nil {
+		return false, err
+	}
+	defer unlock()
+	cur, found, err := kv.Get(ctx, key)
+	if err != nil || !found || string(cur) != old {
+		return false, err
+	}
+	if val == nil {
+		return true, kv.Delete(ctx, key)
+	}
+	return true, kv.Set(ctx, key, val, ttl)
+}
+
+// Store 存取类型为 T 的记录,记录自带 ID 与乐观锁版本号。各字段须在使用前设好。
+type Store[T any] struct {
+	KV     kvstore.Store
+	Prefix string
+	// ID 返回记录的唯一标识。
+	ID func(*T) string
+	// Version 返回记录版本号字段的指针,由 Store 维护。
+	Version func(*T) *int64
+	// TTL 返回记录的存活时间,<=0 表示永不过期。
+	TTL func(*T) time.Duration
+	// 对应 Get 不存在、Create 已存在、Update 版本不匹配时返回的错误。
+	ErrNotFound, ErrExists, ErrConflict error
+}
+
+func (s *Store[T]) key(id string) string { return s.Prefix + "i:" + id }
+
+func (s *Store[T]) indexKey(n int64) string { return s.Prefix + "x:" + strconv.FormatInt(n, 10) }
+
+// Create 写入新记录(版本置 1);ID 已存在返回 ErrExists。
+func (s *Store[T]) Create(ctx context.Context, v *T) error {
+	*s.Version(v) = 1
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// 先写索引再写记录:进程在两步之间崩溃只会留下指向空记录的索引(扫描时清理),
+	// 不会留下无法被 Scan 发现的记录。索引值带写入时间,避免清理掉正在创建的记录的索引。
+	n, err := s.KV.Incr(ctx, s.Prefix+"seq", 1, 0)
+	if err != nil {
+		return err
+	}
+	idx := strconv.FormatInt(time.Now().UnixMilli(), 10) + ":" + s.ID(v)
+	if err := s.KV.Set(ctx, s.indexKey(n), []byte(idx), 0); err != nil {
+		return err
+	}
+	ok, err := s.KV.SetNX(ctx, s.key(s.ID(v)), b, s.TTL(v))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_ = s.KV.Delete(ctx, s.indexKey(n))
+		return s.ErrExists
+	}
+	return nil
+}
+
+// Update 当存储中的版本等于 v 的版本时写入并把 v 的版本加 1;版本不匹配或锁被占用返回 ErrConflict。
+func (s *Store[T]) Update(ctx context.Context, v *T) error {
+	id := s.ID(v)
+	unlock, err := Lock(ctx, s.KV, s.Prefix+"l:"+id)
+	if err != nil {
+		return err
+	}
+	if unlock == nil {
+		return s.ErrConflict
+	}
+	defer unlock()
+
+	cur, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if *s.Version(cur) != *s.Version(v) {
+		return s.ErrConflict
+	}
+	next := *v
+	*s.Version(&next)++
+	b, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	if err := s.KV.Set(ctx, s.key(id), b, s.TTL(&next)); err != nil {
+		return err
+	}
+	*s.Version(v) = *s.Version(&next)
+	return nil
+}
+
+// Get 读取记录;不存在返回 ErrNotFound。
+func (s *Store[T]) Get(ctx context.Context, id string) (*T, error) {
+	b, ok, err := s.KV.Get(ctx, s.key(id))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.ErrNotFound
+	}
+	v := new(T)
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Scan 从低水位(<prefix>lo)扫描到当前序号,返回满足 match 的记录(按写入顺序、去重);
+// 从低水位起连续失效的索引在扫描后推进低水位跳过。
+// 并发扫描可能把低水位写回较小值,只会导致多扫几条,不影响正确性。
+func (s *Store[T]) Scan(ctx context.Context, match func(*T) bool) ([]*T, error) {
+	hi, _, err := s.KV.GetInt(ctx, s.Prefix+"seq")
+	if err != nil {
+		return nil, err
+	}
+	var lo int64
+	if b, ok, err := s.KV.Get(ctx, s.Prefix+"lo"); err != nil {
+		return nil, err
+	} else if ok {
+		lo, _ = strconv.ParseInt(string(b), 10, 64)
+	}
+	var out []*T
+	seen := make(map[string]bool)
+	next := lo
+	for n := lo + 1; n <= hi; n++ {
+		v, pending, err := s.indexed(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			if next == n-1 && !pending {
+				next = n
+			}
+			continue
+		}
+		if id := s.ID(v); !seen[id] && match(v) {
+			seen[id] = true
+			out = append(out, v)
+		}
+	}
+	if next > lo {
+		if err := s.KV.Set(ctx, s.Prefix+"lo", []byte(strconv.FormatInt(next, 10)), 0); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// indexed 读取序号 n 指向的记录。记录已不存在时删除索引并返回 nil;
+// 索引刚写入(可能是 Create 尚未写记录)时保留索引并返回 pending=true。
+func (s *Store[T]) indexed(ctx context.Context, n int64) (v *T, pending bool, err error) {
+	b, ok, err := s.KV.Get(ctx, s.indexKey(n))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	at, id, _ := strings.Cut(string(b), ":")
+	v, err = s.Get(ctx, id)
+	if !errors.Is(err, s.ErrNotFound) {
+		return v, false, err
+	}
+	if ms, _ := strconv.ParseInt(at, 10, 64); time.Since(time.UnixMilli(ms)) < LockTTL {
+		return nil, true, nil
+	}
+	return nil, false, s.KV.Delete(ctx, s.indexKey(n))
+}
@@ -0,0 +1,146 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record 是任务的可序列化快照,由 Queue 在每次状态变化时写入 Backend。
+// Fn 不持久化:从 Backend 恢复的任务按 Name 查找 Queue.Handle 注册的处理函数。
+type Record struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Group       string          `json:"group,omitempty"`
+	Priority    int             `json:"priority,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	MaxRetries  int             `json:"max_retries,omitempty"`
+	RetryDelay  time.Duration   `json:"retry_delay,omitempty"`
+	Timeout     time.Duration   `json:"timeout,omitempty"`
+	Repeat      *Repeat         `json:"repeat,omitempty"`
+	RepeatKey   string          `json:"repeat_key,omitempty"`   // 所属重复任务的 key
+	RepeatCount int             `json:"repeat_count,omitempty"` // 本次是第几次(从 1 起)
+	Parent      string          `json:"parent,omitempty"`
+	Pending     int             `json:"pending,omitempty"` // 尚未完成的子任务数
+	State       JobState        `json:"state"`
+	Attempts    int             `json:"attempts,omitempty"`
+	Progress    float64         `json:"progress,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ReadyAt     time.Time       `json:"ready_at"`
+	StartedAt   time.Time       `json:"started_at,omitzero"`
+	CompletedAt time.Time       `json:"completed_at,omitzero"`
+
+	value any // 未序列化的 Payload,只在 MemoryBackend 中随记录保存
+}
+
+// Filter 是 Backend.List 的查询条件。结果按 (CreatedAt, ID) 升序。
+type Filter struct {
+	States []JobState // 为空表示全部状态
+	// AfterCreated / AfterID 为 keyset 游标:只返回排在 (AfterCreated, AfterID) 之后的记录。
+	AfterCreated time.Time
+	AfterID      string
+	// FinishedBefore 非零时只返回 CompletedAt 早于它的记录(清理已结束任务用)。
+	FinishedBefore time.Time
+	Limit          int // <= 0 不限
+}
+
+// Match 报告 rec 是否满足除游标与 Limit 以外的条件。
+func (f Filter) Match(rec *Record) bool {
+	if len(f.States) > 0 && !slices.Contains(f.States, rec.State) {
+		return false
+	}
+	if !f.FinishedBefore.IsZero() && (rec.CompletedAt.IsZero() || !rec.CompletedAt.Before(f.FinishedBefore)) {
+		return false
+	}
+	return true
+}
+
+// After 报告 rec 是否排在游标之后。
+func (f Filter) After(rec *Record) bool {
+	if f.AfterCreated.IsZero() && f.AfterID == "" {
+		return true
+	}
+	if !rec.CreatedAt.Equal(f.AfterCreated) {
+		return rec.CreatedAt.After(f.AfterCreated)
+	}
+	return rec.ID > f.AfterID
+}
+
+// Backend 持久化任务记录。Queue 在 Start 时从 Backend 恢复未结束的任务,查询 API 也走 Backend。
+// 实现须并发安全;Save 为整条覆盖写(upsert)。
+type Backend interface {
+	Save(ctx context.Context, rec *Record) error
+	Delete(ctx context.Context, id string) error
+	// Get 返回记录;不存在返回 ErrNotFound。
+	Get(ctx context.Context, id string) (*Record, error)
+	List(ctx context.Context, f Filter) ([]*Record, error)
+}
+
+// MemoryBackend 是 Backend 的内存实现(默认),进程重启即丢,用于查询与测试。
+// Payload 不经序列化原样保存(Record.Payload 仅在投递时就是 json.RawMessage 时非空)。
+// 零值不可用,用 NewMemoryBackend 构造。
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryBackend 创建内存 Backend。
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{records: make(map[string]*Record)}
+}
+
+func (m *MemoryBackend) Save(_ context.Context, rec *Record) error {
+	cp := *rec
+	m.mu.Lock()
+	m.records[rec.ID] = &cp
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryBackend) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	delete(m.records, id)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryBackend) Get(_ context.Context, id string) (*Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, ok := m.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *rec
+	return &cp, nil
+}
+
+func (m *MemoryBackend) List(_ context.Context, f Filter) ([]*Record, error) {
+	m.mu.RLock()
+	var out []*Record
+	for _, rec := range m.records {
+		if f.Match(rec) && f.After(rec) {
+			cp := *rec
+			out = append(out, &cp)
+		}
+	}
+	m.mu.RUnlock()
+	sortRecords(out)
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+func sortRecords(recs []*Record) {
+	sort.Slice(recs, func(i, j int) bool {
+		if !recs[i].CreatedAt.Equal(recs[j].CreatedAt) {
+			return recs[i].CreatedAt.Before(recs[j].CreatedAt)
+		}
+		return recs[i].ID < recs[j].ID
+	})
+}
@@ -0,0 +1,218 @@
+package jobqueue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileBackend 是基于追加日志(WAL)的单机持久化 Backend:每次 Save / Delete 追加一行 JSON,
+// 打开时重放日志重建内存索引;日志行数超过存活记录的 2 倍(且不少于 WithCompactThreshold)时
+// 写临时文件 + rename 压缩。进程崩溃时最后一行可能不完整,打开时截掉。
+//
+// 查询走内存索引。零值不可用,用 OpenFileBackend 打开;用完 Close。
+type FileBackend struct {
+	mem  *MemoryBackend
+	path string
+
+	mu        sync.Mutex
+	f         *os.File
+	w         *bufio.Writer
+	lines     int
+	threshold int
+	sync      bool
+}
+
+// FileOption 配置 FileBackend。
+type FileOption func(*FileBackend)
+
+// WithFsync 每次写入后 fsync(默认只写入 OS 缓冲:进程崩溃不丢,机器掉电可能丢最后几条)。
+func WithFsync() FileOption {
+	return func(b *FileBackend) { b.sync = true }
+}
+
+// WithCompactThreshold 设置触发压缩的最小日志行数,默认 1024。
+func WithCompactThreshold(n int) FileOption {
+	return func(b *FileBackend) { b.threshold = n }
+}
+
+type walEntry struct {
+	Op     string  `json:"op"` // "save" | "delete"
+	ID     string  `json:"id,omitempty"`
+	Record *Record `json:"record,omitempty"`
+}
+
+// OpenFileBackend 打开(不存在则创建)path 处的日志并重放。
+func OpenFileBackend(path string, opts ...FileOption) (*FileBackend, error) {
+	b := &FileBackend{mem: NewMemoryBackend(), path: path, threshold: 1024}
+	for _, o := range opts {
+		o(b)
+	}
+	if err := b.replay(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	b.f, b.w = f, bufio.NewWriter(f)
+	return b, nil
+}
+
+func (b *FileBackend) replay() error {
+	f, err := os.Open(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var size int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// 末尾没有换行的半行是崩溃时未写完的记录:截掉,避免与后续追加拼在一起
+				return os.Truncate(b.path, size)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += int64(len(line))
+		var e walEntry
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		switch {
+		case e.Op == "save" && e.Record != nil:
+			b.mem.records[e.Record.ID] = e.Record
+		case e.Op == "delete":
+			delete(b.mem.records, e.ID)
+		}
+		b.lines++
+	}
+}
+
+func (b *FileBackend) Save(ctx context.Context, rec *Record) error {
+	return b.write(walEntry{Op: "save", Record: rec}, func() error { return b.mem.Save(ctx, rec) })
+}
+
+func (b *FileBackend) Delete(ctx context.Context, id string) error {
+	return b.write(walEntry{Op: "delete", ID: id}, func() error { return b.mem.Delete(ctx, id) })
+}
+
+func (b *FileBackend) Get(ctx context.Context, id string) (*Record, error) {
+	return b.mem.Get(ctx, id)
+}
+
+func (b *FileBackend) List(ctx context.Context, f Filter) ([]*Record, error) {
+	return b.mem.List(ctx, f)
+}
+
+// Close 刷盘并关闭日志文件。
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f == nil {
+		return nil
+	}
+	err := b.w.Flush()
+	if cerr := b.f.Close(); err == nil {
+		err = cerr
+	}
+	b.f = nil
+	return err
+}
+
+func (b *FileBackend) write(e walEntry, apply func() error) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f == nil {
+		return os.ErrClosed
+	}
+	if err := b.append(line); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	b.lines++
+	b.mem.mu.RLock()
+	live := len(b.mem.records)
+	b.mem.mu.RUnlock()
+	if b.lines >= b.threshold && b.lines > 2*live {
+		return b.compact()
+	}
+	return nil
+}
+
+func (b *FileBackend) append(line []byte) error {
+	if _, err := b.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+	if b.sync {
+		return b.f.Sync()
+	}
+	return nil
+}
+
+// compact 把存活记录写入临时文件后原子替换日志。调用方持有 b.mu。
+func (b *FileBackend) compact() error {
+	tmp := b.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	b.mem.mu.RLock()
+	n := 0
+	for _, rec := range b.mem.records {
+		line, err := json.Marshal(walEntry{Op: "save", Record: rec})
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			b.mem.mu.RUnlock()
+			f.Close()
+			return err
+		}
+		n++
+	}
+	b.mem.mu.RUnlock()
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return err
+	}
+	nf, err := os.OpenFile(b.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	b.f.Close()
+	b.f, b.w, b.lines = nf, bufio.NewWriter(nf), n
+	return nil
+}
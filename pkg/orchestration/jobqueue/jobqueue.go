@@ -14,30 +14,60 @@
 //   - delayqueue 仅"到点触发回调",不关心执行状态与并发控制;
 //   - jobqueue 关注"完整的 Job 生命周期":排队→执行→报告进度→完成/失败。
 //
-// 进程内实现(不持久化);分布式持久化版本见 contrib/redisqueue。
+// 进阶能力:
+//   - 持久化:任务快照在每次状态变化时写入 Backend(默认 MemoryBackend;FileBackend 为单机 WAL;
+//     contrib/redisqueue.NewJobBackend 存入 Redis),Start 时恢复未结束的任务;
+//   - 重复任务:Job.Repeat 按 cron 表达式或固定间隔重复投递,同一 key 只保留一个系列;
+//   - 父子流程:Job.Children 全部完成后父任务才进入就绪,任一子任务最终失败则父任务失败;
+//   - 分组限流:WithGroupLimiter 按 Job.Group 限速;
+//   - 卡死检测:WithStalledTimeout 内没有进度 / 心跳的执行中任务被取消并重试;
+//   - 查询:Get / Jobs(按状态 keyset 分页)供 dashboard 使用。
+//
+// 调度在进程内;需要多进程共同消费同一队列时直接使用 contrib/redisqueue。
 // 零值不可用,用 New 构造。并发安全。
 package jobqueue
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"runtime/debug"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/rushteam/beauty/pkg/foundation/priority"
+	"github.com/rushteam/beauty/pkg/resilience/ratelimit"
+)
+
+var (
+	// ErrStopped 队列已停止。
+	ErrStopped = errors.New("jobqueue: stopped")
+	// ErrExists 同 ID 的任务尚未结束。
+	ErrExists = errors.New("jobqueue: job already exists")
+	// ErrNotFound 任务记录不存在(或已被清理)。
+	ErrNotFound = errors.New("jobqueue: job not found")
+	// ErrNoHandler 任务既没有 Fn,也没有按 Name 注册的处理函数。
+	ErrNoHandler = errors.New("jobqueue: no handler")
+	// ErrStalled 执行中的任务超过 WithStalledTimeout 没有进度 / 心跳,或进程崩溃时仍在执行。
+	ErrStalled = errors.New("jobqueue: job stalled")
+	// ErrChildFailed 子任务最终失败导致父任务失败(包装子任务 ID 与原因)。
+	ErrChildFailed = errors.New("jobqueue: child job failed")
 )
 
 // JobState 任务状态。
 type JobState int
 
 const (
-	StateWaiting   JobState = iota // 在队列中等待执行
-	StateDelayed                   // 延迟中(到期后转 Waiting)
-	StateActive                    // 正在被 worker 执行
-	StateCompleted                 // 执行成功
-	StateFailed                    // 执行失败
+	StateWaiting         JobState = iota // 在队列中等待执行
+	StateDelayed                         // 延迟中(到期后转 Waiting)
+	StateActive                          // 正在被 worker 执行
+	StateCompleted                       // 执行成功
+	StateFailed                          // 执行失败
+	StateWaitingChildren                 // 等待子任务全部完成
 )
 
 func (s JobState) String() string {
@@ -52,11 +82,30 @@ func (s JobState) String() string {
 		return "completed"
 	case StateFailed:
 		return "failed"
+	case StateWaitingChildren:
+		return "waiting-children"
 	default:
 		return "unknown"
 	}
 }
 
+// Finished 报告是否为终态(completed / failed)。
+func (s JobState) Finished() bool { return s == StateCompleted || s == StateFailed }
+
+// MarshalText 以名字序列化(持久化记录与 dashboard 可读)。
+func (s JobState) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// UnmarshalText 解析 String 的输出。
+func (s *JobState) UnmarshalText(b []byte) error {
+	for st := StateWaiting; st <= StateWaitingChildren; st++ {
+		if st.String() == string(b) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("jobqueue: unknown state %q", b)
+}
+
 // Job 是一个待执行的任务。
 type Job struct {
 	// ID 任务唯一标识。
@@ -65,10 +114,19 @@ type Job struct {
 	Name string
 	// Priority 优先级:数值越小越优先(0 最高)。默认 0。
 	Priority int
-	// Payload 任务数据(业务自定义)。
+	// Payload 任务数据(业务自定义)。使用持久化 Backend 时须可 JSON 序列化;默认 MemoryBackend
+	// 原样保存,可以是任意值(channel、函数等)。从 Backend 恢复的任务中为 json.RawMessage,用 Decode 读取。
 	Payload any
 	// Fn 执行函数。ctx 携带 ProgressReporter,可通过 ReportProgress 上报进度。
+	// 为 nil 时使用 Queue.Handle 按 Name 注册的处理函数(需要持久化恢复的任务应这样注册)。
 	Fn func(ctx context.Context, job *Job) error
+	// Group 限流分组(见 WithGroupLimiter)。空表示不限流。
+	Group string
+	// Repeat 非 nil 时按其规则重复投递(见 Repeat)。
+	Repeat *Repeat
+	// Children 子任务:全部完成后本任务才进入就绪;任一子任务最终失败则本任务以 ErrChildFailed 失败。
+	// 子任务可再带 Children 组成多层流程。
+	Children []*Job
 	// MaxRetries 最大重试次数(0=不重试)。
 	MaxRetries int
 	// RetryDelay 重试基础延迟(第 n 次 = delay * 2^n)。
@@ -94,8 +152,26 @@ type Job struct {
 	StartedAt time.Time
 	// CompletedAt 完成时间。
 	CompletedAt time.Time
+	// Parent 父任务 ID(作为 Children 投递时设置)。
+	Parent string
+
+	readyAt     time.Time       // 就绪时刻(对延迟任务,readyAt = CreatedAt + Delay)
+	payload     json.RawMessage // Payload 的序列化结果(MemoryBackend 下不序列化,为 nil)
+	pending     int             // 尚未完成的子任务数
+	repeatKey   string
+	repeatCount int
+}
 
-	readyAt time.Time // 就绪时刻(对延迟任务,readyAt = CreatedAt + Delay)
+// Decode 把 Payload 解码到 v:恢复的任务直接反序列化,进程内投递的任务经一次 JSON 往返。
+func (j *Job) Decode(v any) error {
+	if raw, ok := j.Payload.(json.RawMessage); ok {
+		return json.Unmarshal(raw, v)
+	}
+	b, err := json.Marshal(j.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
 }
 
 // EventType 事件类型。
@@ -108,6 +184,7 @@ const (
 	EventComplete                  // 执行成功
 	EventFail                      // 执行失败(含重试耗尽)
 	EventRetry                     // 即将重试
+	EventStalled                   // 执行中的任务被判定卡死(超时无心跳或进程崩溃后恢复)
 )
 
 func (e EventType) String() string {
@@ -124,6 +201,8 @@ func (e EventType) String() string {
 		return "fail"
 	case EventRetry:
 		return "retry"
+	case EventStalled:
+		return "stalled"
 	default:
 		return "unknown"
 	}
@@ -133,7 +212,7 @@ func (e EventType) String() string {
 type Event struct {
 	Type EventType
 	Job  *Job
-	Err  error // 仅 EventFail 时有值
+	Err  error // EventFail / EventRetry / EventStalled 时有值
 }
 
 // EventHook 事件回调接口。实现者可选择性处理感兴趣的事件。
@@ -152,7 +231,7 @@ type progressKeyType struct{}
 
 var progressCtxKey = progressKeyType{}
 
-// ReportProgress 在 Job.Fn 内调用,上报执行进度(0~100)。
+// ReportProgress 在 Job.Fn 内调用,上报执行进度(0~100),同时视为一次心跳。
 // 若 ctx 中无 reporter(非 jobqueue 执行),则静默忽略。
 func ReportProgress(ctx context.Context, percent float64) {
 	if rp, ok := ctx.Value(progressCtxKey).(*progressReporter); ok {
@@ -160,9 +239,19 @@ func ReportProgress(ctx context.Context, percent float64) {
 	}
 }
 
+// Heartbeat 在 Job.Fn 内调用,表明任务仍在推进(不改变进度),避免被 WithStalledTimeout 判定卡死。
+func Heartbeat(ctx context.Context) {
+	if rp, ok := ctx.Value(progressCtxKey).(*progressReporter); ok {
+		rp.beat.Store(time.Now().UnixNano())
+	}
+}
+
 type progressReporter struct {
-	job  *Job
-	hook EventHook
+	q       *Queue
+	job     *Job
+	beat    atomic.Int64 // 最近一次进度 / 心跳(unix 纳秒)
+	stalled atomic.Bool
+	cancel  context.CancelCauseFunc
 }
 
 func (p *progressReporter) report(percent float64) {
@@ -172,18 +261,23 @@ func (p *progressReporter) report(percent float64) {
 	if percent > 100 {
 		percent = 100
 	}
+	p.beat.Store(time.Now().UnixNano())
 	p.job.Progress = percent
-	if p.hook != nil {
-		p.hook.OnEvent(Event{Type: EventProgress, Job: p.job})
-	}
+	p.q.persist(p.job)
+	p.q.emit(Event{Type: EventProgress, Job: p.job})
 }
 
 // Config 配置。
 type Config struct {
-	Workers   int       // worker 数量,默认 4
-	QueueSize int       // 内部就绪信号缓冲,默认 1024
-	Hook      EventHook // 事件钩子(nil=不回调)
-	OnPanic   func(job *Job, r any, stack []byte)
+	Workers        int       // worker 数量,默认 4
+	QueueSize      int       // 内部就绪信号缓冲,默认 1024
+	Hook           EventHook // 事件钩子(nil=不回调)
+	OnPanic        func(job *Job, r any, stack []byte)
+	Backend        Backend           // 任务记录持久化,默认 NewMemoryBackend()
+	GroupLimiter   ratelimit.Limiter // 按 Job.Group 限流(nil=不限)
+	StalledTimeout time.Duration     // 执行中无进度 / 心跳多久判定卡死(0=不检测)
+	KeepFinished   time.Duration     // 已结束任务记录的保留时长,默认 1 小时;0 立即删除,<0 永久保留
+	OnError        func(jobID string, err error)
 }
 
 // Option 配置函数。
@@ -206,15 +300,38 @@ func WithPanicHandler(fn func(job *Job, r any, stack []byte)) Option {
 	return func(c *Config) { c.OnPanic = fn }
 }
 
+// WithBackend 设置任务记录的持久化后端(MemoryBackend / FileBackend / contrib/redisqueue.NewJobBackend)。
+// Start 时从中恢复未结束的任务:等待 / 延迟中的照常排队,执行中的视为卡死(EventStalled)重新排队。
+func WithBackend(b Backend) Option { return func(c *Config) { c.Backend = b } }
+
+// WithGroupLimiter 按 Job.Group 限流:出队时以 Group 为 key 调用 l.Allow,超限的任务推迟 retryAfter
+// 后再排队(不计入尝试次数)。例如 ratelimit.NewGCRA(10, 1) 为每组每秒 10 个。
+func WithGroupLimiter(l ratelimit.Limiter) Option { return func(c *Config) { c.GroupLimiter = l } }
+
+// WithStalledTimeout 设置卡死判定:执行中的任务超过 d 没有 ReportProgress / Heartbeat,
+// 其 ctx 以 ErrStalled 取消并触发 EventStalled,按失败处理(可重试)。默认不检测。
+func WithStalledTimeout(d time.Duration) Option { return func(c *Config) { c.StalledTimeout = d } }
+
+// WithKeepFinished 设置已结束任务记录在 Backend 中的保留时长(供查询),默认 1 小时。
+// 0 表示结束即删除,<0 表示永久保留。
+func WithKeepFinished(d time.Duration) Option { return func(c *Config) { c.KeepFinished = d } }
+
+// WithOnError 设置 Backend 读写失败时的回调。默认 slog.Warn。
+func WithOnError(fn func(jobID string, err error)) Option { return func(c *Config) { c.OnError = fn } }
+
 // Queue 带优先级的任务队列。
 type Queue struct {
 	cfg Config
 
-	mu      sync.Mutex
-	pq      *priority.Queue[*Job] // 就绪任务的优先级堆
-	delayed []*Job                // 延迟任务列表(由 ticker 驱动转就绪)
-	byID    map[string]*Job       // ID → Job(用于查询/取消)
-	signal  chan struct{}         // 通知 worker 有新任务就绪
+	mu       sync.Mutex
+	pq       *priority.Queue[*Job]                                // 就绪任务的优先级堆
+	delayed  []*Job                                               // 延迟任务列表(由 ticker 驱动转就绪)
+	byID     map[string]*Job                                      // ID → 未结束的 Job(用于查询/取消/去重)
+	handlers map[string]func(ctx context.Context, job *Job) error // Name → 处理函数
+	repeats  map[string]*repeatEntry                              // 重复任务 key → 系列
+	active   map[string]*progressReporter                         // 执行中的任务
+	signal   chan struct{}                                        // 通知 worker 有新任务就绪
+	seq      atomic.Uint64
 
 	paused    atomic.Bool
 	pauseMu   sync.Mutex
@@ -232,35 +349,53 @@ type Queue struct {
 
 // New 创建任务队列(未启动)。用 Start 启动 worker。
 func New(opts ...Option) *Queue {
-	cfg := Config{Workers: 4, QueueSize: 1024}
+	cfg := Config{Workers: 4, QueueSize: 1024, KeepFinished: time.Hour}
 	for _, o := range opts {
 		o(&cfg)
 	}
 	if cfg.Workers < 1 {
 		cfg.Workers = 1
 	}
+	if cfg.Backend == nil {
+		cfg.Backend = NewMemoryBackend()
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(jobID string, err error) {
+			slog.Warn("jobqueue: backend failed", "job", jobID, "err", err)
+		}
+	}
 	q := &Queue{
-		cfg:    cfg,
-		pq:     priority.New[*Job](func(a, b *Job) bool { return a.Priority < b.Priority }),
-		byID:   make(map[string]*Job),
-		signal: make(chan struct{}, cfg.QueueSize),
-		stopCh: make(chan struct{}),
-		done:   make(chan struct{}),
+		cfg:      cfg,
+		pq:       priority.New[*Job](func(a, b *Job) bool { return a.Priority < b.Priority }),
+		byID:     make(map[string]*Job),
+		handlers: make(map[string]func(ctx context.Context, job *Job) error),
+		repeats:  make(map[string]*repeatEntry),
+		active:   make(map[string]*progressReporter),
+		signal:   make(chan struct{}, cfg.QueueSize),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 	q.pauseCond = sync.NewCond(&q.pauseMu)
 	return q
 }
 
-// Start 启动 worker 池和延迟任务调度器。ctx 取消时优雅停止。满足 beauty.Service。
+// Start 从 Backend 恢复未结束的任务,启动 worker 池和延迟任务调度器。ctx 取消时优雅停止。
+// 恢复失败时停止队列并返回错误。满足 beauty.Service。
 func (q *Queue) Start(ctx context.Context) error {
+	var err error
 	q.startOnce.Do(func() {
+		if err = q.restore(ctx); err != nil {
+			q.Stop()
+			return
+		}
 		q.ctx, q.cancel = context.WithCancel(ctx)
 		for i := 0; i < q.cfg.Workers; i++ {
 			q.wg.Add(1)
 			go q.worker()
 		}
-		q.wg.Add(1)
+		q.wg.Add(2)
 		go q.delayScheduler()
+		go q.janitor()
 		go func() {
 			select {
 			case <-ctx.Done():
@@ -270,7 +405,7 @@ func (q *Queue) Start(ctx context.Context) error {
 		}()
 	})
 	<-q.done
-	return nil
+	return err
 }
 
 // String 满足 beauty.Service。
@@ -278,46 +413,160 @@ func (q *Queue) String() string {
 	return fmt.Sprintf("jobqueue(workers=%d)", q.cfg.Workers)
 }
 
-// Submit 投递一个任务。返回 false 表示队列已停止。
+// Handle 按任务名注册处理函数,供 Fn 为 nil 的任务与从 Backend 恢复的任务使用。同名覆盖。
+// 需要恢复的任务应在 Start 之前注册。
+func (q *Queue) Handle(name string, fn func(ctx context.Context, job *Job) error) {
+	q.mu.Lock()
+	q.handlers[name] = fn
+	q.mu.Unlock()
+}
+
+// Submit 投递一个任务。返回 false 表示投递失败(队列已停止、ID 重复等),需要原因时用 Add。
 func (q *Queue) Submit(job *Job) bool {
+	return q.Add(context.Background(), job) == nil
+}
+
+// Add 投递一个任务并写入 Backend。ID 为空时自动生成。
+// 同 ID 的任务尚未结束返回 ErrExists;队列已停止返回 ErrStopped;没有 Fn 也没有注册处理函数返回 ErrNoHandler。
+// 带 Repeat 的任务见 Repeat;带 Children 的任务先投递自身(waiting-children)再依次投递子任务。
+// 整棵任务树先统一校验,任何一个任务不合法时都不写入任何记录。
+func (q *Queue) Add(ctx context.Context, job *Job) error {
 	if q.stopped.Load() {
-		return false
+		return ErrStopped
+	}
+	if err := q.prepareTree(job); err != nil {
+		return err
+	}
+	if job.Repeat != nil {
+		return q.addRepeat(ctx, job)
+	}
+	return q.add(ctx, job, time.Now().Add(job.Delay))
+}
+
+func (q *Queue) add(ctx context.Context, job *Job, readyAt time.Time) error {
+	if err := q.prepare(job); err != nil {
+		return err
 	}
 	now := time.Now()
 	job.CreatedAt = now
-	job.State = StateWaiting
+	job.readyAt = readyAt
+	job.pending = len(job.Children)
 
-	if job.Delay > 0 {
+	q.mu.Lock()
+	if _, ok := q.byID[job.ID]; ok {
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrExists, job.ID)
+	}
+	switch {
+	case job.pending > 0:
+		job.State = StateWaitingChildren
+	case readyAt.After(now):
 		job.State = StateDelayed
-		job.readyAt = now.Add(job.Delay)
+	default:
+		job.State = StateWaiting
+	}
+	q.byID[job.ID] = job
+	rec := job.record()
+	q.mu.Unlock()
+
+	if err := q.cfg.Backend.Save(ctx, rec); err != nil {
+		q.mu.Lock()
+		delete(q.byID, job.ID)
+		q.mu.Unlock()
+		return err
+	}
+	switch job.State {
+	case StateDelayed:
 		q.mu.Lock()
 		q.delayed = append(q.delayed, job)
-		if job.ID != "" {
-			q.byID[job.ID] = job
-		}
 		q.mu.Unlock()
-	} else {
-		job.readyAt = now
+	case StateWaiting:
 		q.enqueue(job)
 	}
-
 	q.emit(Event{Type: EventSubmit, Job: job})
-	return true
+
+	for i, child := range job.Children {
+		child.Parent = job.ID
+		if err := q.Add(ctx, child); err != nil {
+			// 已投递的子任务与父任务一并取消,父任务不会永远停在 waiting-children
+			for _, added := range job.Children[:i] {
+				q.Cancel(added.ID)
+			}
+			q.Cancel(job.ID)
+			return fmt.Errorf("jobqueue: add child of %s: %w", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// prepareTree 对 job 及其全部子孙任务执行 prepare。
+func (q *Queue) prepareTree(job *Job) error {
+	if err := q.prepare(job); err != nil {
+		return err
+	}
+	for _, child := range job.Children {
+		if err := q.prepareTree(child); err != nil {
+			return fmt.Errorf("jobqueue: child of %s: %w", job.ID, err)
+		}
+	}
+	return nil
 }
 
-// Cancel 取消指定 ID 的任务(仅 Waiting/Delayed 状态可取消)。
+// prepare 校验处理函数、分配 ID,持久化 Backend 下序列化 Payload。
+func (q *Queue) prepare(job *Job) error {
+	if job.Fn == nil && q.handler(job.Name) == nil {
+		return fmt.Errorf("%w: %s", ErrNoHandler, job.Name)
+	}
+	if job.ID == "" {
+		job.ID = strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(q.seq.Add(1), 36)
+	}
+	if _, inMemory := q.cfg.Backend.(*MemoryBackend); inMemory {
+		if raw, ok := job.Payload.(json.RawMessage); ok {
+			job.payload = raw
+		}
+		return nil
+	}
+	if job.Payload != nil && job.payload == nil {
+		if raw, ok := job.Payload.(json.RawMessage); ok {
+			job.payload = raw
+		} else {
+			b, err := json.Marshal(job.Payload)
+			if err != nil {
+				return fmt.Errorf("jobqueue: encode payload of %s: %w", job.ID, err)
+			}
+			job.payload = b
+		}
+	}
+	return nil
+}
+
+func (q *Queue) handler(name string) func(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.handlers[name]
+}
+
+// Cancel 取消指定 ID 的任务(仅 Waiting/Delayed/WaitingChildren 状态可取消)。
+// 取消重复任务当前待执行的一次会结束整个系列;取消子任务会使父任务失败。
 func (q *Queue) Cancel(id string) bool {
 	q.mu.Lock()
 	job, ok := q.byID[id]
-	if ok && (job.State == StateWaiting || job.State == StateDelayed) {
-		delete(q.byID, id)
-		job.State = StateFailed
-		job.Err = context.Canceled
+	if !ok || (job.State != StateWaiting && job.State != StateDelayed && job.State != StateWaitingChildren) {
 		q.mu.Unlock()
-		return true
+		return false
+	}
+	delete(q.byID, id)
+	job.State = StateFailed
+	job.Err = context.Canceled
+	job.CompletedAt = time.Now()
+	if e, ok := q.repeats[job.repeatKey]; ok && e.pending == id {
+		delete(q.repeats, job.repeatKey)
 	}
+	rec := job.record()
 	q.mu.Unlock()
-	return false
+	q.save(rec)
+	q.childDone(job, context.Canceled)
+	return true
 }
 
 // Pause 暂停消费(不影响投递)。
@@ -356,11 +605,7 @@ func (q *Queue) Stop() {
 
 func (q *Queue) enqueue(job *Job) {
 	q.mu.Lock()
-	job.State = StateWaiting
 	q.pq.Push(job)
-	if job.ID != "" {
-		q.byID[job.ID] = job
-	}
 	q.mu.Unlock()
 	select {
 	case q.signal <- struct{}{}:
@@ -376,6 +621,14 @@ func (q *Queue) dequeue() (*Job, bool) {
 		if job.State != StateWaiting {
 			continue // 已取消
 		}
+		if job.Group != "" && q.cfg.GroupLimiter != nil {
+			if ok, wait := q.cfg.GroupLimiter.Allow(job.Group); !ok {
+				job.State = StateDelayed
+				job.readyAt = time.Now().Add(max(wait, time.Millisecond))
+				q.delayed = append(q.delayed, job)
+				continue
+			}
+		}
 		job.State = StateActive
 		return job, true
 	}
@@ -420,17 +673,43 @@ func (q *Queue) waitIfPaused() {
 func (q *Queue) execute(job *Job) {
 	job.Attempts++
 	job.StartedAt = time.Now()
+	fn := job.Fn
+	if fn == nil {
+		fn = q.handler(job.Name)
+	}
+	if job.repeatKey != "" {
+		q.scheduleNext(job)
+	}
+
+	base, cancelCause := context.WithCancelCause(q.ctx)
+	defer cancelCause(nil)
+	rp := &progressReporter{q: q, job: job, cancel: cancelCause}
+	rp.beat.Store(job.StartedAt.UnixNano())
+	q.mu.Lock()
+	q.active[job.ID] = rp
+	q.mu.Unlock()
+	q.persist(job)
 	q.emit(Event{Type: EventStart, Job: job})
 
-	rp := &progressReporter{job: job, hook: q.cfg.Hook}
-	ctx := context.WithValue(q.ctx, progressCtxKey, rp)
+	ctx := context.WithValue(base, progressCtxKey, rp)
 	if job.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
 		defer cancel()
 	}
 
-	err := q.safeExec(ctx, job)
+	var err error
+	if fn == nil {
+		err = fmt.Errorf("%w: %s", ErrNoHandler, job.Name)
+	} else {
+		err = q.safeExec(ctx, job, fn)
+	}
+	if err != nil && errors.Is(context.Cause(base), ErrStalled) {
+		err = ErrStalled
+	}
+	q.mu.Lock()
+	delete(q.active, job.ID)
+	q.mu.Unlock()
 
 	if err != nil {
 		job.Err = err
@@ -444,27 +723,74 @@ func (q *Queue) execute(job *Job) {
 			job.readyAt = time.Now().Add(delay)
 			q.mu.Lock()
 			q.delayed = append(q.delayed, job)
+			rec := job.record()
 			q.mu.Unlock()
+			q.save(rec)
 			return
 		}
 		job.State = StateFailed
 		job.CompletedAt = time.Now()
+		q.finish(job)
 		q.emit(Event{Type: EventFail, Job: job, Err: err})
 	} else {
 		job.State = StateCompleted
 		job.Progress = 100
 		job.CompletedAt = time.Now()
+		q.finish(job)
 		q.emit(Event{Type: EventComplete, Job: job})
 	}
+	q.childDone(job, err)
+}
 
-	if job.ID != "" {
-		q.mu.Lock()
-		delete(q.byID, job.ID)
+// finish 记录已结束的任务并移出内存索引。
+func (q *Queue) finish(job *Job) {
+	q.mu.Lock()
+	delete(q.byID, job.ID)
+	q.mu.Unlock()
+	q.persist(job)
+}
+
+// childDone 在子任务结束时推进父任务:全部成功则父任务就绪,任一失败则父任务失败(并继续向上传递)。
+func (q *Queue) childDone(child *Job, err error) {
+	if child.Parent == "" {
+		return
+	}
+	q.mu.Lock()
+	parent, ok := q.byID[child.Parent]
+	if !ok || parent.State != StateWaitingChildren {
 		q.mu.Unlock()
+		return
+	}
+	ready := false
+	if err != nil {
+		delete(q.byID, parent.ID)
+		parent.State = StateFailed
+		parent.Err = fmt.Errorf("%w: %s: %v", ErrChildFailed, child.ID, err)
+		parent.CompletedAt = time.Now()
+	} else if parent.pending--; parent.pending <= 0 {
+		parent.State = StateWaiting
+		parent.readyAt = time.Now()
+		q.pq.Push(parent)
+		ready = true
+	}
+	rec := parent.record()
+	q.mu.Unlock()
+	q.save(rec)
+
+	if ready {
+		select {
+		case q.signal <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if err != nil {
+		q.emit(Event{Type: EventFail, Job: parent, Err: parent.Err})
+		q.childDone(parent, parent.Err)
 	}
 }
 
-func (q *Queue) safeExec(ctx context.Context, job *Job) (err error) {
+func (q *Queue) safeExec(ctx context.Context, job *Job, fn func(ctx context.Context, job *Job) error) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			stack := debug.Stack()
@@ -474,7 +800,7 @@ func (q *Queue) safeExec(ctx context.Context, job *Job) (err error) {
 			}
 		}
 	}()
-	return job.Fn(ctx, job)
+	return fn(ctx, job)
 }
 
 func (q *Queue) delayScheduler() {
@@ -486,6 +812,7 @@ func (q *Queue) delayScheduler() {
 		case now := <-ticker.C:
 			q.mu.Lock()
 			var remaining []*Job
+			var ready []*Record
 			for _, job := range q.delayed {
 				if job.State == StateFailed || job.State == StateCompleted {
 					continue // 已取消
@@ -493,6 +820,7 @@ func (q *Queue) delayScheduler() {
 				if now.After(job.readyAt) || now.Equal(job.readyAt) {
 					job.State = StateWaiting
 					q.pq.Push(job)
+					ready = append(ready, job.record())
 					select {
 					case q.signal <- struct{}{}:
 					default:
@@ -503,6 +831,9 @@ func (q *Queue) delayScheduler() {
 			}
 			q.delayed = remaining
 			q.mu.Unlock()
+			for _, rec := range ready {
+				q.save(rec)
+			}
 		case <-q.stopCh:
 			return
 		}
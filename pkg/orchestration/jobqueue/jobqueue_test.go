@@ -7,6 +7,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/rushteam/beauty/pkg/resilience/ratelimit"
 )
 
 func TestBasicSubmitAndExecute(t *testing.T) {
@@ -326,3 +328,216 @@ func TestJobTimeout(t *testing.T) {
 		t.Errorf("expected deadline exceeded, got %v", failEvents[0].Err)
 	}
 }
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRepeatEvery(t *testing.T) {
+	var runs atomic.Int32
+	q := New(WithWorkers(1))
+	go q.Start(context.Background())
+	t.Cleanup(q.Stop)
+
+	tmpl := func() *Job {
+		return &Job{
+			ID:     "tick",
+			Name:   "tick",
+			Repeat: &Repeat{Every: 30 * time.Millisecond, Limit: 3},
+			Fn: func(ctx context.Context, job *Job) error {
+				runs.Add(1)
+				return nil
+			},
+		}
+	}
+	if err := q.Add(context.Background(), tmpl()); err != nil {
+		t.Fatal(err)
+	}
+	// 同一 key、同一规则:不产生第二个系列
+	if err := q.Add(context.Background(), tmpl()); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, func() bool { return runs.Load() == 3 })
+	time.Sleep(100 * time.Millisecond)
+	if runs.Load() != 3 {
+		t.Fatalf("runs = %d, want 3", runs.Load())
+	}
+	if q.RemoveRepeat("tick") {
+		t.Fatal("series should have ended after Limit runs")
+	}
+
+	if err := q.Add(context.Background(), &Job{Name: "bad", Repeat: &Repeat{Cron: "not a cron"}, Fn: tmpl().Fn}); err == nil {
+		t.Fatal("invalid cron should fail")
+	}
+}
+
+func TestFlow(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		order = append(order, job.ID)
+		mu.Unlock()
+		if job.Name == "bad" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	var failed atomic.Value
+	q := New(WithWorkers(2), WithHookFunc(func(e Event) {
+		if e.Type == EventFail && e.Job.ID == "report-2" {
+			failed.Store(e.Err)
+		}
+	}))
+	q.Handle("step", record)
+	q.Handle("bad", record)
+	go q.Start(context.Background())
+	t.Cleanup(q.Stop)
+
+	ctx := context.Background()
+	err := q.Add(ctx, &Job{ID: "report", Name: "step", Children: []*Job{
+		{ID: "part-a", Name: "step"},
+		{ID: "part-b", Name: "step", Delay: 30 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := q.Get(ctx, "report"); rec.State != StateWaitingChildren || rec.Pending != 2 {
+		t.Fatalf("parent = %+v", rec)
+	}
+	waitUntil(t, func() bool {
+		rec, _ := q.Get(ctx, "report")
+		return rec.State == StateCompleted
+	})
+	mu.Lock()
+	if len(order) != 3 || order[2] != "report" {
+		t.Fatalf("order = %v", order)
+	}
+	mu.Unlock()
+
+	// 子任务最终失败:父任务以 ErrChildFailed 失败且不执行
+	if err := q.Add(ctx, &Job{ID: "report-2", Name: "step", Children: []*Job{{ID: "part-c", Name: "bad"}}}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, func() bool { return failed.Load() != nil })
+	if err := failed.Load().(error); !errors.Is(err, ErrChildFailed) {
+		t.Fatalf("err = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if order[len(order)-1] != "part-c" {
+		t.Fatalf("order = %v", order)
+	}
+}
+
+func TestGroupLimiter(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	limiter := ratelimit.NewGCRA(20, 1)
+	t.Cleanup(limiter.Stop)
+	q := New(WithWorkers(4), WithGroupLimiter(limiter))
+	q.Handle("call", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return nil
+	})
+	go q.Start(context.Background())
+	t.Cleanup(q.Stop)
+
+	for range 3 {
+		if err := q.Add(context.Background(), &Job{Name: "call", Group: "tenant-1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(times) == 3
+	})
+	// 每组每秒 20 个:3 个任务至少跨越 2 个间隔(100ms)
+	if d := times[2].Sub(times[0]); d < 90*time.Millisecond {
+		t.Fatalf("group not limited: spread = %v", d)
+	}
+}
+
+func TestStalledJob(t *testing.T) {
+	var stalled atomic.Int32
+	var attempts atomic.Int32
+	q := New(WithWorkers(1), WithStalledTimeout(40*time.Millisecond), WithHookFunc(func(e Event) {
+		if e.Type == EventStalled {
+			stalled.Add(1)
+		}
+	}))
+	go q.Start(context.Background())
+	t.Cleanup(q.Stop)
+
+	q.Submit(&Job{
+		ID:         "hang",
+		Name:       "hang",
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+		Fn: func(ctx context.Context, job *Job) error {
+			if attempts.Add(1) == 1 {
+				<-ctx.Done() // 第一次卡住且不发心跳
+				return ctx.Err()
+			}
+			for range 4 { // 第二次持续心跳,不会被判定卡死
+				time.Sleep(20 * time.Millisecond)
+				Heartbeat(ctx)
+			}
+			return nil
+		},
+	})
+	waitUntil(t, func() bool {
+		rec, _ := q.Get(context.Background(), "hang")
+		return rec != nil && rec.State == StateCompleted
+	})
+	if stalled.Load() != 1 || attempts.Load() != 2 {
+		t.Fatalf("stalled = %d, attempts = %d", stalled.Load(), attempts.Load())
+	}
+}
+
+func TestAddInMemoryPayloadAndInvalidTree(t *testing.T) {
+	got := make(chan int, 1)
+	q := New(WithWorkers(1))
+	q.Handle("step", func(ctx context.Context, job *Job) error { return nil })
+	go q.Start(context.Background())
+	t.Cleanup(q.Stop)
+
+	// MemoryBackend 下 Payload 不经 JSON 序列化,channel 也能原样交给 Fn
+	ctx := context.Background()
+	err := q.Add(ctx, &Job{ID: "chan", Payload: got, Fn: func(ctx context.Context, job *Job) error {
+		job.Payload.(chan int) <- 1
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("job was not executed")
+	}
+
+	// 子任务没有处理函数:整棵树都不写入
+	err = q.Add(ctx, &Job{ID: "tree", Name: "step", Children: []*Job{
+		{ID: "ok", Name: "step"},
+		{ID: "missing", Name: "unknown"},
+	}})
+	if !errors.Is(err, ErrNoHandler) {
+		t.Fatalf("err = %v", err)
+	}
+	for _, id := range []string{"tree", "ok", "missing"} {
+		if rec, _ := q.Get(ctx, id); rec != nil {
+			t.Fatalf("%s was written: %+v", id, rec)
+		}
+	}
+}
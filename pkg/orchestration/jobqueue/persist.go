@@ -0,0 +1,249 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/pagination"
+)
+
+func (j *Job) record() *Record {
+	rec := &Record{
+		ID:          j.ID,
+		Name:        j.Name,
+		Group:       j.Group,
+		Priority:    j.Priority,
+		Payload:     j.payload,
+		MaxRetries:  j.MaxRetries,
+		RetryDelay:  j.RetryDelay,
+		Timeout:     j.Timeout,
+		Repeat:      j.Repeat,
+		RepeatKey:   j.repeatKey,
+		RepeatCount: j.repeatCount,
+		Parent:      j.Parent,
+		Pending:     j.pending,
+		State:       j.State,
+		Attempts:    j.Attempts,
+		Progress:    j.Progress,
+		CreatedAt:   j.CreatedAt,
+		ReadyAt:     j.readyAt,
+		StartedAt:   j.StartedAt,
+		CompletedAt: j.CompletedAt,
+	}
+	if j.payload == nil {
+		rec.value = j.Payload
+	}
+	if j.Err != nil {
+		rec.Error = j.Err.Error()
+	}
+	return rec
+}
+
+// job 由记录重建任务(Fn 为空,执行时按 Name 查找处理函数)。
+func (rec *Record) job() *Job {
+	j := &Job{
+		ID:          rec.ID,
+		Name:        rec.Name,
+		Group:       rec.Group,
+		Priority:    rec.Priority,
+		MaxRetries:  rec.MaxRetries,
+		RetryDelay:  rec.RetryDelay,
+		Timeout:     rec.Timeout,
+		Repeat:      rec.Repeat,
+		Parent:      rec.Parent,
+		State:       rec.State,
+		Attempts:    rec.Attempts,
+		Progress:    rec.Progress,
+		CreatedAt:   rec.CreatedAt,
+		StartedAt:   rec.StartedAt,
+		CompletedAt: rec.CompletedAt,
+		readyAt:     rec.ReadyAt,
+		payload:     rec.Payload,
+		repeatKey:   rec.RepeatKey,
+		repeatCount: rec.RepeatCount,
+	}
+	if rec.Payload != nil {
+		j.Payload = rec.Payload
+	} else {
+		j.Payload = rec.value
+	}
+	if rec.Error != "" {
+		j.Err = errors.New(rec.Error)
+	}
+	return j
+}
+
+// persist 把任务当前快照写入 Backend。调用方须是该任务状态的持有者(执行它的 worker 等)。
+func (q *Queue) persist(job *Job) { q.save(job.record()) }
+
+func (q *Queue) save(rec *Record) {
+	ctx := context.Background()
+	var err error
+	if rec.State.Finished() && q.cfg.KeepFinished == 0 {
+		err = q.cfg.Backend.Delete(ctx, rec.ID)
+	} else {
+		err = q.cfg.Backend.Save(ctx, rec)
+	}
+	if err != nil {
+		q.cfg.OnError(rec.ID, err)
+	}
+}
+
+// restore 从 Backend 恢复未结束的任务。执行中的任务(进程崩溃时正在跑)视为卡死,重新排队
+// (at-least-once:处理函数须幂等)。父任务的未完成子任务数按恢复出的子任务重新计算。
+// 重复任务在 Start 之前已被重新 Add 时,以 Add 投递的那一次为准,持久化的尚未开始的一次被丢弃,
+// 同一时刻不会执行两次。
+func (q *Queue) restore(ctx context.Context) error {
+	recs, err := q.cfg.Backend.List(ctx, Filter{States: []JobState{StateWaiting, StateDelayed, StateActive, StateWaitingChildren}})
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]int)
+	for _, rec := range recs {
+		if rec.Parent != "" {
+			pending[rec.Parent]++
+		}
+	}
+	var stalled, dropped []*Job
+	q.mu.Lock()
+	live := make(map[string]bool, len(q.repeats)) // Start 之前 Add 的重复任务系列
+	for key := range q.repeats {
+		live[key] = true
+	}
+	for _, rec := range recs {
+		if _, ok := q.byID[rec.ID]; ok {
+			continue // Start 之前已重新投递
+		}
+		job := rec.job()
+		if live[job.repeatKey] && job.State != StateActive {
+			dropped = append(dropped, job)
+			continue
+		}
+		if job.State == StateActive {
+			job.State, job.Err = StateWaiting, ErrStalled
+			stalled = append(stalled, job)
+		}
+		if job.State == StateWaitingChildren {
+			if job.pending = pending[job.ID]; job.pending == 0 {
+				job.State = StateWaiting
+			}
+		}
+		if job.repeatKey != "" && job.Repeat != nil {
+			if e, ok := q.repeats[job.repeatKey]; !ok || job.readyAt.After(e.readyAt) {
+				q.repeats[job.repeatKey] = &repeatEntry{spec: *job.Repeat, pending: job.ID, readyAt: job.readyAt}
+			}
+		}
+		q.byID[job.ID] = job
+		switch job.State {
+		case StateDelayed:
+			q.delayed = append(q.delayed, job)
+		case StateWaiting:
+			q.pq.Push(job)
+			select {
+			case q.signal <- struct{}{}:
+			default:
+			}
+		}
+	}
+	q.mu.Unlock()
+	for _, job := range dropped {
+		if err := q.cfg.Backend.Delete(ctx, job.ID); err != nil {
+			q.cfg.OnError(job.ID, err)
+		}
+	}
+	for _, job := range stalled {
+		q.persist(job)
+		q.emit(Event{Type: EventStalled, Job: job, Err: ErrStalled})
+	}
+	return nil
+}
+
+// janitor 周期检测卡死任务并清理过期的已结束记录。
+func (q *Queue) janitor() {
+	defer q.wg.Done()
+	interval := time.Second
+	if d := q.cfg.StalledTimeout / 2; d > 0 && d < interval {
+		interval = d
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var cleaned time.Time
+	for {
+		select {
+		case now := <-ticker.C:
+			q.checkStalled(now)
+			if keep := q.cfg.KeepFinished; keep > 0 && now.Sub(cleaned) >= max(keep/4, time.Second) {
+				cleaned = now
+				q.clean(now.Add(-keep))
+			}
+		case <-q.stopCh:
+			return
+		}
+	}
+}
+
+func (q *Queue) checkStalled(now time.Time) {
+	if q.cfg.StalledTimeout <= 0 {
+		return
+	}
+	var stalled []*progressReporter
+	q.mu.Lock()
+	for _, rp := range q.active {
+		if now.Sub(time.Unix(0, rp.beat.Load())) > q.cfg.StalledTimeout && rp.stalled.CompareAndSwap(false, true) {
+			stalled = append(stalled, rp)
+		}
+	}
+	q.mu.Unlock()
+	for _, rp := range stalled {
+		q.emit(Event{Type: EventStalled, Job: rp.job, Err: ErrStalled})
+		rp.cancel(ErrStalled)
+	}
+}
+
+func (q *Queue) clean(before time.Time) {
+	ctx := context.Background()
+	recs, err := q.cfg.Backend.List(ctx, Filter{States: []JobState{StateCompleted, StateFailed}, FinishedBefore: before})
+	if err != nil {
+		q.cfg.OnError("", err)
+		return
+	}
+	for _, rec := range recs {
+		if err := q.cfg.Backend.Delete(ctx, rec.ID); err != nil {
+			q.cfg.OnError(rec.ID, err)
+		}
+	}
+}
+
+// Get 返回任务记录(含尚未清理的已结束任务);不存在返回 ErrNotFound。
+func (q *Queue) Get(ctx context.Context, id string) (*Record, error) {
+	return q.cfg.Backend.Get(ctx, id)
+}
+
+type jobCursor struct {
+	CreatedAt int64  `json:"c"`
+	ID        string `json:"i"`
+}
+
+// Jobs 按 (CreatedAt, ID) 升序分页列出处于 states 的任务(为空表示全部),供 dashboard 使用。
+// cursor 为上一页的 Page.Next(首页传空);limit <= 0 表示不分页。
+func (q *Queue) Jobs(ctx context.Context, cursor string, limit int, states ...JobState) (pagination.Page[*Record], error) {
+	cur, ok, err := pagination.Decode[jobCursor](cursor)
+	if err != nil {
+		return pagination.Page[*Record]{}, err
+	}
+	f := Filter{States: states}
+	if ok {
+		f.AfterCreated, f.AfterID = time.Unix(0, cur.CreatedAt), cur.ID
+	}
+	if limit > 0 {
+		f.Limit = limit + 1
+	}
+	recs, err := q.cfg.Backend.List(ctx, f)
+	if err != nil {
+		return pagination.Page[*Record]{}, err
+	}
+	return pagination.Build(recs, limit, func(r *Record) jobCursor {
+		return jobCursor{CreatedAt: r.CreatedAt.UnixNano(), ID: r.ID}
+	})
+}
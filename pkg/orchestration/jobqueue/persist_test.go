@@ -0,0 +1,194 @@
+package jobqueue
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestoreFromFileBackend(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.wal")
+	type email struct{ To string }
+
+	// 第一个进程:投递后未执行即停止;另有一条崩溃时正在执行的记录
+	fb, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q1 := New(WithBackend(fb))
+	q1.Handle("email", func(context.Context, *Job) error { return nil })
+	if err := q1.Add(ctx, &Job{ID: "e-1", Name: "email", Payload: email{To: "a@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q1.Add(ctx, &Job{ID: "e-2", Name: "email", Payload: email{To: "b@example.com"}, Delay: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := fb.Save(ctx, &Record{ID: "e-3", Name: "email", State: StateActive, Attempts: 1, CreatedAt: now, ReadyAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	q1.Stop()
+	if err := fb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启:三条都恢复并执行,执行中的那条报 EventStalled
+	fb, err = OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+	var done, stalled atomic.Int32
+	q2 := New(WithBackend(fb), WithKeepFinished(-1), WithHookFunc(func(e Event) {
+		if e.Type == EventStalled {
+			stalled.Add(1)
+		}
+	}))
+	q2.Handle("email", func(ctx context.Context, job *Job) error {
+		var m email
+		if job.ID != "e-3" {
+			if err := job.Decode(&m); err != nil || m.To == "" {
+				t.Errorf("decode %s: %+v, %v", job.ID, m, err)
+			}
+		}
+		done.Add(1)
+		return nil
+	})
+	go q2.Start(ctx)
+	t.Cleanup(q2.Stop)
+	waitUntil(t, func() bool { return done.Load() == 3 })
+	if stalled.Load() != 1 {
+		t.Fatalf("stalled = %d", stalled.Load())
+	}
+	if rec, err := fb.Get(ctx, "e-3"); err != nil || rec.State != StateCompleted || rec.Attempts != 2 {
+		t.Fatalf("e-3 = %+v, err = %v", rec, err)
+	}
+}
+
+func TestFileBackendCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.wal")
+	fb, err := OpenFileBackend(path, WithCompactThreshold(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := range 20 {
+		rec := &Record{ID: string(rune('a' + i%4)), Name: "n", Attempts: i, CreatedAt: now}
+		if err := fb.Save(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fb.Delete(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	fb.Close()
+
+	fb, err = OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+	recs, _ := fb.List(ctx, Filter{})
+	if len(recs) != 3 || recs[0].ID != "a" || recs[0].Attempts != 16 {
+		t.Fatalf("records = %+v", recs)
+	}
+	if fb.lines > 8 {
+		t.Fatalf("log not compacted: %d lines", fb.lines)
+	}
+}
+
+func TestJobsPagination(t *testing.T) {
+	ctx := context.Background()
+	q := New(WithKeepFinished(-1))
+	q.Handle("noop", func(context.Context, *Job) error { return nil })
+	q.Pause()
+	for range 5 {
+		if err := q.Add(ctx, &Job{Name: "noop"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Add(ctx, &Job{ID: "later", Name: "noop", Delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := q.Jobs(ctx, cursor, 2, StateWaiting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range page.Items {
+			ids = append(ids, rec.ID)
+		}
+		if cursor = page.Next; cursor == "" {
+			if pages != 2 {
+				t.Fatalf("pages = %d", pages+1)
+			}
+			break
+		}
+	}
+	if len(ids) != 5 {
+		t.Fatalf("ids = %v", ids)
+	}
+	if page, _ := q.Jobs(ctx, "", 0, StateDelayed); len(page.Items) != 1 || page.Items[0].ID != "later" {
+		t.Fatalf("delayed = %+v", page.Items)
+	}
+	if _, err := q.Get(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+// TestRestoreRepeatAddedBeforeStart:重启后在 Start 之前重新 Add 同一重复任务,持久化的那一次被丢弃,不会重复执行。
+func TestRestoreRepeatAddedBeforeStart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.wal")
+	tmpl := func() *Job {
+		return &Job{ID: "tick", Name: "tick", Repeat: &Repeat{Every: 50 * time.Millisecond}}
+	}
+
+	fb, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q1 := New(WithBackend(fb))
+	q1.Handle("tick", func(context.Context, *Job) error { return nil })
+	if err := q1.Add(ctx, tmpl()); err != nil {
+		t.Fatal(err)
+	}
+	q1.Stop()
+	if err := fb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err = OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+	var runs atomic.Int32
+	q2 := New(WithBackend(fb))
+	q2.Handle("tick", func(context.Context, *Job) error { runs.Add(1); return nil })
+	time.Sleep(5 * time.Millisecond) // 与持久化的那一次错开执行时刻
+	if err := q2.Add(ctx, tmpl()); err != nil {
+		t.Fatal(err)
+	}
+	go q2.Start(ctx)
+	t.Cleanup(q2.Stop)
+	waitUntil(t, func() bool { return runs.Load() >= 1 })
+	time.Sleep(20 * time.Millisecond) // 不到下一次的间隔
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("runs = %d, want 1", n)
+	}
+	recs, err := fb.List(ctx, Filter{States: []JobState{StateWaiting, StateDelayed, StateActive}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("pending occurrences = %d, want 1", len(recs))
+	}
+}
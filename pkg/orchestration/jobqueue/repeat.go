@@ -0,0 +1,148 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Repeat 描述重复任务,Cron 与 Every 二选一。
+//
+// 带 Repeat 的 Job 是模板:Add 按规则算出下一次执行时刻,投递一个 ID 为 "{key}:{unix 毫秒}" 的
+// 延迟任务;每次开始执行时投递下一次(错过的时刻直接跳过,不补跑)。key 为模板的 ID,为空时由
+// Name 与规则生成。同一 key 重复 Add 相同规则是幂等的;规则不同则替换原系列。
+// 用 RemoveRepeat 停止系列。
+type Repeat struct {
+	Cron  string        `json:"cron,omitempty"`  // 标准 5 段 cron 表达式,或 @hourly / @every 1m 等描述符
+	Every time.Duration `json:"every,omitempty"` // 固定间隔(首次在 Add 之后 Every)
+	Limit int           `json:"limit,omitempty"` // 最多执行次数,0 表示不限
+}
+
+func (r *Repeat) spec() string {
+	if r.Cron != "" {
+		return r.Cron
+	}
+	return "@every " + r.Every.String()
+}
+
+// next 返回 after 之后的下一次执行时刻。
+func (r *Repeat) next(after time.Time) (time.Time, error) {
+	switch {
+	case r.Cron != "":
+		s, err := cron.ParseStandard(r.Cron)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("jobqueue: repeat cron %q: %w", r.Cron, err)
+		}
+		return s.Next(after), nil
+	case r.Every > 0:
+		return after.Add(r.Every), nil
+	default:
+		return time.Time{}, errors.New("jobqueue: repeat needs Cron or Every")
+	}
+}
+
+type repeatEntry struct {
+	spec    Repeat
+	pending string    // 当前待执行一次的任务 ID
+	readyAt time.Time // 其执行时刻
+}
+
+func (q *Queue) addRepeat(ctx context.Context, tmpl *Job) error {
+	r := *tmpl.Repeat
+	at, err := r.next(time.Now())
+	if err != nil {
+		return err
+	}
+	key := tmpl.ID
+	if key == "" {
+		key = tmpl.Name + "@" + r.spec()
+	}
+	q.mu.Lock()
+	old, ok := q.repeats[key]
+	q.mu.Unlock()
+	if ok {
+		if old.spec == r {
+			return nil // 同一系列已存在
+		}
+		q.RemoveRepeat(key)
+	}
+	occ := occurrence(tmpl, key, 1, at)
+	q.mu.Lock()
+	q.repeats[key] = &repeatEntry{spec: r, pending: occ.ID, readyAt: at}
+	q.mu.Unlock()
+	if err := q.add(ctx, occ, at); err != nil {
+		q.mu.Lock()
+		delete(q.repeats, key)
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RemoveRepeat 停止 key 对应的重复任务,并取消尚未开始的下一次。返回系列是否存在。
+func (q *Queue) RemoveRepeat(key string) bool {
+	q.mu.Lock()
+	e, ok := q.repeats[key]
+	delete(q.repeats, key)
+	q.mu.Unlock()
+	if ok {
+		q.Cancel(e.pending)
+	}
+	return ok
+}
+
+// scheduleNext 在重复任务的一次开始执行时投递下一次。
+func (q *Queue) scheduleNext(job *Job) {
+	q.mu.Lock()
+	e, ok := q.repeats[job.repeatKey]
+	if !ok || e.pending != job.ID {
+		q.mu.Unlock()
+		return
+	}
+	if e.spec.Limit > 0 && job.repeatCount >= e.spec.Limit {
+		delete(q.repeats, job.repeatKey)
+		q.mu.Unlock()
+		return
+	}
+	spec := e.spec
+	q.mu.Unlock()
+
+	at, err := spec.next(job.readyAt)
+	if err == nil && at.Before(time.Now()) {
+		at, err = spec.next(time.Now()) // 跳过错过的时刻
+	}
+	if err != nil {
+		q.cfg.OnError(job.ID, err)
+		return
+	}
+	occ := occurrence(job, job.repeatKey, job.repeatCount+1, at)
+	q.mu.Lock()
+	e.pending, e.readyAt = occ.ID, at
+	q.mu.Unlock()
+	if err := q.add(context.Background(), occ, at); err != nil {
+		q.cfg.OnError(occ.ID, err)
+	}
+}
+
+// occurrence 由模板(或上一次)生成重复任务的一次。
+func occurrence(tmpl *Job, key string, n int, at time.Time) *Job {
+	return &Job{
+		ID:          key + ":" + strconv.FormatInt(at.UnixMilli(), 10),
+		Name:        tmpl.Name,
+		Priority:    tmpl.Priority,
+		Payload:     tmpl.Payload,
+		Fn:          tmpl.Fn,
+		MaxRetries:  tmpl.MaxRetries,
+		RetryDelay:  tmpl.RetryDelay,
+		Timeout:     tmpl.Timeout,
+		Group:       tmpl.Group,
+		Repeat:      tmpl.Repeat,
+		payload:     tmpl.payload,
+		repeatKey:   key,
+		repeatCount: n,
+	}
+}
@@ -0,0 +1,379 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/safe"
+)
+
+var (
+	// ErrUnknownDefinition 实例的定义名未注册到 Coordinator。
+	ErrUnknownDefinition = errors.New("saga: unknown definition")
+	// ErrDefinitionMismatch 已注册的 Saga 与持久化实例的步骤(数量或名称)不一致,
+	// 通常是发布时改了步骤而旧实例尚未完成。
+	ErrDefinitionMismatch = errors.New("saga: definition does not match persisted instance")
+	// ErrInProgress 实例尚在执行中(本进程或其它协调器)。
+	ErrInProgress = errors.New("saga: instance in progress")
+	// ErrNotStuck 实例不处于 compensation_failed,不能重试补偿或标记解决。
+	ErrNotStuck = errors.New("saga: instance is not in compensation_failed")
+)
+
+// Coordinator 是持久化的 saga 执行器:每个实例的执行日志在每步前后写入 Store,
+// 进程崩溃后由(任意一个)Coordinator 从最后落盘的步骤继续。
+//
+// 恢复语义:
+//   - 正向阶段:已完成(done)的步骤不再执行;崩溃时正在执行(running)的步骤会被重跑,
+//     因此 Action 须幂等(推荐用 InstanceID(ctx) + 步骤名作幂等键);
+//   - 补偿阶段:已补偿的步骤跳过,其余已完成步骤继续逆序补偿;
+//   - 停滞判定:状态为 running / compensating 且超过 WithStaleAfter 未更新。
+//     该值须大于最长单步耗时,否则仍在执行的实例会被其它协调器接管(Store 的版本校验
+//     使其中一方在下次落盘时以 ErrConflict 中止,但该步骤可能已执行两次)。
+//
+// 零值不可用,用 NewCoordinator 构造。并发安全;满足 beauty.Service。
+type Coordinator struct {
+	store      Store
+	staleAfter time.Duration
+	interval   time.Duration
+	onError    func(id string, err error)
+
+	mu     sync.Mutex
+	sagas  map[string]*Saga
+	active map[string]struct{} // 本进程正在推进的实例
+}
+
+// CoordinatorOption 配置 Coordinator。
+type CoordinatorOption func(*Coordinator)
+
+// WithStaleAfter 设置实例多久未更新视为停滞(可被恢复),默认 1 分钟。
+func WithStaleAfter(d time.Duration) CoordinatorOption {
+	return func(c *Coordinator) { c.staleAfter = d }
+}
+
+// WithRecoverInterval 设置 Start 后周期恢复的间隔,默认 30 秒。
+func WithRecoverInterval(d time.Duration) CoordinatorOption {
+	return func(c *Coordinator) { c.interval = d }
+}
+
+// WithOnError 设置后台恢复出错时的回调(id 为相关实例,扫描失败时为空)。默认 slog.Warn。
+func WithOnError(fn func(id string, err error)) CoordinatorOption {
+	return func(c *Coordinator) { c.onError = fn }
+}
+
+// NewCoordinator 创建基于 store 的 Coordinator。
+func NewCoordinator(store Store, opts ...CoordinatorOption) *Coordinator {
+	c := &Coordinator{
+		store:      store,
+		staleAfter: time.Minute,
+		interval:   30 * time.Second,
+		sagas:      make(map[string]*Saga),
+		active:     make(map[string]struct{}),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.onError == nil {
+		c.onError = func(id string, err error) {
+			slog.Warn("saga: recover failed", "id", id, "err", err)
+		}
+	}
+	return c
+}
+
+// Register 注册 Saga 定义(按 New 时的 name),同名覆盖。须在 Execute / Start 前完成,
+// 且每个进程都要注册全部定义,才能恢复其它进程留下的实例。
+func (c *Coordinator) Register(sagas ...*Saga) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range sagas {
+		c.sagas[s.name] = s
+	}
+}
+
+// Execute 以 id 为实例 ID 持久化执行 definition。input 以 JSON 保存,步骤内用 Input 读取。
+//
+// id 是幂等键:已存在且已终结的实例直接返回其 Result,不会重复执行;
+// 已存在但未终结的返回 ErrInProgress(交给恢复流程)。
+// 持久化失败返回 error,此时实例停在最后落盘的状态,由恢复流程继续。
+func (c *Coordinator) Execute(ctx context.Context, definition, id string, input any) (*Result, error) {
+	s, err := c.definition(definition)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if input != nil {
+		if raw, err = json.Marshal(input); err != nil {
+			return nil, err
+		}
+	}
+	if !c.acquire(id) {
+		return nil, ErrInProgress
+	}
+	defer c.release(id)
+	inst := s.newInstance(id, raw)
+	if err := c.store.Create(ctx, inst); errors.Is(err, ErrExists) {
+		cur, err := c.store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if cur.State.Terminal() {
+			return cur.Result(), nil
+		}
+		return nil, ErrInProgress
+	} else if err != nil {
+		return nil, err
+	}
+	return c.drive(ctx, s, inst)
+}
+
+// Resume 立即推进实例 id(不论是否停滞),返回其 Result。已终结的实例直接返回 Result。
+func (c *Coordinator) Resume(ctx context.Context, id string) (*Result, error) {
+	inst, err := c.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inst.State.Terminal() {
+		return inst.Result(), nil
+	}
+	return c.resume(ctx, inst)
+}
+
+// Recover 扫描停滞的实例并逐个恢复,返回恢复到终态的实例数。
+// 单个实例的失败经 WithOnError 上报,不中断扫描。
+func (c *Coordinator) Recover(ctx context.Context) (int, error) {
+	list, err := c.store.List(ctx, Filter{
+		States:        []State{StateRunning, StateCompensating},
+		UpdatedBefore: time.Now().Add(-c.staleAfter),
+	})
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, inst := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		// 恢复出的实例不受调用方取消影响:停机只应推迟恢复,不应触发补偿。
+		if _, err := c.resume(context.WithoutCancel(ctx), inst); err != nil {
+			if !errors.Is(err, ErrInProgress) && !errors.Is(err, ErrConflict) {
+				c.onError(inst.ID, err)
+			}
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Start 立即执行一次 Recover,之后按 WithRecoverInterval 周期执行,直到 ctx 取消。满足 beauty.Service。
+func (c *Coordinator) Start(ctx context.Context) error {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		if _, err := c.Recover(ctx); err != nil && ctx.Err() == nil {
+			c.onError("", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// String 满足 beauty.Service。
+func (c *Coordinator) String() string { return "saga-coordinator" }
+
+// Get 读取实例 id 的持久化状态。
+func (c *Coordinator) Get(ctx context.Context, id string) (*Instance, error) {
+	return c.store.Get(ctx, id)
+}
+
+// Stuck 列出补偿失败且尚未人工解决的实例(数据不一致,须人工介入)。
+func (c *Coordinator) Stuck(ctx context.Context) ([]*Instance, error) {
+	list, err := c.store.List(ctx, Filter{States: []State{StateCompensationFailed}})
+	if err != nil {
+		return nil, err
+	}
+	out := list[:0]
+	for _, inst := range list {
+		if !inst.Resolved {
+			out = append(out, inst)
+		}
+	}
+	return out, nil
+}
+
+// RetryCompensation 重新补偿 compensation_failed 实例中补偿失败的步骤(修复下游后调用)。
+func (c *Coordinator) RetryCompensation(ctx context.Context, id string) (*Result, error) {
+	inst, err := c.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inst.State != StateCompensationFailed {
+		return nil, ErrNotStuck
+	}
+	inst.State, inst.Resolved, inst.Note = StateCompensating, false, ""
+	return c.resume(ctx, inst)
+}
+
+// Resolve 把 compensation_failed 实例标记为已人工处理,之后不再出现在 Stuck 中。
+func (c *Coordinator) Resolve(ctx context.Context, id, note string) error {
+	inst, err := c.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inst.State != StateCompensationFailed {
+		return ErrNotStuck
+	}
+	inst.Resolved, inst.Note = true, note
+	return c.save(ctx, inst)
+}
+
+func (c *Coordinator) definition(name string) (*Saga, error) {
+	c.mu.Lock()
+	s, ok := c.sagas[name]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDefinition, name)
+	}
+	return s, nil
+}
+
+func (c *Coordinator) acquire(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.active[id]; ok {
+		return false
+	}
+	c.active[id] = struct{}{}
+	return true
+}
+
+func (c *Coordinator) release(id string) {
+	c.mu.Lock()
+	delete(c.active, id)
+	c.mu.Unlock()
+}
+
+// resume 接管并推进已持久化的实例:先落盘一次认领(版本校验挡住并发接管),再继续执行。
+func (c *Coordinator) resume(ctx context.Context, inst *Instance) (*Result, error) {
+	s, err := c.definition(inst.Definition)
+	if err != nil {
+		return nil, err
+	}
+	if !s.matches(inst) {
+		return nil, ErrDefinitionMismatch
+	}
+	if !c.acquire(inst.ID) {
+		return nil, ErrInProgress
+	}
+	defer c.release(inst.ID)
+	if err := c.save(ctx, inst); err != nil {
+		return nil, err
+	}
+	return c.drive(ctx, s, inst)
+}
+
+func (c *Coordinator) save(ctx context.Context, inst *Instance) error {
+	inst.UpdatedAt = time.Now()
+	return c.store.Update(context.WithoutCancel(ctx), inst)
+}
+
+// drive 从实例当前状态推进到终态,每步前后落盘;落盘失败即中止(留给恢复流程)。
+func (c *Coordinator) drive(ctx context.Context, s *Saga, inst *Instance) (*Result, error) {
+	rt := &runtime{inst: inst}
+	if inst.State == StateRunning {
+		for i := inst.Step; i < len(s.steps); i++ {
+			rec := &inst.Steps[i]
+			step := s.steps[i]
+			if err := ctx.Err(); err != nil {
+				rec.State, rec.Error = StepFailed, err.Error()
+				inst.Error = fmt.Sprintf("saga %q: context done before step %q: %v", s.name, step.Name, err)
+				inst.FailedStep, inst.State = step.Name, StateCompensating
+				break
+			}
+			rec.State = StepRunning
+			if err := c.save(ctx, inst); err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			err := safe.Run(func() error { return step.Action(rt.stepContext(ctx, i)) })
+			rec.Duration = time.Since(start)
+			if err != nil {
+				rec.State, rec.Error = StepFailed, err.Error()
+				inst.Error = fmt.Sprintf("saga %q: step %q action failed: %v", s.name, step.Name, err)
+				inst.FailedStep, inst.State = step.Name, StateCompensating
+				break
+			}
+			rt.commitOutput(i)
+			rec.State, inst.Step = StepDone, i+1
+			if inst.Step == len(s.steps) {
+				inst.State = StateCommitted
+			}
+			if err := c.save(ctx, inst); err != nil {
+				return nil, err
+			}
+		}
+		if inst.State == StateRunning { // 没有步骤
+			inst.State = StateCommitted
+			if err := c.save(ctx, inst); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if inst.State == StateCompensating {
+		if err := c.compensate(ctx, s, rt); err != nil {
+			return nil, err
+		}
+	}
+	return inst.Result(), nil
+}
+
+// compensate 逆序补偿已完成(或上次补偿失败)的步骤,每步补偿后落盘。
+func (c *Coordinator) compensate(ctx context.Context, s *Saga, rt *runtime) error {
+	inst := rt.inst
+	compCtx := context.WithoutCancel(ctx)
+	if err := c.save(ctx, inst); err != nil { // 先落盘 compensating + 失败原因
+		return err
+	}
+	final := StateCompensated
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		rec := &inst.Steps[i]
+		step := s.steps[i]
+		if step.Compensate == nil || (rec.State != StepDone && rec.State != StepCompensationFailed) {
+			continue
+		}
+		tried, err := s.compensateStep(rt.stepContext(compCtx, i), step)
+		rec.Attempts += tried
+		if err != nil {
+			rec.State, rec.Error = StepCompensationFailed, err.Error()
+			final = StateCompensationFailed
+		} else {
+			rec.State, rec.Error = StepCompensated, ""
+		}
+		if err := c.save(ctx, inst); err != nil {
+			return err
+		}
+	}
+	inst.State = final
+	return c.save(ctx, inst)
+}
+
+// matches 报告 s 的步骤与实例记录是否一致。
+func (s *Saga) matches(inst *Instance) bool {
+	if len(s.steps) != len(inst.Steps) {
+		return false
+	}
+	for i, step := range s.steps {
+		if step.Name != inst.Steps[i].Name {
+			return false
+		}
+	}
+	return true
+}
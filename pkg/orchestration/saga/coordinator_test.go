@@ -0,0 +1,212 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rushteam/beauty/pkg/orchestration/saga"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// crashStore 在第 n 次 Update 时失败,模拟协调器进程在该次落盘前崩溃。
+type crashStore struct {
+	saga.Store
+	n int
+}
+
+func (s *crashStore) Update(ctx context.Context, inst *saga.Instance) error {
+	if s.n--; s.n == 0 {
+		return errors.New("crash")
+	}
+	return s.Store.Update(ctx, inst)
+}
+
+type order struct {
+	Amount int `json:"amount"`
+}
+
+// newOrderSaga:reserve(输出预留号) → charge(金额 > limit 失败) → ship。
+func newOrderSaga(limit int, calls map[string]int) *saga.Saga {
+	return saga.New("order").
+		Step("reserve", func(ctx context.Context) error {
+			calls["reserve"]++
+			return saga.SetOutput(ctx, "rsv-"+saga.InstanceID(ctx))
+		}, func(ctx context.Context) error {
+			var rsv string
+			if ok, err := saga.Output(ctx, "reserve", &rsv); !ok || err != nil || rsv == "" {
+				return errors.New("missing reservation")
+			}
+			calls["release"]++
+			return nil
+		}).
+		Step("charge", func(ctx context.Context) error {
+			calls["charge"]++
+			var o order
+			if err := saga.Input(ctx, &o); err != nil {
+				return err
+			}
+			if o.Amount > limit {
+				return errors.New("declined")
+			}
+			return nil
+		}, nil).
+		Step("ship", func(context.Context) error { calls["ship"]++; return nil }, nil)
+}
+
+func TestCoordinator_ResumeForward(t *testing.T) {
+	ctx := context.Background()
+	mem := saga.NewMemoryStore()
+	calls := map[string]int{}
+
+	// 第 4 次落盘 = charge 完成后:charge 已执行但结果未落盘
+	c1 := saga.NewCoordinator(&crashStore{Store: mem, n: 4})
+	c1.Register(newOrderSaga(100, calls))
+	if _, err := c1.Execute(ctx, "order", "o-1", order{Amount: 10}); err == nil {
+		t.Fatal("want crash error")
+	}
+	inst, _ := mem.Get(ctx, "o-1")
+	if inst.State != saga.StateRunning || inst.Steps[0].State != saga.StepDone || inst.Steps[1].State != saga.StepRunning {
+		t.Fatalf("persisted = %+v", inst)
+	}
+
+	c2 := saga.NewCoordinator(mem, saga.WithStaleAfter(0))
+	c2.Register(newOrderSaga(100, calls))
+	if n, err := c2.Recover(ctx); n != 1 || err != nil {
+		t.Fatalf("recovered %d, err = %v", n, err)
+	}
+	inst, _ = c2.Get(ctx, "o-1")
+	if inst.State != saga.StateCommitted {
+		t.Fatalf("state = %v", inst.State)
+	}
+	// reserve 不重跑;落盘前崩溃的 charge 重跑一次
+	if calls["reserve"] != 1 || calls["charge"] != 2 || calls["ship"] != 1 {
+		t.Fatalf("calls = %v", calls)
+	}
+	// 幂等:同 ID 再次 Execute 直接返回已有结果
+	res, err := c2.Execute(ctx, "order", "o-1", order{Amount: 10})
+	if err != nil || res.Status != saga.StatusCommitted || calls["ship"] != 1 {
+		t.Fatalf("res = %+v, err = %v, calls = %v", res, err, calls)
+	}
+}
+
+func TestCoordinator_ResumeCompensation(t *testing.T) {
+	ctx := context.Background()
+	mem := saga.NewMemoryStore()
+	calls := map[string]int{}
+
+	// 第 5 次落盘 = 补偿完 reserve 后:reserve 的补偿已执行但结果未落盘
+	c1 := saga.NewCoordinator(&crashStore{Store: mem, n: 5})
+	c1.Register(newOrderSaga(100, calls))
+	if _, err := c1.Execute(ctx, "order", "o-2", order{Amount: 500}); err == nil {
+		t.Fatal("want crash error")
+	}
+	if inst, _ := mem.Get(ctx, "o-2"); inst.State != saga.StateCompensating || inst.FailedStep != "charge" {
+		t.Fatalf("persisted = %+v", inst)
+	}
+
+	c2 := saga.NewCoordinator(mem)
+	c2.Register(newOrderSaga(100, calls))
+	res, err := c2.Resume(ctx, "o-2")
+	if err != nil || res.Status != saga.StatusCompensated || res.FailedStep != "charge" || res.Err == nil {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if calls["release"] != 2 || calls["ship"] != 0 {
+		t.Fatalf("calls = %v", calls)
+	}
+}
+
+func TestCoordinator_Stuck(t *testing.T) {
+	ctx := context.Background()
+	c := saga.NewCoordinator(saga.NewKVStore(kvstore.NewMemory()))
+	broken := true
+	c.Register(saga.New("transfer").
+		Step("debit", noop, func(context.Context) error {
+			if broken {
+				return errors.New("ledger down")
+			}
+			return nil
+		}).
+		Step("credit", func(context.Context) error { return errors.New("account closed") }, nil))
+
+	for _, id := range []string{"t-1", "t-2"} {
+		res, err := c.Execute(ctx, "transfer", id, nil)
+		if err != nil || res.Status != saga.StatusCompensationFailed {
+			t.Fatalf("res = %+v, err = %v", res, err)
+		}
+	}
+	stuck, err := c.Stuck(ctx)
+	if err != nil || len(stuck) != 2 || stuck[0].Steps[0].State != saga.StepCompensationFailed {
+		t.Fatalf("stuck = %v, err = %v", stuck, err)
+	}
+
+	if err := c.Resolve(ctx, "t-1", "refunded manually"); err != nil {
+		t.Fatal(err)
+	}
+	broken = false
+	res, err := c.RetryCompensation(ctx, "t-2")
+	if err != nil || res.Status != saga.StatusCompensated || res.Steps[0].CompensateTry != 2 {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if stuck, _ := c.Stuck(ctx); len(stuck) != 0 {
+		t.Fatalf("stuck after resolve = %v", stuck)
+	}
+	if inst, _ := c.Get(ctx, "t-1"); !inst.Resolved || inst.Note != "refunded manually" {
+		t.Fatalf("t-1 = %+v", inst)
+	}
+	if _, err := c.RetryCompensation(ctx, "t-2"); !errors.Is(err, saga.ErrNotStuck) {
+		t.Fatalf("want ErrNotStuck, got %v", err)
+	}
+}
+
+func TestCoordinator_Errors(t *testing.T) {
+	ctx := context.Background()
+	mem := saga.NewMemoryStore()
+	c := saga.NewCoordinator(mem)
+	if _, err := c.Execute(ctx, "missing", "x", nil); !errors.Is(err, saga.ErrUnknownDefinition) {
+		t.Fatalf("want ErrUnknownDefinition, got %v", err)
+	}
+	c.Register(saga.New("s").Step("a", noop, nil))
+	if _, err := c.Execute(ctx, "s", "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	inst, _ := mem.Get(ctx, "x")
+	stale := *inst
+	stale.Version--
+	if err := mem.Update(ctx, &stale); !errors.Is(err, saga.ErrConflict) {
+		t.Fatalf("want ErrConflict, got %v", err)
+	}
+
+	// 发布改了步骤:进行中的旧实例不能按新定义恢复
+	inst.State, inst.Step = saga.StateRunning, 0
+	_ = mem.Update(ctx, inst)
+	c.Register(saga.New("s").Step("a", noop, nil).Step("b", noop, nil))
+	if _, err := c.Resume(ctx, "x"); !errors.Is(err, saga.ErrDefinitionMismatch) {
+		t.Fatalf("want ErrDefinitionMismatch, got %v", err)
+	}
+	if err := saga.SetOutput(ctx, 1); !errors.Is(err, saga.ErrNotDurable) {
+		t.Fatalf("want ErrNotDurable, got %v", err)
+	}
+}
+
+func TestKVStore_List(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	store := saga.NewKVStore(kv, saga.WithPrefix("t:"))
+	c := saga.NewCoordinator(store)
+	c.Register(saga.New("s").Step("a", noop, nil))
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := c.Execute(ctx, "s", id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Create(ctx, &saga.Instance{ID: "a"}); !errors.Is(err, saga.ErrExists) {
+		t.Fatalf("want ErrExists, got %v", err)
+	}
+	_ = kv.Delete(ctx, "t:i:a") // 模拟保留期过期
+	list, err := store.List(ctx, saga.Filter{States: []saga.State{saga.StateCommitted}})
+	if err != nil || len(list) != 2 || list[0].ID != "b" {
+		t.Fatalf("list = %v, err = %v", list, err)
+	}
+}
@@ -0,0 +1,186 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// ErrNotDurable 表示 ctx 不在 saga 步骤内(Input / SetOutput / Output 只能在 Action / Compensate 中调用)。
+var ErrNotDurable = errors.New("saga: not inside a saga step")
+
+// State 是持久化实例的状态:running / compensating 为进行中,其余为终态。
+type State string
+
+const (
+	StateRunning            State = "running"
+	StateCompensating       State = "compensating"
+	StateCommitted          State = "committed"
+	StateCompensated        State = "compensated"
+	StateCompensationFailed State = "compensation_failed"
+)
+
+// Terminal 报告是否为终态。
+func (s State) Terminal() bool {
+	return s == StateCommitted || s == StateCompensated || s == StateCompensationFailed
+}
+
+// Status 把终态映射为 Execute 的 Status;非终态返回 false。
+func (s State) Status() (Status, bool) {
+	switch s {
+	case StateCommitted:
+		return StatusCommitted, true
+	case StateCompensated:
+		return StatusCompensated, true
+	case StateCompensationFailed:
+		return StatusCompensationFailed, true
+	}
+	return 0, false
+}
+
+// StepState 是单个步骤的持久化状态。
+type StepState string
+
+const (
+	StepPending            StepState = "pending"
+	StepRunning            StepState = "running" // 已开始、结果未落盘:恢复时重跑(Action 须幂等)
+	StepDone               StepState = "done"
+	StepFailed             StepState = "failed"
+	StepCompensated        StepState = "compensated"
+	StepCompensationFailed StepState = "compensation_failed"
+)
+
+// StepRecord 是单个步骤的持久化记录。
+type StepRecord struct {
+	Name     string          `json:"name"`
+	State    StepState       `json:"state"`
+	Output   json.RawMessage `json:"output,omitempty"`   // SetOutput 写入的输出
+	Error    string          `json:"error,omitempty"`    // 正向或补偿的最后一次错误
+	Attempts int             `json:"attempts,omitempty"` // 补偿累计尝试次数
+	Duration time.Duration   `json:"duration,omitempty"` // 正向操作耗时
+}
+
+// Instance 是一次 saga 执行的持久化状态,由 Coordinator 在每步前后写入 Store。
+type Instance struct {
+	ID         string          `json:"id"`
+	Definition string          `json:"definition"` // 注册到 Coordinator 的 Saga 名
+	Input      json.RawMessage `json:"input,omitempty"`
+	State      State           `json:"state"`
+	Step       int             `json:"step"` // 正向阶段下一个要执行(或失败)的步骤下标
+	Steps      []StepRecord    `json:"steps"`
+	Error      string          `json:"error,omitempty"`       // 触发补偿的原始失败
+	FailedStep string          `json:"failed_step,omitempty"` // 失败步骤名
+	Resolved   bool            `json:"resolved,omitempty"`    // 补偿失败后已人工处理
+	Note       string          `json:"note,omitempty"`        // 人工处理备注
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	Version    int64           `json:"version"` // 乐观锁版本,由 Store 维护
+}
+
+// Result 把实例转为与 Execute 相同形态的 Result;非终态实例的 Status 为其当前推断值。
+func (inst *Instance) Result() *Result {
+	st, _ := inst.State.Status()
+	res := &Result{Name: inst.Definition, Status: st, FailedStep: inst.FailedStep}
+	if inst.Error != "" {
+		res.Err = errors.New(inst.Error)
+	}
+	for _, rec := range inst.Steps {
+		sr := StepResult{Name: rec.Name, Duration: rec.Duration, CompensateTry: rec.Attempts}
+		switch rec.State {
+		case StepFailed:
+			sr.ActionErr = errors.New(rec.Error)
+		case StepCompensated:
+			sr.Compensated = true
+		case StepCompensationFailed:
+			sr.Compensated = true
+			sr.CompensateErr = errors.New(rec.Error)
+		}
+		res.Steps = append(res.Steps, sr)
+	}
+	return res
+}
+
+func (s *Saga) newInstance(id string, input json.RawMessage) *Instance {
+	now := time.Now()
+	inst := &Instance{ID: id, Definition: s.name, Input: input, State: StateRunning, CreatedAt: now, UpdatedAt: now}
+	for _, step := range s.steps {
+		inst.Steps = append(inst.Steps, StepRecord{Name: step.Name, State: StepPending})
+	}
+	return inst
+}
+
+// runtime 是步骤执行期间经 ctx 暴露给 Action / Compensate 的实例视图。
+type runtime struct {
+	inst    *Instance
+	pending json.RawMessage // 当前 Action 经 SetOutput 写入、尚未提交的输出
+}
+
+type stepRef struct {
+	rt   *runtime
+	step int
+}
+
+var stepKey = ctxkey.New[stepRef]()
+
+func (rt *runtime) stepContext(ctx context.Context, step int) context.Context {
+	rt.pending = nil
+	return ctxkey.With(ctx, stepKey, stepRef{rt: rt, step: step})
+}
+
+// commitOutput 把 SetOutput 的结果记入第 step 步。
+func (rt *runtime) commitOutput(step int) {
+	rt.inst.Steps[step].Output, rt.pending = rt.pending, nil
+}
+
+// InstanceID 返回当前步骤所属实例的 ID(Execute 执行时为空),可作为下游调用的幂等键前缀。
+func InstanceID(ctx context.Context) string {
+	ref, _ := ctxkey.Get(ctx, stepKey)
+	if ref.rt == nil {
+		return ""
+	}
+	return ref.rt.inst.ID
+}
+
+// Input 把 Coordinator.Execute 传入的输入解码到 v。无输入时 v 保持不变。
+func Input(ctx context.Context, v any) error {
+	ref, ok := ctxkey.Get(ctx, stepKey)
+	if !ok {
+		return ErrNotDurable
+	}
+	if len(ref.rt.inst.Input) == 0 {
+		return nil
+	}
+	return json.Unmarshal(ref.rt.inst.Input, v)
+}
+
+// SetOutput 记录当前步骤的输出(JSON 序列化),Action 成功后随步骤一起落盘,
+// 后续步骤与补偿经 Output 读取(如下单步骤记下订单号,补偿时据此取消)。
+func SetOutput(ctx context.Context, v any) error {
+	ref, ok := ctxkey.Get(ctx, stepKey)
+	if !ok {
+		return ErrNotDurable
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ref.rt.pending = b
+	return nil
+}
+
+// Output 把步骤 step 的输出解码到 v,返回该步骤是否有输出。
+func Output(ctx context.Context, step string, v any) (bool, error) {
+	ref, ok := ctxkey.Get(ctx, stepKey)
+	if !ok {
+		return false, ErrNotDurable
+	}
+	for _, rec := range ref.rt.inst.Steps {
+		if rec.Name == step && len(rec.Output) > 0 {
+			return true, json.Unmarshal(rec.Output, v)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,78 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/orchestration/internal/kvrecord"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// KVStore 是基于 kvstore.Store 的 Store 实现,多实例共享同一后端(如 Redis)即可跨进程恢复。
+//
+// kvstore 没有列举与 CAS 原语,因此:
+//   - List 依赖一个自增序号索引(<prefix>seq + <prefix>x:<n> → id)顺序扫描,
+//     已过期实例的索引在扫描时顺带清理;适合"进行中实例 + 近期终态"规模,不适合海量历史查询;
+//   - Update 用 SetNX 短锁(<prefix>l:<id>)保护"读版本-写入",锁被占用即返回 ErrConflict。
+//
+// 零值不可用,用 NewKVStore 构造。
+type KVStore struct {
+	rec       kvrecord.Store[Instance]
+	prefix    string
+	retention time.Duration
+}
+
+// KVOption 配置 KVStore。
+type KVOption func(*KVStore)
+
+// WithPrefix 设置键前缀,默认 "saga:"。
+func WithPrefix(prefix string) KVOption {
+	return func(s *KVStore) { s.prefix = prefix }
+}
+
+// WithRetention 设置 committed / compensated 实例的保留时长,默认 7 天;<=0 表示永久保留。
+// compensation_failed 与进行中的实例永不过期(须人工处理或恢复)。
+func WithRetention(d time.Duration) KVOption {
+	return func(s *KVStore) { s.retention = d }
+}
+
+// NewKVStore 创建基于 kv 的 Store。
+func NewKVStore(kv kvstore.Store, opts ...KVOption) *KVStore {
+	s := &KVStore{prefix: "saga:", retention: 7 * 24 * time.Hour}
+	for _, o := range opts {
+		o(s)
+	}
+	s.rec = kvrecord.Store[Instance]{
+		KV:          kv,
+		Prefix:      s.prefix,
+		ID:          func(inst *Instance) string { return inst.ID },
+		Version:     func(inst *Instance) *int64 { return &inst.Version },
+		TTL:         s.ttl,
+		ErrNotFound: ErrNotFound,
+		ErrExists:   ErrExists,
+		ErrConflict: ErrConflict,
+	}
+	return s
+}
+
+func (s *KVStore) ttl(inst *Instance) time.Duration {
+	if inst.State == StateCommitted || inst.State == StateCompensated {
+		return s.retention
+	}
+	return 0
+}
+
+func (s *KVStore) Create(ctx context.Context, inst *Instance) error { return s.rec.Create(ctx, inst) }
+
+func (s *KVStore) Update(ctx context.Context, inst *Instance) error { return s.rec.Update(ctx, inst) }
+
+func (s *KVStore) Get(ctx context.Context, id string) (*Instance, error) { return s.rec.Get(ctx, id) }
+
+// List 从低水位(<prefix>lo)扫描到当前序号;从低水位起连续失效的索引在扫描后推进低水位跳过。
+func (s *KVStore) List(ctx context.Context, f Filter) ([]*Instance, error) {
+	out, err := s.rec.Scan(ctx, f.Match)
+	if err != nil {
+		return nil, err
+	}
+	return limit(sortByUpdated(out), f.Limit), nil
+}
@@ -15,11 +15,11 @@
 //     补偿全成功 → StatusCompensated(数据一致,返回原始失败原因);
 //     某步补偿失败 → StatusCompensationFailed(数据不一致,须告警 + 人工介入)。
 //
-// 关键约束(MVP,纯内存):
+// 关键约束:
 //   - 补偿必须幂等:补偿会因重试重复执行。责任在调用方——推荐正/反向都用
 //     幂等键实现(如 wallet.ApplyTx(txID) / wallet.ApplyTx(refundID));
-//   - 不持久化:协调器进程崩溃则进行中的 saga 丢失、无法恢复。仅适合"单进程内
-//     编排多个 RPC、进程存活期间完成"的流程,不是可靠分布式事务;
+//   - Execute 不持久化:协调器进程崩溃则进行中的 saga 丢失。需要崩溃恢复时改用
+//     Coordinator(见下文"崩溃恢复");
 //   - 无隔离性:执行中的中间态(钱扣了货没发)对其他请求可见,业务需容忍;
 //   - 当步 Action 失败不补偿当步——只补偿已成功的前序步骤,当步的部分副作用
 //     须靠 Action 自身幂等 / 其补偿设计覆盖。
@@ -27,13 +27,15 @@
 // Action/Compensate 中的 panic 被 pkg/safe 转为 error(走正常失败/补偿流程)。
 // 补偿阶段使用 context.WithoutCancel:原请求 ctx 取消不应中断补偿(副作用须补完)。
 //
-// 崩溃恢复:本包不持久化。生产环境依赖「可重投的触发源」(如 MQ at-least-once)
-// 实现恢复——协调器崩溃后消息重投、saga 从头重跑,靠「幂等的 Action/Compensate」
-// 保证不产生重复副作用。
-// 前提:幂等键必须来自触发消息、跨重投稳定(如 msg.OrderID),不可用 idgen/uuid
-// 现场生成——现场生成会让每次重投的键都不同,幂等失效、重复扣款。
-// 仅当触发源不可重投(如不会重试的同步请求)时,才需要外部持久化 saga 状态并在
-// 重启时恢复进度——那种场景本包不覆盖。
+// 崩溃恢复,两种方式:
+//   - 触发源可重投(如 MQ at-least-once):直接用 Execute,协调器崩溃后消息重投、saga
+//     从头重跑,靠「幂等的 Action/Compensate」保证不产生重复副作用。幂等键必须来自触发
+//     消息、跨重投稳定(如 msg.OrderID),不可用 idgen/uuid 现场生成;
+//   - 触发源不可重投(如不会重试的同步请求):用 Coordinator。每个实例的定义名、步骤下标、
+//     各步状态、输入与各步输出(经 Input / SetOutput / Output 读写,JSON 序列化)在每步前后
+//     写入 Store(NewMemoryStore / NewKVStore / contrib/sqldb/sagastore);Coordinator 作为
+//     beauty.Service 启动后周期扫描停滞的实例,从最后落盘的步骤继续正向执行或补偿。
+//     补偿失败的实例经 Stuck 列出,人工处理后 RetryCompensation 或 Resolve。
 //
 // 零值不可用,用 New 构造。单个 Saga 的 Execute 非并发安全(一次编排一个流程);
 // 不同 Saga 实例相互独立。
@@ -176,6 +178,7 @@ func (s *Saga) AddStep(step Step) *Saga {
 // 不受原 ctx 取消影响。
 func (s *Saga) Execute(ctx context.Context) *Result {
 	res := &Result{Name: s.name, Status: StatusCommitted}
+	rt := &runtime{inst: s.newInstance("", nil)} // 非持久化:输出只在本次执行内可见
 
 	completed := make([]int, 0, len(s.steps)) // 已成功步骤的下标(供逆序补偿)
 	for i, step := range s.steps {
@@ -184,21 +187,22 @@ func (s *Saga) Execute(ctx context.Context) *Result {
 			res.Err = fmt.Errorf("saga %q: context done before step %q: %w", s.name, step.Name, err)
 			res.FailedStep = step.Name
 			res.Steps = append(res.Steps, StepResult{Name: step.Name, ActionErr: res.Err})
-			s.compensate(ctx, completed, res)
+			s.compensate(ctx, rt, completed, res)
 			return res
 		}
 
 		start := time.Now()
-		err := safe.Run(func() error { return step.Action(ctx) })
+		err := safe.Run(func() error { return step.Action(rt.stepContext(ctx, i)) })
 		sr := StepResult{Name: step.Name, ActionErr: err, Duration: time.Since(start)}
 		res.Steps = append(res.Steps, sr)
 
 		if err != nil {
 			res.Err = fmt.Errorf("saga %q: step %q action failed: %w", s.name, step.Name, err)
 			res.FailedStep = step.Name
-			s.compensate(ctx, completed, res)
+			s.compensate(ctx, rt, completed, res)
 			return res
 		}
+		rt.commitOutput(i)
 		completed = append(completed, i)
 	}
 	return res
@@ -206,11 +210,29 @@ func (s *Saga) Execute(ctx context.Context) *Result {
 
 // compensate 逆序补偿 completed 中的步骤,把结果写回 res.Steps 对应项。
 // 任一步补偿最终失败 → res.Status = StatusCompensationFailed;否则 StatusCompensated。
-func (s *Saga) compensate(ctx context.Context, completed []int, res *Result) {
+func (s *Saga) compensate(ctx context.Context, rt *runtime, completed []int, res *Result) {
 	// 补偿不受原 ctx 取消影响:副作用须补完。
 	compCtx := context.WithoutCancel(ctx)
 	res.Status = StatusCompensated
 
+	for i := len(completed) - 1; i >= 0; i-- {
+		idx := completed[i]
+		step := s.steps[idx]
+		if step.Compensate == nil {
+			continue // 无补偿的步骤跳过
+		}
+		tried, err := s.compensateStep(rt.stepContext(compCtx, idx), step)
+		res.Steps[idx].Compensated = true
+		res.Steps[idx].CompensateErr = err
+		res.Steps[idx].CompensateTry = tried
+		if err != nil {
+			res.Status = StatusCompensationFailed
+		}
+	}
+}
+
+// compensateStep 按 WithCompensationRetry 重试一个步骤的补偿,返回尝试次数与最终错误。
+func (s *Saga) compensateStep(ctx context.Context, step Step) (int, error) {
 	// 补偿重试的退避序列复用 pkg/backoff:base=compRetryDelay、factor=2、无抖动,
 	// 与历史行为(delay<<(attempt-1))一致。
 	policy := backoff.New(
@@ -219,37 +241,22 @@ func (s *Saga) compensate(ctx context.Context, completed []int, res *Result) {
 		backoff.WithJitter(backoff.JitterNone),
 		backoff.WithMax(0),
 	)
-
-	for i := len(completed) - 1; i >= 0; i-- {
-		idx := completed[i]
-		step := s.steps[idx]
-		if step.Compensate == nil {
-			continue // 无补偿的步骤跳过
+	var lastErr error
+	attempts := s.cfg.compRetries + 1
+	var tried int
+	for attempt := 1; attempt <= attempts; attempt++ {
+		tried = attempt
+		lastErr = safe.Run(func() error { return step.Compensate(ctx) })
+		if s.cfg.onCompensate != nil {
+			s.cfg.onCompensate(step.Name, attempt, lastErr)
 		}
-
-		var lastErr error
-		attempts := s.cfg.compRetries + 1
-		var tried int
-		for attempt := 1; attempt <= attempts; attempt++ {
-			tried = attempt
-			lastErr = safe.Run(func() error { return step.Compensate(compCtx) })
-			if s.cfg.onCompensate != nil {
-				s.cfg.onCompensate(step.Name, attempt, lastErr)
-			}
-			if lastErr == nil {
-				break
-			}
-			if attempt < attempts {
-				// 指数退避后重试(attempt 从 1 计,Duration(attempt-1) 对应 base<<(attempt-1))。
-				time.Sleep(policy.Duration(attempt - 1))
-			}
+		if lastErr == nil {
+			break
 		}
-
-		res.Steps[idx].Compensated = true
-		res.Steps[idx].CompensateErr = lastErr
-		res.Steps[idx].CompensateTry = tried
-		if lastErr != nil {
-			res.Status = StatusCompensationFailed
+		if attempt < attempts {
+			// 指数退避后重试(attempt 从 1 计,Duration(attempt-1) 对应 base<<(attempt-1))。
+			time.Sleep(policy.Duration(attempt - 1))
 		}
 	}
+	return tried, lastErr
 }
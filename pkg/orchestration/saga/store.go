@@ -0,0 +1,149 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound 实例不存在。
+	ErrNotFound = errors.New("saga: instance not found")
+	// ErrExists Create 时实例 ID 已存在。
+	ErrExists = errors.New("saga: instance already exists")
+	// ErrConflict Update 时版本不匹配(实例已被其它协调器推进)。
+	ErrConflict = errors.New("saga: instance version conflict")
+)
+
+// Store 持久化 saga 实例。实现须并发安全;跨进程共享同一 Store 时,Update 的版本校验
+// 保证同一实例同时只有一个协调器能推进。
+type Store interface {
+	// Create 写入新实例(Version 置 1);ID 已存在返回 ErrExists。
+	Create(ctx context.Context, inst *Instance) error
+	// Update 当存储中的 Version 等于 inst.Version 时写入并把 inst.Version 加 1,否则返回 ErrConflict。
+	Update(ctx context.Context, inst *Instance) error
+	// Get 读取实例;不存在返回 ErrNotFound。
+	Get(ctx context.Context, id string) (*Instance, error)
+	// List 按 Filter 列出实例,按 UpdatedAt 升序。
+	List(ctx context.Context, f Filter) ([]*Instance, error)
+}
+
+// Filter 是 Store.List 的查询条件,零值字段不参与过滤。
+type Filter struct {
+	States        []State   // 状态之一
+	Definition    string    // 定义名
+	UpdatedBefore time.Time // 最后更新早于该时刻(恢复扫描用来挑出停滞实例)
+	Limit         int       // 最多返回条数
+}
+
+// Match 报告 inst 是否满足过滤条件(不含 Limit),供 Store 实现复用。
+func (f Filter) Match(inst *Instance) bool {
+	if len(f.States) > 0 && !slices.Contains(f.States, inst.State) {
+		return false
+	}
+	if f.Definition != "" && inst.Definition != f.Definition {
+		return false
+	}
+	if !f.UpdatedBefore.IsZero() && !inst.UpdatedAt.Before(f.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// MemoryStore 是 Store 的内存实现(单进程、进程重启即丢),用于测试与单机。
+// 零值不可用,用 NewMemoryStore 构造。
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+// NewMemoryStore 创建内存 Store。实例以 JSON 保存,读写都是副本。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string][]byte)}
+}
+
+func (m *MemoryStore) Create(_ context.Context, inst *Instance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[inst.ID]; ok {
+		return ErrExists
+	}
+	inst.Version = 1
+	b, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	m.items[inst.ID] = b
+	return nil
+}
+
+func (m *MemoryStore) Update(_ context.Context, inst *Instance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, err := m.decode(inst.ID)
+	if err != nil {
+		return err
+	}
+	if cur.Version != inst.Version {
+		return ErrConflict
+	}
+	next := *inst
+	next.Version++
+	b, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	m.items[inst.ID] = b
+	inst.Version = next.Version
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (*Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.decode(id)
+}
+
+func (m *MemoryStore) List(_ context.Context, f Filter) ([]*Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*Instance
+	for id := range m.items {
+		inst, err := m.decode(id)
+		if err != nil {
+			return nil, err
+		}
+		if f.Match(inst) {
+			out = append(out, inst)
+		}
+	}
+	return limit(sortByUpdated(out), f.Limit), nil
+}
+
+func (m *MemoryStore) decode(id string) (*Instance, error) {
+	b, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	inst := new(Instance)
+	if err := json.Unmarshal(b, inst); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+func sortByUpdated(list []*Instance) []*Instance {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].UpdatedAt.Before(list[j].UpdatedAt) })
+	return list
+}
+
+func limit(list []*Instance, n int) []*Instance {
+	if n > 0 && len(list) > n {
+		return list[:n]
+	}
+	return list
+}
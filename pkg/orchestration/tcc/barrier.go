@@ -0,0 +1,218 @@
+package tcc
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/orchestration/internal/kvrecord"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+var (
+	// ErrNoBranch ctx 中没有事务分支(不在 Coordinator 调用的参与方内,且未经 NewBranchContext 还原)。
+	ErrNoBranch = errors.New("tcc: no branch in context")
+	// ErrSuspended Try 到达时该分支已被 Cancel(悬挂):Try 被拒绝,不得再预留资源。
+	ErrSuspended = errors.New("tcc: branch already cancelled, try rejected")
+	// ErrBranchBusy 同一分支的同一操作(或 Cancel 要等待的 Try)仍在执行中。可重试:
+	// 协调者的重试 / 恢复稍后会再次调用,届时按执行结果处理。
+	ErrBranchBusy = errors.New("tcc: branch operation in progress, retry later")
+)
+
+// Barrier 是参与方侧的分支屏障,处理网络乱序带来的三类异常(按 XID + BranchID 记录):
+//   - 幂等:同一分支重复的 Try / Confirm / Cancel 只执行一次;
+//   - 空回滚:Cancel 先于 Try 到达(Try 超时未达、事务已取消),Cancel 直接成功、不调用业务取消;
+//   - 悬挂:空回滚之后迟到的 Try 返回 ErrSuspended,不再预留(否则资源永远冻结)。
+//
+// 每个操作先记"执行中"、成功后记"已完成"。执行中时到达的重复调用,以及 Try 仍在执行时到达的 Cancel,
+// 都返回可重试的 ErrBranchBusy,不会误报成功,也不会在预留落地前执行业务取消。
+// "执行中"标记带租约(WithBarrierLease),执行者崩溃后到期失效,分支不会永远忙。
+// 标记里带本次执行的令牌,收尾时只在标记仍是自己的令牌时才改记"已完成"(比较后写入):
+// 租约在执行中途到期、被空回滚或另一执行者接手时,收尾不会覆盖对方的记录,而是返回 ErrSuspended / ErrBranchBusy。
+//
+// 用法是包裹参与方的三个操作:
+//
+//	coord.Register(tcc.Branch{
+//	    Name:    "wallet",
+//	    Try:     barrier.Try(freeze),
+//	    Confirm: barrier.Confirm(deduct),
+//	    Cancel:  barrier.Cancel(unfreeze),
+//	})
+//
+// 参与方在远端服务时,远端用 NewBranchContext 还原 xid / branch 后调用包裹后的函数。
+//
+// 屏障记录与业务写入不在同一事务中:两者之间崩溃时,Try / Confirm / Cancel 自身仍须幂等。
+// 需要严格保证时,在业务库里用唯一键(xid, branch, op)与业务写入同事务实现等价逻辑。
+// 零值不可用,用 NewBarrier 构造。
+type Barrier struct {
+	kv     kvstore.Store
+	prefix string
+	ttl    time.Duration
+	lease  time.Duration
+}
+
+// BarrierOption 配置 Barrier。
+type BarrierOption func(*Barrier)
+
+// WithBarrierPrefix 设置键前缀,默认 "tcc:b:"。
+func WithBarrierPrefix(prefix string) BarrierOption {
+	return func(b *Barrier) { b.prefix = prefix }
+}
+
+// WithBarrierTTL 设置屏障记录的保留时长,默认 7 天;须长于事务从创建到终结的最长时间。
+func WithBarrierTTL(d time.Duration) BarrierOption {
+	return func(b *Barrier) { b.ttl = d }
+}
+
+// WithBarrierLease 设置"执行中"标记的租约,默认 1 分钟;须长于参与方单次操作的最长耗时。
+// 租约内执行者崩溃,分支一直返回 ErrBranchBusy 直到到期:到期后 Try 按未到达处理(Cancel 走空回滚),
+// Confirm / Cancel 可重新执行。Try 执行超过租约而期间分支被空回滚时,Try 返回 ErrSuspended,
+// 但它已做的预留不会被屏障撤销——参与方须自行对账,因此租约宁长勿短。
+func WithBarrierLease(d time.Duration) BarrierOption {
+	return func(b *Barrier) { b.lease = d }
+}
+
+// NewBarrier 创建基于 kv 的 Barrier。
+func NewBarrier(kv kvstore.Store, opts ...BarrierOption) *Barrier {
+	b := &Barrier{kv: kv, prefix: "tcc:b:", ttl: 7 * 24 * time.Hour, lease: time.Minute}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// 分支操作记录的取值。执行中记为 markRunning + ":" + 令牌;try 键额外可能是 markCancel(空回滚标记)。
+const (
+	markRunning = "running"
+	markDone    = "done"
+	markCancel  = "cancel"
+)
+
+func (b *Barrier) key(ctx context.Context, op string) (string, error) {
+	ref, ok := ctxkey.Get(ctx, branchKey)
+	if !ok || ref.xid == "" {
+		return "", ErrNoBranch
+	}
+	return b.prefix + ref.xid + ":" + ref.branch + ":" + op, nil
+}
+
+// Try 包裹 Try:首次到达才执行 fn(fn 失败时撤销记录,使随后的 Cancel 按空回滚处理);
+// 已完成的重复到达返回 nil,仍在执行时返回 ErrBranchBusy;分支已被空回滚时返回 ErrSuspended。
+func (b *Barrier) Try(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		key, err := b.key(ctx, "try")
+		if err != nil {
+			return err
+		}
+		return b.once(ctx, key, fn)
+	}
+}
+
+// Confirm 包裹 Confirm:每个分支只成功执行一次,fn 失败时可重试;仍在执行时重复到达返回 ErrBranchBusy。
+func (b *Barrier) Confirm(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		key, err := b.key(ctx, "confirm")
+		if err != nil {
+			return err
+		}
+		return b.once(ctx, key, fn)
+	}
+}
+
+// Cancel 包裹 Cancel:Try 未到达时记下空回滚标记(挡住迟到的 Try)并直接返回 nil;
+// Try 仍在执行时返回 ErrBranchBusy(等预留落地或撤销后再取消);
+// 否则每个分支只成功执行一次 fn,失败时可重试。
+func (b *Barrier) Cancel(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		key, err := b.key(ctx, "cancel")
+		if err != nil {
+			return err
+		}
+		tryKey, _ := b.key(ctx, "try")
+		// 与 Try 收尾的比较后写入互斥,避免空回滚标记落在 Try 读到自己令牌与改记"已完成"之间。
+		unlock, err := kvrecord.Lock(ctx, b.kv, kvrecord.KeyLock(tryKey))
+		if err != nil {
+			return err
+		}
+		if unlock == nil {
+			return ErrBranchBusy
+		}
+		empty, err := b.kv.SetNX(ctx, tryKey, []byte(markCancel), b.ttl)
+		unlock()
+		if err != nil {
+			return err
+		}
+		if empty {
+			return nil
+		}
+		v, found, err := b.kv.Get(ctx, tryKey)
+		switch {
+		case err != nil:
+			return err
+		case !found:
+			return ErrBranchBusy // Try 刚失败撤销了记录,下次重试走空回滚
+		case string(v) == markCancel:
+			return nil // 已空回滚过
+		case running(v):
+			return ErrBranchBusy
+		}
+		return b.once(ctx, key, fn)
+	}
+}
+
+// once 保证 fn 对 key 只成功执行一次:先以租约记"执行中"(带令牌),成功后改记"已完成";fn 失败时删除记录以便重试。
+// 两步收尾都只在记录仍是自己的令牌时生效;租约已失效、记录被他人改写时返回 finish 的结果。
+// 记录已存在时:已完成返回 nil,执行中返回 ErrBranchBusy,空回滚标记(仅 try 键)返回 ErrSuspended。
+func (b *Barrier) once(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	token := markRunning + ":" + rand.Text()
+	ok, err := b.kv.SetNX(ctx, key, []byte(token), b.lease)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		v, found, err := b.kv.Get(ctx, key)
+		switch {
+		case err != nil:
+			return err
+		case !found, running(v):
+			return ErrBranchBusy
+		case string(v) == markCancel:
+			return ErrSuspended
+		}
+		return nil
+	}
+	if err := fn(ctx); err != nil {
+		_ = b.finish(context.WithoutCancel(ctx), key, token, nil)
+		return err
+	}
+	return b.finish(context.WithoutCancel(ctx), key, token, []byte(markDone))
+}
+
+// finishRetries 是收尾时锁被短暂占用(如并发的 Cancel 正写空回滚标记)的重试次数。
+const finishRetries = 5
+
+// finish 在 key 仍记着 token 时把它改为 val(nil 为删除)。记录已变:变成空回滚标记返回 ErrSuspended,
+// 其它情况(租约到期后被另一执行者接手或已完成、记录过期)返回 ErrBranchBusy,由调用方稍后重试按结果处理。
+func (b *Barrier) finish(ctx context.Context, key, token string, val []byte) error {
+	for i := 0; ; i++ {
+		ok, err := kvrecord.CompareAndSet(ctx, b.kv, key, token, val, b.ttl)
+		if err != nil || ok {
+			return err
+		}
+		v, found, err := b.kv.Get(ctx, key)
+		switch {
+		case err != nil:
+			return err
+		case found && string(v) == markCancel:
+			return ErrSuspended
+		case !found || string(v) != token || i == finishRetries:
+			return ErrBranchBusy
+		}
+		time.Sleep(10 * time.Millisecond) // 锁被占用,记录仍是自己的令牌
+	}
+}
+
+func running(v []byte) bool { return strings.HasPrefix(string(v), markRunning) }
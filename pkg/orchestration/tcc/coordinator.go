@@ -0,0 +1,361 @@
+package tcc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/safe"
+)
+
+var (
+	// ErrUnknownParticipant 分支引用的参与方未注册到 Coordinator。
+	ErrUnknownParticipant = errors.New("tcc: unknown participant")
+	// ErrInProgress 事务尚在执行中(本进程或其它协调器)。
+	ErrInProgress = errors.New("tcc: transaction in progress")
+	// ErrEmptyXID Execute 的 xid 为空。
+	ErrEmptyXID = errors.New("tcc: empty xid")
+)
+
+// Call 是一次事务中的一个分支:引用已注册的参与方名 + 该分支的负载(JSON 序列化,
+// 参与方经 Payload 读取)。同一参与方可在一笔事务里出现多次,以分支 ID 区分。
+type Call struct {
+	Participant string
+	Payload     any
+}
+
+// Coordinator 是持久化的 TCC 协调器:分支登记、各分支 Try 结果与全局决议写入 Store,
+// 进程崩溃后由(任意一个)Coordinator 按日志重新驱动 Confirm 或 Cancel。
+//
+// 执行流程(Execute):
+//   - 登记全部分支并落盘(trying),Deadline = 现在 + WithTimeout;
+//   - 顺序 Try(ctx 带 Deadline),每个分支前后落盘;
+//   - 全部成功 → 落盘决议 confirming → 顺序 Confirm;任一失败 / 超时 → 落盘决议 cancelling →
+//     逆序 Cancel 所有发起过 Try 的分支(含 Try 报错的:超时的 Try 可能已在参与方生效);
+//   - 第二阶段全部成功才进入终态;仍有失败的事务保持 confirming / cancelling,由恢复流程继续重试。
+//
+// 恢复(Recover / Start):Deadline 已过且未终结的事务——trying 决议为取消,confirming / cancelling
+// 重新驱动第二阶段。决议一经落盘不会反转。参与方按名字注册(Register),恢复时据日志里的参与方名
+// 重建分支,因此每个进程都要注册全部参与方。参与方侧的空回滚 / 悬挂 / 幂等用 Barrier 处理。
+//
+// 零值不可用,用 NewCoordinator 构造。并发安全;满足 beauty.Service。
+type Coordinator struct {
+	store    Store
+	timeout  time.Duration
+	interval time.Duration
+	onError  func(xid string, err error)
+	phase2   *Tx // 复用 Tx 的第二阶段重试配置
+
+	mu           sync.Mutex
+	participants map[string]Branch
+	active       map[string]struct{} // 本进程正在推进的事务
+}
+
+// CoordinatorOption 配置 Coordinator。
+type CoordinatorOption func(*Coordinator)
+
+// WithTimeout 设置事务的 Try 阶段时限(Deadline = 创建时刻 + d),默认 30 秒。
+// 超过 Deadline 仍未决议的事务会被恢复流程取消。
+func WithTimeout(d time.Duration) CoordinatorOption {
+	return func(c *Coordinator) { c.timeout = d }
+}
+
+// WithRecoverInterval 设置 Start 后周期恢复的间隔,默认 10 秒。
+func WithRecoverInterval(d time.Duration) CoordinatorOption {
+	return func(c *Coordinator) { c.interval = d }
+}
+
+// WithOnError 设置后台恢复出错时的回调(xid 为相关事务,扫描失败时为空)。默认 slog.Warn。
+func WithOnError(fn func(xid string, err error)) CoordinatorOption {
+	return func(c *Coordinator) { c.onError = fn }
+}
+
+// WithTxOptions 设置第二阶段的重试与回调(WithConfirmRetry / WithCancelRetry / WithOnConfirm 等)。
+func WithTxOptions(opts ...Option) CoordinatorOption {
+	return func(c *Coordinator) { c.phase2 = New("coordinator", opts...) }
+}
+
+// NewCoordinator 创建基于 store 的 Coordinator。
+func NewCoordinator(store Store, opts ...CoordinatorOption) *Coordinator {
+	c := &Coordinator{
+		store:        store,
+		timeout:      30 * time.Second,
+		interval:     10 * time.Second,
+		phase2:       New("coordinator"),
+		participants: make(map[string]Branch),
+		active:       make(map[string]struct{}),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.onError == nil {
+		c.onError = func(xid string, err error) {
+			slog.Warn("tcc: recover failed", "xid", xid, "err", err)
+		}
+	}
+	return c
+}
+
+// Register 按 Branch.Name 注册参与方,同名覆盖。Confirm / Cancel 为 nil 表示该阶段无操作。
+func (c *Coordinator) Register(participants ...Branch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range participants {
+		c.participants[p.Name] = p
+	}
+}
+
+// Execute 以 xid 为事务 ID 持久化执行一笔 TCC 事务。
+//
+// xid 是幂等键:已存在且已终结的事务直接返回其 Result;未终结的返回 ErrInProgress(交给恢复流程)。
+// 持久化失败返回 error,此时事务停在最后落盘的状态,由恢复流程在 Deadline 后继续。
+func (c *Coordinator) Execute(ctx context.Context, xid string, calls ...Call) (*Result, error) {
+	if xid == "" {
+		return nil, ErrEmptyXID
+	}
+	now := time.Now()
+	tx := &Transaction{XID: xid, State: StateTrying, Deadline: now.Add(c.timeout), CreatedAt: now, UpdatedAt: now}
+	for i, call := range calls {
+		if _, err := c.participant(call.Participant); err != nil {
+			return nil, err
+		}
+		var payload json.RawMessage
+		if call.Payload != nil {
+			b, err := json.Marshal(call.Payload)
+			if err != nil {
+				return nil, err
+			}
+			payload = b
+		}
+		tx.Branches = append(tx.Branches, BranchRecord{
+			ID: strconv.Itoa(i + 1), Participant: call.Participant, Payload: payload, State: BranchRegistered,
+		})
+	}
+	if !c.acquire(xid) {
+		return nil, ErrInProgress
+	}
+	defer c.release(xid)
+	if err := c.store.Create(ctx, tx); errors.Is(err, ErrExists) {
+		cur, err := c.store.Get(ctx, xid)
+		if err != nil {
+			return nil, err
+		}
+		if cur.State.Terminal() {
+			return cur.Result(), nil
+		}
+		return nil, ErrInProgress
+	} else if err != nil {
+		return nil, err
+	}
+	if err := c.try(ctx, tx); err != nil {
+		return nil, err
+	}
+	return c.drive(ctx, tx)
+}
+
+// Recover 扫描 Deadline 已过且未终结的事务并逐个推进,返回推进到终态的事务数。
+// 单个事务的失败经 WithOnError 上报,不中断扫描。
+func (c *Coordinator) Recover(ctx context.Context) (int, error) {
+	list, err := c.store.List(ctx, Filter{
+		States:         []State{StateTrying, StateConfirming, StateCancelling},
+		DeadlineBefore: time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, tx := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		// 恢复中的事务不受调用方取消影响:停机只应推迟恢复。
+		res, err := c.resume(context.WithoutCancel(ctx), tx)
+		if err != nil {
+			if !errors.Is(err, ErrInProgress) && !errors.Is(err, ErrConflict) {
+				c.onError(tx.XID, err)
+			}
+			continue
+		}
+		if res.Status == StatusConfirmed || res.Status == StatusCancelled {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Start 立即执行一次 Recover,之后按 WithRecoverInterval 周期执行,直到 ctx 取消。满足 beauty.Service。
+func (c *Coordinator) Start(ctx context.Context) error {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		if _, err := c.Recover(ctx); err != nil && ctx.Err() == nil {
+			c.onError("", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// String 满足 beauty.Service。
+func (c *Coordinator) String() string { return "tcc-coordinator" }
+
+// Get 读取事务 xid 的日志。
+func (c *Coordinator) Get(ctx context.Context, xid string) (*Transaction, error) {
+	return c.store.Get(ctx, xid)
+}
+
+func (c *Coordinator) participant(name string) (Branch, error) {
+	c.mu.Lock()
+	p, ok := c.participants[name]
+	c.mu.Unlock()
+	if !ok {
+		return Branch{}, fmt.Errorf("%w: %q", ErrUnknownParticipant, name)
+	}
+	return p, nil
+}
+
+func (c *Coordinator) acquire(xid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.active[xid]; ok {
+		return false
+	}
+	c.active[xid] = struct{}{}
+	return true
+}
+
+func (c *Coordinator) release(xid string) {
+	c.mu.Lock()
+	delete(c.active, xid)
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) save(ctx context.Context, tx *Transaction) error {
+	tx.UpdatedAt = time.Now()
+	return c.store.Update(context.WithoutCancel(ctx), tx)
+}
+
+// resume 接管已超时的事务:trying 决议为取消,其余按已落盘的决议继续第二阶段。
+func (c *Coordinator) resume(ctx context.Context, tx *Transaction) (*Result, error) {
+	if !c.acquire(tx.XID) {
+		return nil, ErrInProgress
+	}
+	defer c.release(tx.XID)
+	if tx.State == StateTrying {
+		tx.State = StateCancelling
+		tx.Error = fmt.Sprintf("tcc %q: deadline exceeded before all branches tried", tx.XID)
+	}
+	if err := c.save(ctx, tx); err != nil { // 认领:版本校验挡住并发接管
+		return nil, err
+	}
+	return c.drive(ctx, tx)
+}
+
+// try 执行第一阶段并落盘全局决议(confirming / cancelling)。
+func (c *Coordinator) try(ctx context.Context, tx *Transaction) error {
+	tryCtx, cancel := context.WithDeadline(ctx, tx.Deadline)
+	defer cancel()
+	for i := range tx.Branches {
+		b := &tx.Branches[i]
+		p, err := c.participant(b.Participant)
+		if err == nil {
+			err = tryCtx.Err()
+		}
+		if err == nil {
+			b.State = BranchTrying
+			if err := c.save(ctx, tx); err != nil {
+				return err
+			}
+			start := time.Now()
+			err = safe.Run(func() error { return p.Try(branchContext(tryCtx, tx.XID, b)) })
+			b.TryDuration = time.Since(start)
+		}
+		if err != nil {
+			if b.State == BranchTrying {
+				b.State = BranchTryFailed
+			}
+			b.TryError = err.Error()
+			tx.State, tx.FailedBranch = StateCancelling, b.Participant
+			tx.Error = fmt.Sprintf("tcc %q: try %q failed: %v", tx.XID, b.Participant, err)
+			return c.save(ctx, tx)
+		}
+		b.State = BranchTried
+	}
+	tx.State = StateConfirming
+	return c.save(ctx, tx)
+}
+
+// drive 按已落盘的决议执行第二阶段,每个分支后落盘;全部成功才进入终态。
+func (c *Coordinator) drive(ctx context.Context, tx *Transaction) (*Result, error) {
+	opCtx := context.WithoutCancel(ctx)
+	cfg := c.phase2.cfg
+	switch tx.State {
+	case StateConfirming:
+		done := true
+		for i := range tx.Branches {
+			b := &tx.Branches[i]
+			if b.State != BranchTried && b.State != BranchConfirmFailed {
+				continue
+			}
+			if err := c.phase(opCtx, tx, b, func(p Branch) func(context.Context) error { return p.Confirm },
+				cfg.confirmRetries, cfg.confirmDelay, cfg.onConfirm, BranchConfirmed, BranchConfirmFailed); err != nil {
+				return nil, err
+			}
+			done = done && b.State == BranchConfirmed
+		}
+		if done {
+			tx.State = StateConfirmed
+			if err := c.save(ctx, tx); err != nil {
+				return nil, err
+			}
+		}
+	case StateCancelling:
+		done := true
+		for i := len(tx.Branches) - 1; i >= 0; i-- {
+			b := &tx.Branches[i]
+			switch b.State {
+			case BranchTrying, BranchTried, BranchTryFailed, BranchCancelFailed:
+			default:
+				continue // 未发起 Try 或已取消
+			}
+			if err := c.phase(opCtx, tx, b, func(p Branch) func(context.Context) error { return p.Cancel },
+				cfg.cancelRetries, cfg.cancelDelay, cfg.onCancel, BranchCancelled, BranchCancelFailed); err != nil {
+				return nil, err
+			}
+			done = done && b.State == BranchCancelled
+		}
+		if done {
+			tx.State = StateCancelled
+			if err := c.save(ctx, tx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tx.Result(), nil
+}
+
+// phase 对一个分支执行 Confirm 或 Cancel(按 Tx 的重试配置),把结果记为 ok / failed 并落盘。
+// 参与方未注册时记为 failed,等注册后由恢复流程重试。
+func (c *Coordinator) phase(ctx context.Context, tx *Transaction, b *BranchRecord, op func(Branch) func(context.Context) error,
+	retries int, delay time.Duration, hook func(string, int, error), ok, failed BranchState) error {
+	p, err := c.participant(b.Participant)
+	if err == nil {
+		if fn := op(p); fn != nil {
+			err = c.phase2.retryOp(branchContext(ctx, tx.XID, b), b.Participant, fn, retries, delay, hook)
+		}
+	}
+	if err != nil {
+		b.State, b.Error = failed, err.Error()
+	} else {
+		b.State, b.Error = ok, ""
+	}
+	return c.save(ctx, tx)
+}
@@ -0,0 +1,299 @@
+package tcc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/orchestration/tcc"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// timeout 是测试事务的时限,恢复前 sleep 超过它让事务进入可恢复状态。
+const timeout = 20 * time.Millisecond
+
+// crashStore 在第 n 次 Update 时失败,模拟协调器进程在该次落盘前崩溃。
+type crashStore struct {
+	tcc.Store
+	n int
+}
+
+func (s *crashStore) Update(ctx context.Context, tx *tcc.Transaction) error {
+	if s.n--; s.n == 0 {
+		return errors.New("crash")
+	}
+	return s.Store.Update(ctx, tx)
+}
+
+// wallet 是带冻结额度的账户参与方,经 Barrier 包裹。
+func wallet(a *account, b *tcc.Barrier) tcc.Branch {
+	amount := func(ctx context.Context) int64 {
+		var n int64
+		_ = tcc.Payload(ctx, &n)
+		return n
+	}
+	return tcc.Branch{
+		Name: "wallet",
+		Try: b.Try(func(ctx context.Context) error {
+			return a.tryDeduct(amount(ctx))(ctx)
+		}),
+		Confirm: b.Confirm(func(ctx context.Context) error {
+			return a.confirmDeduct(amount(ctx))(ctx)
+		}),
+		Cancel: b.Cancel(func(ctx context.Context) error {
+			return a.cancelDeduct(amount(ctx))(ctx)
+		}),
+	}
+}
+
+func TestCoordinator_Execute(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	a := &account{balance: 100}
+	c := tcc.NewCoordinator(tcc.NewKVStore(kv))
+	c.Register(wallet(a, tcc.NewBarrier(kv)))
+
+	res, err := c.Execute(ctx, "x-1", tcc.Call{Participant: "wallet", Payload: 30}, tcc.Call{Participant: "wallet", Payload: 20})
+	if err != nil || res.Status != tcc.StatusConfirmed {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if a.balance != 50 || a.frozen != 0 {
+		t.Fatalf("account = %+v", a)
+	}
+	// 第二个分支余额不足:已冻结的第一个分支被取消
+	res, err = c.Execute(ctx, "x-2", tcc.Call{Participant: "wallet", Payload: 40}, tcc.Call{Participant: "wallet", Payload: 40})
+	if err != nil || res.Status != tcc.StatusCancelled || res.FailedBranch != "wallet" {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if a.balance != 50 || a.frozen != 0 {
+		t.Fatalf("account = %+v", a)
+	}
+	// 幂等:已终结的事务不再执行
+	if res, err := c.Execute(ctx, "x-1", tcc.Call{Participant: "wallet", Payload: 30}); err != nil || res.Status != tcc.StatusConfirmed || a.balance != 50 {
+		t.Fatalf("res = %+v, err = %v, balance = %d", res, err, a.balance)
+	}
+	if _, err := c.Execute(ctx, "x-3", tcc.Call{Participant: "missing"}); !errors.Is(err, tcc.ErrUnknownParticipant) {
+		t.Fatalf("want ErrUnknownParticipant, got %v", err)
+	}
+}
+
+func TestCoordinator_RecoverConfirm(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	mem := tcc.NewMemoryStore()
+	a := &account{balance: 100}
+
+	// 第 4 次落盘 = 第一个分支 Confirm 之后:决议已落盘,Confirm 已执行但结果未落盘
+	c1 := tcc.NewCoordinator(&crashStore{Store: mem, n: 4}, tcc.WithTimeout(timeout))
+	c1.Register(wallet(a, tcc.NewBarrier(kv)))
+	if _, err := c1.Execute(ctx, "x-1", tcc.Call{Participant: "wallet", Payload: 30}, tcc.Call{Participant: "wallet", Payload: 20}); err == nil {
+		t.Fatal("want crash error")
+	}
+	if tx, _ := mem.Get(ctx, "x-1"); tx.State != tcc.StateConfirming {
+		t.Fatalf("state = %v", tx.State)
+	}
+
+	time.Sleep(2 * timeout)
+	// 重启后按名字重建参与方并继续 Confirm;屏障保证第一个分支不会被重复扣款
+	c2 := tcc.NewCoordinator(mem)
+	c2.Register(wallet(a, tcc.NewBarrier(kv)))
+	if n, err := c2.Recover(ctx); n != 1 || err != nil {
+		t.Fatalf("recovered %d, err = %v", n, err)
+	}
+	if a.balance != 50 || a.frozen != 0 {
+		t.Fatalf("account = %+v", a)
+	}
+	if tx, _ := c2.Get(ctx, "x-1"); tx.State != tcc.StateConfirmed {
+		t.Fatalf("state = %v", tx.State)
+	}
+}
+
+func TestCoordinator_RecoverTimeout(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	mem := tcc.NewMemoryStore()
+	a := &account{balance: 100}
+	barrier := tcc.NewBarrier(kv)
+
+	// 第 2 次落盘 = 第二个分支 Try 之前崩溃:第一个分支已冻结(日志中为 trying),无全局决议
+	c1 := tcc.NewCoordinator(&crashStore{Store: mem, n: 2}, tcc.WithTimeout(timeout))
+	c1.Register(wallet(a, barrier))
+	if _, err := c1.Execute(ctx, "x-1", tcc.Call{Participant: "wallet", Payload: 30}, tcc.Call{Participant: "wallet", Payload: 20}); err == nil {
+		t.Fatal("want crash error")
+	}
+	if a.frozen != 30 {
+		t.Fatalf("frozen = %d", a.frozen)
+	}
+
+	time.Sleep(2 * timeout)
+	c2 := tcc.NewCoordinator(mem)
+	c2.Register(wallet(a, barrier))
+	if n, err := c2.Recover(ctx); n != 1 || err != nil {
+		t.Fatalf("recovered %d, err = %v", n, err)
+	}
+	tx, _ := c2.Get(ctx, "x-1")
+	if tx.State != tcc.StateCancelled || tx.Branches[1].State != tcc.BranchRegistered {
+		t.Fatalf("tx = %+v", tx)
+	}
+	if a.balance != 100 || a.frozen != 0 {
+		t.Fatalf("account = %+v", a)
+	}
+}
+
+func TestCoordinator_CancelRetriedByRecovery(t *testing.T) {
+	ctx := context.Background()
+	mem := tcc.NewMemoryStore()
+	broken := true
+	c := tcc.NewCoordinator(mem, tcc.WithTimeout(timeout))
+	c.Register(tcc.Branch{
+		Name: "stock",
+		Try:  func(context.Context) error { return nil },
+		Cancel: func(context.Context) error {
+			if broken {
+				return errors.New("stock service down")
+			}
+			return nil
+		},
+	}, tcc.Branch{Name: "coupon", Try: func(context.Context) error { return errors.New("expired") }})
+
+	res, err := c.Execute(ctx, "x-1", tcc.Call{Participant: "stock"}, tcc.Call{Participant: "coupon"})
+	if err != nil || res.Status != tcc.StatusCancelFailed || res.Branches[0].CancelErr == nil {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	// 决议已落盘:Cancel 失败的事务保持 cancelling,下一轮恢复重试
+	broken = false
+	time.Sleep(2 * timeout)
+	if n, _ := c.Recover(ctx); n != 1 {
+		t.Fatalf("recovered %d", n)
+	}
+	if tx, _ := c.Get(ctx, "x-1"); tx.State != tcc.StateCancelled {
+		t.Fatalf("state = %v", tx.State)
+	}
+}
+
+func TestBarrier(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	b := tcc.NewBarrier(kv)
+	var tries, cancels, confirms int
+	try := b.Try(func(context.Context) error { tries++; return nil })
+	cancel := b.Cancel(func(context.Context) error { cancels++; return nil })
+	confirm := b.Confirm(func(context.Context) error { confirms++; return nil })
+
+	// 空回滚 + 悬挂:Cancel 先到,业务取消不执行;迟到的 Try 被拒
+	ctx := tcc.NewBranchContext(context.Background(), "x-1", "1")
+	if err := cancel(ctx); err != nil || cancels != 0 {
+		t.Fatalf("empty rollback: err = %v, cancels = %d", err, cancels)
+	}
+	if err := try(ctx); !errors.Is(err, tcc.ErrSuspended) || tries != 0 {
+		t.Fatalf("suspension: err = %v, tries = %d", err, tries)
+	}
+	if err := cancel(ctx); err != nil || cancels != 0 {
+		t.Fatalf("repeated empty rollback: err = %v", err)
+	}
+
+	// 幂等:重复的 Try / Confirm 只执行一次
+	ctx = tcc.NewBranchContext(context.Background(), "x-2", "1")
+	for range 2 {
+		if err := try(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := confirm(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tries != 1 || confirms != 1 {
+		t.Fatalf("tries = %d, confirms = %d", tries, confirms)
+	}
+
+	// 正常取消:Try 之后的 Cancel 执行一次
+	ctx = tcc.NewBranchContext(context.Background(), "x-3", "1")
+	_ = try(ctx)
+	_ = cancel(ctx)
+	_ = cancel(ctx)
+	if cancels != 1 {
+		t.Fatalf("cancels = %d", cancels)
+	}
+	if err := try(context.Background()); !errors.Is(err, tcc.ErrNoBranch) {
+		t.Fatalf("want ErrNoBranch, got %v", err)
+	}
+}
+
+// TestBarrierInFlight:Try 仍在执行时 Cancel 不执行业务取消、返回可重试错误;执行中的重复调用不报成功。
+func TestBarrierInFlight(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	b := tcc.NewBarrier(kv)
+	entered, release := make(chan struct{}), make(chan struct{})
+	var cancels int
+	try := b.Try(func(context.Context) error { close(entered); <-release; return nil })
+	cancel := b.Cancel(func(context.Context) error { cancels++; return nil })
+
+	ctx := tcc.NewBranchContext(context.Background(), "x-9", "1")
+	done := make(chan error, 1)
+	go func() { done <- try(ctx) }()
+	<-entered
+	if err := cancel(ctx); !errors.Is(err, tcc.ErrBranchBusy) || cancels != 0 {
+		t.Fatalf("cancel during try: err = %v, cancels = %d", err, cancels)
+	}
+	if err := try(ctx); !errors.Is(err, tcc.ErrBranchBusy) {
+		t.Fatalf("duplicate in-flight try: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// 预留已落地:重试的 Cancel 执行业务取消,迟到的重复 Try 不再执行
+	if err := cancel(ctx); err != nil || cancels != 1 {
+		t.Fatalf("cancel after try: err = %v, cancels = %d", err, cancels)
+	}
+	if err := try(ctx); err != nil {
+		t.Fatalf("completed try should be idempotent: %v", err)
+	}
+
+	// 租约到期:执行者崩溃留下的"执行中"标记失效,Cancel 可按空回滚完成
+	b = tcc.NewBarrier(kv, tcc.WithBarrierLease(10*time.Millisecond))
+	ctx = tcc.NewBranchContext(context.Background(), "x-10", "1")
+	tryKey := "tcc:b:x-10:1:try"
+	if err := kv.Set(ctx, tryKey, []byte("running"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Cancel(func(context.Context) error { return nil })(ctx); !errors.Is(err, tcc.ErrBranchBusy) {
+		t.Fatalf("cancel within lease: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Cancel(func(context.Context) error { t.Error("empty rollback must not run cancel"); return nil })(ctx); err != nil {
+		t.Fatalf("cancel after lease expiry: %v", err)
+	}
+}
+
+// TestBarrierLeaseLostDuringTry:Try 执行超过租约、期间被空回滚时,收尾不得覆盖空回滚标记,Try 返回 ErrSuspended。
+func TestBarrierLeaseLostDuringTry(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+	b := tcc.NewBarrier(kv, tcc.WithBarrierLease(10*time.Millisecond))
+	ctx := tcc.NewBranchContext(context.Background(), "x-11", "1")
+	entered, release := make(chan struct{}), make(chan struct{})
+	try := b.Try(func(context.Context) error { close(entered); <-release; return nil })
+	done := make(chan error, 1)
+	go func() { done <- try(ctx) }()
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Cancel(func(context.Context) error { t.Error("empty rollback must not run cancel"); return nil })(ctx); err != nil {
+		t.Fatalf("cancel after lease expiry: %v", err)
+	}
+	close(release)
+	if err := <-done; !errors.Is(err, tcc.ErrSuspended) {
+		t.Fatalf("try finishing after empty rollback: %v", err)
+	}
+	if v, _, _ := kv.Get(ctx, "tcc:b:x-11:1:try"); string(v) != "cancel" {
+		t.Fatalf("empty rollback marker overwritten: %q", v)
+	}
+	if err := b.Try(func(context.Context) error { return nil })(ctx); !errors.Is(err, tcc.ErrSuspended) {
+		t.Fatalf("late try: %v", err)
+	}
+}
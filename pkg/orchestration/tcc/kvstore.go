@@ -0,0 +1,80 @@
+package tcc
+
+import (
+	"context"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/orchestration/internal/kvrecord"
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// KVStore 是基于 kvstore.Store 的 Store 实现,多个协调器共享同一后端(如 Redis)即可跨进程恢复。
+//
+// kvstore 没有列举与 CAS 原语,因此:
+//   - List 依赖一个自增序号索引(<prefix>seq + <prefix>x:<n> → xid)顺序扫描,
+//     已过期事务的索引在扫描时顺带清理;适合"进行中事务 + 近期终态"规模,不适合海量历史查询;
+//   - Update 用 SetNX 短锁(<prefix>l:<xid>)保护"读版本-写入",锁被占用即返回 ErrConflict。
+//
+// 零值不可用,用 NewKVStore 构造。
+type KVStore struct {
+	rec       kvrecord.Store[Transaction]
+	prefix    string
+	retention time.Duration
+}
+
+// KVOption 配置 KVStore。
+type KVOption func(*KVStore)
+
+// WithPrefix 设置键前缀,默认 "tcc:"。
+func WithPrefix(prefix string) KVOption {
+	return func(s *KVStore) { s.prefix = prefix }
+}
+
+// WithRetention 设置 confirmed / cancelled 事务的保留时长,默认 7 天;<=0 表示永久保留。
+// 未终结的事务永不过期(等待恢复)。
+func WithRetention(d time.Duration) KVOption {
+	return func(s *KVStore) { s.retention = d }
+}
+
+// NewKVStore 创建基于 kv 的 Store。
+func NewKVStore(kv kvstore.Store, opts ...KVOption) *KVStore {
+	s := &KVStore{prefix: "tcc:", retention: 7 * 24 * time.Hour}
+	for _, o := range opts {
+		o(s)
+	}
+	s.rec = kvrecord.Store[Transaction]{
+		KV:          kv,
+		Prefix:      s.prefix,
+		ID:          func(tx *Transaction) string { return tx.XID },
+		Version:     func(tx *Transaction) *int64 { return &tx.Version },
+		TTL:         s.ttl,
+		ErrNotFound: ErrNotFound,
+		ErrExists:   ErrExists,
+		ErrConflict: ErrConflict,
+	}
+	return s
+}
+
+func (s *KVStore) ttl(tx *Transaction) time.Duration {
+	if tx.State.Terminal() {
+		return s.retention
+	}
+	return 0
+}
+
+func (s *KVStore) Create(ctx context.Context, tx *Transaction) error { return s.rec.Create(ctx, tx) }
+
+func (s *KVStore) Update(ctx context.Context, tx *Transaction) error { return s.rec.Update(ctx, tx) }
+
+func (s *KVStore) Get(ctx context.Context, xid string) (*Transaction, error) {
+	return s.rec.Get(ctx, xid)
+}
+
+// List 从低水位(<prefix>lo)扫描到当前序号;从低水位起连续失效的索引在扫描后推进低水位跳过。
+func (s *KVStore) List(ctx context.Context, f Filter) ([]*Transaction, error) {
+	out, err := s.rec.Scan(ctx, f.Match)
+	if err != nil {
+		return nil, err
+	}
+	return limit(sortByDeadline(out), f.Limit), nil
+}
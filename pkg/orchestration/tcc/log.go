@@ -0,0 +1,148 @@
+package tcc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// State 是持久化事务的全局状态。trying 阶段未做出决议;confirming / cancelling 表示
+// 全局决议已落盘(此后只会向该方向推进);confirmed / cancelled 为终态。
+type State string
+
+const (
+	StateTrying     State = "trying"
+	StateConfirming State = "confirming"
+	StateCancelling State = "cancelling"
+	StateConfirmed  State = "confirmed"
+	StateCancelled  State = "cancelled"
+)
+
+// Terminal 报告是否为终态。
+func (s State) Terminal() bool { return s == StateConfirmed || s == StateCancelled }
+
+// BranchState 是单个分支的持久化状态。
+type BranchState string
+
+const (
+	BranchRegistered    BranchState = "registered" // 已登记,尚未 Try
+	BranchTrying        BranchState = "trying"     // Try 已发出、结果未落盘:结果未知,取消时照常 Cancel
+	BranchTried         BranchState = "tried"      // Try 成功
+	BranchTryFailed     BranchState = "try_failed" // Try 返回错误(可能已在参与方生效,如超时),取消时照常 Cancel
+	BranchConfirmed     BranchState = "confirmed"
+	BranchConfirmFailed BranchState = "confirm_failed"
+	BranchCancelled     BranchState = "cancelled"
+	BranchCancelFailed  BranchState = "cancel_failed"
+)
+
+// BranchRecord 是单个分支的持久化记录。
+type BranchRecord struct {
+	ID          string          `json:"id"`          // 事务内的分支 ID(从 "1" 起),与 XID 一起作为参与方的幂等 / 屏障键
+	Participant string          `json:"participant"` // 经 Coordinator.Register 注册的参与方名
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	State       BranchState     `json:"state"`
+	TryError    string          `json:"try_error,omitempty"`
+	Error       string          `json:"error,omitempty"` // Confirm / Cancel 的最后一次错误
+	TryDuration time.Duration   `json:"try_duration,omitempty"`
+}
+
+// Transaction 是一笔 TCC 事务的日志:分支登记、各分支 Try 结果与全局决议。
+type Transaction struct {
+	XID          string         `json:"xid"`
+	State        State          `json:"state"`
+	Branches     []BranchRecord `json:"branches"`
+	Deadline     time.Time      `json:"deadline"`                // Try 阶段截止时间,过期未决议的事务由恢复流程取消
+	Error        string         `json:"error,omitempty"`         // 触发取消的原因
+	FailedBranch string         `json:"failed_branch,omitempty"` // Try 失败的参与方名
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	Version      int64          `json:"version"` // 乐观锁版本,由 Store 维护
+}
+
+// Result 把事务日志转为与 Tx.Execute 相同形态的 Result。
+// confirming / cancelling 状态(第二阶段仍有分支失败、等待恢复重试)分别对应
+// StatusConfirmFailed / StatusCancelFailed;trying 状态的 Status 无意义。
+func (tx *Transaction) Result() *Result {
+	res := &Result{FailedBranch: tx.FailedBranch}
+	switch tx.State {
+	case StateConfirmed:
+		res.Status = StatusConfirmed
+	case StateConfirming:
+		res.Status = StatusConfirmFailed
+	case StateCancelled:
+		res.Status = StatusCancelled
+	case StateCancelling:
+		res.Status = StatusCancelFailed
+	}
+	if tx.Error != "" {
+		res.Err = errors.New(tx.Error)
+	}
+	var confirmErrs []error
+	for _, b := range tx.Branches {
+		br := BranchResult{Name: b.Participant, TryDur: b.TryDuration}
+		if b.TryError != "" {
+			br.TryErr = errors.New(b.TryError)
+		}
+		switch b.State {
+		case BranchConfirmed:
+			br.Confirmed = true
+		case BranchConfirmFailed:
+			br.Confirmed, br.ConfirmErr = true, errors.New(b.Error)
+			confirmErrs = append(confirmErrs, errors.New("confirm "+b.Participant+": "+b.Error))
+		case BranchCancelled:
+			br.Cancelled = true
+		case BranchCancelFailed:
+			br.Cancelled, br.CancelErr = true, errors.New(b.Error)
+		}
+		res.Branches = append(res.Branches, br)
+	}
+	if res.Err == nil && len(confirmErrs) > 0 {
+		res.Err = errors.Join(confirmErrs...)
+	}
+	return res
+}
+
+type branchRef struct {
+	xid     string
+	branch  string
+	payload json.RawMessage
+}
+
+var branchKey = ctxkey.New[branchRef]()
+
+// NewBranchContext 在 ctx 中标记当前所处的事务分支。Coordinator 调用参与方时已自动设置;
+// 参与方在远端服务时,由远端把随请求传来的 xid / branch 还原到 ctx,供 Barrier 使用。
+func NewBranchContext(ctx context.Context, xid, branch string) context.Context {
+	return ctxkey.With(ctx, branchKey, branchRef{xid: xid, branch: branch})
+}
+
+// XID 返回当前分支所属事务的 XID(不在分支内为空)。
+func XID(ctx context.Context) string {
+	ref, _ := ctxkey.Get(ctx, branchKey)
+	return ref.xid
+}
+
+// BranchID 返回当前分支 ID(不在分支内为空)。
+func BranchID(ctx context.Context) string {
+	ref, _ := ctxkey.Get(ctx, branchKey)
+	return ref.branch
+}
+
+// Payload 把 Coordinator.Execute 时该分支的 Call.Payload 解码到 v。无负载时 v 保持不变。
+func Payload(ctx context.Context, v any) error {
+	ref, ok := ctxkey.Get(ctx, branchKey)
+	if !ok {
+		return ErrNoBranch
+	}
+	if len(ref.payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(ref.payload, v)
+}
+
+func branchContext(ctx context.Context, xid string, b *BranchRecord) context.Context {
+	return ctxkey.With(ctx, branchKey, branchRef{xid: xid, branch: b.ID, payload: b.Payload})
+}
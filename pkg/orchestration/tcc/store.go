@@ -0,0 +1,145 @@
+package tcc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound 事务不存在。
+	ErrNotFound = errors.New("tcc: transaction not found")
+	// ErrExists Create 时 XID 已存在。
+	ErrExists = errors.New("tcc: transaction already exists")
+	// ErrConflict Update 时版本不匹配(事务已被其它协调器推进)。
+	ErrConflict = errors.New("tcc: transaction version conflict")
+)
+
+// Store 持久化 TCC 事务日志。实现须并发安全;多个协调器共享同一 Store 时,
+// Update 的版本校验保证同一事务同时只有一方能推进。
+type Store interface {
+	// Create 写入新事务(Version 置 1);XID 已存在返回 ErrExists。
+	Create(ctx context.Context, tx *Transaction) error
+	// Update 当存储中的 Version 等于 tx.Version 时写入并把 tx.Version 加 1,否则返回 ErrConflict。
+	Update(ctx context.Context, tx *Transaction) error
+	// Get 读取事务;不存在返回 ErrNotFound。
+	Get(ctx context.Context, xid string) (*Transaction, error)
+	// List 按 Filter 列出事务,按 Deadline 升序。
+	List(ctx context.Context, f Filter) ([]*Transaction, error)
+}
+
+// Filter 是 Store.List 的查询条件,零值字段不参与过滤。
+type Filter struct {
+	States         []State   // 状态之一
+	DeadlineBefore time.Time // Deadline 早于该时刻(恢复扫描用来挑出超时事务)
+	Limit          int       // 最多返回条数
+}
+
+// Match 报告 tx 是否满足过滤条件(不含 Limit),供 Store 实现复用。
+func (f Filter) Match(tx *Transaction) bool {
+	if len(f.States) > 0 && !slices.Contains(f.States, tx.State) {
+		return false
+	}
+	if !f.DeadlineBefore.IsZero() && !tx.Deadline.Before(f.DeadlineBefore) {
+		return false
+	}
+	return true
+}
+
+// MemoryStore 是 Store 的内存实现(单进程、进程重启即丢),用于测试与单机。
+// 零值不可用,用 NewMemoryStore 构造。
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+// NewMemoryStore 创建内存 Store。事务以 JSON 保存,读写都是副本。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string][]byte)}
+}
+
+func (m *MemoryStore) Create(_ context.Context, tx *Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[tx.XID]; ok {
+		return ErrExists
+	}
+	tx.Version = 1
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	m.items[tx.XID] = b
+	return nil
+}
+
+func (m *MemoryStore) Update(_ context.Context, tx *Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, err := m.decode(tx.XID)
+	if err != nil {
+		return err
+	}
+	if cur.Version != tx.Version {
+		return ErrConflict
+	}
+	next := *tx
+	next.Version++
+	b, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	m.items[tx.XID] = b
+	tx.Version = next.Version
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, xid string) (*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.decode(xid)
+}
+
+func (m *MemoryStore) List(_ context.Context, f Filter) ([]*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*Transaction
+	for xid := range m.items {
+		tx, err := m.decode(xid)
+		if err != nil {
+			return nil, err
+		}
+		if f.Match(tx) {
+			out = append(out, tx)
+		}
+	}
+	return limit(sortByDeadline(out), f.Limit), nil
+}
+
+func (m *MemoryStore) decode(xid string) (*Transaction, error) {
+	b, ok := m.items[xid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	tx := new(Transaction)
+	if err := json.Unmarshal(b, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func sortByDeadline(list []*Transaction) []*Transaction {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Deadline.Before(list[j].Deadline) })
+	return list
+}
+
+func limit(list []*Transaction, n int) []*Transaction {
+	if n > 0 && len(list) > n {
+		return list[:n]
+	}
+	return list
+}
@@ -23,7 +23,9 @@
 //   - Try 必须幂等且可安全 Cancel:Cancel 释放 Try 冻结的资源;
 //   - Confirm 必须幂等:Confirm 可能因重试重复调用;
 //   - Cancel 必须幂等:Cancel 是最终一致性的兜底;
-//   - 本包不持久化(纯内存编排):进程崩溃则进行中的 TCC 丢失,须靠幂等+重投恢复。
+//   - Tx.Execute 不持久化(纯内存编排):Try 与 Confirm 之间进程崩溃,已冻结的资源永远不会释放。
+//     需要崩溃恢复时改用 Coordinator:分支登记、Try 结果与全局决议写入 Store(NewMemoryStore /
+//     NewKVStore),后台按 Deadline 重新驱动 Confirm 或 Cancel;参与方侧用 Barrier 防空回滚与悬挂。
 //
 // 并发安全:一个 Tx 的 Execute 非并发安全;不同 Tx 实例相互独立。
 // 零值不可用:用 New 构造。
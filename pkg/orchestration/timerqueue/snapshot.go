@@ -0,0 +1,161 @@
+package timerqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+// SnapshotStore 保存待执行任务的快照。
+type SnapshotStore interface {
+	// Load 读取最近一次快照;从未保存过返回 (nil, nil)。
+	Load(ctx context.Context) ([]byte, error)
+	// Save 整体覆盖快照。
+	Save(ctx context.Context, data []byte) error
+}
+
+// WithSnapshot 开启快照:Start 时从 store 恢复待执行任务,每 interval 保存一次
+// (<= 0 只在停止时保存),停止时再保存一次。
+//
+// 只有带 Kind 的任务(AddTask)进入快照;回调须在 Start 前用 Handle 注册。
+// 恢复时已过期的任务在启动后第一个 tick 触发;两次保存之间新增/取消的任务在崩溃时会丢失
+// 或重复触发,回调应幂等。
+func WithSnapshot(store SnapshotStore, interval time.Duration) Option {
+	return func(q *Queue) {
+		q.snapStore = store
+		q.snapInterval = interval
+	}
+}
+
+// snapshotTask 是快照中的一个任务。
+type snapshotTask struct {
+	ID        string    `json:"id,omitempty"`
+	ExecuteAt time.Time `json:"at"`
+	Kind      string    `json:"kind"`
+	Data      []byte    `json:"data,omitempty"`
+}
+
+type snapshot struct {
+	seq   uint64
+	tasks []snapshotTask
+}
+
+// collect 在主循环内复制可持久化的任务。
+func (q *Queue) collect(eng engine) snapshot {
+	q.snapSeq++
+	snap := snapshot{seq: q.snapSeq, tasks: make([]snapshotTask, 0, eng.len())}
+	eng.each(func(t *Task) {
+		if t.Kind != "" {
+			snap.tasks = append(snap.tasks, snapshotTask{ID: t.ID, ExecuteAt: t.ExecuteAt, Kind: t.Kind, Data: t.Data})
+		}
+	})
+	return snap
+}
+
+// save 写入快照;比已写入的更旧的快照(并发的周期保存晚于停止时的保存)直接丢弃。
+func (q *Queue) save(ctx context.Context, snap snapshot) error {
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+	if snap.seq <= q.savedSeq {
+		return nil
+	}
+	data, err := json.Marshal(snap.tasks)
+	if err != nil {
+		return err
+	}
+	if err := q.snapStore.Save(ctx, data); err != nil {
+		return err
+	}
+	q.savedSeq = snap.seq
+	return nil
+}
+
+func (q *Queue) restore(ctx context.Context, push func(*Task)) error {
+	data, err := q.snapStore.Load(ctx)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	var tasks []snapshotTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return err
+	}
+	for _, st := range tasks {
+		push(&Task{ID: st.ID, ExecuteAt: st.ExecuteAt, Kind: st.Kind, Data: st.Data})
+	}
+	return nil
+}
+
+// SaveSnapshot 立即保存一次快照(如发布前)。队列须已启动且配置了 WithSnapshot。
+func (q *Queue) SaveSnapshot(ctx context.Context) error {
+	if q.snapStore == nil {
+		return errors.New("timerqueue: snapshot not configured")
+	}
+	reply := make(chan snapshot, 1)
+	select {
+	case q.cmdCh <- command{snap: reply}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case snap := <-reply:
+		return q.save(ctx, snap)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileSnapshot 把快照保存到 path(写临时文件后 rename,崩溃不会留下半个文件)。
+func FileSnapshot(path string) SnapshotStore { return fileSnapshot(path) }
+
+type fileSnapshot string
+
+func (p fileSnapshot) Load(context.Context) ([]byte, error) {
+	data, err := os.ReadFile(string(p))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (p fileSnapshot) Save(_ context.Context, data []byte) error {
+	tmp := string(p) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(p))
+}
+
+// KVSnapshot 把快照保存到 kvstore 的 key(不过期),便于多机共享存储或迁移实例。
+func KVSnapshot(store kvstore.Store, key string) SnapshotStore {
+	return &kvSnapshot{store: store, key: key}
+}
+
+type kvSnapshot struct {
+	store kvstore.Store
+	key   string
+}
+
+func (s *kvSnapshot) Load(ctx context.Context) ([]byte, error) {
+	data, _, err := s.store.Get(ctx, s.key)
+	return data, err
+}
+
+func (s *kvSnapshot) Save(ctx context.Context, data []byte) error {
+	return s.store.Set(ctx, s.key, data, 0)
+}
@@ -0,0 +1,65 @@
+package timerqueue
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/store/kvstore"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	kv := kvstore.NewMemory()
+	defer kv.Stop()
+
+	for name, store := range map[string]SnapshotStore{
+		"file": FileSnapshot(filepath.Join(t.TempDir(), "timers.json")),
+		"kv":   KVSnapshot(kv, "timers:building"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// 第一个进程:登记两个建筑倒计时后停机
+			q1 := New(WithResolution(10*time.Millisecond), WithSnapshot(store, 0))
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- q1.Start(ctx) }()
+			<-q1.Ready()
+			q1.AddTask(Task{ID: "castle", ExecuteAt: time.Now().Add(50 * time.Millisecond), Kind: "build", Data: []byte("lv2")})
+			q1.AddTask(Task{ID: "farm", ExecuteAt: time.Now().Add(time.Hour), Kind: "build", Data: []byte("lv3")})
+			q1.Add("mem-only", time.Hour, func() {}) // 无 Kind,不进快照
+			if err := q1.SaveSnapshot(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			// 第二个进程:恢复后 castle 到期,farm 仍在等待
+			var mu sync.Mutex
+			fired := map[string]string{}
+			q2 := New(WithResolution(10*time.Millisecond), WithTimingWheel(0), WithSnapshot(store, 0))
+			q2.Handle("build", func(id string, data []byte) {
+				mu.Lock()
+				fired[id] = string(data)
+				mu.Unlock()
+			})
+			ctx2, cancel2 := context.WithCancel(context.Background())
+			done2 := make(chan error, 1)
+			go func() { done2 <- q2.Start(ctx2) }()
+			<-q2.Ready()
+			defer func() { cancel2(); <-done2 }()
+
+			if p := q2.Pending(); p != 2 {
+				t.Fatalf("restored pending = %d, want 2", p)
+			}
+			time.Sleep(150 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if len(fired) != 1 || fired["castle"] != "lv2" {
+				t.Fatalf("fired = %v, want castle:lv2", fired)
+			}
+		})
+	}
+}
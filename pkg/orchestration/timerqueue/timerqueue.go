@@ -1,5 +1,5 @@
-// Package timerqueue 提供基于最小堆的延时任务队列,由单协程驱动,适用于海量
-// 倒计时场景(如 SLG 建筑升级、科技研究、造兵、Buff 过期等)。
+// Package timerqueue 提供基于最小堆(或分层时间轮)的延时任务队列,由单协程驱动,
+// 适用于海量倒计时场景(如 SLG 建筑升级、科技研究、造兵、Buff 过期等)。
 //
 // 与 pkg/service/cron 的区别:cron 按 cron 表达式周期触发(少量定时),
 // timerqueue 按绝对到期时间调度(万级一次性倒计时),内部用最小堆而非每任务
@@ -12,6 +12,12 @@
 // channel 串行提交,无锁竞争。回调默认在独立 goroutine 中异步执行,不阻塞
 // 时间轴。精度由 WithResolution 控制(默认 100ms)。
 //
+// 调度结构:默认最小堆,添加/取消 O(log n);百万级定时器时用 WithTimingWheel 换成
+// 分层时间轮,添加/取消 O(1),到期精度为槽宽(tick)。两者 API 与语义一致。
+//
+// 持久化:带 Kind 的任务(AddTask,回调由 Handle 按 Kind 注册)可随 WithSnapshot
+// 周期性快照到文件或 kvstore,Start 时恢复,使倒计时跨进程重启存活。
+//
 // 实现 beauty.Service(Start/String)+ ReadyNotifier,可直接
 // beauty.WithService(queue) 挂进框架,随 app 优雅停机。
 //
@@ -21,6 +27,7 @@ package timerqueue
 import (
 	"container/heap"
 	"context"
+	"fmt"
 	"log/slog"
 	"runtime/debug"
 	"sync"
@@ -40,7 +47,17 @@ type Task struct {
 	// 可改为同步,但会阻塞时间轴——仅当回调极轻量时使用)。
 	Fn func()
 
-	index int // heap 内部索引
+	// Kind 非空且 Fn 为空时,到期执行 Handle(Kind) 注册的回调。只有带 Kind 的任务
+	// 会写入快照(函数无法序列化)。
+	Kind string
+
+	// Data 随任务持久化的业务数据,到期时传给 Kind 对应的回调。
+	Data []byte
+
+	index      int     // heap 内部索引
+	tick       int64   // 时间轮:到期 tick
+	prev, next *Task   // 时间轮:槽内双向链表
+	b          *bucket // 时间轮:所在槽
 }
 
 // taskHeap 最小堆,按 ExecuteAt 升序。
@@ -70,10 +87,41 @@ func (h *taskHeap) Pop() any {
 	return t
 }
 
+// engine 是主循环使用的调度结构,只在主循环 goroutine 内访问。
+type engine interface {
+	push(t *Task)
+	remove(t *Task)
+	// advance 把 now 时已到期的任务追加到 due 并返回。
+	advance(now time.Time, due []*Task) []*Task
+	len() int
+	each(fn func(*Task))
+}
+
+// heapEngine 是基于最小堆的 engine,添加/取消 O(log n)。
+type heapEngine struct{ h taskHeap }
+
+func (e *heapEngine) push(t *Task)   { heap.Push(&e.h, t) }
+func (e *heapEngine) remove(t *Task) { heap.Remove(&e.h, t.index) }
+func (e *heapEngine) len() int       { return e.h.Len() }
+
+func (e *heapEngine) advance(now time.Time, due []*Task) []*Task {
+	for e.h.Len() > 0 && !now.Before(e.h[0].ExecuteAt) {
+		due = append(due, heap.Pop(&e.h).(*Task))
+	}
+	return due
+}
+
+func (e *heapEngine) each(fn func(*Task)) {
+	for _, t := range e.h {
+		fn(t)
+	}
+}
+
 // command 是通过 channel 串行提交给主循环的操作。
 type command struct {
-	add    *Task  // 非 nil 表示添加
-	cancel string // 非空表示取消(按 ID)
+	add    *Task         // 非 nil 表示添加
+	cancel string        // 非空表示取消(按 ID)
+	snap   chan snapshot // 非 nil 表示取快照
 }
 
 // Queue 是最小堆延时任务队列。零值不可用,用 New 构造。
@@ -82,7 +130,18 @@ type Queue struct {
 	resolution time.Duration
 	chanSize   int
 	syncCb     bool
+	batchSize  int
 	onPanic    func(taskID string, r any, stack []byte)
+	wheel      *wheelConfig
+
+	snapStore    SnapshotStore
+	snapInterval time.Duration
+	snapSeq      uint64 // 主循环内递增
+	saveMu       sync.Mutex
+	savedSeq     uint64
+
+	handlersMu sync.RWMutex
+	handlers   map[string]func(id string, data []byte)
 
 	cmdCh     chan command
 	ready     chan struct{}
@@ -128,6 +187,17 @@ func WithSyncCallback(sync bool) Option {
 	return func(q *Queue) { q.syncCb = sync }
 }
 
+// WithBatchSize 设置异步回调的批量大小:同一轮到期的任务每 n 个在一个 goroutine 中
+// 依次执行,减少海量定时器同时到期时的 goroutine 创建。默认 1(每个任务一个 goroutine)。
+// 批内一个慢回调会推迟同批后续回调。WithSyncCallback 时不生效。
+func WithBatchSize(n int) Option {
+	return func(q *Queue) {
+		if n > 0 {
+			q.batchSize = n
+		}
+	}
+}
+
 // WithPanicHandler 设置回调 panic 时的恢复处理。默认仅 slog.Error。
 func WithPanicHandler(fn func(taskID string, r any, stack []byte)) Option {
 	return func(q *Queue) { q.onPanic = fn }
@@ -139,10 +209,15 @@ func New(opts ...Option) *Queue {
 		name:       "timerqueue",
 		resolution: 100 * time.Millisecond,
 		chanSize:   1024,
+		batchSize:  1,
+		handlers:   make(map[string]func(id string, data []byte)),
 	}
 	for _, o := range opts {
 		o(q)
 	}
+	if q.wheel != nil && q.wheel.tick <= 0 {
+		q.wheel.tick = q.resolution
+	}
 	q.cmdCh = make(chan command, q.chanSize)
 	q.ready = make(chan struct{})
 	return q
@@ -157,17 +232,31 @@ func (q *Queue) Add(id string, delay time.Duration, fn func()) bool {
 
 // AddAt 添加一个在绝对时刻 executeAt 到期的任务。
 func (q *Queue) AddAt(id string, executeAt time.Time, fn func()) bool {
-	if fn == nil {
+	return q.AddTask(Task{ID: id, ExecuteAt: executeAt, Fn: fn})
+}
+
+// AddTask 添加任务。Fn 与 Kind 至少设置一个;只设置 Kind 的任务到期时执行
+// Handle(Kind) 注册的回调,并会写入快照。同 ID 的未到期任务被替换。
+func (q *Queue) AddTask(t Task) bool {
+	if t.Fn == nil && t.Kind == "" {
 		return false
 	}
 	select {
-	case q.cmdCh <- command{add: &Task{ID: id, ExecuteAt: executeAt, Fn: fn}}:
+	case q.cmdCh <- command{add: &Task{ID: t.ID, ExecuteAt: t.ExecuteAt, Fn: t.Fn, Kind: t.Kind, Data: t.Data}}:
 		return true
 	default:
 		return false
 	}
 }
 
+// Handle 注册 kind 类任务的到期回调,应在 Start 之前调用(从快照恢复的任务到期时才能找到)。
+// 到期时找不到回调的任务会被丢弃并记录日志。
+func (q *Queue) Handle(kind string, fn func(id string, data []byte)) {
+	q.handlersMu.Lock()
+	q.handlers[kind] = fn
+	q.handlersMu.Unlock()
+}
+
 // Cancel 取消指定 ID 的任务。尚未到期的任务被移除;已到期/已执行的无效果。
 // 返回 false 表示命令 channel 已满或队列已停止。
 func (q *Queue) Cancel(id string) bool {
@@ -186,12 +275,37 @@ func (q *Queue) Cancel(id string) bool {
 func (q *Queue) Pending() int64 { return q.pending.Load() }
 
 // Start 启动主循环,直到 ctx 取消——满足 beauty.Service。
+// 配置了 WithSnapshot 时先从快照恢复(失败返回 error),停止时再写一次快照。
 func (q *Queue) Start(ctx context.Context) error {
-	q.readyOnce.Do(func() { close(q.ready) })
+	var eng engine = &heapEngine{}
+	if q.wheel != nil {
+		eng = newWheel(time.Now(), q.wheel.tick, q.wheel.sizes)
+	}
+	idIndex := make(map[string]*Task) // ID → 待执行的 Task(用于取消与替换)
+
+	push := func(t *Task) {
+		if t.ID != "" {
+			if old, ok := idIndex[t.ID]; ok {
+				eng.remove(old)
+			}
+			idIndex[t.ID] = t
+		}
+		eng.push(t)
+	}
 
-	h := make(taskHeap, 0)
-	heap.Init(&h)
-	idIndex := make(map[string]*Task) // ID → heap 中的 Task(用于 O(log n) 取消)
+	var snapC <-chan time.Time
+	if q.snapStore != nil {
+		if err := q.restore(ctx, push); err != nil {
+			return fmt.Errorf("timerqueue: restore snapshot: %w", err)
+		}
+		q.pending.Store(int64(eng.len()))
+		if q.snapInterval > 0 {
+			t := time.NewTicker(q.snapInterval)
+			defer t.Stop()
+			snapC = t.C
+		}
+	}
+	q.readyOnce.Do(func() { close(q.ready) })
 
 	ticker := time.NewTicker(q.resolution)
 	defer ticker.Stop()
@@ -199,54 +313,71 @@ func (q *Queue) Start(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
+			if q.snapStore != nil {
+				if err := q.save(context.Background(), q.collect(eng)); err != nil {
+					slog.Warn("timerqueue: save snapshot failed", "queue", q.name, "error", err)
+				}
+			}
 			q.pending.Store(0)
 			return nil
 
 		case cmd := <-q.cmdCh:
 			if cmd.add != nil {
-				t := cmd.add
-				if t.ID != "" {
-					if old, ok := idIndex[t.ID]; ok {
-						heap.Remove(&h, old.index)
-						delete(idIndex, t.ID)
-					}
-					idIndex[t.ID] = t
-				}
-				heap.Push(&h, t)
-				q.pending.Store(int64(h.Len()))
+				push(cmd.add)
 			}
 			if cmd.cancel != "" {
 				if t, ok := idIndex[cmd.cancel]; ok {
-					heap.Remove(&h, t.index)
+					eng.remove(t)
 					delete(idIndex, cmd.cancel)
-					q.pending.Store(int64(h.Len()))
 				}
 			}
+			if cmd.snap != nil {
+				cmd.snap <- q.collect(eng)
+			}
+			q.pending.Store(int64(eng.len()))
 
-		case now := <-ticker.C:
-			for h.Len() > 0 {
-				top := h[0]
-				if now.Before(top.ExecuteAt) {
-					break
+		case <-snapC:
+			go func(snap snapshot) {
+				if err := q.save(context.Background(), snap); err != nil {
+					slog.Warn("timerqueue: save snapshot failed", "queue", q.name, "error", err)
 				}
-				t := heap.Pop(&h).(*Task)
-				if t.ID != "" {
+			}(q.collect(eng))
+
+		case now := <-ticker.C:
+			due := eng.advance(now, nil)
+			for _, t := range due {
+				if t.ID != "" && idIndex[t.ID] == t {
 					delete(idIndex, t.ID)
 				}
-				q.fire(t)
 			}
-			q.pending.Store(int64(h.Len()))
+			q.dispatch(due)
+			q.pending.Store(int64(eng.len()))
 		}
 	}
 }
 
-// fire 触发到期任务的回调。
-func (q *Queue) fire(t *Task) {
+// dispatch 触发一轮到期任务的回调:同步模式逐个执行,异步模式按 batchSize 分批起 goroutine。
+func (q *Queue) dispatch(due []*Task) {
 	if q.syncCb {
-		q.safeCall(t)
+		for _, t := range due {
+			q.safeCall(t)
+		}
 		return
 	}
-	go q.safeCall(t)
+	for len(due) > 0 {
+		n := min(q.batchSize, len(due))
+		batch := due[:n:n]
+		due = due[n:]
+		if n == 1 {
+			go q.safeCall(batch[0])
+			continue
+		}
+		go func() {
+			for _, t := range batch {
+				q.safeCall(t)
+			}
+		}()
+	}
 }
 
 // safeCall 带 panic recovery 地执行回调。
@@ -262,7 +393,18 @@ func (q *Queue) safeCall(t *Task) {
 			}
 		}
 	}()
-	t.Fn()
+	if t.Fn != nil {
+		t.Fn()
+		return
+	}
+	q.handlersMu.RLock()
+	fn := q.handlers[t.Kind]
+	q.handlersMu.RUnlock()
+	if fn == nil {
+		slog.Warn("timerqueue: no handler for task kind", "queue", q.name, "task", t.ID, "kind", t.Kind)
+		return
+	}
+	fn(t.ID, t.Data)
 }
 
 // Ready 在主循环启动后关闭——满足 beauty.ReadyNotifier。
@@ -0,0 +1,181 @@
+package timerqueue
+
+import "time"
+
+// wheelConfig 是 WithTimingWheel 的配置。
+type wheelConfig struct {
+	tick  time.Duration
+	sizes []int64
+}
+
+// WithTimingWheel 改用分层时间轮调度:添加/取消 O(1),适合百万级定时器。
+//
+// tick 为最底层的槽宽,即到期精度(任务在 ExecuteAt 之后的第一个 tick 边界触发,不会提前);
+// <= 0 时取 WithResolution。sizes 为由低到高各层的槽数,默认 256, 64, 64, 64
+// (tick=100ms 时覆盖约 77 天,更远的任务放在溢出链表,顶层转完一圈时重新分配)。
+// 轮询间隔仍为 WithResolution,建议与 tick 相同。
+func WithTimingWheel(tick time.Duration, sizes ...int) Option {
+	return func(q *Queue) {
+		cfg := &wheelConfig{tick: tick}
+		for _, n := range sizes {
+			if n > 0 {
+				cfg.sizes = append(cfg.sizes, int64(n))
+			}
+		}
+		if len(cfg.sizes) == 0 {
+			cfg.sizes = []int64{256, 64, 64, 64}
+		}
+		q.wheel = cfg
+	}
+}
+
+// bucket 是时间轮的一个槽:侵入式双向链表,摘除 O(1)。
+type bucket struct{ head, tail *Task }
+
+func (b *bucket) push(t *Task) {
+	t.b, t.prev, t.next = b, b.tail, nil
+	if b.tail != nil {
+		b.tail.next = t
+	} else {
+		b.head = t
+	}
+	b.tail = t
+}
+
+func (b *bucket) remove(t *Task) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		b.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	} else {
+		b.tail = t.prev
+	}
+	t.b, t.prev, t.next = nil, nil, nil
+}
+
+// drain 清空槽,按加入顺序对每个任务调用 fn(调用时任务已脱链)。
+func (b *bucket) drain(fn func(*Task)) {
+	t := b.head
+	b.head, b.tail = nil, nil
+	for t != nil {
+		next := t.next
+		t.b, t.prev, t.next = nil, nil, nil
+		fn(t)
+		t = next
+	}
+}
+
+func (b *bucket) each(fn func(*Task)) {
+	for t := b.head; t != nil; t = t.next {
+		fn(t)
+	}
+}
+
+// wheel 是分层时间轮 engine。
+//
+// 时间以 tick 计(相对 origin)。第 l 层每槽跨 spans[l] 个 tick(spans[0]=1,
+// spans[l+1]=spans[l]*sizes[l])。到期 tick 为 e 的任务放在满足"e 与当前 tick 同属一个
+// spans[l+1] 区间"的最低层 l 的第 (e/spans[l])%sizes[l] 槽;当前 tick 走到该槽的起点时,
+// 槽内任务被重新分配(降到更低层),最终在第 0 层对应槽触发。
+type wheel struct {
+	origin time.Time
+	tick   time.Duration
+	cur    int64 // 已推进到的 tick
+	sizes  []int64
+	spans  []int64
+	levels [][]bucket
+
+	ready    bucket // 加入时已到期,下次 advance 触发
+	overflow bucket // 超出顶层一圈
+	n        int
+}
+
+func newWheel(origin time.Time, tick time.Duration, sizes []int64) *wheel {
+	w := &wheel{origin: origin, tick: tick, sizes: sizes}
+	w.spans = make([]int64, len(sizes)+1)
+	w.spans[0] = 1
+	for l, n := range sizes {
+		w.spans[l+1] = w.spans[l] * n
+		w.levels = append(w.levels, make([]bucket, n))
+	}
+	return w
+}
+
+// tickOf 返回 t 之后(含)的第一个 tick 边界。
+func (w *wheel) tickOf(t time.Time) int64 {
+	d := t.Sub(w.origin)
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + w.tick - 1) / w.tick)
+}
+
+func (w *wheel) place(t *Task) {
+	e := t.tick
+	if e <= w.cur {
+		w.ready.push(t)
+		return
+	}
+	for l := range w.sizes {
+		if span := w.spans[l+1]; e/span == w.cur/span {
+			w.levels[l][(e/w.spans[l])%w.sizes[l]].push(t)
+			return
+		}
+	}
+	w.overflow.push(t)
+}
+
+func (w *wheel) push(t *Task) {
+	t.tick = w.tickOf(t.ExecuteAt)
+	w.place(t)
+	w.n++
+}
+
+func (w *wheel) remove(t *Task) {
+	if t.b != nil {
+		t.b.remove(t)
+		w.n--
+	}
+}
+
+func (w *wheel) len() int { return w.n }
+
+func (w *wheel) advance(now time.Time, due []*Task) []*Task {
+	collect := func(t *Task) {
+		due = append(due, t)
+		w.n--
+	}
+	w.ready.drain(collect)
+	target := int64(now.Sub(w.origin) / w.tick)
+	if w.n == 0 && target > w.cur {
+		w.cur = target // 空轮直接跳到当前 tick
+	}
+	top := len(w.sizes)
+	for w.cur < target {
+		w.cur++
+		if w.cur%w.spans[top] == 0 {
+			w.overflow.drain(w.place)
+		}
+		for l := top - 1; l >= 1; l-- {
+			if w.cur%w.spans[l] == 0 {
+				w.levels[l][(w.cur/w.spans[l])%w.sizes[l]].drain(w.place)
+			}
+		}
+		w.levels[0][w.cur%w.sizes[0]].drain(collect)
+		w.ready.drain(collect) // 降层时恰好到期的任务
+	}
+	return due
+}
+
+func (w *wheel) each(fn func(*Task)) {
+	w.ready.each(fn)
+	for _, level := range w.levels {
+		for i := range level {
+			level[i].each(fn)
+		}
+	}
+	w.overflow.each(fn)
+}
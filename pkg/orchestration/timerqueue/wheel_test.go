@@ -0,0 +1,111 @@
+package timerqueue
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 小轮(4×4 槽,顶层一圈 16 tick)覆盖降层与溢出:每个任务恰好在到期 tick 触发。
+func TestWheelFiresAtDeadlineTick(t *testing.T) {
+	origin := time.Unix(0, 0)
+	w := newWheel(origin, time.Millisecond, []int64{4, 4})
+	r := rand.New(rand.NewPCG(1, 2))
+
+	tasks := make([]*Task, 300)
+	for i := range tasks {
+		tasks[i] = &Task{ExecuteAt: origin.Add(time.Duration(r.IntN(100)) * time.Millisecond)}
+		w.push(tasks[i])
+	}
+	canceled := map[*Task]bool{tasks[0]: true, tasks[10]: true, tasks[20]: true}
+	for task := range canceled {
+		w.remove(task)
+	}
+
+	fired := 0
+	for tick := int64(0); tick <= 100; tick++ {
+		now := origin.Add(time.Duration(tick) * time.Millisecond)
+		for _, task := range w.advance(now, nil) {
+			if canceled[task] {
+				t.Fatalf("canceled task fired")
+			}
+			if task.ExecuteAt.After(now) {
+				t.Fatalf("task due %v fired early at %v", task.ExecuteAt, now)
+			}
+			if now.Sub(task.ExecuteAt) >= time.Millisecond {
+				t.Fatalf("task due %v fired late at %v", task.ExecuteAt, now)
+			}
+			fired++
+		}
+	}
+	if want := len(tasks) - len(canceled); fired != want || w.len() != 0 {
+		t.Fatalf("fired %d (len %d), want %d", fired, w.len(), want)
+	}
+}
+
+func TestTimingWheelQueue(t *testing.T) {
+	q, _ := startQueue(t, WithResolution(10*time.Millisecond), WithTimingWheel(0, 8, 8))
+
+	var mu sync.Mutex
+	var order []string
+	add := func(id string, d time.Duration) {
+		q.Add(id, d, func() { mu.Lock(); order = append(order, id); mu.Unlock() })
+	}
+	add("a", 60*time.Millisecond)
+	add("b", 20*time.Millisecond)
+	add("c", 40*time.Millisecond)
+	add("far", 900*time.Millisecond) // 超出 8×8 槽,走溢出链表
+	add("x", 30*time.Millisecond)
+	q.Cancel("x")
+
+	time.Sleep(1100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 4 || order[0] != "b" || order[1] != "c" || order[2] != "a" || order[3] != "far" {
+		t.Fatalf("unexpected order: %v, want [b c a far]", order)
+	}
+	if p := q.Pending(); p != 0 {
+		t.Errorf("pending = %d, want 0", p)
+	}
+}
+
+func TestBatchDispatch(t *testing.T) {
+	q, _ := startQueue(t, WithResolution(10*time.Millisecond), WithTimingWheel(0), WithBatchSize(64))
+
+	const n = 1000
+	var count atomic.Int64
+	at := time.Now().Add(20 * time.Millisecond)
+	for range n {
+		q.AddAt("", at, func() { count.Add(1) })
+	}
+	time.Sleep(150 * time.Millisecond)
+	if c := count.Load(); c != n {
+		t.Errorf("expected %d fires, got %d", n, c)
+	}
+}
+
+func BenchmarkAddCancel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		eng  func() engine
+	}{
+		{"heap", func() engine { return &heapEngine{} }},
+		{"wheel", func() engine { return newWheel(time.Now(), 100*time.Millisecond, []int64{256, 64, 64, 64}) }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			eng := bc.eng()
+			now := time.Now()
+			for i := range 1_000_000 {
+				eng.push(&Task{ExecuteAt: now.Add(time.Duration(i%86400) * time.Second)})
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				task := &Task{ExecuteAt: now.Add(time.Duration(i%86400) * time.Second)}
+				eng.push(task)
+				eng.remove(task)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+)
+
+// ErrNondeterministic 表示重放时 workflow 代码发出的命令与历史不一致(通常是改了代码却没用
+// GetVersion 保护)。该 workflow 保持打开,修复代码后下次触发时继续。
+var ErrNondeterministic = errors.New("workflow: nondeterministic replay")
+
+// DefaultVersion 是 GetVersion 对"变更前已执行过该位置"的旧 workflow 返回的版本。
+const DefaultVersion = -1
+
+// ActivityError 是 activity 重试耗尽后返回给 workflow 的错误。历史中只保存错误文本,
+// 重放时还原为同样的 ActivityError,因此不要对其做 errors.Is 原始错误判断。
+type ActivityError struct {
+	Activity string
+	Message  string
+}
+
+func (e *ActivityError) Error() string {
+	return "workflow: activity " + e.Activity + " failed: " + e.Message
+}
+
+// Context 是 workflow 代码唯一的外部交互通道。workflow 函数必须是确定性的:
+// 相同历史下发出相同顺序的命令。因此:
+//   - 不要直接做 IO、读时钟、取随机数、起 goroutine——分别用 ExecuteActivity、Now、SideEffect;
+//   - 不要 recover 本包触发的退出:阻塞中的命令(等待 timer / 信号)通过 runtime.Goexit 结束当次执行,
+//     到期 / 信号到达后从头重放。
+//
+// Context 只在 workflow 函数执行期间有效,不可跨 goroutine 使用。
+type Context struct {
+	e    *Engine
+	id   string
+	name string
+
+	commands map[int][]Event    // Seq → 该命令的事件(首个为发起事件)
+	maxSeq   int                // 历史中最大的 Seq
+	signals  map[string][]Event // 按名字的已到达信号
+	consumed map[string]int     // 按名字已被取走的信号数
+	markers  map[string]int     // changeID → 版本
+
+	seq     int
+	haltErr error // 非 nil 表示本次执行因错误中止(否则为阻塞等待)
+}
+
+func newContext(e *Engine, id string, history []Event) *Context {
+	c := &Context{
+		e: e, id: id,
+		commands: make(map[int][]Event),
+		signals:  make(map[string][]Event),
+		consumed: make(map[string]int),
+		markers:  make(map[string]int),
+	}
+	for _, ev := range history {
+		switch ev.Type {
+		case EventWorkflowStarted:
+			c.name = ev.Name
+		case EventSignalReceived:
+			c.signals[ev.Name] = append(c.signals[ev.Name], ev)
+		case EventMarker:
+			var v int
+			_ = json.Unmarshal(ev.Data, &v)
+			c.markers[ev.Name] = v
+		default:
+			if ev.Seq > 0 {
+				c.commands[ev.Seq] = append(c.commands[ev.Seq], ev)
+				c.maxSeq = max(c.maxSeq, ev.Seq)
+			}
+			if ev.Type == EventSignalConsumed {
+				c.consumed[ev.Name]++
+			}
+		}
+	}
+	return c
+}
+
+// ID 返回 workflow ID。
+func (c *Context) ID() string { return c.id }
+
+// Name 返回 workflow 名。
+func (c *Context) Name() string { return c.name }
+
+// block 结束当次执行,等待外部事件(timer 到期 / 信号到达)后重放。
+func (c *Context) block() { runtime.Goexit() }
+
+// fail 以错误结束当次执行;workflow 保持打开。
+func (c *Context) fail(err error) {
+	c.haltErr = err
+	runtime.Goexit()
+}
+
+func (c *Context) record(ev Event) {
+	ev.Time = time.Now()
+	if err := c.e.append(c.id, ev); err != nil {
+		c.fail(err)
+	}
+}
+
+// replayed 返回 seq 在历史中的事件,并校验其发起事件与当前命令一致。
+func (c *Context) replayed(seq int, typ EventType, name string) []Event {
+	evs := c.commands[seq]
+	if len(evs) > 0 && (evs[0].Type != typ || evs[0].Name != name) {
+		c.fail(fmt.Errorf("%w: command %d is %s %q in history, code issued %s %q",
+			ErrNondeterministic, seq, evs[0].Type, evs[0].Name, typ, name))
+	}
+	return evs
+}
+
+// ExecuteActivity 执行已注册的 activity name,把结果解码为 O。
+// 首次执行时先记录 scheduled,执行(含 backoff 重试)后记录结果;重放时直接返回已记录的结果。
+// 在 scheduled 与结果之间崩溃的 activity 会在恢复时重新执行(至少一次),activity 须幂等。
+func ExecuteActivity[O any](c *Context, name string, input any) (O, error) {
+	var out O
+	seq := c.nextSeq()
+	evs := c.replayed(seq, EventActivityScheduled, name)
+	var in json.RawMessage
+	if len(evs) > 0 {
+		in = evs[0].Data
+		for _, ev := range evs[1:] {
+			switch ev.Type {
+			case EventActivityCompleted:
+				return out, decode(ev.Data, &out)
+			case EventActivityFailed:
+				return out, &ActivityError{Activity: name, Message: ev.Error}
+			}
+		}
+	} else {
+		b, err := json.Marshal(input)
+		if err != nil {
+			return out, err
+		}
+		in = b
+		c.record(Event{Type: EventActivityScheduled, Seq: seq, Name: name, Data: in})
+	}
+	res, err := c.e.runActivity(c.id, name, in)
+	if errors.Is(err, ErrUnknownActivity) {
+		c.fail(err)
+	}
+	if err != nil {
+		c.record(Event{Type: EventActivityFailed, Seq: seq, Error: err.Error()})
+		return out, &ActivityError{Activity: name, Message: err.Error()}
+	}
+	c.record(Event{Type: EventActivityCompleted, Seq: seq, Data: res})
+	return out, decode(res, &out)
+}
+
+// Sleep 持久化地等待 d:到期时刻记入历史并交给 timerqueue,当次执行随即结束,到期后重放继续。
+// 进程重启后未到期的 timer 由 Engine.Start 重新挂上。d <= 0 立即返回。
+func (c *Context) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	seq := c.nextSeq()
+	evs := c.replayed(seq, EventTimerStarted, "")
+	if len(evs) == 0 {
+		at := time.Now().Add(d)
+		b, _ := json.Marshal(at)
+		c.record(Event{Type: EventTimerStarted, Seq: seq, Data: b})
+		c.e.scheduleTimer(c.id, seq, at)
+		c.block()
+	}
+	for _, ev := range evs[1:] {
+		if ev.Type == EventTimerFired {
+			return
+		}
+	}
+	var at time.Time
+	_ = json.Unmarshal(evs[0].Data, &at)
+	c.e.scheduleTimer(c.id, seq, at)
+	c.block()
+}
+
+// ReceiveSignal 取走下一个名为 name 的信号(Engine.Signal 发送)并解码为 T;尚未到达时等待。
+// 同名信号按到达顺序依次被取走。
+func ReceiveSignal[T any](c *Context, name string) (T, error) {
+	var v T
+	seq := c.nextSeq()
+	if evs := c.replayed(seq, EventSignalConsumed, name); len(evs) > 0 {
+		return v, decode(evs[0].Data, &v)
+	}
+	n := c.consumed[name]
+	if n >= len(c.signals[name]) {
+		c.block()
+	}
+	data := c.signals[name][n].Data
+	c.consumed[name]++
+	c.record(Event{Type: EventSignalConsumed, Seq: seq, Name: name, Data: data})
+	return v, decode(data, &v)
+}
+
+// SideEffect 执行一次非确定性的 fn(取随机数、生成 ID 等)并把结果记入历史,重放时返回记录值。
+func SideEffect[T any](c *Context, fn func() T) T {
+	seq := c.nextSeq()
+	if evs := c.replayed(seq, EventSideEffect, ""); len(evs) > 0 {
+		var v T
+		if err := decode(evs[0].Data, &v); err != nil {
+			c.fail(err)
+		}
+		return v
+	}
+	v := fn()
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.fail(err)
+	}
+	c.record(Event{Type: EventSideEffect, Seq: seq, Data: b})
+	return v
+}
+
+// Now 返回确定性的当前时间(首次执行时记录,重放时返回记录值)。
+func (c *Context) Now() time.Time {
+	return SideEffect(c, time.Now)
+}
+
+// GetVersion 为代码变更打版本标记,使已在执行中的旧 workflow 仍按旧逻辑重放:
+//
+//	if ctx.GetVersion("add-fraud-check", workflow.DefaultVersion, 1) == 1 {
+//	    _, err := workflow.ExecuteActivity[bool](ctx, "fraud-check", order)
+//	}
+//
+// 历史中已有该 changeID 的标记时返回记录的版本;没有标记但历史在此之后还有命令(旧代码已越过此处)
+// 时返回 DefaultVersion;否则记录 maxSupported 并返回。版本不在 [minSupported, maxSupported]
+// 内时当次执行以 ErrNondeterministic 中止。标记不占命令序号。
+func (c *Context) GetVersion(changeID string, minSupported, maxSupported int) int {
+	v, ok := c.markers[changeID]
+	switch {
+	case ok:
+	case c.seq < c.maxSeq:
+		v = DefaultVersion
+	default:
+		v = maxSupported
+		b, _ := json.Marshal(v)
+		c.markers[changeID] = v
+		c.record(Event{Type: EventMarker, Name: changeID, Data: b})
+	}
+	if v < minSupported || v > maxSupported {
+		c.fail(fmt.Errorf("%w: version %d of %q outside supported range [%d, %d]",
+			ErrNondeterministic, v, changeID, minSupported, maxSupported))
+	}
+	return v
+}
+
+func (c *Context) nextSeq() int {
+	c.seq++
+	return c.seq
+}
+
+func decode(data json.RawMessage, v any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+var workflowIDKey = ctxkey.New[string]()
+
+// WorkflowID 返回 activity 所属的 workflow ID(不在 activity 内为空),可与活动名组合作幂等键。
+func WorkflowID(ctx context.Context) string {
+	id, _ := ctxkey.Get(ctx, workflowIDKey)
+	return id
+}
@@ -0,0 +1,130 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound workflow 不存在。
+	ErrNotFound = errors.New("workflow: not found")
+	// ErrExists StartWorkflow 时 ID 已存在。
+	ErrExists = errors.New("workflow: already exists")
+)
+
+// EventType 是历史事件类型。
+type EventType string
+
+const (
+	EventWorkflowStarted   EventType = "workflow_started"   // Name=workflow 名,Data=输入
+	EventWorkflowCompleted EventType = "workflow_completed" // Data=结果
+	EventWorkflowFailed    EventType = "workflow_failed"    // Error=失败原因
+	EventActivityScheduled EventType = "activity_scheduled" // Seq,Name=activity 名,Data=输入
+	EventActivityCompleted EventType = "activity_completed" // Seq,Data=结果
+	EventActivityFailed    EventType = "activity_failed"    // Seq,Error=重试耗尽后的错误
+	EventTimerStarted      EventType = "timer_started"      // Seq,Data=到期时刻
+	EventTimerFired        EventType = "timer_fired"        // Seq
+	EventSignalReceived    EventType = "signal_received"    // Name=信号名,Data=负载(外部写入,不占 Seq)
+	EventSignalConsumed    EventType = "signal_consumed"    // Seq,Name,Data=被 ReceiveSignal 取走的负载
+	EventSideEffect        EventType = "side_effect"        // Seq,Data=SideEffect / Now 的结果
+	EventMarker            EventType = "marker"             // Name=GetVersion 的 changeID,Data=版本号(不占 Seq)
+)
+
+// Closing 报告事件是否终结 workflow。
+func (t EventType) Closing() bool {
+	return t == EventWorkflowCompleted || t == EventWorkflowFailed
+}
+
+// Event 是 workflow 历史中的一条记录。workflow 代码每发出一个命令(activity / timer /
+// 取信号 / SideEffect)分配一个递增的 Seq,重放时按 Seq 对照历史返回已记录的结果。
+type Event struct {
+	ID    int64           `json:"id"` // 历史内序号(从 1 起),由 HistoryStore 分配
+	Type  EventType       `json:"type"`
+	Seq   int             `json:"seq,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+	Time  time.Time       `json:"time"`
+}
+
+// HistoryStore 持久化 workflow 事件历史(只追加)。实现须并发安全;
+// 同一 workflow 的 Append 由 Engine 串行调用。
+type HistoryStore interface {
+	// Create 以 start(EventWorkflowStarted)开启新历史;ID 已存在返回 ErrExists。
+	Create(ctx context.Context, id string, start Event) error
+	// Append 追加事件并按顺序分配 Event.ID;历史不存在返回 ErrNotFound。
+	Append(ctx context.Context, id string, events ...Event) error
+	// Load 按 ID 顺序返回全部事件;不存在返回 ErrNotFound。
+	Load(ctx context.Context, id string) ([]Event, error)
+	// Open 返回尚未终结(没有 Closing 事件)的 workflow ID,供启动时恢复。
+	Open(ctx context.Context) ([]string, error)
+}
+
+// MemoryStore 是 HistoryStore 的内存实现(进程重启即丢),用于测试与单机。
+// 零值不可用,用 NewMemoryStore 构造。
+type MemoryStore struct {
+	mu      sync.Mutex
+	history map[string][]Event
+	closed  map[string]bool
+}
+
+// NewMemoryStore 创建内存 HistoryStore。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{history: make(map[string][]Event), closed: make(map[string]bool)}
+}
+
+func (m *MemoryStore) Create(_ context.Context, id string, start Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.history[id]; ok {
+		return ErrExists
+	}
+	start.ID = 1
+	m.history[id] = []Event{start}
+	return nil
+}
+
+func (m *MemoryStore) Append(_ context.Context, id string, events ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.history[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, ev := range events {
+		ev.ID = int64(len(h) + 1)
+		h = append(h, ev)
+		if ev.Type.Closing() {
+			m.closed[id] = true
+		}
+	}
+	m.history[id] = h
+	return nil
+}
+
+func (m *MemoryStore) Load(_ context.Context, id string) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.history[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]Event(nil), h...), nil
+}
+
+func (m *MemoryStore) Open(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for id := range m.history {
+		if !m.closed[id] {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestResultReleasesWaiter:ctx 取消后放弃等待的 Result 不留下 waiters 条目,仍在等待的其它 Result 照常被唤醒。
+func TestResultReleasesWaiter(t *testing.T) {
+	ctx := context.Background()
+	e := New(NewMemoryStore())
+	RegisterWorkflow(e, "wait", func(c *Context, _ any) (any, error) { return ReceiveSignal[any](c, "go") })
+	if err := e.StartWorkflow(ctx, "wait", "w-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waiting := make(chan error, 1)
+	go func() { waiting <- e.Result(ctx, "w-1", nil) }()
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := e.Result(short, "w-1", nil); err != context.DeadlineExceeded {
+		t.Fatalf("Result = %v", err)
+	}
+	if err := e.Signal(ctx, "w-1", "go", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waiting:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("remaining waiter not notified")
+	}
+
+	if err := e.StartWorkflow(ctx, "wait", "w-2", nil); err != nil {
+		t.Fatal(err)
+	}
+	short, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_ = e.Result(short, "w-2", nil)
+	e.mu.Lock()
+	n := len(e.waiters)
+	e.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("waiters left behind: %d", n)
+	}
+}
@@ -0,0 +1,493 @@
+// Package workflow 是确定性、持久化的 workflow 引擎(Temporal 风格):workflow 函数是普通 Go 代码,
+// 通过 Context 调用 activity、timer 与信号;每个决策都记入事件历史(HistoryStore),
+// 进程崩溃后从头重新执行 workflow 函数,已记录的命令直接返回历史结果(重放),从断点继续。
+//
+//	e := workflow.New(workflow.NewMemoryStore())
+//	workflow.RegisterActivity(e, "charge", charge, workflow.WithRetry(backoff.New(backoff.WithMaxRetries(5))))
+//	workflow.RegisterWorkflow(e, "order", func(ctx *workflow.Context, o Order) (string, error) {
+//	    if _, err := workflow.ExecuteActivity[string](ctx, "charge", o); err != nil {
+//	        return "", err
+//	    }
+//	    ctx.Sleep(24 * time.Hour)                                   // 持久化 timer(timerqueue)
+//	    ok, _ := workflow.ReceiveSignal[bool](ctx, "confirmed")     // 等待外部信号
+//	    ...
+//	})
+//	app := beauty.New(beauty.WithService(e))                        // Start 恢复未完成的 workflow 并驱动 timer
+//	_ = e.StartWorkflow(ctx, "order", "order-42", o)
+//
+// 确定性要求见 Context。代码变更用 Context.GetVersion 保护已在执行中的 workflow。
+//
+// 一个 HistoryStore 同一时刻只应由一个 Engine 驱动(同一 workflow 的决策在进程内串行,跨进程不加锁);
+// 多实例部署时按 workflow ID 分片到不同 Engine。
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/ctxkey"
+	"github.com/rushteam/beauty/pkg/foundation/keyedmutex"
+	"github.com/rushteam/beauty/pkg/foundation/safe"
+	"github.com/rushteam/beauty/pkg/orchestration/timerqueue"
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
+)
+
+var (
+	// ErrUnknownWorkflow workflow 名未注册。
+	ErrUnknownWorkflow = errors.New("workflow: unknown workflow")
+	// ErrUnknownActivity activity 名未注册。
+	ErrUnknownActivity = errors.New("workflow: unknown activity")
+	// ErrClosed 向已结束的 workflow 发送信号。
+	ErrClosed = errors.New("workflow: closed")
+	// ErrWorkflowFailed Result 返回的 workflow 失败错误(包装失败原因)。
+	ErrWorkflowFailed = errors.New("workflow: failed")
+)
+
+type workflowFunc func(c *Context, input json.RawMessage) (json.RawMessage, error)
+
+type activityDef struct {
+	fn      func(ctx context.Context, input json.RawMessage) (json.RawMessage, error)
+	retry   *backoff.Policy
+	timeout time.Duration
+}
+
+// Engine 驱动 workflow 的执行与恢复。零值不可用,用 New 构造。并发安全;满足 beauty.Service。
+type Engine struct {
+	store   HistoryStore
+	timers  *timerqueue.Queue
+	onError func(id string, err error)
+	retry   *backoff.Policy
+	locks   *keyedmutex.KeyedMutex // 串行化同一 workflow 的追加
+
+	mu         sync.Mutex
+	workflows  map[string]workflowFunc
+	activities map[string]activityDef
+	running    map[string]bool    // id → 是否需要再跑一轮(决策期间有新事件)
+	failures   map[string]int     // id → 连续失败的决策次数,决定下次重试的退避
+	waiters    map[string]*waiter // id → workflow 结束时关闭
+}
+
+// waiter 是 Result 等待 workflow 结束的通知;n 为仍在等待它的 Result 数。
+type waiter struct {
+	ch chan struct{}
+	n  int
+}
+
+// Option 配置 Engine。
+type Option func(*engineConfig)
+
+type engineConfig struct {
+	resolution time.Duration
+	onError    func(id string, err error)
+	retry      *backoff.Policy
+}
+
+// WithTimerResolution 设置 timer 的检查精度,默认 100ms。
+func WithTimerResolution(d time.Duration) Option {
+	return func(c *engineConfig) { c.resolution = d }
+}
+
+// WithOnError 设置决策出错(存储失败、ErrNondeterministic、未注册的 workflow / activity)时的回调。
+// 出错的 workflow 保持打开:ErrNondeterministic 须修复代码后由下次触发(信号、timer、Start)重试,
+// 其它错误按 WithDecisionRetry 的退避自动重试。默认 slog.Warn。
+func WithOnError(fn func(id string, err error)) Option {
+	return func(c *engineConfig) { c.onError = fn }
+}
+
+// WithDecisionRetry 设置决策出错(ErrNondeterministic 除外)后自动重试的退避,默认 backoff.New()
+// (200ms 起指数增长,单次封顶 30s);只用其间隔,不限次数,直到决策成功或 workflow 结束。
+func WithDecisionRetry(p *backoff.Policy) Option {
+	return func(c *engineConfig) { c.retry = p }
+}
+
+// New 创建基于 store 的 Engine。
+func New(store HistoryStore, opts ...Option) *Engine {
+	cfg := engineConfig{resolution: 100 * time.Millisecond}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.retry == nil {
+		cfg.retry = backoff.New()
+	}
+	if cfg.onError == nil {
+		cfg.onError = func(id string, err error) {
+			slog.Warn("workflow: decision failed", "id", id, "err", err)
+		}
+	}
+	return &Engine{
+		store:      store,
+		timers:     timerqueue.New(timerqueue.WithName("workflow"), timerqueue.WithResolution(cfg.resolution)),
+		onError:    cfg.onError,
+		retry:      cfg.retry,
+		locks:      keyedmutex.New(),
+		workflows:  make(map[string]workflowFunc),
+		activities: make(map[string]activityDef),
+		running:    make(map[string]bool),
+		failures:   make(map[string]int),
+		waiters:    make(map[string]*waiter),
+	}
+}
+
+// RegisterWorkflow 注册名为 name 的 workflow,同名覆盖。输入输出经 JSON 序列化记入历史。
+// 每个进程都要注册全部 workflow,恢复时按历史里的名字查找。
+func RegisterWorkflow[I, O any](e *Engine, name string, fn func(ctx *Context, input I) (O, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.workflows[name] = func(c *Context, raw json.RawMessage) (json.RawMessage, error) {
+		var in I
+		if err := decode(raw, &in); err != nil {
+			return nil, err
+		}
+		out, err := fn(c, in)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	}
+}
+
+// ActivityOption 配置 activity。
+type ActivityOption func(*activityDef)
+
+// WithRetry 设置 activity 的重试策略,默认 backoff.New()(最多重试 3 次)。
+// 重试耗尽后 workflow 收到 *ActivityError。
+func WithRetry(p *backoff.Policy) ActivityOption {
+	return func(d *activityDef) { d.retry = p }
+}
+
+// WithActivityTimeout 设置单次尝试的超时(ctx 截止),默认不限。
+func WithActivityTimeout(d time.Duration) ActivityOption {
+	return func(a *activityDef) { a.timeout = d }
+}
+
+// RegisterActivity 注册名为 name 的 activity,同名覆盖。activity 是执行副作用的普通函数,
+// 可能因崩溃被重复执行(至少一次),须幂等——可用 WorkflowID(ctx) 组合幂等键。
+func RegisterActivity[I, O any](e *Engine, name string, fn func(ctx context.Context, input I) (O, error), opts ...ActivityOption) {
+	def := activityDef{
+		fn: func(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+			var in I
+			if err := decode(raw, &in); err != nil {
+				return nil, err
+			}
+			out, err := fn(ctx, in)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(out)
+		},
+	}
+	for _, o := range opts {
+		o(&def)
+	}
+	if def.retry == nil {
+		def.retry = backoff.New()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.activities[name] = def
+}
+
+// StartWorkflow 以 id 启动名为 name 的 workflow,异步执行;用 Result 等待结果。
+// id 已存在返回 ErrExists(id 即幂等键)。
+func (e *Engine) StartWorkflow(ctx context.Context, name, id string, input any) error {
+	e.mu.Lock()
+	_, ok := e.workflows[name]
+	e.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownWorkflow, name)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	if err := e.store.Create(ctx, id, Event{Type: EventWorkflowStarted, Name: name, Data: data, Time: time.Now()}); err != nil {
+		return err
+	}
+	e.schedule(id)
+	return nil
+}
+
+// Signal 向 workflow id 发送名为 name 的信号(payload 经 JSON 序列化),由 ReceiveSignal 取走。
+// 信号先落盘再触发决策,workflow 尚未等待该信号时会保留到被取走。
+// workflow 不存在返回 ErrNotFound,已结束返回 ErrClosed。
+func (e *Engine) Signal(ctx context.Context, id, name string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	unlock := e.locks.Lock(id)
+	h, err := e.store.Load(ctx, id)
+	if err == nil {
+		if closed(h) {
+			err = ErrClosed
+		} else {
+			err = e.store.Append(ctx, id, Event{Type: EventSignalReceived, Name: name, Data: data, Time: time.Now()})
+		}
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+	e.schedule(id)
+	return nil
+}
+
+// Result 等待 workflow id 结束,把结果解码到 out(可为 nil)。workflow 失败时返回包装了
+// ErrWorkflowFailed 的错误。只能感知本 Engine 驱动的结束;ctx 取消返回 ctx.Err()。
+func (e *Engine) Result(ctx context.Context, id string, out any) error {
+	for {
+		w := e.waiter(id)
+		done, err := e.result(ctx, id, out)
+		if !done {
+			select {
+			case <-ctx.Done():
+				done, err = true, ctx.Err()
+			case <-w.ch:
+			}
+		}
+		e.release(id, w)
+		if done {
+			return err
+		}
+	}
+}
+
+// result 读取 workflow id 的结果;尚未结束时返回 done=false。
+func (e *Engine) result(ctx context.Context, id string, out any) (done bool, err error) {
+	h, err := e.store.Load(ctx, id)
+	if err != nil {
+		return true, err
+	}
+	switch last := h[len(h)-1]; last.Type {
+	case EventWorkflowCompleted:
+		if out == nil {
+			return true, nil
+		}
+		return true, decode(last.Data, out)
+	case EventWorkflowFailed:
+		return true, fmt.Errorf("%w: %s", ErrWorkflowFailed, last.Error)
+	}
+	return false, nil
+}
+
+// History 返回 workflow id 的事件历史。
+func (e *Engine) History(ctx context.Context, id string) ([]Event, error) {
+	return e.store.Load(ctx, id)
+}
+
+// Start 恢复 store 中未结束的 workflow(重放至断点并重新挂上未到期的 timer),
+// 然后驱动 timer 直到 ctx 取消——满足 beauty.Service。
+func (e *Engine) Start(ctx context.Context) error {
+	go func() {
+		ids, err := e.store.Open(ctx)
+		if err != nil {
+			e.onError("", err)
+			return
+		}
+		for _, id := range ids {
+			e.schedule(id)
+		}
+	}()
+	return e.timers.Start(ctx)
+}
+
+func (e *Engine) String() string { return "workflow.Engine" }
+
+// schedule 触发一轮决策。同一 workflow 同时只有一轮在跑;期间的触发合并为跑完后再跑一轮。
+func (e *Engine) schedule(id string) {
+	e.mu.Lock()
+	if _, ok := e.running[id]; ok {
+		e.running[id] = true
+		e.mu.Unlock()
+		return
+	}
+	e.running[id] = false
+	e.mu.Unlock()
+	go func() {
+		for {
+			e.retryLater(id, e.decide(id))
+			e.mu.Lock()
+			if !e.running[id] {
+				delete(e.running, id)
+				e.mu.Unlock()
+				return
+			}
+			e.running[id] = false
+			e.mu.Unlock()
+		}
+	}()
+}
+
+// retryLater 记录一轮决策的结果:出错(ErrNondeterministic 除外)时按退避安排重试,成功时清零。
+func (e *Engine) retryLater(id string, err error) {
+	if err == nil || errors.Is(err, ErrNondeterministic) {
+		e.mu.Lock()
+		delete(e.failures, id)
+		e.mu.Unlock()
+		if err != nil {
+			e.onError(id, err)
+		}
+		return
+	}
+	e.onError(id, err)
+	e.mu.Lock()
+	n := e.failures[id]
+	e.failures[id] = n + 1
+	e.mu.Unlock()
+	if !e.timers.Add("wf-retry:"+id, e.retry.Duration(n), func() { e.schedule(id) }) {
+		e.onError(id, errors.New("workflow: timer queue full"))
+	}
+}
+
+// decide 加载历史并重放 workflow 函数,直到它结束或阻塞。返回导致本轮中止的错误。
+func (e *Engine) decide(id string) error {
+	ctx := context.Background()
+	h, err := e.store.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if closed(h) {
+		e.notify(id)
+		return nil
+	}
+	start := h[0]
+	e.mu.Lock()
+	fn, ok := e.workflows[start.Name]
+	e.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownWorkflow, start.Name)
+	}
+
+	c := newContext(e, id, h)
+	var (
+		out      json.RawMessage
+		werr     error
+		finished bool
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 阻塞 / 中止经 runtime.Goexit 退出:finished 保持 false
+		werr = safe.Run(func() error {
+			var err error
+			out, err = fn(c, start.Data)
+			return err
+		})
+		finished = true
+	}()
+	<-done
+	if !finished {
+		return c.haltErr // 阻塞等待时为 nil
+	}
+
+	ev := Event{Type: EventWorkflowCompleted, Data: out, Time: time.Now()}
+	if werr != nil {
+		ev = Event{Type: EventWorkflowFailed, Error: werr.Error(), Time: time.Now()}
+	}
+	if err := e.append(id, ev); err != nil {
+		return err
+	}
+	e.notify(id)
+	return nil
+}
+
+func (e *Engine) append(id string, ev Event) error {
+	unlock := e.locks.Lock(id)
+	defer unlock()
+	return e.store.Append(context.Background(), id, ev)
+}
+
+func (e *Engine) runActivity(id, name string, input json.RawMessage) (json.RawMessage, error) {
+	e.mu.Lock()
+	def, ok := e.activities[name]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownActivity, name)
+	}
+	ctx := ctxkey.With(context.Background(), workflowIDKey, id)
+	var out json.RawMessage
+	err := def.retry.Retry(ctx, func(ctx context.Context) error {
+		if def.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, def.timeout)
+			defer cancel()
+		}
+		return safe.Run(func() error {
+			var err error
+			out, err = def.fn(ctx, input)
+			return err
+		})
+	})
+	return out, err
+}
+
+func (e *Engine) scheduleTimer(id string, seq int, at time.Time) {
+	if !e.timers.AddAt("wf:"+id+":"+strconv.Itoa(seq), at, func() { e.fireTimer(id, seq) }) {
+		e.onError(id, errors.New("workflow: timer queue full"))
+	}
+}
+
+// fireTimer 记录 timer 到期(去重)并触发决策。
+func (e *Engine) fireTimer(id string, seq int) {
+	ctx := context.Background()
+	unlock := e.locks.Lock(id)
+	h, err := e.store.Load(ctx, id)
+	if err == nil && !closed(h) && !fired(h, seq) {
+		err = e.store.Append(ctx, id, Event{Type: EventTimerFired, Seq: seq, Time: time.Now()})
+	}
+	unlock()
+	if err != nil {
+		e.onError(id, err)
+		return
+	}
+	e.schedule(id)
+}
+
+func (e *Engine) waiter(id string) *waiter {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	w, ok := e.waiters[id]
+	if !ok {
+		w = &waiter{ch: make(chan struct{})}
+		e.waiters[id] = w
+	}
+	w.n++
+	return w
+}
+
+// release 结束一次等待;最后一个等待者离开时删除尚未关闭的通知,放弃等待的 Result 不留下条目。
+func (e *Engine) release(id string, w *waiter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if w.n--; w.n == 0 && e.waiters[id] == w {
+		delete(e.waiters, id)
+	}
+}
+
+func (e *Engine) notify(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if w, ok := e.waiters[id]; ok {
+		close(w.ch)
+		delete(e.waiters, id)
+	}
+}
+
+func closed(h []Event) bool {
+	return len(h) > 0 && h[len(h)-1].Type.Closing()
+}
+
+func fired(h []Event, seq int) bool {
+	for _, ev := range h {
+		if ev.Type == EventTimerFired && ev.Seq == seq {
+			return true
+		}
+	}
+	return false
+}
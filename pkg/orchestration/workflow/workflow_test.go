@@ -0,0 +1,289 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/orchestration/workflow"
+	"github.com/rushteam/beauty/pkg/resilience/backoff"
+)
+
+func start(t *testing.T, e *workflow.Engine) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = e.Start(ctx) }()
+}
+
+func result[T any](t *testing.T, e *workflow.Engine, id string) (T, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var out T
+	err := e.Result(ctx, id, &out)
+	return out, err
+}
+
+// order:扣款 → 等待发货信号 → 延时 → 完成。
+func registerOrder(e *workflow.Engine, charges *atomic.Int32) {
+	workflow.RegisterActivity(e, "charge", func(ctx context.Context, amount int) (string, error) {
+		charges.Add(1)
+		return workflow.WorkflowID(ctx) + "-paid", nil
+	})
+	workflow.RegisterWorkflow(e, "order", func(ctx *workflow.Context, amount int) (string, error) {
+		receipt, err := workflow.ExecuteActivity[string](ctx, "charge", amount)
+		if err != nil {
+			return "", err
+		}
+		carrier, err := workflow.ReceiveSignal[string](ctx, "shipped")
+		if err != nil {
+			return "", err
+		}
+		ctx.Sleep(20 * time.Millisecond)
+		return receipt + "/" + carrier, nil
+	})
+}
+
+func TestEngine_Run(t *testing.T) {
+	ctx := context.Background()
+	var charges atomic.Int32
+	e := workflow.New(workflow.NewMemoryStore(), workflow.WithTimerResolution(5*time.Millisecond))
+	registerOrder(e, &charges)
+	start(t, e)
+
+	if err := e.StartWorkflow(ctx, "order", "o-1", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.StartWorkflow(ctx, "order", "o-1", 30); !errors.Is(err, workflow.ErrExists) {
+		t.Fatalf("want ErrExists, got %v", err)
+	}
+	if err := e.Signal(ctx, "o-1", "shipped", "ups"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := result[string](t, e, "o-1")
+	if err != nil || out != "o-1-paid/ups" || charges.Load() != 1 {
+		t.Fatalf("out = %q, err = %v, charges = %d", out, err, charges.Load())
+	}
+	if err := e.Signal(ctx, "o-1", "shipped", "dhl"); !errors.Is(err, workflow.ErrClosed) {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+	if err := e.StartWorkflow(ctx, "missing", "o-2", nil); !errors.Is(err, workflow.ErrUnknownWorkflow) {
+		t.Fatalf("want ErrUnknownWorkflow, got %v", err)
+	}
+}
+
+func TestEngine_ReplayAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	store := workflow.NewMemoryStore()
+	var charges atomic.Int32
+
+	// 第一个进程:扣款后收到信号、挂上 timer,timer 未到期即"崩溃"(不 Start,timer 永不触发)
+	e1 := workflow.New(store)
+	registerOrder(e1, &charges)
+	if err := e1.StartWorkflow(ctx, "order", "o-1", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.Signal(ctx, "o-1", "shipped", "ups"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		h, _ := store.Load(ctx, "o-1")
+		return h[len(h)-1].Type == workflow.EventTimerStarted
+	})
+
+	// 重启:重放历史,扣款不重复执行,timer 重新挂上并继续
+	e2 := workflow.New(store, workflow.WithTimerResolution(5*time.Millisecond))
+	registerOrder(e2, &charges)
+	start(t, e2)
+	out, err := result[string](t, e2, "o-1")
+	if err != nil || out != "o-1-paid/ups" || charges.Load() != 1 {
+		t.Fatalf("out = %q, err = %v, charges = %d", out, err, charges.Load())
+	}
+}
+
+func TestEngine_ActivityRetry(t *testing.T) {
+	ctx := context.Background()
+	e := workflow.New(workflow.NewMemoryStore())
+	var calls atomic.Int32
+	retry := workflow.WithRetry(backoff.New(backoff.WithBase(time.Millisecond), backoff.WithMaxRetries(2)))
+	workflow.RegisterActivity(e, "flaky", func(_ context.Context, failures int32) (int32, error) {
+		if n := calls.Add(1); n <= failures {
+			return 0, errors.New("unavailable")
+		}
+		return calls.Load(), nil
+	}, retry)
+	workflow.RegisterWorkflow(e, "call", func(ctx *workflow.Context, failures int32) (int32, error) {
+		return workflow.ExecuteActivity[int32](ctx, "flaky", failures)
+	})
+
+	if err := e.StartWorkflow(ctx, "call", "w-1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := result[int32](t, e, "w-1"); err != nil || n != 3 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+
+	// 重试耗尽:workflow 收到 ActivityError,未处理则 workflow 失败
+	calls.Store(0)
+	if err := e.StartWorkflow(ctx, "call", "w-2", 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := result[int32](t, e, "w-2"); !errors.Is(err, workflow.ErrWorkflowFailed) || calls.Load() != 3 {
+		t.Fatalf("err = %v, calls = %d", err, calls.Load())
+	}
+}
+
+func TestEngine_GetVersion(t *testing.T) {
+	ctx := context.Background()
+	store := workflow.NewMemoryStore()
+	var audits atomic.Int32
+	step := func(_ context.Context, s string) (string, error) { return s, nil }
+
+	// 旧代码:step → 信号 go → 信号 done
+	e1 := workflow.New(store)
+	workflow.RegisterActivity(e1, "step", step)
+	workflow.RegisterWorkflow(e1, "flow", func(ctx *workflow.Context, _ any) (string, error) {
+		_, _ = workflow.ExecuteActivity[string](ctx, "step", "a")
+		_, _ = workflow.ReceiveSignal[bool](ctx, "go")
+		_, _ = workflow.ReceiveSignal[bool](ctx, "done")
+		return "ok", nil
+	})
+	if err := e1.StartWorkflow(ctx, "flow", "old", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.Signal(ctx, "old", "go", true); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		h, _ := store.Load(ctx, "old")
+		return h[len(h)-1].Type == workflow.EventSignalConsumed
+	})
+
+	// 新代码在 step 之后插入 audit,用 GetVersion 保护:已越过该处的旧 workflow 走旧逻辑
+	e2 := workflow.New(store)
+	workflow.RegisterActivity(e2, "step", step)
+	workflow.RegisterActivity(e2, "audit", func(context.Context, any) (any, error) {
+		audits.Add(1)
+		return nil, nil
+	})
+	workflow.RegisterWorkflow(e2, "flow", func(ctx *workflow.Context, _ any) (int, error) {
+		_, _ = workflow.ExecuteActivity[string](ctx, "step", "a")
+		v := ctx.GetVersion("audit", workflow.DefaultVersion, 1)
+		if v == 1 {
+			_, _ = workflow.ExecuteActivity[any](ctx, "audit", nil)
+		}
+		_, _ = workflow.ReceiveSignal[bool](ctx, "go")
+		_, _ = workflow.ReceiveSignal[bool](ctx, "done")
+		return v, nil
+	})
+	start(t, e2)
+	for _, id := range []string{"old", "new"} {
+		if id == "new" {
+			if err := e2.StartWorkflow(ctx, "flow", id, nil); err != nil {
+				t.Fatal(err)
+			}
+			_ = e2.Signal(ctx, id, "go", true)
+		}
+		if err := e2.Signal(ctx, id, "done", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := result[int](t, e2, "old"); err != nil || v != workflow.DefaultVersion {
+		t.Fatalf("old: v = %d, err = %v", v, err)
+	}
+	if v, err := result[int](t, e2, "new"); err != nil || v != 1 || audits.Load() != 1 {
+		t.Fatalf("new: v = %d, err = %v, audits = %d", v, err, audits.Load())
+	}
+}
+
+func TestEngine_Nondeterministic(t *testing.T) {
+	ctx := context.Background()
+	store := workflow.NewMemoryStore()
+	noop := func(context.Context, any) (any, error) { return nil, nil }
+
+	e1 := workflow.New(store)
+	workflow.RegisterActivity(e1, "a", noop)
+	workflow.RegisterWorkflow(e1, "flow", func(ctx *workflow.Context, _ any) (any, error) {
+		_, _ = workflow.ExecuteActivity[any](ctx, "a", nil)
+		return workflow.ReceiveSignal[any](ctx, "done")
+	})
+	if err := e1.StartWorkflow(ctx, "flow", "w-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		h, _ := store.Load(ctx, "w-1")
+		return h[len(h)-1].Type == workflow.EventActivityCompleted
+	})
+
+	// 未经 GetVersion 保护地改了第一个命令:重放报 ErrNondeterministic,workflow 保持打开
+	errs := make(chan error, 1)
+	e2 := workflow.New(store, workflow.WithOnError(func(_ string, err error) { errs <- err }))
+	workflow.RegisterActivity(e2, "b", noop)
+	workflow.RegisterWorkflow(e2, "flow", func(ctx *workflow.Context, _ any) (any, error) {
+		return workflow.ExecuteActivity[any](ctx, "b", nil)
+	})
+	if err := e2.Signal(ctx, "w-1", "done", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, workflow.ErrNondeterministic) {
+			t.Fatalf("want ErrNondeterministic, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+	}
+	if ids, _ := store.Open(ctx); len(ids) != 1 {
+		t.Fatalf("open = %v", ids)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// flakyStore 让前 n 次 Append 失败,模拟存储的瞬时故障。
+type flakyStore struct {
+	*workflow.MemoryStore
+	fails atomic.Int32
+}
+
+func (s *flakyStore) Append(ctx context.Context, id string, events ...workflow.Event) error {
+	if s.fails.Add(-1) >= 0 {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryStore.Append(ctx, id, events...)
+}
+
+func TestEngine_RetriesTransientStoreError(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{MemoryStore: workflow.NewMemoryStore()}
+	var errs atomic.Int32
+	e := workflow.New(store, workflow.WithTimerResolution(5*time.Millisecond),
+		workflow.WithDecisionRetry(backoff.New(backoff.WithBase(10*time.Millisecond), backoff.WithMax(20*time.Millisecond))),
+		workflow.WithOnError(func(string, error) { errs.Add(1) }))
+	workflow.RegisterWorkflow(e, "hello", func(ctx *workflow.Context, name string) (string, error) {
+		return "hi " + name, nil
+	})
+	start(t, e)
+	time.Sleep(20 * time.Millisecond) // 等 timer 队列启动
+
+	store.fails.Store(2) // 完成事件前两次写入失败,没有信号 / timer 也应自动重试
+	if err := e.StartWorkflow(ctx, "hello", "w-1", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := result[string](t, e, "w-1")
+	if err != nil || out != "hi bob" || errs.Load() != 2 {
+		t.Fatalf("out = %q, err = %v, errors = %d", out, err, errs.Load())
+	}
+}
@@ -0,0 +1,239 @@
+// Package bulkhead 提供按下游依赖隔离的舱壁(bulkhead):每个依赖(支付网关、推荐服务、某个库……)
+// 各有独立的并发上限与排队等待上限,一个依赖变慢只会耗尽它自己的名额,不会拖住所有 goroutine
+// 进而拖垮对其它依赖的调用。
+//
+// 与 foundation/semaphore 的关系:单个 Bulkhead 就是一个等权信号量(容量 = 最大并发,满时最多等
+// MaxWait);本包在其上补齐"按依赖名登记"的 Registry、拒绝错误(带建议重试间隔)与运行统计。
+// 与 circuitbreaker 互补:熔断看错误率,舱壁看并发占用——下游只是变慢、尚未报错时舱壁已能限住。
+//
+// 接入方式:
+//   - 直接调用 Registry.Do(ctx, "payment", fn);
+//   - gRPC / HTTP 客户端见 pkg/middleware/bulkhead(拦截器、RoundTripper,拒绝时返回
+//     api/errors 的 Unavailable + RetryInfo,并导出饱和度指标)。
+//
+// 纯标准库、并发安全。
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rushteam/beauty/pkg/foundation/semaphore"
+)
+
+// ErrFull 表示舱壁已满(并发达到上限且在 MaxWait 内未等到名额)。
+var ErrFull = errors.New("bulkhead: full")
+
+// RejectedError 是舱壁拒绝时返回的错误,errors.Is(err, ErrFull) 为 true。
+type RejectedError struct {
+	Name       string        // 依赖名
+	Capacity   int           // 最大并发
+	RetryAfter time.Duration // 建议的重试间隔
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("bulkhead: %q full (max %d concurrent calls)", e.Name, e.Capacity)
+}
+
+func (e *RejectedError) Unwrap() error { return ErrFull }
+
+// Option 配置 Bulkhead。
+type Option func(*config)
+
+type config struct {
+	maxConcurrent int
+	maxWait       time.Duration
+	retryAfter    time.Duration
+	onReject      func(name string)
+}
+
+// WithMaxConcurrent 设置最大并发调用数(默认 10)。
+func WithMaxConcurrent(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxConcurrent = n
+		}
+	}
+}
+
+// WithMaxWait 设置满时排队等待名额的最长时间(默认 0,即满则立即拒绝)。
+func WithMaxWait(d time.Duration) Option {
+	return func(c *config) {
+		if d >= 0 {
+			c.maxWait = d
+		}
+	}
+}
+
+// WithRetryAfter 设置拒绝时建议调用方等待的时长(默认 1s),写入 RejectedError.RetryAfter。
+func WithRetryAfter(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.retryAfter = d
+		}
+	}
+}
+
+// WithOnReject 注册拒绝回调(用于日志/告警),参数为依赖名。
+func WithOnReject(fn func(name string)) Option {
+	return func(c *config) { c.onReject = fn }
+}
+
+// Stats 是单个舱壁的运行统计。
+type Stats struct {
+	Name     string
+	Capacity int   // 最大并发
+	InFlight int   // 正在执行的调用数
+	Waiting  int   // 正在排队等待名额的调用数
+	Rejected int64 // 累计拒绝次数
+}
+
+// Saturation 返回占用率 InFlight/Capacity(0..1)。
+func (s Stats) Saturation() float64 {
+	if s.Capacity == 0 {
+		return 0
+	}
+	return float64(s.InFlight) / float64(s.Capacity)
+}
+
+// Bulkhead 是单个依赖的舱壁。零值不可用,用 New 或 Registry.Get 构造。并发安全。
+type Bulkhead struct {
+	name     string
+	cfg      config
+	sem      *semaphore.Semaphore
+	waiting  atomic.Int64
+	rejected atomic.Int64
+}
+
+// New 创建名为 name 的舱壁。
+func New(name string, opts ...Option) *Bulkhead {
+	cfg := config{maxConcurrent: 10, retryAfter: time.Second}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &Bulkhead{
+		name: name,
+		cfg:  cfg,
+		sem:  semaphore.New(semaphore.WithCapacity(int64(cfg.maxConcurrent)), semaphore.WithMaxWait(cfg.maxWait)),
+	}
+}
+
+// Name 返回依赖名。
+func (b *Bulkhead) Name() string { return b.name }
+
+// Acquire 占用一个名额:有空位立即返回;否则最多排队 MaxWait,仍无名额返回 *RejectedError。
+// ctx 在排队期间取消返回 ctx.Err()。成功后必须调用返回的 release(可重复调用,只生效一次)。
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	if !b.sem.TryAcquire(1) {
+		if b.cfg.maxWait <= 0 {
+			return nil, b.reject()
+		}
+		b.waiting.Add(1)
+		err := b.sem.Acquire(ctx, 1)
+		b.waiting.Add(-1)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, b.reject()
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(func() { b.sem.Release(1) }) }, nil
+}
+
+// Do 在舱壁内执行 fn:占到名额才执行,fn 返回后释放。被拒绝时不执行 fn,返回 *RejectedError。
+func (b *Bulkhead) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	release, err := b.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(ctx)
+}
+
+// Stats 返回当前统计。
+func (b *Bulkhead) Stats() Stats {
+	return Stats{
+		Name:     b.name,
+		Capacity: b.cfg.maxConcurrent,
+		InFlight: int(b.sem.InFlight()),
+		Waiting:  int(b.waiting.Load()),
+		Rejected: b.rejected.Load(),
+	}
+}
+
+func (b *Bulkhead) reject() error {
+	b.rejected.Add(1)
+	if b.cfg.onReject != nil {
+		b.cfg.onReject(b.name)
+	}
+	return &RejectedError{Name: b.name, Capacity: b.cfg.maxConcurrent, RetryAfter: b.cfg.retryAfter}
+}
+
+// Registry 按依赖名管理舱壁。未登记的依赖在首次使用时按默认选项创建。
+// 零值不可用,用 NewRegistry 构造。并发安全。
+type Registry struct {
+	defaults []Option
+	mu       sync.RWMutex
+	items    map[string]*Bulkhead
+}
+
+// NewRegistry 创建 Registry,defaults 是未单独登记的依赖使用的选项。
+//
+//	reg := bulkhead.NewRegistry(bulkhead.WithMaxConcurrent(20))
+//	reg.Register("payment", bulkhead.WithMaxConcurrent(5), bulkhead.WithMaxWait(50*time.Millisecond))
+//	err := reg.Do(ctx, "payment", func(ctx context.Context) error { return pay(ctx) })
+func NewRegistry(defaults ...Option) *Registry {
+	return &Registry{defaults: defaults, items: make(map[string]*Bulkhead)}
+}
+
+// Register 为 name 登记独立配置(在默认选项之上追加 opts),替换已有的同名舱壁。
+// 应在开始调用前完成:替换时已在旧舱壁内的调用仍按旧舱壁计数。
+func (r *Registry) Register(name string, opts ...Option) *Bulkhead {
+	b := New(name, append(append([]Option(nil), r.defaults...), opts...)...)
+	r.mu.Lock()
+	r.items[name] = b
+	r.mu.Unlock()
+	return b
+}
+
+// Get 返回 name 的舱壁,不存在时按默认选项创建。
+func (r *Registry) Get(name string) *Bulkhead {
+	r.mu.RLock()
+	b, ok := r.items[name]
+	r.mu.RUnlock()
+	if ok {
+		return b
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.items[name]; ok {
+		return b
+	}
+	b = New(name, r.defaults...)
+	r.items[name] = b
+	return b
+}
+
+// Do 在 name 的舱壁内执行 fn,见 Bulkhead.Do。
+func (r *Registry) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return r.Get(name).Do(ctx, fn)
+}
+
+// Stats 返回所有舱壁的统计(按依赖名排序)。
+func (r *Registry) Stats() []Stats {
+	r.mu.RLock()
+	out := make([]Stats, 0, len(r.items))
+	for _, b := range r.items {
+		out = append(out, b.Stats())
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,98 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkhead_RejectsWhenFull(t *testing.T) {
+	var rejected []string
+	b := New("payment", WithMaxConcurrent(2), WithRetryAfter(3*time.Second), WithOnReject(func(name string) {
+		rejected = append(rejected, name)
+	}))
+	ctx := context.Background()
+
+	r1, err1 := b.Acquire(ctx)
+	r2, err2 := b.Acquire(ctx)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("acquire: %v %v", err1, err2)
+	}
+	err := b.Do(ctx, func(context.Context) error { t.Error("must not run when full"); return nil })
+	var re *RejectedError
+	if !errors.Is(err, ErrFull) || !errors.As(err, &re) || re.Name != "payment" || re.RetryAfter != 3*time.Second {
+		t.Fatalf("want RejectedError, got %v", err)
+	}
+	if st := b.Stats(); st.InFlight != 2 || st.Rejected != 1 || st.Saturation() != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	r1()
+	r1() // 重复释放无副作用
+	if err := b.Do(ctx, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("after release: %v", err)
+	}
+	r2()
+	if st := b.Stats(); st.InFlight != 0 || len(rejected) != 1 {
+		t.Errorf("stats = %+v, rejected = %v", st, rejected)
+	}
+}
+
+func TestBulkhead_MaxWait(t *testing.T) {
+	b := New("search", WithMaxConcurrent(1), WithMaxWait(200*time.Millisecond))
+	ctx := context.Background()
+	release, _ := b.Acquire(ctx)
+
+	// 排队期间名额被释放:拿到名额
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	if err := b.Do(ctx, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("waiter should get the slot: %v", err)
+	}
+
+	// 排队期间 ctx 取消:返回 ctx 错误而不是拒绝
+	release, _ = b.Acquire(ctx)
+	defer release()
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := b.Do(cctx, func(context.Context) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded, got %v", err)
+	}
+	if err := b.Do(ctx, func(context.Context) error { return nil }); !errors.Is(err, ErrFull) {
+		t.Errorf("want ErrFull after max wait, got %v", err)
+	}
+}
+
+// TestRegistry_Isolation:一个依赖占满不影响其它依赖。
+func TestRegistry_Isolation(t *testing.T) {
+	reg := NewRegistry(WithMaxConcurrent(4))
+	reg.Register("slow", WithMaxConcurrent(1))
+	ctx := context.Background()
+
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = reg.Do(ctx, "slow", func(context.Context) error { <-block; return nil })
+	}()
+	for reg.Get("slow").Stats().InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := reg.Do(ctx, "slow", func(context.Context) error { return nil }); !errors.Is(err, ErrFull) {
+		t.Errorf("slow should be full, got %v", err)
+	}
+	if err := reg.Do(ctx, "fast", func(context.Context) error { return nil }); err != nil {
+		t.Errorf("fast must not be affected: %v", err)
+	}
+	close(block)
+	wg.Wait()
+
+	stats := reg.Stats()
+	if len(stats) != 2 || stats[0].Name != "fast" || stats[0].Capacity != 4 || stats[1].Capacity != 1 || stats[1].Rejected != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
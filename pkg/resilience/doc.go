@@ -14,4 +14,5 @@
 //	throttle        — 节流(与 ratelimit 互补,侧重调用频率平滑)
 //	cooldown        — 冷却计时(依赖 store/kvstore)
 //	counter         — 分布式计数器(依赖 store/kvstore)
+//	bulkhead        — 按下游依赖隔离并发(舱壁)
 package resilience
@@ -1,7 +1,256 @@
+// Package grpcgw 提供基于 grpc-gateway 的 REST 网关服务:按 proto 中的 google.api.http 注解
+// 把 HTTP/JSON 请求转码为 gRPC 调用。
+//
+// Gateway 是一个完整的 beauty.Service:
+//
+//   - 进程内直连 grpcserver.Server(grpcserver.InProcessConn),不走回环端口,请求照常经过服务端拦截器;
+//   - 错误经 api/errors 写回,HTTP 状态码与 JSON 结构与 errors.WriteHTTP 一致,文案按 Accept-Language 本地化;
+//   - x-* 头与 Authorization 转发为 gRPC metadata,ctx 中的 api/metadata(上游中间件注入的租户、用户等)
+//     经 metadata/propagation 一并透传;
+//   - 服务端流式方法按 Accept 输出换行分隔 JSON(默认 / application/x-ndjson)或 SSE(text/event-stream);
+//   - 从同一份注解生成 OpenAPI 3 文档,默认挂在 /openapi.json。
+//
+// 用法:
+//
+//	grpcSrv := grpcserver.New(":9090", func(s *grpc.Server) { v1.RegisterGreeterServer(s, impl) })
+//	gw, err := grpcgw.New(":8080", grpcSrv, grpcgw.WithHandlers(v1.RegisterGreeterHandler))
+//	app := beauty.New(beauty.WithService(grpcSrv), beauty.WithService(gw))
 package grpcgw
 
-import "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
-func New() *runtime.ServeMux {
-	return runtime.NewServeMux()
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/api/metadata/propagation"
+	"github.com/rushteam/beauty/pkg/service/grpcserver"
+	"github.com/rushteam/beauty/pkg/service/logger"
+	"github.com/rushteam/beauty/pkg/service/webserver"
+	"google.golang.org/grpc"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterFunc 把一个 gRPC 服务的 REST 路由注册到 mux,签名与 protoc-gen-grpc-gateway
+// 生成的 RegisterXxxHandler 一致,可直接传入。
+type RegisterFunc func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// Option 配置 Gateway。
+type Option func(*options)
+
+type options struct {
+	name           string
+	handlers       []RegisterFunc
+	muxOpts        []runtime.ServeMuxOption
+	dialOpts       []grpc.DialOption
+	webOpts        []webserver.Option
+	forwardHeaders map[string]bool
+	openAPIPath    string
+	openAPITitle   string
+	openAPIVersion string
+}
+
+// WithServiceName 设置服务名,默认 "grpc-gateway"。
+func WithServiceName(name string) Option { return func(o *options) { o.name = name } }
+
+// WithHandlers 追加要挂载的生成代码注册函数。
+//
+//	grpcgw.WithHandlers(v1.RegisterGreeterHandler, v1.RegisterOrderHandler)
+func WithHandlers(fns ...RegisterFunc) Option {
+	return func(o *options) { o.handlers = append(o.handlers, fns...) }
+}
+
+// WithServeMuxOptions 追加 runtime.ServeMux 选项,排在内置选项之后,可覆盖错误处理、marshaler 等。
+func WithServeMuxOptions(opts ...runtime.ServeMuxOption) Option {
+	return func(o *options) { o.muxOpts = append(o.muxOpts, opts...) }
+}
+
+// WithDialOptions 追加进程内连接的拨号选项(如 grpcserver 配置了 TLS 时的传输凭证、客户端拦截器)。
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOpts = append(o.dialOpts, opts...) }
+}
+
+// WithWebServerOptions 透传给底层 webserver 的选项(中间件、超时、TLS 等)。
+func WithWebServerOptions(opts ...webserver.Option) Option {
+	return func(o *options) { o.webOpts = append(o.webOpts, opts...) }
+}
+
+// WithForwardHeaders 追加需要转发为 gRPC metadata 的 HTTP 头(x-* 与 Authorization 默认转发)。
+func WithForwardHeaders(names ...string) Option {
+	return func(o *options) {
+		for _, n := range names {
+			o.forwardHeaders[strings.ToLower(n)] = true
+		}
+	}
+}
+
+// WithOpenAPIPath 设置 OpenAPI 文档的路径,默认 "/openapi.json";空串不挂载。
+func WithOpenAPIPath(path string) Option { return func(o *options) { o.openAPIPath = path } }
+
+// WithOpenAPIInfo 设置 OpenAPI 文档的 info.title 与 info.version。
+func WithOpenAPIInfo(title, version string) Option {
+	return func(o *options) { o.openAPITitle, o.openAPIVersion = title, version }
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		name:           "grpc-gateway",
+		forwardHeaders: map[string]bool{"authorization": true},
+		openAPIPath:    "/openapi.json",
+		openAPIVersion: "1.0.0",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.openAPITitle == "" {
+		o.openAPITitle = o.name
+	}
+	return o
+}
+
+// Gateway 是 REST 网关服务,嵌入 webserver.Server,可直接交给 beauty.WithService。
+type Gateway struct {
+	*webserver.Server
+	mux      *runtime.ServeMux
+	conn     *grpc.ClientConn
+	services []string
+	opts     *options
+}
+
+// New 创建网关:进程内连接 target,挂载 WithHandlers 注册的路由,监听 addr。
+// target 的停止由其自身的 Start 管理,Gateway 停止时只关闭进程内连接。
+func New(addr string, target *grpcserver.Server, opts ...Option) (*Gateway, error) {
+	o := newOptions(opts)
+	conn, err := target.InProcessConn(o.dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("grpcgw: dial in-process: %w", err)
+	}
+	mux := newServeMux(o)
+	for _, fn := range o.handlers {
+		if err := fn(context.Background(), mux, conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("grpcgw: register handler: %w", err)
+		}
+	}
+	g := &Gateway{mux: mux, conn: conn, opts: o}
+	for name := range target.Server.GetServiceInfo() {
+		g.services = append(g.services, name)
+	}
+	webOpts := append([]webserver.Option{webserver.WithServiceName(o.name)}, o.webOpts...)
+	g.Server = webserver.New(addr, g.handler(), webOpts...)
+	return g, nil
 }
+
+// NewServeMux 返回带网关默认行为(错误映射、头转发、NDJSON / SSE marshaler)的 runtime.ServeMux,
+// 用于不经 gRPC 连接、直接调用实现的 RegisterXxxHandlerServer 场景。
+func NewServeMux(opts ...Option) *runtime.ServeMux {
+	return newServeMux(newOptions(opts))
+}
+
+// ServeMux 返回底层 runtime.ServeMux,可用 HandlePath 追加自定义路由。
+func (g *Gateway) ServeMux() *runtime.ServeMux { return g.mux }
+
+// Conn 返回网关使用的进程内 gRPC 连接。
+func (g *Gateway) Conn() *grpc.ClientConn { return g.conn }
+
+// OpenAPI 返回由 target 上已注册服务的 google.api.http 注解生成的 OpenAPI 3 文档(JSON)。
+func (g *Gateway) OpenAPI() ([]byte, error) {
+	return BuildOpenAPI(g.opts.openAPITitle, g.opts.openAPIVersion, g.services...)
+}
+
+// Start 启动 HTTP 服务,ctx 结束后优雅关闭并释放进程内连接。
+func (g *Gateway) Start(ctx context.Context) error {
+	defer g.conn.Close()
+	return g.Server.Start(ctx)
+}
+
+func (g *Gateway) handler() http.Handler {
+	doc := sync.OnceValues(g.OpenAPI)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.opts.openAPIPath != "" && r.URL.Path == g.opts.openAPIPath && r.Method == http.MethodGet {
+			b, err := doc()
+			if err != nil {
+				logger.Error("grpcgw: build openapi failed", "error", err)
+				http.Error(w, "openapi unavailable", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(b)
+			return
+		}
+		// 请求语言绑定到 ctx,流中途出错时 streamErrorHandler 据此本地化
+		g.mux.ServeHTTP(w, r.WithContext(perr.WithRequestLocales(r)))
+	})
+}
+
+func newServeMux(o *options) *runtime.ServeMux {
+	base := []runtime.ServeMuxOption{
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithStreamErrorHandler(streamErrorHandler),
+		runtime.WithIncomingHeaderMatcher(headerMatcher(o.forwardHeaders)),
+		runtime.WithMetadata(contextMetadata),
+		runtime.WithMarshalerOption(ContentTypeNDJSON, ndjsonMarshaler{newJSONPb()}),
+		runtime.WithMarshalerOption(ContentTypeSSE, sseMarshaler{newJSONPb()}),
+	}
+	return runtime.NewServeMux(append(base, o.muxOpts...)...)
+}
+
+// headerMatcher 转发 x-* 头(与 metadata/propagation 的透传约定一致)与白名单中的头,键名小写原样保留;
+// 其余交给 grpc-gateway 的默认规则(如 Accept-Language → grpcgateway-accept-language)。
+func headerMatcher(allow map[string]bool) runtime.HeaderMatcherFunc {
+	return func(key string) (string, bool) {
+		k := strings.ToLower(key)
+		if strings.HasPrefix(k, "x-") || allow[k] {
+			return k, true
+		}
+		return runtime.DefaultHeaderMatcher(key)
+	}
+}
+
+// contextMetadata 把 ctx 中的 api/metadata(上游 HTTP 中间件注入的)写入 gRPC metadata。
+func contextMetadata(ctx context.Context, _ *http.Request) grpcmd.MD {
+	md, _ := grpcmd.FromOutgoingContext(propagation.GRPCClientInject(ctx))
+	return md
+}
+
+// errorHandler 按 errors.WriteHTTP 的约定写错误响应;路由错误(404 / 405)保留其 HTTP 状态码。
+func errorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			for _, v := range vs {
+				w.Header().Add(runtime.MetadataHeaderPrefix+k, v)
+			}
+		}
+	}
+	var he *runtime.HTTPStatusError
+	if errors.As(err, &he) {
+		w = statusWriter{w, he.HTTPStatus}
+		err = he.Err
+	}
+	st, ok := perr.FromGRPCError(err)
+	if !ok {
+		st, _ = perr.FromError(err)
+	}
+	perr.WriteHTTPContext(perr.WithRequestLocales(r), w, st)
+}
+
+// streamErrorHandler 在流中途出错时附带本地化文案与 api/errors 详情。
+func streamErrorHandler(ctx context.Context, err error) *status.Status {
+	if st, ok := perr.FromGRPCError(err); ok {
+		return status.Convert(perr.ToGRPCContext(ctx, st))
+	}
+	return status.Convert(err)
+}
+
+// statusWriter 用固定的 HTTP 状态码替换 WriteHeader 的参数。
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w statusWriter) WriteHeader(int) { w.ResponseWriter.WriteHeader(w.code) }
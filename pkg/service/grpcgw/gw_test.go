@@ -0,0 +1,349 @@
+package grpcgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	perr "github.com/rushteam/beauty/pkg/api/errors"
+	"github.com/rushteam/beauty/pkg/api/metadata"
+	"github.com/rushteam/beauty/pkg/service/grpcserver"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// registerHealth 手写与生成代码等价的路由,把 grpc.health.v1.Health 暴露为 REST。
+func registerHealth(_ context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	client := healthpb.NewHealthClient(conn)
+	if err := mux.HandlePath(http.MethodGet, "/v1/health/{service}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/grpc.health.v1.Health/Check")
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		var md runtime.ServerMetadata
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: params["service"]}, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+	}); err != nil {
+		return err
+	}
+	return mux.HandlePath(http.MethodGet, "/v1/watch/{service}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/grpc.health.v1.Health/Watch")
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: params["service"]})
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		header, _ := stream.Header()
+		ctx = runtime.NewServerMetadataContext(ctx, runtime.ServerMetadata{HeaderMD: header})
+		runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) { return stream.Recv() })
+	})
+}
+
+type mdCapture struct {
+	mu sync.Mutex
+	md grpcmd.MD
+}
+
+func (c *mdCapture) intercept(ctx context.Context, req any, _ *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+	c.mu.Lock()
+	c.md, _ = grpcmd.FromIncomingContext(ctx)
+	c.mu.Unlock()
+	return h(ctx, req)
+}
+
+func (c *mdCapture) get(k string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v := c.md.Get(k); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func newTestGateway(t *testing.T, opts ...Option) (http.Handler, *mdCapture) {
+	t.Helper()
+	capture := &mdCapture{}
+	srv := grpcserver.New("127.0.0.1:0", nil, grpcserver.WithGrpcServerUnaryInterceptor(capture.intercept))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { srv.Start(ctx); close(done) }()
+	t.Cleanup(func() { cancel(); <-done })
+	<-srv.Ready()
+
+	gw, err := New("127.0.0.1:0", srv, append([]Option{WithHandlers(registerHealth)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gw.Conn().Close() })
+	return gw.Server.Handler, capture
+}
+
+func TestGatewayUnary(t *testing.T) {
+	h, capture := newTestGateway(t)
+	req := httptest.NewRequest(http.MethodGet, "/v1/health/", nil)
+	req.Header.Set("X-Tenant-Id", "t1")
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("Cookie", "sid=1")
+	req = req.WithContext(metadata.NewContext(req.Context(), metadata.MD{"x-user-id": "u1"}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"SERVING"`) {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+	for k, want := range map[string]string{"x-tenant-id": "t1", "authorization": "Bearer abc", "x-user-id": "u1", "cookie": ""} {
+		if got := capture.get(k); got != want {
+			t.Errorf("metadata %s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestGatewayForwardHeaders(t *testing.T) {
+	h, capture := newTestGateway(t, WithForwardHeaders("Cookie"))
+	req := httptest.NewRequest(http.MethodGet, "/v1/health/", nil)
+	req.Header.Set("Cookie", "sid=1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got := capture.get("cookie"); got != "sid=1" {
+		t.Fatalf("cookie = %q", got)
+	}
+}
+
+func TestGatewayErrorMatchesWriteHTTP(t *testing.T) {
+	h, _ := newTestGateway(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/health/missing", nil))
+
+	st, _ := perr.FromGRPCError(status.Error(codes.NotFound, "unknown service"))
+	want := httptest.NewRecorder()
+	perr.WriteHTTP(want, st)
+	if rec.Code != want.Code || rec.Body.String() != want.Body.String() {
+		t.Fatalf("got %d %s, want %d %s", rec.Code, rec.Body.String(), want.Code, want.Body.String())
+	}
+
+	// 路由错误同样是 api/errors 的 JSON 结构
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if rec.Code != http.StatusNotFound || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Code == 0 {
+		t.Fatalf("routing error: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGatewayStreaming(t *testing.T) {
+	h, _ := newTestGateway(t)
+	watch := func(accept string) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/v1/watch/", nil).WithContext(ctx)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := watch("")
+	first, _, _ := strings.Cut(rec.Body.String(), "\n")
+	if first != `{"result":{"status":"SERVING"}}` {
+		t.Fatalf("ndjson first line = %q", first)
+	}
+
+	rec = watch(ContentTypeNDJSON)
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeNDJSON {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	rec = watch(ContentTypeSSE)
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeSSE {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "data: {\"status\":\"SERVING\"}\n\n") {
+		t.Fatalf("sse body = %q", body)
+	}
+	// 请求超时结束流,错误作为 error 事件发出
+	if !strings.Contains(body, "event: error\ndata: ") {
+		t.Fatalf("sse error event missing: %q", body)
+	}
+}
+
+func TestGatewayOpenAPIEndpoint(t *testing.T) {
+	h, _ := newTestGateway(t, WithOpenAPIInfo("health", "v1"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string            `json:"openapi"`
+		Info    map[string]string `json:"info"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &doc) != nil || doc.Info["title"] != "health" {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSSEMarshaler(t *testing.T) {
+	m := sseMarshaler{newJSONPb()}
+	b, err := m.Marshal(map[string]any{"result": &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}})
+	if err != nil || string(b) != "data: {\"status\":\"SERVING\"}\n\n" {
+		t.Fatalf("result = %q, %v", b, err)
+	}
+	b, _ = m.Marshal(map[string]proto.Message{"error": status.New(codes.PermissionDenied, "no").Proto()})
+	if !bytes.HasPrefix(b, []byte("event: error\ndata: {")) || !bytes.HasSuffix(b, []byte("}\n\n")) {
+		t.Fatalf("error = %q", b)
+	}
+}
+
+// libraryFiles 构造一个带 google.api.http 注解的测试 proto 文件。
+func libraryFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+	s := proto.String
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: s(name), Number: proto.Int32(num), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = s(typeName)
+		}
+		return f
+	}
+	opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	rep := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	method := func(name, in, out string, rule *annotations.HttpRule, stream bool) *descriptorpb.MethodDescriptorProto {
+		o := &descriptorpb.MethodOptions{}
+		proto.SetExtension(o, annotations.E_Http, rule)
+		return &descriptorpb.MethodDescriptorProto{Name: s(name), InputType: s(in), OutputType: s(out), Options: o, ServerStreaming: proto.Bool(stream)}
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       s("library.proto"),
+		Package:    s("library.v1"),
+		Syntax:     s("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  s("View"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{{Name: s("BASIC"), Number: proto.Int32(0)}, {Name: s("FULL"), Number: proto.Int32(1)}},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: s("Book"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+				field("page_count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, opt, ""),
+				field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, rep, ""),
+				field("create_time", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".google.protobuf.Timestamp"),
+				field("sequel", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".library.v1.Book"),
+			}},
+			{Name: s("GetBookRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+				field("view", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, opt, ".library.v1.View"),
+				field("read_mask", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".library.v1.Book"),
+			}},
+			{Name: s("CreateBookRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("parent", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, opt, ""),
+				field("book", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, opt, ".library.v1.Book"),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: s("Library"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetBook", ".library.v1.GetBookRequest", ".library.v1.Book",
+					&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"}}, false),
+				method("CreateBook", ".library.v1.CreateBookRequest", ".library.v1.Book",
+					&annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Post{Post: "/v1/{parent=shelves/*}/books"}, Body: "book",
+						AdditionalBindings: []*annotations.HttpRule{{Pattern: &annotations.HttpRule_Put{Put: "/v1/{parent=shelves/*}/books"}, Body: "book"}},
+					}, false),
+				method("WatchBook", ".library.v1.GetBookRequest", ".library.v1.Book",
+					&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}:watch"}}, true),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestBuildOpenAPI(t *testing.T) {
+	b, err := buildOpenAPI(libraryFiles(t), "library", "1.0", []string{"library.v1.Library"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	get := doc.Paths["/v1/{name}"]["get"]
+	if get["operationId"] != "Library_GetBook" {
+		t.Fatalf("get op = %v", get)
+	}
+	params, _ := json.Marshal(get["parameters"])
+	for _, want := range []string{`"name":"name","required":true`, `"in":"query","name":"view"`, `"enum":["BASIC","FULL"]`} {
+		if !strings.Contains(string(params), want) {
+			t.Errorf("GetBook parameters %s missing %s", params, want)
+		}
+	}
+	if strings.Contains(string(params), "readMask") {
+		t.Errorf("message fields should not be query parameters: %s", params)
+	}
+
+	books := doc.Paths["/v1/{parent}/books"]
+	if books["post"]["operationId"] != "Library_CreateBook" || books["put"]["operationId"] != "Library_CreateBook_1" {
+		t.Fatalf("create ops = %v", books)
+	}
+	if body, _ := json.Marshal(books["post"]["requestBody"]); !strings.Contains(string(body), `#/components/schemas/library.v1.Book`) {
+		t.Errorf("requestBody = %s", body)
+	}
+
+	if watch, _ := json.Marshal(doc.Paths["/v1/{name}:watch"]["get"]["responses"]); !strings.Contains(string(watch), ContentTypeSSE) {
+		t.Errorf("stream responses = %s", watch)
+	}
+
+	book, _ := json.Marshal(doc.Components.Schemas["library.v1.Book"])
+	for _, want := range []string{`"pageCount":{"format":"int64","type":"string"}`, `"createTime":{"format":"date-time","type":"string"}`,
+		`"sequel":{"$ref":"#/components/schemas/library.v1.Book"}`, `"tags":{"items":{"type":"string"},"type":"array"}`} {
+		if !strings.Contains(string(book), want) {
+			t.Errorf("Book schema %s missing %s", book, want)
+		}
+	}
+	if _, ok := doc.Components.Schemas[errorSchemaName]; !ok {
+		t.Error("error schema missing")
+	}
+}
@@ -0,0 +1,69 @@
+package grpcgw
+
+import (
+	"bytes"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// 流式响应的内容类型,经请求的 Accept 头选择。
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeSSE    = "text/event-stream"
+)
+
+// newJSONPb 与 grpc-gateway 默认 marshaler 的配置一致。
+func newJSONPb() *runtime.JSONPb {
+	return &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+}
+
+// ndjsonMarshaler 输出换行分隔 JSON,每行一个 {"result": ...} 或 {"error": ...}。
+type ndjsonMarshaler struct{ *runtime.JSONPb }
+
+func (ndjsonMarshaler) ContentType(any) string { return ContentTypeNDJSON }
+
+func (ndjsonMarshaler) Delimiter() []byte { return []byte("\n") }
+
+// sseMarshaler 把每条流消息编码为一个 SSE 事件:消息本身作 data(不包 result),
+// 流中途的错误以 "event: error" 发出,data 为 google.rpc.Status。
+type sseMarshaler struct{ *runtime.JSONPb }
+
+func (sseMarshaler) ContentType(any) string { return ContentTypeSSE }
+
+// Delimiter 为空:Marshal 已输出以空行结尾的完整事件。
+func (sseMarshaler) Delimiter() []byte { return nil }
+
+func (m sseMarshaler) Marshal(v any) ([]byte, error) {
+	event := ""
+	switch chunk := v.(type) {
+	case map[string]any:
+		if r, ok := chunk["result"]; ok && len(chunk) == 1 {
+			v = r
+		}
+	case map[string]proto.Message:
+		if e, ok := chunk["error"]; ok && len(chunk) == 1 {
+			event, v = "error", e
+		}
+	}
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+	// protojson 的输出不含换行,保险起见仍按行拆成多条 data
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,329 @@
+package grpcgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// errorSchemaName 是错误响应(errors.WriteHTTP 的 JSON 结构)在 components.schemas 中的名字。
+const errorSchemaName = "beauty.api.Error"
+
+// descriptorFinder 由 *protoregistry.Files 实现。
+type descriptorFinder interface {
+	FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// BuildOpenAPI 根据 services(gRPC 服务全名)在全局 proto 注册表中的 google.api.http 注解生成
+// OpenAPI 3.0 文档(JSON)。没有注解的方法不出现在文档中。
+//
+// 字段名与转码行为一致:请求 / 响应体按 protojson 的 JSON 名,路径参数用注解中的字段路径;
+// 64 位整数为字符串,枚举为名称。生成代码不保留 proto 注释,文档不含字段说明。
+func BuildOpenAPI(title, version string, services ...string) ([]byte, error) {
+	return buildOpenAPI(protoregistry.GlobalFiles, title, version, services)
+}
+
+func buildOpenAPI(files descriptorFinder, title, version string, services []string) ([]byte, error) {
+	b := &openAPIBuilder{schemas: map[string]any{errorSchemaName: errorSchema()}}
+	paths := map[string]map[string]any{}
+	names := append([]string(nil), services...)
+	sort.Strings(names)
+	for _, name := range names {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("grpcgw: openapi: service %s: %w", name, err)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("grpcgw: openapi: %s is not a service", name)
+		}
+		methods := sd.Methods()
+		for i := range methods.Len() {
+			md := methods.Get(i)
+			rule, _ := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+			if rule == nil {
+				continue
+			}
+			for j, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+				verb, tmpl := httpPattern(r)
+				if verb == "" || tmpl == "" {
+					continue
+				}
+				path, pathFields := openAPIPath(tmpl)
+				opID := string(sd.Name()) + "_" + string(md.Name())
+				if j > 0 {
+					opID += fmt.Sprintf("_%d", j)
+				}
+				if paths[path] == nil {
+					paths[path] = map[string]any{}
+				}
+				paths[path][verb] = b.operation(sd, md, r, opID, pathFields)
+			}
+		}
+	}
+	doc := map[string]any{
+		"openapi":    "3.0.3",
+		"info":       map[string]any{"title": title, "version": version},
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.schemas},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// httpPattern 返回 OpenAPI 的小写方法名与路径模板;OpenAPI 不支持的自定义方法返回空。
+func httpPattern(r *annotations.HttpRule) (string, string) {
+	switch p := r.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "get", p.Get
+	case *annotations.HttpRule_Put:
+		return "put", p.Put
+	case *annotations.HttpRule_Post:
+		return "post", p.Post
+	case *annotations.HttpRule_Delete:
+		return "delete", p.Delete
+	case *annotations.HttpRule_Patch:
+		return "patch", p.Patch
+	case *annotations.HttpRule_Custom:
+		switch k := strings.ToLower(p.Custom.GetKind()); k {
+		case "head", "options", "trace":
+			return k, p.Custom.GetPath()
+		}
+	}
+	return "", ""
+}
+
+var pathVarRe = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// openAPIPath 把 "/v1/{name=shelves/*}/books" 转成 "/v1/{name}/books",并返回路径中的字段路径。
+func openAPIPath(tmpl string) (string, []string) {
+	var fields []string
+	path := pathVarRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		f := pathVarRe.FindStringSubmatch(m)[1]
+		fields = append(fields, f)
+		return "{" + f + "}"
+	})
+	return path, fields
+}
+
+type openAPIBuilder struct {
+	schemas map[string]any
+}
+
+func (b *openAPIBuilder) operation(sd protoreflect.ServiceDescriptor, md protoreflect.MethodDescriptor, r *annotations.HttpRule, opID string, pathFields []string) map[string]any {
+	in := md.Input()
+	var params []any
+	inPath := map[string]bool{}
+	for _, f := range pathFields {
+		inPath[f] = true
+		schema := map[string]any{"type": "string"}
+		if fd := lookupField(in, f); fd != nil {
+			schema = b.fieldSchema(fd)
+		}
+		params = append(params, map[string]any{"name": f, "in": "path", "required": true, "schema": schema})
+	}
+	op := map[string]any{
+		"operationId": opID,
+		"tags":        []string{string(sd.FullName())},
+	}
+	switch body := r.GetBody(); body {
+	case "*":
+		op["requestBody"] = jsonBody(b.messageSchema(in))
+	case "":
+		// 无 body:其余顶层标量字段可作查询参数
+		fields := in.Fields()
+		for i := range fields.Len() {
+			fd := fields.Get(i)
+			if inPath[string(fd.Name())] || !queryable(fd) {
+				continue
+			}
+			params = append(params, map[string]any{"name": fd.JSONName(), "in": "query", "schema": b.fieldSchema(fd)})
+		}
+	default:
+		if fd := lookupField(in, body); fd != nil {
+			op["requestBody"] = jsonBody(b.fieldSchema(fd))
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	out := b.messageSchema(md.Output())
+	if rb := r.GetResponseBody(); rb != "" {
+		if fd := lookupField(md.Output(), rb); fd != nil {
+			out = b.fieldSchema(fd)
+		}
+	}
+	var content map[string]any
+	if md.IsStreamingServer() {
+		chunk := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"result": out,
+				"error":  map[string]any{"type": "object"},
+			},
+		}
+		content = map[string]any{
+			"application/json": map[string]any{"schema": chunk},
+			ContentTypeNDJSON:  map[string]any{"schema": chunk},
+			ContentTypeSSE:     map[string]any{"schema": out},
+		}
+	} else {
+		content = map[string]any{"application/json": map[string]any{"schema": out}}
+	}
+	op["responses"] = map[string]any{
+		"200":     map[string]any{"description": "OK", "content": content},
+		"default": map[string]any{"description": "Error", "content": map[string]any{"application/json": map[string]any{"schema": ref(errorSchemaName)}}},
+	}
+	return op
+}
+
+func jsonBody(schema map[string]any) map[string]any {
+	return map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{"schema": schema}}}
+}
+
+func ref(name string) map[string]any { return map[string]any{"$ref": "#/components/schemas/" + name} }
+
+// lookupField 按 "a.b.c"(proto 字段名)在 md 中查找字段。
+func lookupField(md protoreflect.MessageDescriptor, path string) protoreflect.FieldDescriptor {
+	var fd protoreflect.FieldDescriptor
+	for seg := range strings.SplitSeq(path, ".") {
+		if md == nil {
+			return nil
+		}
+		fd = md.Fields().ByName(protoreflect.Name(seg))
+		if fd == nil {
+			return nil
+		}
+		md = fd.Message()
+	}
+	return fd
+}
+
+// queryable 判断字段能否以查询参数传递:标量、枚举及其 repeated,以及按字符串 / 标量编码的 well-known 类型。
+func queryable(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() {
+		return false
+	}
+	if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind {
+		return true
+	}
+	s, ok := wellKnownSchemas[fd.Message().FullName()]
+	return ok && s["type"] != "object" && s["type"] != "array" && len(s) > 0
+}
+
+func (b *openAPIBuilder) fieldSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	if fd.IsMap() {
+		return map[string]any{"type": "object", "additionalProperties": b.singularSchema(fd.MapValue())}
+	}
+	s := b.singularSchema(fd)
+	if fd.IsList() {
+		return map[string]any{"type": "array", "items": s}
+	}
+	return s
+}
+
+func (b *openAPIBuilder) singularSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return map[string]any{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]any{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return map[string]any{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range values.Len() {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]any{"type": "string", "enum": names}
+	default:
+		return b.messageSchema(fd.Message())
+	}
+}
+
+// messageSchema 返回消息的 $ref,首次遇到时把定义写入 components.schemas(先占位以支持递归消息)。
+func (b *openAPIBuilder) messageSchema(md protoreflect.MessageDescriptor) map[string]any {
+	if s, ok := wellKnownSchemas[md.FullName()]; ok {
+		return s
+	}
+	name := string(md.FullName())
+	if _, ok := b.schemas[name]; !ok {
+		b.schemas[name] = nil
+		props := map[string]any{}
+		fields := md.Fields()
+		for i := range fields.Len() {
+			fd := fields.Get(i)
+			props[fd.JSONName()] = b.fieldSchema(fd)
+		}
+		s := map[string]any{"type": "object"}
+		if len(props) > 0 {
+			s["properties"] = props
+		}
+		b.schemas[name] = s
+	}
+	return ref(name)
+}
+
+// wellKnownSchemas 是按 protojson 特殊编码的 well-known 类型。
+var wellKnownSchemas = map[protoreflect.FullName]map[string]any{
+	"google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+	"google.protobuf.Duration":    {"type": "string", "example": "1.5s"},
+	"google.protobuf.FieldMask":   {"type": "string"},
+	"google.protobuf.Struct":      {"type": "object", "additionalProperties": true},
+	"google.protobuf.Value":       {},
+	"google.protobuf.ListValue":   {"type": "array", "items": map[string]any{}},
+	"google.protobuf.Empty":       {"type": "object"},
+	"google.protobuf.Any":         {"type": "object", "properties": map[string]any{"@type": map[string]any{"type": "string"}}, "additionalProperties": true},
+	"google.protobuf.DoubleValue": {"type": "number", "format": "double"},
+	"google.protobuf.FloatValue":  {"type": "number", "format": "float"},
+	"google.protobuf.Int64Value":  {"type": "string", "format": "int64"},
+	"google.protobuf.UInt64Value": {"type": "string", "format": "uint64"},
+	"google.protobuf.Int32Value":  {"type": "integer", "format": "int32"},
+	"google.protobuf.UInt32Value": {"type": "integer", "format": "int64", "minimum": 0},
+	"google.protobuf.BoolValue":   {"type": "boolean"},
+	"google.protobuf.StringValue": {"type": "string"},
+	"google.protobuf.BytesValue":  {"type": "string", "format": "byte"},
+	"google.api.HttpBody":         {"type": "string", "format": "binary"},
+}
+
+// errorSchema 描述 errors.WriteHTTP 写出的 JSON。
+func errorSchema() map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"code", "message"},
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "integer", "format": "int32"},
+			"message": map[string]any{"type": "string"},
+			"details": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"type": map[string]any{"type": "string"},
+						"data": map[string]any{"type": "object"},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// errInProcessClosed 表示 Server 已停止,进程内连接不可再建立。
+var errInProcessClosed = errors.New("grpcserver: in-process listener closed")
+
+// pipeListener 是进程内 net.Listener:Dial 用 net.Pipe 造一对连接,服务端一端交给 Accept。
+// 与 Start 监听的 TCP 端口共用同一个 grpc.Server(拦截器、stats handler、健康检查一致)。
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errInProcessClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+// dial 在 Server 开始 Serve 之前会阻塞,直到 Accept 或 ctx 结束。
+func (l *pipeListener) dial(ctx context.Context, _ string) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+	case <-ctx.Done():
+	}
+	server.Close()
+	client.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, errInProcessClosed
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "inprocess" }
+
+// InProcessConn 返回直连本 Server 的客户端连接,不经过网络端口(同进程的 REST 网关、
+// 后台任务调用本服务时使用)。请求照常经过服务端的全部拦截器与 stats handler。
+// 连接懒建立,Start 之前发起的调用会等待 Server 就绪;Server 停止后调用返回 Unavailable。
+// 默认明文,Server 配置了 TLS 时需在 opts 中传入对应的传输凭证。
+func (s *Server) InProcessConn(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithContextDialer(s.inproc.dial),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	return grpc.NewClient("passthrough:///inprocess", dialOpts...)
+}
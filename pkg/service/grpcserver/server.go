@@ -141,6 +141,7 @@ func New(addr string, handler func(*grpc.Server), opts ...Option) *Server {
 		addr:                addr,
 		ready:               make(chan struct{}),
 		gracefulStopTimeout: 30 * time.Second,
+		inproc:              newPipeListener(),
 		Server:              nil,
 	}
 
@@ -201,6 +202,7 @@ type Server struct {
 	gracefulStopTimeout time.Duration
 	Server              *grpc.Server
 	healthServer        *health.Server
+	inproc              *pipeListener
 
 	// 服务发现相关字段
 	serviceDiscovery *ServiceDiscovery
@@ -246,6 +248,11 @@ func (s *Server) Start(ctx context.Context) error {
 			logger.Error("grpc server serve failed", "error", err)
 		}
 	}()
+	go func() {
+		if err := s.Server.Serve(s.inproc); err != nil && err != grpc.ErrServerStopped {
+			logger.Error("grpc in-process serve failed", "error", err)
+		}
+	}()
 	<-ctx.Done()
 	logger.Info("grpc server stopping...")
 	s.healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)